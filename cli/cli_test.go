@@ -1,10 +1,22 @@
 package cli
 
 import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/digitorus/pdfsign/sign"
+	"github.com/digitorus/pdfsign/verify"
 )
 
 func TestParseCertType(t *testing.T) {
@@ -40,6 +52,59 @@ func TestParseCertType(t *testing.T) {
 	}
 }
 
+func TestParseCommitmentType(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected sign.CommitmentType
+		wantErr  bool
+	}{
+		{"", 0, false},
+		{"ProofOfOrigin", sign.ProofOfOrigin, false},
+		{"ProofOfApproval", sign.ProofOfApproval, false},
+		{"ProofOfCreation", sign.ProofOfCreation, false},
+		{"proofOfOrigin", 0, true},
+	}
+	for _, tt := range tests {
+		result, err := ParseCommitmentType(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseCommitmentType(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+		}
+		if result != tt.expected {
+			t.Errorf("ParseCommitmentType(%q) = %v, want %v", tt.input, result, tt.expected)
+		}
+	}
+}
+
+func TestSignaturePolicyConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.pdf")
+	if err := os.WriteFile(path, []byte("policy"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := SignaturePolicyConfig("2.16.724.1.3.1.1.2.1.9", path, "https://example.com/policy.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.OID.String() != "2.16.724.1.3.1.1.2.1.9" || string(policy.Document) != "policy" || policy.URL != "https://example.com/policy.pdf" {
+		t.Errorf("unexpected signature policy %+v", policy)
+	}
+
+	if policy, err := SignaturePolicyConfig("", "", ""); err != nil || policy != nil {
+		t.Errorf("expected no signature policy, got %v, %v", policy, err)
+	}
+	for _, args := range [][3]string{
+		{"", path, ""},
+		{"1.2.x", path, ""},
+		{"1", path, ""},
+		{"1.2.3", "", ""},
+		{"1.2.3", filepath.Join(t.TempDir(), "missing.pdf"), ""},
+	} {
+		if _, err := SignaturePolicyConfig(args[0], args[1], args[2]); err == nil {
+			t.Errorf("expected an error for %q", args)
+		}
+	}
+}
+
 func TestUsage(t *testing.T) {
 	origArgs := os.Args
 	defer func() { os.Args = origArgs }()
@@ -129,3 +194,211 @@ func TestSignCommand_FlagParsing(t *testing.T) {
 		t.Error("SignPDF should not be called for insufficient args")
 	}
 }
+
+func TestParsePrivateKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecDER, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8DER, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		der  []byte
+	}{
+		{"PKCS1", x509.MarshalPKCS1PrivateKey(rsaKey)},
+		{"SEC1", ecDER},
+		{"PKCS8", pkcs8DER},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParsePrivateKey(tt.der); err != nil {
+				t.Errorf("ParsePrivateKey() error = %v", err)
+			}
+		})
+	}
+
+	if _, err := ParsePrivateKey([]byte("invalid")); err == nil {
+		t.Error("expected an error for an invalid key")
+	}
+}
+
+func TestParseSigningTime(t *testing.T) {
+	got, err := ParseSigningTime("2024-03-01T12:00:00+01:00")
+	if err != nil {
+		t.Fatalf("ParseSigningTime() error = %v", err)
+	}
+	if want := time.Date(2024, time.March, 1, 11, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("ParseSigningTime() = %v, want %v", got, want)
+	}
+
+	if _, err := ParseSigningTime("2024-03-01"); err == nil {
+		t.Errorf("ParseSigningTime() expected an error for a date without time")
+	}
+
+	if got, err := ParseSigningTime(""); err != nil || got.IsZero() {
+		t.Errorf("ParseSigningTime() expected the current time, got %v, %v", got, err)
+	}
+}
+
+func TestReadSecret(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+	if _, err := w.WriteString("123456\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	_ = w.Close()
+
+	if pin, err := ReadSecret(r, ""); err != nil || pin != "123456" {
+		t.Errorf("ReadSecret() = %q, %v, want 123456", pin, err)
+	}
+	if _, err := ReadSecret(r, ""); err == nil {
+		t.Error("ReadSecret() expected an error at the end of the input")
+	}
+}
+
+func TestIsPKCS12(t *testing.T) {
+	for path, expected := range map[string]bool{
+		"signer.p12":  true,
+		"signer.PFX":  true,
+		"signer.crt":  false,
+		"p12":         false,
+		"signer.p12/": false,
+	} {
+		if IsPKCS12(path) != expected {
+			t.Errorf("IsPKCS12(%q) = %v, want %v", path, !expected, expected)
+		}
+	}
+}
+
+func TestHeaderFlags(t *testing.T) {
+	var headers HeaderFlags
+	if err := headers.Set("X-Api-Key: secret"); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	for _, invalid := range []string{"X-Api-Key", ": secret"} {
+		if err := headers.Set(invalid); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+	if len(headers) != 1 {
+		t.Errorf("expected 1 header, got %d", len(headers))
+	}
+}
+
+func TestTSAConfig(t *testing.T) {
+	defer func(user, proxy, ca string, headers HeaderFlags) {
+		TSAUser, TSAProxy, TSACA, TSAHeaders = user, proxy, ca, headers
+	}(TSAUser, TSAProxy, TSACA, TSAHeaders)
+
+	t.Setenv("PDFSIGN_TSA_PASSWORD", "secret")
+	t.Setenv("PDFSIGN_TSA_TOKEN", "token")
+	TSAUser = "user"
+	TSAProxy = "http://proxy.example.com:3128"
+	TSAHeaders = HeaderFlags{"X-Api-Key: key", "X-Api-Key:  other "}
+
+	tsa, err := TSAConfig("https://tsa.example.com/")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if tsa.Username != "user" || tsa.Password != "secret" || tsa.Token != "token" {
+		t.Errorf("unexpected credentials %q, %q, %q", tsa.Username, tsa.Password, tsa.Token)
+	}
+	if values := tsa.Header.Values("X-Api-Key"); len(values) != 2 || values[1] != "other" {
+		t.Errorf("unexpected headers %q", values)
+	}
+	if tsa.Proxy == nil || tsa.Proxy.Host != "proxy.example.com:3128" {
+		t.Errorf("unexpected proxy %v", tsa.Proxy)
+	}
+
+	tsa, err = TSAConfig("https://tsa.example.com/, https://backup.example.com/")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if tsa.URL != "https://tsa.example.com/" || len(tsa.Fallbacks) != 1 || tsa.Fallbacks[0].URL != "https://backup.example.com/" {
+		t.Errorf("unexpected TSA %s with fallbacks %v", tsa.URL, tsa.Fallbacks)
+	}
+	if tsa.Fallbacks[0].Token != "token" {
+		t.Errorf("expected the fallback to use the settings of the TSA")
+	}
+
+	TSACA = "../testfiles/testfile20.pdf"
+	if _, err := TSAConfig("https://tsa.example.com/"); err == nil {
+		t.Errorf("expected an error for a file without certificates")
+	}
+}
+
+func TestSignPDFEd25519(t *testing.T) {
+	defer func(certType, tsa string, pdf20 bool) {
+		CertType, TSA, PDF20 = certType, tsa, pdf20
+	}(CertType, TSA, PDF20)
+	CertType, TSA, PDF20 = sign.ApprovalSignature.String(), "", true
+
+	public, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "pdfsign Ed25519 Signer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, public, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "signer.crt"), filepath.Join(dir, "signer.key")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	input, output := "../testfiles/testfile20.pdf", filepath.Join(dir, "signed.pdf")
+	signPDFImpl(input, []string{input, output, certPath, keyPath})
+
+	signed, err := os.Open(output)
+	if err != nil {
+		t.Fatalf("expected a signed document: %v", err)
+	}
+	defer func() {
+		_ = signed.Close()
+	}()
+	options := verify.DefaultVerifyOptions()
+	options.AllowUntrustedRoots = true
+	response, err := verify.VerifyFileWithOptions(signed, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Signers) != 1 || !response.Signers[0].ValidSignature {
+		t.Fatalf("expected a valid signature, got %+v", response.Signers)
+	}
+	if digest := response.Signers[0].DigestAlgorithm; digest != "SHA-512" {
+		t.Errorf("expected a SHA-512 digest of the Ed25519 signature, got %s", digest)
+	}
+}
@@ -0,0 +1,28 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ReadSecret prints prompt to stderr and reads a PIN or password from f,
+// without echo when f is a terminal.
+func ReadSecret(f *os.File, prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+
+	restore, err := disableEcho(f)
+	if err == nil {
+		defer func() {
+			restore()
+			fmt.Fprintln(os.Stderr)
+		}()
+	}
+
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read secret: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
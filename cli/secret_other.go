@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package cli
+
+import (
+	"errors"
+	"os"
+)
+
+// disableEcho is not supported, the PIN is echoed.
+func disableEcho(*os.File) (func(), error) {
+	return nil, errors.New("disabling the terminal echo is not supported")
+}
@@ -2,23 +2,63 @@ package cli
 
 import (
 	"crypto"
+	"crypto/tls"
 	"crypto/x509"
+	"encoding/asn1"
 	"encoding/pem"
 	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/digitorus/pdfsign/sign"
+	"github.com/digitorus/pdfsign/signer/cng"
+	"github.com/digitorus/pdfsign/signer/keychain"
+	"github.com/digitorus/pdfsign/signer/piv"
+	"github.com/digitorus/pdfsign/signer/pkcs12"
 )
 
 var (
 	InfoName, InfoLocation, InfoReason, InfoContact, TSA string
-	CertType                                             string
+	CertType, Commitment                                 string
+	PolicyOID, PolicyDocument, PolicyURL                 string
+	DocMDP                                               uint
+	FieldName                                            string
+	PSS, PDF20, Deterministic, CAdES, LegacySHA1, PKCS1  bool
+	OCSP, CRL, RepairXref, UpdateMetadata                bool
+	SigningTime                                          string
+	PIVSlot, PIVReader                                   string
+	StoreThumbprint, StoreSubject                        string
+	StoreMachine                                         bool
+	TSAUser, TSACert, TSAKey, TSACA, TSAProxy            string
+	TSAHeaders                                           HeaderFlags
+	TSARetries                                           int
+	TSATimeout                                           time.Duration
 )
 
+// HeaderFlags collects the values of a repeatable "Name: value" flag.
+type HeaderFlags []string
+
+func (h *HeaderFlags) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *HeaderFlags) Set(value string) error {
+	if name, _, ok := strings.Cut(value, ":"); !ok || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("invalid header %q, expected Name: value", value)
+	}
+	*h = append(*h, value)
+	return nil
+}
+
 func ParseCertType(s string) (sign.CertType, error) {
 	switch s {
 	case sign.CertificationSignature.String():
@@ -34,6 +74,52 @@ func ParseCertType(s string) (sign.CertType, error) {
 	}
 }
 
+// ParseCommitmentType parses the name of a commitment type, an empty string
+// is no commitment type.
+func ParseCommitmentType(s string) (sign.CommitmentType, error) {
+	if s == "" {
+		return 0, nil
+	}
+	for commitment := sign.ProofOfOrigin; commitment <= sign.ProofOfCreation; commitment++ {
+		if commitment.String() == s {
+			return commitment, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid commitment value")
+}
+
+// SignaturePolicyConfig returns the signature policy of the dotted policy OID
+// and the policy document at path, nil if oid is empty.
+func SignaturePolicyConfig(oid, path, url string) (*sign.SignaturePolicy, error) {
+	if oid == "" {
+		if path != "" || url != "" {
+			return nil, errors.New("-policy-document and -policy-url require -policy-oid")
+		}
+		return nil, nil
+	}
+
+	var identifier asn1.ObjectIdentifier
+	for _, arc := range strings.Split(oid, ".") {
+		n, err := strconv.Atoi(arc)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid signature policy OID %q", oid)
+		}
+		identifier = append(identifier, n)
+	}
+	if len(identifier) < 2 {
+		return nil, fmt.Errorf("invalid signature policy OID %q", oid)
+	}
+	if path == "" {
+		return nil, errors.New("-policy-oid requires -policy-document")
+	}
+
+	document, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signature policy: %w", err)
+	}
+	return &sign.SignaturePolicy{OID: identifier, Document: document, URL: url}, nil
+}
+
 func SignCommand() {
 	signFlags := flag.NewFlagSet("sign", flag.ExitOnError)
 
@@ -41,17 +127,52 @@ func SignCommand() {
 	signFlags.StringVar(&InfoLocation, "location", "", "Location of the signatory")
 	signFlags.StringVar(&InfoReason, "reason", "", "Reason for signing")
 	signFlags.StringVar(&InfoContact, "contact", "", "Contact information for signatory")
-	signFlags.StringVar(&TSA, "tsa", "https://freetsa.org/tsr", "URL for Time-Stamp Authority")
+	signFlags.StringVar(&TSA, "tsa", "https://freetsa.org/tsr", "URL for Time-Stamp Authority, or a comma separated list of URLs that are tried in order")
+	signFlags.StringVar(&TSAUser, "tsa-user", "", "User of the TSA basic authentication, the password is read from PDFSIGN_TSA_PASSWORD")
+	signFlags.Var(&TSAHeaders, "tsa-header", "Additional \"Name: value\" header of the TSA requests, can be repeated; a bearer token is read from PDFSIGN_TSA_TOKEN")
+	signFlags.StringVar(&TSACert, "tsa-cert", "", "PEM client certificate for TSAs that require mutual TLS")
+	signFlags.StringVar(&TSAKey, "tsa-key", "", "PEM private key of the TSA client certificate")
+	signFlags.StringVar(&TSACA, "tsa-ca", "", "PEM roots of the TSA server certificate, instead of the system roots")
+	signFlags.IntVar(&TSARetries, "tsa-retries", 2, "Retries of a TSA that times out or fails with a server error, before the next TSA is tried")
+	signFlags.DurationVar(&TSATimeout, "tsa-timeout", 30*time.Second, "Timeout of a TSA request")
+	signFlags.StringVar(&TSAProxy, "tsa-proxy", "", "Proxy URL of the TSA requests, defaults to HTTPS_PROXY or HTTP_PROXY")
 	signFlags.StringVar(&CertType, "certType", "CertificationSignature", "Type of the certificate (CertificationSignature, ApprovalSignature, UsageRightsSignature, TimeStampSignature)")
+	signFlags.StringVar(&Commitment, "commitment", "", "Commitment type of the signature (ProofOfOrigin, ProofOfReceipt, ProofOfDelivery, ProofOfSender, ProofOfApproval, ProofOfCreation), used as reason if -reason is empty without -cades")
+	signFlags.StringVar(&PolicyOID, "policy-oid", "", "Dotted OID of the signature policy the signature claims conformance to")
+	signFlags.StringVar(&PolicyDocument, "policy-document", "", "File of the signature policy, its SHA-256 digest is part of the signature")
+	signFlags.StringVar(&PolicyURL, "policy-url", "", "URL where the signature policy can be retrieved")
+	signFlags.StringVar(&FieldName, "field", "", "Name of an existing empty signature field to sign")
+	signFlags.BoolVar(&PSS, "pss", false, "Sign with RSASSA-PSS instead of PKCS #1 v1.5")
+	signFlags.BoolVar(&CAdES, "cades", false, "Create an ETSI.CAdES.detached signature instead of adbe.pkcs7.detached")
+	signFlags.BoolVar(&LegacySHA1, "sha1", false, "Create a legacy adbe.pkcs7.sha1 signature with a SHA-1 digest, for validators that require it")
+	signFlags.BoolVar(&PKCS1, "pkcs1", false, "Create a legacy adbe.x509.rsa_sha1 PKCS #1 signature of an RSA key with a SHA-1 digest, without a timestamp")
+	signFlags.BoolVar(&OCSP, "ocsp", false, "Embed OCSP responses for the signing certificate and its issuers, so the signature can be validated offline")
+	signFlags.BoolVar(&CRL, "crl", false, "Embed the CRLs of the signing certificate and its issuers in the CMS, large CRLs are logged")
+	signFlags.BoolVar(&PDF20, "pdf20", false, "Allow PDF 2.0 features such as Ed25519 signatures, raises the document version to 2.0")
+	signFlags.BoolVar(&Deterministic, "deterministic", false, "Create identical output for identical input, requires -time and a TSA that returns a fixed response")
+	signFlags.BoolVar(&RepairXref, "repair-xref", false, "Rebuild a corrupt cross-reference table from the objects of the document before signing")
+	signFlags.BoolVar(&UpdateMetadata, "update-metadata", false, "Set the modification date of the document information and XMP metadata to the signing date")
+	signFlags.StringVar(&SigningTime, "time", "", "Signing time in RFC 3339 format, defaults to the current time")
+	signFlags.StringVar(&PIVSlot, "piv-slot", "", "Sign with the key in a YubiKey PIV slot (9a or 9c) instead of a key file, the PIN is read from PDFSIGN_PIV_PIN or the terminal")
+	signFlags.StringVar(&PIVReader, "piv-reader", "", "Name, or part of the name, of the smart card reader of the YubiKey")
+	signFlags.StringVar(&StoreThumbprint, "store-thumbprint", "", "Sign with the certificate with this SHA-1 thumbprint in the Windows certificate store or the macOS Keychain instead of a key file")
+	signFlags.StringVar(&StoreSubject, "store-subject", "", "Sign with the first valid certificate whose subject contains this text in the Windows certificate store or the macOS Keychain")
+	signFlags.BoolVar(&StoreMachine, "store-machine", false, "Use the personal store of the computer instead of the current user, Windows only")
+	signFlags.UintVar(&DocMDP, "docMDP", uint(sign.AllowFillingExistingFormFieldsAndSignaturesPerms), "DocMDP permission level of a certification signature (1: no changes, 2: form filling and signing, 3: form filling, signing and annotations)")
 
 	signFlags.Usage = func() {
-		fmt.Printf("Usage: %s sign [options] <input.pdf> <output.pdf> <certificate.crt> <private_key.key> [chain.crt]\n\n", os.Args[0])
+		fmt.Printf("Usage: %s sign [options] <input.pdf> <output.pdf> <certificate.crt> <private_key.key> [chain.crt]\n", os.Args[0])
+		fmt.Printf("       %s sign [options] <input.pdf> <output.pdf> <bundle.p12> [chain.crt]\n\n", os.Args[0])
 		fmt.Println("Sign a PDF file with a digital signature")
 		fmt.Println("\nOptions:")
 		signFlags.PrintDefaults()
+		fmt.Println("\nEncrypted documents are opened with the user or owner password in PDFSIGN_PDF_PASSWORD.")
 		fmt.Println("\nExamples:")
 		fmt.Printf("  %s sign -name \"John Doe\" input.pdf output.pdf cert.crt key.key\n", os.Args[0])
+		fmt.Printf("  %s sign -name \"John Doe\" input.pdf output.pdf signer.p12\n", os.Args[0])
 		fmt.Printf("  %s sign -certType \"TimeStampSignature\" input.pdf output.pdf\n", os.Args[0])
+		fmt.Printf("  %s sign -piv-slot 9c -name \"John Doe\" input.pdf output.pdf [chain.crt]\n", os.Args[0])
+		fmt.Printf("  %s sign -store-subject \"John Doe\" input.pdf output.pdf\n", os.Args[0])
 	}
 
 	if err := signFlags.Parse(os.Args[2:]); err != nil {
@@ -75,6 +196,14 @@ func signPDFImpl(input string, args []string) {
 	if err != nil {
 		log.Fatal(err)
 	}
+	commitment, err := ParseCommitmentType(Commitment)
+	if err != nil {
+		log.Fatal(err)
+	}
+	policy, err := SignaturePolicyConfig(PolicyOID, PolicyDocument, PolicyURL)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	if certTypeValue == sign.TimeStampSignature {
 		if len(args) < 2 {
@@ -86,20 +215,106 @@ func signPDFImpl(input string, args []string) {
 		return
 	}
 
-	if len(args) < 4 {
-		fmt.Fprintf(os.Stderr, "Signing requires: input.pdf output.pdf certificate.crt private_key.key [chain.crt]\n")
-		osExit(1)
+	var output string
+	var cert *x509.Certificate
+	var pkey crypto.Signer
+	var certificateChains [][]*x509.Certificate
+	if PIVSlot != "" || StoreThumbprint != "" || StoreSubject != "" {
+		if len(args) < 2 {
+			fmt.Fprintf(os.Stderr, "Signing with a PIV slot or the certificate store requires: input.pdf output.pdf [chain.crt]\n")
+			osExit(1)
+		}
+		output = args[1]
+
+		var signer tokenSigner
+		if PIVSlot != "" {
+			signer = OpenPIV(PIVSlot, PIVReader)
+		} else {
+			signer = OpenCertificateStore(StoreThumbprint, StoreSubject, StoreMachine)
+		}
+		defer func() {
+			_ = signer.Close()
+		}()
+		pkey = signer
+		// Without a chain file, the chain of the signer is used.
+		if len(args) > 2 {
+			chain, _ := signer.CertificateChain()
+			cert = chain[0]
+			certificateChains = LoadCertificateChain(args[2], cert)
+		}
+	} else if len(args) > 2 && IsPKCS12(args[2]) {
+		output = args[1]
+		bundle := LoadPKCS12(args[2])
+		cert, pkey = bundle.Certificate, bundle
+		if len(args) > 3 {
+			certificateChains = LoadCertificateChain(args[3], cert)
+		} else {
+			certificateChains = [][]*x509.Certificate{bundle.Chain}
+		}
+	} else {
+		if len(args) < 4 {
+			fmt.Fprintf(os.Stderr, "Signing requires: input.pdf output.pdf certificate.crt private_key.key [chain.crt], or input.pdf output.pdf bundle.p12 [chain.crt]\n")
+			osExit(1)
+		}
+
+		output = args[1]
+		certPath := args[2]
+		keyPath := args[3]
+		var chainPath string
+		if len(args) > 4 {
+			chainPath = args[4]
+		}
+
+		cert, pkey, certificateChains = LoadCertificatesAndKey(certPath, keyPath, chainPath)
+	}
+
+	signingTime, err := ParseSigningTime(SigningTime)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if Deterministic && SigningTime == "" {
+		log.Fatal("deterministic signing requires -time")
+	}
+
+	tsa, err := TSAConfig(TSA)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	output := args[1]
-	certPath := args[2]
-	keyPath := args[3]
-	var chainPath string
-	if len(args) > 4 {
-		chainPath = args[4]
+	var signatureAlgorithm sign.SignatureAlgorithm
+	if PSS {
+		signatureAlgorithm = sign.RSAPSS
+	}
+	// Without a digest algorithm the library chooses the digest of the key,
+	// SHA-512 for Ed25519 and SHA-256 otherwise.
+	var subFilter sign.SubFilter
+	var digestAlgorithm crypto.Hash
+	switch {
+	case CAdES && LegacySHA1, CAdES && PKCS1, LegacySHA1 && PKCS1:
+		log.Fatal("only one of -cades, -sha1 and -pkcs1 can be used")
+	case CAdES:
+		subFilter = sign.SubFilterETSICAdESDetached
+	case LegacySHA1:
+		subFilter = sign.SubFilterAdbePKCS7SHA1
+		digestAlgorithm = crypto.SHA1
+	case PKCS1:
+		// PKCS #1 signatures can not hold a signature timestamp.
+		subFilter = sign.SubFilterAdbeX509RSASHA1
+		digestAlgorithm = crypto.SHA1
+		tsa = sign.TSA{}
 	}
 
-	cert, pkey, certificateChains := LoadCertificatesAndKey(certPath, keyPath, chainPath)
+	if PKCS1 && (OCSP || CRL) {
+		log.Fatal("-ocsp and -crl can not be used with -pkcs1")
+	}
+	var revocationFunction sign.RevocationFunction
+	if OCSP {
+		revocationFunction = sign.DefaultOCSPFetcher.Embed
+	}
+	var crlFetcher *sign.CRLFetcher
+	if CRL {
+		crlFetcher = sign.DefaultCRLFetcher
+	}
 
 	err = sign.SignFile(input, output, sign.SignData{
 		Signature: sign.SignDataSignature{
@@ -108,17 +323,31 @@ func signPDFImpl(input string, args []string) {
 				Location:    InfoLocation,
 				Reason:      InfoReason,
 				ContactInfo: InfoContact,
-				Date:        time.Now().Local(),
+				Date:        signingTime,
 			},
-			CertType:   certTypeValue,
-			DocMDPPerm: sign.AllowFillingExistingFormFieldsAndSignaturesPerms,
+			CertType:         certTypeValue,
+			DocMDPPerm:       sign.DocMDPPerm(DocMDP),
+			CommitmentType:   commitment,
+			CommitmentReason: commitment != 0 && !CAdES,
 		},
-		Signer:            pkey,
-		DigestAlgorithm:   crypto.SHA256,
-		Certificate:       cert,
-		CertificateChains: certificateChains,
-		TSA: sign.TSA{
-			URL: TSA,
+		Signer:             pkey,
+		DigestAlgorithm:    digestAlgorithm,
+		Certificate:        cert,
+		CertificateChains:  certificateChains,
+		TSA:                tsa,
+		RevocationFunction: revocationFunction,
+		CRLFetcher:         crlFetcher,
+		FieldName:          FieldName,
+		SignatureAlgorithm: signatureAlgorithm,
+		SubFilter:          subFilter,
+		SignaturePolicy:    policy,
+		PDF20:              PDF20,
+		Deterministic:      Deterministic,
+		Password:           os.Getenv("PDFSIGN_PDF_PASSWORD"),
+		RepairXref:         RepairXref,
+		UpdateMetadata:     UpdateMetadata,
+		OnLinearized: func(int64) {
+			log.Println("The signature invalidates the linearization (fast web view) of the document")
 		},
 	})
 	if err != nil {
@@ -128,6 +357,105 @@ func signPDFImpl(input string, args []string) {
 	}
 }
 
+// ParseSigningTime parses a signing time in RFC 3339 format, an empty string
+// returns the current time.
+func ParseSigningTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Now().Local(), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid signing time: %w", err)
+	}
+	return t, nil
+}
+
+// OpenPIV opens the signer of a YubiKey PIV slot. The PIN is read from
+// PDFSIGN_PIV_PIN, or from the terminal when the slot requires it.
+func OpenPIV(slot, reader string) *piv.Signer {
+	s, err := piv.ParseSlot(slot)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	signer, err := piv.Open(piv.Config{
+		Reader: reader,
+		Slot:   s,
+		PIN:    os.Getenv("PDFSIGN_PIV_PIN"),
+		PINPrompt: func() (string, error) {
+			return ReadSecret(os.Stdin, "PIV PIN: ")
+		},
+		TouchPrompt: func() {
+			fmt.Fprintln(os.Stderr, "Touch your YubiKey...")
+		},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	return signer
+}
+
+// tokenSigner is a signer of a smartcard or a certificate store.
+type tokenSigner interface {
+	sign.CertificateSigner
+	Close() error
+}
+
+// OpenCertificateStore opens the signer of a certificate in the macOS
+// Keychain, or in the personal Windows certificate store of the current user
+// or the computer.
+func OpenCertificateStore(thumbprint, subject string, machine bool) tokenSigner {
+	var signer tokenSigner
+	var err error
+	if runtime.GOOS == "darwin" {
+		signer, err = keychain.Open(keychain.Config{
+			Thumbprint: thumbprint,
+			Subject:    subject,
+		})
+	} else {
+		location := cng.CurrentUser
+		if machine {
+			location = cng.LocalMachine
+		}
+		signer, err = cng.Open(cng.Config{
+			Location:   location,
+			Thumbprint: thumbprint,
+			Subject:    subject,
+		})
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	return signer
+}
+
+// IsPKCS12 reports whether path has the extension of a PKCS #12 file.
+func IsPKCS12(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".p12", ".pfx":
+		return true
+	}
+	return false
+}
+
+// LoadPKCS12 loads a PKCS #12 file. The password is read from
+// PDFSIGN_P12_PASSWORD, or from the terminal if it is not set.
+func LoadPKCS12(path string) *pkcs12.Bundle {
+	password, ok := os.LookupEnv("PDFSIGN_P12_PASSWORD")
+	if !ok {
+		var err error
+		if password, err = ReadSecret(os.Stdin, "Password for "+filepath.Base(path)+": "); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	bundle, err := pkcs12.Load(path, password)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return bundle
+}
+
 func LoadCertificatesAndKey(certPath, keyPath, chainPath string) (*x509.Certificate, crypto.Signer, [][]*x509.Certificate) {
 	certData, err := os.ReadFile(certPath)
 	if err != nil {
@@ -161,7 +489,7 @@ func LoadCertificatesAndKey(certPath, keyPath, chainPath string) (*x509.Certific
 		log.Fatal(errors.New("failed to parse PEM block containing the private key"))
 	}
 
-	pkey, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+	pkey, err := ParsePrivateKey(keyBlock.Bytes)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -174,6 +502,26 @@ func LoadCertificatesAndKey(certPath, keyPath, chainPath string) (*x509.Certific
 	return cert, pkey, certificateChains
 }
 
+// ParsePrivateKey parses a PKCS #1 RSA, SEC 1 EC or PKCS #8 private key.
+func ParsePrivateKey(der []byte) (crypto.Signer, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, errors.New("failed to parse private key as PKCS #1, SEC 1 or PKCS #8")
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
+
 func LoadCertificateChain(chainPath string, cert *x509.Certificate) [][]*x509.Certificate {
 	chainData, err := os.ReadFile(chainPath)
 	if err != nil {
@@ -195,15 +543,91 @@ func LoadCertificateChain(chainPath string, cert *x509.Certificate) [][]*x509.Ce
 	return certificateChains
 }
 
-func TimeStampPDF(input, output, tsa string) {
-	err := sign.SignFile(input, output, sign.SignData{
+// TSAConfig returns the TSA at tsaURL with the settings of the TSA flags.
+// A comma separated list of URLs adds the other URLs as fallbacks with the
+// same settings. The password and the bearer token are read from
+// PDFSIGN_TSA_PASSWORD and PDFSIGN_TSA_TOKEN, so they do not show in the
+// process list.
+func TSAConfig(tsaURL string) (sign.TSA, error) {
+	urls := strings.Split(tsaURL, ",")
+	for i := range urls {
+		urls[i] = strings.TrimSpace(urls[i])
+	}
+
+	tsa := sign.TSA{
+		URL:      urls[0],
+		Username: TSAUser,
+		Password: os.Getenv("PDFSIGN_TSA_PASSWORD"),
+		Token:    os.Getenv("PDFSIGN_TSA_TOKEN"),
+		Timeout:  TSATimeout,
+		Retries:  TSARetries,
+	}
+
+	if len(TSAHeaders) > 0 {
+		tsa.Header = make(http.Header)
+		for _, header := range TSAHeaders {
+			name, value, _ := strings.Cut(header, ":")
+			tsa.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+		}
+	}
+
+	if TSACert != "" || TSAKey != "" {
+		certificate, err := tls.LoadX509KeyPair(TSACert, TSAKey)
+		if err != nil {
+			return sign.TSA{}, fmt.Errorf("failed to load TSA client certificate: %w", err)
+		}
+		tsa.ClientCertificate = &certificate
+	}
+
+	if TSACA != "" {
+		roots, err := os.ReadFile(TSACA)
+		if err != nil {
+			return sign.TSA{}, err
+		}
+		tsa.RootCAs = x509.NewCertPool()
+		if !tsa.RootCAs.AppendCertsFromPEM(roots) {
+			return sign.TSA{}, fmt.Errorf("no certificates in %s", TSACA)
+		}
+	}
+
+	if TSAProxy != "" {
+		proxy, err := url.Parse(TSAProxy)
+		if err != nil {
+			return sign.TSA{}, fmt.Errorf("invalid TSA proxy: %w", err)
+		}
+		tsa.Proxy = proxy
+	}
+
+	for _, fallback := range urls[1:] {
+		if fallback == "" {
+			continue
+		}
+		alternative := tsa
+		alternative.URL = fallback
+		tsa.Fallbacks = append(tsa.Fallbacks, alternative)
+	}
+	if len(tsa.Fallbacks) > 0 {
+		tsa.OnUsed = func(url string) {
+			log.Println("Timestamp from " + url)
+		}
+	}
+
+	return tsa, nil
+}
+
+func TimeStampPDF(input, output, tsaURL string) {
+	tsa, err := TSAConfig(tsaURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = sign.SignFile(input, output, sign.SignData{
 		Signature: sign.SignDataSignature{
 			CertType: sign.TimeStampSignature,
 		},
 		DigestAlgorithm: crypto.SHA256,
-		TSA: sign.TSA{
-			URL: tsa,
-		},
+		TSA:             tsa,
+		Password:        os.Getenv("PDFSIGN_PDF_PASSWORD"),
 	})
 	if err != nil {
 		log.Println(err)
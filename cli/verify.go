@@ -1,7 +1,10 @@
 package cli
 
 import (
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -20,7 +23,20 @@ func VerifyCommand() {
 	var trustSignatureTime bool
 	var validateTimestampCertificates bool
 	var allowUntrustedRoots bool
+	var crlFallbackOnly bool
+	var revocationCacheDir string
+	var revocationBundleDir string
 	var httpTimeout time.Duration
+	var format string
+	var policy string
+	var validationTime string
+	var eutl bool
+	var aatl bool
+	var aatlRoot string
+	var trustAnchors string
+	var disableSystemRoots bool
+	var checkPDFA bool
+	var repairXref bool
 
 	verifyFlags.BoolVar(&enableExternalRevocation, "external", false, "Enable external OCSP and CRL checking")
 	verifyFlags.BoolVar(&requireDigitalSignatureKU, "require-digital-signature", true, "Require Digital Signature key usage in certificates")
@@ -28,7 +44,20 @@ func VerifyCommand() {
 	verifyFlags.BoolVar(&trustSignatureTime, "trust-signature-time", false, "Trust the signature time embedded in the PDF if no timestamp is present (untrusted)")
 	verifyFlags.BoolVar(&validateTimestampCertificates, "validate-timestamp-certs", true, "Validate timestamp token certificates")
 	verifyFlags.BoolVar(&allowUntrustedRoots, "allow-untrusted-roots", false, "Allow certificates embedded in the PDF to be used as trusted roots (use with caution)")
+	verifyFlags.BoolVar(&crlFallbackOnly, "crl-fallback", false, "Download CRLs only for certificates without an OCSP status")
+	verifyFlags.StringVar(&revocationCacheDir, "revocation-cache", "", "Directory that caches OCSP responses and CRLs of external checks between runs")
+	verifyFlags.StringVar(&revocationBundleDir, "revocation-bundle", "", "Directory of OCSP responses and CRLs fetched in advance, checked without network access unless -external is given")
 	verifyFlags.DurationVar(&httpTimeout, "http-timeout", 10*time.Second, "Timeout for external revocation checking requests")
+	verifyFlags.StringVar(&policy, "policy", "", "Verification policy that presets the options: default, strict, pades-baseline or legacy-compatible")
+	verifyFlags.StringVar(&validationTime, "validation-time", "", "Evaluate the signatures as of this time in RFC 3339 format instead of the timestamp or current time")
+	verifyFlags.BoolVar(&eutl, "eutl", false, "Trust the services of the EU trusted lists and report whether signatures are qualified, the lists are cached with -revocation-cache")
+	verifyFlags.BoolVar(&aatl, "aatl", false, "Trust the certificates of the Adobe Approved Trust List, as Acrobat does, the list is cached with -revocation-cache")
+	verifyFlags.StringVar(&aatlRoot, "aatl-root", "", "PEM file of the Adobe root the signature of the Adobe Approved Trust List must chain to, required with -aatl")
+	verifyFlags.StringVar(&trustAnchors, "trust-anchors", "", "PEM bundle or directory of PEM certificates to trust in addition to the system roots")
+	verifyFlags.BoolVar(&disableSystemRoots, "no-system-roots", false, "Trust only the anchors of -trust-anchors, -eutl and -aatl instead of also the system roots")
+	verifyFlags.BoolVar(&checkPDFA, "pdfa", false, "Report whether the document and its signatures break the declared PDF/A conformance")
+	verifyFlags.BoolVar(&repairXref, "repair-xref", false, "Rebuild a corrupt cross-reference table from the objects of the document")
+	verifyFlags.StringVar(&format, "format", "response", "Output format: response for the full verification response, report for the versioned JSON report, etsi for an ETSI EN 319 102-1 validation report")
 
 	verifyFlags.Usage = func() {
 		fmt.Printf("Usage: %s verify [options] <input.pdf>\n\n", os.Args[0])
@@ -38,7 +67,18 @@ func VerifyCommand() {
 		fmt.Println("\nExamples:")
 		fmt.Printf("  %s verify document.pdf\n", os.Args[0])
 		fmt.Printf("  %s verify -external -http-timeout=30s document.pdf\n", os.Args[0])
+		fmt.Printf("  %s verify -external -revocation-cache ~/.cache/pdfsign document.pdf\n", os.Args[0])
+		fmt.Printf("  %s verify -revocation-bundle /media/revocation document.pdf\n", os.Args[0])
 		fmt.Printf("  %s verify -allow-untrusted-roots self-signed.pdf\n", os.Args[0])
+		fmt.Printf("  %s verify -policy pades-baseline document.pdf\n", os.Args[0])
+		fmt.Printf("  %s verify -validation-time 2024-01-15T12:00:00Z document.pdf\n", os.Args[0])
+		fmt.Printf("  %s verify -eutl -revocation-cache ~/.cache/pdfsign document.pdf\n", os.Args[0])
+		fmt.Printf("  %s verify -aatl -aatl-root adobe-root.pem document.pdf\n", os.Args[0])
+		fmt.Printf("  %s verify -trust-anchors /etc/pdfsign/roots -no-system-roots document.pdf\n", os.Args[0])
+		fmt.Printf("  %s verify -format report document.pdf\n", os.Args[0])
+		fmt.Printf("  %s verify -format etsi document.pdf\n", os.Args[0])
+		fmt.Printf("  %s verify -pdfa archived.pdf\n", os.Args[0])
+		fmt.Printf("  %s verify -repair-xref scanned.pdf\n", os.Args[0])
 	}
 
 	if err := verifyFlags.Parse(os.Args[2:]); err != nil {
@@ -50,13 +90,53 @@ func VerifyCommand() {
 		osExit(1)
 	}
 
+	if format != "response" && format != "report" && format != "etsi" {
+		fmt.Fprintf(os.Stderr, "Invalid output format %q, expected response, report or etsi\n", format)
+		osExit(1)
+	}
+
+	var at time.Time
+	if validationTime != "" {
+		t, err := time.Parse(time.RFC3339, validationTime)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid validation time %q, expected RFC 3339 format\n", validationTime)
+			osExit(1)
+		}
+		at = t
+	}
+
+	// Flags that are not given take the values of the policy.
+	preset, err := verify.PolicyOptions(verify.Policy(policy))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid verification policy %q, expected one of %v\n", policy, verify.Policies)
+		osExit(1)
+	}
+	given := map[string]bool{}
+	verifyFlags.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	for name, value := range map[string]struct {
+		flag   *bool
+		preset bool
+	}{
+		"external":                  {&enableExternalRevocation, preset.EnableExternalRevocationCheck},
+		"require-digital-signature": {&requireDigitalSignatureKU, preset.RequireDigitalSignatureKU},
+		"require-non-repudiation":   {&requireNonRepudiation, preset.RequireNonRepudiation},
+		"trust-signature-time":      {&trustSignatureTime, preset.TrustSignatureTime},
+		"validate-timestamp-certs":  {&validateTimestampCertificates, preset.ValidateTimestampCertificates},
+		"allow-untrusted-roots":     {&allowUntrustedRoots, preset.AllowUntrustedRoots},
+		"crl-fallback":              {&crlFallbackOnly, preset.CRLFallbackOnly},
+	} {
+		if !given[name] {
+			*value.flag = value.preset
+		}
+	}
+
 	input := verifyFlags.Arg(0)
 	VerifyPDF(input, enableExternalRevocation, requireDigitalSignatureKU, requireNonRepudiation,
-		trustSignatureTime, validateTimestampCertificates, allowUntrustedRoots, httpTimeout)
+		trustSignatureTime, validateTimestampCertificates, allowUntrustedRoots, crlFallbackOnly, revocationCacheDir, revocationBundleDir, httpTimeout, format, policy, at, eutl, aatl, aatlRoot, trustAnchors, disableSystemRoots, checkPDFA, repairXref)
 }
 
 func VerifyPDF(input string, enableExternalRevocation, requireDigitalSignatureKU, requireNonRepudiation,
-	trustSignatureTime, validateTimestampCertificates, allowUntrustedRoots bool, httpTimeout time.Duration) {
+	trustSignatureTime, validateTimestampCertificates, allowUntrustedRoots, crlFallbackOnly bool, revocationCacheDir, revocationBundleDir string, httpTimeout time.Duration, format, policy string, validationTime time.Time, eutl, aatl bool, aatlRoot, trustAnchors string, disableSystemRoots, checkPDFA, repairXref bool) {
 	inputFile, err := os.Open(input)
 	if err != nil {
 		log.Fatal(err)
@@ -67,14 +147,49 @@ func VerifyPDF(input string, enableExternalRevocation, requireDigitalSignatureKU
 		}
 	}()
 
-	options := verify.DefaultVerifyOptions()
+	options, err := verify.PolicyOptions(verify.Policy(policy))
+	if err != nil {
+		log.Fatal(err)
+	}
 	options.EnableExternalRevocationCheck = enableExternalRevocation
 	options.RequireDigitalSignatureKU = requireDigitalSignatureKU
 	options.RequireNonRepudiation = requireNonRepudiation
 	options.TrustSignatureTime = trustSignatureTime
 	options.ValidateTimestampCertificates = validateTimestampCertificates
 	options.AllowUntrustedRoots = allowUntrustedRoots
+	options.CRLFallbackOnly = crlFallbackOnly
 	options.HTTPTimeout = httpTimeout
+	options.ValidationTime = validationTime
+	if revocationCacheDir != "" {
+		cache, err := verify.NewDiskRevocationCache(revocationCacheDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		options.RevocationCache = cache
+	}
+	if revocationBundleDir != "" {
+		bundle, err := verify.LoadRevocationBundle(revocationBundleDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		options.RevocationBundle = bundle
+	}
+	if eutl {
+		options.TrustProviders = append(options.TrustProviders, &verify.EUTLProvider{Cache: options.RevocationCache})
+	}
+	if aatl {
+		roots, err := loadCertificates(aatlRoot)
+		if err != nil {
+			log.Fatalf("-aatl requires the Adobe root of the list with -aatl-root: %v", err)
+		}
+		options.TrustProviders = append(options.TrustProviders, &verify.AATLProvider{Roots: roots, Cache: options.RevocationCache})
+	}
+	if trustAnchors != "" {
+		options.TrustProviders = append(options.TrustProviders, verify.NewPEMTrustProvider(trustAnchors))
+	}
+	options.DisableSystemRoots = disableSystemRoots
+	options.CheckPDFA = checkPDFA
+	options.RepairXref = repairXref
 
 	resp, err := verify.VerifyFileWithOptions(inputFile, options)
 	if err != nil {
@@ -82,10 +197,49 @@ func VerifyPDF(input string, enableExternalRevocation, requireDigitalSignatureKU
 		osExit(1)
 	}
 
-	jsonData, err := json.Marshal(resp)
+	var jsonData []byte
+	switch format {
+	case "report":
+		jsonData, err = resp.MarshalReport()
+	case "etsi":
+		jsonData, err = resp.MarshalETSIReport()
+	default:
+		jsonData, err = json.Marshal(resp)
+	}
 	if err != nil {
 		fmt.Println(err)
 		osExit(1)
 	}
 	fmt.Println(string(jsonData))
 }
+
+// loadCertificates returns the certificates of the PEM file at path.
+func loadCertificates(path string) ([]*x509.Certificate, error) {
+	if path == "" {
+		return nil, errors.New("no PEM file given")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var certificates []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate in %s: %w", path, err)
+		}
+		certificates = append(certificates, cert)
+	}
+	if len(certificates) == 0 {
+		return nil, fmt.Errorf("no certificates in %s", path)
+	}
+	return certificates, nil
+}
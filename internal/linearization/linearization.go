@@ -0,0 +1,58 @@
+// Package linearization reads the linearization dictionary of linearized
+// documents, which are organized for reading the first page before the rest
+// of the file has been received, known as fast web view (see Annex F,
+// "Linearized PDF").
+//
+// A document is only linearized as long as it has the length of the L entry
+// of the dictionary. An incremental update, such as that of a signature,
+// invalidates the linearization, and readers treat the document as one that
+// is not linearized.
+package linearization
+
+import (
+	"io"
+	"regexp"
+	"strconv"
+)
+
+// headerLength is the part of the file that contains the linearization
+// dictionary, see F.2, "Linearization parameter dictionary".
+const headerLength = 1024
+
+var (
+	firstObject = regexp.MustCompile(`^%PDF-\d\.\d[^\n\r]*[\r\n]+(?:%[^\n\r]*[\r\n]+)*\s*\d+\s+\d+\s+obj\s*<<((?:[^<>]|<[^<>]*>)*)>>`)
+	linearized  = regexp.MustCompile(`/Linearized\s+[\d.]+`)
+	length      = regexp.MustCompile(`/L\s+(\d+)`)
+	pages       = regexp.MustCompile(`/N\s+(\d+)`)
+)
+
+// Dictionary is the linearization parameter dictionary of a document.
+type Dictionary struct {
+	Length int64 // L, the length of the linearized file
+	Pages  int   // N, the number of pages of the linearized file
+}
+
+// Read returns the linearization dictionary of the document f of size bytes,
+// the first object of the file, or nil if the document is not linearized.
+func Read(f io.ReaderAt, size int64) *Dictionary {
+	header := make([]byte, min(size, headerLength))
+	n, _ := f.ReadAt(header, 0)
+	m := firstObject.FindSubmatch(header[:n])
+	if m == nil || !linearized.Match(m[1]) {
+		return nil
+	}
+	d := &Dictionary{}
+	if l := length.FindSubmatch(m[1]); l != nil {
+		d.Length, _ = strconv.ParseInt(string(l[1]), 10, 64)
+	}
+	if p := pages.FindSubmatch(m[1]); p != nil {
+		d.Pages, _ = strconv.Atoi(string(p[1]))
+	}
+	return d
+}
+
+// Valid returns whether the document of size bytes is still linearized:
+// whether it has the length of the linearized file.
+func (d *Dictionary) Valid(size int64) bool {
+	return d.Length == size
+}
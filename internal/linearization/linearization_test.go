@@ -0,0 +1,46 @@
+package linearization
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// linearizedDocument returns a document that starts with a linearization
+// dictionary of the length of the document and the pages given.
+func linearizedDocument(pages int) []byte {
+	var document bytes.Buffer
+	document.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	_, _ = fmt.Fprintf(&document, "4 0 obj\n<< /Linearized 1 /L %010d /H [ 120 30 ] /O 3 /E 300 /N %d /T 400 >>\nendobj\n", 0, pages)
+	document.WriteString("1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n%%EOF\n")
+	data := document.Bytes()
+	return bytes.Replace(data, []byte(fmt.Sprintf("/L %010d", 0)), []byte(fmt.Sprintf("/L %010d", len(data))), 1)
+}
+
+func TestRead(t *testing.T) {
+	document := linearizedDocument(2)
+	d := Read(bytes.NewReader(document), int64(len(document)))
+	if d == nil {
+		t.Fatalf("expected a linearized document")
+	}
+	if d.Length != int64(len(document)) || d.Pages != 2 {
+		t.Errorf("expected the length %d and 2 pages, got %d and %d", len(document), d.Length, d.Pages)
+	}
+	if !d.Valid(int64(len(document))) {
+		t.Errorf("expected the linearization to be valid")
+	}
+	if d.Valid(int64(len(document)) + 100) {
+		t.Errorf("expected an update to invalidate the linearization")
+	}
+
+	for name, document := range map[string]string{
+		"not linearized":       "%PDF-1.7\n1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n",
+		"not the first object": "%PDF-1.7\n1 0 obj\n<< /Type /Catalog >>\nendobj\n4 0 obj\n<< /Linearized 1 /L 100 >>\nendobj\n",
+		"after 1024 bytes":     "%PDF-1.7\n" + strings.Repeat("%\n", 512) + "4 0 obj\n<< /Linearized 1 /L 100 >>\nendobj\n",
+	} {
+		if d := Read(strings.NewReader(document), int64(len(document))); d != nil {
+			t.Errorf("%s: expected no linearization dictionary, got %+v", name, d)
+		}
+	}
+}
@@ -0,0 +1,399 @@
+// Package xref reads the cross-reference sections of hybrid-reference files,
+// which pdf.Reader does not.
+//
+// A hybrid-reference file has classic cross-reference tables for readers of
+// PDF 1.4 and before, and lists the objects in object streams in
+// cross-reference streams referred to by the XRefStm entry of the trailers
+// (see 7.5.8.4, "Compatibility with applications that do not support
+// compressed reference streams"). pdf.Reader only reads the tables, the objects
+// in the object streams are missing and new objects may be given their
+// numbers.
+//
+// It also rebuilds the cross-reference sections of documents whose tables are
+// corrupt from the objects found in the file, see Repair.
+package xref
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+
+	"github.com/digitorus/pdf"
+)
+
+var (
+	trailerPrev    = regexp.MustCompile(`/Prev\s+(\d+)`)
+	trailerXRefStm = regexp.MustCompile(`/XRefStm\s+(\d+)`)
+	trailerSize    = regexp.MustCompile(`/Size\s+(\d+)`)
+	objectHeader   = regexp.MustCompile(`^\s*(\d+)\s+(\d+)\s+obj\b`)
+)
+
+// maxTrailerLength is the length of the trailer dictionary after a table
+// that is read.
+const maxTrailerLength = 64 * 1024
+
+// entry is a cross-reference entry: an object at an offset of the file, of
+// type 1, or the index of an object in an object stream, of type 2.
+type entry struct {
+	typ    byte
+	field2 int64 // Offset or object number of the object stream
+	field3 int64 // Generation or index in the object stream
+}
+
+// section is a cross-reference table with the trailer after it.
+type section struct {
+	offset  int64  // Offset of the xref keyword
+	table   []byte // Subsections of the table
+	trailer []byte // Trailer dictionary
+	xrefStm int64  // XRefStm entry of the trailer, zero without
+}
+
+// NewReader returns a reader of the document f of size bytes, like
+// pdf.NewReader, that reads the cross-reference streams of a hybrid-reference
+// file as well, see Extend.
+func NewReader(f io.ReaderAt, size int64) (*pdf.Reader, error) {
+	rdr, err := pdf.NewReader(f, size)
+	if err != nil {
+		return nil, err
+	}
+	return Extend(f, size, rdr)
+}
+
+// Extend returns rdr, the reader of the document f of size bytes, or if the
+// document is a hybrid-reference file, a reader of f that reads the objects
+// of the cross-reference streams of the XRefStm entries as well. Its
+// XrefInformation is that of rdr, with the number of items of all sections,
+// and its trailer has the entries of the last trailer except for Prev and
+// XRefStm.
+func Extend(f io.ReaderAt, size int64, rdr *pdf.Reader) (*pdf.Reader, error) {
+	if rdr.XrefInformation.Type != "table" {
+		return rdr, nil
+	}
+	sections, err := tableSections(f, size, rdr.XrefInformation.StartPos)
+	if err != nil {
+		return nil, err
+	}
+	hybrid := false
+	for _, s := range sections {
+		hybrid = hybrid || s.xrefStm != 0
+	}
+	if !hybrid {
+		return rdr, nil
+	}
+
+	// The entries of the last section take precedence, within a section
+	// those of the table over those of its cross-reference stream.
+	entries := make(map[int64]entry)
+	for _, s := range sections {
+		table, err := parseTable(s.table)
+		if err != nil {
+			return nil, fmt.Errorf("malformed cross-reference table at %d: %w", s.offset, err)
+		}
+		for id, e := range table {
+			if _, ok := entries[id]; !ok {
+				entries[id] = e
+			}
+		}
+		if s.xrefStm == 0 {
+			continue
+		}
+		stream, err := readStream(f, size, s.xrefStm)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the cross-reference stream at %d: %w", s.xrefStm, err)
+		}
+		for id, e := range stream {
+			if _, ok := entries[id]; !ok {
+				entries[id] = e
+			}
+		}
+	}
+
+	merged := mergedSection(size, sections[0].trailer, entries, false)
+	extended, err := pdf.NewReader(&suffixReader{f, size, merged}, size+int64(len(merged)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the cross-reference streams: %w", err)
+	}
+	information := rdr.XrefInformation
+	information.ItemCount = extended.XrefInformation.ItemCount
+	extended.XrefInformation = information
+	return extended, nil
+}
+
+// tableSections returns the cross-reference tables of the document f of size
+// bytes from the one at offset, the last one first, up to the first section
+// by Prev that is not a table.
+func tableSections(f io.ReaderAt, size, offset int64) ([]section, error) {
+	var sections []section
+	seen := make(map[int64]bool)
+	for offset > 0 && offset < size && !seen[offset] {
+		seen[offset] = true
+		s, err := tableSection(f, size, offset)
+		if err != nil {
+			return nil, err
+		}
+		if s == nil {
+			break
+		}
+		sections = append(sections, *s)
+
+		offset = 0
+		if m := trailerPrev.FindSubmatch(s.trailer); m != nil {
+			offset, _ = strconv.ParseInt(string(m[1]), 10, 64)
+		}
+	}
+	return sections, nil
+}
+
+// tableSection returns the cross-reference table at offset of the document f
+// of size bytes, or nil if there is no table.
+func tableSection(f io.ReaderAt, size, offset int64) (*section, error) {
+	r := io.NewSectionReader(f, offset, size-offset)
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(r, head); err != nil || string(head) != "xref" {
+		return nil, nil
+	}
+
+	// The table consists of numbers and the keywords n and f only, the first
+	// trailer keyword ends it.
+	var data []byte
+	chunk := make([]byte, 32*1024)
+	start := -1
+	for start < 0 {
+		n, err := r.Read(chunk)
+		data = append(data, chunk[:n]...)
+		if i := bytes.Index(data, []byte("trailer")); i >= 0 {
+			start = i + len("trailer")
+			break
+		}
+		if err == io.EOF {
+			return nil, fmt.Errorf("cross-reference table at %d without a trailer", offset)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	for len(data)-start < maxTrailerLength && !bytes.Contains(data[start:], []byte("startxref")) {
+		n, err := r.Read(chunk)
+		data = append(data, chunk[:n]...)
+		if err != nil {
+			break
+		}
+	}
+
+	s := &section{offset: offset, table: data[:start-len("trailer")], trailer: data[start:]}
+	if i := bytes.Index(s.trailer, []byte("startxref")); i >= 0 {
+		s.trailer = s.trailer[:i]
+	}
+	s.trailer = bytes.TrimSpace(s.trailer)
+	if !bytes.HasPrefix(s.trailer, []byte("<<")) || !bytes.HasSuffix(s.trailer, []byte(">>")) {
+		return nil, fmt.Errorf("cross-reference table at %d without a trailer dictionary", offset)
+	}
+	if m := trailerXRefStm.FindSubmatch(s.trailer); m != nil {
+		s.xrefStm, _ = strconv.ParseInt(string(m[1]), 10, 64)
+	}
+	return s, nil
+}
+
+// parseTable returns the entries in use of the subsections of a
+// cross-reference table.
+func parseTable(table []byte) (map[int64]entry, error) {
+	fields := bytes.Fields(table)
+	entries := make(map[int64]entry)
+	for len(fields) >= 2 {
+		start, err1 := strconv.ParseInt(string(fields[0]), 10, 64)
+		n, err2 := strconv.ParseInt(string(fields[1]), 10, 64)
+		if err1 != nil || err2 != nil || n < 0 || int64(len(fields)-2) < 3*n {
+			return nil, errors.New("invalid subsection")
+		}
+		fields = fields[2:]
+		for i := int64(0); i < n; i++ {
+			off, err1 := strconv.ParseInt(string(fields[0]), 10, 64)
+			gen, err2 := strconv.ParseInt(string(fields[1]), 10, 64)
+			if err1 != nil || err2 != nil {
+				return nil, errors.New("invalid entry")
+			}
+			// Free entries leave the object to the cross-reference stream
+			// or the previous sections, as pdf.Reader does.
+			if string(fields[2]) == "n" {
+				if _, ok := entries[start+i]; !ok {
+					entries[start+i] = entry{typ: 1, field2: off, field3: gen}
+				}
+			}
+			fields = fields[3:]
+		}
+	}
+	return entries, nil
+}
+
+// readStream returns the entries of the cross-reference stream at offset of
+// the document f of size bytes. The stream is decoded by a pdf.Reader of f
+// with a cross-reference table of the stream only.
+func readStream(f io.ReaderAt, size, offset int64) (entries map[int64]entry, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			entries, err = nil, fmt.Errorf("%v", r)
+		}
+	}()
+
+	head := make([]byte, 64)
+	n, _ := f.ReadAt(head, offset)
+	m := objectHeader.FindSubmatch(head[:n])
+	if m == nil {
+		return nil, errors.New("not an object")
+	}
+	id, _ := strconv.ParseInt(string(m[1]), 10, 32)
+	gen, _ := strconv.ParseInt(string(m[2]), 10, 16)
+
+	var suffix bytes.Buffer
+	_, _ = fmt.Fprintf(&suffix, "\nxref\n%d 1\n%010d %05d n \ntrailer\n<< /Size %d >>\nstartxref\n%d\n%%%%EOF\n", id, offset, gen, id+1, size+1)
+	rdr, err := pdf.NewReader(&suffixReader{f, size, suffix.Bytes()}, size+int64(suffix.Len()))
+	if err != nil {
+		return nil, err
+	}
+	xrefs := rdr.Xref()
+	if int64(len(xrefs)) <= id {
+		return nil, errors.New("not an object")
+	}
+	ptr := xrefs[id].Ptr()
+	stream := rdr.Resolve(ptr, ptr)
+	if stream.Kind() != pdf.Stream || stream.Key("Type").Name() != "XRef" {
+		return nil, errors.New("not a cross-reference stream")
+	}
+
+	w := stream.Key("W")
+	if w.Len() != 3 {
+		return nil, errors.New("invalid W array")
+	}
+	widths := make([]int, 3)
+	for i := range widths {
+		widths[i] = int(w.Index(i).Int64())
+		if widths[i] < 0 || widths[i] > 8 {
+			return nil, errors.New("invalid W array")
+		}
+	}
+	index := stream.Key("Index")
+	var subsections []int64
+	if index.IsNull() {
+		subsections = []int64{0, stream.Key("Size").Int64()}
+	}
+	for i := 0; i < index.Len(); i++ {
+		subsections = append(subsections, index.Index(i).Int64())
+	}
+	if len(subsections)%2 != 0 {
+		return nil, errors.New("invalid Index array")
+	}
+
+	data, err := io.ReadAll(stream.Reader())
+	if err != nil {
+		return nil, err
+	}
+	row := widths[0] + widths[1] + widths[2]
+	entries = make(map[int64]entry)
+	for i := 0; i < len(subsections); i += 2 {
+		for id := subsections[i]; id < subsections[i]+subsections[i+1]; id++ {
+			if len(data) < row || row == 0 {
+				return nil, errors.New("truncated cross-reference stream")
+			}
+			e := entry{
+				typ:    1,
+				field2: decodeInt(data[widths[0] : widths[0]+widths[1]]),
+				field3: decodeInt(data[widths[0]+widths[1] : row]),
+			}
+			if widths[0] > 0 {
+				e.typ = byte(decodeInt(data[:widths[0]]))
+			}
+			data = data[row:]
+			if e.typ == 1 || e.typ == 2 {
+				entries[id] = e
+			}
+		}
+	}
+	return entries, nil
+}
+
+// mergedSection returns a cross-reference stream with the entries, to be
+// appended to the document of size bytes, followed by startxref, with the
+// entries of the trailer except for Prev, XRefStm and Size. With self, the
+// stream lists itself, so its object number is not given to another object.
+func mergedSection(size int64, trailer []byte, entries map[int64]entry, self bool) []byte {
+	length := int64(0)
+	if m := trailerSize.FindSubmatch(trailer); m != nil {
+		length, _ = strconv.ParseInt(string(m[1]), 10, 64)
+	}
+	for id := range entries {
+		length = max(length, id+1)
+	}
+
+	offset := size + 1
+	stream := length
+	if self {
+		length++
+	}
+
+	var data bytes.Buffer
+	for id := int64(0); id < length; id++ {
+		e := entries[id]
+		if id == stream {
+			e = entry{typ: 1, field2: offset}
+		}
+		data.WriteByte(e.typ)
+		for shift := 56; shift >= 0; shift -= 8 {
+			data.WriteByte(byte(e.field2 >> shift))
+		}
+		data.WriteByte(byte(e.field3 >> 8))
+		data.WriteByte(byte(e.field3))
+	}
+
+	for _, key := range []*regexp.Regexp{trailerPrev, trailerXRefStm, trailerSize} {
+		trailer = key.ReplaceAll(trailer, nil)
+	}
+
+	var section bytes.Buffer
+	_, _ = fmt.Fprintf(&section, "\n%d 0 obj\n<< /Type /XRef /Size %d /W [1 8 2] /Length %d %s\nstream\n", stream, length, data.Len(), trailer[len("<<"):])
+	section.Write(data.Bytes())
+	_, _ = fmt.Fprintf(&section, "\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", offset)
+	return section.Bytes()
+}
+
+func decodeInt(b []byte) int64 {
+	var x int64
+	for _, c := range b {
+		x = x<<8 | int64(c)
+	}
+	return x
+}
+
+// suffixReader reads the first size bytes of f followed by suffix.
+type suffixReader struct {
+	f      io.ReaderAt
+	size   int64
+	suffix []byte
+}
+
+func (r *suffixReader) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	if off < r.size {
+		m, err := r.f.ReadAt(p[:min(int64(len(p)), r.size-off)], off)
+		n += m
+		if err != nil && err != io.EOF {
+			return n, err
+		}
+		if m < int(min(int64(len(p)), r.size-off)) {
+			return n, io.EOF
+		}
+	}
+	if n < len(p) {
+		start := max(off+int64(n)-r.size, 0)
+		if start >= int64(len(r.suffix)) {
+			return n, io.EOF
+		}
+		n += copy(p[n:], r.suffix[start:])
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
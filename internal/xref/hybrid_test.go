@@ -0,0 +1,116 @@
+package xref
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/digitorus/pdf"
+)
+
+// hybridDocument returns a hybrid-reference file: the document information 6
+// and the structure tree root 7 are stored in the object stream 5 and listed
+// as free in the cross-reference table, the cross-reference stream 8 of the
+// XRefStm entry lists them.
+func hybridDocument() []byte {
+	document := bytes.NewBufferString("%PDF-1.5\n")
+	offsets := make(map[int]int)
+	for id, object := range []string{
+		1: "<< /Type /Catalog /Pages 2 0 R /StructTreeRoot 7 0 R >>",
+		2: "<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		3: "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R >>",
+		4: "<< /Length 0 >>\nstream\n\nendstream",
+	} {
+		if object != "" {
+			offsets[id] = document.Len()
+			_, _ = fmt.Fprintf(document, "%d 0 obj\n%s\nendobj\n", id, object)
+		}
+	}
+	objects := "6 0 7 25 << /Producer (hybrid) >>\n<< /Type /StructTreeRoot >>\n"
+	offsets[5] = document.Len()
+	_, _ = fmt.Fprintf(document, "5 0 obj\n<< /Type /ObjStm /N 2 /First 9 /Length %d >>\nstream\n%s\nendstream\nendobj\n", len(objects), objects)
+
+	stream := document.Len()
+	entries := []byte{2, 0, 5, 0, 2, 0, 5, 1}
+	_, _ = fmt.Fprintf(document, "8 0 obj\n<< /Type /XRef /Size 9 /Index [6 2] /W [1 2 1] /Length %d >>\nstream\n%s\nendstream\nendobj\n", len(entries), entries)
+
+	table := document.Len()
+	document.WriteString("xref\n0 9\n0000000000 65535 f \n")
+	for id := 1; id < 9; id++ {
+		if offset, ok := offsets[id]; ok {
+			_, _ = fmt.Fprintf(document, "%010d 00000 n \n", offset)
+		} else {
+			document.WriteString("0000000000 00000 f \n")
+		}
+	}
+	_, _ = fmt.Fprintf(document, "trailer\n<< /Size 9 /Root 1 0 R /Info 6 0 R /XRefStm %d >>\nstartxref\n%d\n%%%%EOF\n", stream, table)
+	return document.Bytes()
+}
+
+func TestNewReader(t *testing.T) {
+	document := hybridDocument()
+
+	// An update by a writer without cross-reference streams, which keeps
+	// the objects of the stream.
+	update := len(document)
+	prev := bytes.LastIndex(document, []byte("\nxref\n")) + 1
+	document = append(document, []byte("3 0 obj\n<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Contents 4 0 R >>\nendobj\n")...)
+	table := len(document)
+	document = append(document, fmt.Sprintf("xref\n3 1\n%010d 00000 n \ntrailer\n<< /Size 9 /Root 1 0 R /Info 6 0 R /Prev %d >>\nstartxref\n%d\n%%%%EOF\n", update, prev, table)...)
+
+	for name, document := range map[string][]byte{
+		"hybrid-reference file": document[:update],
+		"update":                document,
+	} {
+		t.Run(name, func(t *testing.T) {
+			plain, err := pdf.NewReader(bytes.NewReader(document), int64(len(document)))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if !plain.Trailer().Key("Info").IsNull() {
+				t.Fatalf("expected pdf.Reader not to read the cross-reference stream")
+			}
+
+			rdr, err := NewReader(bytes.NewReader(document), int64(len(document)))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if producer := rdr.Trailer().Key("Info").Key("Producer").Text(); producer != "hybrid" {
+				t.Errorf("expected the producer of the object stream, got %q", producer)
+			}
+			root := rdr.Trailer().Key("Root")
+			if kind := root.Key("StructTreeRoot").Key("Type").Name(); kind != "StructTreeRoot" {
+				t.Errorf("expected the structure tree root of the object stream, got %q", kind)
+			}
+			if count := root.Key("Pages").Key("Count").Int64(); count != 1 {
+				t.Errorf("expected 1 page, got %d", count)
+			}
+			if rdr.XrefInformation.StartPos != plain.XrefInformation.StartPos {
+				t.Errorf("expected the cross-reference table at %d, got %d", plain.XrefInformation.StartPos, rdr.XrefInformation.StartPos)
+			}
+			if rdr.XrefInformation.Type != "table" || rdr.XrefInformation.ItemCount != 9 {
+				t.Errorf("expected a table of 9 items, got a %s of %d", rdr.XrefInformation.Type, rdr.XrefInformation.ItemCount)
+			}
+			if !rdr.Trailer().Key("Prev").IsNull() || !rdr.Trailer().Key("XRefStm").IsNull() {
+				t.Errorf("expected a trailer without Prev and XRefStm, got %v", rdr.Trailer())
+			}
+		})
+	}
+}
+
+func TestExtendWithoutCrossReferenceStreams(t *testing.T) {
+	document := hybridDocument()
+	document = bytes.Replace(document, []byte(" /XRefStm"), []byte(" /Comment"), 1)
+
+	plain, err := pdf.NewReader(bytes.NewReader(document), int64(len(document)))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	rdr, err := Extend(bytes.NewReader(document), int64(len(document)), plain)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if rdr != plain {
+		t.Errorf("expected the reader of a file without cross-reference streams")
+	}
+}
@@ -0,0 +1,248 @@
+package xref
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/digitorus/pdf"
+)
+
+var (
+	objectMarker   = regexp.MustCompile(`\b(\d{1,10})[\x00\t\n\f\r ]+(\d{1,5})[\x00\t\n\f\r ]+obj\b`)
+	trailerRoot    = regexp.MustCompile(`/Root\s+\d+\s+\d+\s+R`)
+	trailerInfo    = regexp.MustCompile(`/Info\s+\d+\s+\d+\s+R`)
+	trailerID      = regexp.MustCompile(`/ID\s*\[\s*<[0-9A-Fa-f\s]*>\s*<[0-9A-Fa-f\s]*>\s*\]`)
+	trailerEncrypt = regexp.MustCompile(`/Encrypt\s+\d+\s+\d+\s+R`)
+)
+
+// scannedObject is an object found by Repair at position of the file: the
+// object itself or an object stream that contains it.
+type scannedObject struct {
+	id       int64
+	position int64
+	entry    entry
+}
+
+// Check resolves every object listed by the cross-reference sections of rdr
+// and returns the error of the first object that is not found at its offset
+// or in its object stream.
+func Check(rdr *pdf.Reader) (err error) {
+	var current uint32
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("object %d: %v", current, r)
+		}
+	}()
+	xrefs := rdr.Xref()
+	for i := range xrefs {
+		ptr := xrefs[i].Ptr()
+		if ptr.GetID() == 0 {
+			continue
+		}
+		current = ptr.GetID()
+		rdr.Resolve(ptr, ptr)
+	}
+	return nil
+}
+
+// Repair rebuilds the cross-reference section of the document f of size
+// bytes, whose cross-reference table is corrupt or gives wrong offsets, from
+// the objects found by scanning the file for "obj" keywords, see 7.5.4,
+// "Cross-reference table". An object found more than once is taken from the
+// last position, an object in an object stream from the stream. The trailer
+// refers to the last document catalog and document information of the
+// trailers, or without trailers to the last catalog found.
+//
+// Repair returns the section, a cross-reference stream without Prev to be
+// appended to f, and a reader of the document f followed by the section.
+// Encrypted documents are not repaired.
+func Repair(f io.ReaderAt, size int64) (*pdf.Reader, []byte, error) {
+	data := make([]byte, size)
+	if n, err := f.ReadAt(data, 0); int64(n) < size {
+		return nil, nil, fmt.Errorf("failed to read the document: %w", err)
+	}
+	if trailerEncrypt.Match(data) {
+		return nil, nil, errors.New("encrypted documents can not be repaired")
+	}
+
+	objects := scanObjects(data)
+	if len(objects) == 0 {
+		return nil, nil, errors.New("no objects found")
+	}
+	entries := make(map[int64]entry)
+	for _, o := range objects {
+		entries[o.id] = o.entry
+	}
+
+	// The objects of the object streams are listed at the position of their
+	// stream, which is read by a reader of the objects in the file.
+	scanned, err := repairedReader(f, size, []byte("<< >>"), entries)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, o := range objects {
+		objects = append(objects, objectStream(scanned, o)...)
+	}
+	sort.SliceStable(objects, func(i, j int) bool {
+		return objects[i].position < objects[j].position
+	})
+	for _, o := range objects {
+		entries[o.id] = o.entry
+	}
+
+	trailer := []byte("<<")
+	for _, key := range []*regexp.Regexp{trailerRoot, trailerInfo, trailerID} {
+		if all := key.FindAll(data, -1); len(all) > 0 {
+			trailer = append(append(trailer, ' '), all[len(all)-1]...)
+		}
+	}
+	trailer = append(trailer, " >>"...)
+
+	rdr, err := repairedReader(f, size, trailer, entries)
+	if err != nil {
+		return nil, nil, err
+	}
+	if rootType(rdr) != "Catalog" {
+		root, ok := lastCatalog(scanned, objects)
+		if !ok {
+			return nil, nil, errors.New("no document catalog found")
+		}
+		trailer = trailerRoot.ReplaceAll(trailer, nil)
+		trailer = append([]byte(fmt.Sprintf("<< /Root %d 0 R", root)), trailer[len("<<"):]...)
+		if rdr, err = repairedReader(f, size, trailer, entries); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	section := mergedSection(size, trailer, entries, true)
+	return rdr, section, nil
+}
+
+// Concat returns the first size bytes of f followed by section, the
+// document Repair returns the reader of.
+func Concat(f io.ReaderAt, size int64, section []byte) *io.SectionReader {
+	return io.NewSectionReader(&suffixReader{f, size, section}, 0, size+int64(len(section)))
+}
+
+// repairedReader returns the reader of the document f of size bytes followed
+// by the section of the entries and trailer.
+func repairedReader(f io.ReaderAt, size int64, trailer []byte, entries map[int64]entry) (rdr *pdf.Reader, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			rdr, err = nil, fmt.Errorf("failed to read the repaired document: %v", r)
+		}
+	}()
+	section := mergedSection(size, trailer, entries, true)
+	rdr, err = pdf.NewReader(&suffixReader{f, size, section}, size+int64(len(section)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the repaired document: %w", err)
+	}
+	return rdr, nil
+}
+
+// scanObjects returns the objects of data in the order of their positions.
+// The data of streams is skipped, so objects inside streams, such as those of
+// object streams or embedded files, are not taken for objects of the file.
+func scanObjects(data []byte) []scannedObject {
+	var objects []scannedObject
+	for pos := 0; pos < len(data); {
+		m := objectMarker.FindSubmatchIndex(data[pos:])
+		if m == nil {
+			break
+		}
+		id, err1 := strconv.ParseInt(string(data[pos+m[2]:pos+m[3]]), 10, 32)
+		gen, err2 := strconv.ParseInt(string(data[pos+m[4]:pos+m[5]]), 10, 32)
+		offset := int64(pos + m[0])
+		pos += m[1]
+		if err1 != nil || err2 != nil || id == 0 || gen > 65535 {
+			continue
+		}
+		objects = append(objects, scannedObject{id: id, position: offset, entry: entry{typ: 1, field2: offset, field3: gen}})
+
+		end := bytes.Index(data[pos:], []byte("endobj"))
+		stream := bytes.Index(data[pos:], []byte("stream"))
+		if stream >= 0 && (end < 0 || stream < end) {
+			if i := bytes.Index(data[pos+stream+len("stream"):], []byte("endstream")); i >= 0 {
+				pos += stream + len("stream") + i + len("endstream")
+			}
+		}
+	}
+	return objects
+}
+
+// objectStream returns the objects of o if it is an object stream, at the
+// position of the stream.
+func objectStream(rdr *pdf.Reader, o scannedObject) (objects []scannedObject) {
+	defer func() {
+		if recover() != nil {
+			objects = nil
+		}
+	}()
+	stream := resolve(rdr, o.id)
+	if stream.Kind() != pdf.Stream || stream.Key("Type").Name() != "ObjStm" {
+		return nil
+	}
+	// Only the header of object numbers and offsets is read.
+	n := stream.Key("N").Int64()
+	header := make([]byte, stream.Key("First").Int64())
+	if _, err := io.ReadFull(stream.Reader(), header); err != nil {
+		return nil
+	}
+	fields := bytes.Fields(header)
+	for i := int64(0); i < n && int(2*i+1) < len(fields); i++ {
+		id, err := strconv.ParseInt(string(fields[2*i]), 10, 32)
+		if err != nil || id == 0 {
+			continue
+		}
+		objects = append(objects, scannedObject{id: id, position: o.position, entry: entry{typ: 2, field2: o.id, field3: i}})
+	}
+	return objects
+}
+
+// lastCatalog returns the number of the last document catalog of objects.
+func lastCatalog(rdr *pdf.Reader, objects []scannedObject) (int64, bool) {
+	for i := len(objects) - 1; i >= 0; i-- {
+		if objects[i].entry.typ == 1 && resolveType(rdr, objects[i].id) == "Catalog" {
+			return objects[i].id, true
+		}
+	}
+	return 0, false
+}
+
+// rootType returns the Type of the Root of the trailer of rdr, or an empty
+// name if it can not be read.
+func rootType(rdr *pdf.Reader) (name string) {
+	defer func() {
+		if recover() != nil {
+			name = ""
+		}
+	}()
+	return rdr.Trailer().Key("Root").Key("Type").Name()
+}
+
+// resolveType returns the Type of the object id of rdr, or an empty name if
+// it can not be read.
+func resolveType(rdr *pdf.Reader, id int64) (name string) {
+	defer func() {
+		if recover() != nil {
+			name = ""
+		}
+	}()
+	return resolve(rdr, id).Key("Type").Name()
+}
+
+// resolve returns the object id of rdr, it panics if the object can not be
+// read.
+func resolve(rdr *pdf.Reader, id int64) pdf.Value {
+	xrefs := rdr.Xref()
+	if id >= int64(len(xrefs)) {
+		return pdf.Value{}
+	}
+	ptr := xrefs[id].Ptr()
+	return rdr.Resolve(ptr, ptr)
+}
@@ -0,0 +1,141 @@
+package xref
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/digitorus/pdf"
+)
+
+// brokenDocument returns a document whose cross-reference table gives
+// offsets that are off by 10 bytes, as after an edit that did not update
+// the table. The page 3 is redefined after the table without a new section,
+// and the content stream contains the text of an object.
+func brokenDocument() []byte {
+	document := bytes.NewBufferString("%PDF-1.4\n")
+	offsets := make([]int, 6)
+	content := "BT (1 0 obj) Tj ET"
+	for id, object := range []string{
+		1: "<< /Type /Catalog /Pages 2 0 R >>",
+		2: "<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		3: "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R >>",
+		4: fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+		5: "<< /Producer (scanner) >>",
+	} {
+		if object != "" {
+			offsets[id] = document.Len()
+			_, _ = fmt.Fprintf(document, "%d 0 obj\n%s\nendobj\n", id, object)
+		}
+	}
+	table := document.Len()
+	document.WriteString("xref\n0 6\n0000000000 65535 f \n")
+	for _, offset := range offsets[1:] {
+		_, _ = fmt.Fprintf(document, "%010d 00000 n \n", offset+10)
+	}
+	_, _ = fmt.Fprintf(document, "trailer\n<< /Size 6 /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", table)
+	document.WriteString("3 0 obj\n<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Contents 4 0 R >>\nendobj\n")
+	return document.Bytes()
+}
+
+func TestRepair(t *testing.T) {
+	hybrid := hybridDocument()
+	hybrid = hybrid[:bytes.LastIndex(hybrid, []byte("startxref"))]
+
+	tests := []struct {
+		name     string
+		document []byte
+		producer string
+		width    int64
+	}{
+		{"wrong offsets", brokenDocument(), "scanner", 595},
+		{"object stream without startxref", hybrid, "hybrid", 612},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			size := int64(len(tt.document))
+			if rdr, err := pdf.NewReader(bytes.NewReader(tt.document), size); err == nil {
+				if err := Check(rdr); err == nil {
+					t.Fatalf("expected the document to be broken")
+				}
+			}
+
+			rdr, section, err := Repair(bytes.NewReader(tt.document), size)
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if err := Check(rdr); err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if producer := rdr.Trailer().Key("Info").Key("Producer").Text(); producer != tt.producer {
+				t.Errorf("expected the producer %q, got %q", tt.producer, producer)
+			}
+			page := rdr.Trailer().Key("Root").Key("Pages").Key("Kids").Index(0)
+			if width := page.Key("MediaBox").Index(2).Int64(); width != tt.width {
+				t.Errorf("expected the page of width %d, got %d", tt.width, width)
+			}
+			if !rdr.Trailer().Key("Prev").IsNull() {
+				t.Errorf("expected a section without Prev, got %v", rdr.Trailer())
+			}
+
+			// The section is a cross-reference stream that lists itself.
+			repaired := Concat(bytes.NewReader(tt.document), size, section)
+			data, err := io.ReadAll(repaired)
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if !bytes.HasPrefix(data, tt.document) || !bytes.HasSuffix(data, section) {
+				t.Fatalf("expected the document followed by the section")
+			}
+			plain, err := pdf.NewReader(repaired, repaired.Size())
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if plain.XrefInformation.Type != "stream" || plain.XrefInformation.StartPos != size+1 {
+				t.Errorf("expected a cross-reference stream at %d, got a %s at %d", size+1, plain.XrefInformation.Type, plain.XrefInformation.StartPos)
+			}
+			self := plain.XrefInformation.ItemCount - 1
+			if !strings.HasPrefix(string(section), fmt.Sprintf("\n%d 0 obj", self)) {
+				t.Errorf("expected the section to be the object %d, got %q", self, section[:16])
+			}
+		})
+	}
+}
+
+func TestRepairObjectInStream(t *testing.T) {
+	// The text of the content stream, after the catalog, is not taken for
+	// the object 1.
+	document := brokenDocument()
+	rdr, _, err := Repair(bytes.NewReader(document), int64(len(document)))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	ptr := rdr.Xref()[1].Ptr()
+	if kind := rdr.Resolve(ptr, ptr).Key("Type").Name(); kind != "Catalog" {
+		t.Errorf("expected the catalog as object 1, got %q", kind)
+	}
+}
+
+func TestRepairErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		want     string
+	}{
+		{"no objects", "%PDF-1.4\n%%EOF\n", "no objects found"},
+		{"no catalog", "%PDF-1.4\n1 0 obj\n<< /Type /Pages /Count 0 >>\nendobj\n", "no document catalog found"},
+		{"encrypted", "%PDF-1.4\n1 0 obj\n<< /Type /Catalog >>\nendobj\ntrailer\n<< /Root 1 0 R /Encrypt 2 0 R >>\n", "encrypted documents can not be repaired"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// pdf.Reader finds no %%EOF in documents of less than 200 bytes.
+			document := tt.document + strings.Repeat("% padding\n", 20)
+			_, _, err := Repair(strings.NewReader(document), int64(len(document)))
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("expected the error %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
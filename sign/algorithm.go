@@ -0,0 +1,273 @@
+package sign
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"io"
+)
+
+var (
+	oidSignatureRSA     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidSignatureRSAPSS  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+	oidMGF1             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 8}
+	oidSignatureEd25519 = asn1.ObjectIdentifier{1, 3, 101, 112}
+)
+
+// ecdsaOIDs are the ecdsa-with-SHA2 (RFC 5758) and id-ecdsa-with-sha3 (RFC
+// 8702) signature algorithms.
+var ecdsaOIDs = map[crypto.Hash]asn1.ObjectIdentifier{
+	crypto.SHA1:     {1, 2, 840, 10045, 4, 1},
+	crypto.SHA256:   {1, 2, 840, 10045, 4, 3, 2},
+	crypto.SHA384:   {1, 2, 840, 10045, 4, 3, 3},
+	crypto.SHA512:   {1, 2, 840, 10045, 4, 3, 4},
+	crypto.SHA3_256: {2, 16, 840, 1, 101, 3, 4, 3, 10},
+	crypto.SHA3_384: {2, 16, 840, 1, 101, 3, 4, 3, 11},
+	crypto.SHA3_512: {2, 16, 840, 1, 101, 3, 4, 3, 12},
+}
+
+// pssParameters reflects RSASSA-PSS-params, see RFC 4055, section 3.1.
+type pssParameters struct {
+	Hash         pkix.AlgorithmIdentifier `asn1:"explicit,tag:0"`
+	MGF          pkix.AlgorithmIdentifier `asn1:"explicit,tag:1"`
+	SaltLength   int                      `asn1:"explicit,tag:2"`
+	TrailerField int                      `asn1:"optional,explicit,tag:3,default:1"`
+}
+
+// pssSigner creates RSASSA-PSS signatures with a salt as long as the digest,
+// which is what RFC 4056 recommends for CMS and what verifiers expect.
+type pssSigner struct {
+	crypto.Signer
+}
+
+func (signer pssSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return signer.Signer.Sign(rand, digest, &rsa.PSSOptions{
+		SaltLength: rsa.PSSSaltLengthEqualsHash,
+		Hash:       opts.HashFunc(),
+	})
+}
+
+// validateSignatureAlgorithm checks that the selected signature algorithm can
+// be used with the signer's key, the digest algorithm and deterministic mode.
+func (context *SignContext) validateSignatureAlgorithm() error {
+	if context.SignData.Signature.CertType == TimeStampSignature {
+		return nil
+	}
+
+	algorithm := context.SignData.SignatureAlgorithm
+	if context.SignData.Deterministic {
+		if context.SignData.Signature.Info.Date.IsZero() {
+			return fmt.Errorf("deterministic signing requires a signature date")
+		}
+		// The salt of RSASSA-PSS is random, the signer can not be told to
+		// use a fixed one.
+		if algorithm == RSAPSS {
+			return fmt.Errorf("signature algorithm %s can not be used for deterministic signing", algorithm)
+		}
+	}
+
+	// ISO 32000-1, 12.8.3.3.1: the SHA-1 digest of the ByteRange is signed
+	// with SHA-1 as well.
+	if context.SignData.SubFilter == SubFilterAdbePKCS7SHA1 && context.SignData.DigestAlgorithm != crypto.SHA1 {
+		return fmt.Errorf("the %s SubFilter requires a SHA-1 digest", SubFilterAdbePKCS7SHA1)
+	}
+	if context.SignData.SubFilter == SubFilterAdbeX509RSASHA1 {
+		return context.validatePKCS1()
+	}
+
+	public := context.publicKey()
+	if public == nil {
+		if algorithm != 0 {
+			return fmt.Errorf("signer is required for signature algorithm %s", algorithm)
+		}
+		return nil
+	}
+
+	switch algorithm {
+	case 0:
+	case RSAPKCS1v15, RSAPSS:
+		if _, ok := public.(*rsa.PublicKey); !ok {
+			return fmt.Errorf("signature algorithm %s requires an RSA key", algorithm)
+		}
+	case ECDSA:
+		if _, ok := public.(*ecdsa.PublicKey); !ok {
+			return fmt.Errorf("signature algorithm %s requires an ECDSA key", algorithm)
+		}
+	case Ed25519:
+		if _, ok := public.(ed25519.PublicKey); !ok {
+			return fmt.Errorf("signature algorithm %s requires an Ed25519 key", algorithm)
+		}
+	default:
+		return fmt.Errorf("unknown signature algorithm: %s", algorithm)
+	}
+
+	// Ed25519 signatures are defined for PDF 2.0 by ISO/TS 32002, which only
+	// allows SHA-512 as digest, see also RFC 8419.
+	if _, ok := public.(ed25519.PublicKey); ok {
+		if !context.SignData.PDF20 {
+			return fmt.Errorf("Ed25519 signatures require PDF 2.0, see SignData.PDF20")
+		}
+		if context.SignData.DigestAlgorithm != crypto.SHA512 {
+			return fmt.Errorf("Ed25519 signatures require a SHA-512 digest")
+		}
+	}
+
+	// ECDSA signatures are only created on the curves that have an
+	// ecdsa-with-SHA2 profile for CMS, see RFC 5753 and RFC 5758.
+	if key, ok := public.(*ecdsa.PublicKey); ok {
+		switch key.Curve {
+		case elliptic.P256(), elliptic.P384(), elliptic.P521():
+		default:
+			return fmt.Errorf("unsupported ECDSA curve %s", key.Curve.Params().Name)
+		}
+		if _, ok := ecdsaOIDs[context.SignData.DigestAlgorithm]; !ok {
+			return fmt.Errorf("unsupported digest algorithm %s for ECDSA", context.SignData.DigestAlgorithm)
+		}
+	}
+
+	if algorithm == RSAPSS {
+		switch context.SignData.DigestAlgorithm {
+		case crypto.SHA256, crypto.SHA384, crypto.SHA512, crypto.SHA3_256, crypto.SHA3_384, crypto.SHA3_512:
+		default:
+			return fmt.Errorf("signature algorithm %s requires a SHA-2 or SHA-3 digest of at least 256 bits", algorithm)
+		}
+
+		// The encoded message holds the digest, the salt of the same length
+		// and two more bytes, see RFC 8017, section 9.1.1.
+		size := (public.(*rsa.PublicKey).N.BitLen() + 6) / 8
+		if size < 2*context.SignData.DigestAlgorithm.Size()+2 {
+			return fmt.Errorf("RSA key is too small for signature algorithm %s with %s", algorithm, context.SignData.DigestAlgorithm)
+		}
+	}
+
+	return nil
+}
+
+// signer returns the signer that creates signatures with the selected
+// signature algorithm.
+func (context *SignContext) signer() crypto.Signer {
+	if context.SignData.SignatureAlgorithm == RSAPSS {
+		return pssSigner{context.SignData.Signer}
+	}
+	return context.SignData.Signer
+}
+
+// signatureAlgorithmIdentifier returns the AlgorithmIdentifier of the
+// SignerInfo signatureAlgorithm for the key of the signing certificate.
+func (context *SignContext) signatureAlgorithmIdentifier() (*pkix.AlgorithmIdentifier, error) {
+	hash := context.SignData.DigestAlgorithm
+
+	switch context.SignData.Certificate.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if context.SignData.SignatureAlgorithm == RSAPSS {
+			return pssAlgorithmIdentifier(hash)
+		}
+		// The rsaEncryption identifier is used with any digest algorithm,
+		// see RFC 3370, section 3.2.
+		return &pkix.AlgorithmIdentifier{Algorithm: oidSignatureRSA, Parameters: asn1.NullRawValue}, nil
+	case *ecdsa.PublicKey:
+		if oid, ok := ecdsaOIDs[hash]; ok {
+			return &pkix.AlgorithmIdentifier{Algorithm: oid}, nil
+		}
+		return nil, fmt.Errorf("unsupported digest algorithm %s for ECDSA", hash)
+	case ed25519.PublicKey:
+		return &pkix.AlgorithmIdentifier{Algorithm: oidSignatureEd25519}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %T", context.SignData.Certificate.PublicKey)
+}
+
+// pssAlgorithmIdentifier returns the RSASSA-PSS AlgorithmIdentifier. The hash
+// and mask generation function parameters use the digest algorithm of the
+// SignerInfo, with the salt length of the digest size.
+func pssAlgorithmIdentifier(digest crypto.Hash) (*pkix.AlgorithmIdentifier, error) {
+	hash := pkix.AlgorithmIdentifier{
+		Algorithm:  getOIDFromHashAlgorithm(digest),
+		Parameters: asn1.NullRawValue,
+	}
+	mgf, err := asn1.Marshal(hash)
+	if err != nil {
+		return nil, err
+	}
+	params, err := asn1.Marshal(pssParameters{
+		Hash:         hash,
+		MGF:          pkix.AlgorithmIdentifier{Algorithm: oidMGF1, Parameters: asn1.RawValue{FullBytes: mgf}},
+		SaltLength:   digest.Size(),
+		TrailerField: 1,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &pkix.AlgorithmIdentifier{
+		Algorithm:  oidSignatureRSAPSS,
+		Parameters: asn1.RawValue{FullBytes: params},
+	}, nil
+}
+
+// signatureSize returns the maximum size of the signature value created with
+// the key of the signing certificate.
+func (context *SignContext) signatureSize() int {
+	switch key := context.SignData.Certificate.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return key.Size()
+	case *ecdsa.PublicKey:
+		// Ecdsa-Sig-Value is a SEQUENCE of the INTEGERs r and s, which are at
+		// most as long as the curve order plus a leading zero byte.
+		integer := 2 + (key.Curve.Params().BitSize+7)/8 + 1
+		if 2*integer > 127 {
+			return 3 + 2*integer
+		}
+		return 2 + 2*integer
+	case ed25519.PublicKey:
+		return ed25519.SignatureSize
+	}
+
+	// Unknown keys get enough room for a 4096 bit RSA key.
+	return 512
+}
+
+// defaultDigestAlgorithm returns the digest algorithm that is used when none
+// is given: the algorithm of an AlgorithmSigner, SHA-512 for Ed25519 keys and
+// SHA-256 otherwise.
+func (context *SignContext) defaultDigestAlgorithm() crypto.Hash {
+	switch context.SignData.SubFilter {
+	case SubFilterAdbePKCS7SHA1, SubFilterAdbeX509RSASHA1:
+		return crypto.SHA1
+	}
+	if signer, ok := context.SignData.Signer.(AlgorithmSigner); ok {
+		hash, _ := signer.SignatureAlgorithm()
+		return hash
+	}
+	if _, ok := context.publicKey().(ed25519.PublicKey); ok {
+		return crypto.SHA512
+	}
+	return crypto.SHA256
+}
+
+// publicKey returns the public key of the signer, or of the signing
+// certificate when the signature is created remotely.
+func (context *SignContext) publicKey() crypto.PublicKey {
+	if context.SignData.Signer != nil {
+		return context.SignData.Signer.Public()
+	}
+	if context.SignData.Certificate != nil {
+		return context.SignData.Certificate.PublicKey
+	}
+	return nil
+}
+
+// usesISO32002 reports whether the signature uses an algorithm from
+// ISO/TS 32002, which extends the PDF 2.0 signature algorithms.
+func (context *SignContext) usesISO32002() bool {
+	if context.SignData.Certificate == nil || context.SignData.Signature.CertType == TimeStampSignature {
+		return false
+	}
+	_, ok := context.SignData.Certificate.PublicKey.(ed25519.PublicKey)
+	return ok
+}
@@ -0,0 +1,434 @@
+package sign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/verify"
+	"github.com/digitorus/pkcs7"
+)
+
+func TestSignPDFRSAPSS(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	input, err := os.ReadFile("../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	for _, hash := range []crypto.Hash{crypto.SHA256, crypto.SHA384} {
+		t.Run(hash.String(), func(t *testing.T) {
+			rdr, err := pdf.NewReader(bytes.NewReader(input), int64(len(input)))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			var output bytes.Buffer
+			err = Sign(bytes.NewReader(input), &output, rdr, int64(len(input)), SignData{
+				Signature: SignDataSignature{
+					Info: SignDataSignatureInfo{
+						Name: "John Doe",
+						Date: time.Now().Local(),
+					},
+					CertType:   CertificationSignature,
+					DocMDPPerm: AllowFillingExistingFormFieldsAndSignaturesPerms,
+				},
+				Signer:             pkey,
+				DigestAlgorithm:    hash,
+				SignatureAlgorithm: RSAPSS,
+				Certificate:        cert,
+			})
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			signed, err := pdf.NewReader(bytes.NewReader(output.Bytes()), int64(output.Len()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			fields := signed.Trailer().Key("Root").Key("AcroForm").Key("Fields")
+			p7, err := pkcs7.Parse([]byte(fields.Index(fields.Len() - 1).Key("V").Key("Contents").RawString()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			algorithm := p7.Signers[0].DigestEncryptionAlgorithm
+			if !algorithm.Algorithm.Equal(oidSignatureRSAPSS) {
+				t.Fatalf("expected signature algorithm %s, got %s", oidSignatureRSAPSS, algorithm.Algorithm)
+			}
+			var params pssParameters
+			if _, err := asn1.Unmarshal(algorithm.Parameters.FullBytes, &params); err != nil {
+				t.Fatalf("failed to parse RSASSA-PSS parameters: %s", err)
+			}
+			if !params.Hash.Algorithm.Equal(getOIDFromHashAlgorithm(hash)) || !params.MGF.Algorithm.Equal(oidMGF1) {
+				t.Errorf("unexpected RSASSA-PSS hash %s and mask generation function %s", params.Hash.Algorithm, params.MGF.Algorithm)
+			}
+			if params.SaltLength != hash.Size() || params.TrailerField != 1 {
+				t.Errorf("expected salt length %d and trailer field 1, got %d and %d", hash.Size(), params.SaltLength, params.TrailerField)
+			}
+
+			info, err := verify.Verify(bytes.NewReader(output.Bytes()), int64(output.Len()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if len(info.Signers) != 1 || !info.Signers[0].ValidSignature {
+				t.Errorf("expected a single valid signature")
+			}
+		})
+	}
+}
+
+// createTestCertificate creates a self-signed signing certificate for key.
+func createTestCertificate(t *testing.T, key crypto.Signer) *x509.Certificate {
+	t.Helper()
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(3),
+		Subject:               pkix.Name{CommonName: "pdfsign test signer"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	return cert
+}
+
+func TestSignPDFECDSA(t *testing.T) {
+	input, err := os.ReadFile("../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	tests := []struct {
+		curve     elliptic.Curve
+		hash      crypto.Hash
+		algorithm asn1.ObjectIdentifier
+	}{
+		{curve: elliptic.P256(), hash: crypto.SHA256, algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}},
+		{curve: elliptic.P384(), hash: crypto.SHA384, algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}},
+		{curve: elliptic.P521(), hash: crypto.SHA512, algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.curve.Params().Name, func(t *testing.T) {
+			key, err := ecdsa.GenerateKey(tt.curve, rand.Reader)
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			cert := createTestCertificate(t, key)
+
+			rdr, err := pdf.NewReader(bytes.NewReader(input), int64(len(input)))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			var output bytes.Buffer
+			err = Sign(bytes.NewReader(input), &output, rdr, int64(len(input)), SignData{
+				Signature: SignDataSignature{
+					Info: SignDataSignatureInfo{
+						Name: "John Doe",
+						Date: time.Now().Local(),
+					},
+					CertType: ApprovalSignature,
+				},
+				Signer:             key,
+				DigestAlgorithm:    tt.hash,
+				SignatureAlgorithm: ECDSA,
+				Certificate:        cert,
+			})
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			signed, err := pdf.NewReader(bytes.NewReader(output.Bytes()), int64(output.Len()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			fields := signed.Trailer().Key("Root").Key("AcroForm").Key("Fields")
+			p7, err := pkcs7.Parse([]byte(fields.Index(fields.Len() - 1).Key("V").Key("Contents").RawString()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if got := p7.Signers[0].DigestEncryptionAlgorithm.Algorithm; !got.Equal(tt.algorithm) {
+				t.Errorf("expected signature algorithm %s, got %s", tt.algorithm, got)
+			}
+
+			info, err := verify.Verify(bytes.NewReader(output.Bytes()), int64(output.Len()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if len(info.Signers) != 1 || !info.Signers[0].ValidSignature {
+				t.Errorf("expected a single valid signature")
+			}
+		})
+	}
+}
+
+func TestSignPDFEd25519(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	cert := createTestCertificate(t, key)
+
+	input, err := os.ReadFile("../testfiles/testfile12.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	sign := func(pdf20 bool) ([]byte, error) {
+		rdr, err := pdf.NewReader(bytes.NewReader(input), int64(len(input)))
+		if err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+
+		var output bytes.Buffer
+		err = Sign(bytes.NewReader(input), &output, rdr, int64(len(input)), SignData{
+			Signature: SignDataSignature{
+				Info: SignDataSignatureInfo{
+					Name: "John Doe",
+					Date: time.Now().Local(),
+				},
+				CertType: ApprovalSignature,
+			},
+			Signer:      key,
+			Certificate: cert,
+			PDF20:       pdf20,
+		})
+		return output.Bytes(), err
+	}
+
+	if _, err := sign(false); err == nil {
+		t.Fatalf("expected an error for an Ed25519 signature without PDF 2.0")
+	}
+
+	output, err := sign(true)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	signed, err := pdf.NewReader(bytes.NewReader(output), int64(len(output)))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	root := signed.Trailer().Key("Root")
+	if got := root.Key("Version").Name(); got != "2.0" {
+		t.Errorf("expected version 2.0, got %q", got)
+	}
+	if !hasISO32002Extension(root.Key("Extensions")) {
+		t.Errorf("expected the ISO/TS 32002 developer extension")
+	}
+
+	fields := root.Key("AcroForm").Key("Fields")
+	p7, err := pkcs7.Parse([]byte(fields.Index(fields.Len() - 1).Key("V").Key("Contents").RawString()))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if got := p7.Signers[0].DigestEncryptionAlgorithm.Algorithm; !got.Equal(pkcs7.OIDEncryptionAlgorithmEDDSA25519) {
+		t.Errorf("expected signature algorithm id-Ed25519, got %s", got)
+	}
+	if got := p7.Signers[0].DigestAlgorithm.Algorithm; !got.Equal(getOIDFromHashAlgorithm(crypto.SHA512)) {
+		t.Errorf("expected digest algorithm SHA-512, got %s", got)
+	}
+
+	info, err := verify.Verify(bytes.NewReader(output), int64(len(output)))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if len(info.Signers) != 1 || !info.Signers[0].ValidSignature {
+		t.Errorf("expected a single valid signature")
+	}
+}
+
+func TestSignPDFSHA3(t *testing.T) {
+	input, err := os.ReadFile("../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	tests := []struct {
+		name      string
+		key       crypto.Signer
+		hash      crypto.Hash
+		algorithm SignatureAlgorithm
+		digest    asn1.ObjectIdentifier
+	}{
+		{name: "RSA-SHA3-256", key: rsaKey, hash: crypto.SHA3_256, algorithm: RSAPKCS1v15, digest: asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 8}},
+		{name: "RSAPSS-SHA3-512", key: rsaKey, hash: crypto.SHA3_512, algorithm: RSAPSS, digest: asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 10}},
+		{name: "ECDSA-SHA3-384", key: ecdsaKey, hash: crypto.SHA3_384, algorithm: ECDSA, digest: asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 9}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert := createTestCertificate(t, tt.key)
+
+			rdr, err := pdf.NewReader(bytes.NewReader(input), int64(len(input)))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			var output bytes.Buffer
+			err = Sign(bytes.NewReader(input), &output, rdr, int64(len(input)), SignData{
+				Signature: SignDataSignature{
+					Info: SignDataSignatureInfo{
+						Name: "John Doe",
+						Date: time.Now().Local(),
+					},
+					CertType: ApprovalSignature,
+				},
+				Signer:             tt.key,
+				DigestAlgorithm:    tt.hash,
+				SignatureAlgorithm: tt.algorithm,
+				Certificate:        cert,
+			})
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			signed, err := pdf.NewReader(bytes.NewReader(output.Bytes()), int64(output.Len()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			fields := signed.Trailer().Key("Root").Key("AcroForm").Key("Fields")
+			p7, err := pkcs7.Parse([]byte(fields.Index(fields.Len() - 1).Key("V").Key("Contents").RawString()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if got := p7.Signers[0].DigestAlgorithm.Algorithm; !got.Equal(tt.digest) {
+				t.Errorf("expected digest algorithm %s, got %s", tt.digest, got)
+			}
+
+			info, err := verify.Verify(bytes.NewReader(output.Bytes()), int64(output.Len()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if len(info.Signers) != 1 || !info.Signers[0].ValidSignature {
+				t.Errorf("expected a single valid signature")
+			}
+		})
+	}
+}
+
+func TestSignatureSize(t *testing.T) {
+	cert, _ := loadCertificateAndKey(t)
+	context := SignContext{SignData: SignData{Certificate: cert}}
+	if got := context.signatureSize(); got != 128 {
+		t.Errorf("expected 128 bytes for a 1024 bit RSA key, got %d", got)
+	}
+
+	digest := sha256.Sum256([]byte("pdfsign"))
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+		context := SignContext{SignData: SignData{Certificate: &x509.Certificate{PublicKey: &key.PublicKey}}}
+		size := context.signatureSize()
+
+		for i := 0; i < 50; i++ {
+			signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if len(signature) > size {
+				t.Fatalf("%s signature of %d bytes exceeds the size %d", curve.Params().Name, len(signature), size)
+			}
+		}
+	}
+}
+
+func TestValidateSignatureAlgorithm(t *testing.T) {
+	_, pkey := loadCertificateAndKey(t)
+
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	p224Key, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	tests := []struct {
+		name          string
+		signer        crypto.Signer
+		algorithm     SignatureAlgorithm
+		hash          crypto.Hash
+		pdf20         bool
+		deterministic bool
+		date          time.Time
+		wantErr       bool
+	}{
+		{name: "key default", signer: ecdsaKey, hash: crypto.SHA256},
+		{name: "pkcs1v15", signer: pkey, algorithm: RSAPKCS1v15, hash: crypto.SHA1},
+		{name: "pss", signer: pkey, algorithm: RSAPSS, hash: crypto.SHA384},
+		{name: "pss with sha512 and 1024 bit key", signer: pkey, algorithm: RSAPSS, hash: crypto.SHA512, wantErr: true},
+		{name: "pss with sha1", signer: pkey, algorithm: RSAPSS, hash: crypto.SHA1, wantErr: true},
+		{name: "pss with ecdsa key", signer: ecdsaKey, algorithm: RSAPSS, hash: crypto.SHA256, wantErr: true},
+		{name: "pss without signer", algorithm: RSAPSS, hash: crypto.SHA256, wantErr: true},
+		{name: "ecdsa", signer: ecdsaKey, algorithm: ECDSA, hash: crypto.SHA256},
+		{name: "ecdsa with rsa key", signer: pkey, algorithm: ECDSA, hash: crypto.SHA256, wantErr: true},
+		{name: "ecdsa with unsupported curve", signer: p224Key, hash: crypto.SHA256, wantErr: true},
+		{name: "ed25519", signer: ed25519Key, algorithm: Ed25519, hash: crypto.SHA512, pdf20: true},
+		{name: "ed25519 without pdf 2.0", signer: ed25519Key, hash: crypto.SHA512, wantErr: true},
+		{name: "ed25519 with sha256", signer: ed25519Key, hash: crypto.SHA256, pdf20: true, wantErr: true},
+		{name: "unknown", signer: pkey, algorithm: SignatureAlgorithm(99), hash: crypto.SHA256, wantErr: true},
+		{name: "deterministic", signer: ecdsaKey, hash: crypto.SHA256, deterministic: true, date: time.Now()},
+		{name: "deterministic without date", signer: pkey, hash: crypto.SHA256, deterministic: true, wantErr: true},
+		{name: "deterministic pss", signer: pkey, algorithm: RSAPSS, hash: crypto.SHA256, deterministic: true, date: time.Now(), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			context := SignContext{SignData: SignData{
+				Signature: SignDataSignature{
+					Info: SignDataSignatureInfo{Date: tt.date},
+				},
+				Signer:             tt.signer,
+				DigestAlgorithm:    tt.hash,
+				SignatureAlgorithm: tt.algorithm,
+				PDF20:              tt.pdf20,
+				Deterministic:      tt.deterministic,
+			}}
+			err := context.validateSignatureAlgorithm()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateSignatureAlgorithm() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
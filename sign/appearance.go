@@ -3,10 +3,15 @@ package sign
 import (
 	"bytes"
 	"compress/zlib"
+	"encoding/binary"
 	"fmt"
 	"image"
+	"image/color"
 	_ "image/jpeg" // register JPEG format
 	_ "image/png"  // register PNG format
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
 )
 
 // Helper functions for PDF resource components
@@ -28,6 +33,7 @@ func createFontResource(buffer *bytes.Buffer) {
 	buffer.WriteString("       /Type /Font\n")
 	buffer.WriteString("       /Subtype /Type1\n")
 	buffer.WriteString("       /BaseFont /Times-Roman\n")
+	buffer.WriteString("       /Encoding /WinAnsiEncoding\n")
 	buffer.WriteString("       /FirstChar 32\n") // Standard ASCII range start (space)
 	buffer.WriteString("       /LastChar 255\n") // Standard ASCII range end
 	buffer.WriteString("       /FontDescriptor <<\n")
@@ -67,16 +73,13 @@ func writeAppearanceStreamBuffer(buffer *bytes.Buffer, stream []byte) {
 func (context *SignContext) createImageXObject() ([]byte, []byte, error) {
 	imageData := context.SignData.Appearance.Image
 
-	// Read image to get format and decode image data
-	img, format, err := image.Decode(bytes.NewReader(imageData))
+	// Read the image header to get format and dimensions, JPEG data is
+	// embedded as is and only other images are decoded.
+	config, format, err := image.DecodeConfig(bytes.NewReader(imageData))
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to decode image: %w", err)
 	}
-
-	// Get image dimensions
-	bounds := img.Bounds()
-	width := bounds.Max.X - bounds.Min.X
-	height := bounds.Max.Y - bounds.Min.Y
+	width, height := config.Width, config.Height
 
 	// Create basic PDF Image XObject
 	var imageObject bytes.Buffer
@@ -87,7 +90,6 @@ func (context *SignContext) createImageXObject() ([]byte, []byte, error) {
 	imageObject.WriteString("  /Subtype /Image\n")
 	imageObject.WriteString(fmt.Sprintf("  /Width %d\n", width))
 	imageObject.WriteString(fmt.Sprintf("  /Height %d\n", height))
-	imageObject.WriteString("  /ColorSpace /DeviceRGB\n")
 	imageObject.WriteString("  /BitsPerComponent 8\n")
 
 	var rgbData = new(bytes.Buffer)
@@ -96,25 +98,44 @@ func (context *SignContext) createImageXObject() ([]byte, []byte, error) {
 	// Handle different formats
 	switch format {
 	case "jpeg":
+		// The DCT encoded data is embedded as is, so the color space must match
+		// the components of the JPEG.
+		switch config.ColorModel {
+		case color.GrayModel:
+			imageObject.WriteString("  /ColorSpace /DeviceGray\n")
+		case color.CMYKModel:
+			imageObject.WriteString("  /ColorSpace /DeviceCMYK\n")
+			// Adobe applications write inverted CMYK JPEGs and mark them with
+			// their APP14 segment, other CMYK JPEGs are not inverted.
+			if hasAdobeMarker(imageData) {
+				imageObject.WriteString("  /Decode [1 0 1 0 1 0 1 0]\n")
+			}
+		default:
+			imageObject.WriteString("  /ColorSpace /DeviceRGB\n")
+		}
 		imageObject.WriteString("  /Filter [/FlateDecode/DCTDecode]\n")
 		rgbData = bytes.NewBuffer(imageData) // JPEG data is already in the correct format
 	case "png":
+		img, _, err := image.Decode(bytes.NewReader(imageData))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decode image: %w", err)
+		}
+		bounds := img.Bounds()
+
+		imageObject.WriteString("  /ColorSpace /DeviceRGB\n")
 		imageObject.WriteString("  /Filter /FlateDecode\n")
 
 		// Extract RGB and alpha values from each pixel
 		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
 			for x := bounds.Min.X; x < bounds.Max.X; x++ {
-				// Get the color at pixel (x,y)
-				originalColor := img.At(x, y)
-
-				// Extract RGBA values (ranges from 0-65535 in Go's color model)
-				r, g, b, a := originalColor.RGBA()
-
-				// Convert to 8-bit (0-255)
-				rgbData.WriteByte(byte(r >> 8))
-				rgbData.WriteByte(byte(g >> 8))
-				rgbData.WriteByte(byte(b >> 8))
-				alphaData.WriteByte(byte(a >> 8))
+				// Get the color at pixel (x,y), the alpha is applied by the soft
+				// mask so the colors must not be premultiplied.
+				originalColor := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+
+				rgbData.WriteByte(originalColor.R)
+				rgbData.WriteByte(originalColor.G)
+				rgbData.WriteByte(originalColor.B)
+				alphaData.WriteByte(originalColor.A)
 			}
 		}
 
@@ -145,6 +166,42 @@ func (context *SignContext) createImageXObject() ([]byte, []byte, error) {
 	return imageObject.Bytes(), maskObjectBytes, nil
 }
 
+// hasAdobeMarker reports whether the JPEG data has an Adobe APP14 segment
+// before its first scan.
+func hasAdobeMarker(data []byte) bool {
+	if len(data) < 2 || data[0] != 0xff || data[1] != 0xd8 {
+		return false
+	}
+	for pos := 2; pos+4 <= len(data); {
+		if data[pos] != 0xff {
+			return false
+		}
+		marker := data[pos+1]
+		switch {
+		case marker == 0xff:
+			// Fill byte before a marker.
+			pos++
+			continue
+		case marker == 0x01 || marker >= 0xd0 && marker <= 0xd7:
+			// Markers without a segment.
+			pos += 2
+			continue
+		case marker == 0xda || marker == 0xd9:
+			// Start of scan or end of image.
+			return false
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			return false
+		}
+		if marker == 0xee && bytes.HasPrefix(data[pos+4:pos+2+length], []byte("Adobe")) {
+			return true
+		}
+		pos += 2 + length
+	}
+	return false
+}
+
 func compressData(data []byte) []byte {
 	var compressedData bytes.Buffer
 	writer := zlib.NewWriter(&compressedData)
@@ -181,51 +238,175 @@ func (context *SignContext) createAlphaMask(width, height int, alphaData []byte)
 	return maskObject.Bytes(), nil
 }
 
-// hasAlpha checks if the image has an alpha channel
+// hasAlpha checks if the image has transparent or translucent pixels
 func hasAlpha(img image.Image) bool {
-	switch img.(type) {
-	case *image.NRGBA, *image.RGBA:
-		return true
-	default:
-		return false
+	if opaque, ok := img.(interface{ Opaque() bool }); ok {
+		return !opaque.Opaque()
 	}
+	return true
 }
 
-func computeTextSizeAndPosition(text string, rectWidth, rectHeight float64) (float64, float64, float64) {
-	// Calculate font size
-	fontSize := rectHeight * 0.8                     // Use most of the height for the font
-	textWidth := float64(len(text)) * fontSize * 0.5 // Approximate text width
-	if textWidth > rectWidth {
-		fontSize = rectWidth / (float64(len(text)) * 0.5) // Adjust font size to fit text within rect width
+// Approximate metrics of the Times-Roman font, relative to the font size.
+const (
+	averageCharWidth = 0.5
+	lineSpacing      = 1.2
+)
+
+// appearanceLines returns the lines of text to draw in the appearance.
+func (context *SignContext) appearanceLines() []string {
+	info := context.SignData.Signature.Info
+	lines := []string{info.Name}
+
+	if !context.SignData.Appearance.ShowDetails {
+		return lines
+	}
+
+	if info.Reason != "" {
+		lines = append(lines, "Reason: "+info.Reason)
+	}
+	if info.Location != "" {
+		lines = append(lines, "Location: "+info.Location)
+	}
+	if !info.Date.IsZero() {
+		lines = append(lines, "Date: "+info.Date.Format("2006-01-02 15:04:05 -07:00"))
+	}
+
+	return lines
+}
+
+// timesRomanWidth approximates the width of the text in Times-Roman for a font
+// size of 1.
+func timesRomanWidth(text string) float64 {
+	return float64(utf8.RuneCountInString(text)) * averageCharWidth
+}
+
+// encodeTimesRoman returns the text as PDF string in the WinAnsiEncoding of
+// the Times-Roman font. Text with other characters, such as Chinese, Japanese
+// or Korean, can only be drawn with an embedded font.
+func encodeTimesRoman(text string) (string, error) {
+	if isASCII(text) {
+		return pdfString(text), nil
+	}
+	encoded, err := charmap.Windows1252.NewEncoder().String(text)
+	if err != nil {
+		return "", fmt.Errorf("the text %q has characters that Times-Roman can not display, set Appearance.Font to a font that has them", text)
+	}
+	return string(hexString([]byte(encoded))), nil
+}
+
+// computeTextLayout returns the font size and the position of each line, the
+// block of lines is centered vertically and aligned horizontally as requested.
+// textWidth returns the width of a line for a font size of 1.
+func computeTextLayout(lines []string, fontSize float64, alignment TextAlignment, rectWidth, rectHeight float64, textWidth func(string) float64) (float64, [][2]float64) {
+	longest := 0.0
+	for _, line := range lines {
+		if width := textWidth(line); width > longest {
+			longest = width
+		}
+	}
+
+	if fontSize <= 0 {
+		// Use most of the height for the text block
+		fontSize = rectHeight * 0.8 / (float64(len(lines)-1)*lineSpacing + 1)
+		if longest*fontSize > rectWidth {
+			fontSize = rectWidth / longest // Adjust font size to fit text within rect width
+		}
 	}
 
-	// Center text horizontally and vertically
-	textWidth = float64(len(text)) * fontSize * 0.5
-	textX := (rectWidth - textWidth) / 2
-	if textX < 0 {
-		textX = 0
+	lineHeight := fontSize * lineSpacing
+	blockHeight := float64(len(lines)-1)*lineHeight + fontSize
+	padding := fontSize / 4
+
+	positions := make([][2]float64, len(lines))
+	for i, line := range lines {
+		width := textWidth(line) * fontSize
+
+		var textX float64
+		switch alignment {
+		case TextAlignLeft:
+			textX = padding
+		case TextAlignRight:
+			textX = rectWidth - width - padding
+		default:
+			textX = (rectWidth - width) / 2
+		}
+		if textX < 0 {
+			textX = 0
+		}
+
+		// Approximate vertical centering of the block, from the top line down
+		textY := (rectHeight+blockHeight)/2 - fontSize + fontSize/3 - float64(i)*lineHeight
+
+		positions[i] = [2]float64{textX, textY}
 	}
-	textY := (rectHeight-fontSize)/2 + fontSize/3 // Approximate vertical centering
 
-	return fontSize, textX, textY
+	return fontSize, positions
 }
 
-func drawText(buffer *bytes.Buffer, text string, fontSize float64, x, y float64) {
-	buffer.WriteString("q\n")                       // Save graphics state
-	buffer.WriteString("BT\n")                      // Begin text
-	fmt.Fprintf(buffer, "/F1 %.2f Tf\n", fontSize)  // Set font and size
-	fmt.Fprintf(buffer, "%.2f %.2f Td\n", x, y)     // Set text position
-	buffer.WriteString("0.2 0.2 0.6 rg\n")          // Set font color to ballpoint-like color (RGB)
-	fmt.Fprintf(buffer, "%s Tj\n", pdfString(text)) // Show text
-	buffer.WriteString("ET\n")                      // End text
-	buffer.WriteString("Q\n")                       // Restore graphics state
+// writeColor writes the operator that sets the fill (rg) or stroke (RG) color.
+func writeColor(buffer *bytes.Buffer, c color.Color, operator string) {
+	r, g, b, _ := c.RGBA()
+	fmt.Fprintf(buffer, "%.3f %.3f %.3f %s\n", float64(r)/0xffff, float64(g)/0xffff, float64(b)/0xffff, operator)
+}
+
+func drawBackground(buffer *bytes.Buffer, c color.Color, rectWidth, rectHeight float64) {
+	buffer.WriteString("q\n") // Save graphics state
+	writeColor(buffer, c, "rg")
+	fmt.Fprintf(buffer, "0 0 %.2f %.2f re f\n", rectWidth, rectHeight)
+	buffer.WriteString("Q\n") // Restore graphics state
+}
+
+func drawBorder(buffer *bytes.Buffer, c color.Color, rectWidth, rectHeight float64) {
+	buffer.WriteString("q\n") // Save graphics state
+	writeColor(buffer, c, "RG")
+	buffer.WriteString("1 w\n") // Line width of one point, drawn inside the rectangle
+	fmt.Fprintf(buffer, "0.50 0.50 %.2f %.2f re S\n", rectWidth-1, rectHeight-1)
+	buffer.WriteString("Q\n") // Restore graphics state
+}
+
+// drawText draws a line of text, text must already be encoded as PDF string for
+// the font.
+func drawText(buffer *bytes.Buffer, text string, fontSize float64, x, y float64, c color.Color) {
+	buffer.WriteString("q\n")                      // Save graphics state
+	buffer.WriteString("BT\n")                     // Begin text
+	fmt.Fprintf(buffer, "/F1 %.2f Tf\n", fontSize) // Set font and size
+	fmt.Fprintf(buffer, "%.2f %.2f Td\n", x, y)    // Set text position
+	if c == nil {
+		buffer.WriteString("0.2 0.2 0.6 rg\n") // Set font color to ballpoint-like color (RGB)
+	} else {
+		writeColor(buffer, c, "rg")
+	}
+	fmt.Fprintf(buffer, "%s Tj\n", text) // Show text
+	buffer.WriteString("ET\n")           // End text
+	buffer.WriteString("Q\n")            // Restore graphics state
+}
+
+// computeImagePosition scales the image to fit the rectangle while preserving
+// its aspect ratio, and centers it. It returns the position and size to draw the
+// image at.
+func computeImagePosition(imageWidth, imageHeight int, rectWidth, rectHeight float64) (float64, float64, float64, float64) {
+	if imageWidth <= 0 || imageHeight <= 0 {
+		return 0, 0, rectWidth, rectHeight
+	}
+
+	scale := rectWidth / float64(imageWidth)
+	if s := rectHeight / float64(imageHeight); s < scale {
+		scale = s
+	}
+
+	width := float64(imageWidth) * scale
+	height := float64(imageHeight) * scale
+
+	return (rectWidth - width) / 2, (rectHeight - height) / 2, width, height
 }
 
-func drawImage(buffer *bytes.Buffer, rectWidth, rectHeight float64) {
+func drawImage(buffer *bytes.Buffer, imageWidth, imageHeight int, rectWidth, rectHeight float64) {
+	x, y, width, height := computeImagePosition(imageWidth, imageHeight, rectWidth, rectHeight)
+
 	// We save state twice on purpose due to the cm operation
 	buffer.WriteString("q\n") // Save graphics state
 	buffer.WriteString("q\n") // Save before image transformation
-	fmt.Fprintf(buffer, "%.2f 0 0 %.2f 0 0 cm\n", rectWidth, rectHeight)
+	fmt.Fprintf(buffer, "%.2f 0 0 %.2f %.2f %.2f cm\n", width, height, x, y)
 	buffer.WriteString("/Im1 Do\n") // Draw image
 	buffer.WriteString("Q\n")       // Restore after transformation
 	buffer.WriteString("Q\n")       // Restore graphics state
@@ -272,8 +453,48 @@ func (context *SignContext) createAppearance(rect [4]float64) ([]byte, error) {
 		createImageResource(&appearance_buffer, imageObjectId)
 	}
 
+	appearance := context.SignData.Appearance
+
+	var lines, encodedLines []string
+	textWidth := timesRomanWidth
 	if shouldDisplayText {
-		createFontResource(&appearance_buffer)
+		lines = context.appearanceLines()
+		encodedLines = make([]string, len(lines))
+
+		if len(appearance.Font) > 0 {
+			font, err := newEmbeddedFont(appearance.Font, appearance.FontIndex)
+			if err != nil {
+				return nil, err
+			}
+			textWidth = font.font.textWidth
+
+			// The text is encoded first, so only the used glyphs are embedded.
+			for i, line := range lines {
+				if missing := font.font.missing(line); missing != "" {
+					return nil, fmt.Errorf("the font %s has no glyphs for the characters %q", font.font.postScriptName, missing)
+				}
+				encodedLines[i] = font.encode(line)
+			}
+
+			fontObjectId, err := context.addFontObjects(font)
+			if err != nil {
+				return nil, fmt.Errorf("failed to embed font: %w", err)
+			}
+
+			appearance_buffer.WriteString("   /Font <<\n")
+			fmt.Fprintf(&appearance_buffer, "     /F1 %d 0 R\n", fontObjectId)
+			appearance_buffer.WriteString("   >>\n")
+		} else {
+			for i, line := range lines {
+				encoded, err := encodeTimesRoman(line)
+				if err != nil {
+					return nil, err
+				}
+				encodedLines[i] = encoded
+			}
+
+			createFontResource(&appearance_buffer)
+		}
 	}
 
 	appearance_buffer.WriteString("  >>\n")
@@ -281,14 +502,27 @@ func (context *SignContext) createAppearance(rect [4]float64) ([]byte, error) {
 	// Create the appearance stream
 	var appearance_stream_buffer bytes.Buffer
 
+	if appearance.BackgroundColor != nil {
+		drawBackground(&appearance_stream_buffer, appearance.BackgroundColor, rectWidth, rectHeight)
+	}
+
 	if hasImage {
-		drawImage(&appearance_stream_buffer, rectWidth, rectHeight)
+		config, _, err := image.DecodeConfig(bytes.NewReader(appearance.Image))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode image: %w", err)
+		}
+		drawImage(&appearance_stream_buffer, config.Width, config.Height, rectWidth, rectHeight)
 	}
 
 	if shouldDisplayText {
-		text := context.SignData.Signature.Info.Name
-		fontSize, textX, textY := computeTextSizeAndPosition(text, rectWidth, rectHeight)
-		drawText(&appearance_stream_buffer, text, fontSize, textX, textY)
+		fontSize, positions := computeTextLayout(lines, appearance.FontSize, appearance.TextAlignment, rectWidth, rectHeight, textWidth)
+		for i, line := range encodedLines {
+			drawText(&appearance_stream_buffer, line, fontSize, positions[i][0], positions[i][1], appearance.TextColor)
+		}
+	}
+
+	if appearance.BorderColor != nil {
+		drawBorder(&appearance_stream_buffer, appearance.BorderColor, rectWidth, rectHeight)
 	}
 
 	writeFormTypeAndLength(&appearance_buffer, appearance_stream_buffer.Len())
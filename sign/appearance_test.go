@@ -0,0 +1,259 @@
+package sign
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestComputeTextLayout(t *testing.T) {
+	lines := []string{"John Doe", "Reason: Test"}
+
+	tests := []struct {
+		name      string
+		alignment TextAlignment
+		check     func(t *testing.T, fontSize float64, positions [][2]float64)
+	}{
+		{
+			name:      "center",
+			alignment: TextAlignCenter,
+			check: func(t *testing.T, fontSize float64, positions [][2]float64) {
+				width := float64(len(lines[0])) * fontSize * averageCharWidth
+				if got, want := positions[0][0], (200-width)/2; got != want {
+					t.Errorf("expected x %.2f, got %.2f", want, got)
+				}
+			},
+		},
+		{
+			name:      "left",
+			alignment: TextAlignLeft,
+			check: func(t *testing.T, fontSize float64, positions [][2]float64) {
+				if positions[0][0] != positions[1][0] {
+					t.Errorf("expected lines to share the left margin, got %.2f and %.2f", positions[0][0], positions[1][0])
+				}
+			},
+		},
+		{
+			name:      "right",
+			alignment: TextAlignRight,
+			check: func(t *testing.T, fontSize float64, positions [][2]float64) {
+				for i, line := range lines {
+					end := positions[i][0] + float64(len(line))*fontSize*averageCharWidth
+					if end > 200 {
+						t.Errorf("line %d ends outside of the rectangle at %.2f", i, end)
+					}
+				}
+				if positions[0][0] <= positions[1][0] {
+					t.Errorf("expected the shorter line to start further right")
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fontSize, positions := computeTextLayout(lines, 10, tt.alignment, 200, 50, timesRomanWidth)
+			if fontSize != 10 {
+				t.Errorf("expected the configured font size, got %.2f", fontSize)
+			}
+			if positions[0][1] <= positions[1][1] {
+				t.Errorf("expected the first line above the second line")
+			}
+			tt.check(t, fontSize, positions)
+		})
+	}
+}
+
+func TestComputeTextLayoutFitsRectangle(t *testing.T) {
+	lines := []string{"A very long signer name that does not fit"}
+
+	fontSize, positions := computeTextLayout(lines, 0, TextAlignCenter, 100, 50, timesRomanWidth)
+	if width := float64(len(lines[0])) * fontSize * averageCharWidth; width > 100 {
+		t.Errorf("text width %.2f exceeds rectangle width", width)
+	}
+	if positions[0][0] < 0 {
+		t.Errorf("text starts outside of the rectangle")
+	}
+}
+
+func TestCreateAppearanceWithDetails(t *testing.T) {
+	context := SignContext{
+		SignData: SignData{
+			Signature: SignDataSignature{
+				Info: SignDataSignatureInfo{
+					Name:     "John Doe",
+					Reason:   "Approval",
+					Location: "Tallinn",
+					Date:     time.Date(2017, 9, 23, 14, 39, 0, 0, time.UTC),
+				},
+			},
+			Appearance: Appearance{
+				ShowDetails:     true,
+				FontSize:        8,
+				TextAlignment:   TextAlignLeft,
+				TextColor:       color.RGBA{R: 255, A: 255},
+				BackgroundColor: color.White,
+				BorderColor:     color.Black,
+			},
+		},
+	}
+
+	appearance, err := context.createAppearance([4]float64{0, 0, 200, 60})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	for _, expected := range []string{
+		"(John Doe) Tj",
+		"(Reason: Approval) Tj",
+		"(Location: Tallinn) Tj",
+		"(Date: 2017-09-23 14:39:00 +00:00) Tj",
+		"/F1 8.00 Tf",
+		"1.000 0.000 0.000 rg",
+		"1.000 1.000 1.000 rg\n0 0 200.00 60.00 re f",
+		"0.000 0.000 0.000 RG",
+	} {
+		if !strings.Contains(string(appearance), expected) {
+			t.Errorf("expected appearance to contain %q", expected)
+		}
+	}
+}
+
+func TestCreateAppearanceNameOnly(t *testing.T) {
+	context := SignContext{
+		SignData: SignData{
+			Signature: SignDataSignature{
+				Info: SignDataSignatureInfo{
+					Name:   "John Doe",
+					Reason: "Approval",
+				},
+			},
+		},
+	}
+
+	appearance, err := context.createAppearance([4]float64{0, 0, 200, 60})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	if strings.Contains(string(appearance), "Reason") {
+		t.Errorf("expected only the signer name without ShowDetails")
+	}
+	if !strings.Contains(string(appearance), "0.2 0.2 0.6 rg") {
+		t.Errorf("expected the default text color")
+	}
+	if strings.Contains(string(appearance), " re ") {
+		t.Errorf("expected no background or border by default")
+	}
+}
+
+func TestComputeImagePosition(t *testing.T) {
+	tests := []struct {
+		name                       string
+		imageWidth, imageHeight    int
+		rectWidth, rectHeight      float64
+		wantX, wantY, wantW, wantH float64
+	}{
+		{"same ratio", 200, 100, 100, 50, 0, 0, 100, 50},
+		{"wide image", 400, 100, 100, 50, 0, 12.5, 100, 25},
+		{"tall image", 100, 200, 100, 50, 37.5, 0, 25, 50},
+		{"invalid image", 0, 0, 100, 50, 0, 0, 100, 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x, y, w, h := computeImagePosition(tt.imageWidth, tt.imageHeight, tt.rectWidth, tt.rectHeight)
+			if x != tt.wantX || y != tt.wantY || w != tt.wantW || h != tt.wantH {
+				t.Errorf("computeImagePosition() = %v %v %v %v, want %v %v %v %v", x, y, w, h, tt.wantX, tt.wantY, tt.wantW, tt.wantH)
+			}
+		})
+	}
+}
+
+// testCMYKJPEG returns an 8x8 baseline JPEG with four components, with the
+// APP14 segment of Adobe applications if adobe is set. Each Huffman table
+// has a single code, so every block is a DC difference of zero and an end of
+// block.
+func testCMYKJPEG(adobe bool) []byte {
+	data := []byte{0xff, 0xd8}
+	if adobe {
+		data = append(data, 0xff, 0xee, 0, 14, 'A', 'd', 'o', 'b', 'e', 0, 100, 0, 0, 0, 0, 0)
+	}
+	data = append(data, 0xff, 0xdb, 0, 67, 0)
+	data = append(data, bytes.Repeat([]byte{1}, 64)...)
+	data = append(data, 0xff, 0xc0, 0, 20, 8, 0, 8, 0, 8, 4, 1, 0x11, 0, 2, 0x11, 0, 3, 0x11, 0, 4, 0x11, 0)
+	for _, class := range []byte{0x00, 0x10} {
+		data = append(data, 0xff, 0xc4, 0, 20, class, 1)
+		data = append(data, make([]byte, 15)...)
+		data = append(data, 0)
+	}
+	data = append(data, 0xff, 0xda, 0, 14, 4, 1, 0, 2, 0, 3, 0, 4, 0, 0, 63, 0)
+	return append(data, 0, 0xff, 0xd9)
+}
+
+func TestCreateImageXObject(t *testing.T) {
+	gray := image.NewGray(image.Rect(0, 0, 4, 4))
+	var grayJPEG bytes.Buffer
+	if err := jpeg.Encode(&grayJPEG, gray, nil); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	translucent := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	translucent.SetNRGBA(0, 0, color.NRGBA{R: 200, G: 100, B: 50, A: 128})
+	var translucentPNG bytes.Buffer
+	if err := png.Encode(&translucentPNG, translucent); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	opaque := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	draw.Draw(opaque, opaque.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	var opaquePNG bytes.Buffer
+	if err := png.Encode(&opaquePNG, opaque); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	tests := []struct {
+		name       string
+		image      []byte
+		colorSpace string
+		wantMask   bool
+		wantDecode bool // The inverted Decode array of Adobe CMYK JPEGs
+	}{
+		{"grayscale jpeg", grayJPEG.Bytes(), "/DeviceGray", false, false},
+		{"adobe cmyk jpeg", testCMYKJPEG(true), "/DeviceCMYK", false, true},
+		{"cmyk jpeg", testCMYKJPEG(false), "/DeviceCMYK", false, false},
+		{"translucent png", translucentPNG.Bytes(), "/DeviceRGB", true, false},
+		{"opaque png", opaquePNG.Bytes(), "/DeviceRGB", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			context := SignContext{
+				SignData: SignData{
+					Appearance: Appearance{Image: tt.image},
+				},
+				lastXrefID: 10,
+			}
+
+			imageObject, mask, err := context.createImageXObject()
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if !strings.Contains(string(imageObject), "/ColorSpace "+tt.colorSpace+"\n") {
+				t.Errorf("expected color space %s", tt.colorSpace)
+			}
+			if (mask != nil) != tt.wantMask {
+				t.Errorf("expected soft mask %v, got %v", tt.wantMask, mask != nil)
+			}
+			if decode := strings.Contains(string(imageObject), "/Decode [1 0 1 0 1 0 1 0]"); decode != tt.wantDecode {
+				t.Errorf("expected inverted decode %v, got %v", tt.wantDecode, decode)
+			}
+		})
+	}
+}
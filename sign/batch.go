@@ -0,0 +1,170 @@
+package sign
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// BatchDocument is a document that is signed by SignBatch.
+type BatchDocument struct {
+	Input     string             // Path of the document to sign
+	Output    string             // Path of the signed document, only written if signing succeeds
+	Signature *SignDataSignature // Replaces the Signature of the batch when set, such as the reason of the document
+}
+
+// BatchResult is the outcome of signing a BatchDocument.
+type BatchResult struct {
+	Document BatchDocument
+	Err      error
+}
+
+// SignBatch signs documents with sign_data, up to workers documents at the
+// same time, runtime.NumCPU() if zero. It returns the result of every
+// document in the order of documents, a failing document does not stop the
+// others. Documents whose output is their input, or the output of another
+// document, are not signed.
+//
+// The Signer of sign_data is shared and must be safe for concurrent use. The
+// requests to the TSA and its fallbacks share a client that keeps a
+// connection per worker open, unless the TSA or sign_data has an HTTPClient.
+// OnUsed of the TSA is called from the workers.
+func SignBatch(documents []BatchDocument, sign_data SignData, workers int) []BatchResult {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	workers = min(workers, len(documents))
+	if sign_data.HTTPClient == nil {
+		sign_data.TSA = sign_data.TSA.withSharedClient(workers)
+	}
+
+	results := make([]BatchResult, len(documents))
+	for index, err := range checkBatchOutputs(documents) {
+		results[index] = BatchResult{Document: documents[index], Err: err}
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				results[index] = BatchResult{
+					Document: documents[index],
+					Err:      signBatchDocument(documents[index], sign_data),
+				}
+			}
+		}()
+	}
+
+	for index := range documents {
+		if results[index].Err == nil {
+			indexes <- index
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	return results
+}
+
+// checkBatchOutputs returns the errors of the documents that can not be
+// signed by their index: a document that would overwrite its input, and all
+// documents that share an output, as they would overwrite each other.
+func checkBatchOutputs(documents []BatchDocument) map[int]error {
+	errs := make(map[int]error)
+	outputs := make(map[string][]int, len(documents))
+	for index, document := range documents {
+		output, err := filepath.Abs(document.Output)
+		if err != nil {
+			errs[index] = err
+			continue
+		}
+		outputs[output] = append(outputs[output], index)
+
+		if input, err := filepath.Abs(document.Input); err == nil && input == output {
+			errs[index] = fmt.Errorf("output %s is the input of the document", document.Output)
+		} else if inputInfo, err := os.Stat(document.Input); err == nil {
+			if outputInfo, err := os.Stat(document.Output); err == nil && os.SameFile(inputInfo, outputInfo) {
+				errs[index] = fmt.Errorf("output %s is the input of the document", document.Output)
+			}
+		}
+	}
+	for _, indexes := range outputs {
+		if len(indexes) < 2 {
+			continue
+		}
+		for _, index := range indexes {
+			if _, ok := errs[index]; !ok {
+				errs[index] = fmt.Errorf("output %s is the output of %d documents", documents[index].Output, len(indexes))
+			}
+		}
+	}
+	return errs
+}
+
+// signBatchDocument signs a single document of a batch, a panic while
+// reading a malformed document is returned as error. The signed document is
+// written to a new file next to the output that replaces it when signing
+// succeeds, so a failing document leaves the output as it was.
+func signBatchDocument(document BatchDocument, sign_data SignData) (err error) {
+	input, err := os.Open(document.Input)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = input.Close()
+	}()
+	info, err := input.Stat()
+	if err != nil {
+		return err
+	}
+
+	output, err := createBatchOutput(document.Output)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed to sign %s (%v)", document.Input, r)
+		}
+		if closeErr := output.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Rename(output.Name(), document.Output)
+		}
+		if err != nil {
+			_ = os.Remove(output.Name())
+		}
+	}()
+
+	if document.Signature != nil {
+		sign_data.Signature = *document.Signature
+	}
+	// The revocation data is appended to for each document.
+	sign_data.RevocationData.CRL = slices.Clip(sign_data.RevocationData.CRL)
+	sign_data.RevocationData.OCSP = slices.Clip(sign_data.RevocationData.OCSP)
+
+	return Sign(input, output, nil, info.Size(), sign_data)
+}
+
+// createBatchOutput creates a new file in the directory of output to write
+// the signed document to, with the permissions of os.Create.
+func createBatchOutput(output string) (*os.File, error) {
+	for {
+		name := output + "." + strconv.FormatUint(rand.Uint64(), 36) + ".tmp"
+		file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o666)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		return file, err
+	}
+}
@@ -0,0 +1,202 @@
+package sign
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdf"
+)
+
+func TestSignBatch(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+	tsa := newTestTSA(t)
+	dir := t.TempDir()
+
+	var documents []BatchDocument
+	for i := 0; i < 6; i++ {
+		documents = append(documents, BatchDocument{
+			Input:  "../testfiles/testfile20.pdf",
+			Output: filepath.Join(dir, "signed"+strconv.Itoa(i)+".pdf"),
+		})
+	}
+	documents[2].Signature = &SignDataSignature{
+		Info: SignDataSignatureInfo{
+			Name:   "Jane Doe",
+			Reason: "Invoice 2",
+			Date:   time.Now().Local(),
+		},
+		CertType: ApprovalSignature,
+	}
+	documents[4].Input = filepath.Join(dir, "missing.pdf")
+
+	var used atomic.Int32
+	results := SignBatch(documents, SignData{
+		Signature: SignDataSignature{
+			Info: SignDataSignatureInfo{
+				Name:   "John Doe",
+				Reason: "Batch",
+				Date:   time.Now().Local(),
+			},
+			CertType:   CertificationSignature,
+			DocMDPPerm: AllowFillingExistingFormFieldsAndSignaturesPerms,
+		},
+		Signer:      pkey,
+		Certificate: cert,
+		TSA: TSA{
+			URL:    tsa.URL,
+			OnUsed: func(url string) { used.Add(1) },
+		},
+	}, 3)
+
+	if len(results) != len(documents) {
+		t.Fatalf("expected %d results, got %d", len(documents), len(results))
+	}
+	for i, result := range results {
+		if result.Document.Output != documents[i].Output {
+			t.Errorf("expected the results in the order of the documents")
+		}
+		if i == 4 {
+			if result.Err == nil {
+				t.Errorf("expected an error for the missing document")
+			}
+			if _, err := os.Stat(result.Document.Output); !os.IsNotExist(err) {
+				t.Errorf("expected the output of the failed document to be removed")
+			}
+			continue
+		}
+		if result.Err != nil {
+			t.Fatalf("document %d: %s", i, result.Err.Error())
+		}
+
+		content, err := os.ReadFile(result.Document.Output)
+		if err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+		rdr, err := pdf.NewReader(bytes.NewReader(content), int64(len(content)))
+		if err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+		want := "Batch"
+		if i == 2 {
+			want = "Invoice 2"
+		}
+		if reason := rdr.Trailer().Key("Root").Key("AcroForm").Key("Fields").Index(0).Key("V").Key("Reason").Text(); reason != want {
+			t.Errorf("document %d: expected reason %q, got %q", i, want, reason)
+		}
+	}
+	if used.Load() != 5 {
+		t.Errorf("expected 5 timestamps, got %d", used.Load())
+	}
+}
+
+func TestSignBatchOutputs(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+	dir := t.TempDir()
+
+	original, err := os.ReadFile("../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	input := filepath.Join(dir, "input.pdf")
+	existing := filepath.Join(dir, "existing.pdf")
+	broken := filepath.Join(dir, "broken.pdf")
+	for name, content := range map[string][]byte{input: original, existing: []byte("previous"), broken: []byte("%PDF-1.7\nbroken")} {
+		if err := os.WriteFile(name, content, 0o644); err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+	}
+
+	documents := []BatchDocument{
+		{Input: input, Output: input},
+		{Input: input, Output: filepath.Join(dir, "same.pdf")},
+		{Input: "../testfiles/testfile20.pdf", Output: filepath.Join(dir, ".", "same.pdf")},
+		{Input: broken, Output: existing},
+		{Input: input, Output: filepath.Join(dir, "signed.pdf")},
+	}
+	results := SignBatch(documents, SignData{
+		Signature: SignDataSignature{
+			Info: SignDataSignatureInfo{
+				Name: "John Doe",
+				Date: time.Now().Local(),
+			},
+			CertType: ApprovalSignature,
+		},
+		Signer:      pkey,
+		Certificate: cert,
+	}, 2)
+
+	for i, want := range []string{
+		"is the input of the document",
+		"is the output of 2 documents",
+		"is the output of 2 documents",
+		"not a PDF file",
+		"",
+	} {
+		err := results[i].Err
+		if want == "" {
+			if err != nil {
+				t.Errorf("document %d: %s", i, err.Error())
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("document %d: expected error containing %q, got %v", i, want, err)
+		}
+	}
+
+	content, err := os.ReadFile(input)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if !bytes.Equal(content, original) {
+		t.Errorf("expected the input to be left as it is")
+	}
+	if content, err := os.ReadFile(existing); err != nil || string(content) != "previous" {
+		t.Errorf("expected the output of the failed document to be left as it is, got %q (%v)", content, err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if strings.Join(names, " ") != "broken.pdf existing.pdf input.pdf signed.pdf" {
+		t.Errorf("expected only the signed document to be written, got %v", names)
+	}
+}
+
+func TestTSAWithSharedClient(t *testing.T) {
+	custom := &http.Client{}
+	tsa := TSA{
+		URL:       "https://tsa.example.com",
+		Fallbacks: []TSA{{URL: "https://fallback.example.com"}, {URL: "https://custom.example.com", HTTPClient: custom}},
+	}
+
+	shared := tsa.withSharedClient(4)
+	if shared.HTTPClient == nil || shared.HTTPClient.Transport.(*http.Transport).MaxIdleConnsPerHost != 4 {
+		t.Fatalf("expected a shared client with 4 idle connections")
+	}
+	if shared.Fallbacks[0].HTTPClient == nil || shared.Fallbacks[0].HTTPClient == shared.HTTPClient {
+		t.Errorf("expected a shared client of the fallback")
+	}
+	if shared.Fallbacks[1].HTTPClient != custom {
+		t.Errorf("expected the client of the fallback to be kept")
+	}
+	if tsa.HTTPClient != nil || tsa.Fallbacks[0].HTTPClient != nil {
+		t.Errorf("the TSA of the caller must not be modified")
+	}
+
+	if empty := (TSA{}).withSharedClient(4); empty.HTTPClient != nil {
+		t.Errorf("expected no client without a URL")
+	}
+}
@@ -0,0 +1,182 @@
+package sign
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/digitorus/pkcs7"
+)
+
+// maxChainLength limits the number of certificates of a completed chain.
+const maxChainLength = 10
+
+// IssuerFetcher downloads missing issuer certificates from the caIssuers URLs
+// of the Authority Information Access extension (RFC 5280, section 4.2.2.1).
+// Downloaded certificates are cached by URL, an IssuerFetcher can be shared
+// between signatures.
+type IssuerFetcher struct {
+	HTTPClient *http.Client // Defaults to the client of WithHTTPClient, or a client with a timeout of 10 seconds
+
+	mu    sync.Mutex
+	cache map[string][]*x509.Certificate
+}
+
+// DefaultIssuerFetcher completes the certificate chains of SignData without
+// an IssuerFetcher.
+var DefaultIssuerFetcher = &IssuerFetcher{}
+
+var defaultIssuerClient = &http.Client{Timeout: 10 * time.Second}
+
+// CompleteChain returns chain, which starts with the signing certificate,
+// followed by the issuers that are missing up to a self-signed certificate.
+// The chain is completed as far as possible, the error reports why it is not
+// complete.
+func (f *IssuerFetcher) CompleteChain(chain []*x509.Certificate) ([]*x509.Certificate, error) {
+	return f.CompleteChainContext(context.Background(), chain)
+}
+
+// CompleteChainContext is CompleteChain with a context that cancels the
+// downloads.
+func (f *IssuerFetcher) CompleteChainContext(ctx context.Context, chain []*x509.Certificate) ([]*x509.Certificate, error) {
+	if len(chain) == 0 {
+		return chain, nil
+	}
+	completed := append([]*x509.Certificate(nil), chain...)
+
+	for len(completed) < maxChainLength {
+		last := completed[len(completed)-1]
+		if bytes.Equal(last.RawIssuer, last.RawSubject) {
+			return completed, nil
+		}
+		if len(last.IssuingCertificateURL) == 0 {
+			return completed, fmt.Errorf("no caIssuers URL in certificate %s", last.Subject)
+		}
+
+		issuer, err := f.issuer(ctx, last)
+		if err != nil {
+			return completed, err
+		}
+		for _, c := range completed {
+			if c.Equal(issuer) {
+				return completed, errors.New("loop in certificate chain")
+			}
+		}
+		completed = append(completed, issuer)
+	}
+	return completed, errors.New("certificate chain is too long")
+}
+
+// issuer returns the certificate at the caIssuers URLs that issued
+// certificate.
+func (f *IssuerFetcher) issuer(ctx context.Context, certificate *x509.Certificate) (*x509.Certificate, error) {
+	var errs []error
+	for _, url := range certificate.IssuingCertificateURL {
+		candidates, err := f.fetch(ctx, url)
+		if err != nil {
+			errs = append(errs, err)
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		for _, candidate := range candidates {
+			if bytes.Equal(certificate.RawIssuer, candidate.RawSubject) && certificate.CheckSignatureFrom(candidate) == nil {
+				return candidate, nil
+			}
+		}
+		errs = append(errs, fmt.Errorf("no issuer of %s at %s", certificate.Subject, url))
+	}
+	return nil, errors.Join(errs...)
+}
+
+// fetch returns the certificates at a caIssuers URL, a DER or PEM encoded
+// certificate or a certs-only CMS as in RFC 5280.
+func (f *IssuerFetcher) fetch(ctx context.Context, url string) ([]*x509.Certificate, error) {
+	f.mu.Lock()
+	cached, ok := f.cache[url]
+	f.mu.Unlock()
+	if ok {
+		return cached, nil
+	}
+
+	client := httpClient(ctx, f.HTTPClient, defaultIssuerClient)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare issuer request (%s): %w", url, err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch issuer: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("failed to fetch issuer (%s): status %d", url, resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read issuer (%s): %w", url, err)
+	}
+
+	certificates, err := parseIssuers(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid issuer (%s): %w", url, err)
+	}
+
+	f.mu.Lock()
+	if f.cache == nil {
+		f.cache = make(map[string][]*x509.Certificate)
+	}
+	f.cache[url] = certificates
+	f.mu.Unlock()
+	return certificates, nil
+}
+
+func parseIssuers(data []byte) ([]*x509.Certificate, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+	if certificate, err := x509.ParseCertificate(data); err == nil {
+		return []*x509.Certificate{certificate}, nil
+	}
+	p7, err := pkcs7.Parse(data)
+	if err != nil {
+		return nil, errors.New("not a certificate or a certs-only CMS")
+	}
+	return p7.Certificates, nil
+}
+
+// completeCertificateChain adds the missing issuers of the signing
+// certificate to the first certificate chain. Signing continues with the
+// incomplete chain if the issuers can not be fetched.
+func (context *SignContext) completeCertificateChain() {
+	chain := []*x509.Certificate{context.SignData.Certificate}
+	if len(context.SignData.CertificateChains) > 0 && len(context.SignData.CertificateChains[0]) > 0 {
+		chain = context.SignData.CertificateChains[0]
+	}
+
+	fetcher := context.SignData.IssuerFetcher
+	if fetcher == nil {
+		fetcher = DefaultIssuerFetcher
+	}
+	completed, _ := fetcher.CompleteChainContext(signingContext(&context.SignData), chain)
+	if len(completed) == len(chain) {
+		return
+	}
+
+	// The chains of the caller are not modified.
+	chains := [][]*x509.Certificate{completed}
+	if len(context.SignData.CertificateChains) > 1 {
+		chains = append(chains, context.SignData.CertificateChains[1:]...)
+	}
+	context.SignData.CertificateChains = chains
+}
@@ -0,0 +1,206 @@
+package sign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/verify"
+	"github.com/digitorus/pkcs7"
+)
+
+// issuerHierarchy is a root, an intermediate and a leaf certificate whose
+// caIssuers URLs point to server.
+type issuerHierarchy struct {
+	server       *httptest.Server
+	requests     atomic.Int32
+	root         *x509.Certificate
+	intermediate *x509.Certificate
+	leaf         *x509.Certificate
+
+	rootKey, intermediateKey, leafKey *ecdsa.PrivateKey
+}
+
+func newIssuerHierarchy(t *testing.T) *issuerHierarchy {
+	t.Helper()
+
+	h := &issuerHierarchy{}
+	responses := map[string][]byte{}
+	h.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.requests.Add(1)
+		response, ok := responses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(response)
+	}))
+	t.Cleanup(h.server.Close)
+
+	create := func(template, parent *x509.Certificate, public crypto.PublicKey, signer crypto.Signer) *x509.Certificate {
+		der, err := x509.CreateCertificate(rand.Reader, template, parent, public, signer)
+		if err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+		certificate, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+		return certificate
+	}
+	generate := func() *ecdsa.PrivateKey {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+		return key
+	}
+
+	now := time.Now()
+	h.rootKey, h.intermediateKey, h.leafKey = generate(), generate(), generate()
+
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "pdfsign Test Root"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	h.root = create(rootTemplate, rootTemplate, &h.rootKey.PublicKey, h.rootKey)
+
+	h.intermediate = create(&x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "pdfsign Test Intermediate"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IssuingCertificateURL: []string{h.server.URL + "/root.p7c"},
+	}, h.root, &h.intermediateKey.PublicKey, h.rootKey)
+
+	h.leaf = create(&x509.Certificate{
+		SerialNumber:          big.NewInt(3),
+		Subject:               pkix.Name{CommonName: "pdfsign Test Signer"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		IssuingCertificateURL: []string{h.server.URL + "/missing.crt", h.server.URL + "/intermediate.crt"},
+	}, h.intermediate, &h.leafKey.PublicKey, h.intermediateKey)
+
+	degenerated, err := pkcs7.DegenerateCertificate(h.root.Raw)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	responses["/root.p7c"] = degenerated
+	responses["/intermediate.crt"] = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: h.intermediate.Raw})
+
+	return h
+}
+
+func TestIssuerFetcherCompleteChain(t *testing.T) {
+	h := newIssuerHierarchy(t)
+	fetcher := &IssuerFetcher{HTTPClient: h.server.Client()}
+
+	chain, err := fetcher.CompleteChain([]*x509.Certificate{h.leaf})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if len(chain) != 3 || !chain[1].Equal(h.intermediate) || !chain[2].Equal(h.root) {
+		t.Fatalf("expected the leaf, intermediate and root certificate, got %d certificates", len(chain))
+	}
+	requests := h.requests.Load()
+
+	// The issuers are cached, only the missing URL is requested again.
+	if _, err := fetcher.CompleteChain([]*x509.Certificate{h.leaf}); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if h.requests.Load() != requests+1 {
+		t.Errorf("expected cached issuers, got %d new requests", h.requests.Load()-requests)
+	}
+
+	// Complete chains are not changed.
+	chain, err = fetcher.CompleteChain([]*x509.Certificate{h.leaf, h.intermediate, h.root})
+	if err != nil || len(chain) != 3 {
+		t.Errorf("expected the complete chain, got %d certificates (%v)", len(chain), err)
+	}
+}
+
+func TestIssuerFetcherMissingIssuer(t *testing.T) {
+	h := newIssuerHierarchy(t)
+	fetcher := &IssuerFetcher{HTTPClient: h.server.Client()}
+
+	// The intermediate can not be found without a caIssuers URL.
+	leaf := *h.leaf
+	leaf.IssuingCertificateURL = []string{h.server.URL + "/missing.crt"}
+	chain, err := fetcher.CompleteChain([]*x509.Certificate{&leaf})
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	if len(chain) != 1 {
+		t.Errorf("expected the incomplete chain, got %d certificates", len(chain))
+	}
+
+	cert, _ := loadCertificateAndKey(t)
+	cert.IssuingCertificateURL = nil
+	if _, err := fetcher.CompleteChain([]*x509.Certificate{cert}); err != nil {
+		t.Errorf("expected self-signed certificates to be complete: %s", err.Error())
+	}
+}
+
+func TestSignPDFCompletesCertificateChain(t *testing.T) {
+	h := newIssuerHierarchy(t)
+
+	input, err := os.ReadFile("../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	rdr, err := pdf.NewReader(bytes.NewReader(input), int64(len(input)))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	var output bytes.Buffer
+	err = Sign(bytes.NewReader(input), &output, rdr, int64(len(input)), SignData{
+		Signature: SignDataSignature{
+			Info: SignDataSignatureInfo{
+				Name: "John Doe",
+				Date: time.Now().Local(),
+			},
+			CertType: ApprovalSignature,
+		},
+		Signer:          h.leafKey,
+		Certificate:     h.leaf,
+		DigestAlgorithm: crypto.SHA256,
+		IssuerFetcher:   &IssuerFetcher{HTTPClient: h.server.Client()},
+	})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	info, err := verify.Verify(bytes.NewReader(output.Bytes()), int64(output.Len()))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if len(info.Signers) != 1 || !info.Signers[0].ValidSignature {
+		t.Fatalf("expected a single valid signature")
+	}
+	if len(info.Signers[0].Certificates) != 3 {
+		t.Errorf("expected 3 embedded certificates, got %d", len(info.Signers[0].Certificates))
+	}
+}
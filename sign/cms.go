@@ -0,0 +1,287 @@
+package sign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"math/big"
+	"slices"
+	"time"
+)
+
+// The CMS SignedData (RFC 5652) of the signature is built here rather than
+// with pkcs7, which only knows the SHA-1 and SHA-2 digests and takes the
+// signing time from the clock.
+
+var (
+	oidData                   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidAttributeContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttributeMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidAttributeSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidAttributeTimeStamp     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 14}
+)
+
+type cmsContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"optional"`
+}
+
+type cmsSignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      cmsContentInfo
+	Certificates     asn1.RawValue   `asn1:"optional"`
+	CRLs             asn1.RawValue   `asn1:"optional,tag:1"`
+	SignerInfos      []cmsSignerInfo `asn1:"set"`
+}
+
+type cmsIssuerAndSerial struct {
+	IssuerName   asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type cmsSignerInfo struct {
+	Version                   int
+	IssuerAndSerialNumber     cmsIssuerAndSerial
+	DigestAlgorithm           pkix.AlgorithmIdentifier
+	AuthenticatedAttributes   []cmsAttribute `asn1:"optional,omitempty,tag:0"`
+	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedDigest           []byte
+	UnauthenticatedAttributes []cmsAttribute `asn1:"optional,omitempty,tag:1"`
+}
+
+type cmsAttribute struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue `asn1:"set"`
+}
+
+// signingTime returns the time of the signing-time attribute, the signature
+// date in deterministic mode and the current time otherwise.
+func (context *SignContext) signingTime() time.Time {
+	if context.SignData.Deterministic {
+		return context.SignData.Signature.Info.Date
+	}
+	return time.Now()
+}
+
+// random returns the source of randomness of the signer. Deterministic mode
+// passes none, which makes ECDSA keys sign according to RFC 6979.
+func (context *SignContext) random() io.Reader {
+	if context.SignData.Deterministic {
+		return nil
+	}
+	return rand.Reader
+}
+
+// newCMSAttribute creates an attribute with a single DER encoded value.
+func newCMSAttribute(attributeType asn1.ObjectIdentifier, value interface{}) (cmsAttribute, error) {
+	der, err := asn1.Marshal(value)
+	if err != nil {
+		return cmsAttribute{}, fmt.Errorf("failed to marshal attribute %s: %w", attributeType, err)
+	}
+	return cmsAttribute{
+		Type:  attributeType,
+		Value: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: der},
+	}, nil
+}
+
+// sortCMSAttributes sorts the attributes in the DER order of a SET OF, and
+// returns the DER encoding of the set, which is what the signature covers.
+func sortCMSAttributes(attributes []cmsAttribute) ([]byte, error) {
+	encoded := make([][]byte, len(attributes))
+	for i, attribute := range attributes {
+		der, err := asn1.Marshal(attribute)
+		if err != nil {
+			return nil, err
+		}
+		encoded[i] = der
+	}
+
+	order := make([]int, len(attributes))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return bytes.Compare(encoded[a], encoded[b])
+	})
+
+	sorted := make([]cmsAttribute, len(attributes))
+	var set []byte
+	for i, index := range order {
+		sorted[i] = attributes[index]
+		set = append(set, encoded[index]...)
+	}
+	copy(attributes, sorted)
+
+	return asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: set})
+}
+
+// createSignedData signs the content with the digest of contentHash and
+// returns the detached SignedData with the signer info of the signing
+// certificate, or the SignedData with the encapsulated digest of
+// adbe.pkcs7.sha1 signatures.
+func (context *SignContext) createSignedData(digest []byte, signedAttributes []cmsAttribute) (*cmsSignedData, error) {
+	if context.SignData.Signer == nil {
+		return nil, fmt.Errorf("signer is required")
+	}
+
+	sd, signed, err := context.prepareSignedData(digest, signedAttributes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ed25519 signs the attributes itself, the other algorithms sign their
+	// digest.
+	var signature []byte
+	if sd.SignerInfos[0].DigestEncryptionAlgorithm.Algorithm.Equal(oidSignatureEd25519) {
+		signature, err = context.signer().Sign(context.random(), signed, crypto.Hash(0))
+	} else {
+		h := context.SignData.DigestAlgorithm.New()
+		h.Write(signed)
+		signature, err = context.signer().Sign(context.random(), h.Sum(nil), context.SignData.DigestAlgorithm)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+	sd.SignerInfos[0].EncryptedDigest = signature
+
+	return sd, nil
+}
+
+// contentHash returns the digest algorithm of the ByteRange content, SHA-1
+// for the encapsulated digest of adbe.pkcs7.sha1 signatures.
+func (context *SignContext) contentHash() crypto.Hash {
+	if context.SignData.SubFilter == SubFilterAdbePKCS7SHA1 {
+		return crypto.SHA1
+	}
+	return context.SignData.DigestAlgorithm
+}
+
+// prepareSignedData returns the SignedData of the content with the digest
+// of contentHash without the signature value, and the DER encoding of the
+// signed attributes that the signature value is calculated over.
+func (context *SignContext) prepareSignedData(digest []byte, signedAttributes []cmsAttribute) (*cmsSignedData, []byte, error) {
+	hash := context.SignData.DigestAlgorithm
+	if !hash.Available() {
+		return nil, nil, fmt.Errorf("digest algorithm %s is not available", hash)
+	}
+	digestAlgorithm := pkix.AlgorithmIdentifier{Algorithm: getOIDFromHashAlgorithm(hash)}
+	if digestAlgorithm.Algorithm == nil {
+		return nil, nil, fmt.Errorf("unsupported digest algorithm %s", hash)
+	}
+
+	// The content of adbe.pkcs7.sha1 signatures is the SHA-1 digest of the
+	// ByteRange content.
+	contentInfo := cmsContentInfo{ContentType: oidData}
+	if context.SignData.SubFilter == SubFilterAdbePKCS7SHA1 {
+		der, err := asn1.Marshal(digest)
+		if err != nil {
+			return nil, nil, err
+		}
+		contentInfo.Content = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: der}
+
+		h := hash.New()
+		h.Write(digest)
+		digest = h.Sum(nil)
+	}
+
+	contentType, err := newCMSAttribute(oidAttributeContentType, oidData)
+	if err != nil {
+		return nil, nil, err
+	}
+	messageDigest, err := newCMSAttribute(oidAttributeMessageDigest, digest)
+	if err != nil {
+		return nil, nil, err
+	}
+	attributes := []cmsAttribute{contentType, messageDigest}
+	// CAdES signatures shall not contain the signing-time attribute, the
+	// signing time is the M entry of the signature dictionary, see ETSI EN
+	// 319 142-1, 5.4.2.
+	if !context.cades() {
+		signingTime, err := newCMSAttribute(oidAttributeSigningTime, context.signingTime().UTC())
+		if err != nil {
+			return nil, nil, err
+		}
+		attributes = append(attributes, signingTime)
+	}
+	attributes = append(attributes, signedAttributes...)
+
+	signed, err := sortCMSAttributes(attributes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal signed attributes: %w", err)
+	}
+
+	signatureAlgorithm, err := context.signatureAlgorithmIdentifier()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Add the first certificate chain without our own certificate, the
+	// issuer of the signer is the first certificate of the chain.
+	certificate := context.SignData.Certificate
+	certificates := []*x509.Certificate{certificate}
+	if len(context.SignData.CertificateChains) > 0 && len(context.SignData.CertificateChains[0]) > 1 {
+		chain := context.SignData.CertificateChains[0][1:]
+		if err := certificate.CheckSignatureFrom(chain[0]); err != nil {
+			return nil, nil, fmt.Errorf("certificate signature from parent is invalid: %w", err)
+		}
+		certificates = append(certificates, chain...)
+	}
+
+	var raw []byte
+	for _, cert := range certificates {
+		raw = append(raw, cert.Raw...)
+	}
+
+	var crls asn1.RawValue
+	if len(context.crls) > 0 {
+		crls = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, IsCompound: true, Bytes: bytes.Join(context.crls, nil)}
+	}
+
+	return &cmsSignedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{digestAlgorithm},
+		ContentInfo:      contentInfo,
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: raw},
+		CRLs:             crls,
+		SignerInfos: []cmsSignerInfo{{
+			Version: 1,
+			IssuerAndSerialNumber: cmsIssuerAndSerial{
+				IssuerName:   asn1.RawValue{FullBytes: certificate.RawIssuer},
+				SerialNumber: certificate.SerialNumber,
+			},
+			DigestAlgorithm:           digestAlgorithm,
+			AuthenticatedAttributes:   attributes,
+			DigestEncryptionAlgorithm: *signatureAlgorithm,
+		}},
+	}, signed, nil
+}
+
+// setTimestamp adds the signature time-stamp token (RFC 3161, appendix A) as
+// unsigned attribute of the signer.
+func (sd *cmsSignedData) setTimestamp(token []byte) error {
+	attribute, err := newCMSAttribute(oidAttributeTimeStamp, asn1.RawValue{FullBytes: token})
+	if err != nil {
+		return err
+	}
+	sd.SignerInfos[0].UnauthenticatedAttributes = []cmsAttribute{attribute}
+	return nil
+}
+
+// finish returns the DER encoded ContentInfo of the SignedData.
+func (sd *cmsSignedData) finish() ([]byte, error) {
+	inner, err := asn1.Marshal(*sd)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(cmsContentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: inner},
+	})
+}
@@ -0,0 +1,159 @@
+package sign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/asn1"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdf"
+)
+
+func TestSortCMSAttributes(t *testing.T) {
+	long, err := newCMSAttribute(oidAttributeMessageDigest, bytes.Repeat([]byte{0xff}, 64))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	short, err := newCMSAttribute(oidAttributeContentType, oidData)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	attributes := []cmsAttribute{long, short}
+	set, err := sortCMSAttributes(attributes)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	// The shorter encoding sorts first in DER.
+	if !attributes[0].Type.Equal(oidAttributeContentType) || !attributes[1].Type.Equal(oidAttributeMessageDigest) {
+		t.Errorf("expected the content type before the message digest, got %s %s", attributes[0].Type, attributes[1].Type)
+	}
+
+	var decoded []cmsAttribute
+	if _, err := asn1.UnmarshalWithParams(set, &decoded, "set"); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if len(decoded) != 2 || !decoded[0].Type.Equal(oidAttributeContentType) {
+		t.Errorf("expected the encoded set in sorted order")
+	}
+}
+
+// newReplayTSA returns a TSA that answers repeated requests with the response
+// the test TSA gave to the first one.
+func newReplayTSA(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	upstream := newTestTSA(t)
+
+	var mu sync.Mutex
+	responses := make(map[string][]byte)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		response, ok := responses[string(body)]
+		if !ok {
+			resp, err := http.Post(upstream.URL, r.Header.Get("Content-Type"), bytes.NewReader(body))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+			if response, err = io.ReadAll(resp.Body); err != nil {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+			responses[string(body)] = response
+		}
+
+		w.Header().Set("Content-Type", "application/timestamp-reply")
+		_, _ = w.Write(response)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestSignPDFDeterministic(t *testing.T) {
+	input, err := os.ReadFile("../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	cert, pkey := loadCertificateAndKey(t)
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	ecdsaCert := createTestCertificate(t, ecdsaKey)
+	tsa := newReplayTSA(t)
+
+	date := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		data SignData
+	}{
+		{
+			name: "rsa",
+			data: SignData{Signer: pkey, Certificate: cert},
+		},
+		{
+			name: "ecdsa",
+			data: SignData{Signer: ecdsaKey, Certificate: ecdsaCert},
+		},
+		{
+			name: "timestamp",
+			data: SignData{Signer: pkey, Certificate: cert, TSA: TSA{URL: tsa.URL}, Profile: PAdESBaselineT},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sign := func() []byte {
+				rdr, err := pdf.NewReader(bytes.NewReader(input), int64(len(input)))
+				if err != nil {
+					t.Fatalf("%s", err.Error())
+				}
+
+				data := tt.data
+				data.Signature = SignDataSignature{
+					Info: SignDataSignatureInfo{
+						Name: "John Doe",
+						Date: date,
+					},
+					CertType: ApprovalSignature,
+				}
+				data.DigestAlgorithm = crypto.SHA256
+				data.Deterministic = true
+
+				var output bytes.Buffer
+				if err := Sign(bytes.NewReader(input), &output, rdr, int64(len(input)), data); err != nil {
+					t.Fatalf("%s", err.Error())
+				}
+				return output.Bytes()
+			}
+
+			if first, second := sign(), sign(); !bytes.Equal(first, second) {
+				t.Errorf("expected identical output for identical input")
+			}
+		})
+	}
+}
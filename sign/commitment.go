@@ -0,0 +1,78 @@
+package sign
+
+import (
+	"encoding/asn1"
+	"fmt"
+)
+
+var oidAttributeCommitmentType = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 16}
+
+// commitmentTypes are the id-cti-ets commitment type identifiers of RFC 5126,
+// 5.11.1, with the Reason they are mirrored as.
+var commitmentTypes = map[CommitmentType]struct {
+	oid    asn1.ObjectIdentifier
+	reason string
+}{
+	ProofOfOrigin:   {asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 6, 1}, "Proof of origin"},
+	ProofOfReceipt:  {asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 6, 2}, "Proof of receipt"},
+	ProofOfDelivery: {asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 6, 3}, "Proof of delivery"},
+	ProofOfSender:   {asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 6, 4}, "Proof of sender"},
+	ProofOfApproval: {asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 6, 5}, "Proof of approval"},
+	ProofOfCreation: {asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 6, 6}, "Proof of creation"},
+}
+
+// commitmentTypeIndication reflects CommitmentTypeIndication without
+// qualifiers, see RFC 5126, 5.11.1.
+type commitmentTypeIndication struct {
+	CommitmentTypeID asn1.ObjectIdentifier
+}
+
+// validateCommitmentType checks the commitment type of the signature and
+// mirrors it as Reason if requested.
+func (context *SignContext) validateCommitmentType() error {
+	signature := &context.SignData.Signature
+	if signature.CommitmentType == 0 {
+		if signature.CommitmentReason {
+			return fmt.Errorf("a commitment type is required to use it as reason")
+		}
+		return nil
+	}
+
+	commitment, ok := commitmentTypes[signature.CommitmentType]
+	if !ok {
+		return fmt.Errorf("unknown commitment type: %s", signature.CommitmentType)
+	}
+	switch {
+	case signature.CertType == TimeStampSignature:
+		return fmt.Errorf("document timestamps can not have a commitment type")
+	case context.SignData.SubFilter == SubFilterAdbeX509RSASHA1:
+		return fmt.Errorf("%s signatures have no signed attributes for a commitment type", SubFilterAdbeX509RSASHA1)
+	}
+
+	// ETSI EN 319 142-1 does not allow a Reason next to the commitment type
+	// of PAdES signatures.
+	if context.cades() {
+		if signature.CommitmentReason || signature.Info.Reason != "" {
+			return fmt.Errorf("%s signatures with a commitment type can not have a reason", SubFilterETSICAdESDetached)
+		}
+		return nil
+	}
+	if signature.CommitmentReason && signature.Info.Reason == "" {
+		signature.Info.Reason = commitment.reason
+	}
+	return nil
+}
+
+// commitmentTypeAttribute returns the commitment-type-indication signed
+// attribute, or nil if the signature has no commitment type.
+func (context *SignContext) commitmentTypeAttribute() (*cmsAttribute, error) {
+	commitment, ok := commitmentTypes[context.SignData.Signature.CommitmentType]
+	if !ok {
+		return nil, nil
+	}
+	attribute, err := newCMSAttribute(oidAttributeCommitmentType, commitmentTypeIndication{CommitmentTypeID: commitment.oid})
+	if err != nil {
+		return nil, err
+	}
+	return &attribute, nil
+}
@@ -0,0 +1,161 @@
+package sign
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/asn1"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/verify"
+	"github.com/digitorus/pkcs7"
+)
+
+func TestSignPDFCommitmentType(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	input, err := os.ReadFile("../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	tests := []struct {
+		name       string
+		commitment CommitmentType
+		reason     bool
+		profile    PAdESProfile
+		want       asn1.ObjectIdentifier
+		wantReason string
+	}{
+		{name: "approval as reason", commitment: ProofOfApproval, reason: true, want: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 6, 5}, wantReason: "Proof of approval"},
+		{name: "origin", commitment: ProofOfOrigin, want: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 6, 1}},
+		{name: "PAdES creation", commitment: ProofOfCreation, profile: PAdESBaselineB, want: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 6, 6}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output bytes.Buffer
+			err := Sign(bytes.NewReader(input), &output, nil, int64(len(input)), SignData{
+				Signature: SignDataSignature{
+					Info: SignDataSignatureInfo{
+						Name: "John Doe",
+						Date: time.Now().Local(),
+					},
+					CertType:         CertificationSignature,
+					DocMDPPerm:       AllowFillingExistingFormFieldsAndSignaturesPerms,
+					CommitmentType:   tt.commitment,
+					CommitmentReason: tt.reason,
+				},
+				Signer:          pkey,
+				Certificate:     cert,
+				DigestAlgorithm: crypto.SHA256,
+				Profile:         tt.profile,
+			})
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			rdr, err := pdf.NewReader(bytes.NewReader(output.Bytes()), int64(output.Len()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			v := rdr.Trailer().Key("Root").Key("AcroForm").Key("Fields").Index(0).Key("V")
+			if got := v.Key("Reason").Text(); got != tt.wantReason {
+				t.Errorf("expected reason %q, got %q", tt.wantReason, got)
+			}
+
+			p7, err := pkcs7.Parse([]byte(v.Key("Contents").RawString()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			var indication commitmentTypeIndication
+			if err := p7.UnmarshalSignedAttribute(oidAttributeCommitmentType, &indication); err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if !indication.CommitmentTypeID.Equal(tt.want) {
+				t.Errorf("expected commitment type %s, got %s", tt.want, indication.CommitmentTypeID)
+			}
+
+			info, err := verify.Verify(bytes.NewReader(output.Bytes()), int64(output.Len()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if len(info.Signers) != 1 || !info.Signers[0].ValidSignature {
+				t.Errorf("expected a valid signature")
+			}
+		})
+	}
+}
+
+func TestValidateCommitmentType(t *testing.T) {
+	tests := []struct {
+		name       string
+		signData   SignData
+		wantErr    bool
+		wantReason string
+	}{
+		{
+			name: "no commitment type",
+		},
+		{
+			name:     "reason without commitment type",
+			signData: SignData{Signature: SignDataSignature{CommitmentReason: true}},
+			wantErr:  true,
+		},
+		{
+			name:     "unknown commitment type",
+			signData: SignData{Signature: SignDataSignature{CommitmentType: CommitmentType(99)}},
+			wantErr:  true,
+		},
+		{
+			name: "explicit reason is kept",
+			signData: SignData{Signature: SignDataSignature{
+				CommitmentType:   ProofOfReceipt,
+				CommitmentReason: true,
+				Info:             SignDataSignatureInfo{Reason: "Received"},
+			}},
+			wantReason: "Received",
+		},
+		{
+			name:     "document timestamp",
+			signData: SignData{Signature: SignDataSignature{CommitmentType: ProofOfOrigin, CertType: TimeStampSignature}},
+			wantErr:  true,
+		},
+		{
+			name:     "PKCS #1 signature",
+			signData: SignData{Signature: SignDataSignature{CommitmentType: ProofOfOrigin}, SubFilter: SubFilterAdbeX509RSASHA1},
+			wantErr:  true,
+		},
+		{
+			name: "CAdES with reason",
+			signData: SignData{
+				Signature: SignDataSignature{CommitmentType: ProofOfOrigin, Info: SignDataSignatureInfo{Reason: "Origin"}},
+				SubFilter: SubFilterETSICAdESDetached,
+			},
+			wantErr: true,
+		},
+		{
+			name: "PAdES with commitment type as reason",
+			signData: SignData{
+				Signature: SignDataSignature{CommitmentType: ProofOfOrigin, CommitmentReason: true},
+				Profile:   PAdESBaselineB,
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			context := SignContext{SignData: tt.signData}
+			err := context.validateCommitmentType()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateCommitmentType() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := context.SignData.Signature.Info.Reason; err == nil && got != tt.wantReason {
+				t.Errorf("expected reason %q, got %q", tt.wantReason, got)
+			}
+		})
+	}
+}
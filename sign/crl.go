@@ -0,0 +1,197 @@
+package sign
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/digitorus/pdfsign/revocation"
+)
+
+// CRLFetcher downloads the certificate revocation lists of the CRL
+// distribution points of certificates (RFC 5280, section 4.2.1.13). CRLs
+// are cached by URL until their next update, a CRLFetcher can be shared
+// between signatures.
+//
+// CRLs are embedded hex encoded and take twice their size in the document,
+// large CRLs are logged.
+type CRLFetcher struct {
+	HTTPClient *http.Client // Defaults to the client of WithHTTPClient, or a client with a timeout of 30 seconds
+	WarnSize   int64        // Size in bytes above which a CRL is logged as large, defaults to 1 MiB
+	MaxSize    int64        // Size in bytes of the largest CRL that is downloaded, defaults to 16 MiB
+
+	mu    sync.Mutex
+	cache map[string]*x509.RevocationList
+}
+
+// DefaultCRLFetcher is used by DefaultEmbedRevocationStatusFunction.
+var DefaultCRLFetcher = &CRLFetcher{}
+
+var defaultCRLClient = &http.Client{Timeout: 30 * time.Second}
+
+const (
+	defaultCRLWarnSize = 1 << 20
+	defaultCRLMaxSize  = 16 << 20
+)
+
+// Embed is a RevocationFunction that adds the CRL of the issuer of cert to
+// i. Certificates without an issuer or a CRL distribution point are skipped.
+func (f *CRLFetcher) Embed(cert, issuer *x509.Certificate, i *revocation.InfoArchival) error {
+	return f.EmbedContext(context.Background(), cert, issuer, i)
+}
+
+// EmbedContext is Embed with a context that cancels the downloads.
+func (f *CRLFetcher) EmbedContext(ctx context.Context, cert, issuer *x509.Certificate, i *revocation.InfoArchival) error {
+	if issuer == nil || len(cert.CRLDistributionPoints) == 0 {
+		return nil
+	}
+	crl, err := f.CRLContext(ctx, cert, issuer)
+	if err != nil {
+		return err
+	}
+	return i.AddCRL(crl)
+}
+
+// CRL returns the DER encoded CRL for cert, signed by issuer. The HTTP
+// distribution points of cert are tried in order until one returns a
+// current CRL. A revoked certificate is an error.
+func (f *CRLFetcher) CRL(cert, issuer *x509.Certificate) ([]byte, error) {
+	return f.CRLContext(context.Background(), cert, issuer)
+}
+
+// CRLContext is CRL with a context that cancels the downloads, the next
+// distribution points are not tried once ctx is done.
+func (f *CRLFetcher) CRLContext(ctx context.Context, cert, issuer *x509.Certificate) ([]byte, error) {
+	var errs []error
+	for _, url := range cert.CRLDistributionPoints {
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			errs = append(errs, fmt.Errorf("unsupported CRL distribution point %s", url))
+			continue
+		}
+
+		crl, err := f.fetch(ctx, url)
+		if err != nil {
+			errs = append(errs, err)
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		if err := crl.CheckSignatureFrom(issuer); err != nil {
+			errs = append(errs, fmt.Errorf("invalid CRL (%s): %w", url, err))
+			continue
+		}
+		if !crl.NextUpdate.IsZero() && crl.NextUpdate.Before(time.Now()) {
+			errs = append(errs, fmt.Errorf("expired CRL (%s)", url))
+			continue
+		}
+		for _, entry := range crl.RevokedCertificateEntries {
+			if entry.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+				return nil, fmt.Errorf("certificate %s is revoked since %s", cert.Subject, entry.RevocationTime)
+			}
+		}
+		return crl.Raw, nil
+	}
+	return nil, errors.Join(errs...)
+}
+
+// fetch returns the CRL at url, from the cache if it has not expired.
+func (f *CRLFetcher) fetch(ctx context.Context, url string) (*x509.RevocationList, error) {
+	f.mu.Lock()
+	cached, ok := f.cache[url]
+	f.mu.Unlock()
+	if ok && (cached.NextUpdate.IsZero() || cached.NextUpdate.After(time.Now())) {
+		return cached, nil
+	}
+
+	client := httpClient(ctx, f.HTTPClient, defaultCRLClient)
+	maxSize := f.MaxSize
+	if maxSize == 0 {
+		maxSize = defaultCRLMaxSize
+	}
+	warnSize := f.WarnSize
+	if warnSize == 0 {
+		warnSize = defaultCRLWarnSize
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare CRL request (%s): %w", url, err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch CRL: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("failed to fetch CRL (%s): status %d", url, resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CRL (%s): %w", url, err)
+	}
+	if int64(len(body)) > maxSize {
+		return nil, fmt.Errorf("CRL (%s) is larger than %d bytes", url, maxSize)
+	}
+	if int64(len(body)) > warnSize {
+		log.Printf("CRL (%s) is %d bytes, it adds %d bytes to the document", url, len(body), hex.EncodedLen(len(body)))
+	}
+
+	crl, err := x509.ParseRevocationList(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CRL (%s): %w", url, err)
+	}
+
+	f.mu.Lock()
+	if f.cache == nil {
+		f.cache = make(map[string]*x509.RevocationList)
+	}
+	f.cache[url] = crl
+	f.mu.Unlock()
+	return crl, nil
+}
+
+// fetchCRLs downloads the CRLs for the first certificate chain with the
+// CRLFetcher, they are added to the crls field of the SignedData.
+func (context *SignContext) fetchCRLs() error {
+	fetcher := context.SignData.CRLFetcher
+	if fetcher == nil {
+		return nil
+	}
+
+	chain := []*x509.Certificate{context.SignData.Certificate}
+	if len(context.SignData.CertificateChains) > 0 && len(context.SignData.CertificateChains[0]) > 0 {
+		chain = context.SignData.CertificateChains[0]
+	}
+
+	context.crls = nil
+	for i := 0; i < len(chain)-1; i++ {
+		if len(chain[i].CRLDistributionPoints) == 0 {
+			continue
+		}
+		crl, err := fetcher.CRLContext(signingContext(&context.SignData), chain[i], chain[i+1])
+		if err != nil {
+			return err
+		}
+		if slices.ContainsFunc(context.crls, func(c []byte) bool { return bytes.Equal(c, crl) }) {
+			continue
+		}
+		context.crls = append(context.crls, crl)
+
+		// Add space for the CRL and its header.
+		context.SignatureMaxLength += uint32(hex.EncodedLen(len(crl) + 8))
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package sign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/revocation"
+	"github.com/digitorus/pdfsign/verify"
+	"github.com/digitorus/pkcs7"
+)
+
+// newCRLServer serves CRLs of the intermediate of h, /revoked revokes
+// serial number 11, /forged is not signed by the intermediate and /expired
+// has expired.
+func newCRLServer(t *testing.T, h *issuerHierarchy) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	create := func(template *x509.RevocationList, key crypto.Signer) []byte {
+		crl, err := x509.CreateRevocationList(rand.Reader, template, h.intermediate, key)
+		if err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+		return crl
+	}
+	current := func(revoked ...x509.RevocationListEntry) *x509.RevocationList {
+		return &x509.RevocationList{
+			Number:                    big.NewInt(1),
+			ThisUpdate:                time.Now().Add(-time.Minute),
+			NextUpdate:                time.Now().Add(time.Hour),
+			RevokedCertificateEntries: revoked,
+		}
+	}
+	forgedKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	responses := map[string][]byte{
+		"/intermediate.crl": create(current(), h.intermediateKey),
+		"/revoked.crl":      create(current(x509.RevocationListEntry{SerialNumber: big.NewInt(11), RevocationTime: time.Now().Add(-time.Hour)}), h.intermediateKey),
+		"/forged.crl":       create(current(), forgedKey),
+		"/expired.crl": create(&x509.RevocationList{
+			Number:     big.NewInt(1),
+			ThisUpdate: time.Now().Add(-2 * time.Hour),
+			NextUpdate: time.Now().Add(-time.Hour),
+		}, h.intermediateKey),
+	}
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		response, ok := responses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(response)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+// newCRLLeaf returns a certificate issued by the intermediate of h with the
+// CRL distribution points urls.
+func newCRLLeaf(t *testing.T, h *issuerHierarchy, serial int64, urls ...string) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "pdfsign Test CRL Signer"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		CRLDistributionPoints: urls,
+	}, h.intermediate, &key.PublicKey, h.intermediateKey)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	return certificate, key
+}
+
+func TestCRLFetcherCRL(t *testing.T) {
+	h := newIssuerHierarchy(t)
+	server, _ := newCRLServer(t, h)
+
+	tests := []struct {
+		name    string
+		serial  int64
+		paths   []string
+		maxSize int64
+		wantErr string
+	}{
+		{name: "current", serial: 10, paths: []string{"/intermediate.crl"}},
+		{name: "next distribution point", serial: 10, paths: []string{"/missing.crl", "/intermediate.crl"}},
+		{name: "not revoked", serial: 10, paths: []string{"/revoked.crl"}},
+		{name: "revoked", serial: 11, paths: []string{"/revoked.crl"}, wantErr: "is revoked"},
+		{name: "invalid signature", serial: 10, paths: []string{"/forged.crl"}, wantErr: "invalid CRL"},
+		{name: "expired", serial: 10, paths: []string{"/expired.crl"}, wantErr: "expired CRL"},
+		{name: "too large", serial: 10, paths: []string{"/intermediate.crl"}, maxSize: 16, wantErr: "larger than 16 bytes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			urls := []string{"ldap://ldap.example.com/cn=CRL"}
+			for _, path := range tt.paths {
+				urls = append(urls, server.URL+path)
+			}
+			leaf, _ := newCRLLeaf(t, h, tt.serial, urls...)
+			fetcher := &CRLFetcher{HTTPClient: server.Client(), MaxSize: tt.maxSize}
+
+			crl, err := fetcher.CRL(leaf, h.intermediate)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected an error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if _, err := x509.ParseRevocationList(crl); err != nil {
+				t.Errorf("%s", err.Error())
+			}
+		})
+	}
+}
+
+func TestCRLFetcherCache(t *testing.T) {
+	h := newIssuerHierarchy(t)
+	server, requests := newCRLServer(t, h)
+	leaf, _ := newCRLLeaf(t, h, 10, server.URL+"/intermediate.crl")
+
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	fetcher := &CRLFetcher{HTTPClient: server.Client(), WarnSize: 16}
+	for i := 0; i < 2; i++ {
+		if _, err := fetcher.CRL(leaf, h.intermediate); err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+	}
+	if requests.Load() != 1 {
+		t.Errorf("expected a cached CRL, got %d requests", requests.Load())
+	}
+	if !strings.Contains(logged.String(), "/intermediate.crl) is ") {
+		t.Errorf("expected a warning about the CRL size, got %q", logged.String())
+	}
+
+	// Certificates without an issuer or a distribution point are skipped.
+	var info revocation.InfoArchival
+	if err := fetcher.Embed(leaf, nil, &info); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if err := fetcher.Embed(h.intermediate, h.root, &info); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if len(info.CRL) != 0 {
+		t.Errorf("expected no CRLs, got %d", len(info.CRL))
+	}
+}
+
+func TestSignPDFCRLFetcher(t *testing.T) {
+	h := newIssuerHierarchy(t)
+	server, _ := newCRLServer(t, h)
+	leaf, key := newCRLLeaf(t, h, 10, server.URL+"/intermediate.crl")
+
+	input, err := os.ReadFile("../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	var output bytes.Buffer
+	err = Sign(bytes.NewReader(input), &output, nil, int64(len(input)), SignData{
+		Signature: SignDataSignature{
+			Info: SignDataSignatureInfo{
+				Name: "John Doe",
+				Date: time.Now().Local(),
+			},
+			CertType: ApprovalSignature,
+		},
+		Signer:            key,
+		Certificate:       leaf,
+		CertificateChains: [][]*x509.Certificate{{leaf, h.intermediate, h.root}},
+		DigestAlgorithm:   crypto.SHA256,
+		CRLFetcher:        &CRLFetcher{HTTPClient: server.Client()},
+	})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	rdr, err := pdf.NewReader(bytes.NewReader(output.Bytes()), int64(output.Len()))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	v := rdr.Trailer().Key("Root").Key("AcroForm").Key("Fields").Index(0).Key("V")
+	p7, err := pkcs7.Parse([]byte(v.Key("Contents").RawString()))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if len(p7.CRLs) != 1 {
+		t.Fatalf("expected the CRL of the signing certificate in the SignedData, got %d", len(p7.CRLs))
+	}
+
+	result, err := verify.Verify(bytes.NewReader(output.Bytes()), int64(output.Len()))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if len(result.Signers) != 1 || !result.Signers[0].ValidSignature {
+		t.Fatalf("expected a valid signature")
+	}
+	for _, certificate := range result.Signers[0].Certificates {
+		if certificate.Certificate.Equal(leaf) && !certificate.CRLEmbedded {
+			t.Errorf("expected the embedded CRL of the signing certificate")
+		}
+	}
+}
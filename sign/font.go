@@ -0,0 +1,843 @@
+package sign
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// trueTypeFont is a parsed TrueType or OpenType font, it only contains the
+// information that is needed to embed the font in an appearance stream.
+type trueTypeFont struct {
+	data   []byte
+	tables map[string][]byte
+
+	postScriptName string
+	cff            bool     // OpenType font with CFF outlines
+	cids           []uint16 // CIDs of the glyphs of a CID-keyed CFF font, nil if the CIDs are the glyph ids
+
+	unitsPerEm  uint16
+	numGlyphs   uint16
+	longLoca    bool
+	advances    []uint16
+	cmap        map[rune]uint16
+	bbox        [4]int16
+	ascent      int16
+	descent     int16
+	capHeight   int16
+	italicAngle float64
+}
+
+// parseTrueTypeFont parses the tables of a TrueType (.ttf) or OpenType (.otf)
+// font, or of the first font of a collection (.ttc, .otc).
+func parseTrueTypeFont(data []byte) (*trueTypeFont, error) {
+	return parseCollectionFont(data, 0)
+}
+
+// parseCollectionFont parses the tables of the font index of a TrueType or
+// OpenType collection, see the OpenType specification, "Font Collections".
+// The index of a font that is not a collection must be 0. The font of a
+// collection is written as a font file of its own for embedding.
+func parseCollectionFont(data []byte, index int) (*trueTypeFont, error) {
+	if len(data) < 12 {
+		return nil, fmt.Errorf("font data too short")
+	}
+
+	font := &trueTypeFont{
+		data:   data,
+		tables: make(map[string][]byte),
+	}
+
+	// The table directory of the font, at the start of the file or at the
+	// offset of the font in a collection.
+	directory := 0
+	collection := binary.BigEndian.Uint32(data) == 0x74746366 // 'ttcf'
+	if collection {
+		numFonts := int(binary.BigEndian.Uint32(data[8:]))
+		if index < 0 || index >= numFonts || len(data) < 12+numFonts*4 {
+			return nil, fmt.Errorf("font collection has no font %d", index)
+		}
+		directory = int(binary.BigEndian.Uint32(data[12+index*4:]))
+		if directory+12 > len(data) {
+			return nil, fmt.Errorf("font %d of the collection out of bounds", index)
+		}
+	} else if index != 0 {
+		return nil, fmt.Errorf("font is not a collection, it has no font %d", index)
+	}
+
+	switch version := binary.BigEndian.Uint32(data[directory:]); version {
+	case 0x00010000, 0x74727565: // 1.0 and 'true'
+	case 0x4f54544f: // 'OTTO'
+		font.cff = true
+	default:
+		return nil, fmt.Errorf("unsupported font format %08x", version)
+	}
+
+	numTables := int(binary.BigEndian.Uint16(data[directory+4:]))
+	if len(data) < directory+12+numTables*16 {
+		return nil, fmt.Errorf("font table directory truncated")
+	}
+	for i := 0; i < numTables; i++ {
+		record := data[directory+12+i*16:]
+		tag := string(record[0:4])
+		offset := binary.BigEndian.Uint32(record[8:])
+		length := binary.BigEndian.Uint32(record[12:])
+		if uint64(offset)+uint64(length) > uint64(len(data)) {
+			return nil, fmt.Errorf("font table %q out of bounds", tag)
+		}
+		font.tables[tag] = data[offset : offset+length]
+	}
+
+	for _, tag := range []string{"head", "hhea", "hmtx", "maxp", "cmap"} {
+		if _, ok := font.tables[tag]; !ok {
+			return nil, fmt.Errorf("font is missing the %q table", tag)
+		}
+	}
+	outlines := []string{"loca", "glyf"}
+	if font.cff {
+		outlines = []string{"CFF "}
+	}
+	for _, tag := range outlines {
+		if _, ok := font.tables[tag]; !ok {
+			return nil, fmt.Errorf("font is missing the %q table", tag)
+		}
+	}
+
+	head := font.tables["head"]
+	if len(head) < 54 {
+		return nil, fmt.Errorf("font head table truncated")
+	}
+	font.unitsPerEm = binary.BigEndian.Uint16(head[18:])
+	if font.unitsPerEm == 0 {
+		return nil, fmt.Errorf("font has invalid units per em")
+	}
+	for i := range font.bbox {
+		font.bbox[i] = int16(binary.BigEndian.Uint16(head[36+i*2:]))
+	}
+	font.longLoca = binary.BigEndian.Uint16(head[50:]) == 1
+
+	maxp := font.tables["maxp"]
+	if len(maxp) < 6 {
+		return nil, fmt.Errorf("font maxp table truncated")
+	}
+	font.numGlyphs = binary.BigEndian.Uint16(maxp[4:])
+
+	hhea := font.tables["hhea"]
+	if len(hhea) < 36 {
+		return nil, fmt.Errorf("font hhea table truncated")
+	}
+	font.ascent = int16(binary.BigEndian.Uint16(hhea[4:]))
+	font.descent = int16(binary.BigEndian.Uint16(hhea[6:]))
+	font.capHeight = font.ascent
+
+	numberOfHMetrics := int(binary.BigEndian.Uint16(hhea[34:]))
+	hmtx := font.tables["hmtx"]
+	if numberOfHMetrics == 0 || len(hmtx) < numberOfHMetrics*4 {
+		return nil, fmt.Errorf("font hmtx table truncated")
+	}
+	font.advances = make([]uint16, font.numGlyphs)
+	for i := range font.advances {
+		metric := i
+		if metric >= numberOfHMetrics {
+			metric = numberOfHMetrics - 1
+		}
+		font.advances[i] = binary.BigEndian.Uint16(hmtx[metric*4:])
+	}
+
+	if os2 := font.tables["OS/2"]; len(os2) >= 10 {
+		// fsType bit 1: Restricted License embedding, the font must not be
+		// embedded without permission of the legal owner.
+		if fsType := binary.BigEndian.Uint16(os2[8:]); fsType&0x000f == 0x0002 {
+			return nil, fmt.Errorf("font license does not allow embedding")
+		}
+		if len(os2) >= 90 && binary.BigEndian.Uint16(os2) >= 2 {
+			font.capHeight = int16(binary.BigEndian.Uint16(os2[88:]))
+		}
+	}
+
+	if post := font.tables["post"]; len(post) >= 8 {
+		font.italicAngle = float64(int32(binary.BigEndian.Uint32(post[4:]))) / 65536
+	}
+
+	var err error
+	font.cmap, err = parseCmap(font.tables["cmap"])
+	if err != nil {
+		return nil, err
+	}
+
+	if font.cff {
+		font.cids, err = parseCFFCharset(font.tables["CFF "], int(font.numGlyphs))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	font.postScriptName = sanitizeFontName(parseFontName(font.tables["name"]))
+
+	if collection {
+		font.data = writeFontFile(font.tables)
+	}
+
+	return font, nil
+}
+
+// parseCmap parses the Unicode character to glyph mapping of the font, it
+// supports the segment mapping (4) and segmented coverage (12) formats.
+func parseCmap(cmap []byte) (map[rune]uint16, error) {
+	if len(cmap) < 4 {
+		return nil, fmt.Errorf("font cmap table truncated")
+	}
+
+	// Prefer the full Unicode repertoire over the BMP only subtables.
+	var best []byte
+	bestScore := 0
+	numTables := int(binary.BigEndian.Uint16(cmap[2:]))
+	for i := 0; i < numTables && 4+i*8+8 <= len(cmap); i++ {
+		record := cmap[4+i*8:]
+		platform := binary.BigEndian.Uint16(record)
+		encoding := binary.BigEndian.Uint16(record[2:])
+		offset := binary.BigEndian.Uint32(record[4:])
+		if uint64(offset)+4 > uint64(len(cmap)) {
+			continue
+		}
+		subtable := cmap[offset:]
+		format := binary.BigEndian.Uint16(subtable)
+
+		score := 0
+		switch {
+		case format == 12 && (platform == 0 || (platform == 3 && encoding == 10)):
+			score = 2
+		case format == 4 && (platform == 0 || (platform == 3 && encoding == 1)):
+			score = 1
+		}
+		if score > bestScore {
+			best, bestScore = subtable, score
+		}
+	}
+
+	mapping := make(map[rune]uint16)
+	switch bestScore {
+	case 2:
+		if len(best) < 16 {
+			return nil, fmt.Errorf("font cmap subtable truncated")
+		}
+		numGroups := int(binary.BigEndian.Uint32(best[12:]))
+		if len(best) < 16+numGroups*12 {
+			return nil, fmt.Errorf("font cmap subtable truncated")
+		}
+		for i := 0; i < numGroups; i++ {
+			group := best[16+i*12:]
+			start := binary.BigEndian.Uint32(group)
+			end := binary.BigEndian.Uint32(group[4:])
+			glyph := binary.BigEndian.Uint32(group[8:])
+			for c := start; c <= end && c <= 0x10ffff; c++ {
+				mapping[rune(c)] = uint16(glyph + c - start)
+			}
+		}
+	case 1:
+		if len(best) < 14 {
+			return nil, fmt.Errorf("font cmap subtable truncated")
+		}
+		segCount := int(binary.BigEndian.Uint16(best[6:]) / 2)
+		if len(best) < 16+segCount*8 {
+			return nil, fmt.Errorf("font cmap subtable truncated")
+		}
+		endCodes := best[14:]
+		startCodes := best[16+segCount*2:]
+		idDeltas := best[16+segCount*4:]
+		idRangeOffsets := best[16+segCount*6:]
+		for i := 0; i < segCount; i++ {
+			end := binary.BigEndian.Uint16(endCodes[i*2:])
+			start := binary.BigEndian.Uint16(startCodes[i*2:])
+			delta := binary.BigEndian.Uint16(idDeltas[i*2:])
+			rangeOffset := int(binary.BigEndian.Uint16(idRangeOffsets[i*2:]))
+			for c := uint32(start); c <= uint32(end) && c != 0xffff; c++ {
+				var glyph uint16
+				if rangeOffset == 0 {
+					glyph = uint16(c) + delta
+				} else {
+					// The offset is relative to the position of the range offset itself.
+					index := 16 + segCount*6 + i*2 + rangeOffset + int(c-uint32(start))*2
+					if index+2 > len(best) {
+						continue
+					}
+					glyph = binary.BigEndian.Uint16(best[index:])
+					if glyph != 0 {
+						glyph += delta
+					}
+				}
+				if glyph != 0 {
+					mapping[rune(c)] = glyph
+				}
+			}
+		}
+	default:
+		return nil, fmt.Errorf("font has no Unicode cmap")
+	}
+
+	return mapping, nil
+}
+
+// parseFontName returns the PostScript name (name ID 6) of the font.
+func parseFontName(name []byte) string {
+	if len(name) < 6 {
+		return ""
+	}
+
+	count := int(binary.BigEndian.Uint16(name[2:]))
+	storage := int(binary.BigEndian.Uint16(name[4:]))
+	for i := 0; i < count && 6+i*12+12 <= len(name); i++ {
+		record := name[6+i*12:]
+		platform := binary.BigEndian.Uint16(record)
+		nameID := binary.BigEndian.Uint16(record[6:])
+		length := int(binary.BigEndian.Uint16(record[8:]))
+		offset := int(binary.BigEndian.Uint16(record[10:]))
+		if nameID != 6 || storage+offset+length > len(name) {
+			continue
+		}
+
+		value := name[storage+offset : storage+offset+length]
+		switch platform {
+		case 0, 3: // UTF-16BE
+			units := make([]uint16, len(value)/2)
+			for j := range units {
+				units[j] = binary.BigEndian.Uint16(value[j*2:])
+			}
+			return string(utf16.Decode(units))
+		case 1: // Macintosh Roman, the PostScript name is ASCII
+			return string(value)
+		}
+	}
+
+	return ""
+}
+
+// sanitizeFontName makes sure the name can be used as PDF name object.
+func sanitizeFontName(name string) string {
+	var b strings.Builder
+	for _, c := range name {
+		if c > 32 && c < 127 && !strings.ContainsRune("[](){}<>/%#", c) {
+			b.WriteRune(c)
+		}
+	}
+	if b.Len() == 0 {
+		return "EmbeddedFont"
+	}
+	return b.String()
+}
+
+// glyphs returns the glyph ids for the text, characters that are not in the
+// font are mapped to the missing glyph (0).
+func (font *trueTypeFont) glyphs(text string) []uint16 {
+	glyphs := make([]uint16, 0, len(text))
+	for _, c := range text {
+		glyphs = append(glyphs, font.cmap[c])
+	}
+	return glyphs
+}
+
+// missing returns the characters of the text that are not in the font.
+func (font *trueTypeFont) missing(text string) string {
+	var missing []rune
+	for _, c := range text {
+		if _, ok := font.cmap[c]; !ok && !strings.ContainsRune(string(missing), c) {
+			missing = append(missing, c)
+		}
+	}
+	return string(missing)
+}
+
+// cid returns the CID of a glyph, the code of the glyph with the Identity-H
+// encoding.
+func (font *trueTypeFont) cid(glyph uint16) uint16 {
+	if font.cids == nil || int(glyph) >= len(font.cids) {
+		return glyph
+	}
+	return font.cids[glyph]
+}
+
+// advance returns the advance width of a glyph in text space units (1/1000 em).
+func (font *trueTypeFont) advance(glyph uint16) float64 {
+	if int(glyph) >= len(font.advances) {
+		return 0
+	}
+	return font.scale(int(font.advances[glyph]))
+}
+
+// textWidth returns the width of the text for a font size of 1.
+func (font *trueTypeFont) textWidth(text string) float64 {
+	var width float64
+	for _, glyph := range font.glyphs(text) {
+		width += font.advance(glyph)
+	}
+	return width / 1000
+}
+
+// scale converts font units to text space units (1/1000 em).
+func (font *trueTypeFont) scale(v int) float64 {
+	return float64(v) * 1000 / float64(font.unitsPerEm)
+}
+
+// subset returns a copy of the font that only contains the outlines of the
+// given glyphs. Glyph ids are kept, so the subset can be used with an identity
+// CIDToGIDMap, or with the charset of an OpenType font with CFF outlines.
+func (font *trueTypeFont) subset(used map[uint16]bool) ([]byte, error) {
+	if font.cff {
+		return font.subsetCFF(used)
+	}
+
+	offsets, err := font.glyphOffsets()
+	if err != nil {
+		return nil, err
+	}
+	glyf := font.tables["glyf"]
+
+	// Glyph 0 (.notdef) is required, composite glyphs need their components.
+	keep := map[uint16]bool{0: true}
+	queue := make([]uint16, 0, len(used))
+	for glyph := range used {
+		queue = append(queue, glyph)
+	}
+	for len(queue) > 0 {
+		glyph := queue[0]
+		queue = queue[1:]
+		if keep[glyph] || int(glyph) >= int(font.numGlyphs) {
+			continue
+		}
+		keep[glyph] = true
+		queue = append(queue, compositeComponents(glyf[offsets[glyph]:offsets[glyph+1]])...)
+	}
+
+	var newGlyf bytes.Buffer
+	newLoca := make([]byte, (int(font.numGlyphs)+1)*4)
+	for glyph := 0; glyph < int(font.numGlyphs); glyph++ {
+		binary.BigEndian.PutUint32(newLoca[glyph*4:], uint32(newGlyf.Len()))
+		if keep[uint16(glyph)] {
+			newGlyf.Write(glyf[offsets[glyph]:offsets[glyph+1]])
+			for newGlyf.Len()%4 != 0 {
+				newGlyf.WriteByte(0)
+			}
+		}
+	}
+	binary.BigEndian.PutUint32(newLoca[int(font.numGlyphs)*4:], uint32(newGlyf.Len()))
+
+	// The new loca table always uses the long format.
+	head := append([]byte(nil), font.tables["head"]...)
+	binary.BigEndian.PutUint16(head[50:], 1)
+	binary.BigEndian.PutUint32(head[8:], 0) // checkSumAdjustment, set below
+
+	tables := map[string][]byte{
+		"head": head,
+		"loca": newLoca,
+		"glyf": newGlyf.Bytes(),
+	}
+	// The tables required by ISO 32000-1, 9.9 "Embedded font programs", and
+	// the cmap and OS/2 tables that some viewers rely on.
+	for _, tag := range []string{"hhea", "hmtx", "maxp", "cmap", "cvt ", "fpgm", "prep", "OS/2"} {
+		if table, ok := font.tables[tag]; ok {
+			tables[tag] = table
+		}
+	}
+
+	return writeFontFile(tables), nil
+}
+
+// subsetCFF returns a copy of the OpenType font with CFF outlines that only
+// contains the charstrings of the given glyphs.
+func (font *trueTypeFont) subsetCFF(used map[uint16]bool) ([]byte, error) {
+	cff, err := subsetCFF(font.tables["CFF "], used)
+	if err != nil {
+		return nil, err
+	}
+
+	head := append([]byte(nil), font.tables["head"]...)
+	binary.BigEndian.PutUint32(head[8:], 0) // checkSumAdjustment, set below
+
+	tables := map[string][]byte{
+		"head": head,
+		"CFF ": cff,
+	}
+	for _, tag := range []string{"hhea", "hmtx", "maxp", "cmap", "OS/2", "name", "post"} {
+		if table, ok := font.tables[tag]; ok {
+			tables[tag] = table
+		}
+	}
+
+	return writeFontFile(tables), nil
+}
+
+// glyphOffsets returns the offsets of the glyphs in the glyf table.
+func (font *trueTypeFont) glyphOffsets() ([]uint32, error) {
+	loca := font.tables["loca"]
+	glyfLength := uint32(len(font.tables["glyf"]))
+
+	offsets := make([]uint32, int(font.numGlyphs)+1)
+	for i := range offsets {
+		if font.longLoca {
+			if len(loca) < (i+1)*4 {
+				return nil, fmt.Errorf("font loca table truncated")
+			}
+			offsets[i] = binary.BigEndian.Uint32(loca[i*4:])
+		} else {
+			if len(loca) < (i+1)*2 {
+				return nil, fmt.Errorf("font loca table truncated")
+			}
+			offsets[i] = uint32(binary.BigEndian.Uint16(loca[i*2:])) * 2
+		}
+		if offsets[i] > glyfLength || (i > 0 && offsets[i] < offsets[i-1]) {
+			return nil, fmt.Errorf("font loca table is invalid")
+		}
+	}
+
+	return offsets, nil
+}
+
+// compositeComponents returns the glyph ids referenced by a composite glyph.
+func compositeComponents(glyph []byte) []uint16 {
+	if len(glyph) < 10 || int16(binary.BigEndian.Uint16(glyph)) >= 0 {
+		return nil
+	}
+
+	const (
+		argsAreWords    = 0x0001
+		haveScale       = 0x0008
+		moreComponents  = 0x0020
+		haveXYScale     = 0x0040
+		haveTwoByTwo    = 0x0080
+		componentHeader = 4
+	)
+
+	var components []uint16
+	for offset := 10; offset+componentHeader <= len(glyph); {
+		flags := binary.BigEndian.Uint16(glyph[offset:])
+		components = append(components, binary.BigEndian.Uint16(glyph[offset+2:]))
+		offset += componentHeader
+
+		if flags&argsAreWords != 0 {
+			offset += 4
+		} else {
+			offset += 2
+		}
+		switch {
+		case flags&haveScale != 0:
+			offset += 2
+		case flags&haveXYScale != 0:
+			offset += 4
+		case flags&haveTwoByTwo != 0:
+			offset += 8
+		}
+
+		if flags&moreComponents == 0 {
+			break
+		}
+	}
+
+	return components
+}
+
+// writeFontFile serializes the tables as a TrueType font file, or as an
+// OpenType font file if the tables have CFF outlines.
+func writeFontFile(tables map[string][]byte) []byte {
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	numTables := len(tags)
+	entrySelector := 0
+	for 1<<(entrySelector+1) <= numTables {
+		entrySelector++
+	}
+	searchRange := (1 << entrySelector) * 16
+
+	var buffer bytes.Buffer
+	header := make([]byte, 12+numTables*16)
+	binary.BigEndian.PutUint32(header, 0x00010000)
+	if _, ok := tables["CFF "]; ok {
+		binary.BigEndian.PutUint32(header, 0x4f54544f) // 'OTTO'
+	}
+	binary.BigEndian.PutUint16(header[4:], uint16(numTables))
+	binary.BigEndian.PutUint16(header[6:], uint16(searchRange))
+	binary.BigEndian.PutUint16(header[8:], uint16(entrySelector))
+	binary.BigEndian.PutUint16(header[10:], uint16(numTables*16-searchRange))
+
+	offset := len(header)
+	var body bytes.Buffer
+	headOffset := 0
+	for i, tag := range tags {
+		table := tables[tag]
+		if tag == "head" {
+			headOffset = offset
+		}
+
+		record := header[12+i*16:]
+		copy(record, tag)
+		binary.BigEndian.PutUint32(record[4:], fontChecksum(table))
+		binary.BigEndian.PutUint32(record[8:], uint32(offset))
+		binary.BigEndian.PutUint32(record[12:], uint32(len(table)))
+
+		body.Write(table)
+		for body.Len()%4 != 0 {
+			body.WriteByte(0)
+		}
+		offset = len(header) + body.Len()
+	}
+
+	buffer.Write(header)
+	buffer.Write(body.Bytes())
+	font := buffer.Bytes()
+
+	// The checksum of the complete font must be 0xB1B0AFBA.
+	if headOffset != 0 {
+		binary.BigEndian.PutUint32(font[headOffset+8:], 0xB1B0AFBA-fontChecksum(font))
+	}
+
+	return font
+}
+
+func fontChecksum(data []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(data); i += 4 {
+		var word [4]byte
+		copy(word[:], data[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
+
+// embeddedFont keeps track of the glyphs that are used with an embedded font,
+// so only those need to be included in the document.
+type embeddedFont struct {
+	font *trueTypeFont
+	used map[uint16]rune
+}
+
+func newEmbeddedFont(data []byte, index int) (*embeddedFont, error) {
+	font, err := parseCollectionFont(data, index)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse font: %w", err)
+	}
+
+	return &embeddedFont{
+		font: font,
+		used: make(map[uint16]rune),
+	}, nil
+}
+
+// encode returns the text as PDF hex string of the CIDs of its glyphs, for
+// use with the Identity-H encoding.
+func (e *embeddedFont) encode(text string) string {
+	var b strings.Builder
+	b.WriteString("<")
+	for _, c := range text {
+		glyph := e.font.cmap[c]
+		if _, ok := e.used[glyph]; !ok && glyph != 0 {
+			e.used[glyph] = c
+		}
+		fmt.Fprintf(&b, "%04X", e.font.cid(glyph))
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+// subsetTag returns the six letter tag that identifies the subset, see ISO
+// 32000-1, 9.6.4 "Font subsets".
+func (e *embeddedFont) subsetTag() string {
+	glyphs := e.sortedGlyphs()
+
+	h := sha1.New()
+	for _, glyph := range glyphs {
+		_ = binary.Write(h, binary.BigEndian, glyph)
+	}
+	sum := h.Sum(nil)
+
+	tag := make([]byte, 6)
+	for i := range tag {
+		tag[i] = 'A' + sum[i]%26
+	}
+	return string(tag)
+}
+
+// sortedGlyphs returns the used glyphs in the order of their CIDs.
+func (e *embeddedFont) sortedGlyphs() []uint16 {
+	glyphs := make([]uint16, 0, len(e.used))
+	for glyph := range e.used {
+		glyphs = append(glyphs, glyph)
+	}
+	sort.Slice(glyphs, func(i, j int) bool { return e.font.cid(glyphs[i]) < e.font.cid(glyphs[j]) })
+	return glyphs
+}
+
+// addFontObjects writes the Type0 font with its descendant CIDFont, font
+// descriptor, font file and ToUnicode CMap, and returns the object id of the
+// Type0 font. It must be called after all text has been encoded.
+func (context *SignContext) addFontObjects(e *embeddedFont) (uint32, error) {
+	font := e.font
+
+	used := make(map[uint16]bool, len(e.used))
+	for glyph := range e.used {
+		used[glyph] = true
+	}
+	fontFile, err := font.subset(used)
+	if err != nil {
+		return 0, fmt.Errorf("failed to subset font: %w", err)
+	}
+
+	baseFont := e.subsetTag() + "+" + font.postScriptName
+
+	// Font file stream
+	compressed := compressData(fontFile)
+
+	var fontFileBuffer bytes.Buffer
+	fontFileBuffer.WriteString("<<\n")
+	if font.cff {
+		fontFileBuffer.WriteString("  /Subtype /OpenType\n")
+	}
+	fontFileBuffer.WriteString("  /Filter /FlateDecode\n")
+	if !font.cff {
+		fmt.Fprintf(&fontFileBuffer, "  /Length1 %d\n", len(fontFile))
+	}
+	fmt.Fprintf(&fontFileBuffer, "  /Length %d\n", len(compressed))
+	fontFileBuffer.WriteString(">>\n")
+	fontFileBuffer.WriteString("stream\n")
+	fontFileBuffer.Write(compressed)
+	fontFileBuffer.WriteString("\nendstream\n")
+
+	fontFileId, err := context.addObject(fontFileBuffer.Bytes())
+	if err != nil {
+		return 0, fmt.Errorf("failed to add font file object: %w", err)
+	}
+
+	// Font descriptor (Table 120)
+	var descriptor bytes.Buffer
+	descriptor.WriteString("<<\n")
+	descriptor.WriteString("  /Type /FontDescriptor\n")
+	descriptor.WriteString("  /FontName /" + baseFont + "\n")
+	descriptor.WriteString("  /Flags 4\n") // Symbolic, the glyphs are selected by CID
+	fmt.Fprintf(&descriptor, "  /FontBBox [%.0f %.0f %.0f %.0f]\n",
+		font.scale(int(font.bbox[0])), font.scale(int(font.bbox[1])),
+		font.scale(int(font.bbox[2])), font.scale(int(font.bbox[3])))
+	fmt.Fprintf(&descriptor, "  /ItalicAngle %.2f\n", font.italicAngle)
+	fmt.Fprintf(&descriptor, "  /Ascent %.0f\n", font.scale(int(font.ascent)))
+	fmt.Fprintf(&descriptor, "  /Descent %.0f\n", font.scale(int(font.descent)))
+	fmt.Fprintf(&descriptor, "  /CapHeight %.0f\n", font.scale(int(font.capHeight)))
+	descriptor.WriteString("  /StemV 80\n")
+	if font.cff {
+		fmt.Fprintf(&descriptor, "  /FontFile3 %d 0 R\n", fontFileId)
+	} else {
+		fmt.Fprintf(&descriptor, "  /FontFile2 %d 0 R\n", fontFileId)
+	}
+	descriptor.WriteString(">>\n")
+
+	descriptorId, err := context.addObject(descriptor.Bytes())
+	if err != nil {
+		return 0, fmt.Errorf("failed to add font descriptor object: %w", err)
+	}
+
+	// Descendant CIDFont (Table 117), CIDs are the glyph ids of the font,
+	// or the CIDs of the charset of a CID-keyed CFF font.
+	var cidFont bytes.Buffer
+	cidFont.WriteString("<<\n")
+	cidFont.WriteString("  /Type /Font\n")
+	if font.cff {
+		cidFont.WriteString("  /Subtype /CIDFontType0\n")
+	} else {
+		cidFont.WriteString("  /Subtype /CIDFontType2\n")
+	}
+	cidFont.WriteString("  /BaseFont /" + baseFont + "\n")
+	cidFont.WriteString("  /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >>\n")
+	fmt.Fprintf(&cidFont, "  /FontDescriptor %d 0 R\n", descriptorId)
+	fmt.Fprintf(&cidFont, "  /DW %.0f\n", font.advance(0))
+	cidFont.WriteString("  /W [")
+	for _, glyph := range e.sortedGlyphs() {
+		fmt.Fprintf(&cidFont, " %d [%.0f]", font.cid(glyph), font.advance(glyph))
+	}
+	cidFont.WriteString(" ]\n")
+	if !font.cff {
+		cidFont.WriteString("  /CIDToGIDMap /Identity\n")
+	}
+	cidFont.WriteString(">>\n")
+
+	cidFontId, err := context.addObject(cidFont.Bytes())
+	if err != nil {
+		return 0, fmt.Errorf("failed to add CIDFont object: %w", err)
+	}
+
+	// ToUnicode CMap, so the text can be extracted and searched.
+	cmap := e.toUnicodeCMap()
+	compressedCMap := compressData(cmap)
+
+	var toUnicode bytes.Buffer
+	toUnicode.WriteString("<<\n")
+	toUnicode.WriteString("  /Filter /FlateDecode\n")
+	fmt.Fprintf(&toUnicode, "  /Length %d\n", len(compressedCMap))
+	toUnicode.WriteString(">>\n")
+	toUnicode.WriteString("stream\n")
+	toUnicode.Write(compressedCMap)
+	toUnicode.WriteString("\nendstream\n")
+
+	toUnicodeId, err := context.addObject(toUnicode.Bytes())
+	if err != nil {
+		return 0, fmt.Errorf("failed to add ToUnicode object: %w", err)
+	}
+
+	// Type0 font (Table 119)
+	var type0 bytes.Buffer
+	type0.WriteString("<<\n")
+	type0.WriteString("  /Type /Font\n")
+	type0.WriteString("  /Subtype /Type0\n")
+	type0.WriteString("  /BaseFont /" + baseFont + "\n")
+	type0.WriteString("  /Encoding /Identity-H\n")
+	fmt.Fprintf(&type0, "  /DescendantFonts [%d 0 R]\n", cidFontId)
+	fmt.Fprintf(&type0, "  /ToUnicode %d 0 R\n", toUnicodeId)
+	type0.WriteString(">>\n")
+
+	return context.addObject(type0.Bytes())
+}
+
+// toUnicodeCMap creates the CMap that maps the CIDs of the used glyphs to
+// Unicode.
+func (e *embeddedFont) toUnicodeCMap() []byte {
+	var cmap bytes.Buffer
+
+	cmap.WriteString("/CIDInit /ProcSet findresource begin\n")
+	cmap.WriteString("12 dict begin\n")
+	cmap.WriteString("begincmap\n")
+	cmap.WriteString("/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n")
+	cmap.WriteString("/CMapName /Adobe-Identity-UCS def\n")
+	cmap.WriteString("/CMapType 2 def\n")
+	cmap.WriteString("1 begincodespacerange\n")
+	cmap.WriteString("<0000> <FFFF>\n")
+	cmap.WriteString("endcodespacerange\n")
+
+	glyphs := e.sortedGlyphs()
+	// At most 100 entries are allowed per bfchar block.
+	for start := 0; start < len(glyphs); start += 100 {
+		end := start + 100
+		if end > len(glyphs) {
+			end = len(glyphs)
+		}
+
+		fmt.Fprintf(&cmap, "%d beginbfchar\n", end-start)
+		for _, glyph := range glyphs[start:end] {
+			fmt.Fprintf(&cmap, "<%04X> <", e.font.cid(glyph))
+			for _, unit := range utf16.Encode([]rune{e.used[glyph]}) {
+				fmt.Fprintf(&cmap, "%04X", unit)
+			}
+			cmap.WriteString(">\n")
+		}
+		cmap.WriteString("endbfchar\n")
+	}
+
+	cmap.WriteString("endcmap\n")
+	cmap.WriteString("CMapName currentdict /CMap defineresource pop\n")
+	cmap.WriteString("end\n")
+	cmap.WriteString("end\n")
+
+	return cmap.Bytes()
+}
@@ -0,0 +1,616 @@
+package sign
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// CFF Top DICT operators, see Adobe Technical Note #5176, "The Compact Font
+// Format Specification", Table 9. Two-byte operators are 1200 plus their
+// second byte.
+const (
+	cffCharset     = 15
+	cffEncoding    = 16
+	cffCharStrings = 17
+	cffPrivate     = 18
+	cffSubrs       = 19
+	cffROS         = 1230
+	cffFDArray     = 1236
+	cffFDSelect    = 1237
+)
+
+// cffEndChar is a Type 2 charstring of only the endchar operator, it replaces
+// the charstrings of the glyphs that are not in a subset.
+var cffEndChar = []byte{14}
+
+// parseCFFCharset returns the CIDs of the numGlyphs glyphs of the first font
+// of the CFF table, if it is a CID-keyed font. The charset of a CID-keyed
+// font maps the glyph ids to CIDs, PDF processors select the glyphs of such a
+// font by CID. It returns nil for other fonts, whose glyphs are selected by
+// glyph id.
+func parseCFFCharset(cff []byte, numGlyphs int) ([]uint16, error) {
+	if len(cff) < 4 {
+		return nil, fmt.Errorf("font CFF table truncated")
+	}
+
+	// The header is followed by the Name INDEX and the Top DICT INDEX.
+	_, next, err := readCFFIndex(cff, int(cff[2]))
+	if err != nil {
+		return nil, err
+	}
+	topDicts, _, err := readCFFIndex(cff, next)
+	if err != nil {
+		return nil, err
+	}
+	if len(topDicts) == 0 {
+		return nil, fmt.Errorf("font CFF table has no Top DICT")
+	}
+	top, err := parseCFFDict(topDicts[0])
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := top[cffROS]; !ok {
+		return nil, nil
+	}
+
+	cids := make([]uint16, numGlyphs)
+	charset := top[cffCharset]
+	if len(charset) == 0 || charset[0] <= 2 {
+		// The predefined charsets do not apply to CID-keyed fonts, the
+		// glyphs are taken to have their glyph ids as CIDs.
+		for glyph := range cids {
+			cids[glyph] = uint16(glyph)
+		}
+		return cids, nil
+	}
+
+	pos := charset[0]
+	if pos >= len(cff) {
+		return nil, fmt.Errorf("font CFF charset out of bounds")
+	}
+	format := cff[pos]
+	pos++
+	// The .notdef glyph 0 is not in the charset, it has CID 0.
+	for glyph := 1; glyph < numGlyphs; {
+		switch format {
+		case 0:
+			if pos+2 > len(cff) {
+				return nil, fmt.Errorf("font CFF charset truncated")
+			}
+			cids[glyph] = binary.BigEndian.Uint16(cff[pos:])
+			glyph++
+			pos += 2
+		case 1, 2:
+			size := 3
+			if format == 2 {
+				size = 4
+			}
+			if pos+size > len(cff) {
+				return nil, fmt.Errorf("font CFF charset truncated")
+			}
+			first := int(binary.BigEndian.Uint16(cff[pos:]))
+			left := int(cff[pos+2])
+			if format == 2 {
+				left = int(binary.BigEndian.Uint16(cff[pos+2:]))
+			}
+			for i := 0; i <= left && glyph < numGlyphs; i++ {
+				cids[glyph] = uint16(first + i)
+				glyph++
+			}
+			pos += size
+		default:
+			return nil, fmt.Errorf("unsupported font CFF charset format %d", format)
+		}
+	}
+	return cids, nil
+}
+
+// readCFFIndex returns the objects of the INDEX at pos of the CFF table and
+// the position after it.
+func readCFFIndex(cff []byte, pos int) ([][]byte, int, error) {
+	if pos+2 > len(cff) {
+		return nil, 0, fmt.Errorf("font CFF INDEX truncated")
+	}
+	count := int(binary.BigEndian.Uint16(cff[pos:]))
+	if count == 0 {
+		return nil, pos + 2, nil
+	}
+	if pos+3 > len(cff) {
+		return nil, 0, fmt.Errorf("font CFF INDEX truncated")
+	}
+	offSize := int(cff[pos+2])
+	if offSize < 1 || offSize > 4 {
+		return nil, 0, fmt.Errorf("invalid font CFF INDEX offset size %d", offSize)
+	}
+	offsets := pos + 3
+	// The data starts at the byte before the first object, offsets are 1 for
+	// the first object.
+	data := offsets + (count+1)*offSize - 1
+	if data+1 > len(cff) {
+		return nil, 0, fmt.Errorf("font CFF INDEX truncated")
+	}
+	offset := func(i int) int {
+		var v int
+		for _, b := range cff[offsets+i*offSize : offsets+(i+1)*offSize] {
+			v = v<<8 | int(b)
+		}
+		return data + v
+	}
+
+	objects := make([][]byte, count)
+	for i := range objects {
+		start, end := offset(i), offset(i+1)
+		if start > end || end > len(cff) {
+			return nil, 0, fmt.Errorf("font CFF INDEX object out of bounds")
+		}
+		objects[i] = cff[start:end]
+	}
+	return objects, offset(count), nil
+}
+
+// cffDictEntry is an operator of a CFF DICT with its operands, the integer
+// values and the operands as they are encoded.
+type cffDictEntry struct {
+	operator int
+	operands []int
+	raw      []byte
+}
+
+// parseCFFDict returns the integer operands of the operators of a CFF DICT,
+// real operands are returned as 0.
+func parseCFFDict(dict []byte) (map[int][]int, error) {
+	entries, err := readCFFDict(dict)
+	if err != nil {
+		return nil, err
+	}
+	operators := make(map[int][]int, len(entries))
+	for _, entry := range entries {
+		operators[entry.operator] = entry.operands
+	}
+	return operators, nil
+}
+
+// readCFFDict returns the operators of a CFF DICT in the order they appear,
+// real operands are returned as 0.
+func readCFFDict(dict []byte) ([]cffDictEntry, error) {
+	var entries []cffDictEntry
+	var operands []int
+	start := 0
+	for pos := 0; pos < len(dict); {
+		b0 := int(dict[pos])
+		switch {
+		case b0 <= 21:
+			raw := dict[start:pos]
+			operator := b0
+			pos++
+			if b0 == 12 {
+				if pos >= len(dict) {
+					return nil, fmt.Errorf("font CFF DICT truncated")
+				}
+				operator = 1200 + int(dict[pos])
+				pos++
+			}
+			entries = append(entries, cffDictEntry{operator: operator, operands: operands, raw: raw})
+			operands = nil
+			start = pos
+		case b0 == 28 || b0 == 29:
+			size := 2
+			if b0 == 29 {
+				size = 4
+			}
+			if pos+1+size > len(dict) {
+				return nil, fmt.Errorf("font CFF DICT truncated")
+			}
+			if b0 == 28 {
+				operands = append(operands, int(int16(binary.BigEndian.Uint16(dict[pos+1:]))))
+			} else {
+				operands = append(operands, int(int32(binary.BigEndian.Uint32(dict[pos+1:]))))
+			}
+			pos += 1 + size
+		case b0 == 30:
+			// A real number of nibbles, terminated by the nibble 0xf.
+			for pos++; pos < len(dict) && dict[pos]&0x0f != 0x0f && dict[pos]&0xf0 != 0xf0; pos++ {
+			}
+			pos++
+			operands = append(operands, 0)
+		case b0 >= 32 && b0 <= 246:
+			operands = append(operands, b0-139)
+			pos++
+		case b0 >= 247 && b0 <= 254:
+			if pos+2 > len(dict) {
+				return nil, fmt.Errorf("font CFF DICT truncated")
+			}
+			b1 := int(dict[pos+1])
+			if b0 <= 250 {
+				operands = append(operands, (b0-247)*256+b1+108)
+			} else {
+				operands = append(operands, -(b0-251)*256-b1-108)
+			}
+			pos += 2
+		default:
+			return nil, fmt.Errorf("invalid font CFF DICT operand %d", b0)
+		}
+	}
+	return entries, nil
+}
+
+// writeCFFDict encodes the entries of a CFF DICT. The operands of the
+// operators in values are replaced by these values, written as 5 byte
+// integers so the size of the DICT does not depend on them.
+func writeCFFDict(entries []cffDictEntry, values map[int][]int) []byte {
+	var dict bytes.Buffer
+	for _, entry := range entries {
+		if operands, ok := values[entry.operator]; ok {
+			for _, v := range operands {
+				dict.Write([]byte{29, byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)})
+			}
+		} else {
+			dict.Write(entry.raw)
+		}
+		if entry.operator >= 1200 {
+			dict.Write([]byte{12, byte(entry.operator - 1200)})
+		} else {
+			dict.WriteByte(byte(entry.operator))
+		}
+	}
+	return dict.Bytes()
+}
+
+// writeCFFIndex encodes the objects as a CFF INDEX.
+func writeCFFIndex(objects [][]byte) []byte {
+	if len(objects) == 0 {
+		return []byte{0, 0}
+	}
+	size := 1
+	for _, object := range objects {
+		size += len(object)
+	}
+	offSize := 1
+	for size >= 1<<(8*offSize) {
+		offSize++
+	}
+
+	index := []byte{byte(len(objects) >> 8), byte(len(objects)), byte(offSize)}
+	offset := 1
+	writeOffset := func() {
+		for i := offSize - 1; i >= 0; i-- {
+			index = append(index, byte(offset>>(8*i)))
+		}
+	}
+	writeOffset()
+	for _, object := range objects {
+		offset += len(object)
+		writeOffset()
+	}
+	for _, object := range objects {
+		index = append(index, object...)
+	}
+	return index
+}
+
+// cffPrivateDict is a Private DICT with its local subroutines.
+type cffPrivateDict struct {
+	entries []cffDictEntry
+	subrs   []byte // The encoded Local Subr INDEX, nil if there is none
+}
+
+// readCFFPrivate reads the Private DICT of size bytes at offset, and the Local
+// Subr INDEX at the offset relative to it.
+func readCFFPrivate(cff []byte, size, offset int) (*cffPrivateDict, error) {
+	if size < 0 || offset < 0 || offset+size > len(cff) {
+		return nil, fmt.Errorf("font CFF Private DICT out of bounds")
+	}
+	entries, err := readCFFDict(cff[offset : offset+size])
+	if err != nil {
+		return nil, err
+	}
+	private := &cffPrivateDict{entries: entries}
+	for _, entry := range entries {
+		if entry.operator != cffSubrs || len(entry.operands) != 1 {
+			continue
+		}
+		start := offset + entry.operands[0]
+		if start < 0 {
+			return nil, fmt.Errorf("font CFF Local Subr INDEX out of bounds")
+		}
+		_, end, err := readCFFIndex(cff, start)
+		if err != nil {
+			return nil, err
+		}
+		private.subrs = cff[start:end]
+	}
+	return private, nil
+}
+
+// encode returns the Private DICT followed by its Local Subr INDEX, and the
+// size of the DICT.
+func (private *cffPrivateDict) encode() ([]byte, int) {
+	values := map[int][]int{}
+	if private.subrs != nil {
+		// The size of the DICT does not depend on the offset.
+		values[cffSubrs] = []int{0}
+		values[cffSubrs] = []int{len(writeCFFDict(private.entries, values))}
+	}
+	dict := writeCFFDict(private.entries, values)
+	return append(dict, private.subrs...), len(dict)
+}
+
+// subsetCFF returns a copy of the CFF table with the charstrings of the
+// glyphs that are not used replaced by an empty glyph. Glyph ids are kept, so
+// the charset, FDSelect and the metrics of the font still apply. The global
+// and local subroutines are kept as they are. The glyphs that the deprecated
+// seac form of endchar combines into an accented character are not kept for
+// it, they are only kept when they are used themselves.
+func subsetCFF(cff []byte, used map[uint16]bool) ([]byte, error) {
+	if len(cff) < 4 {
+		return nil, fmt.Errorf("font CFF table truncated")
+	}
+
+	nameStart := int(cff[2])
+	_, topStart, err := readCFFIndex(cff, nameStart)
+	if err != nil {
+		return nil, err
+	}
+	topDicts, stringStart, err := readCFFIndex(cff, topStart)
+	if err != nil {
+		return nil, err
+	}
+	if len(topDicts) != 1 {
+		return nil, fmt.Errorf("font CFF table with %d fonts is not supported", len(topDicts))
+	}
+	_, globalSubrStart, err := readCFFIndex(cff, stringStart)
+	if err != nil {
+		return nil, err
+	}
+	_, dataStart, err := readCFFIndex(cff, globalSubrStart)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := readCFFDict(topDicts[0])
+	if err != nil {
+		return nil, err
+	}
+	top := make(map[int][]int, len(entries))
+	for _, entry := range entries {
+		top[entry.operator] = entry.operands
+	}
+
+	offset := top[cffCharStrings]
+	if len(offset) != 1 {
+		return nil, fmt.Errorf("font CFF table has no CharStrings")
+	}
+	charStrings, _, err := readCFFIndex(cff, offset[0])
+	if err != nil {
+		return nil, err
+	}
+	numGlyphs := len(charStrings)
+
+	// The structures the Top DICT refers to by offset, they are written in
+	// this order after the Global Subr INDEX.
+	type section struct {
+		operator int
+		data     []byte
+	}
+	var sections []section
+	if offset := top[cffCharset]; len(offset) == 1 && offset[0] > 2 {
+		data, err := cffSection(cff, offset[0], numGlyphs, cffCharsetLength)
+		if err != nil {
+			return nil, err
+		}
+		sections = append(sections, section{cffCharset, data})
+	}
+	if offset := top[cffEncoding]; len(offset) == 1 && offset[0] > 1 {
+		data, err := cffSection(cff, offset[0], numGlyphs, cffEncodingLength)
+		if err != nil {
+			return nil, err
+		}
+		sections = append(sections, section{cffEncoding, data})
+	}
+	if offset := top[cffFDSelect]; len(offset) == 1 {
+		data, err := cffSection(cff, offset[0], numGlyphs, cffFDSelectLength)
+		if err != nil {
+			return nil, err
+		}
+		sections = append(sections, section{cffFDSelect, data})
+	}
+
+	subset := make([][]byte, numGlyphs)
+	for glyph, charString := range charStrings {
+		if glyph == 0 || used[uint16(glyph)] {
+			subset[glyph] = charString
+		} else {
+			subset[glyph] = cffEndChar
+		}
+	}
+	sections = append(sections, section{cffCharStrings, writeCFFIndex(subset)})
+
+	// The Private DICT of a name-keyed font, or the Font DICTs of the FDArray
+	// of a CID-keyed font that have a Private DICT each.
+	type privateDict struct {
+		font    int // The index of the Font DICT, -1 for the Top DICT
+		private *cffPrivateDict
+	}
+	var privates []privateDict
+	if private := top[cffPrivate]; len(private) == 2 {
+		p, err := readCFFPrivate(cff, private[0], private[1])
+		if err != nil {
+			return nil, err
+		}
+		privates = append(privates, privateDict{-1, p})
+	}
+	var fontDicts [][]cffDictEntry
+	var fdArray bool
+	if offset := top[cffFDArray]; len(offset) == 1 {
+		fonts, _, err := readCFFIndex(cff, offset[0])
+		if err != nil {
+			return nil, err
+		}
+		fdArray = true
+		for i, font := range fonts {
+			fontEntries, err := readCFFDict(font)
+			if err != nil {
+				return nil, err
+			}
+			fontDicts = append(fontDicts, fontEntries)
+			for _, entry := range fontEntries {
+				if entry.operator == cffPrivate && len(entry.operands) == 2 {
+					p, err := readCFFPrivate(cff, entry.operands[0], entry.operands[1])
+					if err != nil {
+						return nil, err
+					}
+					privates = append(privates, privateDict{i, p})
+				}
+			}
+		}
+	}
+
+	// The offsets are written as 5 byte integers, so the sizes of the DICTs
+	// are known before the offsets are, the placeholders are replaced below.
+	values := map[int][]int{}
+	for _, section := range sections {
+		values[section.operator] = []int{0}
+	}
+	if fdArray {
+		values[cffFDArray] = []int{0}
+	}
+	fontValues := make([]map[int][]int, len(fontDicts))
+	for i := range fontValues {
+		fontValues[i] = map[int][]int{}
+	}
+	for _, p := range privates {
+		if p.font < 0 {
+			values[cffPrivate] = []int{0, 0}
+		} else {
+			fontValues[p.font][cffPrivate] = []int{0, 0}
+		}
+	}
+	writeFDArray := func() []byte {
+		fonts := make([][]byte, len(fontDicts))
+		for i, font := range fontDicts {
+			fonts[i] = writeCFFDict(font, fontValues[i])
+		}
+		return writeCFFIndex(fonts)
+	}
+
+	pos := topStart + len(writeCFFIndex([][]byte{writeCFFDict(entries, values)})) + dataStart - stringStart
+	for _, section := range sections {
+		values[section.operator] = []int{pos}
+		pos += len(section.data)
+	}
+	if fdArray {
+		values[cffFDArray] = []int{pos}
+		pos += len(writeFDArray())
+	}
+	privateData := make([][]byte, len(privates))
+	for i, p := range privates {
+		data, size := p.private.encode()
+		privateData[i] = data
+		if p.font < 0 {
+			values[cffPrivate] = []int{size, pos}
+		} else {
+			fontValues[p.font][cffPrivate] = []int{size, pos}
+		}
+		pos += len(data)
+	}
+
+	var buffer bytes.Buffer
+	buffer.Write(cff[:topStart])
+	buffer.Write(writeCFFIndex([][]byte{writeCFFDict(entries, values)}))
+	buffer.Write(cff[stringStart:dataStart])
+	for _, section := range sections {
+		buffer.Write(section.data)
+	}
+	if fdArray {
+		buffer.Write(writeFDArray())
+	}
+	for _, data := range privateData {
+		buffer.Write(data)
+	}
+	return buffer.Bytes(), nil
+}
+
+// cffSection returns the structure at pos of the CFF table, its length is
+// returned by the length function for a font of numGlyphs glyphs.
+func cffSection(cff []byte, pos, numGlyphs int, length func(cff []byte, pos, numGlyphs int) (int, error)) ([]byte, error) {
+	if pos < 0 || pos >= len(cff) {
+		return nil, fmt.Errorf("font CFF table offset %d out of bounds", pos)
+	}
+	n, err := length(cff, pos, numGlyphs)
+	if err != nil {
+		return nil, err
+	}
+	if pos+n > len(cff) {
+		return nil, fmt.Errorf("font CFF table truncated")
+	}
+	return cff[pos : pos+n], nil
+}
+
+// cffCharsetLength returns the length of the charset at pos.
+func cffCharsetLength(cff []byte, pos, numGlyphs int) (int, error) {
+	switch format := cff[pos]; format {
+	case 0:
+		return 1 + 2*max(numGlyphs-1, 0), nil
+	case 1, 2:
+		size := 3
+		if format == 2 {
+			size = 4
+		}
+		n := 1
+		// The .notdef glyph 0 is not in the charset.
+		for glyph := 1; glyph < numGlyphs; n += size {
+			if pos+n+size > len(cff) {
+				return 0, fmt.Errorf("font CFF charset truncated")
+			}
+			left := int(cff[pos+n+2])
+			if format == 2 {
+				left = int(binary.BigEndian.Uint16(cff[pos+n+2:]))
+			}
+			glyph += left + 1
+		}
+		return n, nil
+	default:
+		return 0, fmt.Errorf("unsupported font CFF charset format %d", format)
+	}
+}
+
+// cffEncodingLength returns the length of the encoding at pos, with its
+// supplements.
+func cffEncodingLength(cff []byte, pos, _ int) (int, error) {
+	if pos+2 > len(cff) {
+		return 0, fmt.Errorf("font CFF encoding truncated")
+	}
+	format := cff[pos]
+	var n int
+	switch format & 0x7f {
+	case 0:
+		n = 2 + int(cff[pos+1])
+	case 1:
+		n = 2 + 2*int(cff[pos+1])
+	default:
+		return 0, fmt.Errorf("unsupported font CFF encoding format %d", format&0x7f)
+	}
+	if format&0x80 != 0 {
+		if pos+n >= len(cff) {
+			return 0, fmt.Errorf("font CFF encoding truncated")
+		}
+		n += 1 + 3*int(cff[pos+n])
+	}
+	return n, nil
+}
+
+// cffFDSelectLength returns the length of the FDSelect at pos.
+func cffFDSelectLength(cff []byte, pos, numGlyphs int) (int, error) {
+	switch format := cff[pos]; format {
+	case 0:
+		return 1 + numGlyphs, nil
+	case 3:
+		if pos+3 > len(cff) {
+			return 0, fmt.Errorf("font CFF FDSelect truncated")
+		}
+		return 1 + 2 + 3*int(binary.BigEndian.Uint16(cff[pos+1:])) + 2, nil
+	default:
+		return 0, fmt.Errorf("unsupported font CFF FDSelect format %d", format)
+	}
+}
@@ -0,0 +1,475 @@
+package sign
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdfsign/verify"
+	"github.com/mattetti/filebuffer"
+)
+
+// testCFF builds a CFF table of a font with the operators dict in its Top
+// DICT, followed by the charset, the CharStrings of 5 glyphs, each a width of
+// its glyph id and endchar, and a Private DICT with a Local Subr INDEX. The
+// Private DICT of a CID-keyed font, with the ROS operator in dict, is that of
+// the only Font DICT of its FDArray.
+func testCFF(dict []byte, charset []byte) []byte {
+	index := func(objects ...[]byte) []byte {
+		b := []byte{0, byte(len(objects)), 1, 1}
+		offset := 1
+		for _, object := range objects {
+			offset += len(object)
+			b = append(b, byte(offset))
+		}
+		for _, object := range objects {
+			b = append(b, object...)
+		}
+		return b
+	}
+	// Offsets are 5 byte integers (29), so the sizes do not depend on them.
+	integer := func(v int) []byte {
+		return []byte{29, byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+	}
+	cidKeyed := bytes.Contains(dict, []byte{12, 30})
+
+	var charStrings [][]byte
+	for glyph := 0; glyph < 5; glyph++ {
+		charStrings = append(charStrings, []byte{byte(139 + glyph), 14})
+	}
+	charStringsIndex := index(charStrings...)
+	subrs := index([]byte{11})
+	private := append(integer(6), cffSubrs)
+	fdSelect := []byte{0, 0, 0, 0, 0, 0}
+
+	cff := []byte{1, 0, 4, 1}
+	cff = append(cff, index([]byte("TestCIDFont"))...)
+	topSize := 2 * 6
+	if cidKeyed {
+		topSize += 2 * 7
+	} else {
+		topSize += 11
+	}
+	// The Top DICT INDEX is followed by the empty String INDEX and the empty
+	// Global Subr INDEX.
+	pos := len(cff) + 5 + topSize + len(dict) + 4
+	top := append(integer(pos), cffCharset)
+	pos += len(charset)
+	top = append(append(top, integer(pos)...), cffCharStrings)
+	pos += len(charStringsIndex)
+	var fdArray []byte
+	if cidKeyed {
+		top = append(append(top, integer(pos)...), 12, cffFDSelect-1200)
+		pos += len(fdSelect)
+		fdArraySize := 5 + 11
+		top = append(append(top, integer(pos)...), 12, cffFDArray-1200)
+		pos += fdArraySize
+		fdArray = index(append(append(integer(len(private)), integer(pos)...), cffPrivate))
+	} else {
+		top = append(append(append(top, integer(len(private))...), integer(pos)...), cffPrivate)
+	}
+	top = append(top, dict...)
+	cff = append(cff, index(top)...)
+	cff = append(cff, 0, 0, 0, 0)
+	cff = append(cff, charset...)
+	cff = append(cff, charStringsIndex...)
+	if cidKeyed {
+		cff = append(cff, fdSelect...)
+		cff = append(cff, fdArray...)
+	}
+	cff = append(cff, private...)
+	return append(cff, subrs...)
+}
+
+// testCIDFont returns an OpenType font with CFF outlines of the tables of
+// testFont. With the ROS operator the font is CID-keyed, the glyphs 1 to 4
+// have the CIDs 1000 to 1003, and the glyphs 3 and 4 are mapped to 中 and 文.
+func testCIDFont(cidKeyed bool) []byte {
+	font, err := parseTrueTypeFont(testFont(0))
+	if err != nil {
+		panic(err)
+	}
+	tables := make(map[string][]byte)
+	for tag, table := range font.tables {
+		tables[tag] = table
+	}
+	delete(tables, "loca")
+	delete(tables, "glyf")
+
+	var dict []byte
+	if cidKeyed {
+		// /Registry (Adobe), /Ordering (Identity), /Supplement 0 ros
+		dict = []byte{0x8b, 0x8c, 0x8b, 12, 30}
+	}
+	tables["CFF "] = testCFF(dict, []byte{2, 0x03, 0xe8, 0, 3})
+
+	// Format 12 subtable for (3,10)
+	groups := [][3]uint32{{'A', 'A', 1}, {0x416, 0x416, 3}, {0x4e2d, 0x4e2d, 3}, {0x6587, 0x6587, 4}}
+	cmap := make([]byte, 12+16+len(groups)*12)
+	be := binary.BigEndian
+	be.PutUint16(cmap[2:], 1)
+	be.PutUint16(cmap[4:], 3)
+	be.PutUint16(cmap[6:], 10)
+	be.PutUint32(cmap[8:], 12)
+	subtable := cmap[12:]
+	be.PutUint16(subtable, 12)
+	be.PutUint32(subtable[4:], uint32(len(subtable)))
+	be.PutUint32(subtable[12:], uint32(len(groups)))
+	for i, group := range groups {
+		be.PutUint32(subtable[16+i*12:], group[0])
+		be.PutUint32(subtable[20+i*12:], group[1])
+		be.PutUint32(subtable[24+i*12:], group[2])
+	}
+	tables["cmap"] = cmap
+
+	return writeFontFile(tables)
+}
+
+// testCollection returns a font collection of the fonts, the offsets of
+// their tables are made relative to the start of the collection.
+func testCollection(fonts ...[]byte) []byte {
+	be := binary.BigEndian
+	collection := make([]byte, 12+4*len(fonts))
+	copy(collection, "ttcf")
+	be.PutUint32(collection[4:], 0x00010000)
+	be.PutUint32(collection[8:], uint32(len(fonts)))
+	for i, font := range fonts {
+		base := len(collection)
+		be.PutUint32(collection[12+i*4:], uint32(base))
+		font = bytes.Clone(font)
+		for j := 0; j < int(be.Uint16(font[4:])); j++ {
+			record := font[12+j*16:]
+			be.PutUint32(record[8:], be.Uint32(record[8:])+uint32(base))
+		}
+		collection = append(collection, font...)
+	}
+	return collection
+}
+
+func TestParseCFFCharset(t *testing.T) {
+	tests := []struct {
+		name    string
+		dict    []byte
+		charset []byte
+		want    []uint16
+	}{
+		{"name-keyed", nil, []byte{0, 0, 1, 0, 2, 0, 3, 0, 4}, nil},
+		{"format 0", []byte{0x8b, 0x8c, 0x8b, 12, 30}, []byte{0, 0, 7, 0, 9, 0, 8, 0, 1}, []uint16{0, 7, 9, 8, 1}},
+		{"format 1", []byte{0x8b, 0x8c, 0x8b, 12, 30}, []byte{1, 0, 100, 1, 0, 10, 1}, []uint16{0, 100, 101, 10, 11}},
+		{"format 2", []byte{0x8b, 0x8c, 0x8b, 12, 30}, []byte{2, 0x4e, 0x00, 0, 3}, []uint16{0, 0x4e00, 0x4e01, 0x4e02, 0x4e03}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cids, err := parseCFFCharset(testCFF(tt.dict, tt.charset), 5)
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if len(cids) != len(tt.want) {
+				t.Fatalf("expected the CIDs %v, got %v", tt.want, cids)
+			}
+			for i := range cids {
+				if cids[i] != tt.want[i] {
+					t.Errorf("expected the CIDs %v, got %v", tt.want, cids)
+					break
+				}
+			}
+		})
+	}
+
+	if _, err := parseCFFCharset(testCFF([]byte{0x8b, 0x8c, 0x8b, 12, 30}, []byte{3}), 5); err == nil {
+		t.Errorf("expected an error for an unsupported charset format")
+	}
+}
+
+func TestSubsetCFF(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		dict []byte
+	}{
+		{"name-keyed", nil},
+		{"CID-keyed", []byte{0x8b, 0x8c, 0x8b, 12, 30}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cff := testCFF(tt.dict, []byte{2, 0x03, 0xe8, 0, 3})
+			subset, err := subsetCFF(cff, map[uint16]bool{3: true})
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			for _, font := range []struct {
+				data   []byte
+				subset bool
+			}{{cff, false}, {subset, true}} {
+				data := font.data
+				_, next, err := readCFFIndex(data, int(data[2]))
+				if err != nil {
+					t.Fatalf("%s", err.Error())
+				}
+				topDicts, _, err := readCFFIndex(data, next)
+				if err != nil {
+					t.Fatalf("%s", err.Error())
+				}
+				top, err := parseCFFDict(topDicts[0])
+				if err != nil {
+					t.Fatalf("%s", err.Error())
+				}
+
+				charStrings, _, err := readCFFIndex(data, top[cffCharStrings][0])
+				if err != nil {
+					t.Fatalf("%s", err.Error())
+				}
+				if len(charStrings) != 5 {
+					t.Fatalf("expected 5 CharStrings, got %d", len(charStrings))
+				}
+				for glyph, charString := range charStrings {
+					want := []byte{byte(139 + glyph), 14}
+					if font.subset && glyph != 0 && glyph != 3 {
+						want = cffEndChar
+					}
+					if !bytes.Equal(charString, want) {
+						t.Errorf("expected the CharString % x of glyph %d, got % x", want, glyph, charString)
+					}
+				}
+
+				private := top[cffPrivate]
+				if tt.dict != nil {
+					fonts, _, err := readCFFIndex(data, top[cffFDArray][0])
+					if err != nil {
+						t.Fatalf("%s", err.Error())
+					}
+					fontDict, err := parseCFFDict(fonts[0])
+					if err != nil {
+						t.Fatalf("%s", err.Error())
+					}
+					private = fontDict[cffPrivate]
+
+					fdSelect := top[cffFDSelect][0]
+					if !bytes.Equal(data[fdSelect:fdSelect+6], []byte{0, 0, 0, 0, 0, 0}) {
+						t.Errorf("expected the FDSelect to be kept")
+					}
+				}
+				p, err := readCFFPrivate(data, private[0], private[1])
+				if err != nil {
+					t.Fatalf("%s", err.Error())
+				}
+				if !bytes.Equal(p.subrs, []byte{0, 1, 1, 1, 2, 11}) {
+					t.Errorf("expected the Local Subr INDEX to be kept, got % x", p.subrs)
+				}
+
+				cids, err := parseCFFCharset(data, 5)
+				if err != nil {
+					t.Fatalf("%s", err.Error())
+				}
+				if tt.dict != nil && (len(cids) != 5 || cids[4] != 1003) {
+					t.Errorf("expected the charset to be kept, got %v", cids)
+				}
+			}
+		})
+	}
+}
+
+func TestParseCollectionFont(t *testing.T) {
+	collection := testCollection(testFont(0), testCIDFont(true))
+
+	font, err := parseTrueTypeFont(collection)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if font.cff || font.postScriptName != "TestFont" {
+		t.Errorf("expected the TrueType font first, got CFF %v", font.cff)
+	}
+
+	font, err = parseCollectionFont(collection, 1)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if !font.cff || font.cid(1) != 1000 {
+		t.Errorf("expected the CID-keyed font second, got CFF %v", font.cff)
+	}
+	// The font is embedded as a font file of its own.
+	standalone, err := parseTrueTypeFont(font.data)
+	if err != nil {
+		t.Fatalf("failed to parse the embedded font: %s", err.Error())
+	}
+	if !standalone.cff || standalone.cid(4) != 1003 {
+		t.Errorf("expected the embedded font to be the CID-keyed font")
+	}
+
+	for _, index := range []int{-1, 2} {
+		if _, err := parseCollectionFont(collection, index); err == nil {
+			t.Errorf("expected an error for font %d", index)
+		}
+	}
+	if _, err := parseCollectionFont(testFont(0), 1); err == nil {
+		t.Errorf("expected an error for font 1 of a font that is not a collection")
+	}
+}
+
+func TestCreateAppearanceWithCIDKeyedFont(t *testing.T) {
+	context := SignContext{
+		OutputBuffer: filebuffer.New([]byte{}),
+		lastXrefID:   10,
+		SignData: SignData{
+			Signature: SignDataSignature{
+				Info: SignDataSignatureInfo{
+					Name: "A中文",
+				},
+			},
+			Appearance: Appearance{
+				Font: testCIDFont(true),
+			},
+		},
+	}
+
+	appearance, err := context.createAppearance([4]float64{0, 0, 200, 60})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	// The codes are the CIDs of the glyphs 1, 3 and 4.
+	if !strings.Contains(string(appearance), "<03E803EA03EB> Tj") {
+		t.Errorf("expected the text to be encoded as CIDs, got %q", appearance)
+	}
+
+	objects := context.OutputBuffer.Buff.String()
+	for _, expected := range []string{
+		"/Subtype /OpenType",
+		"/FontFile3 11 0 R",
+		"/Subtype /CIDFontType0",
+		"/W [ 1000 [667] 1002 [1000] 1003 [1000] ]",
+		"/Encoding /Identity-H",
+		"/Flags 4\n",
+	} {
+		if !strings.Contains(objects, expected) {
+			t.Errorf("expected font objects to contain %q", expected)
+		}
+	}
+	for _, unexpected := range []string{"/CIDToGIDMap", "/Length1"} {
+		if strings.Contains(objects, unexpected) {
+			t.Errorf("expected no %s for a CFF font", unexpected)
+		}
+	}
+
+	font, err := newEmbeddedFont(testCIDFont(true), 0)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	font.encode("中文")
+	cmap := string(font.toUnicodeCMap())
+	for _, expected := range []string{"<03EA> <4E2D>", "<03EB> <6587>"} {
+		if !strings.Contains(cmap, expected) {
+			t.Errorf("expected CMap to contain %q", expected)
+		}
+	}
+
+	// Without ROS the glyph ids are the CIDs.
+	font, err = newEmbeddedFont(testCIDFont(false), 0)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if encoded := font.encode("中文"); encoded != "<00030004>" {
+		t.Errorf("expected the glyph ids of a name-keyed font, got %s", encoded)
+	}
+}
+
+func TestCreateAppearanceMissingCharacters(t *testing.T) {
+	tests := []struct {
+		name string
+		font []byte
+		want string
+	}{
+		{"embedded font", testFont(0), `the font TestFont has no glyphs for the characters "中文"`},
+		{"Times-Roman", nil, `the text "A中文" has characters that Times-Roman can not display, set Appearance.Font to a font that has them`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			context := SignContext{
+				OutputBuffer: filebuffer.New([]byte{}),
+				lastXrefID:   10,
+				SignData: SignData{
+					Signature: SignDataSignature{
+						Info: SignDataSignatureInfo{
+							Name: "A中文",
+						},
+					},
+					Appearance: Appearance{
+						Font: tt.font,
+					},
+				},
+			}
+			_, err := context.createAppearance([4]float64{0, 0, 200, 60})
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("expected the error %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestCreateAppearanceWinAnsi(t *testing.T) {
+	context := SignContext{
+		SignData: SignData{
+			Signature: SignDataSignature{
+				Info: SignDataSignatureInfo{
+					Name: "José",
+				},
+			},
+		},
+	}
+
+	appearance, err := context.createAppearance([4]float64{0, 0, 200, 60})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	for _, expected := range []string{"/Encoding /WinAnsiEncoding", "<4a6f73e9> Tj"} {
+		if !strings.Contains(string(appearance), expected) {
+			t.Errorf("expected appearance to contain %q", expected)
+		}
+	}
+}
+
+func TestSignCJKAppearance(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+	document, err := os.ReadFile("../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	var output bytes.Buffer
+	err = Sign(bytes.NewReader(document), &output, nil, int64(len(document)), SignData{
+		Signature: SignDataSignature{
+			Info: SignDataSignatureInfo{
+				Name: "中文",
+				Date: time.Now().Local(),
+			},
+			CertType: ApprovalSignature,
+		},
+		Appearance: Appearance{
+			Visible:     true,
+			LowerLeftX:  350,
+			LowerLeftY:  75,
+			UpperRightX: 600,
+			UpperRightY: 100,
+			Font:        testCollection(testFont(0), testCIDFont(true)),
+			FontIndex:   1,
+		},
+		Signer:      pkey,
+		Certificate: cert,
+	})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	// The text of the appearance is extracted with the ToUnicode CMap.
+	response, err := verify.Verify(bytes.NewReader(output.Bytes()), int64(output.Len()))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if len(response.Signers) != 1 || !response.Signers[0].ValidSignature {
+		t.Fatalf("expected a valid signature, got %+v", response.Signers)
+	}
+	if text := response.Signers[0].AppearanceText; text != "中文" {
+		t.Errorf("expected the appearance text 中文, got %q", text)
+	}
+}
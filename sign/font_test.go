@@ -0,0 +1,262 @@
+package sign
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/mattetti/filebuffer"
+)
+
+// testFont builds a minimal TrueType font with the glyphs: 0 .notdef, 1 'A',
+// 2 'é' (a composite of glyph 1), 3 'Ж' and 4 (unmapped).
+func testFont(fsType uint16) []byte {
+	be := binary.BigEndian
+
+	head := make([]byte, 54)
+	be.PutUint32(head, 0x00010000)
+	be.PutUint32(head[12:], 0x5F0F3CF5) // magicNumber
+	be.PutUint16(head[18:], 2048)       // unitsPerEm
+	be.PutUint16(head[36:], uint16(0xff00))
+	be.PutUint16(head[40:], 2048)
+	be.PutUint16(head[42:], 1800)
+	be.PutUint16(head[50:], 0) // short loca
+
+	hhea := make([]byte, 36)
+	be.PutUint32(hhea, 0x00010000)
+	be.PutUint16(hhea[4:], 1900)
+	be.PutUint16(hhea[6:], uint16(0xfe00)) // -512
+	be.PutUint16(hhea[34:], 4)             // numberOfHMetrics
+
+	maxp := make([]byte, 6)
+	be.PutUint32(maxp, 0x00005000)
+	be.PutUint16(maxp[4:], 5)
+
+	// The last glyph uses the advance of the last metric.
+	hmtx := make([]byte, 4*4+2)
+	for i, advance := range []uint16{1024, 1366, 1366, 2048} {
+		be.PutUint16(hmtx[i*4:], advance)
+	}
+
+	simple := []byte{0, 1, 0, 0, 0, 0, 0, 10, 0, 10, 0, 0}
+	composite := []byte{0xff, 0xff, 0, 0, 0, 0, 0, 10, 0, 10, 0, 0x01, 0, 1, 0, 0, 0, 0}
+	glyphs := [][]byte{simple, simple, composite, simple, simple}
+	var glyf bytes.Buffer
+	loca := make([]byte, 2*(len(glyphs)+1))
+	for i, glyph := range glyphs {
+		be.PutUint16(loca[i*2:], uint16(glyf.Len()/2))
+		glyf.Write(glyph)
+	}
+	be.PutUint16(loca[len(glyphs)*2:], uint16(glyf.Len()/2))
+
+	// Format 4 subtable for (3,1)
+	segments := [][3]uint16{{'A', 'A', 1}, {0xe9, 0xe9, 2}, {0x416, 0x416, 3}, {0xffff, 0xffff, 0}}
+	segCount := len(segments)
+	format4 := make([]byte, 16+segCount*8)
+	be.PutUint16(format4, 4)
+	be.PutUint16(format4[2:], uint16(len(format4)))
+	be.PutUint16(format4[6:], uint16(segCount*2))
+	for i, segment := range segments {
+		be.PutUint16(format4[14+i*2:], segment[1])
+		be.PutUint16(format4[16+segCount*2+i*2:], segment[0])
+		delta := uint16(1)
+		if segment[2] != 0 {
+			delta = segment[2] - segment[0]
+		}
+		be.PutUint16(format4[16+segCount*4+i*2:], delta)
+	}
+	cmap := make([]byte, 12, 12+len(format4))
+	be.PutUint16(cmap[2:], 1)
+	be.PutUint16(cmap[4:], 3)
+	be.PutUint16(cmap[6:], 1)
+	be.PutUint32(cmap[8:], 12)
+	cmap = append(cmap, format4...)
+
+	os2 := make([]byte, 96)
+	be.PutUint16(os2, 4)
+	be.PutUint16(os2[8:], fsType)
+	be.PutUint16(os2[88:], 1400)
+
+	nameValue := utf16.Encode([]rune("Test Font"))
+	name := make([]byte, 18+len(nameValue)*2)
+	be.PutUint16(name[2:], 1)
+	be.PutUint16(name[4:], 18)
+	be.PutUint16(name[6:], 3)
+	be.PutUint16(name[8:], 1)
+	be.PutUint16(name[12:], 6)
+	be.PutUint16(name[14:], uint16(len(nameValue)*2))
+	for i, unit := range nameValue {
+		be.PutUint16(name[18+i*2:], unit)
+	}
+
+	return writeFontFile(map[string][]byte{
+		"head": head,
+		"hhea": hhea,
+		"maxp": maxp,
+		"hmtx": hmtx,
+		"loca": loca,
+		"glyf": glyf.Bytes(),
+		"cmap": cmap,
+		"OS/2": os2,
+		"name": name,
+	})
+}
+
+func TestParseTrueTypeFont(t *testing.T) {
+	font, err := parseTrueTypeFont(testFont(0))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	if font.postScriptName != "TestFont" {
+		t.Errorf("expected PostScript name TestFont, got %q", font.postScriptName)
+	}
+	if font.capHeight != 1400 {
+		t.Errorf("expected cap height from the OS/2 table, got %d", font.capHeight)
+	}
+
+	glyphs := font.glyphs("AéЖ?")
+	expected := []uint16{1, 2, 3, 0}
+	for i := range expected {
+		if glyphs[i] != expected[i] {
+			t.Errorf("expected glyphs %v, got %v", expected, glyphs)
+			break
+		}
+	}
+
+	// 1366 + 2048 font units at 2048 units per em
+	if width := font.textWidth("AЖ"); width < 1.666 || width > 1.668 {
+		t.Errorf("unexpected text width %f", width)
+	}
+	if advance := font.advance(4); advance != 1000 {
+		t.Errorf("expected glyph 4 to use the last advance width, got %f", advance)
+	}
+}
+
+func TestParseTrueTypeFontErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"too short", []byte{0, 1, 0, 0}},
+		{"collection", append([]byte("ttcf"), make([]byte, 12)...)},
+		{"unknown format", append([]byte("wOFF"), make([]byte, 12)...)},
+		{"restricted license", testFont(0x0002)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseTrueTypeFont(tt.data); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
+
+func TestSubsetTrueTypeFont(t *testing.T) {
+	font, err := parseTrueTypeFont(testFont(0))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	data, err := font.subset(map[uint16]bool{2: true})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	if sum := fontChecksum(data); sum != 0xB1B0AFBA {
+		t.Errorf("invalid font checksum %08x", sum)
+	}
+
+	subset, err := parseTrueTypeFont(data)
+	if err != nil {
+		t.Fatalf("failed to parse subset: %s", err.Error())
+	}
+	if subset.numGlyphs != font.numGlyphs {
+		t.Errorf("expected the glyph ids to be kept")
+	}
+
+	offsets, err := subset.glyphOffsets()
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	for glyph, keep := range []bool{true, true, true, false, false} {
+		length := offsets[glyph+1] - offsets[glyph]
+		if keep && length == 0 {
+			t.Errorf("expected glyph %d to be included", glyph)
+		}
+		if !keep && length != 0 {
+			t.Errorf("expected glyph %d to be removed", glyph)
+		}
+	}
+}
+
+func TestCreateAppearanceWithFont(t *testing.T) {
+	context := SignContext{
+		OutputBuffer: filebuffer.New([]byte{}),
+		lastXrefID:   10,
+		SignData: SignData{
+			Signature: SignDataSignature{
+				Info: SignDataSignatureInfo{
+					Name: "AéЖ",
+				},
+			},
+			Appearance: Appearance{
+				Font: testFont(0),
+			},
+		},
+	}
+
+	appearance, err := context.createAppearance([4]float64{0, 0, 200, 60})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	for _, expected := range []string{
+		"/F1 15 0 R",
+		"<000100020003> Tj",
+	} {
+		if !strings.Contains(string(appearance), expected) {
+			t.Errorf("expected appearance to contain %q", expected)
+		}
+	}
+
+	objects := context.OutputBuffer.Buff.String()
+	for _, expected := range []string{
+		"/FontFile2 11 0 R",
+		"/Subtype /CIDFontType2",
+		"/CIDToGIDMap /Identity",
+		"/W [ 1 [667] 2 [667] 3 [1000] ]",
+		"/Subtype /Type0",
+		"/Encoding /Identity-H",
+		"/ToUnicode 14 0 R",
+	} {
+		if !strings.Contains(objects, expected) {
+			t.Errorf("expected font objects to contain %q", expected)
+		}
+	}
+
+	if !strings.Contains(objects, "+TestFont") {
+		t.Errorf("expected a subset tag before the font name")
+	}
+}
+
+func TestToUnicodeCMap(t *testing.T) {
+	font, err := newEmbeddedFont(testFont(0), 0)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	if encoded := font.encode("AЖ"); encoded != "<00010003>" {
+		t.Errorf("unexpected encoding %s", encoded)
+	}
+
+	cmap := string(font.toUnicodeCMap())
+	for _, expected := range []string{"2 beginbfchar", "<0001> <0041>", "<0003> <0416>"} {
+		if !strings.Contains(cmap, expected) {
+			t.Errorf("expected CMap to contain %q", expected)
+		}
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/digitorus/pdf"
+	_ "golang.org/x/crypto/sha3" // Registers the SHA-3 digest algorithms
 	"golang.org/x/text/encoding/unicode"
 	"golang.org/x/text/transform"
 )
@@ -170,6 +171,10 @@ var hashOIDs = map[crypto.Hash]asn1.ObjectIdentifier{
 	crypto.SHA256: asn1.ObjectIdentifier([]int{2, 16, 840, 1, 101, 3, 4, 2, 1}),
 	crypto.SHA384: asn1.ObjectIdentifier([]int{2, 16, 840, 1, 101, 3, 4, 2, 2}),
 	crypto.SHA512: asn1.ObjectIdentifier([]int{2, 16, 840, 1, 101, 3, 4, 2, 3}),
+
+	crypto.SHA3_256: asn1.ObjectIdentifier([]int{2, 16, 840, 1, 101, 3, 4, 2, 8}),
+	crypto.SHA3_384: asn1.ObjectIdentifier([]int{2, 16, 840, 1, 101, 3, 4, 2, 9}),
+	crypto.SHA3_512: asn1.ObjectIdentifier([]int{2, 16, 840, 1, 101, 3, 4, 2, 10}),
 }
 
 // func getHashAlgorithmFromOID(target asn1.ObjectIdentifier) crypto.Hash {
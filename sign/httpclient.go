@@ -0,0 +1,30 @@
+package sign
+
+import (
+	"context"
+	"net/http"
+)
+
+type httpClientKey struct{}
+
+// WithHTTPClient returns a copy of ctx with which the OCSPFetcher,
+// CRLFetcher and IssuerFetcher without an HTTPClient of their own send their
+// requests with client. Proxies, TLS settings and the timeout of a request
+// are those of the client and its Transport.
+//
+// SignData.HTTPClient is added to the context of the signature this way.
+func WithHTTPClient(ctx context.Context, client *http.Client) context.Context {
+	return context.WithValue(ctx, httpClientKey{}, client)
+}
+
+// httpClient returns client, the client of ctx if client is nil, and
+// fallback if neither is set.
+func httpClient(ctx context.Context, client, fallback *http.Client) *http.Client {
+	if client != nil {
+		return client
+	}
+	if client, ok := ctx.Value(httpClientKey{}).(*http.Client); ok && client != nil {
+		return client
+	}
+	return fallback
+}
@@ -0,0 +1,81 @@
+package sign
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"testing"
+)
+
+// countingTransport counts the requests it sends with http.DefaultTransport.
+type countingTransport struct {
+	requests atomic.Int32
+}
+
+func (c *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	c.requests.Add(1)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestSignDataHTTPClient(t *testing.T) {
+	tsa := newTestTSA(t)
+	shared := &countingTransport{}
+	client := &http.Client{Transport: shared}
+
+	context := SignContext{SignData: SignData{TSA: TSA{URL: tsa.URL}, HTTPClient: client}}
+	if _, err := context.GetTSA([]byte("signature")); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if shared.requests.Load() != 1 {
+		t.Errorf("expected the TSA request to be sent with the client, got %d requests", shared.requests.Load())
+	}
+
+	// A TSA with settings of its own does not use the client.
+	proxy, err := url.Parse(tsa.URL)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	context.SignData.TSA.Proxy = proxy
+	if _, err := context.GetTSA([]byte("signature")); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if shared.requests.Load() != 1 {
+		t.Errorf("expected the TSA request to be sent with the proxy, got %d requests with the client", shared.requests.Load())
+	}
+
+	h := newIssuerHierarchy(t)
+	context.SignData.Certificate = h.leaf
+	context.SignData.IssuerFetcher = &IssuerFetcher{}
+	context.completeCertificateChain()
+	if chains := context.SignData.CertificateChains; len(chains) != 1 || len(chains[0]) != 3 {
+		t.Fatalf("expected the completed chain, got %d chains", len(chains))
+	}
+	if shared.requests.Load() != 1+h.requests.Load() {
+		t.Errorf("expected the %d caIssuers requests to be sent with the client, got %d", h.requests.Load(), shared.requests.Load()-1)
+	}
+}
+
+func TestWithHTTPClient(t *testing.T) {
+	h := newIssuerHierarchy(t)
+	shared, own := &countingTransport{}, &countingTransport{}
+	ctx := WithHTTPClient(context.Background(), &http.Client{Transport: shared})
+
+	if _, err := (&IssuerFetcher{}).CompleteChainContext(ctx, []*x509.Certificate{h.leaf}); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if shared.requests.Load() == 0 {
+		t.Errorf("expected the requests to be sent with the client of the context")
+	}
+
+	// The client of a fetcher takes precedence.
+	requests := shared.requests.Load()
+	fetcher := &IssuerFetcher{HTTPClient: &http.Client{Transport: own}}
+	if _, err := fetcher.CompleteChainContext(ctx, []*x509.Certificate{h.leaf}); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if shared.requests.Load() != requests || own.requests.Load() == 0 {
+		t.Errorf("expected the requests to be sent with the client of the fetcher, got %d and %d", shared.requests.Load()-requests, own.requests.Load())
+	}
+}
@@ -0,0 +1,136 @@
+package sign
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/digitorus/pdfsign/revocation"
+	"golang.org/x/crypto/ocsp"
+)
+
+// OCSPFetcher requests the revocation status of certificates from the OCSP
+// responders of the Authority Information Access extension (RFC 6960), so
+// the responses can be embedded and signatures validated offline right after
+// signing.
+type OCSPFetcher struct {
+	HTTPClient *http.Client // Defaults to the client of WithHTTPClient, or a client with a timeout of 10 seconds
+}
+
+// DefaultOCSPFetcher is used by DefaultEmbedRevocationStatusFunction.
+var DefaultOCSPFetcher = &OCSPFetcher{}
+
+var defaultOCSPClient = &http.Client{Timeout: 10 * time.Second}
+
+// maxOCSPGetLength is the longest URL of a GET request, longer requests are
+// sent with POST (RFC 6960, appendix A.1).
+const maxOCSPGetLength = 255
+
+// Embed is a RevocationFunction that adds the OCSP response for cert to i.
+// Certificates without an issuer or an OCSP responder are skipped.
+func (f *OCSPFetcher) Embed(cert, issuer *x509.Certificate, i *revocation.InfoArchival) error {
+	return f.EmbedContext(context.Background(), cert, issuer, i)
+}
+
+// EmbedContext is Embed with a context that cancels the requests.
+func (f *OCSPFetcher) EmbedContext(ctx context.Context, cert, issuer *x509.Certificate, i *revocation.InfoArchival) error {
+	if issuer == nil || len(cert.OCSPServer) == 0 {
+		return nil
+	}
+	response, err := f.ResponseContext(ctx, cert, issuer)
+	if err != nil {
+		return err
+	}
+	return i.AddOCSP(response)
+}
+
+// Response returns the DER encoded OCSP response for cert, signed by issuer
+// or by a responder it delegated to. The responders of cert are tried in
+// order until one returns a current response. A revoked certificate is an
+// error.
+func (f *OCSPFetcher) Response(cert, issuer *x509.Certificate) ([]byte, error) {
+	return f.ResponseContext(context.Background(), cert, issuer)
+}
+
+// ResponseContext is Response with a context that cancels the requests, the
+// next responders are not tried once ctx is done.
+func (f *OCSPFetcher) ResponseContext(ctx context.Context, cert, issuer *x509.Certificate) ([]byte, error) {
+	request, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for _, server := range cert.OCSPServer {
+		body, err := f.fetch(ctx, server, request)
+		if err != nil {
+			errs = append(errs, err)
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+
+		response, err := ocsp.ParseResponseForCert(body, cert, issuer)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid OCSP response (%s): %w", server, err))
+			continue
+		}
+		switch {
+		case response.Status == ocsp.Revoked:
+			return nil, fmt.Errorf("certificate %s is revoked since %s", cert.Subject, response.RevokedAt)
+		case response.Status != ocsp.Good:
+			errs = append(errs, fmt.Errorf("unknown certificate %s at %s", cert.Subject, server))
+			continue
+		case !response.NextUpdate.IsZero() && response.NextUpdate.Before(time.Now()):
+			errs = append(errs, fmt.Errorf("expired OCSP response (%s)", server))
+			continue
+		}
+		return body, nil
+	}
+	return nil, errors.Join(errs...)
+}
+
+// fetch sends an OCSP request to server with GET, or with POST if the URL
+// is too long.
+func (f *OCSPFetcher) fetch(ctx context.Context, server string, request []byte) ([]byte, error) {
+	client := httpClient(ctx, f.HTTPClient, defaultOCSPClient)
+
+	var req *http.Request
+	var err error
+	get := strings.TrimRight(server, "/") + "/" + url.PathEscape(base64.StdEncoding.EncodeToString(request))
+	if len(get) <= maxOCSPGetLength {
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, get, nil)
+	} else {
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, server, bytes.NewReader(request))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/ocsp-request")
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare OCSP request (%s): %w", server, err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch OCSP response: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("failed to fetch OCSP response (%s): status %d", server, resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OCSP response (%s): %w", server, err)
+	}
+	return body, nil
+}
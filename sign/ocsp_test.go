@@ -0,0 +1,226 @@
+package sign
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdfsign/revocation"
+	"github.com/digitorus/pdfsign/verify"
+	"golang.org/x/crypto/ocsp"
+)
+
+// newOCSPResponder returns a responder for certificates of the intermediate
+// of h with the status of statuses by serial number, and the methods of the
+// requests it received.
+func newOCSPResponder(t *testing.T, h *issuerHierarchy, statuses map[int64]int, key crypto.Signer) (*httptest.Server, *[]string) {
+	t.Helper()
+
+	var methods []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+
+		var der []byte
+		if r.Method == http.MethodPost {
+			der, _ = io.ReadAll(r.Body)
+		} else {
+			escaped, _ := url.PathUnescape(path.Base(r.URL.EscapedPath()))
+			der, _ = base64.StdEncoding.DecodeString(escaped)
+		}
+		request, err := ocsp.ParseRequest(der)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		status, ok := statuses[request.SerialNumber.Int64()]
+		if !ok {
+			status = ocsp.Unknown
+		}
+		response, err := ocsp.CreateResponse(h.intermediate, h.intermediate, ocsp.Response{
+			Status:       status,
+			SerialNumber: request.SerialNumber,
+			ThisUpdate:   time.Now().Add(-time.Minute),
+			NextUpdate:   time.Now().Add(time.Hour),
+			RevokedAt:    time.Now().Add(-time.Hour),
+		}, key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write(response)
+	}))
+	t.Cleanup(server.Close)
+	return server, &methods
+}
+
+// newOCSPLeaf returns a certificate issued by the intermediate of h with the
+// OCSP responders servers.
+func newOCSPLeaf(t *testing.T, h *issuerHierarchy, serial int64, servers ...string) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "pdfsign Test OCSP Signer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		OCSPServer:   servers,
+	}, h.intermediate, &key.PublicKey, h.intermediateKey)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	return certificate, key
+}
+
+func TestOCSPFetcherResponse(t *testing.T) {
+	h := newIssuerHierarchy(t)
+	server, methods := newOCSPResponder(t, h, map[int64]int{10: ocsp.Good, 11: ocsp.Revoked}, h.intermediateKey)
+	forged, _ := newOCSPResponder(t, h, map[int64]int{10: ocsp.Good}, h.leafKey)
+	fetcher := &OCSPFetcher{HTTPClient: server.Client()}
+
+	tests := []struct {
+		name       string
+		serial     int64
+		servers    []string
+		wantErr    string
+		wantMethod string
+	}{
+		{name: "GET", serial: 10, servers: []string{server.URL}, wantMethod: http.MethodGet},
+		{name: "POST", serial: 10, servers: []string{server.URL + "/" + strings.Repeat("a", maxOCSPGetLength)}, wantMethod: http.MethodPost},
+		{name: "next responder", serial: 10, servers: []string{forged.URL, server.URL}, wantMethod: http.MethodGet},
+		{name: "revoked", serial: 11, servers: []string{server.URL}, wantErr: "is revoked"},
+		{name: "unknown", serial: 12, servers: []string{server.URL}, wantErr: "unknown certificate"},
+		{name: "invalid signature", serial: 10, servers: []string{forged.URL}, wantErr: "invalid OCSP response"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*methods = nil
+			leaf, _ := newOCSPLeaf(t, h, tt.serial, tt.servers...)
+
+			response, err := fetcher.Response(leaf, h.intermediate)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected an error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if _, err := ocsp.ParseResponseForCert(response, leaf, h.intermediate); err != nil {
+				t.Errorf("%s", err.Error())
+			}
+			if len(*methods) != 1 || (*methods)[0] != tt.wantMethod {
+				t.Errorf("expected a %s request, got %v", tt.wantMethod, *methods)
+			}
+		})
+	}
+}
+
+func TestOCSPFetcherEmbed(t *testing.T) {
+	h := newIssuerHierarchy(t)
+	server, methods := newOCSPResponder(t, h, map[int64]int{10: ocsp.Good}, h.intermediateKey)
+	fetcher := &OCSPFetcher{HTTPClient: server.Client()}
+	leaf, key := newOCSPLeaf(t, h, 10, server.URL)
+
+	// Certificates without an issuer or a responder are skipped.
+	var info revocation.InfoArchival
+	if err := fetcher.Embed(leaf, nil, &info); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if err := fetcher.Embed(h.intermediate, h.root, &info); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if len(info.OCSP) != 0 || len(*methods) != 0 {
+		t.Fatalf("expected no OCSP requests, got %d", len(*methods))
+	}
+
+	input, err := os.ReadFile("../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	var output bytes.Buffer
+	err = Sign(bytes.NewReader(input), &output, nil, int64(len(input)), SignData{
+		Signature: SignDataSignature{
+			Info: SignDataSignatureInfo{
+				Name: "John Doe",
+				Date: time.Now().Local(),
+			},
+			CertType: ApprovalSignature,
+		},
+		Signer:             key,
+		Certificate:        leaf,
+		CertificateChains:  [][]*x509.Certificate{{leaf, h.intermediate, h.root}},
+		DigestAlgorithm:    crypto.SHA256,
+		RevocationFunction: fetcher.Embed,
+	})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if len(*methods) != 1 {
+		t.Errorf("expected an OCSP request for the signing certificate, got %d", len(*methods))
+	}
+
+	result, err := verify.Verify(bytes.NewReader(output.Bytes()), int64(output.Len()))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if len(result.Signers) != 1 || !result.Signers[0].ValidSignature {
+		t.Fatalf("expected a valid signature")
+	}
+	for _, certificate := range result.Signers[0].Certificates {
+		if certificate.Certificate.Equal(leaf) && (!certificate.OCSPEmbedded || certificate.OCSPResponse.Status != ocsp.Good) {
+			t.Errorf("expected the embedded OCSP response of the signing certificate")
+		}
+	}
+}
+
+func TestOCSPFetcherResponseContext(t *testing.T) {
+	h := newIssuerHierarchy(t)
+	server, methods := newOCSPResponder(t, h, map[int64]int{10: ocsp.Good}, h.intermediateKey)
+	fetcher := &OCSPFetcher{HTTPClient: server.Client()}
+	leaf, _ := newOCSPLeaf(t, h, 10, server.URL, server.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := fetcher.ResponseContext(ctx, leaf, h.intermediate)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the request to be canceled, got %v", err)
+	}
+	if len(*methods) != 0 {
+		t.Errorf("expected no OCSP requests, got %d", len(*methods))
+	}
+	// The second responder is not tried once the context is done.
+	if strings.Count(err.Error(), server.URL) != 1 {
+		t.Errorf("expected a single failed responder: %s", err.Error())
+	}
+}
@@ -0,0 +1,89 @@
+package sign
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/digitorus/timestamp"
+)
+
+// validateProfile checks that the sign data contains everything the selected
+// PAdES baseline profile requires, before any bytes are written.
+func (context *SignContext) validateProfile() error {
+	profile := context.SignData.Profile
+	switch context.SignData.SubFilter {
+	case 0, SubFilterETSICAdESDetached:
+	case SubFilterAdbePKCS7Detached, SubFilterAdbePKCS7SHA1, SubFilterAdbeX509RSASHA1:
+		if profile != 0 {
+			return fmt.Errorf("profile %s requires the %s SubFilter", profile, SubFilterETSICAdESDetached)
+		}
+	default:
+		return fmt.Errorf("unknown SubFilter: %s", context.SignData.SubFilter)
+	}
+	if profile == 0 {
+		return nil
+	}
+
+	if context.SignData.Signature.CertType == TimeStampSignature {
+		return fmt.Errorf("profile %s cannot be used for a document timestamp", profile)
+	}
+
+	switch profile {
+	case PAdESBaselineB:
+	case PAdESBaselineT:
+		// ETSI EN 319 142-1, 6.3 (PAdES-BASELINE-T): a signature time-stamp
+		// shall be incorporated in the signature as an unsigned attribute.
+		if context.SignData.TSA.URL == "" {
+			return fmt.Errorf("profile %s requires a TSA URL", profile)
+		}
+	case PAdESBaselineLT, PAdESBaselineLTA:
+		// ETSI EN 319 142-1, 6.4 (PAdES-BASELINE-LT): builds on B-T and adds
+		// the validation material of the signature to the DSS. B-LTA adds a
+		// document timestamp over the result (6.5).
+		if context.SignData.TSA.URL == "" {
+			return fmt.Errorf("profile %s requires a TSA URL", profile)
+		}
+		if context.SignData.RevocationFunction == nil {
+			context.SignData.RevocationFunction = defaultRevocationFunction(signingContext(&context.SignData))
+		}
+	default:
+		return fmt.Errorf("unknown profile: %s", profile)
+	}
+
+	return nil
+}
+
+// subFilter returns the SubFilter value for the signature dictionary.
+func (context *SignContext) subFilter() string {
+	if context.cades() {
+		return SubFilterETSICAdESDetached.String()
+	}
+	switch context.SignData.SubFilter {
+	case SubFilterAdbePKCS7SHA1, SubFilterAdbeX509RSASHA1:
+		return context.SignData.SubFilter.String()
+	}
+	return SubFilterAdbePKCS7Detached.String()
+}
+
+// cades reports whether the signature is a CAdES signature. PAdES baseline
+// signatures shall use the ETSI.CAdES.detached SubFilter, see ETSI EN 319
+// 142-1, 5.3.
+func (context *SignContext) cades() bool {
+	return context.SignData.SubFilter == SubFilterETSICAdESDetached || context.SignData.Profile != 0
+}
+
+// checkTimestampImprint makes sure the TSA actually timestamped the data we
+// requested, a mismatching token would be embedded silently otherwise.
+func (context *SignContext) checkTimestampImprint(ts *timestamp.Timestamp, data []byte) error {
+	if !ts.HashAlgorithm.Available() {
+		return fmt.Errorf("timestamp uses unavailable hash algorithm %v", ts.HashAlgorithm)
+	}
+
+	h := ts.HashAlgorithm.New()
+	h.Write(data)
+	if !bytes.Equal(h.Sum(nil), ts.HashedMessage) {
+		return fmt.Errorf("timestamp message imprint does not match the signature value")
+	}
+
+	return nil
+}
@@ -0,0 +1,417 @@
+package sign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/revocation"
+	"github.com/digitorus/pdfsign/verify"
+	"github.com/digitorus/pkcs7"
+	"github.com/digitorus/timestamp"
+)
+
+// newTestTSA starts a local RFC 3161 time-stamp authority so tests do not
+// depend on public TSA services.
+func newTestTSA(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate TSA key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "pdfsign test TSA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatalf("failed to create TSA certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse TSA certificate: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req, err := timestamp.ParseRequest(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ts := timestamp.Timestamp{
+			HashAlgorithm:     req.HashAlgorithm,
+			HashedMessage:     req.HashedMessage,
+			Time:              time.Now().UTC().Truncate(time.Second),
+			Policy:            asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 2, 3, 4},
+			Nonce:             req.Nonce,
+			AddTSACertificate: req.Certificates,
+		}
+		resp, err := ts.CreateResponseWithOpts(cert, key, crypto.SHA256)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/timestamp-reply")
+		_, _ = w.Write(resp)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestSignPDFBaselineT(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+	tsa := newTestTSA(t)
+
+	tmpfile, err := os.CreateTemp("", t.Name())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer func() {
+		if err := os.Remove(tmpfile.Name()); err != nil {
+			t.Errorf("Failed to remove tmpfile: %v", err)
+		}
+	}()
+
+	err = SignFile("../testfiles/testfile20.pdf", tmpfile.Name(), SignData{
+		Signature: SignDataSignature{
+			Info: SignDataSignatureInfo{
+				Name:   "John Doe",
+				Reason: "PAdES B-T",
+				Date:   time.Now().Local(),
+			},
+			CertType:   CertificationSignature,
+			DocMDPPerm: AllowFillingExistingFormFieldsAndSignaturesPerms,
+		},
+		Signer:      pkey,
+		Certificate: cert,
+		TSA: TSA{
+			URL: tsa.URL,
+		},
+		Profile: PAdESBaselineT,
+	})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	content, err := os.ReadFile(tmpfile.Name())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if !strings.Contains(string(content), "/SubFilter /ETSI.CAdES.detached") {
+		t.Errorf("expected ETSI.CAdES.detached SubFilter")
+	}
+
+	info, err := verify.VerifyFile(tmpfile)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if len(info.Signers) != 1 {
+		t.Fatalf("expected 1 signer, got %d", len(info.Signers))
+	}
+	if info.Signers[0].TimeStamp == nil {
+		t.Fatalf("expected an embedded signature timestamp")
+	}
+	if info.Signers[0].TimeSource != "embedded_timestamp" {
+		t.Errorf("expected time source embedded_timestamp, got %q", info.Signers[0].TimeSource)
+	}
+	if info.Signers[0].TimestampStatus != "valid" || info.Signers[0].TimestampTime == nil || info.Signers[0].TimestampError != "" {
+		t.Errorf("expected a valid timestamp proving the time, got %q (%s)", info.Signers[0].TimestampStatus, info.Signers[0].TimestampError)
+	}
+}
+
+func TestValidateProfile(t *testing.T) {
+	tests := []struct {
+		name     string
+		signData SignData
+		wantErr  bool
+	}{
+		{
+			name:     "no profile",
+			signData: SignData{},
+		},
+		{
+			name:     "baseline B without TSA",
+			signData: SignData{Profile: PAdESBaselineB},
+		},
+		{
+			name:     "baseline T without TSA",
+			signData: SignData{Profile: PAdESBaselineT},
+			wantErr:  true,
+		},
+		{
+			name:     "baseline T with TSA",
+			signData: SignData{Profile: PAdESBaselineT, TSA: TSA{URL: "http://localhost"}},
+		},
+		{
+			name:     "baseline LT without TSA",
+			signData: SignData{Profile: PAdESBaselineLT},
+			wantErr:  true,
+		},
+		{
+			name:     "baseline LT with TSA",
+			signData: SignData{Profile: PAdESBaselineLT, TSA: TSA{URL: "http://localhost"}},
+		},
+		{
+			name:     "baseline LTA without TSA",
+			signData: SignData{Profile: PAdESBaselineLTA},
+			wantErr:  true,
+		},
+		{
+			name: "baseline T as document timestamp",
+			signData: SignData{
+				Profile:   PAdESBaselineT,
+				TSA:       TSA{URL: "http://localhost"},
+				Signature: SignDataSignature{CertType: TimeStampSignature},
+			},
+			wantErr: true,
+		},
+		{
+			name:     "CAdES SubFilter without profile",
+			signData: SignData{SubFilter: SubFilterETSICAdESDetached},
+		},
+		{
+			name:     "adbe.pkcs7.detached SubFilter with profile",
+			signData: SignData{Profile: PAdESBaselineB, SubFilter: SubFilterAdbePKCS7Detached},
+			wantErr:  true,
+		},
+		{
+			name:     "adbe.pkcs7.sha1 SubFilter with profile",
+			signData: SignData{Profile: PAdESBaselineB, SubFilter: SubFilterAdbePKCS7SHA1},
+			wantErr:  true,
+		},
+		{
+			name:     "unknown SubFilter",
+			signData: SignData{SubFilter: SubFilter(99)},
+			wantErr:  true,
+		},
+		{
+			name:     "unknown profile",
+			signData: SignData{Profile: PAdESProfile(99)},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			context := SignContext{SignData: tt.signData}
+			err := context.validateProfile()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSignPDFSubFilter(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	issuer := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      cert.Issuer,
+		KeyUsage:     x509.KeyUsageCRLSign,
+		SubjectKeyId: []byte{1, 2, 3, 4},
+	}
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Hour),
+		NextUpdate: time.Now().Add(time.Hour),
+	}, issuer, pkey)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	input, err := os.ReadFile("../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	oidRevocationInfoArchival := asn1.ObjectIdentifier{1, 2, 840, 113583, 1, 1, 8}
+	oidSigningCertificateV2 := asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+
+	tests := []struct {
+		name      string
+		subFilter SubFilter
+		want      string
+		cades     bool
+	}{
+		{name: "default", want: "adbe.pkcs7.detached"},
+		{name: "adbe.pkcs7.detached", subFilter: SubFilterAdbePKCS7Detached, want: "adbe.pkcs7.detached"},
+		{name: "ETSI.CAdES.detached", subFilter: SubFilterETSICAdESDetached, want: "ETSI.CAdES.detached", cades: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output bytes.Buffer
+			err := Sign(bytes.NewReader(input), &output, nil, int64(len(input)), SignData{
+				Signature: SignDataSignature{
+					Info: SignDataSignatureInfo{
+						Name: "John Doe",
+						Date: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+					},
+					CertType:   CertificationSignature,
+					DocMDPPerm: AllowFillingExistingFormFieldsAndSignaturesPerms,
+				},
+				Signer:            pkey,
+				Certificate:       cert,
+				CertificateChains: [][]*x509.Certificate{{cert}},
+				DigestAlgorithm:   crypto.SHA256,
+				RevocationFunction: func(cert, issuer *x509.Certificate, i *revocation.InfoArchival) error {
+					return i.AddCRL(crl)
+				},
+				SubFilter: tt.subFilter,
+			})
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			rdr, err := pdf.NewReader(bytes.NewReader(output.Bytes()), int64(output.Len()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			root := rdr.Trailer().Key("Root")
+			v := root.Key("AcroForm").Key("Fields").Index(0).Key("V")
+			if got := v.Key("SubFilter").Name(); got != tt.want {
+				t.Errorf("expected SubFilter %s, got %s", tt.want, got)
+			}
+			if got := v.Key("M").RawString(); got != "D:20240501120000+00'00'" {
+				t.Errorf("unexpected signing time %q", got)
+			}
+
+			p7, err := pkcs7.Parse([]byte(v.Key("Contents").RawString()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			attributes := make(map[string]bool)
+			for _, attribute := range p7.Signers[0].AuthenticatedAttributes {
+				attributes[attribute.Type.String()] = true
+			}
+			if !attributes[oidSigningCertificateV2.String()] {
+				t.Errorf("expected the signing-certificate-v2 attribute")
+			}
+			if attributes[oidAttributeSigningTime.String()] == tt.cades {
+				t.Errorf("expected the signing-time attribute only without CAdES, got %v", attributes[oidAttributeSigningTime.String()])
+			}
+			if attributes[oidRevocationInfoArchival.String()] == tt.cades {
+				t.Errorf("expected the adbe-revocationInfoArchival attribute only without CAdES, got %v", attributes[oidRevocationInfoArchival.String()])
+			}
+
+			// The revocation data of CAdES signatures is in the DSS.
+			if crls := root.Key("DSS").Key("CRLs").Len(); (crls == 1) != tt.cades {
+				t.Errorf("unexpected number of CRLs in the DSS: %d", crls)
+			}
+
+			info, err := verify.Verify(bytes.NewReader(output.Bytes()), int64(output.Len()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if len(info.Signers) != 1 || !info.Signers[0].ValidSignature {
+				t.Errorf("expected a valid signature")
+			}
+		})
+	}
+}
+
+func TestSignPDFAdbePKCS7SHA1(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	input, err := os.ReadFile("../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	sign_data := SignData{
+		Signature: SignDataSignature{
+			Info: SignDataSignatureInfo{
+				Name: "John Doe",
+				Date: time.Now().Local(),
+			},
+			CertType:   CertificationSignature,
+			DocMDPPerm: AllowFillingExistingFormFieldsAndSignaturesPerms,
+		},
+		Signer:      pkey,
+		Certificate: cert,
+		SubFilter:   SubFilterAdbePKCS7SHA1,
+	}
+
+	var output bytes.Buffer
+	if err := Sign(bytes.NewReader(input), &output, nil, int64(len(input)), sign_data); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	rdr, err := pdf.NewReader(bytes.NewReader(output.Bytes()), int64(output.Len()))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	v := rdr.Trailer().Key("Root").Key("AcroForm").Key("Fields").Index(0).Key("V")
+	if got := v.Key("SubFilter").Name(); got != "adbe.pkcs7.sha1" {
+		t.Errorf("expected SubFilter adbe.pkcs7.sha1, got %s", got)
+	}
+
+	// The SignedData encapsulates the SHA-1 digest of the ByteRange.
+	var content []byte
+	byteRange := v.Key("ByteRange")
+	for i := 0; i+1 < byteRange.Len(); i += 2 {
+		start := byteRange.Index(i).Int64()
+		content = append(content, output.Bytes()[start:start+byteRange.Index(i+1).Int64()]...)
+	}
+	digest := sha1.Sum(content)
+
+	p7, err := pkcs7.Parse([]byte(v.Key("Contents").RawString()))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if !bytes.Equal(p7.Content, digest[:]) {
+		t.Errorf("expected the SHA-1 digest of the ByteRange as content, got %x", p7.Content)
+	}
+	if got := p7.Signers[0].DigestAlgorithm.Algorithm; !got.Equal(getOIDFromHashAlgorithm(crypto.SHA1)) {
+		t.Errorf("expected a SHA-1 digest algorithm, got %s", got)
+	}
+	if err := p7.Verify(); err != nil {
+		t.Errorf("%s", err.Error())
+	}
+
+	info, err := verify.Verify(bytes.NewReader(output.Bytes()), int64(output.Len()))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if len(info.Signers) != 1 || !info.Signers[0].ValidSignature {
+		t.Errorf("expected a valid signature")
+	}
+
+	// Other digests are rejected.
+	sign_data.DigestAlgorithm = crypto.SHA256
+	err = Sign(bytes.NewReader(input), io.Discard, nil, int64(len(input)), sign_data)
+	if err == nil || !strings.Contains(err.Error(), "SHA-1") {
+		t.Errorf("expected an error for a SHA-256 digest, got %v", err)
+	}
+}
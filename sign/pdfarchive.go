@@ -0,0 +1,319 @@
+package sign
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/revocation"
+	"github.com/digitorus/pkcs7"
+	"github.com/mattetti/filebuffer"
+)
+
+// ArchiveTimestampFile extends a (PAdES B-LT or B-LTA) signed document with a
+// new archive timestamp, see ArchiveTimestamp.
+func ArchiveTimestampFile(input string, output string, sign_data SignData) error {
+	input_file, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = input_file.Close()
+	}()
+
+	output_file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = output_file.Close()
+	}()
+
+	return ArchiveTimestamp(input_file, output_file, sign_data)
+}
+
+// ArchiveTimestamp extends a signed document to PAdES B-LTA, or renews the
+// protection of a B-LTA document before the algorithms or certificates of its
+// most recent document timestamp lose their strength.
+//
+// The validation material of all signatures and document timestamps that is not
+// yet part of the DSS is added first, see AddLTV, after that a document
+// timestamp from the TSA in sign_data is appended over the complete document.
+// Revocation data is collected with the RevocationFunction of sign_data,
+// DefaultEmbedRevocationStatusFunction if nil. Only the TSA, DigestAlgorithm,
+// IssuerFetcher, RevocationFunction and Password fields of sign_data are
+// used.
+func ArchiveTimestamp(input io.ReadSeeker, output io.Writer, sign_data SignData) error {
+	if sign_data.TSA.URL == "" {
+		return fmt.Errorf("archive timestamp requires a TSA URL")
+	}
+	if sign_data.RevocationFunction == nil {
+		sign_data.RevocationFunction = defaultRevocationFunction(signingContext(&sign_data))
+	}
+
+	if _, err := input.Seek(0, 0); err != nil {
+		return err
+	}
+	document, err := io.ReadAll(input)
+	if err != nil {
+		return err
+	}
+
+	document, err = archiveTimestamp(document, sign_data)
+	if err != nil {
+		return err
+	}
+
+	_, err = output.Write(document)
+	return err
+}
+
+func archiveTimestamp(document []byte, sign_data SignData) ([]byte, error) {
+	data, err := missingValidationData(document, sign_data)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > 0 {
+		document, err = appendDSS(document, data, sign_data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add document security store: %w", err)
+		}
+	}
+
+	return timestampDocument(document, sign_data)
+}
+
+// AddLTVFile makes a signed document LTV enabled, see AddLTV.
+func AddLTVFile(input string, output string, sign_data SignData) error {
+	input_file, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = input_file.Close()
+	}()
+
+	output_file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = output_file.Close()
+	}()
+
+	return AddLTV(input_file, output_file, sign_data)
+}
+
+// AddLTV makes an already signed document LTV enabled, so its signatures can
+// be validated after the certificates expire or the revocation services are
+// gone.
+//
+// The validation material of all signatures and document timestamps that is
+// not yet part of the DSS is appended in a new revision, with a VRI entry for
+// each signature. Issuers that are not embedded in a signature are
+// downloaded with the IssuerFetcher of sign_data, revocation data is
+// collected with its RevocationFunction, DefaultEmbedRevocationStatusFunction
+// if nil. Only the IssuerFetcher, RevocationFunction, Password and
+// Deterministic fields of sign_data are used. The document is written
+// unchanged if all signatures have a VRI entry.
+func AddLTV(input io.ReadSeeker, output io.Writer, sign_data SignData) error {
+	if sign_data.RevocationFunction == nil {
+		sign_data.RevocationFunction = defaultRevocationFunction(signingContext(&sign_data))
+	}
+
+	if _, err := input.Seek(0, 0); err != nil {
+		return err
+	}
+	document, err := io.ReadAll(input)
+	if err != nil {
+		return err
+	}
+
+	data, err := missingValidationData(document, sign_data)
+	if err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		document, err = appendDSS(document, data, sign_data)
+		if err != nil {
+			return fmt.Errorf("failed to add document security store: %w", err)
+		}
+	}
+
+	_, err = output.Write(document)
+	return err
+}
+
+// addArchiveTimestamp appends a document timestamp over the output buffer,
+// including the DSS, as required by PAdES baseline-LTA.
+func (context *SignContext) addArchiveTimestamp() error {
+	document, err := timestampDocument(context.OutputBuffer.Buff.Bytes(), context.SignData)
+	if err != nil {
+		return err
+	}
+
+	context.OutputBuffer = filebuffer.New(document)
+	return nil
+}
+
+// timestampDocument appends a document timestamp (ETSI.RFC3161) to the
+// document, the ByteRange of the timestamp covers all existing revisions.
+func timestampDocument(document []byte, sign_data SignData) ([]byte, error) {
+	timestamp_data := timestampOnlySignData(sign_data.TSA)
+	timestamp_data.DigestAlgorithm = sign_data.DigestAlgorithm
+	timestamp_data.Password = sign_data.Password
+	timestamp_data.Context = sign_data.Context
+
+	var output bytes.Buffer
+	err := Sign(bytes.NewReader(document), &output, nil, int64(len(document)), timestamp_data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add document timestamp: %w", err)
+	}
+
+	return output.Bytes(), nil
+}
+
+// missingValidationData returns the validation material, keyed by VRI key, of
+// the signatures and document timestamps that have no VRI entry in the DSS yet.
+func missingValidationData(document []byte, sign_data SignData) (map[string]validationData, error) {
+	rdr, _, err := openDocument(bytes.NewReader(document), nil, int64(len(document)), sign_data.Password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read document: %w", err)
+	}
+
+	root := rdr.Trailer().Key("Root")
+	vri := root.Key("DSS").Key("VRI")
+
+	data := make(map[string]validationData)
+	for _, field := range signatureFields(root.Key("AcroForm").Key("Fields"), "", 0) {
+		contents := []byte(field.Key("V").Key("Contents").RawString())
+		if len(contents) == 0 {
+			continue
+		}
+
+		key := vriKey(contents)
+		if !vri.Key(key).IsNull() {
+			continue
+		}
+
+		certificates, err := signatureCertificates(contents)
+		if err != nil {
+			return nil, err
+		}
+		certificates = completeCertificates(signingContext(&sign_data), certificates, sign_data.IssuerFetcher)
+
+		var info revocation.InfoArchival
+		if sign_data.RevocationFunction != nil {
+			for _, cert := range certificates {
+				if err := sign_data.RevocationFunction(cert, findIssuer(cert, certificates), &info); err != nil {
+					return nil, fmt.Errorf("failed to fetch revocation data: %w", err)
+				}
+			}
+		}
+
+		entry := validationData{
+			Certificates: certificates,
+		}
+		for _, ocsp := range info.OCSP {
+			entry.OCSPs = append(entry.OCSPs, ocsp.FullBytes)
+		}
+		for _, crl := range info.CRL {
+			entry.CRLs = append(entry.CRLs, crl.FullBytes)
+		}
+		data[key] = entry
+	}
+
+	return data, nil
+}
+
+// signatureFields returns the signature fields in fields and their kids, the
+// field type may be inherited from a parent field. depth is the level in the
+// field hierarchy.
+func signatureFields(fields pdf.Value, parentType string, depth int) []pdf.Value {
+	if depth > 32 {
+		return nil
+	}
+	var signatures []pdf.Value
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Index(i)
+		fieldType := parentType
+		if ft := field.Key("FT").Name(); ft != "" {
+			fieldType = ft
+		}
+		if fieldType == "Sig" {
+			signatures = append(signatures, field)
+		}
+		signatures = append(signatures, signatureFields(field.Key("Kids"), fieldType, depth+1)...)
+	}
+	return signatures
+}
+
+// signatureCertificates returns the certificates embedded in a signature, and
+// the certificates of the signature timestamp token if there is one.
+func signatureCertificates(contents []byte) ([]*x509.Certificate, error) {
+	p7, err := pkcs7.Parse(contents)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signature: %w", err)
+	}
+
+	certificates := p7.Certificates
+	for _, s := range p7.Signers {
+		for _, attr := range s.UnauthenticatedAttributes {
+			// RFC 3161 id-aa-timeStampToken
+			if !attr.Type.Equal(asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 14}) {
+				continue
+			}
+
+			token, err := pkcs7.Parse(attr.Value.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse timestamp token: %w", err)
+			}
+			certificates = append(certificates, token.Certificates...)
+		}
+	}
+
+	return certificates, nil
+}
+
+// findIssuer returns the issuer of cert from the given certificates, or nil if
+// it is not included.
+func findIssuer(cert *x509.Certificate, certificates []*x509.Certificate) *x509.Certificate {
+	for _, candidate := range certificates {
+		if candidate != cert && bytes.Equal(candidate.RawSubject, cert.RawIssuer) {
+			return candidate
+		}
+	}
+	return nil
+}
+
+// completeCertificates adds the issuers that are missing from certificates,
+// downloaded by fetcher or DefaultIssuerFetcher. Certificates whose issuers
+// can not be fetched are left incomplete.
+func completeCertificates(ctx context.Context, certificates []*x509.Certificate, fetcher *IssuerFetcher) []*x509.Certificate {
+	if fetcher == nil {
+		fetcher = DefaultIssuerFetcher
+	}
+
+	completed := append([]*x509.Certificate(nil), certificates...)
+	for i := 0; i < len(completed); i++ {
+		cert := completed[i]
+		if bytes.Equal(cert.RawIssuer, cert.RawSubject) || findIssuer(cert, completed) != nil {
+			continue
+		}
+
+		chain, _ := fetcher.CompleteChainContext(ctx, []*x509.Certificate{cert})
+		for _, issuer := range chain[1:] {
+			if !slices.ContainsFunc(completed, issuer.Equal) {
+				completed = append(completed, issuer)
+			}
+		}
+	}
+	return completed
+}
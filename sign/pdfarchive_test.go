@@ -0,0 +1,361 @@
+package sign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"fmt"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/revocation"
+	"github.com/digitorus/pdfsign/verify"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestSignPDFBaselineLTA(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+	tsa := newTestTSA(t)
+
+	tmpfile, err := os.CreateTemp("", t.Name())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer func() {
+		if err := os.Remove(tmpfile.Name()); err != nil {
+			t.Errorf("Failed to remove tmpfile: %v", err)
+		}
+	}()
+
+	err = SignFile("../testfiles/testfile20.pdf", tmpfile.Name(), SignData{
+		Signature: SignDataSignature{
+			Info: SignDataSignatureInfo{
+				Name:   "John Doe",
+				Reason: "PAdES B-LTA",
+				Date:   time.Now().Local(),
+			},
+			CertType:   CertificationSignature,
+			DocMDPPerm: AllowFillingExistingFormFieldsAndSignaturesPerms,
+		},
+		Signer:      pkey,
+		Certificate: cert,
+		TSA: TSA{
+			URL: tsa.URL,
+		},
+		Profile: PAdESBaselineLTA,
+	})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	content, err := os.ReadFile(tmpfile.Name())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	checkArchiveTimestamp(t, content, 2, 1)
+
+	// Renew the archive timestamp, the validation material of the previous
+	// document timestamp must be added to the DSS first.
+	renewed, err := os.CreateTemp("", t.Name())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer func() {
+		if err := os.Remove(renewed.Name()); err != nil {
+			t.Errorf("Failed to remove tmpfile: %v", err)
+		}
+	}()
+
+	err = ArchiveTimestampFile(tmpfile.Name(), renewed.Name(), SignData{
+		TSA: TSA{
+			URL: tsa.URL,
+		},
+	})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	renewedContent, err := os.ReadFile(renewed.Name())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if !bytes.HasPrefix(renewedContent, content) {
+		t.Fatalf("archive timestamp must not modify earlier revisions")
+	}
+	checkArchiveTimestamp(t, renewedContent, 3, 2)
+
+	info, err := verify.VerifyFile(renewed)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if len(info.Signers) != 3 || !info.Signers[0].ValidSignature {
+		t.Fatalf("expected the original signature to remain valid")
+	}
+	for i, signer := range info.Signers[1:] {
+		if signer.SignatureType != "document_timestamp" || !signer.ValidSignature || signer.TimestampError != "" {
+			t.Errorf("expected document timestamp %d to be valid, got %q (%s)", i+1, signer.SignatureType, signer.TimestampError)
+		}
+	}
+	if !info.Signers[0].DocumentTimestampProtected || !info.Signers[1].DocumentTimestampProtected || info.Signers[2].DocumentTimestampProtected {
+		t.Errorf("expected the signature and the first document timestamp to be protected by the last")
+	}
+	chain := info.DocumentTimestamps
+	if chain == nil || chain.Count != 2 || !chain.Valid || chain.ProtectedUntil == nil {
+		t.Errorf("expected a valid chain of 2 document timestamps, got %+v", chain)
+	}
+	// DSS updates and document timestamps are allowed after the signature.
+	if !info.Signers[0].ModifiedAfterSigning || info.Signers[0].DisallowedModifications || info.Signers[0].ModificationError != "" {
+		t.Errorf("expected only allowed modifications after the signature, got %+v (%s)", info.Signers[0].Modifications, info.Signers[0].ModificationError)
+	}
+	if info.Signers[2].ModifiedAfterSigning {
+		t.Errorf("expected no modifications after the last document timestamp")
+	}
+}
+
+func TestArchiveTimestampRequiresTSA(t *testing.T) {
+	err := ArchiveTimestamp(bytes.NewReader(nil), &bytes.Buffer{}, SignData{})
+	if err == nil {
+		t.Fatalf("expected an error without TSA URL")
+	}
+}
+
+func TestAddLTV(t *testing.T) {
+	h := newIssuerHierarchy(t)
+
+	ocspResponse, err := ocsp.CreateResponse(h.intermediate, h.intermediate, ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: h.leaf.SerialNumber,
+		ThisUpdate:   time.Now().Add(-time.Minute),
+		NextUpdate:   time.Now().Add(time.Hour),
+	}, h.intermediateKey)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Minute),
+		NextUpdate: time.Now().Add(time.Hour),
+	}, h.root, h.rootKey)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	// The issuers are not part of the signature, the caIssuers URLs of the
+	// embedded certificate still point to them.
+	leaf := *h.leaf
+	leaf.IssuingCertificateURL = nil
+
+	input, err := os.ReadFile("../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	var signed bytes.Buffer
+	err = Sign(bytes.NewReader(input), &signed, nil, int64(len(input)), SignData{
+		Signature: SignDataSignature{
+			Info: SignDataSignatureInfo{
+				Name: "John Doe",
+				Date: time.Now().Local(),
+			},
+			CertType: ApprovalSignature,
+		},
+		Signer:          h.leafKey,
+		Certificate:     &leaf,
+		DigestAlgorithm: crypto.SHA256,
+	})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	var calls int
+	sign_data := SignData{
+		IssuerFetcher: &IssuerFetcher{HTTPClient: h.server.Client()},
+		RevocationFunction: func(cert, issuer *x509.Certificate, i *revocation.InfoArchival) error {
+			calls++
+			switch {
+			case cert.Equal(h.leaf) && issuer.Equal(h.intermediate):
+				return i.AddOCSP(ocspResponse)
+			case cert.Equal(h.intermediate) && issuer.Equal(h.root):
+				return i.AddCRL(crl)
+			}
+			return nil
+		},
+	}
+
+	var output bytes.Buffer
+	if err := AddLTV(bytes.NewReader(signed.Bytes()), &output, sign_data); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if !bytes.HasPrefix(output.Bytes(), signed.Bytes()) {
+		t.Fatalf("AddLTV must not modify earlier revisions")
+	}
+	if calls != 3 {
+		t.Errorf("expected revocation data for 3 certificates, got %d", calls)
+	}
+
+	rdr, err := pdf.NewReader(bytes.NewReader(output.Bytes()), int64(output.Len()))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	root := rdr.Trailer().Key("Root")
+	contents := root.Key("AcroForm").Key("Fields").Index(0).Key("V").Key("Contents").RawString()
+	vri := root.Key("DSS").Key("VRI").Key(vriKey([]byte(contents)))
+	if vri.IsNull() {
+		t.Fatalf("expected a VRI entry for the signature")
+	}
+	if certs, ocsps, crls := vri.Key("Cert").Len(), vri.Key("OCSP").Len(), vri.Key("CRL").Len(); certs != 3 || ocsps != 1 || crls != 1 {
+		t.Errorf("expected 3 certificates, an OCSP response and a CRL, got %d, %d and %d", certs, ocsps, crls)
+	}
+	if certs := root.Key("DSS").Key("Certs").Len(); certs != 3 {
+		t.Errorf("expected the completed chain in the DSS, got %d certificates", certs)
+	}
+
+	info, err := verify.Verify(bytes.NewReader(output.Bytes()), int64(output.Len()))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if len(info.Signers) != 1 || !info.Signers[0].ValidSignature {
+		t.Fatalf("expected the signature to remain valid")
+	}
+	// The chain and its revocation data are taken from the DSS.
+	if !info.Signers[0].LTVEnabled {
+		t.Errorf("expected the signature to be LTV enabled: %s", info.Signers[0].LTVError)
+	}
+	if info.Signers[0].DisallowedModifications || len(info.Signers[0].Modifications) == 0 {
+		t.Errorf("expected the DSS update to be an allowed modification, got %+v (%s)", info.Signers[0].Modifications, info.Signers[0].ModificationError)
+	}
+	for _, m := range info.Signers[0].Modifications {
+		if m.Type != "dss" {
+			t.Errorf("expected only DSS modifications, got %s of %s", m.Type, m.Object)
+		}
+	}
+	for _, certificate := range info.Signers[0].Certificates {
+		if certificate.Certificate.Equal(h.leaf) && (!certificate.OCSPEmbedded || certificate.OCSPStatus != "good") {
+			t.Errorf("expected the OCSP response of the DSS for the signing certificate")
+		}
+	}
+	before, err := verify.Verify(bytes.NewReader(signed.Bytes()), int64(signed.Len()))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if len(before.Signers) != 1 || before.Signers[0].LTVEnabled || before.Signers[0].LTVError == "" {
+		t.Errorf("expected the signature without a DSS not to be LTV enabled")
+	}
+
+	// Documents that are LTV enabled are not changed.
+	var unchanged bytes.Buffer
+	calls = 0
+	if err := AddLTV(bytes.NewReader(output.Bytes()), &unchanged, sign_data); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if !bytes.Equal(unchanged.Bytes(), output.Bytes()) || calls != 0 {
+		t.Errorf("expected the LTV enabled document to be unchanged")
+	}
+}
+
+// checkArchiveTimestamp checks that the last signature field of the document is
+// a document timestamp covering the complete file.
+func checkArchiveTimestamp(t *testing.T, content []byte, fields, vris int) {
+	t.Helper()
+
+	rdr, err := pdf.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	root := rdr.Trailer().Key("Root")
+	if n := len(root.Key("DSS").Key("VRI").Keys()); n != vris {
+		t.Errorf("expected %d VRI entries, got %d", vris, n)
+	}
+
+	sigFields := root.Key("AcroForm").Key("Fields")
+	if sigFields.Len() != fields {
+		t.Fatalf("expected %d signature fields, got %d", fields, sigFields.Len())
+	}
+
+	v := sigFields.Index(sigFields.Len() - 1).Key("V")
+	if v.Key("Type").Name() != "DocTimeStamp" {
+		t.Fatalf("expected the last signature to be a document timestamp, got %q", v.Key("Type").Name())
+	}
+
+	byteRange := v.Key("ByteRange")
+	end := byteRange.Index(2).Int64() + byteRange.Index(3).Int64()
+	if end != int64(len(content)) {
+		t.Errorf("document timestamp covers %d bytes, file has %d", end, len(content))
+	}
+}
+
+func TestAddLTVNestedField(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	// The signature field is a kid of a field that declares the field type.
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R /AcroForm << /Fields [4 0 R] >> >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Annots [5 0 R] >>",
+		"<< /FT /Sig /T (Form) /Kids [5 0 R] >>",
+		"<< /Type /Annot /Subtype /Widget /T (Approver) /Parent 4 0 R /P 3 0 R /Rect [0 0 0 0] /F 132 >>",
+	}
+	input := []byte("%PDF-1.7\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = len(input)
+		input = fmt.Appendf(input, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := len(input)
+	input = fmt.Appendf(input, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		input = fmt.Appendf(input, "%010d 00000 n \n", offset)
+	}
+	input = fmt.Appendf(input, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	var signed bytes.Buffer
+	err := Sign(bytes.NewReader(input), &signed, nil, int64(len(input)), SignData{
+		Signature: SignDataSignature{
+			Info: SignDataSignatureInfo{
+				Name: "John Doe",
+				Date: time.Now().Local(),
+			},
+			CertType: ApprovalSignature,
+		},
+		Signer:          pkey,
+		Certificate:     cert,
+		DigestAlgorithm: crypto.SHA256,
+		FieldName:       "Form.Approver",
+	})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	var calls int
+	var output bytes.Buffer
+	err = AddLTV(bytes.NewReader(signed.Bytes()), &output, SignData{
+		IssuerFetcher: &IssuerFetcher{},
+		RevocationFunction: func(cert, issuer *x509.Certificate, i *revocation.InfoArchival) error {
+			calls++
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if calls == 0 {
+		t.Errorf("expected revocation data to be collected for the nested signature")
+	}
+
+	rdr, err := pdf.NewReader(bytes.NewReader(output.Bytes()), int64(output.Len()))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	root := rdr.Trailer().Key("Root")
+	contents := root.Key("AcroForm").Key("Fields").Index(0).Key("Kids").Index(0).Key("V").Key("Contents").RawString()
+	if contents == "" {
+		t.Fatalf("expected the signature in the kid of the field")
+	}
+	if root.Key("DSS").Key("VRI").Key(vriKey([]byte(contents))).IsNull() {
+		t.Errorf("expected a VRI entry for the nested signature")
+	}
+}
@@ -11,37 +11,42 @@ func (context *SignContext) updateByteRange() error {
 		return err
 	}
 
-	// Set ByteRangeValues by looking for the /Contents< filled with zeros
-	contentsPlaceholder := bytes.Repeat([]byte("0"), int(context.SignatureMaxLength))
-	contentsIndex := bytes.Index(context.OutputBuffer.Buff.Bytes(), contentsPlaceholder)
+	// Set ByteRangeValues by looking for the /Contents< filled with zeros.
+	// The zero padding of the Contents of earlier signatures can be longer
+	// than the placeholder, the placeholder of the new revision is the last
+	// one that is delimited. The buffer holds the incremental update that
+	// follows the input.
+	contentsPlaceholder := append(append([]byte("<"), bytes.Repeat([]byte("0"), int(context.SignatureMaxLength))...), '>')
+	contentsIndex := bytes.LastIndex(context.OutputBuffer.Buff.Bytes(), contentsPlaceholder)
 	if contentsIndex == -1 {
 		return fmt.Errorf("failed to find contents placeholder")
 	}
 
 	// Calculate ByteRangeValues
-	signatureContentsStart := int64(contentsIndex) - 1
+	signatureContentsStart := context.inputLength + int64(contentsIndex)
 	signatureContentsEnd := signatureContentsStart + int64(context.SignatureMaxLength) + 2
 	context.ByteRangeValues = []int64{
 		0,
 		signatureContentsStart,
 		signatureContentsEnd,
-		int64(context.OutputBuffer.Buff.Len()) - signatureContentsEnd,
+		context.outputLength() - signatureContentsEnd,
 	}
 
 	new_byte_range := fmt.Sprintf("/ByteRange [%d %d %d %d]", context.ByteRangeValues[0], context.ByteRangeValues[1], context.ByteRangeValues[2], context.ByteRangeValues[3])
 
-	// Make sure our ByteRange string has the same length as the placeholder.
-	if len(new_byte_range) < len(signatureByteRangePlaceholder) {
-		new_byte_range += strings.Repeat(" ", len(signatureByteRangePlaceholder)-len(new_byte_range))
-	} else if len(new_byte_range) != len(signatureByteRangePlaceholder) {
-		return fmt.Errorf("new byte range string is the same lenght as the placeholder")
-	}
-
 	// Find the placeholder in the buffer
-	placeholderIndex := bytes.Index(context.OutputBuffer.Buff.Bytes(), []byte(signatureByteRangePlaceholder))
-	if placeholderIndex == -1 {
+	placeholder := byteRangePlaceholderPattern.FindIndex(context.OutputBuffer.Buff.Bytes())
+	if placeholder == nil {
 		return fmt.Errorf("failed to find ByteRange placeholder")
 	}
+	placeholderIndex, placeholderLength := placeholder[0], placeholder[1]-placeholder[0]
+
+	// Make sure our ByteRange string has the same length as the placeholder.
+	if len(new_byte_range) < placeholderLength {
+		new_byte_range += strings.Repeat(" ", placeholderLength-len(new_byte_range))
+	} else if len(new_byte_range) != placeholderLength {
+		return fmt.Errorf("new byte range string is longer than the placeholder")
+	}
 
 	// Replace the placeholder with the new byte range
 	bufferBytes := context.OutputBuffer.Buff.Bytes()
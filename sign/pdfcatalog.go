@@ -29,41 +29,120 @@ func (context *SignContext) createCatalog() ([]byte, error) {
 	//
 	// If an incremental upgrade requires a version that is higher than specified by the document.
 	// Ensure PDF version is at least 1.5 to support SigFlags in acroFormDict (1.4) and UF in the fileSpecDict (1.5)
-	if v, err := strconv.ParseFloat(context.PDFReader.PDFVersion, 64); err == nil && v < 1.5 {
-		catalog_buffer.WriteString("  /Version /1.5\n")
+	// or 2.0 when PDF 2.0 features are allowed.
+	root := context.PDFReader.Trailer().Key("Root")
+	version, required := context.documentVersion(root), "1.5"
+	if context.SignData.PDF20 {
+		required = "2.0"
+	}
+	writeVersion := false
+	if v, err := strconv.ParseFloat(required, 64); err == nil && version < v {
+		catalog_buffer.WriteString("  /Version /" + required + "\n")
+		writeVersion = true
 	}
 
-	// Retrieve the root, its pointer and set the root string
-	root := context.PDFReader.Trailer().Key("Root")
+	// ISO/TS 32002 signature algorithms are announced with a developer
+	// extension, unless the document already has one.
+	writeExtensions := context.usesISO32002() && !hasISO32002Extension(root.Key("Extensions"))
+
+	// Retrieve the root pointer and set the root string
 	rootPtr := root.GetPtr()
 	context.CatalogData.RootString = strconv.Itoa(int(rootPtr.GetID())) + " " + strconv.Itoa(int(rootPtr.GetGen())) + " R"
 
-	// Copy over existing catalog entries except for type and AcroForum
+	// Copy over existing catalog entries except for type and AcroForum, and
+	// the entries that are replaced in this revision.
 	for _, key := range root.Keys() {
-		if key != "Type" && key != "AcroForm" {
-			_, _ = fmt.Fprintf(&catalog_buffer, "  /%s ", key)
-			context.serializeCatalogEntry(&catalog_buffer, rootPtr.GetID(), root.Key(key))
+		switch {
+		case key == "Type" || key == "AcroForm":
+			continue
+		case key == "Version" && writeVersion:
+			continue
+		case key == "Extensions" && writeExtensions:
+			continue
+		case key == "DSS" && context.dssObjectId != 0:
+			continue
+		case key == "Perms" && context.SignData.Signature.CertType == CertificationSignature:
+			continue
+		}
+
+		_, _ = fmt.Fprintf(&catalog_buffer, "  /%s ", key)
+		context.serializeCatalogEntry(&catalog_buffer, rootPtr.GetID(), root.Key(key))
+		catalog_buffer.WriteString("\n")
+	}
+
+	// (Optional; PDF 1.5) A permissions dictionary that specifies user access
+	// permissions for the document (see 12.8.6, "Permissions"). The DocMDP
+	// entry shall be an indirect reference to the signature dictionary of the
+	// certification signature, this is what makes a signature a certification
+	// signature for PDF processors.
+	if context.SignData.Signature.CertType == CertificationSignature {
+		catalog_buffer.WriteString("  /Perms <<")
+		if perms := root.Key("Perms"); !perms.IsNull() {
+			for _, key := range perms.Keys() {
+				if key == "DocMDP" {
+					continue
+				}
+				_, _ = fmt.Fprintf(&catalog_buffer, " /%s ", key)
+				context.serializeCatalogEntry(&catalog_buffer, rootPtr.GetID(), perms.Key(key))
+			}
+		}
+		catalog_buffer.WriteString(" /DocMDP " + strconv.Itoa(int(context.SignData.objectId)) + " 0 R >>\n")
+	}
+
+	if writeExtensions {
+		context.writeISO32002Extension(&catalog_buffer, root.Key("Extensions"))
+	}
+
+	if context.dssObjectId != 0 {
+		catalog_buffer.WriteString("  /DSS " + strconv.Itoa(int(context.dssObjectId)) + " 0 R\n")
+	}
+
+	// Revisions without a new signature field, such as a DSS update, keep the
+	// existing AcroForm unchanged.
+	if context.VisualSignData.objectId == 0 && len(context.preparedFields) == 0 {
+		if acroForm := root.Key("AcroForm"); !acroForm.IsNull() {
+			catalog_buffer.WriteString("  /AcroForm ")
+			context.serializeCatalogEntry(&catalog_buffer, rootPtr.GetID(), acroForm)
 			catalog_buffer.WriteString("\n")
 		}
+		catalog_buffer.WriteString(">>\n")
+		return catalog_buffer.Bytes(), nil
 	}
 
 	// Start the AcroForm dictionary with /NeedAppearances
 	catalog_buffer.WriteString("  /AcroForm <<\n")
-	catalog_buffer.WriteString("    /Fields [")
 
-	// Add existing signatures to the AcroForm dictionary
-	for i, sig := range context.existingSignatures {
-		if i > 0 {
-			catalog_buffer.WriteString(" ")
+	// Copy over the existing AcroForm entries, such as the default resources
+	// and appearance, so earlier revisions are left as they are.
+	acroForm := root.Key("AcroForm")
+	acroFormPtr := acroForm.GetPtr()
+	for _, key := range acroForm.Keys() {
+		// Revisions without a signature keep the existing signature flags.
+		if key == "Fields" || (key == "SigFlags" && context.SignData.Signature.CertType != 0) {
+			continue
 		}
-		catalog_buffer.WriteString(strconv.Itoa(int(sig.objectId)) + " 0 R")
+		_, _ = fmt.Fprintf(&catalog_buffer, "    /%s ", key)
+		context.serializeCatalogEntry(&catalog_buffer, acroFormPtr.GetID(), acroForm.Key(key))
+		catalog_buffer.WriteString("\n")
+	}
+
+	catalog_buffer.WriteString("    /Fields [")
+
+	// Keep all existing fields, including signatures and other form fields.
+	fields := acroForm.Key("Fields")
+	for i := 0; i < fields.Len(); i++ {
+		ptr := fields.Index(i).GetPtr()
+		_, _ = fmt.Fprintf(&catalog_buffer, "%d %d R ", ptr.GetID(), ptr.GetGen())
+	}
+
+	for _, id := range context.preparedFields {
+		catalog_buffer.WriteString(strconv.Itoa(int(id)) + " 0 R ")
 	}
 
 	// Add the visual signature field to the AcroForm dictionary
-	if len(context.existingSignatures) > 0 {
-		catalog_buffer.WriteString(" ")
+	if context.VisualSignData.objectId != 0 && !context.VisualSignData.existingField {
+		catalog_buffer.WriteString(strconv.Itoa(int(context.VisualSignData.objectId)) + " 0 R")
 	}
-	catalog_buffer.WriteString(strconv.Itoa(int(context.VisualSignData.objectId)) + " 0 R")
 
 	catalog_buffer.WriteString("]\n") // close Fields array
 
@@ -115,6 +194,61 @@ func (context *SignContext) createCatalog() ([]byte, error) {
 	return catalog_buffer.Bytes(), nil
 }
 
+// documentVersion returns the version of the document, which is the later of
+// the version in the header and the Version entry of the catalog.
+func (context *SignContext) documentVersion(root pdf.Value) float64 {
+	version, _ := strconv.ParseFloat(context.PDFReader.PDFVersion, 64)
+	if v, err := strconv.ParseFloat(root.Key("Version").Name(), 64); err == nil && v > version {
+		version = v
+	}
+	return version
+}
+
+// hasISO32002Extension reports whether the extensions dictionary contains the
+// ISO_ developer extension for ISO/TS 32002.
+func hasISO32002Extension(extensions pdf.Value) bool {
+	iso := extensions.Key("ISO_")
+	if iso.Kind() == pdf.Dict {
+		return iso.Key("ExtensionLevel").Int64() == 32002
+	}
+	for i := 0; i < iso.Len(); i++ {
+		if iso.Index(i).Key("ExtensionLevel").Int64() == 32002 {
+			return true
+		}
+	}
+	return false
+}
+
+// writeISO32002Extension writes the catalog Extensions entry (see 7.12,
+// "Extensions dictionary") with the existing extensions and the ISO/TS 32002
+// extension added to the ISO_ extensions.
+func (context *SignContext) writeISO32002Extension(w *bytes.Buffer, extensions pdf.Value) {
+	extensionsPtr := extensions.GetPtr()
+
+	w.WriteString("  /Extensions <<")
+	for _, key := range extensions.Keys() {
+		if key == "ISO_" {
+			continue
+		}
+		_, _ = fmt.Fprintf(w, " /%s ", key)
+		context.serializeCatalogEntry(w, extensionsPtr.GetID(), extensions.Key(key))
+	}
+
+	w.WriteString(" /ISO_ [")
+	iso := extensions.Key("ISO_")
+	if iso.Kind() == pdf.Dict {
+		context.serializeCatalogEntry(w, extensionsPtr.GetID(), iso)
+		w.WriteString(" ")
+	} else {
+		isoPtr := iso.GetPtr()
+		for i := 0; i < iso.Len(); i++ {
+			context.serializeCatalogEntry(w, isoPtr.GetID(), iso.Index(i))
+			w.WriteString(" ")
+		}
+	}
+	w.WriteString("<< /Type /DeveloperExtensions /BaseVersion /2.0 /ExtensionLevel 32002 >>] >>\n")
+}
+
 // serializeCatalogEntry takes a pdf.Value and serializes it to the given writer.
 func (context *SignContext) serializeCatalogEntry(w io.Writer, rootObjId uint32, value pdf.Value) {
 	if ptr := value.GetPtr(); ptr.GetID() != rootObjId {
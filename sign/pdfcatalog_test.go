@@ -1,8 +1,10 @@
 package sign
 
 import (
+	"bytes"
 	"fmt"
 	"os"
+	"strconv"
 	"testing"
 
 	"github.com/digitorus/pdf"
@@ -15,7 +17,7 @@ var testFiles = []struct {
 	{
 		file: "../testfiles/testfile20.pdf",
 		expectedCatalogs: map[CertType]string{
-			CertificationSignature: "<<\n  /Type /Catalog\n  /Metadata 2 0 R\n  /Pages 3 0 R\n  /AcroForm <<\n    /Fields [10 0 R]\n    /SigFlags 3\n  >>\n>>\n",
+			CertificationSignature: "<<\n  /Type /Catalog\n  /Metadata 2 0 R\n  /Pages 3 0 R\n  /Perms << /DocMDP 9 0 R >>\n  /AcroForm <<\n    /Fields [10 0 R]\n    /SigFlags 3\n  >>\n>>\n",
 			UsageRightsSignature:   "<<\n  /Type /Catalog\n  /Metadata 2 0 R\n  /Pages 3 0 R\n  /AcroForm <<\n    /Fields [10 0 R]\n    /SigFlags 1\n  >>\n>>\n",
 			ApprovalSignature:      "<<\n  /Type /Catalog\n  /Metadata 2 0 R\n  /Pages 3 0 R\n  /AcroForm <<\n    /Fields [10 0 R]\n    /SigFlags 3\n  >>\n>>\n",
 		},
@@ -23,7 +25,7 @@ var testFiles = []struct {
 	{
 		file: "../testfiles/testfile12.pdf",
 		expectedCatalogs: map[CertType]string{
-			CertificationSignature: "<<\n  /Type /Catalog\n  /Version /1.5\n  /Outlines 2 0 R\n  /Pages 3 0 R\n  /AcroForm <<\n    /Fields [16 0 R]\n    /SigFlags 3\n  >>\n>>\n",
+			CertificationSignature: "<<\n  /Type /Catalog\n  /Version /1.5\n  /Outlines 2 0 R\n  /Pages 3 0 R\n  /Perms << /DocMDP 15 0 R >>\n  /AcroForm <<\n    /Fields [16 0 R]\n    /SigFlags 3\n  >>\n>>\n",
 			UsageRightsSignature:   "<<\n  /Type /Catalog\n  /Version /1.5\n  /Outlines 2 0 R\n  /Pages 3 0 R\n  /AcroForm <<\n    /Fields [16 0 R]\n    /SigFlags 1\n  >>\n>>\n",
 			ApprovalSignature:      "<<\n  /Type /Catalog\n  /Version /1.5\n  /Outlines 2 0 R\n  /Pages 3 0 R\n  /AcroForm <<\n    /Fields [16 0 R]\n    /SigFlags 3\n  >>\n>>\n",
 		},
@@ -64,6 +66,7 @@ func TestCreateCatalog(t *testing.T) {
 							CertType:   certType,
 							DocMDPPerm: AllowFillingExistingFormFieldsAndSignaturesPerms,
 						},
+						objectId: uint32(rdr.XrefInformation.ItemCount) - 1,
 					},
 				}
 
@@ -80,3 +83,29 @@ func TestCreateCatalog(t *testing.T) {
 		}
 	}
 }
+
+func TestWriteISO32002Extension(t *testing.T) {
+	object := []byte("1 0 obj\n<< /ADBE << /BaseVersion /1.7 /ExtensionLevel 8 >> /ISO_ << /BaseVersion /2.0 /ExtensionLevel 32001 >> >>\nendobj\n")
+	document := append([]byte("%PDF-2.0\n"), object...)
+	xref := len(document)
+	document = append(document, []byte("xref\n0 2\n0000000000 65535 f \n0000000009 00000 n \ntrailer\n<< /Size 2 /Extensions 1 0 R >>\nstartxref\n")...)
+	document = append(document, []byte(strconv.Itoa(xref)+"\n%%EOF\n")...)
+
+	rdr, err := pdf.NewReader(bytes.NewReader(document), int64(len(document)))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	extensions := rdr.Trailer().Key("Extensions")
+	if hasISO32002Extension(extensions) {
+		t.Fatalf("did not expect the ISO/TS 32002 extension")
+	}
+
+	context := SignContext{PDFReader: rdr}
+	var buffer bytes.Buffer
+	context.writeISO32002Extension(&buffer, extensions)
+
+	expected := "  /Extensions << /ADBE <</BaseVersion /1.7 /ExtensionLevel 8>> /ISO_ [<</BaseVersion /2.0 /ExtensionLevel 32001>> << /Type /DeveloperExtensions /BaseVersion /2.0 /ExtensionLevel 32002 >>] >>\n"
+	if buffer.String() != expected {
+		t.Errorf("unexpected extensions\nexpected: %q\ngot:      %q", expected, buffer.String())
+	}
+}
@@ -0,0 +1,359 @@
+package sign
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/digitorus/pdf"
+	"github.com/mattetti/filebuffer"
+)
+
+// validationData is the material that is written into the Document Security
+// Store (DSS) for a single signature, see ETSI EN 319 142-1, 5.4.
+type validationData struct {
+	Certificates []*x509.Certificate
+	OCSPs        [][]byte
+	CRLs         [][]byte
+}
+
+// dssRefs keeps track of the object references of the validation material in
+// a DSS dictionary, either copied from a previous revision or newly written.
+type dssRefs struct {
+	certs []string
+	ocsps []string
+	crls  []string
+
+	// vri maps the uppercase hex encoded SHA-1 hash of a signature's /Contents
+	// to its serialized VRI dictionary.
+	vri map[string]string
+}
+
+// newIncrementalContext prepares a context that appends a new revision to the
+// given document, without modifying any of the existing bytes. The Password
+// and Deterministic fields of sign_data apply to encrypted documents.
+func newIncrementalContext(document []byte, sign_data SignData) (*SignContext, error) {
+	input := bytes.NewReader(document)
+	rdr, security, err := openDocument(input, nil, int64(len(document)), sign_data.Password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read document: %w", err)
+	}
+	if security != nil {
+		security.deterministic = sign_data.Deterministic
+	}
+
+	context := &SignContext{
+		PDFReader:    rdr,
+		InputFile:    input,
+		OutputBuffer: filebuffer.New([]byte{}),
+		security:     security,
+	}
+
+	existingSignatures, err := context.fetchExistingSignatures()
+	if err != nil {
+		return nil, err
+	}
+	context.existingSignatures = existingSignatures
+
+	if _, err := context.OutputBuffer.Write(document); err != nil {
+		return nil, err
+	}
+
+	// File always needs an empty line after %%EOF.
+	if _, err := context.OutputBuffer.Write([]byte("\n")); err != nil {
+		return nil, err
+	}
+
+	return context, nil
+}
+
+// finishIncrementalUpdate writes the catalog, cross-reference section and
+// trailer of an incremental update started with newIncrementalContext.
+func (context *SignContext) finishIncrementalUpdate() ([]byte, error) {
+	catalog, err := context.createCatalog()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create catalog: %w", err)
+	}
+
+	context.CatalogData.ObjectId, err = context.addObject(catalog)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add catalog object: %w", err)
+	}
+
+	if err := context.writeXref(); err != nil {
+		return nil, fmt.Errorf("failed to write xref: %w", err)
+	}
+
+	if err := context.writeTrailer(); err != nil {
+		return nil, fmt.Errorf("failed to write trailer: %w", err)
+	}
+
+	return context.OutputBuffer.Buff.Bytes(), nil
+}
+
+// vriKey returns the key of the VRI dictionary entry for a signature, this is
+// the uppercase base-16 encoded SHA-1 digest of the signature /Contents.
+func vriKey(contents []byte) string {
+	hash := sha1.Sum(contents)
+	return strings.ToUpper(hex.EncodeToString(hash[:]))
+}
+
+// signatureContents returns the raw (decoded) value of the /Contents entry of
+// the signature that was just written to the output buffer.
+func (context *SignContext) signatureContents() ([]byte, error) {
+	file_content := context.OutputBuffer.Buff.Bytes()
+
+	// The ByteRange hole includes the < and > delimiters of the hex string.
+	hexContents := file_content[context.ByteRangeValues[1]+1 : context.ByteRangeValues[2]-1]
+
+	contents := make([]byte, hex.DecodedLen(len(hexContents)))
+	if _, err := hex.Decode(contents, hexContents); err != nil {
+		return nil, fmt.Errorf("failed to decode signature contents: %w", err)
+	}
+
+	return contents, nil
+}
+
+// collectValidationData gathers the certificates and revocation information
+// that is needed to validate the signature created by this context.
+func (context *SignContext) collectValidationData() validationData {
+	var data validationData
+
+	if len(context.SignData.CertificateChains) > 0 && len(context.SignData.CertificateChains[0]) > 0 {
+		data.Certificates = append(data.Certificates, context.SignData.CertificateChains[0]...)
+	} else if context.SignData.Certificate != nil {
+		data.Certificates = append(data.Certificates, context.SignData.Certificate)
+	}
+	data.Certificates = append(data.Certificates, context.timestampCertificates...)
+
+	for _, ocsp := range context.SignData.RevocationData.OCSP {
+		data.OCSPs = append(data.OCSPs, ocsp.FullBytes)
+	}
+	for _, crl := range context.SignData.RevocationData.CRL {
+		data.CRLs = append(data.CRLs, crl.FullBytes)
+	}
+
+	return data
+}
+
+// hasRevocationData reports whether revocation data was collected for the
+// signature.
+func (context *SignContext) hasRevocationData() bool {
+	return len(context.SignData.RevocationData.OCSP) > 0 || len(context.SignData.RevocationData.CRL) > 0
+}
+
+// addValidationInfo appends a new revision to the output buffer that contains
+// a DSS dictionary with the validation material for the signature that was just
+// created.
+func (context *SignContext) addValidationInfo() error {
+	contents, err := context.signatureContents()
+	if err != nil {
+		return err
+	}
+
+	document, err := appendDSS(context.OutputBuffer.Buff.Bytes(), map[string]validationData{
+		vriKey(contents): context.collectValidationData(),
+	}, context.SignData)
+	if err != nil {
+		return fmt.Errorf("failed to add document security store: %w", err)
+	}
+
+	context.OutputBuffer = filebuffer.New(document)
+	return nil
+}
+
+// appendDSS appends an incremental update to the document that adds the given
+// validation material, keyed by VRI key, to the Document Security Store.
+// Existing DSS entries are preserved.
+func appendDSS(document []byte, data map[string]validationData, sign_data SignData) ([]byte, error) {
+	context, err := newIncrementalContext(document, sign_data)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := context.existingDSSRefs()
+
+	// Sort the keys so that the output is stable.
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// Validation material that is shared between signatures is only written once.
+	written := make(map[string]string)
+	addStream := func(content []byte) (string, error) {
+		hash := sha1.Sum(content)
+		if ref, ok := written[string(hash[:])]; ok {
+			return ref, nil
+		}
+
+		id, err := context.addObject(createDSSStream(content))
+		if err != nil {
+			return "", err
+		}
+
+		ref := strconv.Itoa(int(id)) + " 0 R"
+		written[string(hash[:])] = ref
+		return ref, nil
+	}
+
+	for _, key := range keys {
+		var vriCerts, vriOCSPs, vriCRLs []string
+
+		for _, cert := range data[key].Certificates {
+			ref, err := addStream(cert.Raw)
+			if err != nil {
+				return nil, fmt.Errorf("failed to add certificate: %w", err)
+			}
+			vriCerts = appendUnique(vriCerts, ref)
+			refs.certs = appendUnique(refs.certs, ref)
+		}
+		for _, ocsp := range data[key].OCSPs {
+			ref, err := addStream(ocsp)
+			if err != nil {
+				return nil, fmt.Errorf("failed to add OCSP response: %w", err)
+			}
+			vriOCSPs = appendUnique(vriOCSPs, ref)
+			refs.ocsps = appendUnique(refs.ocsps, ref)
+		}
+		for _, crl := range data[key].CRLs {
+			ref, err := addStream(crl)
+			if err != nil {
+				return nil, fmt.Errorf("failed to add CRL: %w", err)
+			}
+			vriCRLs = appendUnique(vriCRLs, ref)
+			refs.crls = appendUnique(refs.crls, ref)
+		}
+
+		refs.vri[key] = createVRIDictionary(vriCerts, vriOCSPs, vriCRLs)
+	}
+
+	context.dssObjectId, err = context.addObject(createDSSDictionary(refs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to add DSS object: %w", err)
+	}
+
+	return context.finishIncrementalUpdate()
+}
+
+// existingDSSRefs copies the references of a DSS dictionary in the current
+// revision, if any.
+func (context *SignContext) existingDSSRefs() dssRefs {
+	refs := dssRefs{
+		vri: make(map[string]string),
+	}
+
+	dss := context.PDFReader.Trailer().Key("Root").Key("DSS")
+	if dss.IsNull() {
+		return refs
+	}
+
+	refs.certs = collectReferences(dss.Key("Certs"))
+	refs.ocsps = collectReferences(dss.Key("OCSPs"))
+	refs.crls = collectReferences(dss.Key("CRLs"))
+
+	vri := dss.Key("VRI")
+	for _, key := range vri.Keys() {
+		var buffer bytes.Buffer
+		entry := vri.Key(key)
+		entryPtr := entry.GetPtr()
+		context.serializeCatalogEntry(&buffer, entryPtr.GetID(), entry)
+		refs.vri[strings.ToUpper(key)] = buffer.String()
+	}
+
+	return refs
+}
+
+// collectReferences returns the indirect references contained in an array.
+func collectReferences(array pdf.Value) []string {
+	var refs []string
+	for i := 0; i < array.Len(); i++ {
+		ptr := array.Index(i).GetPtr()
+		refs = append(refs, fmt.Sprintf("%d %d R", ptr.GetID(), ptr.GetGen()))
+	}
+	return refs
+}
+
+func appendUnique(list []string, value string) []string {
+	for _, v := range list {
+		if v == value {
+			return list
+		}
+	}
+	return append(list, value)
+}
+
+func createDSSStream(content []byte) []byte {
+	var buffer bytes.Buffer
+
+	compressed := compressData(content)
+
+	buffer.WriteString("<<\n")
+	buffer.WriteString("  /Filter /FlateDecode\n")
+	fmt.Fprintf(&buffer, "  /Length %d\n", len(compressed))
+	buffer.WriteString(">>\n")
+	buffer.WriteString("stream\n")
+	buffer.Write(compressed)
+	buffer.WriteString("\nendstream\n")
+
+	return buffer.Bytes()
+}
+
+func createVRIDictionary(certs, ocsps, crls []string) string {
+	var buffer bytes.Buffer
+
+	buffer.WriteString("<<")
+	if len(certs) > 0 {
+		buffer.WriteString(" /Cert [" + strings.Join(certs, " ") + "]")
+	}
+	if len(ocsps) > 0 {
+		buffer.WriteString(" /OCSP [" + strings.Join(ocsps, " ") + "]")
+	}
+	if len(crls) > 0 {
+		buffer.WriteString(" /CRL [" + strings.Join(crls, " ") + "]")
+	}
+	buffer.WriteString(" >>")
+
+	return buffer.String()
+}
+
+func createDSSDictionary(refs dssRefs) []byte {
+	var buffer bytes.Buffer
+
+	buffer.WriteString("<<\n")
+	buffer.WriteString("  /Type /DSS\n")
+
+	if len(refs.certs) > 0 {
+		buffer.WriteString("  /Certs [" + strings.Join(refs.certs, " ") + "]\n")
+	}
+	if len(refs.ocsps) > 0 {
+		buffer.WriteString("  /OCSPs [" + strings.Join(refs.ocsps, " ") + "]\n")
+	}
+	if len(refs.crls) > 0 {
+		buffer.WriteString("  /CRLs [" + strings.Join(refs.crls, " ") + "]\n")
+	}
+
+	if len(refs.vri) > 0 {
+		keys := make([]string, 0, len(refs.vri))
+		for key := range refs.vri {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		buffer.WriteString("  /VRI <<\n")
+		for _, key := range keys {
+			buffer.WriteString("    /" + key + " " + refs.vri[key] + "\n")
+		}
+		buffer.WriteString("  >>\n")
+	}
+
+	buffer.WriteString(">>\n")
+
+	return buffer.Bytes()
+}
@@ -0,0 +1,175 @@
+package sign
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/asn1"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/revocation"
+	"github.com/digitorus/pdfsign/verify"
+)
+
+func TestSignPDFBaselineLT(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+	tsa := newTestTSA(t)
+
+	// Use a locally created CRL so the test does not depend on the network.
+	issuer := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      cert.Issuer,
+		KeyUsage:     x509.KeyUsageCRLSign,
+		SubjectKeyId: []byte{1, 2, 3, 4},
+	}
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Hour),
+		NextUpdate: time.Now().Add(time.Hour),
+	}, issuer, pkey)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	tmpfile, err := os.CreateTemp("", t.Name())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer func() {
+		if err := os.Remove(tmpfile.Name()); err != nil {
+			t.Errorf("Failed to remove tmpfile: %v", err)
+		}
+	}()
+
+	err = SignFile("../testfiles/testfile20.pdf", tmpfile.Name(), SignData{
+		Signature: SignDataSignature{
+			Info: SignDataSignatureInfo{
+				Name:   "John Doe",
+				Reason: "PAdES B-LT",
+				Date:   time.Now().Local(),
+			},
+			CertType:   CertificationSignature,
+			DocMDPPerm: AllowFillingExistingFormFieldsAndSignaturesPerms,
+		},
+		Signer:            pkey,
+		Certificate:       cert,
+		CertificateChains: [][]*x509.Certificate{{cert}},
+		TSA: TSA{
+			URL: tsa.URL,
+		},
+		RevocationFunction: func(cert, issuer *x509.Certificate, i *revocation.InfoArchival) error {
+			return i.AddCRL(crl)
+		},
+		Profile: PAdESBaselineLT,
+	})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	content, err := os.ReadFile(tmpfile.Name())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	rdr, err := pdf.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	dss := rdr.Trailer().Key("Root").Key("DSS")
+	if dss.IsNull() {
+		t.Fatalf("expected a DSS dictionary in the catalog")
+	}
+	if dss.Key("Certs").Len() != 2 {
+		t.Errorf("expected signer and TSA certificate in DSS, got %d", dss.Key("Certs").Len())
+	}
+	if dss.Key("CRLs").Len() != 1 {
+		t.Errorf("expected 1 CRL in DSS, got %d", dss.Key("CRLs").Len())
+	}
+
+	stored, err := io.ReadAll(dss.Key("CRLs").Index(0).Reader())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if !bytes.Equal(stored, crl) {
+		t.Errorf("CRL in DSS does not match the embedded CRL")
+	}
+
+	vri := dss.Key("VRI")
+	if len(vri.Keys()) != 1 {
+		t.Fatalf("expected 1 VRI entry, got %d", len(vri.Keys()))
+	}
+	key := vri.Keys()[0]
+	if len(key) != 40 || strings.ToUpper(key) != key {
+		t.Errorf("VRI key %q is not an uppercase hex SHA-1 hash", key)
+	}
+
+	// The AcroForm of the signed revision must be preserved.
+	if rdr.Trailer().Key("Root").Key("AcroForm").Key("Fields").Len() != 1 {
+		t.Errorf("expected the signature field to be preserved")
+	}
+
+	info, err := verify.VerifyFile(tmpfile)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if len(info.Signers) != 1 {
+		t.Fatalf("expected 1 signer, got %d", len(info.Signers))
+	}
+	if !info.Signers[0].ValidSignature {
+		t.Errorf("expected a valid signature")
+	}
+}
+
+func TestAppendDSSMergesExistingEntries(t *testing.T) {
+	cert, _ := loadCertificateAndKey(t)
+
+	document, err := os.ReadFile("../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	first, err := appendDSS(document, map[string]validationData{
+		vriKey([]byte("first")): {Certificates: []*x509.Certificate{cert}},
+	}, SignData{})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	ocsp, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	second, err := appendDSS(first, map[string]validationData{
+		vriKey([]byte("second")): {OCSPs: [][]byte{ocsp}},
+	}, SignData{})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	if !bytes.HasPrefix(second, first) {
+		t.Fatalf("DSS update must not modify earlier revisions")
+	}
+
+	rdr, err := pdf.NewReader(bytes.NewReader(second), int64(len(second)))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	dss := rdr.Trailer().Key("Root").Key("DSS")
+	if dss.Key("Certs").Len() != 1 {
+		t.Errorf("expected 1 certificate in DSS, got %d", dss.Key("Certs").Len())
+	}
+	if dss.Key("OCSPs").Len() != 1 {
+		t.Errorf("expected 1 OCSP response in DSS, got %d", dss.Key("OCSPs").Len())
+	}
+	if len(dss.Key("VRI").Keys()) != 2 {
+		t.Errorf("expected 2 VRI entries, got %d", len(dss.Key("VRI").Keys()))
+	}
+}
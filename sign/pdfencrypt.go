@@ -0,0 +1,806 @@
+package sign
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rc4"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/internal/xref"
+)
+
+// ErrInvalidPassword is returned when the password does not open an encrypted
+// document.
+var ErrInvalidPassword = errors.New("encrypted document: invalid password")
+
+type cryptMethod int
+
+const (
+	cryptIdentity cryptMethod = iota
+	cryptRC4
+	cryptAESV2 // AES-128
+	cryptAESV3 // AES-256
+)
+
+// passwordPadding pads passwords of revision 2 to 4 to 32 bytes.
+var passwordPadding = []byte{
+	0x28, 0xbf, 0x4e, 0x5e, 0x4e, 0x75, 0x8a, 0x41, 0x64, 0x00, 0x4e, 0x56, 0xff, 0xfa, 0x01, 0x08,
+	0x2e, 0x2e, 0x00, 0xb6, 0xd0, 0x68, 0x3e, 0x80, 0x2f, 0x0c, 0xa9, 0xfe, 0x64, 0x53, 0x69, 0x7a,
+}
+
+// securityHandler is the standard security handler (ISO 32000-2, clause
+// 7.6.4) of an encrypted document: RC4 with revision 2 to 4, AES-128 with
+// revision 4 and AES-256 with revision 6, or the deprecated revision 5.
+type securityHandler struct {
+	key             []byte
+	revision        int
+	strings         cryptMethod
+	streams         cryptMethod
+	encryptMetadata bool
+	permissions     uint32
+	owner           bool // Opened with the owner password
+
+	// encryptEntry is the value of the Encrypt entry of the trailer, it is copied
+	// to new cross-reference streams.
+	encryptEntry string
+	encryptID    uint32
+
+	// deterministic derives the AES initialization vectors from the data
+	// instead of the random source.
+	deterministic bool
+}
+
+// cryptFilter returns the method of a crypt filter of the CF dictionary.
+func cryptFilter(dict *pdfNode, resolve func(*pdfNode) *pdfNode, name *pdfNode) (cryptMethod, error) {
+	if name == nil || name.isName("Identity") {
+		return cryptIdentity, nil
+	}
+	filter := resolve(resolve(dict.get("CF")).get(resolve(name).text()))
+	if filter == nil {
+		return 0, fmt.Errorf("encrypted document: crypt filter %s not found", resolve(name).text())
+	}
+	switch method := resolve(filter.get("CFM")); {
+	case method == nil || method.isName("None"):
+		return cryptIdentity, nil
+	case method.isName("V2"):
+		return cryptRC4, nil
+	case method.isName("AESV2"):
+		return cryptAESV2, nil
+	case method.isName("AESV3"):
+		return cryptAESV3, nil
+	default:
+		return 0, fmt.Errorf("encrypted document: unsupported crypt filter method %s", method.text())
+	}
+}
+
+// newSecurityHandler authenticates password with the encryption dictionary
+// and returns the handler with the file encryption key. id is the first
+// element of the ID of the document.
+func newSecurityHandler(dict *pdfNode, resolve func(*pdfNode) *pdfNode, id []byte, password string) (*securityHandler, error) {
+	if filter := resolve(dict.get("Filter")); !filter.isName("Standard") {
+		return nil, fmt.Errorf("encrypted document: unsupported security handler %s", filter.text())
+	}
+
+	v, _ := resolve(dict.get("V")).int()
+	r, _ := resolve(dict.get("R")).int()
+	p, _ := resolve(dict.get("P")).int()
+	length, ok := resolve(dict.get("Length")).int()
+	if !ok {
+		length = 40
+	}
+
+	h := &securityHandler{
+		revision:        int(r),
+		encryptMetadata: resolve(dict.get("EncryptMetadata")).text() != "false",
+		permissions:     uint32(p),
+	}
+
+	keyLength := 5
+	switch v {
+	case 1:
+		h.strings, h.streams = cryptRC4, cryptRC4
+	case 2:
+		h.strings, h.streams = cryptRC4, cryptRC4
+		keyLength = int(length / 8)
+	case 4, 5:
+		var err error
+		if h.strings, err = cryptFilter(dict, resolve, dict.get("StrF")); err != nil {
+			return nil, err
+		}
+		if h.streams, err = cryptFilter(dict, resolve, dict.get("StmF")); err != nil {
+			return nil, err
+		}
+		keyLength = 16
+		if v == 5 {
+			keyLength = 32
+		}
+	default:
+		return nil, fmt.Errorf("encrypted document: unsupported encryption algorithm %d", v)
+	}
+	if keyLength < 5 || keyLength > 16 && v != 5 {
+		return nil, fmt.Errorf("encrypted document: invalid key length %d", length)
+	}
+
+	o := resolve(dict.get("O"))
+	u := resolve(dict.get("U"))
+	if o == nil || u == nil {
+		return nil, errors.New("encrypted document: missing O or U entry")
+	}
+
+	switch {
+	case v < 5 && r >= 2 && r <= 4:
+		if len(o.value) < 32 || len(u.value) < 32 {
+			return nil, errors.New("encrypted document: invalid O or U entry")
+		}
+		h.key, h.owner = h.authenticateRC4(pdfDocEncoding(password), o.value[:32], u.value[:32], id, keyLength)
+	case v == 5 && (r == 5 || r == 6):
+		oe := resolve(dict.get("OE"))
+		ue := resolve(dict.get("UE"))
+		if len(o.value) < 48 || len(u.value) < 48 || (oe == nil || len(oe.value) < 32) || (ue == nil || len(ue.value) < 32) {
+			return nil, errors.New("encrypted document: invalid O, U, OE or UE entry")
+		}
+		h.key, h.owner = h.authenticateAES256(utf8Password(password), o.value[:48], u.value[:48], oe.value[:32], ue.value[:32])
+	default:
+		return nil, fmt.Errorf("encrypted document: unsupported revision %d of encryption algorithm %d", r, v)
+	}
+	if h.key == nil {
+		return nil, ErrInvalidPassword
+	}
+	return h, nil
+}
+
+// pdfDocEncoding returns the password in PDFDocEncoding, for revision 2 to 4.
+// It matches Latin-1 for the printable characters, other passwords are used as
+// UTF-8.
+func pdfDocEncoding(password string) []byte {
+	encoded := make([]byte, 0, len(password))
+	for _, r := range password {
+		if r > 0xff {
+			return []byte(password)
+		}
+		encoded = append(encoded, byte(r))
+	}
+	return encoded
+}
+
+// utf8Password returns the password of revision 5 and 6, truncated to 127
+// bytes. The SASLprep profile is not applied, passwords must be normalized
+// by the caller.
+func utf8Password(password string) []byte {
+	encoded := []byte(password)
+	if len(encoded) > 127 {
+		encoded = encoded[:127]
+	}
+	return encoded
+}
+
+func padPassword(password []byte) []byte {
+	padded := make([]byte, 0, 32)
+	padded = append(padded, password[:min(len(password), 32)]...)
+	return append(padded, passwordPadding[:32-len(padded)]...)
+}
+
+func rc4Crypt(key, data []byte) []byte {
+	c, _ := rc4.NewCipher(key) // The key is 1 to 256 bytes
+	out := make([]byte, len(data))
+	c.XORKeyStream(out, data)
+	return out
+}
+
+// rc4Rounds encrypts data 20 times, with the key XORed with the round
+// number, as used by revision 3 and 4. Rounds descend to decrypt.
+func rc4Rounds(key, data []byte, decrypt bool) []byte {
+	roundKey := make([]byte, len(key))
+	for i := 0; i < 20; i++ {
+		round := byte(i)
+		if decrypt {
+			round = byte(19 - i)
+		}
+		for j := range key {
+			roundKey[j] = key[j] ^ round
+		}
+		data = rc4Crypt(roundKey, data)
+	}
+	return data
+}
+
+// rc4FileKey computes the file encryption key of a user password, see
+// Algorithm 2.
+func (h *securityHandler) rc4FileKey(password, o, id []byte, keyLength int) []byte {
+	digest := md5.New()
+	digest.Write(padPassword(password))
+	digest.Write(o)
+	_ = binary.Write(digest, binary.LittleEndian, h.permissions)
+	digest.Write(id)
+	if h.revision >= 4 && !h.encryptMetadata {
+		digest.Write([]byte{0xff, 0xff, 0xff, 0xff})
+	}
+	key := digest.Sum(nil)
+	if h.revision >= 3 {
+		for i := 0; i < 50; i++ {
+			sum := md5.Sum(key[:keyLength])
+			key = sum[:]
+		}
+	}
+	return key[:keyLength]
+}
+
+// rc4UserValue computes the U entry for a file encryption key, see Algorithm
+// 4 and 5. Only the first 16 bytes are significant for revision 3 and 4.
+func (h *securityHandler) rc4UserValue(key, id []byte) []byte {
+	if h.revision == 2 {
+		return rc4Crypt(key, passwordPadding)
+	}
+	digest := md5.New()
+	digest.Write(passwordPadding)
+	digest.Write(id)
+	return rc4Rounds(key, digest.Sum(nil), false)
+}
+
+// rc4OwnerKey computes the key that encrypts the user password in the O
+// entry from the owner password, see Algorithm 3.
+func (h *securityHandler) rc4OwnerKey(password []byte, keyLength int) []byte {
+	sum := md5.Sum(padPassword(password))
+	key := sum[:]
+	if h.revision >= 3 {
+		for i := 0; i < 50; i++ {
+			sum = md5.Sum(key)
+			key = sum[:]
+		}
+	}
+	return key[:keyLength]
+}
+
+func (h *securityHandler) authenticateRC4(password, o, u, id []byte, keyLength int) ([]byte, bool) {
+	check := func(userPassword []byte) []byte {
+		key := h.rc4FileKey(userPassword, o, id, keyLength)
+		expected := h.rc4UserValue(key, id)
+		if h.revision >= 3 {
+			expected, u = expected[:16], u[:16]
+		}
+		if bytes.Equal(expected, u) {
+			return key
+		}
+		return nil
+	}
+
+	// The owner password decrypts the padded user password of O, see
+	// Algorithm 7.
+	ownerKey := h.rc4OwnerKey(password, keyLength)
+	userPassword := rc4Crypt(ownerKey, o)
+	if h.revision >= 3 {
+		userPassword = rc4Rounds(ownerKey, o, true)
+	}
+	if key := check(userPassword); key != nil {
+		return key, true
+	}
+	return check(password), false
+}
+
+// aes256Hash computes the password hash of revision 5 (SHA-256) or revision 6
+// (Algorithm 2.B).
+func aes256Hash(revision int, password, salt, userKey []byte) []byte {
+	digest := sha256.New()
+	digest.Write(password)
+	digest.Write(salt)
+	digest.Write(userKey)
+	k := digest.Sum(nil)
+	if revision == 5 {
+		return k
+	}
+
+	for round := 0; ; round++ {
+		var sequence []byte
+		sequence = append(sequence, password...)
+		sequence = append(sequence, k...)
+		sequence = append(sequence, userKey...)
+		k1 := bytes.Repeat(sequence, 64)
+
+		block, _ := aes.NewCipher(k[:16])
+		e := make([]byte, len(k1))
+		cipher.NewCBCEncrypter(block, k[16:32]).CryptBlocks(e, k1)
+
+		// The first 16 bytes of E as a number modulo 3 select the hash,
+		// 256 is 1 modulo 3.
+		sum := 0
+		for _, b := range e[:16] {
+			sum += int(b)
+		}
+		var next hash.Hash
+		switch sum % 3 {
+		case 0:
+			next = sha256.New()
+		case 1:
+			next = sha512.New384()
+		case 2:
+			next = sha512.New()
+		}
+		next.Write(e)
+		k = next.Sum(nil)
+
+		if round >= 63 && int(e[len(e)-1]) <= round-31 {
+			break
+		}
+	}
+	return k[:32]
+}
+
+// aes256KeyCrypt encrypts or decrypts the file encryption key of the OE and
+// UE entries, with AES-256 in CBC mode, a zero IV and no padding.
+func aes256KeyCrypt(key, data []byte, decrypt bool) []byte {
+	block, _ := aes.NewCipher(key)
+	out := make([]byte, len(data))
+	iv := make([]byte, aes.BlockSize)
+	if decrypt {
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+	} else {
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, data)
+	}
+	return out
+}
+
+// authenticateAES256 returns the file encryption key, see Algorithm 2.A.
+func (h *securityHandler) authenticateAES256(password, o, u, oe, ue []byte) ([]byte, bool) {
+	if bytes.Equal(aes256Hash(h.revision, password, o[32:40], u), o[:32]) {
+		return aes256KeyCrypt(aes256Hash(h.revision, password, o[40:48], u), oe, true), true
+	}
+	if bytes.Equal(aes256Hash(h.revision, password, u[32:40], nil), u[:32]) {
+		return aes256KeyCrypt(aes256Hash(h.revision, password, u[40:48], nil), ue, true), false
+	}
+	return nil, false
+}
+
+// canSign reports whether the permissions allow to sign, an owner can always
+// sign. Bit 6 of the permissions allows to add annotations and form fields,
+// bit 9 of revision 3 and above only to fill in existing fields.
+func (h *securityHandler) canSign(existingField bool) bool {
+	return h.owner || h.permissions&(1<<5) != 0 || (existingField && h.revision >= 3 && h.permissions&(1<<8) != 0)
+}
+
+// objectKey returns the key of the strings and streams of an object, see
+// Algorithm 1. AES-256 uses the file encryption key.
+func (h *securityHandler) objectKey(method cryptMethod, id, gen uint32) []byte {
+	if method == cryptAESV3 {
+		return h.key
+	}
+	data := append(slices.Clone(h.key), byte(id), byte(id>>8), byte(id>>16), byte(gen), byte(gen>>8))
+	if method == cryptAESV2 {
+		data = append(data, "sAlT"...)
+	}
+	sum := md5.Sum(data)
+	return sum[:min(len(h.key)+5, 16)]
+}
+
+func (h *securityHandler) decrypt(method cryptMethod, id, gen uint32, data []byte) ([]byte, error) {
+	key := h.objectKey(method, id, gen)
+	switch method {
+	case cryptRC4:
+		return rc4Crypt(key, data), nil
+	case cryptAESV2, cryptAESV3:
+		// Some writers leave empty strings unencrypted.
+		if len(data) == 0 {
+			return data, nil
+		}
+		if len(data) < 2*aes.BlockSize || len(data)%aes.BlockSize != 0 {
+			return nil, fmt.Errorf("invalid AES encrypted data length %d", len(data))
+		}
+		block, _ := aes.NewCipher(key)
+		out := make([]byte, len(data)-aes.BlockSize)
+		cipher.NewCBCDecrypter(block, data[:aes.BlockSize]).CryptBlocks(out, data[aes.BlockSize:])
+		padding := int(out[len(out)-1])
+		if padding == 0 || padding > aes.BlockSize || !bytes.Equal(out[len(out)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+			return nil, errors.New("invalid AES padding")
+		}
+		return out[:len(out)-padding], nil
+	}
+	return data, nil
+}
+
+func (h *securityHandler) encrypt(method cryptMethod, id, gen uint32, data []byte) ([]byte, error) {
+	key := h.objectKey(method, id, gen)
+	switch method {
+	case cryptRC4:
+		return rc4Crypt(key, data), nil
+	case cryptAESV2, cryptAESV3:
+		iv := make([]byte, aes.BlockSize)
+		if h.deterministic {
+			sum := sha256.Sum256(append(slices.Clone(key), data...))
+			copy(iv, sum[:])
+		} else if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+			return nil, err
+		}
+		padding := aes.BlockSize - len(data)%aes.BlockSize
+		padded := append(slices.Clone(data), bytes.Repeat([]byte{byte(padding)}, padding)...)
+		block, _ := aes.NewCipher(key)
+		out := make([]byte, len(padded))
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, padded)
+		return append(iv, out...), nil
+	}
+	return data, nil
+}
+
+// isSignatureDictionary reports whether the Contents of a dictionary are not
+// encrypted.
+func isSignatureDictionary(dict *pdfNode) bool {
+	t := dict.get("Type")
+	return t.isName("Sig") || t.isName("DocTimeStamp") || (t == nil && dict.get("ByteRange") != nil && dict.get("Contents") != nil)
+}
+
+// visitStrings calls fn for the strings in node that are encrypted.
+func visitStrings(node *pdfNode, fn func(*pdfNode)) {
+	switch node.kind {
+	case nodeString:
+		fn(node)
+	case nodeArray:
+		for _, item := range node.items {
+			visitStrings(item, fn)
+		}
+	case nodeDict:
+		signature := isSignatureDictionary(node)
+		for i := 1; i < len(node.items); i += 2 {
+			if signature && node.items[i-1].isName("Contents") {
+				continue
+			}
+			visitStrings(node.items[i], fn)
+		}
+	}
+}
+
+// streamEncrypted reports whether the data of a stream with dict is
+// encrypted. Streams with a Crypt filter are left to the filter.
+func (h *securityHandler) streamEncrypted(dict *pdfNode) bool {
+	if dict.get("Type").isName("XRef") {
+		return false
+	}
+	if dict.get("Type").isName("Metadata") && !h.encryptMetadata {
+		return false
+	}
+	filter := dict.get("Filter")
+	if filter != nil && filter.kind == nodeArray && len(filter.items) > 0 {
+		filter = filter.items[0]
+	}
+	return !filter.isName("Crypt")
+}
+
+// literalString encodes value as a literal string, balanced parentheses are
+// not escaped.
+func literalString(value []byte) []byte {
+	depth := 0
+	balanced := true
+	for _, c := range value {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			balanced = balanced && depth >= 0
+		}
+	}
+	balanced = balanced && depth == 0
+
+	encoded := []byte{'('}
+	for _, c := range value {
+		switch {
+		case c == '\\', (c == '(' || c == ')') && !balanced:
+			encoded = append(encoded, '\\', c)
+		case c == '\r':
+			encoded = append(encoded, '\\', 'r')
+		default:
+			encoded = append(encoded, c)
+		}
+	}
+	return append(encoded, ')')
+}
+
+func hexString(value []byte) []byte {
+	encoded := make([]byte, 0, hex.EncodedLen(len(value))+2)
+	encoded = append(encoded, '<')
+	encoded = hex.AppendEncode(encoded, value)
+	return append(encoded, '>')
+}
+
+// replaceInPlace writes value over data[start:end], padded with spaces.
+func replaceInPlace(data []byte, start, end int, values ...[]byte) error {
+	for _, value := range values {
+		if len(value) <= end-start {
+			n := copy(data[start:end], value)
+			for i := start + n; i < end; i++ {
+				data[i] = ' '
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("decrypted value at offset %d does not fit", start)
+}
+
+// decryptObject decrypts the strings and stream of an object in data, the
+// new lengths of streams with an indirect Length are added to lengths.
+func (h *securityHandler) decryptObject(data []byte, object *pdfObject, lengths map[uint32]int) error {
+	var err error
+	visitStrings(object.value, func(node *pdfNode) {
+		if err != nil {
+			return
+		}
+		var plaintext []byte
+		if plaintext, err = h.decrypt(h.strings, object.id, object.gen, node.value); err == nil {
+			err = replaceInPlace(data, node.start, node.end, literalString(plaintext), hexString(plaintext))
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("object %d: %w", object.id, err)
+	}
+
+	if !object.stream || !h.streamEncrypted(object.value) {
+		return nil
+	}
+	plaintext, err := h.decrypt(h.streams, object.id, object.gen, data[object.streamStart:object.streamEnd])
+	if err != nil {
+		return fmt.Errorf("stream %d: %w", object.id, err)
+	}
+	copy(data[object.streamStart:], plaintext)
+	for i := object.streamStart + len(plaintext); i < object.streamEnd; i++ {
+		data[i] = '\n'
+	}
+	if len(plaintext) == object.streamEnd-object.streamStart {
+		return nil
+	}
+
+	length := object.value.get("Length")
+	if id, _, ok := length.ref(); ok {
+		lengths[id] = len(plaintext)
+		return nil
+	}
+	if length == nil {
+		return fmt.Errorf("stream %d: missing Length", object.id)
+	}
+	return replaceInPlace(data, length.start, length.end, []byte(strconv.Itoa(len(plaintext))))
+}
+
+// encryptObject encrypts the strings and stream of an object that is written
+// to the incremental update, the object starts with its value.
+func (h *securityHandler) encryptObject(id uint32, object []byte) ([]byte, error) {
+	s := &pdfScanner{data: object}
+	value := s.parseValue(s.next(), 0)
+	if value.get("Type").isName("XRef") {
+		return object, nil
+	}
+
+	type edit struct {
+		start, end int
+		value      []byte
+	}
+	var edits []edit
+	var err error
+	visitStrings(value, func(node *pdfNode) {
+		if err != nil {
+			return
+		}
+		var ciphertext []byte
+		if ciphertext, err = h.encrypt(h.strings, id, 0, node.value); err == nil {
+			edits = append(edits, edit{node.start, node.end, hexString(ciphertext)})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if keyword := s.next(); keyword.kind == tokenKeyword && string(keyword.value) == "stream" && h.streamEncrypted(value) {
+		// Parse the object again with a header to find the stream data.
+		header := []byte("0 0 obj\n")
+		s = &pdfScanner{data: append(header, object...)}
+		stream := s.object(s.next())
+		if stream == nil || !stream.stream {
+			return nil, errors.New("invalid stream object")
+		}
+		start, end := stream.streamStart-len(header), stream.streamEnd-len(header)
+		length := value.get("Length")
+		if _, ok := length.int(); !ok {
+			return nil, errors.New("stream object without a direct Length")
+		}
+		ciphertext, err := h.encrypt(h.streams, id, 0, object[start:end])
+		if err != nil {
+			return nil, err
+		}
+		edits = append(edits,
+			edit{length.start, length.end, []byte(strconv.Itoa(len(ciphertext)))},
+			edit{start, end, ciphertext})
+	}
+
+	sort.Slice(edits, func(i, j int) bool {
+		return edits[i].start < edits[j].start
+	})
+	var encrypted bytes.Buffer
+	pos := 0
+	for _, e := range edits {
+		encrypted.Write(object[pos:e.start])
+		encrypted.Write(e.value)
+		pos = e.end
+	}
+	encrypted.Write(object[pos:])
+	return encrypted.Bytes(), nil
+}
+
+// decryptDocument returns a copy of an encrypted document with the same byte
+// offsets, in which the strings and streams are decrypted and the Encrypt
+// entries of the trailers are renamed. pdf.Reader reads the copy as an
+// unencrypted document with the cross-reference information of the original.
+// The handler is nil if the document is not encrypted.
+func decryptDocument(document []byte, password string) ([]byte, *securityHandler, error) {
+	objects, trailers := scanPDF(document)
+	byID := make(map[uint32]*pdfObject, len(objects))
+	for _, object := range objects {
+		byID[object.id] = object
+		// Cross-reference stream dictionaries are trailers as well.
+		if object.value.get("Type").isName("XRef") {
+			trailers = append(trailers, object.value)
+		}
+	}
+	resolve := func(node *pdfNode) *pdfNode {
+		if id, _, ok := node.ref(); ok {
+			if object := byID[id]; object != nil {
+				return object.value
+			}
+			return nil
+		}
+		return node
+	}
+
+	// The entries of the most recent trailer apply.
+	sort.SliceStable(trailers, func(i, j int) bool {
+		return trailers[i].start < trailers[j].start
+	})
+	var encryptKeys []*pdfNode
+	var encrypt, documentID *pdfNode
+	for _, trailer := range trailers {
+		if key := trailer.keyNode("Encrypt"); key != nil {
+			encryptKeys = append(encryptKeys, key)
+			encrypt = trailer.get("Encrypt")
+		}
+		if id := trailer.get("ID"); id != nil {
+			documentID = id
+		}
+	}
+	if encrypt == nil {
+		return nil, nil, nil
+	}
+
+	dict := resolve(encrypt)
+	if dict == nil || dict.kind != nodeDict {
+		return nil, nil, errors.New("encrypted document: invalid encryption dictionary")
+	}
+	var id []byte
+	if documentID = resolve(documentID); documentID != nil && documentID.kind == nodeArray && len(documentID.items) > 0 {
+		if first := resolve(documentID.items[0]); first != nil {
+			id = first.value
+		}
+	}
+
+	h, err := newSecurityHandler(dict, resolve, id, password)
+	if err != nil {
+		return nil, nil, err
+	}
+	h.encryptEntry = string(document[encrypt.start:encrypt.end])
+	h.encryptID, _, _ = encrypt.ref()
+
+	decrypted := slices.Clone(document)
+	for _, key := range encryptKeys {
+		if err := replaceInPlace(decrypted, key.start, key.end, []byte("/Decrypt")); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// The encryption dictionary and cross-reference streams are not
+	// encrypted.
+	lengths := make(map[uint32]int)
+	for _, object := range objects {
+		if (h.encryptID != 0 && object.id == h.encryptID) || object.value.get("Type").isName("XRef") {
+			continue
+		}
+		if err := h.decryptObject(decrypted, object, lengths); err != nil {
+			return nil, nil, fmt.Errorf("encrypted document: %w", err)
+		}
+	}
+	for _, object := range objects {
+		if length, ok := lengths[object.id]; ok && object.value.kind == nodeNumber {
+			if err := replaceInPlace(decrypted, object.value.start, object.value.end, []byte(strconv.Itoa(length))); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	return decrypted, h, nil
+}
+
+// openDocument returns the reader of a document. An encrypted document is
+// read from its decrypted copy, with the security handler that encrypts the
+// incremental update. A nil rdr is opened from input. The reader of a
+// hybrid-reference file reads its cross-reference streams as well.
+func openDocument(input io.ReadSeeker, rdr *pdf.Reader, size int64, password string) (*pdf.Reader, *securityHandler, error) {
+	if rdr != nil && !slices.Contains(rdr.Trailer().Keys(), "Encrypt") {
+		return extendReader(readerAt(input), size, rdr)
+	}
+
+	// Unencrypted documents are read from input as needed, encrypted
+	// documents are decrypted in memory.
+	if rdr == nil {
+		if r, err := pdf.NewReader(readerAt(input), size); err == nil {
+			if !slices.Contains(r.Trailer().Keys(), "Encrypt") {
+				return extendReader(readerAt(input), size, r)
+			}
+			rdr = r
+		}
+	}
+
+	if _, err := input.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+	document, err := io.ReadAll(io.LimitReader(input, size))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// pdf.Reader does not open all encrypted documents, the error of an
+	// unencrypted document is returned after the scan.
+	var readErr error
+	if rdr == nil {
+		rdr, readErr = pdf.NewReader(bytes.NewReader(document), int64(len(document)))
+		if readErr == nil && !slices.Contains(rdr.Trailer().Keys(), "Encrypt") {
+			return extendReader(bytes.NewReader(document), int64(len(document)), rdr)
+		}
+	}
+
+	decrypted, h, err := decryptDocument(document, password)
+	if err != nil {
+		return nil, nil, err
+	}
+	if h == nil {
+		if readErr != nil {
+			return nil, nil, readErr
+		}
+		return extendReader(bytes.NewReader(document), int64(len(document)), rdr)
+	}
+
+	rdr, err = xref.NewReader(bytes.NewReader(decrypted), int64(len(decrypted)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read decrypted document: %w", err)
+	}
+	return rdr, h, nil
+}
+
+// extendReader returns the reader rdr of the unencrypted document f, see
+// xref.Extend.
+func extendReader(f io.ReaderAt, size int64, rdr *pdf.Reader) (*pdf.Reader, *securityHandler, error) {
+	rdr, err := xref.Extend(f, size, rdr)
+	if err != nil {
+		return nil, nil, err
+	}
+	return rdr, nil, nil
+}
+
+// openSigningDocument opens the document of sign_data, see openDocument, and
+// checks that the permissions of an encrypted document allow to sign it.
+func openSigningDocument(input io.ReadSeeker, rdr *pdf.Reader, size int64, sign_data SignData) (*pdf.Reader, *securityHandler, error) {
+	rdr, h, err := openDocument(input, rdr, size, sign_data.Password)
+	if err != nil || h == nil {
+		return rdr, h, err
+	}
+	if !h.canSign(sign_data.FieldName != "") {
+		return nil, nil, errors.New("encrypted document: the permissions do not allow signing, the owner password is required")
+	}
+	h.deterministic = sign_data.Deterministic
+	return rdr, h, nil
+}
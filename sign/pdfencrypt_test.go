@@ -0,0 +1,576 @@
+package sign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pkcs7"
+)
+
+type testEncryption struct {
+	name        string
+	v, r        int
+	length      int    // Key length in bits
+	cfm         string // Crypt filter method of V 4 and 5
+	permissions int32
+	xrefStream  bool
+	emptyUser   bool // Only an owner password, the document opens without a password
+}
+
+var testEncryptions = []testEncryption{
+	{name: "RC4-40", v: 1, r: 2, length: 40, permissions: -4},
+	{name: "RC4-128", v: 2, r: 3, length: 128, permissions: -4},
+	{name: "AES-128", v: 4, r: 4, length: 128, cfm: "AESV2", permissions: -4},
+	{name: "AES-256", v: 5, r: 6, length: 256, cfm: "AESV3", permissions: -4},
+	{name: "AES-256 xref stream", v: 5, r: 6, length: 256, cfm: "AESV3", permissions: -4, xrefStream: true},
+}
+
+const (
+	testUserPassword  = "user"
+	testOwnerPassword = "owner"
+	testTitle         = "Encrypted (document) \\ title"
+)
+
+// encryptTestFile rewrites a document without object streams as an
+// encrypted document with the user and owner passwords, with an Info
+// dictionary that holds testTitle.
+func encryptTestFile(t *testing.T, path string, e testEncryption) []byte {
+	t.Helper()
+
+	userPassword := testUserPassword
+	if e.emptyUser {
+		userPassword = ""
+	}
+
+	original, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	objects, trailers := scanPDF(original)
+	if len(trailers) == 0 {
+		t.Fatalf("%s has no trailer", path)
+	}
+	root := trailers[len(trailers)-1].get("Root")
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	h := &securityHandler{
+		revision:        e.r,
+		encryptMetadata: true,
+		permissions:     uint32(e.permissions),
+	}
+	var encrypt string
+	switch {
+	case e.v < 4:
+		h.strings, h.streams = cryptRC4, cryptRC4
+	case e.cfm == "AESV2":
+		h.strings, h.streams = cryptAESV2, cryptAESV2
+	default:
+		h.strings, h.streams = cryptAESV3, cryptAESV3
+	}
+
+	if e.r <= 4 {
+		keyLength := e.length / 8
+		ownerKey := h.rc4OwnerKey([]byte(testOwnerPassword), keyLength)
+		o := rc4Crypt(ownerKey, padPassword([]byte(userPassword)))
+		if e.r >= 3 {
+			o = rc4Rounds(ownerKey, padPassword([]byte(userPassword)), false)
+		}
+		h.key = h.rc4FileKey([]byte(userPassword), o, id, keyLength)
+		u := h.rc4UserValue(h.key, id)
+		u = append(u, make([]byte, 32-len(u))...)
+
+		encrypt = fmt.Sprintf("<< /Filter /Standard /V %d /R %d /Length %d /P %d /O %s /U %s", e.v, e.r, e.length, e.permissions, hexString(o), hexString(u))
+		if e.v == 4 {
+			encrypt += fmt.Sprintf(" /CF << /StdCF << /CFM /%s /AuthEvent /DocOpen /Length 16 >> >> /StmF /StdCF /StrF /StdCF", e.cfm)
+		}
+		encrypt += " >>"
+	} else {
+		random := make([]byte, 64)
+		if _, err := rand.Read(random); err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+		h.key = random[:32]
+		user, owner := []byte(userPassword), []byte(testOwnerPassword)
+
+		u := append(aes256Hash(e.r, user, random[32:40], nil), random[32:48]...)
+		ue := aes256KeyCrypt(aes256Hash(e.r, user, random[40:48], nil), h.key, false)
+		o := append(aes256Hash(e.r, owner, random[48:56], u), random[48:64]...)
+		oe := aes256KeyCrypt(aes256Hash(e.r, owner, random[56:64], u), h.key, false)
+
+		perms := make([]byte, 16)
+		binary.LittleEndian.PutUint32(perms, uint32(e.permissions))
+		copy(perms[4:], []byte{0xff, 0xff, 0xff, 0xff, 'T', 'a', 'd', 'b'})
+		block, _ := aes.NewCipher(h.key)
+		block.Encrypt(perms, perms)
+
+		encrypt = fmt.Sprintf("<< /Filter /Standard /V 5 /R %d /Length 256 /P %d /O %s /U %s /OE %s /UE %s /Perms %s"+
+			" /CF << /StdCF << /CFM /AESV3 /AuthEvent /DocOpen /Length 32 >> >> /StmF /StdCF /StrF /StdCF >>",
+			e.r, e.permissions, hexString(o), hexString(u), hexString(oe), hexString(ue), hexString(perms))
+	}
+
+	var output bytes.Buffer
+	output.Write(original[:objects[0].start])
+	offsets := make(map[uint32]int)
+	size := uint32(0)
+	write := func(id uint32, body []byte, encrypted bool) {
+		if encrypted {
+			var err error
+			if body, err = h.encryptObject(id, body); err != nil {
+				t.Fatalf("failed to encrypt object %d: %s", id, err.Error())
+			}
+		}
+		offsets[id] = output.Len()
+		fmt.Fprintf(&output, "%d 0 obj\n%s\nendobj\n", id, body)
+		size = max(size, id+1)
+	}
+	for _, object := range objects {
+		body := bytes.TrimSpace(original[object.value.start:object.end])
+		write(object.id, bytes.TrimSpace(bytes.TrimSuffix(body, []byte("endobj"))), true)
+	}
+	encryptID, infoID := size, size+1
+	write(encryptID, []byte(encrypt), false)
+	write(infoID, []byte(fmt.Sprintf("<< /Title %s /Producer (pdfsign) >>", literalString([]byte(testTitle)))), true)
+
+	trailer := fmt.Sprintf("/Root %s /Info %d 0 R /Encrypt %d 0 R /ID [%s %s]", original[root.start:root.end], infoID, encryptID, hexString(id), hexString(id))
+	if e.xrefStream {
+		xrefID := size
+		offsets[xrefID] = output.Len()
+		var entries bytes.Buffer
+		for i := uint32(0); i <= xrefID; i++ {
+			if offset, ok := offsets[i]; ok {
+				writeXrefStreamLine(&entries, 1, int64(offset), 4, 0)
+			} else {
+				writeXrefStreamLine(&entries, 0, 0, 4, 0)
+			}
+		}
+		fmt.Fprintf(&output, "%d 0 obj\n<< /Type /XRef /Size %d /W [1 4 1] /Length %d %s >>\nstream\n", xrefID, xrefID+1, entries.Len(), trailer)
+		output.Write(entries.Bytes())
+		fmt.Fprintf(&output, "\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", offsets[xrefID])
+		return output.Bytes()
+	}
+
+	xref := output.Len()
+	fmt.Fprintf(&output, "xref\n0 %d\n", size)
+	for i := uint32(0); i < size; i++ {
+		if offset, ok := offsets[i]; ok {
+			fmt.Fprintf(&output, "%010d 00000 n \n", offset)
+		} else {
+			output.WriteString("0000000000 65535 f \n")
+		}
+	}
+	fmt.Fprintf(&output, "trailer\n<< /Size %d %s >>\nstartxref\n%d\n%%%%EOF\n", size, trailer, xref)
+	return output.Bytes()
+}
+
+// decryptedReader returns the reader of the decrypted copy of document.
+func decryptedReader(t *testing.T, document []byte, password string) (*pdf.Reader, *securityHandler) {
+	t.Helper()
+
+	decrypted, h, err := decryptDocument(document, password)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if h == nil {
+		t.Fatalf("expected an encrypted document")
+	}
+	rdr, err := pdf.NewReader(bytes.NewReader(decrypted), int64(len(decrypted)))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	return rdr, h
+}
+
+func readStream(t *testing.T, v pdf.Value) []byte {
+	t.Helper()
+
+	data, err := io.ReadAll(v.Reader())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	return data
+}
+
+func TestDecryptDocument(t *testing.T) {
+	original, err := os.ReadFile("../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	plain, err := pdf.NewReader(bytes.NewReader(original), int64(len(original)))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	content := readStream(t, plain.Page(1).V.Key("Contents").Index(0))
+	metadata := readStream(t, plain.Trailer().Key("Root").Key("Metadata"))
+
+	for _, e := range testEncryptions {
+		t.Run(e.name, func(t *testing.T) {
+			document := encryptTestFile(t, "../testfiles/testfile20.pdf", e)
+			if bytes.Contains(document, []byte("Datalogics")) {
+				t.Fatalf("expected the metadata stream to be encrypted")
+			}
+
+			for _, password := range []string{testUserPassword, testOwnerPassword} {
+				rdr, h := decryptedReader(t, document, password)
+				if h.owner != (password == testOwnerPassword) {
+					t.Errorf("%s: unexpected owner authentication %v", password, h.owner)
+				}
+				if title := rdr.Trailer().Key("Info").Key("Title").RawString(); title != testTitle {
+					t.Errorf("%s: unexpected title %q", password, title)
+				}
+				if data := readStream(t, rdr.Page(1).V.Key("Contents").Index(0)); !bytes.Equal(data, content) {
+					t.Errorf("%s: the decrypted content stream does not match", password)
+				}
+				if data := readStream(t, rdr.Trailer().Key("Root").Key("Metadata")); !bytes.Equal(data, metadata) {
+					t.Errorf("%s: the decrypted metadata stream does not match", password)
+				}
+			}
+
+			if _, _, err := decryptDocument(document, "wrong"); !errors.Is(err, ErrInvalidPassword) {
+				t.Errorf("expected ErrInvalidPassword, got %v", err)
+			}
+		})
+	}
+
+	// Unencrypted documents have no handler.
+	if decrypted, h, err := decryptDocument(original, ""); err != nil || h != nil || decrypted != nil {
+		t.Errorf("expected no handler for an unencrypted document, got %v", err)
+	}
+}
+
+// TestDecryptDocumentReader checks the RC4 and AES-128 key derivation and
+// encryption with the decryption of pdf.Reader. It does not shorten the
+// object keys of 40-bit RC4 and leaves the padding of AES streams.
+func TestDecryptDocumentReader(t *testing.T) {
+	original, err := os.ReadFile("../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	plain, err := pdf.NewReader(bytes.NewReader(original), int64(len(original)))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	content := readStream(t, plain.Page(1).V.Key("Contents").Index(0))
+
+	for _, e := range testEncryptions[1:3] {
+		t.Run(e.name, func(t *testing.T) {
+			document := encryptTestFile(t, "../testfiles/testfile20.pdf", e)
+			asked := false
+			rdr, err := pdf.NewReaderEncrypted(bytes.NewReader(document), int64(len(document)), func() string {
+				if asked {
+					return ""
+				}
+				asked = true
+				return testUserPassword
+			})
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			data := readStream(t, rdr.Page(1).V.Key("Contents").Index(0))
+			if e.cfm == "AESV2" && len(data) > len(content) && len(data)-len(content) <= aes.BlockSize {
+				data = data[:len(content)]
+			}
+			if !bytes.Equal(data, content) {
+				t.Errorf("the content stream does not match")
+			}
+			// pdf.Reader only decrypts RC4 strings.
+			if e.cfm == "" {
+				if title := rdr.Trailer().Key("Info").Key("Title").RawString(); title != testTitle {
+					t.Errorf("unexpected title %q", title)
+				}
+			}
+		})
+	}
+}
+
+// verifyEncryptedSignature checks the last signature of an encrypted
+// document, verify.VerifyFile does not read encrypted documents.
+func verifyEncryptedSignature(t *testing.T, document []byte, password string) pdf.Value {
+	t.Helper()
+
+	rdr, _ := decryptedReader(t, document, password)
+	fields := rdr.Trailer().Key("Root").Key("AcroForm").Key("Fields")
+	// The last signature, document timestamps do not sign the byte range.
+	var v pdf.Value
+	for i := fields.Len() - 1; i >= 0 && v.IsNull(); i-- {
+		if value := fields.Index(i).Key("V"); value.Key("Type").Name() == "Sig" {
+			v = value
+		}
+	}
+	if v.IsNull() {
+		t.Fatalf("expected a signature field")
+	}
+
+	byteRange := v.Key("ByteRange")
+	var content []byte
+	for i := 0; i+1 < byteRange.Len(); i += 2 {
+		start, length := byteRange.Index(i).Int64(), byteRange.Index(i+1).Int64()
+		content = append(content, document[start:start+length]...)
+	}
+
+	p7, err := pkcs7.Parse([]byte(v.Key("Contents").RawString()))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	p7.Content = content
+	if err := p7.Verify(); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	return v
+}
+
+func TestSignEncryptedPDF(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+	tsa := newTestTSA(t)
+
+	for _, e := range testEncryptions {
+		for _, password := range []string{testUserPassword, testOwnerPassword} {
+			t.Run(e.name+" "+password, func(t *testing.T) {
+				document := encryptTestFile(t, "../testfiles/testfile20.pdf", e)
+
+				var output bytes.Buffer
+				err := Sign(bytes.NewReader(document), &output, nil, int64(len(document)), SignData{
+					Signature: SignDataSignature{
+						Info: SignDataSignatureInfo{
+							Name:   "John Doe",
+							Reason: "Encrypted",
+							Date:   time.Now().Local(),
+						},
+						CertType: ApprovalSignature,
+					},
+					Appearance: Appearance{
+						Visible:     true,
+						LowerLeftX:  350,
+						LowerLeftY:  75,
+						UpperRightX: 600,
+						UpperRightY: 100,
+					},
+					Signer:          pkey,
+					Certificate:     cert,
+					DigestAlgorithm: crypto.SHA256,
+					TSA:             TSA{URL: tsa.URL},
+					Profile:         PAdESBaselineLT,
+					Password:        password,
+				})
+				if err != nil {
+					t.Fatalf("%s", err.Error())
+				}
+				signed := output.Bytes()
+				if !bytes.HasPrefix(signed, document) {
+					t.Fatalf("expected an incremental update")
+				}
+				if bytes.Contains(signed[len(document):], []byte("John Doe")) {
+					t.Errorf("expected the strings of the update to be encrypted")
+				}
+				if !bytes.Contains(signed[bytes.LastIndex(signed, []byte("startxref"))-600:], []byte("/Encrypt")) {
+					t.Errorf("expected the Encrypt entry in the trailer of the update")
+				}
+
+				v := verifyEncryptedSignature(t, signed, password)
+				if name, reason := v.Key("Name").RawString(), v.Key("Reason").RawString(); name != "John Doe" || reason != "Encrypted" {
+					t.Errorf("unexpected signer name %q or reason %q", name, reason)
+				}
+
+				// The DSS of baseline-LT is encrypted as well.
+				rdr, _ := decryptedReader(t, signed, testUserPassword)
+				certs := rdr.Trailer().Key("Root").Key("DSS").Key("Certs")
+				if certs.Len() == 0 {
+					t.Fatalf("expected DSS certificates")
+				}
+				if _, err := x509.ParseCertificate(readStream(t, certs.Index(0))); err != nil {
+					t.Errorf("failed to parse the DSS certificate: %s", err.Error())
+				}
+				// New cross-reference streams do not keep the Info.
+				if title := rdr.Trailer().Key("Info").Key("Title").RawString(); title != testTitle && !e.xrefStream {
+					t.Errorf("unexpected title %q", title)
+				}
+			})
+		}
+	}
+}
+
+// TestSignEncryptedPDFReader reads the strings of the update with the RC4
+// decryption of pdf.Reader.
+func TestSignEncryptedPDFReader(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+	document := encryptTestFile(t, "../testfiles/testfile20.pdf", testEncryptions[1])
+
+	var output bytes.Buffer
+	err := Sign(bytes.NewReader(document), &output, nil, int64(len(document)), SignData{
+		Signature: SignDataSignature{
+			Info: SignDataSignatureInfo{
+				Name: "John Doe",
+				Date: time.Now().Local(),
+			},
+			CertType:   CertificationSignature,
+			DocMDPPerm: AllowFillingExistingFormFieldsAndSignaturesPerms,
+		},
+		Signer:          pkey,
+		Certificate:     cert,
+		DigestAlgorithm: crypto.SHA256,
+		Password:        testOwnerPassword,
+	})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	asked := false
+	rdr, err := pdf.NewReaderEncrypted(bytes.NewReader(output.Bytes()), int64(output.Len()), func() string {
+		if asked {
+			return ""
+		}
+		asked = true
+		return testUserPassword
+	})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	v := rdr.Trailer().Key("Root").Key("AcroForm").Key("Fields").Index(0).Key("V")
+	if name := v.Key("Name").RawString(); name != "John Doe" {
+		t.Errorf("unexpected signer name %q", name)
+	}
+}
+
+func TestSignEncryptedPDFPermissions(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	// Printing only, no annotations or form fields.
+	e := testEncryptions[3]
+	e.permissions = -3904 | 1<<2
+	document := encryptTestFile(t, "../testfiles/testfile20.pdf", e)
+
+	sign := func(password string) error {
+		var output bytes.Buffer
+		return Sign(bytes.NewReader(document), &output, nil, int64(len(document)), SignData{
+			Signature: SignDataSignature{
+				Info:     SignDataSignatureInfo{Name: "John Doe", Date: time.Now().Local()},
+				CertType: ApprovalSignature,
+			},
+			Signer:          pkey,
+			Certificate:     cert,
+			DigestAlgorithm: crypto.SHA256,
+			Password:        password,
+		})
+	}
+
+	if err := sign(testUserPassword); err == nil || !strings.Contains(err.Error(), "permissions") {
+		t.Errorf("expected a permission error, got %v", err)
+	}
+	if err := sign(testOwnerPassword); err != nil {
+		t.Errorf("expected the owner to sign, got %v", err)
+	}
+	if err := sign("wrong"); !errors.Is(err, ErrInvalidPassword) {
+		t.Errorf("expected ErrInvalidPassword, got %v", err)
+	}
+}
+
+// checkEncryptedUpdate checks that the strings and streams of the objects
+// appended to document are encrypted, AES decryption fails on plaintext.
+func checkEncryptedUpdate(t *testing.T, document, updated []byte, password string) {
+	t.Helper()
+
+	_, h := decryptedReader(t, updated, password)
+	objects, _ := scanPDF(updated)
+	count := 0
+	for _, object := range objects {
+		if object.start < len(document) {
+			continue
+		}
+		count++
+		if object.value.get("Type").isName("XRef") {
+			if object.value.get("Encrypt") == nil {
+				t.Errorf("cross-reference stream %d has no Encrypt entry", object.id)
+			}
+			continue
+		}
+		visitStrings(object.value, func(node *pdfNode) {
+			if _, err := h.decrypt(h.strings, object.id, object.gen, node.value); err != nil {
+				t.Errorf("string %q of object %d is not encrypted: %s", updated[node.start:min(node.end, node.start+40)], object.id, err.Error())
+			}
+		})
+		if object.stream && h.streamEncrypted(object.value) {
+			if _, err := h.decrypt(h.streams, object.id, object.gen, updated[object.streamStart:object.streamEnd]); err != nil {
+				t.Errorf("stream of object %d is not encrypted: %s", object.id, err.Error())
+			}
+		}
+	}
+	if count == 0 {
+		t.Fatalf("expected objects in the update")
+	}
+	for _, plaintext := range []string{"John Doe", "Locked field", "Helv"} {
+		if bytes.Contains(updated[len(document):], []byte(plaintext)) {
+			t.Errorf("found plaintext %q in the update", plaintext)
+		}
+	}
+}
+
+// TestEncryptedIncrementalUpdates prepares a field of a document with an
+// owner password only, and signs it with a visible appearance and a PAdES baseline-LTA document timestamp.
+func TestEncryptedIncrementalUpdates(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+	tsa := newTestTSA(t)
+
+	for _, e := range []testEncryption{testEncryptions[2], testEncryptions[4]} {
+		t.Run(e.name, func(t *testing.T) {
+			e.emptyUser = true
+			document := encryptTestFile(t, "../testfiles/testfile20.pdf", e)
+
+			var prepared bytes.Buffer
+			err := PrepareFields(bytes.NewReader(document), &prepared, []SignatureField{{
+				Name:        "Approval",
+				Page:        1,
+				LowerLeftX:  350,
+				LowerLeftY:  75,
+				UpperRightX: 600,
+				UpperRightY: 100,
+				Lock:        &FieldLock{Action: LockIncludedFields, Fields: []string{"Locked field"}},
+			}})
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			checkEncryptedUpdate(t, document, prepared.Bytes(), "")
+
+			var output bytes.Buffer
+			err = Sign(bytes.NewReader(prepared.Bytes()), &output, nil, int64(prepared.Len()), SignData{
+				Signature: SignDataSignature{
+					Info: SignDataSignatureInfo{
+						Name:     "John Doe",
+						Location: "Encrypted",
+						Date:     time.Now().Local(),
+					},
+					CertType: ApprovalSignature,
+				},
+				Appearance: Appearance{
+					Visible:     true,
+					ShowDetails: true,
+				},
+				FieldName:       "Approval",
+				Signer:          pkey,
+				Certificate:     cert,
+				DigestAlgorithm: crypto.SHA256,
+				TSA:             TSA{URL: tsa.URL},
+				Profile:         PAdESBaselineLTA,
+			})
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			checkEncryptedUpdate(t, prepared.Bytes(), output.Bytes(), "")
+			verifyEncryptedSignature(t, output.Bytes(), testOwnerPassword)
+		})
+	}
+}
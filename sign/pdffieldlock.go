@@ -0,0 +1,170 @@
+package sign
+
+import (
+	"bytes"
+	"crypto"
+	"fmt"
+
+	"github.com/digitorus/pdf"
+)
+
+// digestMethod returns the DigestMethod name of a signature reference
+// dictionary (Table 253), or an empty string if there is none. The SHA-3
+// names are defined by ISO/TS 32001.
+func digestMethod(hash crypto.Hash) string {
+	switch hash {
+	case crypto.MD5:
+		return "MD5"
+	case crypto.SHA1:
+		return "SHA1"
+	case crypto.SHA256:
+		return "SHA256"
+	case crypto.SHA384:
+		return "SHA384"
+	case crypto.SHA512:
+		return "SHA512"
+	case crypto.RIPEMD160:
+		return "RIPEMD160"
+	case crypto.SHA3_256:
+		return "SHA3-256"
+	case crypto.SHA3_384:
+		return "SHA3-384"
+	case crypto.SHA3_512:
+		return "SHA3-512"
+	}
+	return ""
+}
+
+// validate checks that the lock can be written as FieldMDP transform.
+func (lock *FieldLock) validate() error {
+	switch lock.Action {
+	case LockAllFields:
+		if len(lock.Fields) > 0 {
+			return fmt.Errorf("field lock %s does not take field names", lock.Action)
+		}
+	case LockIncludedFields, LockExcludedFields:
+		if len(lock.Fields) == 0 {
+			return fmt.Errorf("field lock %s requires field names", lock.Action)
+		}
+	default:
+		return fmt.Errorf("invalid field lock action: %s", lock.Action)
+	}
+	return nil
+}
+
+// entries returns the Action and Fields entries, which are shared by the
+// signature field lock dictionary and the FieldMDP transform parameters.
+func (lock *FieldLock) entries() string {
+	var buffer bytes.Buffer
+
+	// Action [name]: (Required) A name that, along with the Fields array, describes
+	//   which form fields do not permit changes after the signature is applied.
+	//   Valid values shall be:
+	//     All - All form fields
+	//     Include - Only those form fields specified in Fields.
+	//     Exclude - Only those form fields not specified in Fields.
+	switch lock.Action {
+	case LockAllFields:
+		buffer.WriteString(" /Action /All")
+	case LockIncludedFields:
+		buffer.WriteString(" /Action /Include")
+	case LockExcludedFields:
+		buffer.WriteString(" /Action /Exclude")
+	}
+
+	// Fields [array]: (Required if Action is Include or Exclude) An array of text
+	//   strings containing field names.
+	if len(lock.Fields) > 0 {
+		buffer.WriteString(" /Fields [")
+		for i, field := range lock.Fields {
+			if i > 0 {
+				buffer.WriteString(" ")
+			}
+			buffer.WriteString(pdfString(field))
+		}
+		buffer.WriteString("]")
+	}
+
+	return buffer.String()
+}
+
+// lockDictionary returns the signature field lock dictionary (Table 233), so
+// PDF processors lock the fields when the field is signed.
+func (lock *FieldLock) lockDictionary() string {
+	return "<< /Type /SigFieldLock" + lock.entries() + " >>"
+}
+
+// fieldMDPReference returns a signature reference dictionary with the FieldMDP
+// transform method, see 12.8.2.4, "FieldMDP".
+func (context *SignContext) fieldMDPReference(lock *FieldLock) string {
+	var buffer bytes.Buffer
+
+	buffer.WriteString(" << /Type /SigRef\n")
+	buffer.WriteString("   /TransformMethod /FieldMDP\n")
+
+	// Entries in the FieldMDP transform parameters dictionary (Table 259)
+	buffer.WriteString("   /TransformParams << /Type /TransformParams")
+	buffer.WriteString(lock.entries())
+	buffer.WriteString(" /V /1.2 >>\n")
+
+	if name := digestMethod(context.SignData.DigestAlgorithm); name != "" {
+		buffer.WriteString("   /DigestMethod /" + name + "\n")
+	}
+	buffer.WriteString(" >>\n")
+
+	return buffer.String()
+}
+
+// parseFieldLock reads a signature field lock dictionary.
+func parseFieldLock(value pdf.Value) (*FieldLock, error) {
+	lock := &FieldLock{}
+
+	switch action := value.Key("Action").Name(); action {
+	case "All":
+		lock.Action = LockAllFields
+	case "Include":
+		lock.Action = LockIncludedFields
+	case "Exclude":
+		lock.Action = LockExcludedFields
+	default:
+		return nil, fmt.Errorf("invalid field lock action %q", action)
+	}
+
+	fields := value.Key("Fields")
+	for i := 0; i < fields.Len(); i++ {
+		lock.Fields = append(lock.Fields, fields.Index(i).Text())
+	}
+
+	return lock, lock.validate()
+}
+
+// resolveFieldLock determines the fields that are locked by the signature. An
+// existing signature field can specify the locked fields with its /Lock
+// dictionary, which is used unless a FieldLock is given.
+func (context *SignContext) resolveFieldLock() error {
+	if context.SignData.Signature.FieldLock == nil && context.SignData.FieldName != "" {
+		fields := context.PDFReader.Trailer().Key("Root").Key("AcroForm").Key("Fields")
+		if field, _, found := findFieldByName(fields, "", "", context.SignData.FieldName); found {
+			if value := field.Key("Lock"); !value.IsNull() {
+				lock, err := parseFieldLock(value)
+				if err != nil {
+					return fmt.Errorf("failed to parse lock of field %q: %w", context.SignData.FieldName, err)
+				}
+				context.SignData.Signature.FieldLock = lock
+			}
+		}
+	}
+
+	lock := context.SignData.Signature.FieldLock
+	if lock == nil {
+		return nil
+	}
+
+	switch context.SignData.Signature.CertType {
+	case CertificationSignature, ApprovalSignature:
+	default:
+		return fmt.Errorf("field locks are only supported for certification and approval signatures")
+	}
+
+	return lock.validate()
+}
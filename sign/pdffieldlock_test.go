@@ -0,0 +1,232 @@
+package sign
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/verify"
+)
+
+func TestSignPDFFieldLock(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	input, err := os.ReadFile("../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	var prepared bytes.Buffer
+	err = PrepareFields(bytes.NewReader(input), &prepared, []SignatureField{
+		{Name: "Locking", Page: 1, Lock: &FieldLock{Action: LockExcludedFields, Fields: []string{"Comments"}}},
+	})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	tests := []struct {
+		name       string
+		document   []byte
+		certType   CertType
+		fieldName  string
+		lock       *FieldLock
+		references []string
+		action     string
+		fields     []string
+	}{
+		{
+			name:       "approval locking all fields",
+			document:   input,
+			certType:   ApprovalSignature,
+			lock:       &FieldLock{Action: LockAllFields},
+			references: []string{"FieldMDP"},
+			action:     "All",
+		},
+		{
+			name:       "certification locking included fields",
+			document:   input,
+			certType:   CertificationSignature,
+			lock:       &FieldLock{Action: LockIncludedFields, Fields: []string{"Name", "Date"}},
+			references: []string{"DocMDP", "FieldMDP"},
+			action:     "Include",
+			fields:     []string{"Name", "Date"},
+		},
+		{
+			name:       "lock of existing field",
+			document:   prepared.Bytes(),
+			certType:   ApprovalSignature,
+			fieldName:  "Locking",
+			references: []string{"FieldMDP"},
+			action:     "Exclude",
+			fields:     []string{"Comments"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rdr, err := pdf.NewReader(bytes.NewReader(tt.document), int64(len(tt.document)))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			var output bytes.Buffer
+			err = Sign(bytes.NewReader(tt.document), &output, rdr, int64(len(tt.document)), SignData{
+				Signature: SignDataSignature{
+					Info: SignDataSignatureInfo{
+						Name: "John Doe",
+						Date: time.Now().Local(),
+					},
+					CertType:   tt.certType,
+					DocMDPPerm: AllowFillingExistingFormFieldsAndSignaturesPerms,
+					FieldLock:  tt.lock,
+				},
+				FieldName:   tt.fieldName,
+				Signer:      pkey,
+				Certificate: cert,
+			})
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			signed, err := pdf.NewReader(bytes.NewReader(output.Bytes()), int64(output.Len()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			fields := signed.Trailer().Key("Root").Key("AcroForm").Key("Fields")
+			field := fields.Index(fields.Len() - 1)
+
+			references := field.Key("V").Key("Reference")
+			if references.Len() != len(tt.references) {
+				t.Fatalf("expected %d signature references, got %d", len(tt.references), references.Len())
+			}
+			for i, method := range tt.references {
+				if got := references.Index(i).Key("TransformMethod").Name(); got != method {
+					t.Errorf("expected reference %d to use %s, got %s", i, method, got)
+				}
+			}
+
+			params := references.Index(len(tt.references) - 1).Key("TransformParams")
+			for name, dict := range map[string]pdf.Value{"transform parameters": params, "field lock": field.Key("Lock")} {
+				if got := dict.Key("Action").Name(); got != tt.action {
+					t.Errorf("expected %s action %s, got %s", name, tt.action, got)
+				}
+				if dict.Key("Fields").Len() != len(tt.fields) {
+					t.Fatalf("expected %s to contain %d fields, got %d", name, len(tt.fields), dict.Key("Fields").Len())
+				}
+				for i, fieldName := range tt.fields {
+					if got := dict.Key("Fields").Index(i).Text(); got != fieldName {
+						t.Errorf("expected %s field %q, got %q", name, fieldName, got)
+					}
+				}
+			}
+			if got := field.Key("Lock").Key("Type").Name(); got != "SigFieldLock" {
+				t.Errorf("expected a SigFieldLock dictionary, got %q", got)
+			}
+
+			info, err := verify.Verify(bytes.NewReader(output.Bytes()), int64(output.Len()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if len(info.Signers) != 1 || !info.Signers[0].ValidSignature {
+				t.Errorf("expected a single valid signature")
+			}
+		})
+	}
+}
+
+func TestVerifyFieldLock(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	input, err := os.ReadFile("../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	tests := []struct {
+		name          string
+		lock          *FieldLock
+		wantViolation bool
+	}{
+		{name: "locked field", lock: &FieldLock{Action: LockIncludedFields, Fields: []string{"Second"}}, wantViolation: true},
+		{name: "other field", lock: &FieldLock{Action: LockIncludedFields, Fields: []string{"Comments"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var document bytes.Buffer
+			err := PrepareFields(bytes.NewReader(input), &document, []SignatureField{
+				{Name: "First", Page: 1, Lock: tt.lock},
+				{Name: "Second", Page: 1},
+			})
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			// Sign the first field, then the second field it may lock.
+			for _, fieldName := range []string{"First", "Second"} {
+				rdr, err := pdf.NewReader(bytes.NewReader(document.Bytes()), int64(document.Len()))
+				if err != nil {
+					t.Fatalf("%s", err.Error())
+				}
+				var output bytes.Buffer
+				err = Sign(bytes.NewReader(document.Bytes()), &output, rdr, int64(document.Len()), SignData{
+					Signature: SignDataSignature{
+						Info: SignDataSignatureInfo{
+							Name: "John Doe",
+							Date: time.Now().Local(),
+						},
+						CertType: ApprovalSignature,
+					},
+					FieldName:   fieldName,
+					Signer:      pkey,
+					Certificate: cert,
+				})
+				if err != nil {
+					t.Fatalf("%s", err.Error())
+				}
+				document = output
+			}
+
+			info, err := verify.Verify(bytes.NewReader(document.Bytes()), int64(document.Len()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if len(info.Signers) != 2 {
+				t.Fatalf("expected 2 signatures, got %d", len(info.Signers))
+			}
+			first := info.Signers[0]
+			if len(first.FieldLocks) == 0 {
+				t.Fatalf("expected the field locks of the first signature")
+			}
+			if (len(first.FieldMDPViolations) != 0) != tt.wantViolation || first.DisallowedModifications != tt.wantViolation {
+				t.Errorf("unexpected FieldMDP violations %q", first.FieldMDPViolations)
+			}
+		})
+	}
+}
+
+func TestFieldLockValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		lock    FieldLock
+		wantErr bool
+	}{
+		{"all fields", FieldLock{Action: LockAllFields}, false},
+		{"all fields with names", FieldLock{Action: LockAllFields, Fields: []string{"A"}}, true},
+		{"included fields", FieldLock{Action: LockIncludedFields, Fields: []string{"A"}}, false},
+		{"included fields without names", FieldLock{Action: LockIncludedFields}, true},
+		{"excluded fields without names", FieldLock{Action: LockExcludedFields}, true},
+		{"missing action", FieldLock{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.lock.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package sign
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// SignatureField describes an unsigned signature field, see PrepareFields.
+type SignatureField struct {
+	Name string // Partial field name, must be unique in the document
+
+	Page        uint32
+	LowerLeftX  float64
+	LowerLeftY  float64
+	UpperRightX float64
+	UpperRightY float64
+
+	Flags     int        // Annotation flags, defaults to AnnotationFlagPrint
+	Lock      *FieldLock // Form fields that are locked once the field is signed
+	SeedValue *SeedValue // Constraints on how the field may be signed
+}
+
+// PrepareFieldsFile adds empty signature fields to a document, see PrepareFields.
+func PrepareFieldsFile(input string, output string, fields []SignatureField) error {
+	input_file, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = input_file.Close()
+	}()
+
+	output_file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = output_file.Close()
+	}()
+
+	return PrepareFields(input_file, output_file, fields)
+}
+
+// PrepareFields adds unsigned signature fields to a document in an incremental
+// update, so the document can be prepared before it reaches the signers. The
+// fields can be signed later by setting SignData.FieldName. A field with an
+// empty rectangle is invisible.
+func PrepareFields(input io.ReadSeeker, output io.Writer, fields []SignatureField) error {
+	if len(fields) == 0 {
+		return fmt.Errorf("no signature fields to add")
+	}
+
+	if _, err := input.Seek(0, 0); err != nil {
+		return err
+	}
+	document, err := io.ReadAll(input)
+	if err != nil {
+		return err
+	}
+
+	context, err := newIncrementalContext(document, SignData{})
+	if err != nil {
+		return err
+	}
+
+	if err := context.addSignatureFields(fields); err != nil {
+		return err
+	}
+
+	document, err = context.finishIncrementalUpdate()
+	if err != nil {
+		return err
+	}
+
+	_, err = output.Write(document)
+	return err
+}
+
+// addSignatureFields writes a widget annotation merged with its signature field
+// for each of the fields, and adds the widgets to their pages.
+func (context *SignContext) addSignatureFields(fields []SignatureField) error {
+	root := context.PDFReader.Trailer().Key("Root")
+	existing := root.Key("AcroForm").Key("Fields")
+
+	names := make(map[string]bool)
+	annots := make(map[uint32][]uint32)
+	var pages []uint32
+
+	for _, field := range fields {
+		if field.Name == "" {
+			return fmt.Errorf("signature field name is required")
+		}
+		if field.Lock != nil {
+			if err := field.Lock.validate(); err != nil {
+				return err
+			}
+		}
+		if names[field.Name] {
+			return fmt.Errorf("duplicate signature field name %q", field.Name)
+		}
+		if _, _, found := findFieldByName(existing, "", "", field.Name); found {
+			return fmt.Errorf("field %q already exists", field.Name)
+		}
+		names[field.Name] = true
+
+		page, err := findPageByNumber(root.Key("Pages"), field.Page)
+		if err != nil {
+			return err
+		}
+		page_ptr := page.GetPtr()
+
+		flags := field.Flags
+		if flags == 0 {
+			flags = AnnotationFlagPrint
+		}
+
+		var widget bytes.Buffer
+		widget.WriteString("<<\n")
+		widget.WriteString("  /Type /Annot\n")
+		widget.WriteString("  /Subtype /Widget\n")
+		widget.WriteString("  /FT /Sig\n")
+		widget.WriteString(fmt.Sprintf("  /T %s\n", pdfString(field.Name)))
+		widget.WriteString(fmt.Sprintf("  /Rect [%f %f %f %f]\n", field.LowerLeftX, field.LowerLeftY, field.UpperRightX, field.UpperRightY))
+		widget.WriteString(fmt.Sprintf("  /P %d %d R\n", page_ptr.GetID(), page_ptr.GetGen()))
+		widget.WriteString(fmt.Sprintf("  /F %d\n", flags))
+		if field.Lock != nil {
+			widget.WriteString("  /Lock " + field.Lock.lockDictionary() + "\n")
+		}
+		if field.SeedValue != nil {
+			widget.WriteString("  /SV " + field.SeedValue.seedValueDictionary() + "\n")
+		}
+		widget.WriteString(">>\n")
+
+		id, err := context.addObject(widget.Bytes())
+		if err != nil {
+			return fmt.Errorf("failed to add signature field object: %w", err)
+		}
+		context.preparedFields = append(context.preparedFields, id)
+
+		if _, ok := annots[field.Page]; !ok {
+			pages = append(pages, field.Page)
+		}
+		annots[field.Page] = append(annots[field.Page], id)
+	}
+
+	// Each page is updated once, with all of its new widgets.
+	for _, pageNumber := range pages {
+		page, err := findPageByNumber(root.Key("Pages"), pageNumber)
+		if err != nil {
+			return err
+		}
+		page_ptr := page.GetPtr()
+
+		inc_page_update, err := context.createIncPageUpdate(pageNumber, annots[pageNumber]...)
+		if err != nil {
+			return fmt.Errorf("failed to create incremental page update: %w", err)
+		}
+		if err := context.updateObject(page_ptr.GetID(), inc_page_update); err != nil {
+			return fmt.Errorf("failed to add incremental page update object: %w", err)
+		}
+	}
+
+	return nil
+}
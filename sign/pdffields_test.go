@@ -0,0 +1,136 @@
+package sign
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/verify"
+)
+
+func TestPrepareFields(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	input, err := os.ReadFile("../testfiles/testfile12.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	fields := []SignatureField{
+		{Name: "Author", Page: 1, LowerLeftX: 50, LowerLeftY: 50, UpperRightX: 250, UpperRightY: 100},
+		{Name: "Reviewer", Page: 1, LowerLeftX: 300, LowerLeftY: 50, UpperRightX: 500, UpperRightY: 100},
+		{Name: "Approver", Page: 2, Flags: AnnotationFlagPrint | AnnotationFlagLocked},
+	}
+
+	var prepared bytes.Buffer
+	if err := PrepareFields(bytes.NewReader(input), &prepared, fields); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	rdr, err := pdf.NewReader(bytes.NewReader(prepared.Bytes()), int64(prepared.Len()))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	acroFormFields := rdr.Trailer().Key("Root").Key("AcroForm").Key("Fields")
+	if acroFormFields.Len() != len(fields) {
+		t.Fatalf("expected %d fields, got %d", len(fields), acroFormFields.Len())
+	}
+	for i, field := range fields {
+		value := acroFormFields.Index(i)
+		if value.Key("T").Text() != field.Name || value.Key("FT").Name() != "Sig" {
+			t.Errorf("unexpected field %d: %s", i, value)
+		}
+		if !value.Key("V").IsNull() {
+			t.Errorf("expected field %q to be unsigned", field.Name)
+		}
+	}
+	if flags := acroFormFields.Index(2).Key("F").Int64(); flags != AnnotationFlagPrint|AnnotationFlagLocked {
+		t.Errorf("expected the configured annotation flags, got %d", flags)
+	}
+	if flags := acroFormFields.Index(0).Key("F").Int64(); flags != AnnotationFlagPrint {
+		t.Errorf("expected the default annotation flags, got %d", flags)
+	}
+
+	original, err := pdf.NewReader(bytes.NewReader(input), int64(len(input)))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	for page, added := range map[int]int{1: 2, 2: 1} {
+		before := original.Page(page).V.Key("Annots").Len()
+		if after := rdr.Page(page).V.Key("Annots").Len(); after != before+added {
+			t.Errorf("expected %d widgets to be added to page %d, got %d", added, page, after-before)
+		}
+	}
+
+	// The prepared fields are signed one after the other.
+	document := prepared.Bytes()
+	for _, field := range fields {
+		rdr, err := pdf.NewReader(bytes.NewReader(document), int64(len(document)))
+		if err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+
+		var output bytes.Buffer
+		err = Sign(bytes.NewReader(document), &output, rdr, int64(len(document)), SignData{
+			Signature: SignDataSignature{
+				Info: SignDataSignatureInfo{
+					Name: field.Name,
+					Date: time.Now().Local(),
+				},
+				CertType: ApprovalSignature,
+			},
+			FieldName:   field.Name,
+			Signer:      pkey,
+			Certificate: cert,
+		})
+		if err != nil {
+			t.Fatalf("failed to sign field %q: %s", field.Name, err.Error())
+		}
+		document = output.Bytes()
+	}
+
+	info, err := verify.Verify(bytes.NewReader(document), int64(len(document)))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if len(info.Signers) != len(fields) {
+		t.Fatalf("expected %d signatures, got %d", len(fields), len(info.Signers))
+	}
+	for i, signer := range info.Signers {
+		if !signer.ValidSignature {
+			t.Errorf("signature %d is not valid", i)
+		}
+	}
+}
+
+func TestPrepareFieldsErrors(t *testing.T) {
+	input, err := os.ReadFile("../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	existing := addEmptySignatureField(t, input, "Approver")
+
+	tests := []struct {
+		name     string
+		document []byte
+		fields   []SignatureField
+	}{
+		{"no fields", input, nil},
+		{"missing name", input, []SignatureField{{Page: 1}}},
+		{"duplicate name", input, []SignatureField{{Name: "A", Page: 1}, {Name: "A", Page: 1}}},
+		{"existing name", existing, []SignatureField{{Name: "Approver", Page: 1}}},
+		{"invalid page", input, []SignatureField{{Name: "A", Page: 5}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output bytes.Buffer
+			if err := PrepareFields(bytes.NewReader(tt.document), &output, tt.fields); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package sign
+
+import (
+	"io"
+
+	"github.com/digitorus/pdfsign/internal/linearization"
+)
+
+// noteLinearization calls sign_data.OnLinearized if the document in input,
+// of size bytes, is linearized, the incremental update of the signature then
+// invalidates the linearization. It cannot be restored without rewriting the
+// signed bytes.
+func noteLinearization(input io.ReadSeeker, size int64, sign_data SignData) {
+	if sign_data.OnLinearized == nil {
+		return
+	}
+	if d := linearization.Read(readerAt(input), size); d != nil && d.Valid(size) {
+		sign_data.OnLinearized(d.Length)
+	}
+}
@@ -0,0 +1,90 @@
+package sign
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdfsign/verify"
+)
+
+// linearizedDocument returns a document of one page that starts with the
+// linearization dictionary 5 of its length.
+func linearizedDocument() []byte {
+	document := bytes.NewBufferString("%PDF-1.7\n")
+	offsets := make([]int, 6)
+	for _, id := range []int{5, 1, 2, 3, 4} {
+		offsets[id] = document.Len()
+		_, _ = fmt.Fprintf(document, "%d 0 obj\n%s\nendobj\n", id, []string{
+			1: "<< /Type /Catalog /Pages 2 0 R >>",
+			2: "<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+			3: "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >>",
+			4: "<< /Producer (linearizer) >>",
+			5: "<< /Linearized 1 /L 0000000000 /H [ 0 0 ] /O 3 /E 0 /N 1 /T 0 >>",
+		}[id])
+	}
+	table := document.Len()
+	document.WriteString("xref\n0 6\n0000000000 65535 f \n")
+	for _, offset := range offsets[1:] {
+		_, _ = fmt.Fprintf(document, "%010d 00000 n \n", offset)
+	}
+	_, _ = fmt.Fprintf(document, "trailer\n<< /Size 6 /Root 1 0 R /Info 4 0 R >>\nstartxref\n%d\n%%%%EOF\n", table)
+	data := document.Bytes()
+	return bytes.Replace(data, []byte("/L 0000000000"), []byte(fmt.Sprintf("/L %010d", len(data))), 1)
+}
+
+func TestSignLinearized(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+	signData := SignData{
+		Signature: SignDataSignature{
+			Info: SignDataSignatureInfo{
+				Name: "Web",
+				Date: time.Now().Local(),
+			},
+			CertType: ApprovalSignature,
+		},
+		Signer:      pkey,
+		Certificate: cert,
+	}
+	var noted []int64
+	signData.OnLinearized = func(length int64) {
+		noted = append(noted, length)
+	}
+
+	document := linearizedDocument()
+	var output bytes.Buffer
+	if err := Sign(bytes.NewReader(document), &output, nil, int64(len(document)), signData); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if len(noted) != 1 || noted[0] != int64(len(document)) {
+		t.Errorf("expected the linearization of %d bytes to be noted, got %v", len(document), noted)
+	}
+
+	info, err := verify.Verify(bytes.NewReader(output.Bytes()), int64(output.Len()))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if l := info.Linearization; l == nil || l.Valid || l.Updates != 1 || l.Length != int64(len(document)) {
+		t.Errorf("expected the linearization to be invalidated by 1 update, got %+v", l)
+	}
+
+	// The linearization of the signed document was already invalidated, as
+	// is that of a document that is not linearized.
+	signed := output.Bytes()
+	plain, err := os.ReadFile("../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	for _, document := range [][]byte{signed, plain} {
+		noted = nil
+		output.Reset()
+		if err := Sign(bytes.NewReader(document), &output, nil, int64(len(document)), signData); err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+		if len(noted) != 0 {
+			t.Errorf("expected no linearization to be noted, got %v", noted)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package sign
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/digitorus/pdf"
+)
+
+// xmpDate matches the modification and metadata dates of XMP metadata, from
+// the start tag of an element to its end tag or as an attribute, with the xmp
+// prefix or the older xap prefix.
+var xmpDate = regexp.MustCompile(`<((?:xmp|xap):(?:ModifyDate|MetadataDate))>[^<]*<|(\s)((?:xmp|xap):(?:ModifyDate|MetadataDate))\s*=\s*(?:"[^"]*"|'[^']*')`)
+
+// xmpHistory matches the history of XMP metadata, xmpHistorySeq the start of
+// its sequence of events, which may be empty.
+var (
+	xmpHistory    = regexp.MustCompile(`<(?:xmp|xap)MM:History[\s/>]`)
+	xmpHistorySeq = regexp.MustCompile(`<(?:xmp|xap)MM:History>\s*(<rdf:Seq\s*(/?)>)`)
+)
+
+// xmpRDFEnd matches the end of the RDF of XMP metadata.
+var xmpRDFEnd = regexp.MustCompile(`</rdf:RDF\s*>`)
+
+// updateMetadata sets the modification date of the document information
+// dictionary and of the XMP metadata of the catalog to the signing date, and
+// records the signer and the conformance of the signature in the history of
+// the XMP metadata, so the metadata of the signed revision agrees with its
+// signature. A document without document information gets a new dictionary,
+// XMP metadata is only updated if the document has it.
+func (context *SignContext) updateMetadata() error {
+	date := context.SignData.Signature.Info.Date
+	if date.IsZero() {
+		date = context.signingTime()
+	}
+
+	info := context.PDFReader.Trailer().Key("Info")
+	if info.IsNull() {
+		id, err := context.addObject(context.updatedInfo(info, date))
+		if err != nil {
+			return err
+		}
+		context.InfoData.ObjectId = id
+	} else if ptr := info.GetPtr(); info.Kind() == pdf.Dict && ptr.GetID() != 0 {
+		if err := context.updateObject(ptr.GetID(), context.updatedInfo(info, date)); err != nil {
+			return err
+		}
+	}
+
+	metadata := context.PDFReader.Trailer().Key("Root").Key("Metadata")
+	if ptr := metadata.GetPtr(); metadata.Kind() == pdf.Stream && ptr.GetID() != 0 {
+		metadataObject, err := updatedXMP(metadata, date, context.signerName(), context.conformance())
+		if err != nil {
+			return fmt.Errorf("failed to read XMP metadata: %w", err)
+		}
+		if err := context.updateObject(ptr.GetID(), metadataObject); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updatedInfo returns the document information dictionary info with the
+// modification date date. The strings are written as hexadecimal strings, so
+// they are kept as they are whatever their characters.
+func (context *SignContext) updatedInfo(info pdf.Value, date time.Time) []byte {
+	var buffer bytes.Buffer
+	ptr := info.GetPtr()
+	buffer.WriteString("<<\n")
+	for _, key := range info.Keys() {
+		if key == "ModDate" {
+			continue
+		}
+		_, _ = fmt.Fprintf(&buffer, "  /%s ", key)
+		if value := info.Key(key); value.Kind() == pdf.String {
+			buffer.Write(hexString([]byte(value.RawString())))
+		} else {
+			context.serializeCatalogEntry(&buffer, ptr.GetID(), value)
+		}
+		buffer.WriteString("\n")
+	}
+	buffer.WriteString("  /ModDate " + pdfDateTime(date) + "\n")
+	buffer.WriteString(">>\n")
+	return buffer.Bytes()
+}
+
+// signerName returns the name of the signer, the name of the signature or the
+// common name of the signing certificate.
+func (context *SignContext) signerName() string {
+	if name := context.SignData.Signature.Info.Name; name != "" {
+		return name
+	}
+	if certificate := context.SignData.Certificate; certificate != nil {
+		return certificate.Subject.CommonName
+	}
+	return ""
+}
+
+// conformance returns a hint of what the signature conforms to, its PAdES
+// baseline level or its SubFilter.
+func (context *SignContext) conformance() string {
+	if context.SignData.Signature.CertType == TimeStampSignature {
+		return "ETSI.RFC3161"
+	}
+	if context.SignData.Profile != 0 {
+		return context.SignData.Profile.String()
+	}
+	return context.subFilter()
+}
+
+// updatedXMP returns the metadata stream object of the XMP metadata updated
+// by updateXMP. The stream is written without filters, as PDF/A requires for
+// metadata streams.
+func updatedXMP(metadata pdf.Value, date time.Time, signer, conformance string) ([]byte, error) {
+	data, err := io.ReadAll(metadata.Reader())
+	if err != nil {
+		return nil, err
+	}
+	data, err = updateXMP(data, date, signer, conformance)
+	if err != nil {
+		return nil, err
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString("<<\n")
+	buffer.WriteString("  /Type /Metadata\n")
+	buffer.WriteString("  /Subtype /XML\n")
+	buffer.WriteString("  /Length " + strconv.Itoa(len(data)) + "\n")
+	buffer.WriteString(">>\nstream\n")
+	buffer.Write(data)
+	buffer.WriteString("\nendstream\n")
+	return buffer.Bytes(), nil
+}
+
+// updateXMP sets the xmp:ModifyDate and xmp:MetadataDate of the XMP metadata
+// to date, and appends a "signed" event with the signer and the conformance
+// to its xmpMM:History. The event only uses the fields of the resource event
+// type that PDF/A-1 knows, as PDF/A forbids undeclared properties. Metadata
+// without these properties gets a description with them.
+func updateXMP(data []byte, date time.Time, signer, conformance string) ([]byte, error) {
+	if !xmpRDFEnd.Match(data) {
+		return nil, errors.New("no RDF found")
+	}
+
+	xmpDateText := date.Format(time.RFC3339)
+	found := map[string]bool{}
+	data = xmpDate.ReplaceAllFunc(data, func(m []byte) []byte {
+		sub := xmpDate.FindSubmatch(m)
+		if name := string(sub[1]); name != "" {
+			found[name[len("xmp:"):]] = true
+			return []byte("<" + name + ">" + xmpDateText + "<")
+		}
+		name := string(sub[3])
+		found[name[len("xmp:"):]] = true
+		return []byte(string(sub[2]) + name + `="` + xmpDateText + `"`)
+	})
+
+	var event bytes.Buffer
+	event.WriteString(`<rdf:li rdf:parseType="Resource" xmlns:stEvt="http://ns.adobe.com/xap/1.0/sType/ResourceEvent#">`)
+	event.WriteString("<stEvt:action>signed</stEvt:action>")
+	event.WriteString("<stEvt:when>" + xmpDateText + "</stEvt:when>")
+	event.WriteString("<stEvt:softwareAgent>pdfsign</stEvt:softwareAgent>")
+	event.WriteString("<stEvt:parameters>")
+	if signer != "" {
+		event.WriteString("by ")
+		_ = xml.EscapeText(&event, []byte(signer))
+		event.WriteString(", ")
+	}
+	_ = xml.EscapeText(&event, []byte(conformance))
+	event.WriteString("</stEvt:parameters>")
+	event.WriteString("</rdf:li>")
+
+	var missing bytes.Buffer
+	var namespaces string
+	for _, name := range []string{"ModifyDate", "MetadataDate"} {
+		if !found[name] {
+			_, _ = fmt.Fprintf(&missing, "<xmp:%s>%s</xmp:%s>", name, xmpDateText, name)
+			namespaces = ` xmlns:xmp="http://ns.adobe.com/xap/1.0/"`
+		}
+	}
+
+	if history := xmpHistorySeq.FindSubmatchIndex(data); history != nil {
+		if history[5] > history[4] {
+			// An empty sequence, written as <rdf:Seq/>.
+			seq := "<rdf:Seq>" + event.String() + "</rdf:Seq>"
+			data = append(data[:history[2]:history[2]], append([]byte(seq), data[history[3]:]...)...)
+		} else {
+			end := bytes.Index(data[history[1]:], []byte("</rdf:Seq>"))
+			if end < 0 {
+				return nil, errors.New("unterminated xmpMM:History")
+			}
+			end += history[1]
+			data = append(data[:end:end], append(event.Bytes(), data[end:]...)...)
+		}
+	} else if xmpHistory.Match(data) {
+		return nil, errors.New("unsupported xmpMM:History, it is not a sequence")
+	} else {
+		missing.WriteString("<xmpMM:History><rdf:Seq>" + event.String() + "</rdf:Seq></xmpMM:History>")
+		namespaces += ` xmlns:xmpMM="http://ns.adobe.com/xap/1.0/mm/"`
+	}
+
+	if missing.Len() > 0 {
+		description := `<rdf:Description rdf:about=""` + namespaces + ">" + missing.String() + "</rdf:Description>\n"
+		end := xmpRDFEnd.FindIndex(data)
+		data = append(data[:end[0]:end[0]], append([]byte(description), data[end[0]:]...)...)
+	}
+	return data, nil
+}
@@ -0,0 +1,212 @@
+package sign
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdfsign/internal/xref"
+	"github.com/digitorus/pdfsign/verify"
+)
+
+func TestSignUpdateMetadata(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+	date := time.Date(2026, 3, 14, 15, 9, 26, 0, time.FixedZone("CET", 3600))
+
+	tests := []struct {
+		file     string
+		producer string // Producer of the document information, kept as it is
+		xmp      bool
+	}{
+		{"testfile16.pdf", "Acrobat Distiller 10.1.2 (Windows)", true},
+		{"testfile20.pdf", "", true},                      // Has no document information and uses the xap prefix
+		{"testfile30.pdf", "Adobe PDF Library 9.0", true}, // Is signed and has a cross-reference stream
+		{"testfile12.pdf", "[ClibPDF Library 0.96] NEXTSTEP or OPENSTEP", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			document, err := os.ReadFile("../testfiles/" + tt.file)
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			rdr, err := xref.NewReader(bytes.NewReader(document), int64(len(document)))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			original := rdr.Trailer().Key("Root").Key("Metadata")
+			if original.IsNull() == tt.xmp {
+				t.Fatalf("expected XMP metadata %v", tt.xmp)
+			}
+			originalXMP, _ := io.ReadAll(original.Reader())
+
+			var output bytes.Buffer
+			err = Sign(bytes.NewReader(document), &output, nil, int64(len(document)), SignData{
+				Signature: SignDataSignature{
+					Info: SignDataSignatureInfo{
+						Name: "Registrar",
+						Date: date,
+					},
+					CertType: ApprovalSignature,
+				},
+				Signer:         pkey,
+				Certificate:    cert,
+				UpdateMetadata: true,
+			})
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			rdr, err = xref.NewReader(bytes.NewReader(output.Bytes()), int64(output.Len()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			info := rdr.Trailer().Key("Info")
+			if modDate := info.Key("ModDate").Text(); modDate != "D:20260314150926+01'00'" {
+				t.Errorf("expected the modification date of the signature, got %q", modDate)
+			}
+			if producer := info.Key("Producer").Text(); producer != tt.producer {
+				t.Errorf("expected the producer %q, got %q", tt.producer, producer)
+			}
+
+			metadata := rdr.Trailer().Key("Root").Key("Metadata")
+			if tt.xmp {
+				data, err := io.ReadAll(metadata.Reader())
+				if err != nil {
+					t.Fatalf("%s", err.Error())
+				}
+				// The dates are replaced and the signing is added to the
+				// history, the rest of the metadata is kept as it is.
+				want := string(originalXMP)
+				for _, name := range []string{"xmp:ModifyDate", "xmp:MetadataDate", "xap:ModifyDate", "xap:MetadataDate"} {
+					start := strings.Index(want, "<"+name+">")
+					if start < 0 {
+						continue
+					}
+					start += len(name) + 2
+					end := start + strings.Index(want[start:], "</"+name+">")
+					want = want[:start] + "2026-03-14T15:09:26+01:00" + want[end:]
+				}
+				end := strings.LastIndex(want, "</rdf:RDF>")
+				want = want[:end] + `<rdf:Description rdf:about="" xmlns:xmpMM="http://ns.adobe.com/xap/1.0/mm/"><xmpMM:History><rdf:Seq>` +
+					`<rdf:li rdf:parseType="Resource" xmlns:stEvt="http://ns.adobe.com/xap/1.0/sType/ResourceEvent#">` +
+					`<stEvt:action>signed</stEvt:action><stEvt:when>2026-03-14T15:09:26+01:00</stEvt:when>` +
+					`<stEvt:softwareAgent>pdfsign</stEvt:softwareAgent><stEvt:parameters>by Registrar, adbe.pkcs7.detached</stEvt:parameters>` +
+					"</rdf:li></rdf:Seq></xmpMM:History></rdf:Description>\n" + want[end:]
+				if string(data) != want {
+					t.Errorf("unexpected XMP metadata\n%s\nexpected\n%s", data, want)
+				}
+				if !metadata.Key("Filter").IsNull() || metadata.Key("Subtype").Name() != "XML" {
+					t.Errorf("expected an unfiltered XML metadata stream, got %v", metadata)
+				}
+			} else if !metadata.IsNull() {
+				t.Errorf("expected no XMP metadata to be added, got %v", metadata)
+			}
+
+			response, err := verify.Verify(bytes.NewReader(output.Bytes()), int64(output.Len()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			signer := response.Signers[len(response.Signers)-1]
+			if !signer.ValidSignature || signer.Name != "Registrar" {
+				t.Fatalf("expected a valid signature of the registrar, got %+v", signer)
+			}
+			if !response.DocumentInfo.ModDate.Equal(date) {
+				t.Errorf("expected the modification date %v, got %v", date, response.DocumentInfo.ModDate)
+			}
+		})
+	}
+}
+
+func TestSignWithoutUpdateMetadata(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+	document, err := os.ReadFile("../testfiles/testfile16.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	var output bytes.Buffer
+	err = Sign(bytes.NewReader(document), &output, nil, int64(len(document)), SignData{
+		Signature: SignDataSignature{
+			Info: SignDataSignatureInfo{
+				Name: "Registrar",
+				Date: time.Now().Local(),
+			},
+			CertType: ApprovalSignature,
+		},
+		Signer:      pkey,
+		Certificate: cert,
+	})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	update := output.String()[len(document):]
+	if strings.Contains(update, "/ModDate") || strings.Contains(update, "/Type /Metadata") {
+		t.Errorf("expected the metadata to be left as it is")
+	}
+}
+
+func TestUpdateXMP(t *testing.T) {
+	date := time.Date(2026, 3, 14, 15, 9, 26, 0, time.UTC)
+	event := `<rdf:li rdf:parseType="Resource" xmlns:stEvt="http://ns.adobe.com/xap/1.0/sType/ResourceEvent#">` +
+		`<stEvt:action>signed</stEvt:action><stEvt:when>2026-03-14T15:09:26Z</stEvt:when>` +
+		`<stEvt:softwareAgent>pdfsign</stEvt:softwareAgent><stEvt:parameters>by A &amp; B, PAdESBaselineT</stEvt:parameters></rdf:li>`
+
+	tests := []struct {
+		name    string
+		xmp     string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "elements",
+			xmp: "<rdf:RDF><rdf:Description>\n  <xmp:ModifyDate>2012-05-30T10:46:47-07:00</xmp:ModifyDate>\n" +
+				"  <xmp:MetadataDate>2012-05-30T10:46:47-07:00</xmp:MetadataDate>\n" +
+				"  <xmpMM:History><rdf:Seq><rdf:li>created</rdf:li></rdf:Seq></xmpMM:History>\n</rdf:Description></rdf:RDF>",
+			want: "<rdf:RDF><rdf:Description>\n  <xmp:ModifyDate>2026-03-14T15:09:26Z</xmp:ModifyDate>\n" +
+				"  <xmp:MetadataDate>2026-03-14T15:09:26Z</xmp:MetadataDate>\n" +
+				"  <xmpMM:History><rdf:Seq><rdf:li>created</rdf:li>" + event + "</rdf:Seq></xmpMM:History>\n</rdf:Description></rdf:RDF>",
+		},
+		{
+			name: "attributes",
+			xmp:  `<rdf:RDF><rdf:Description xap:ModifyDate='2017' xap:MetadataDate = "2017"><xapMM:History> <rdf:Seq/></xapMM:History></rdf:Description></rdf:RDF>`,
+			want: `<rdf:RDF><rdf:Description xap:ModifyDate="2026-03-14T15:09:26Z" xap:MetadataDate="2026-03-14T15:09:26Z"><xapMM:History> <rdf:Seq>` + event + `</rdf:Seq></xapMM:History></rdf:Description></rdf:RDF>`,
+		},
+		{
+			name: "missing",
+			xmp:  "<rdf:RDF><rdf:Description><dc:format>application/pdf</dc:format></rdf:Description></rdf:RDF>",
+			want: `<rdf:RDF><rdf:Description><dc:format>application/pdf</dc:format></rdf:Description><rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmlns:xmpMM="http://ns.adobe.com/xap/1.0/mm/">` +
+				"<xmp:ModifyDate>2026-03-14T15:09:26Z</xmp:ModifyDate><xmp:MetadataDate>2026-03-14T15:09:26Z</xmp:MetadataDate>" +
+				"<xmpMM:History><rdf:Seq>" + event + "</rdf:Seq></xmpMM:History></rdf:Description>\n</rdf:RDF>",
+		},
+		{
+			name:    "history is not a sequence",
+			xmp:     "<rdf:RDF><rdf:Description><xmpMM:History>created</xmpMM:History></rdf:Description></rdf:RDF>",
+			wantErr: "unsupported xmpMM:History",
+		},
+		{
+			name:    "no RDF",
+			xmp:     "<x:xmpmeta/>",
+			wantErr: "no RDF found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := updateXMP([]byte(tt.xmp), date, "A & B", PAdESBaselineT.String())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if string(data) != tt.want {
+				t.Errorf("unexpected XMP metadata\n%s\nexpected\n%s", data, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package sign
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/internal/xref"
+)
+
+// repairDocument returns input, rdr and size, or with sign_data.RepairXref,
+// if the cross-reference table of the document can not be read or gives
+// wrong offsets, the document with the cross-reference section rebuilt by
+// xref.Repair appended, its reader and size. The rebuilt section becomes
+// part of the signed document, so the incremental update refers to it.
+func repairDocument(input io.ReadSeeker, rdr *pdf.Reader, size int64, sign_data SignData) (io.ReadSeeker, *pdf.Reader, int64, error) {
+	if !sign_data.RepairXref {
+		return input, rdr, size, nil
+	}
+	f := readerAt(input)
+	if rdr == nil {
+		r, err := openReader(f, size)
+		if err == nil && xref.Check(r) == nil {
+			return input, r, size, nil
+		}
+	} else if xref.Check(rdr) == nil {
+		return input, rdr, size, nil
+	}
+
+	repaired, section, err := xref.Repair(f, size)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to repair the cross-reference table: %w", err)
+	}
+	return xref.Concat(f, size, section), repaired, size + int64(len(section)), nil
+}
+
+// openReader returns xref.NewReader of f, with the panics of malformed
+// documents returned as errors.
+func openReader(f io.ReaderAt, size int64) (rdr *pdf.Reader, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			rdr, err = nil, fmt.Errorf("%v", r)
+		}
+	}()
+	return xref.NewReader(f, size)
+}
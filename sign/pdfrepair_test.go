@@ -0,0 +1,100 @@
+package sign
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/internal/xref"
+	"github.com/digitorus/pdfsign/verify"
+)
+
+// brokenXrefDocument returns a document whose cross-reference table gives
+// offsets that are off by 10 bytes.
+func brokenXrefDocument() []byte {
+	document := bytes.NewBufferString("%PDF-1.4\n")
+	offsets := make([]int, 5)
+	for id, object := range []string{
+		1: "<< /Type /Catalog /Pages 2 0 R >>",
+		2: "<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		3: "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >>",
+		4: "<< /Producer (scanner) >>",
+	} {
+		if object != "" {
+			offsets[id] = document.Len()
+			_, _ = fmt.Fprintf(document, "%d 0 obj\n%s\nendobj\n", id, object)
+		}
+	}
+	table := document.Len()
+	document.WriteString("xref\n0 5\n0000000000 65535 f \n")
+	for _, offset := range offsets[1:] {
+		_, _ = fmt.Fprintf(document, "%010d 00000 n \n", offset+10)
+	}
+	_, _ = fmt.Fprintf(document, "trailer\n<< /Size 5 /Root 1 0 R /Info 4 0 R >>\nstartxref\n%d\n%%%%EOF\n", table)
+	return document.Bytes()
+}
+
+func TestSignRepairXref(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+	document := brokenXrefDocument()
+	signData := SignData{
+		Signature: SignDataSignature{
+			Info: SignDataSignatureInfo{
+				Name: "Scanner",
+				Date: time.Now().Local(),
+			},
+			CertType: ApprovalSignature,
+		},
+		Signer:      pkey,
+		Certificate: cert,
+	}
+
+	rdr, err := pdf.NewReader(bytes.NewReader(document), int64(len(document)))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if xref.Check(rdr) == nil {
+		t.Fatalf("expected the cross-reference table to be corrupt")
+	}
+
+	var output bytes.Buffer
+	signData.RepairXref = true
+	if err := Sign(bytes.NewReader(document), &output, nil, int64(len(document)), signData); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	signed := output.Bytes()
+	if !bytes.HasPrefix(signed, document) {
+		t.Fatalf("expected the original document to be kept")
+	}
+
+	// The signed document is read without repair, the signature covers the
+	// rebuilt section.
+	info, err := verify.Verify(bytes.NewReader(signed), int64(len(signed)))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if info.XrefRepaired {
+		t.Errorf("expected the signed document to be read without repair")
+	}
+	if info.DocumentInfo.Producer != "scanner" {
+		t.Errorf("expected the document information of the document, got %q", info.DocumentInfo.Producer)
+	}
+	if len(info.Signers) != 1 {
+		t.Fatalf("expected 1 signer, got %d", len(info.Signers))
+	}
+	if signer := info.Signers[0]; !signer.ValidSignature || signer.DisallowedModifications {
+		t.Errorf("expected a valid signature, got %+v", signer)
+	}
+
+	// The signed document is sound, it is signed again without another
+	// rebuilt section.
+	output.Reset()
+	if err := Sign(bytes.NewReader(signed), &output, nil, int64(len(signed)), signData); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if sections := bytes.Count(output.Bytes(), []byte("/W [1 8 2]")); sections != 1 {
+		t.Errorf("expected 1 rebuilt section, got %d", sections)
+	}
+}
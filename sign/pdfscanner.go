@@ -0,0 +1,540 @@
+package sign
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strconv"
+)
+
+// pdfScanner is a lexer for the PDF syntax that keeps the offsets of the
+// tokens. pdf.Reader hides the byte positions of objects, they are needed to
+// decrypt and encrypt the strings and streams of a document in place.
+type pdfScanner struct {
+	data []byte
+	pos  int
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenKeyword
+	tokenNumber
+	tokenName
+	tokenString
+	tokenDictOpen
+	tokenDictClose
+	tokenArrayOpen
+	tokenArrayClose
+)
+
+type pdfToken struct {
+	kind       tokenKind
+	start, end int
+	value      []byte // Decoded string or name, the text of numbers and keywords
+}
+
+type nodeKind int
+
+const (
+	nodeKeyword nodeKind = iota // true, false, null and unknown keywords
+	nodeNumber
+	nodeName
+	nodeString
+	nodeArray
+	nodeDict
+	nodeRef
+)
+
+// pdfNode is a parsed PDF value and its position in the scanned data.
+type pdfNode struct {
+	kind       nodeKind
+	start, end int
+	value      []byte
+	items      []*pdfNode // Array elements, alternating keys and values of a dictionary, or the numbers of a reference
+}
+
+// pdfObject is an indirect object, the stream data of a stream object is
+// data[streamStart:streamEnd].
+type pdfObject struct {
+	id, gen                uint32
+	start, end             int
+	value                  *pdfNode
+	stream                 bool
+	streamStart, streamEnd int
+}
+
+// maxNesting limits the nesting of arrays and dictionaries.
+const maxNesting = 256
+
+func isWhitespace(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+func isDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func isInteger(value []byte) bool {
+	if len(value) > 0 && (value[0] == '+' || value[0] == '-') {
+		value = value[1:]
+	}
+	if len(value) == 0 {
+		return false
+	}
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isNumber(value []byte) bool {
+	digits := 0
+	for i, c := range value {
+		switch {
+		case c >= '0' && c <= '9':
+			digits++
+		case (c == '+' || c == '-') && i == 0, c == '.':
+		default:
+			return false
+		}
+	}
+	return digits > 0
+}
+
+// skipSpace skips whitespace and comments.
+func (s *pdfScanner) skipSpace() {
+	for s.pos < len(s.data) {
+		c := s.data[s.pos]
+		switch {
+		case isWhitespace(c):
+			s.pos++
+		case c == '%':
+			for s.pos < len(s.data) && s.data[s.pos] != '\n' && s.data[s.pos] != '\r' {
+				s.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (s *pdfScanner) next() pdfToken {
+	s.skipSpace()
+	start := s.pos
+	if s.pos >= len(s.data) {
+		return pdfToken{kind: tokenEOF, start: start, end: start}
+	}
+
+	c := s.data[s.pos]
+	token := pdfToken{start: start}
+	switch {
+	case c == '(':
+		token.kind = tokenString
+		token.value = s.literalString()
+	case c == '<' && s.pos+1 < len(s.data) && s.data[s.pos+1] == '<':
+		token.kind = tokenDictOpen
+		s.pos += 2
+	case c == '<':
+		token.kind = tokenString
+		token.value = s.hexString()
+	case c == '>' && s.pos+1 < len(s.data) && s.data[s.pos+1] == '>':
+		token.kind = tokenDictClose
+		s.pos += 2
+	case c == '[':
+		token.kind = tokenArrayOpen
+		s.pos++
+	case c == ']':
+		token.kind = tokenArrayClose
+		s.pos++
+	case c == '/':
+		token.kind = tokenName
+		s.pos++
+		token.value = s.name()
+	case isDelimiter(c):
+		// Stray delimiters are returned as keywords.
+		token.kind = tokenKeyword
+		s.pos++
+		token.value = []byte{c}
+	default:
+		for s.pos < len(s.data) && !isWhitespace(s.data[s.pos]) && !isDelimiter(s.data[s.pos]) {
+			s.pos++
+		}
+		token.value = s.data[start:s.pos]
+		token.kind = tokenKeyword
+		if isNumber(token.value) {
+			token.kind = tokenNumber
+		}
+	}
+	token.end = s.pos
+	return token
+}
+
+func (s *pdfScanner) literalString() []byte {
+	var value []byte
+	depth := 0
+	s.pos++
+	for s.pos < len(s.data) {
+		c := s.data[s.pos]
+		s.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return value
+			}
+			depth--
+		case '\r':
+			// An end-of-line marker in a string is read as a line feed.
+			if s.pos < len(s.data) && s.data[s.pos] == '\n' {
+				s.pos++
+			}
+			c = '\n'
+		case '\\':
+			if s.pos >= len(s.data) {
+				return value
+			}
+			c = s.data[s.pos]
+			s.pos++
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if s.pos < len(s.data) && s.data[s.pos] == '\n' {
+					s.pos++
+				}
+				continue
+			case '\n':
+				continue
+			case '0', '1', '2', '3', '4', '5', '6', '7':
+				octal := int(c - '0')
+				for i := 0; i < 2 && s.pos < len(s.data) && s.data[s.pos] >= '0' && s.data[s.pos] <= '7'; i++ {
+					octal = octal*8 + int(s.data[s.pos]-'0')
+					s.pos++
+				}
+				c = byte(octal)
+			}
+		}
+		value = append(value, c)
+	}
+	return value
+}
+
+func (s *pdfScanner) hexString() []byte {
+	var digits []byte
+	s.pos++
+	for s.pos < len(s.data) && s.data[s.pos] != '>' {
+		if c := s.data[s.pos]; !isWhitespace(c) {
+			digits = append(digits, c)
+		}
+		s.pos++
+	}
+	s.pos++
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	value := make([]byte, len(digits)/2)
+	// Invalid digits are ignored, like readers do.
+	n, _ := hex.Decode(value, digits)
+	return value[:n]
+}
+
+func (s *pdfScanner) name() []byte {
+	var value []byte
+	for s.pos < len(s.data) && !isWhitespace(s.data[s.pos]) && !isDelimiter(s.data[s.pos]) {
+		c := s.data[s.pos]
+		s.pos++
+		if c == '#' && s.pos+1 < len(s.data) {
+			if b, err := hex.DecodeString(string(s.data[s.pos : s.pos+2])); err == nil {
+				c = b[0]
+				s.pos += 2
+			}
+		}
+		value = append(value, c)
+	}
+	return value
+}
+
+// isObjectEnd reports whether a keyword ends the value of an object, it stops
+// the parsing of unterminated arrays and dictionaries.
+func isObjectEnd(token pdfToken) bool {
+	if token.kind == tokenEOF {
+		return true
+	}
+	if token.kind != tokenKeyword {
+		return false
+	}
+	switch string(token.value) {
+	case "obj", "endobj", "stream", "endstream", "xref", "trailer", "startxref":
+		return true
+	}
+	return false
+}
+
+// parseValue parses the value that starts with token.
+func (s *pdfScanner) parseValue(token pdfToken, depth int) *pdfNode {
+	node := &pdfNode{start: token.start, end: token.end, value: token.value}
+	switch token.kind {
+	case tokenNumber:
+		node.kind = nodeNumber
+		if !isInteger(token.value) {
+			break
+		}
+		pos := s.pos
+		generation := s.next()
+		r := s.next()
+		if generation.kind == tokenNumber && isInteger(generation.value) && r.kind == tokenKeyword && string(r.value) == "R" {
+			node.kind = nodeRef
+			node.items = []*pdfNode{
+				{kind: nodeNumber, start: token.start, end: token.end, value: token.value},
+				{kind: nodeNumber, start: generation.start, end: generation.end, value: generation.value},
+			}
+			node.end = r.end
+			break
+		}
+		s.pos = pos
+	case tokenName:
+		node.kind = nodeName
+	case tokenString:
+		node.kind = nodeString
+	case tokenArrayOpen, tokenDictOpen:
+		node.kind = nodeArray
+		closing := tokenArrayClose
+		if token.kind == tokenDictOpen {
+			node.kind = nodeDict
+			closing = tokenDictClose
+		}
+		node.value = nil
+		for depth < maxNesting {
+			item := s.next()
+			if item.kind == closing {
+				node.end = item.end
+				break
+			}
+			if isObjectEnd(item) {
+				s.pos = item.start
+				break
+			}
+			node.items = append(node.items, s.parseValue(item, depth+1))
+			node.end = s.pos
+		}
+		if node.kind == nodeDict && len(node.items)%2 == 1 {
+			node.items = node.items[:len(node.items)-1]
+		}
+	default:
+		node.kind = nodeKeyword
+	}
+	return node
+}
+
+// get returns the value of key in a dictionary, or nil.
+func (n *pdfNode) get(key string) *pdfNode {
+	if n == nil || n.kind != nodeDict {
+		return nil
+	}
+	for i := 0; i+1 < len(n.items); i += 2 {
+		if n.items[i].kind == nodeName && string(n.items[i].value) == key {
+			return n.items[i+1]
+		}
+	}
+	return nil
+}
+
+// keyNode returns the key node of key in a dictionary, or nil.
+func (n *pdfNode) keyNode(key string) *pdfNode {
+	if n == nil || n.kind != nodeDict {
+		return nil
+	}
+	for i := 0; i+1 < len(n.items); i += 2 {
+		if n.items[i].kind == nodeName && string(n.items[i].value) == key {
+			return n.items[i]
+		}
+	}
+	return nil
+}
+
+func (n *pdfNode) isName(name string) bool {
+	return n != nil && n.kind == nodeName && string(n.value) == name
+}
+
+// text returns the value of a name, string, number or keyword.
+func (n *pdfNode) text() string {
+	if n == nil {
+		return ""
+	}
+	return string(n.value)
+}
+
+func (n *pdfNode) int() (int64, bool) {
+	if n == nil || n.kind != nodeNumber || !isInteger(n.value) {
+		return 0, false
+	}
+	value, err := strconv.ParseInt(string(n.value), 10, 64)
+	return value, err == nil
+}
+
+// ref returns the object number and generation of a reference.
+func (n *pdfNode) ref() (uint32, uint32, bool) {
+	if n == nil || n.kind != nodeRef {
+		return 0, 0, false
+	}
+	id, err := strconv.ParseUint(string(n.items[0].value), 10, 32)
+	if err != nil {
+		return 0, 0, false
+	}
+	gen, err := strconv.ParseUint(string(n.items[1].value), 10, 16)
+	if err != nil {
+		return 0, 0, false
+	}
+	return uint32(id), uint32(gen), true
+}
+
+// endsStream reports whether endstream follows the stream data that ends at
+// end, the end-of-line marker before it is optional.
+func endsStream(data []byte, end int) bool {
+	if end < 0 || end > len(data) {
+		return false
+	}
+	for end < len(data) && isWhitespace(data[end]) {
+		end++
+	}
+	return bytes.HasPrefix(data[end:], []byte("endstream"))
+}
+
+// object parses the indirect object that starts with the object number in
+// token, or returns nil if token does not start an object.
+func (s *pdfScanner) object(token pdfToken) *pdfObject {
+	pos := s.pos
+	generation := s.next()
+	keyword := s.next()
+	if !isInteger(token.value) || generation.kind != tokenNumber || !isInteger(generation.value) || keyword.kind != tokenKeyword || string(keyword.value) != "obj" {
+		s.pos = pos
+		return nil
+	}
+	id, err := strconv.ParseUint(string(token.value), 10, 32)
+	if err != nil {
+		s.pos = pos
+		return nil
+	}
+	gen, err := strconv.ParseUint(string(generation.value), 10, 16)
+	if err != nil {
+		s.pos = pos
+		return nil
+	}
+
+	object := &pdfObject{id: uint32(id), gen: uint32(gen), start: token.start}
+	object.value = s.parseValue(s.next(), 0)
+
+	next := s.next()
+	if next.kind == tokenKeyword && string(next.value) == "stream" {
+		// The keyword stream is followed by CRLF or LF.
+		start := next.end
+		if start < len(s.data) && s.data[start] == '\r' {
+			start++
+		}
+		if start < len(s.data) && s.data[start] == '\n' {
+			start++
+		}
+		object.stream = true
+		object.streamStart = start
+
+		length, ok := object.value.get("Length").int()
+		if end := start + int(length); ok && length >= 0 && endsStream(s.data, end) {
+			object.streamEnd = end
+		} else {
+			// Indirect or invalid lengths, the data ends before endstream.
+			i := bytes.Index(s.data[start:], []byte("endstream"))
+			if i < 0 {
+				i = len(s.data) - start
+			}
+			end := start + i
+			if end > start && s.data[end-1] == '\n' {
+				end--
+			}
+			if end > start && s.data[end-1] == '\r' {
+				end--
+			}
+			object.streamEnd = end
+		}
+
+		s.pos = object.streamEnd
+		for s.pos < len(s.data) && isWhitespace(s.data[s.pos]) {
+			s.pos++
+		}
+		if bytes.HasPrefix(s.data[s.pos:], []byte("endstream")) {
+			s.pos += len("endstream")
+		}
+		next = s.next()
+	}
+
+	if next.kind == tokenKeyword && string(next.value) == "endobj" {
+		object.end = next.end
+	} else {
+		s.pos = next.start
+		object.end = next.start
+	}
+	return object
+}
+
+// scanPDF returns the indirect objects and the trailer dictionaries of a
+// document in the order of the file.
+func scanPDF(data []byte) ([]*pdfObject, []*pdfNode) {
+	var objects []*pdfObject
+	var trailers []*pdfNode
+
+	s := &pdfScanner{data: data}
+	for {
+		token := s.next()
+		switch {
+		case token.kind == tokenEOF:
+			resolveStreamLengths(data, objects)
+			return objects, trailers
+		case token.kind == tokenKeyword && string(token.value) == "trailer":
+			if trailer := s.parseValue(s.next(), 0); trailer.kind == nodeDict {
+				trailers = append(trailers, trailer)
+			}
+		case token.kind == tokenNumber:
+			if object := s.object(token); object != nil {
+				objects = append(objects, object)
+			}
+		}
+	}
+}
+
+// resolveStreamLengths sets the end of streams with an indirect Length, when
+// the length object is valid.
+func resolveStreamLengths(data []byte, objects []*pdfObject) {
+	byID := make(map[uint32]*pdfObject, len(objects))
+	for _, object := range objects {
+		byID[object.id] = object
+	}
+	for _, object := range objects {
+		id, _, ok := object.value.get("Length").ref()
+		if !object.stream || !ok || byID[id] == nil {
+			continue
+		}
+		length, ok := byID[id].value.int()
+		if end := object.streamStart + int(length); ok && length >= 0 && endsStream(data, end) {
+			object.streamEnd = end
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package sign
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPDFScannerValues(t *testing.T) {
+	data := []byte(`<< /Title (a \(b\) (c)\n\101\
+d) /Hex <48 65 6c6c 6F7> /N#20ame 12 /Ref 4 0 R /Array [1 2.5 -3 true null] % comment
+/Nested << /Key /Value >> >>`)
+
+	s := &pdfScanner{data: data}
+	dict := s.parseValue(s.next(), 0)
+	if dict.kind != nodeDict || dict.start != 0 || dict.end != len(data) {
+		t.Fatalf("expected a dictionary over the data, got kind %d at %d-%d", dict.kind, dict.start, dict.end)
+	}
+
+	if title := dict.get("Title"); title == nil || string(title.value) != "a (b) (c)\nAd" {
+		t.Errorf("unexpected literal string %q", title.value)
+	}
+	hex := dict.get("Hex")
+	if string(hex.value) != "Hellop" {
+		t.Errorf("unexpected hex string %q", hex.value)
+	}
+	if !bytes.Equal(data[hex.start:hex.end], []byte("<48 65 6c6c 6F7>")) {
+		t.Errorf("unexpected hex string span %q", data[hex.start:hex.end])
+	}
+	if n, ok := dict.get("N ame").int(); !ok || n != 12 {
+		t.Errorf("expected the escaped name with value 12, got %d", n)
+	}
+	if id, gen, ok := dict.get("Ref").ref(); !ok || id != 4 || gen != 0 {
+		t.Errorf("expected reference 4 0 R, got %d %d", id, gen)
+	}
+	if array := dict.get("Array"); array == nil || len(array.items) != 5 || array.items[1].kind != nodeNumber || array.items[3].kind != nodeKeyword {
+		t.Errorf("unexpected array %v", array)
+	}
+	if !dict.get("Nested").get("Key").isName("Value") {
+		t.Errorf("expected the nested dictionary")
+	}
+}
+
+func TestScanPDF(t *testing.T) {
+	data := []byte("%PDF-1.7\n" +
+		"1 0 obj\n<< /Length 2 0 R >>\nstream\nendstream inside\nendstream\nendobj\n" +
+		"2 0 obj\n16\nendobj\n" +
+		"3 0 obj\n<< /Length 5 /Broken [1 2 >>\nstream\r\nabcde\r\nendstream\nendobj\n" +
+		"xref\n0 4\n0000000000 65535 f \ntrailer\n<< /Size 4 /Root 1 0 R >>\nstartxref\n0\n%%EOF\n")
+
+	objects, trailers := scanPDF(data)
+	if len(objects) != 3 || len(trailers) != 1 {
+		t.Fatalf("expected 3 objects and a trailer, got %d and %d", len(objects), len(trailers))
+	}
+
+	// The indirect Length includes the endstream in the data.
+	first := objects[0]
+	if stream := data[first.streamStart:first.streamEnd]; string(stream) != "endstream inside" {
+		t.Errorf("unexpected stream data %q", stream)
+	}
+	if objects[1].id != 2 || objects[1].stream {
+		t.Errorf("unexpected object %d", objects[1].id)
+	}
+	if stream := data[objects[2].streamStart:objects[2].streamEnd]; string(stream) != "abcde" {
+		t.Errorf("unexpected stream data %q", stream)
+	}
+	if !bytes.HasSuffix(data[objects[2].start:objects[2].end], []byte("endobj")) {
+		t.Errorf("expected the object to end with endobj")
+	}
+	if id, _, ok := trailers[0].get("Root").ref(); !ok || id != 1 {
+		t.Errorf("expected the Root of the trailer")
+	}
+}
@@ -0,0 +1,508 @@
+package sign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/digitorus/pdf"
+)
+
+// Seed value dictionary flags (Table 234), a set flag makes the corresponding
+// entry a requirement instead of a recommendation.
+const (
+	SeedValueFlagFilter           = 1 << 0
+	SeedValueFlagSubFilter        = 1 << 1
+	SeedValueFlagV                = 1 << 2
+	SeedValueFlagReasons          = 1 << 3
+	SeedValueFlagLegalAttestation = 1 << 4
+	SeedValueFlagAddRevInfo       = 1 << 5
+	SeedValueFlagDigestMethod     = 1 << 6
+)
+
+// Certificate seed value dictionary flags (Table 235).
+const (
+	SeedValueCertFlagSubject   = 1 << 0
+	SeedValueCertFlagIssuer    = 1 << 1
+	SeedValueCertFlagOID       = 1 << 2
+	SeedValueCertFlagSubjectDN = 1 << 3
+	SeedValueCertFlagKeyUsage  = 1 << 5
+	SeedValueCertFlagURL       = 1 << 6
+)
+
+// SeedValue constrains how a signature field may be signed, see ISO 32000-1,
+// 12.7.4.5 "Signature fields". Only the entries that are marked as required by
+// Flags are enforced when signing, a required entry that is not supported
+// makes signing fail.
+type SeedValue struct {
+	Filter        string        // Required signature handler, only Adobe.PPKLite is supported
+	SubFilters    []string      // Acceptable SubFilter values
+	DigestMethods []crypto.Hash // Acceptable digest algorithms
+	Reasons       []string      // Acceptable reasons, a single "." means no reason may be given
+	AddRevInfo    bool          // Revocation information must be embedded in the signature
+
+	TimestampURL      string // TSA to use for the signature timestamp
+	TimestampRequired bool   // The signature must contain a timestamp from TimestampURL
+
+	Certificate *SeedValueCertificate
+
+	Flags int // SeedValueFlag* bits
+}
+
+// SeedValueCertificate constrains the signing certificate (Table 235).
+type SeedValueCertificate struct {
+	Subjects []*x509.Certificate     // The signing certificate must be one of these
+	Issuers  []*x509.Certificate     // The signing certificate must be issued by one of these
+	Policies []asn1.ObjectIdentifier // The signing certificate must have one of these policies
+
+	// KeyUsages lists acceptable key usages of the signing certificate, each
+	// a string of 9 characters for the key usage bits digitalSignature to
+	// decipherOnly: '1' requires the bit, '0' forbids it and 'X' ignores it.
+	KeyUsages []string
+
+	Flags int // SeedValueCertFlag* bits
+}
+
+// seedValueDictionary returns the seed value dictionary for a signature field.
+func (sv *SeedValue) seedValueDictionary() string {
+	var buffer bytes.Buffer
+
+	buffer.WriteString("<< /Type /SV")
+	if sv.Flags != 0 {
+		fmt.Fprintf(&buffer, " /Ff %d", sv.Flags)
+	}
+
+	if sv.Filter != "" {
+		buffer.WriteString(" /Filter /" + sv.Filter)
+	}
+
+	if len(sv.SubFilters) > 0 {
+		buffer.WriteString(" /SubFilter [")
+		for i, subFilter := range sv.SubFilters {
+			if i > 0 {
+				buffer.WriteString(" ")
+			}
+			buffer.WriteString("/" + subFilter)
+		}
+		buffer.WriteString("]")
+	}
+
+	if len(sv.DigestMethods) > 0 {
+		buffer.WriteString(" /DigestMethod [")
+		for i, hash := range sv.DigestMethods {
+			if i > 0 {
+				buffer.WriteString(" ")
+			}
+			buffer.WriteString("/" + digestMethod(hash))
+		}
+		buffer.WriteString("]")
+	}
+
+	if len(sv.Reasons) > 0 {
+		buffer.WriteString(" /Reasons [")
+		for i, reason := range sv.Reasons {
+			if i > 0 {
+				buffer.WriteString(" ")
+			}
+			buffer.WriteString(pdfString(reason))
+		}
+		buffer.WriteString("]")
+	}
+
+	if sv.AddRevInfo {
+		buffer.WriteString(" /AddRevInfo true")
+	}
+
+	if sv.TimestampURL != "" {
+		buffer.WriteString(" /TimeStamp << /URL " + pdfString(sv.TimestampURL))
+		if sv.TimestampRequired {
+			buffer.WriteString(" /Ff 1")
+		}
+		buffer.WriteString(" >>")
+	}
+
+	if cert := sv.Certificate; cert != nil {
+		buffer.WriteString(" /Cert << /Type /SVCert")
+		if cert.Flags != 0 {
+			fmt.Fprintf(&buffer, " /Ff %d", cert.Flags)
+		}
+		for _, entry := range []struct {
+			key          string
+			certificates []*x509.Certificate
+		}{{"Subject", cert.Subjects}, {"Issuer", cert.Issuers}} {
+			if len(entry.certificates) == 0 {
+				continue
+			}
+			buffer.WriteString(" /" + entry.key + " [")
+			for i, certificate := range entry.certificates {
+				if i > 0 {
+					buffer.WriteString(" ")
+				}
+				buffer.WriteString("<" + strings.ToUpper(hex.EncodeToString(certificate.Raw)) + ">")
+			}
+			buffer.WriteString("]")
+		}
+		if len(cert.Policies) > 0 {
+			buffer.WriteString(" /OID [")
+			for i, oid := range cert.Policies {
+				if i > 0 {
+					buffer.WriteString(" ")
+				}
+				buffer.WriteString(pdfString(oid.String()))
+			}
+			buffer.WriteString("]")
+		}
+		if len(cert.KeyUsages) > 0 {
+			buffer.WriteString(" /KeyUsage [")
+			for i, keyUsage := range cert.KeyUsages {
+				if i > 0 {
+					buffer.WriteString(" ")
+				}
+				buffer.WriteString(pdfString(keyUsage))
+			}
+			buffer.WriteString("]")
+		}
+		buffer.WriteString(" >>")
+	}
+
+	buffer.WriteString(" >>")
+
+	return buffer.String()
+}
+
+// parseSeedValue reads the seed value dictionary of a signature field.
+func parseSeedValue(value pdf.Value) (*SeedValue, error) {
+	sv := &SeedValue{
+		Flags:      int(value.Key("Ff").Int64()),
+		AddRevInfo: value.Key("AddRevInfo").Bool(),
+		Filter:     value.Key("Filter").Name(),
+	}
+
+	subFilters := value.Key("SubFilter")
+	for i := 0; i < subFilters.Len(); i++ {
+		sv.SubFilters = append(sv.SubFilters, subFilters.Index(i).Name())
+	}
+
+	digestMethods := value.Key("DigestMethod")
+	for i := 0; i < digestMethods.Len(); i++ {
+		name := digestMethods.Index(i).Name()
+		hash, ok := digestMethodHash(name)
+		if !ok {
+			// Unknown digest methods can not be used, but do not prevent
+			// signing with one of the others.
+			continue
+		}
+		sv.DigestMethods = append(sv.DigestMethods, hash)
+	}
+
+	reasons := value.Key("Reasons")
+	for i := 0; i < reasons.Len(); i++ {
+		sv.Reasons = append(sv.Reasons, reasons.Index(i).Text())
+	}
+
+	if timestamp := value.Key("TimeStamp"); !timestamp.IsNull() {
+		sv.TimestampURL = timestamp.Key("URL").Text()
+		sv.TimestampRequired = timestamp.Key("Ff").Int64() == 1
+	}
+
+	if cert := value.Key("Cert"); !cert.IsNull() {
+		sv.Certificate = &SeedValueCertificate{
+			Flags: int(cert.Key("Ff").Int64()),
+		}
+
+		var err error
+		sv.Certificate.Subjects, err = parseSeedValueCertificates(cert.Key("Subject"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid subject certificate: %w", err)
+		}
+		sv.Certificate.Issuers, err = parseSeedValueCertificates(cert.Key("Issuer"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid issuer certificate: %w", err)
+		}
+
+		oids := cert.Key("OID")
+		for i := 0; i < oids.Len(); i++ {
+			oid, err := parseObjectIdentifier(oids.Index(i).Text())
+			if err != nil {
+				return nil, err
+			}
+			sv.Certificate.Policies = append(sv.Certificate.Policies, oid)
+		}
+
+		keyUsages := cert.Key("KeyUsage")
+		for i := 0; i < keyUsages.Len(); i++ {
+			sv.Certificate.KeyUsages = append(sv.Certificate.KeyUsages, keyUsages.Index(i).Text())
+		}
+	}
+
+	return sv, nil
+}
+
+func parseSeedValueCertificates(value pdf.Value) ([]*x509.Certificate, error) {
+	var certificates []*x509.Certificate
+	for i := 0; i < value.Len(); i++ {
+		certificate, err := x509.ParseCertificate([]byte(value.Index(i).RawString()))
+		if err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, certificate)
+	}
+	return certificates, nil
+}
+
+func parseObjectIdentifier(text string) (asn1.ObjectIdentifier, error) {
+	var oid asn1.ObjectIdentifier
+	for _, part := range strings.Split(text, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid certificate policy OID %q", text)
+		}
+		oid = append(oid, n)
+	}
+	return oid, nil
+}
+
+// digestMethodHash returns the hash for a DigestMethod name.
+func digestMethodHash(name string) (crypto.Hash, bool) {
+	for _, hash := range []crypto.Hash{crypto.MD5, crypto.SHA1, crypto.SHA256, crypto.SHA384, crypto.SHA512, crypto.RIPEMD160, crypto.SHA3_256, crypto.SHA3_384, crypto.SHA3_512} {
+		if digestMethod(hash) == name {
+			return hash, true
+		}
+	}
+	return 0, false
+}
+
+// checkSeedValue enforces the required entries of the seed value dictionary of
+// the signature field that is signed. It runs before the document is written,
+// so a signature that would violate the constraints is never created.
+func (context *SignContext) checkSeedValue() error {
+	name := context.SignData.FieldName
+	if name == "" {
+		return nil
+	}
+
+	fields := context.PDFReader.Trailer().Key("Root").Key("AcroForm").Key("Fields")
+	field, _, found := findFieldByName(fields, "", "", name)
+	if !found {
+		return nil // reported when the field is filled
+	}
+
+	value := field.Key("SV")
+	if value.IsNull() {
+		return nil
+	}
+
+	sv, err := parseSeedValue(value)
+	if err != nil {
+		return fmt.Errorf("failed to parse seed value of field %q: %w", name, err)
+	}
+
+	sign_data := &context.SignData
+
+	if sv.Flags&SeedValueFlagV != 0 {
+		// The minimum seed value parser version can not be honoured as the
+		// MDP, LegalAttestation and AppearanceFilter entries are ignored.
+		return fmt.Errorf("signature field %q: unsupported required seed value constraint V %d", name, value.Key("V").Int64())
+	}
+
+	if sv.Flags&SeedValueFlagFilter != 0 && sv.Filter != "" && sv.Filter != "Adobe.PPKLite" {
+		return fmt.Errorf("signature field %q requires the signature handler %s, only Adobe.PPKLite is supported", name, sv.Filter)
+	}
+
+	if sv.Flags&SeedValueFlagSubFilter != 0 && len(sv.SubFilters) > 0 {
+		if subFilter := context.subFilter(); !slices.Contains(sv.SubFilters, subFilter) {
+			return fmt.Errorf("signature field %q requires one of the SubFilters %v, got %s", name, sv.SubFilters, subFilter)
+		}
+	}
+
+	if sv.Flags&SeedValueFlagDigestMethod != 0 && len(sv.DigestMethods) > 0 {
+		if !slices.Contains(sv.DigestMethods, sign_data.DigestAlgorithm) {
+			allowed := make([]string, len(sv.DigestMethods))
+			for i, hash := range sv.DigestMethods {
+				allowed[i] = digestMethod(hash)
+			}
+			return fmt.Errorf("signature field %q requires one of the digest methods %v, got %s", name, allowed, sign_data.DigestAlgorithm)
+		}
+	}
+
+	if sv.Flags&SeedValueFlagReasons != 0 && len(sv.Reasons) > 0 {
+		reason := sign_data.Signature.Info.Reason
+		if len(sv.Reasons) == 1 && sv.Reasons[0] == "." {
+			if reason != "" {
+				return fmt.Errorf("signature field %q does not allow a reason", name)
+			}
+		} else if !slices.Contains(sv.Reasons, reason) {
+			return fmt.Errorf("signature field %q requires one of the reasons %q, got %q", name, sv.Reasons, reason)
+		}
+	}
+
+	if sv.Flags&SeedValueFlagAddRevInfo != 0 && sv.AddRevInfo {
+		if sign_data.RevocationFunction == nil {
+			return fmt.Errorf("signature field %q requires revocation information to be embedded, a RevocationFunction is required", name)
+		}
+	}
+
+	if sv.TimestampRequired && sv.TimestampURL != "" {
+		if sign_data.TSA.URL == "" {
+			// Use the timestamp server of the field.
+			sign_data.TSA.URL = sv.TimestampURL
+		} else if sign_data.TSA.URL != sv.TimestampURL {
+			return fmt.Errorf("signature field %q requires a timestamp from %s", name, sv.TimestampURL)
+		}
+	}
+
+	if sv.Certificate != nil && sign_data.Signature.CertType != TimeStampSignature {
+		if err := context.checkSeedValueCertificate(sv.Certificate); err != nil {
+			return fmt.Errorf("signature field %q: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// checkSeedValueCertificate enforces the required certificate constraints.
+func (context *SignContext) checkSeedValueCertificate(sv *SeedValueCertificate) error {
+	certificate := context.SignData.Certificate
+	if certificate == nil {
+		return fmt.Errorf("certificate is required")
+	}
+
+	for _, unsupported := range []struct {
+		flag int
+		name string
+	}{{SeedValueCertFlagSubjectDN, "SubjectDN"}, {SeedValueCertFlagURL, "URL"}} {
+		if sv.Flags&unsupported.flag != 0 {
+			return fmt.Errorf("unsupported required seed value constraint %s", unsupported.name)
+		}
+	}
+
+	if sv.Flags&SeedValueCertFlagSubject != 0 && len(sv.Subjects) > 0 {
+		found := false
+		for _, subject := range sv.Subjects {
+			if bytes.Equal(subject.Raw, certificate.Raw) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("signing certificate %q is not one of the required certificates", certificate.Subject)
+		}
+	}
+
+	if sv.Flags&SeedValueCertFlagIssuer != 0 && len(sv.Issuers) > 0 {
+		found := false
+		for _, issuer := range sv.Issuers {
+			if issuedBy(certificate, issuer, context.SignData.CertificateChains) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("signing certificate %q is not issued by one of the required issuers", certificate.Subject)
+		}
+	}
+
+	if sv.Flags&SeedValueCertFlagOID != 0 && len(sv.Policies) > 0 {
+		found := false
+		for _, policy := range sv.Policies {
+			if slices.ContainsFunc(certificate.PolicyIdentifiers, policy.Equal) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("signing certificate %q has none of the required policies %v", certificate.Subject, sv.Policies)
+		}
+	}
+
+	if sv.Flags&SeedValueCertFlagKeyUsage != 0 && len(sv.KeyUsages) > 0 {
+		found := false
+		for _, keyUsage := range sv.KeyUsages {
+			ok, err := matchKeyUsage(certificate.KeyUsage, keyUsage)
+			if err != nil {
+				return err
+			}
+			if ok {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("signing certificate %q has none of the required key usages %q", certificate.Subject, sv.KeyUsages)
+		}
+	}
+
+	return nil
+}
+
+// matchKeyUsage reports whether the key usage matches a KeyUsage seed value,
+// its characters follow the bit order of x509.KeyUsage.
+func matchKeyUsage(keyUsage x509.KeyUsage, pattern string) (bool, error) {
+	if len(pattern) > 9 {
+		return false, fmt.Errorf("invalid key usage seed value %q", pattern)
+	}
+	for i, c := range []byte(pattern) {
+		set := keyUsage&(1<<i) != 0
+		switch c {
+		case '1':
+			if !set {
+				return false, nil
+			}
+		case '0':
+			if set {
+				return false, nil
+			}
+		case 'X', 'x':
+		default:
+			return false, fmt.Errorf("invalid key usage seed value %q", pattern)
+		}
+	}
+	return true, nil
+}
+
+// issuedBy reports whether the issuer signed the certificate, or one of the
+// certificates it chains up to. The chain is followed from the certificate
+// through the certificates of chains that verifiably signed each link, so an
+// unrelated certificate in chains does not satisfy the constraint.
+func issuedBy(certificate, issuer *x509.Certificate, chains [][]*x509.Certificate) bool {
+	// Each link is another certificate of chains, which bounds the walk
+	// when the chains contain a loop.
+	links := 0
+	for _, chain := range chains {
+		links += len(chain)
+	}
+
+	current := certificate
+	for depth := 0; depth <= links; depth++ {
+		if current.CheckSignatureFrom(issuer) == nil {
+			return true
+		}
+
+		var parent *x509.Certificate
+		for _, chain := range chains {
+			for _, c := range chain {
+				if c.Equal(current) || !bytes.Equal(c.RawSubject, current.RawIssuer) {
+					continue
+				}
+				if current.CheckSignatureFrom(c) == nil {
+					parent = c
+					break
+				}
+			}
+			if parent != nil {
+				break
+			}
+		}
+		if parent == nil {
+			return false
+		}
+		current = parent
+	}
+	return false
+}
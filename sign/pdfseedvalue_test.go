@@ -0,0 +1,351 @@
+package sign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdf"
+)
+
+func TestSignPDFSeedValue(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "pdfsign other signer"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	other, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	input, err := os.ReadFile("../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	tests := []struct {
+		name      string
+		seedValue SeedValue
+		reason    string
+		digest    crypto.Hash
+		chains    [][]*x509.Certificate
+		wantErr   string
+	}{
+		{
+			name: "required constraints met",
+			seedValue: SeedValue{
+				SubFilters:    []string{"adbe.pkcs7.detached"},
+				DigestMethods: []crypto.Hash{crypto.SHA256, crypto.SHA512},
+				Reasons:       []string{"Approval", "Review"},
+				Filter:        "Adobe.PPKLite",
+				Certificate: &SeedValueCertificate{
+					Subjects:  []*x509.Certificate{cert},
+					KeyUsages: []string{"1", "0XXXXXXXX"},
+					Flags:     SeedValueCertFlagSubject | SeedValueCertFlagKeyUsage,
+				},
+				Flags: SeedValueFlagFilter | SeedValueFlagSubFilter | SeedValueFlagDigestMethod | SeedValueFlagReasons,
+			},
+			reason: "Approval",
+		},
+		{
+			name: "optional constraints are not enforced",
+			seedValue: SeedValue{
+				DigestMethods: []crypto.Hash{crypto.SHA512},
+				Reasons:       []string{"Review"},
+			},
+			reason: "Approval",
+		},
+		{
+			name: "reason not allowed",
+			seedValue: SeedValue{
+				Reasons: []string{"Review"},
+				Flags:   SeedValueFlagReasons,
+			},
+			reason:  "Approval",
+			wantErr: "requires one of the reasons",
+		},
+		{
+			name: "no reason allowed",
+			seedValue: SeedValue{
+				Reasons: []string{"."},
+				Flags:   SeedValueFlagReasons,
+			},
+			reason:  "Approval",
+			wantErr: "does not allow a reason",
+		},
+		{
+			name: "digest method not allowed",
+			seedValue: SeedValue{
+				DigestMethods: []crypto.Hash{crypto.SHA512},
+				Flags:         SeedValueFlagDigestMethod,
+			},
+			digest:  crypto.SHA256,
+			wantErr: "requires one of the digest methods [SHA512]",
+		},
+		{
+			name: "subfilter not allowed",
+			seedValue: SeedValue{
+				SubFilters: []string{"ETSI.CAdES.detached"},
+				Flags:      SeedValueFlagSubFilter,
+			},
+			wantErr: "requires one of the SubFilters",
+		},
+		{
+			name: "revocation information required",
+			seedValue: SeedValue{
+				AddRevInfo: true,
+				Flags:      SeedValueFlagAddRevInfo,
+			},
+			wantErr: "requires revocation information",
+		},
+		{
+			name: "other subject required",
+			seedValue: SeedValue{
+				Certificate: &SeedValueCertificate{
+					Subjects: []*x509.Certificate{other},
+					Flags:    SeedValueCertFlagSubject,
+				},
+			},
+			wantErr: "is not one of the required certificates",
+		},
+		{
+			name: "other issuer required",
+			seedValue: SeedValue{
+				Certificate: &SeedValueCertificate{
+					Issuers: []*x509.Certificate{other},
+					Flags:   SeedValueCertFlagIssuer,
+				},
+			},
+			wantErr: "is not issued by one of the required issuers",
+		},
+		{
+			name: "other issuer in the certificate chains",
+			seedValue: SeedValue{
+				Certificate: &SeedValueCertificate{
+					Issuers: []*x509.Certificate{other},
+					Flags:   SeedValueCertFlagIssuer,
+				},
+			},
+			chains:  [][]*x509.Certificate{{cert, other}},
+			wantErr: "is not issued by one of the required issuers",
+		},
+		{
+			name: "key usage not allowed",
+			seedValue: SeedValue{
+				Certificate: &SeedValueCertificate{
+					KeyUsages: []string{"1XXXXXXXX"},
+					Flags:     SeedValueCertFlagKeyUsage,
+				},
+			},
+			wantErr: "has none of the required key usages",
+		},
+		{
+			name: "subject distinguished name required",
+			seedValue: SeedValue{
+				Certificate: &SeedValueCertificate{
+					Flags: SeedValueCertFlagSubjectDN,
+				},
+			},
+			wantErr: "unsupported required seed value constraint SubjectDN",
+		},
+		{
+			name: "certificate URL required",
+			seedValue: SeedValue{
+				Certificate: &SeedValueCertificate{
+					Flags: SeedValueCertFlagURL,
+				},
+			},
+			wantErr: "unsupported required seed value constraint URL",
+		},
+		{
+			name: "other filter required",
+			seedValue: SeedValue{
+				Filter: "Entrust.PPKEF",
+				Flags:  SeedValueFlagFilter,
+			},
+			wantErr: "requires the signature handler Entrust.PPKEF",
+		},
+		{
+			name: "seed value version required",
+			seedValue: SeedValue{
+				Flags: SeedValueFlagV,
+			},
+			wantErr: "unsupported required seed value constraint V",
+		},
+		{
+			name: "certificate policy required",
+			seedValue: SeedValue{
+				Certificate: &SeedValueCertificate{
+					Policies: []asn1.ObjectIdentifier{{1, 2, 3, 4}},
+					Flags:    SeedValueCertFlagOID,
+				},
+			},
+			wantErr: "has none of the required policies",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var prepared bytes.Buffer
+			err := PrepareFields(bytes.NewReader(input), &prepared, []SignatureField{
+				{Name: "Approver", Page: 1, SeedValue: &tt.seedValue},
+			})
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			document := prepared.Bytes()
+			rdr, err := pdf.NewReader(bytes.NewReader(document), int64(len(document)))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			var output bytes.Buffer
+			err = Sign(bytes.NewReader(document), &output, rdr, int64(len(document)), SignData{
+				Signature: SignDataSignature{
+					Info: SignDataSignatureInfo{
+						Name:   "John Doe",
+						Reason: tt.reason,
+						Date:   time.Now().Local(),
+					},
+					CertType: ApprovalSignature,
+				},
+				FieldName:         "Approver",
+				DigestAlgorithm:   tt.digest,
+				Signer:            pkey,
+				Certificate:       cert,
+				CertificateChains: tt.chains,
+			})
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				if output.Len() != 0 {
+					t.Errorf("expected no output to be written")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+		})
+	}
+}
+
+func TestParseSeedValue(t *testing.T) {
+	cert, _ := loadCertificateAndKey(t)
+
+	sv := &SeedValue{
+		SubFilters:        []string{"adbe.pkcs7.detached", "ETSI.CAdES.detached"},
+		DigestMethods:     []crypto.Hash{crypto.SHA256},
+		Reasons:           []string{"I agree (fully)"},
+		AddRevInfo:        true,
+		Filter:            "Adobe.PPKLite",
+		TimestampURL:      "https://tsa.example.com",
+		TimestampRequired: true,
+		Certificate: &SeedValueCertificate{
+			Subjects:  []*x509.Certificate{cert},
+			Policies:  []asn1.ObjectIdentifier{{2, 16, 840, 1, 101, 2, 1}},
+			KeyUsages: []string{"1X0XXXXXX"},
+			Flags:     SeedValueCertFlagSubject | SeedValueCertFlagOID,
+		},
+		Flags: SeedValueFlagReasons | SeedValueFlagAddRevInfo,
+	}
+
+	object := []byte("1 0 obj\n" + sv.seedValueDictionary() + "\nendobj\n")
+	document := append([]byte("%PDF-1.7\n"), object...)
+	xref := len(document)
+	document = append(document, []byte("xref\n0 2\n0000000000 65535 f \n0000000009 00000 n \ntrailer\n<< /Size 2 /SV 1 0 R >>\nstartxref\n")...)
+	document = append(document, []byte(strconv.Itoa(xref)+"\n%%EOF\n")...)
+
+	rdr, err := pdf.NewReader(bytes.NewReader(document), int64(len(document)))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	parsed, err := parseSeedValue(rdr.Trailer().Key("SV"))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	if strings.Join(parsed.SubFilters, ",") != "adbe.pkcs7.detached,ETSI.CAdES.detached" {
+		t.Errorf("unexpected SubFilters %v", parsed.SubFilters)
+	}
+	if len(parsed.DigestMethods) != 1 || parsed.DigestMethods[0] != crypto.SHA256 {
+		t.Errorf("unexpected digest methods %v", parsed.DigestMethods)
+	}
+	if len(parsed.Reasons) != 1 || parsed.Reasons[0] != "I agree (fully)" {
+		t.Errorf("unexpected reasons %q", parsed.Reasons)
+	}
+	if !parsed.AddRevInfo || parsed.Flags != sv.Flags {
+		t.Errorf("unexpected AddRevInfo %t and flags %d", parsed.AddRevInfo, parsed.Flags)
+	}
+	if parsed.TimestampURL != sv.TimestampURL || !parsed.TimestampRequired {
+		t.Errorf("unexpected timestamp %q, required %t", parsed.TimestampURL, parsed.TimestampRequired)
+	}
+	if parsed.Certificate == nil || len(parsed.Certificate.Subjects) != 1 || !parsed.Certificate.Subjects[0].Equal(cert) {
+		t.Fatalf("expected the subject certificate to be parsed")
+	}
+	if len(parsed.Certificate.Policies) != 1 || !parsed.Certificate.Policies[0].Equal(sv.Certificate.Policies[0]) {
+		t.Errorf("unexpected policies %v", parsed.Certificate.Policies)
+	}
+	if parsed.Filter != sv.Filter {
+		t.Errorf("unexpected filter %q", parsed.Filter)
+	}
+	if len(parsed.Certificate.KeyUsages) != 1 || parsed.Certificate.KeyUsages[0] != sv.Certificate.KeyUsages[0] {
+		t.Errorf("unexpected key usages %q", parsed.Certificate.KeyUsages)
+	}
+	if parsed.Certificate.Flags != sv.Certificate.Flags {
+		t.Errorf("unexpected certificate flags %d", parsed.Certificate.Flags)
+	}
+}
+
+func TestIssuedBy(t *testing.T) {
+	h := newIssuerHierarchy(t)
+	other, _ := loadCertificateAndKey(t)
+
+	tests := []struct {
+		name   string
+		issuer *x509.Certificate
+		chains [][]*x509.Certificate
+		want   bool
+	}{
+		{"direct issuer", h.intermediate, nil, true},
+		{"root through the chain", h.root, [][]*x509.Certificate{{h.leaf, h.intermediate, h.root}}, true},
+		{"root without the intermediate", h.root, [][]*x509.Certificate{{h.leaf, h.root}}, false},
+		{"unrelated certificate in the chain", other, [][]*x509.Certificate{{h.leaf, h.intermediate, h.root, other}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := issuedBy(h.leaf, tt.issuer, tt.chains); got != tt.want {
+				t.Errorf("expected %t, got %t", tt.want, got)
+			}
+		})
+	}
+}
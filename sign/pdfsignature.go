@@ -9,9 +9,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
-	"net/http"
+	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/digitorus/pkcs7"
 	"github.com/digitorus/timestamp"
@@ -19,7 +19,17 @@ import (
 	cryptobyte_asn1 "golang.org/x/crypto/cryptobyte/asn1"
 )
 
-const signatureByteRangePlaceholder = "/ByteRange[0 ********** ********** **********]"
+// byteRangePlaceholderPattern matches the placeholder of byteRangePlaceholder.
+var byteRangePlaceholderPattern = regexp.MustCompile(`/ByteRange\[0 \*+ \*+ \*+\]`)
+
+// byteRangePlaceholder returns the placeholder of the ByteRange of a
+// signature appended to a document of size bytes. The offsets have room for
+// 10 digits, and for documents of 1 GB and larger for one digit more than
+// the size.
+func byteRangePlaceholder(size int64) string {
+	digits := strings.Repeat("*", max(10, len(strconv.FormatInt(size, 10))+1))
+	return "/ByteRange[0 " + digits + " " + digits + " " + digits + "]"
+}
 
 func (context *SignContext) createSignaturePlaceholder() []byte {
 	// Using a buffer because it's way faster than concatenating.
@@ -28,18 +38,31 @@ func (context *SignContext) createSignaturePlaceholder() []byte {
 	signature_buffer.WriteString("<<\n")
 	signature_buffer.WriteString(" /Type /Sig\n")
 	signature_buffer.WriteString(" /Filter /Adobe.PPKLite\n")
-	signature_buffer.WriteString(" /SubFilter /adbe.pkcs7.detached\n")
+	signature_buffer.WriteString(" /SubFilter /" + context.subFilter() + "\n")
+	if context.SignData.SubFilter == SubFilterAdbeX509RSASHA1 {
+		signature_buffer.WriteString(" /Cert " + context.certEntry() + "\n")
+	}
 
 	signature_buffer.WriteString(context.createPropBuild())
 
 	// Create a placeholder for the byte range string, we will replace it later.
-	signature_buffer.WriteString(" " + signatureByteRangePlaceholder)
+	signature_buffer.WriteString(" " + byteRangePlaceholder(context.outputLength()))
 
 	// Create a placeholder for the actual signature content, we will replace it later.
 	signature_buffer.WriteString(" /Contents<")
 	signature_buffer.Write(bytes.Repeat([]byte("0"), int(context.SignatureMaxLength)))
 	signature_buffer.WriteString(">\n")
 
+	// An approval signature that locks form fields references a FieldMDP
+	// transform, instead of the default transform parameters.
+	lock := context.SignData.Signature.FieldLock
+	lockedApproval := context.SignData.Signature.CertType == ApprovalSignature && lock != nil
+	if lockedApproval {
+		signature_buffer.WriteString(" /Reference [\n")
+		signature_buffer.WriteString(context.fieldMDPReference(lock))
+		signature_buffer.WriteString(" ]\n")
+	}
+
 	switch context.SignData.Signature.CertType {
 	case CertificationSignature, UsageRightsSignature:
 		signature_buffer.WriteString(" /Reference [\n") // start array of signature reference dictionaries
@@ -91,6 +114,10 @@ func (context *SignContext) createSignaturePlaceholder() []byte {
 
 	// Approval signatures (also known as recipient signatures)
 	case ApprovalSignature:
+		if lockedApproval {
+			break
+		}
+
 		// Used to detect modifications to a list of form fields specified in TransformParams; see
 		// 12.8.2.4, "FieldMDP"
 		signature_buffer.WriteString("   /TransformMethod /FieldMDP\n")
@@ -118,31 +145,25 @@ func (context *SignContext) createSignaturePlaceholder() []byte {
 
 	// (Required) A name identifying the algorithm that shall be used when computing the digest if not specified in the
 	// certificate. Valid values are MD5, SHA1 SHA256, SHA384, SHA512 and RIPEMD160
-	switch context.SignData.DigestAlgorithm {
-	case crypto.MD5:
-		signature_buffer.WriteString("   /DigestMethod /MD5\n")
-	case crypto.SHA1:
-		signature_buffer.WriteString("   /DigestMethod /SHA1\n")
-	case crypto.SHA256:
-		signature_buffer.WriteString("   /DigestMethod /SHA256\n")
-	case crypto.SHA384:
-		signature_buffer.WriteString("   /DigestMethod /SHA384\n")
-	case crypto.SHA512:
-		signature_buffer.WriteString("   /DigestMethod /SHA512\n")
-	case crypto.RIPEMD160:
-		signature_buffer.WriteString("   /DigestMethod /RIPEMD160\n")
+	if name := digestMethod(context.SignData.DigestAlgorithm); name != "" && !lockedApproval {
+		signature_buffer.WriteString("   /DigestMethod /" + name + "\n")
 	}
 
 	switch context.SignData.Signature.CertType {
 	case CertificationSignature, UsageRightsSignature:
 		signature_buffer.WriteString("   >>\n") // close TransformParams
 		signature_buffer.WriteString(" >>")     // close SigRef
-		signature_buffer.WriteString(" ]")      // end of reference
+		if lock != nil && context.SignData.Signature.CertType == CertificationSignature {
+			signature_buffer.WriteString("\n" + context.fieldMDPReference(lock))
+		}
+		signature_buffer.WriteString(" ]") // end of reference
 	}
 
 	switch context.SignData.Signature.CertType {
 	case ApprovalSignature:
-		signature_buffer.WriteString(" >>\n")
+		if !lockedApproval {
+			signature_buffer.WriteString(" >>\n")
+		}
 	}
 
 	if context.SignData.Signature.Info.Name != "" {
@@ -176,9 +197,16 @@ func (context *SignContext) createSignaturePlaceholder() []byte {
 	//
 	// A timestamp can be embedded in a CMS binary data object (see 12.8.3.3, "CMS
 	// (PKCS #7) signatures").
-	if context.SignData.TSA.URL == "" && !context.SignData.Signature.Info.Date.IsZero() {
+	//
+	// CAdES signatures have no signing-time attribute, the M entry is always
+	// written.
+	date := context.SignData.Signature.Info.Date
+	if date.IsZero() && context.cades() {
+		date = context.signingTime()
+	}
+	if (context.SignData.TSA.URL == "" || context.cades()) && !date.IsZero() {
 		signature_buffer.WriteString(" /M ")
-		signature_buffer.WriteString(pdfDateTime(context.SignData.Signature.Info.Date))
+		signature_buffer.WriteString(pdfDateTime(date))
 		signature_buffer.WriteString("\n")
 	}
 
@@ -198,7 +226,7 @@ func (context *SignContext) createTimestampPlaceholder() []byte {
 	timestamp_buffer.WriteString(context.createPropBuild())
 
 	// Create a placeholder for the byte range string, we will replace it later.
-	timestamp_buffer.WriteString(" " + signatureByteRangePlaceholder)
+	timestamp_buffer.WriteString(" " + byteRangePlaceholder(context.outputLength()))
 
 	timestamp_buffer.WriteString(" /Contents<")
 	timestamp_buffer.Write(bytes.Repeat([]byte("0"), int(context.SignatureMaxLength)))
@@ -214,6 +242,9 @@ func (context *SignContext) fetchRevocationData() error {
 			certificate_chain := context.SignData.CertificateChains[0]
 			if certificate_chain != nil && (len(certificate_chain) > 0) {
 				for i, certificate := range certificate_chain {
+					if err := signingContext(&context.SignData).Err(); err != nil {
+						return err
+					}
 					if i < len(certificate_chain)-1 {
 						err := context.SignData.RevocationFunction(certificate, certificate_chain[i+1], &context.SignData.RevocationData)
 						if err != nil {
@@ -230,7 +261,11 @@ func (context *SignContext) fetchRevocationData() error {
 		}
 	}
 
-	// Calculate space needed for signature.
+	// Calculate space needed for signature, CAdES signatures add the
+	// revocation data to the DSS.
+	if context.cades() {
+		return nil
+	}
 	for _, crl := range context.SignData.RevocationData.CRL {
 		context.SignatureMaxLength += uint32(hex.EncodedLen(len(crl.FullBytes)))
 	}
@@ -241,21 +276,39 @@ func (context *SignContext) fetchRevocationData() error {
 	return nil
 }
 
-func (context *SignContext) createSigningCertificateAttribute() (*pkcs7.Attribute, error) {
-	hash := context.SignData.DigestAlgorithm.New()
-	hash.Write(context.SignData.Certificate.Raw)
+// createSigningCertificateAttribute returns the ESS signing-certificate-v2
+// attribute (RFC 5035) that binds the signing certificate to the signature,
+// which CAdES and PAdES validators require.
+func (context *SignContext) createSigningCertificateAttribute() (*cmsAttribute, error) {
+	certificate := context.SignData.Certificate
+
+	// The certificate hash of ESSCertIDv2 follows the digest algorithm,
+	// SHA-1 digests of the legacy SubFilters use the default SHA-256.
+	digestAlgorithm := context.SignData.DigestAlgorithm.HashFunc()
+	if digestAlgorithm == crypto.SHA1 {
+		digestAlgorithm = crypto.SHA256
+	}
+	hash := digestAlgorithm.New()
+	hash.Write(certificate.Raw)
 
 	var b cryptobyte.Builder
-	b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) { // SigningCertificate
-		b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) { // []ESSCertID, []ESSCertIDv2
-			b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) { // ESSCertID, ESSCertIDv2
-				if context.SignData.DigestAlgorithm.HashFunc() != crypto.SHA1 &&
-					context.SignData.DigestAlgorithm.HashFunc() != crypto.SHA256 { // default SHA-256
+	b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) { // SigningCertificateV2
+		b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) { // []ESSCertIDv2
+			b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) { // ESSCertIDv2
+				if digestAlgorithm != crypto.SHA256 { // default SHA-256
 					b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) { // AlgorithmIdentifier
-						b.AddASN1ObjectIdentifier(getOIDFromHashAlgorithm(context.SignData.DigestAlgorithm))
+						b.AddASN1ObjectIdentifier(getOIDFromHashAlgorithm(digestAlgorithm))
 					})
 				}
-				b.AddASN1OctetString(hash.Sum(nil)) // certHash
+				b.AddASN1OctetString(hash.Sum(nil))                               // certHash
+				b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) { // IssuerSerial
+					b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) { // GeneralNames
+						b.AddASN1(cryptobyte_asn1.Tag(4).ContextSpecific().Constructed(), func(b *cryptobyte.Builder) { // directoryName
+							b.AddBytes(certificate.RawIssuer)
+						})
+					})
+					b.AddASN1BigInt(certificate.SerialNumber)
+				})
 			})
 		})
 	})
@@ -264,29 +317,21 @@ func (context *SignContext) createSigningCertificateAttribute() (*pkcs7.Attribut
 	if err != nil {
 		return nil, err
 	}
-	signingCertificate := pkcs7.Attribute{
-		Type:  asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}, // SigningCertificateV2
-		Value: asn1.RawValue{FullBytes: sse},
-	}
-	if context.SignData.DigestAlgorithm.HashFunc() == crypto.SHA1 {
-		signingCertificate.Type = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 12} // SigningCertificate
+	attributeType := asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47} // SigningCertificateV2
+	signingCertificate, err := newCMSAttribute(attributeType, asn1.RawValue{FullBytes: sse})
+	if err != nil {
+		return nil, err
 	}
 	return &signingCertificate, nil
 }
 
-func (context *SignContext) createSignature() ([]byte, error) {
-	if _, err := context.OutputBuffer.Seek(0, 0); err != nil {
-		return nil, err
-	}
-
-	// Sadly we can't efficiently sign a file, we need to read all the bytes we want to sign.
-	file_content := context.OutputBuffer.Buff.Bytes()
-
-	// Collect the parts to sign.
-	sign_content := make([]byte, 0)
-	sign_content = append(sign_content, file_content[context.ByteRangeValues[0]:(context.ByteRangeValues[0]+context.ByteRangeValues[1])]...)
-	sign_content = append(sign_content, file_content[context.ByteRangeValues[2]:(context.ByteRangeValues[2]+context.ByteRangeValues[3])]...)
+// byteRangeContent returns the parts of the document that the ByteRange
+// covers.
+func (context *SignContext) byteRangeContent() ([]byte, error) {
+	return io.ReadAll(context.byteRangeReader())
+}
 
+func (context *SignContext) createSignature() ([]byte, error) {
 	// Return the timestamp if we are signing a timestamp.
 	if context.SignData.Signature.CertType == TimeStampSignature {
 		// ETSI EN 319 142-1 V1.2.1
@@ -300,7 +345,13 @@ func (context *SignContext) createSignature() ([]byte, error) {
 		// entire document, including the Document Time-stamp dictionary but excluding
 		// the TimeStampToken itself (the entry with key Contents).
 
-		timestamp_response, err := context.GetTSA(sign_content)
+		hash := timestampHash(context.SignData.DigestAlgorithm)
+		digest, err := context.byteRangeDigest(hash)
+		if err != nil {
+			return nil, err
+		}
+
+		timestamp_response, err := context.getTSADigest(hash, digest)
 		if err != nil {
 			return nil, fmt.Errorf("get timestamp: %w", err)
 		}
@@ -310,127 +361,167 @@ func (context *SignContext) createSignature() ([]byte, error) {
 			return nil, fmt.Errorf("parse timestamp: %w", err)
 		}
 
-		return ts.RawToken, nil
-	}
+		// The document is hashed again if the TSA used another algorithm.
+		if ts.HashAlgorithm != hash {
+			if digest, err = context.byteRangeDigest(ts.HashAlgorithm); err != nil {
+				return nil, fmt.Errorf("timestamp uses unavailable hash algorithm %v", ts.HashAlgorithm)
+			}
+		}
+		if !bytes.Equal(digest, ts.HashedMessage) {
+			return nil, fmt.Errorf("timestamp message imprint does not match the document")
+		}
 
-	// Initialize pkcs7 signer.
-	signed_data, err := pkcs7.NewSignedData(sign_content)
-	if err != nil {
-		return nil, fmt.Errorf("new signed data: %w", err)
+		return ts.RawToken, nil
 	}
 
-	signed_data.SetDigestAlgorithm(getOIDFromHashAlgorithm(context.SignData.DigestAlgorithm))
-	signingCertificate, err := context.createSigningCertificateAttribute()
+	digest, err := context.byteRangeDigest(context.contentHash())
 	if err != nil {
-		return nil, fmt.Errorf("new signed data: %w", err)
+		return nil, err
 	}
 
-	signer_config := pkcs7.SignerInfoConfig{
-		ExtraSignedAttributes: []pkcs7.Attribute{
-			{
-				Type:  asn1.ObjectIdentifier{1, 2, 840, 113583, 1, 1, 8},
-				Value: context.SignData.RevocationData,
-			},
-			*signingCertificate,
-		},
+	if context.SignData.SubFilter == SubFilterAdbeX509RSASHA1 {
+		return context.createPKCS1Signature(digest)
 	}
 
-	// Add the first certificate chain without our own certificate.
-	var certificate_chain []*x509.Certificate
-	if len(context.SignData.CertificateChains) > 0 && len(context.SignData.CertificateChains[0]) > 1 {
-		certificate_chain = context.SignData.CertificateChains[0][1:]
+	signedAttributes, err := context.signedAttributes()
+	if err != nil {
+		return nil, fmt.Errorf("new signed data: %w", err)
 	}
 
-	// Add the signer and sign the data.
-	if err := signed_data.AddSignerChain(context.SignData.Certificate, context.SignData.Signer, certificate_chain, signer_config); err != nil {
-		return nil, fmt.Errorf("add signer chain: %w", err)
+	// Sign the data, PDF needs a detached signature, meaning the content
+	// isn't included.
+	signed_data, err := context.createSignedData(digest, signedAttributes)
+	if err != nil {
+		return nil, fmt.Errorf("new signed data: %w", err)
 	}
 
-	// PDF needs a detached signature, meaning the content isn't included.
-	signed_data.Detach()
-
 	if context.SignData.TSA.URL != "" {
-		signature_data := signed_data.GetSignedData()
-
-		timestamp_response, err := context.GetTSA(signature_data.SignerInfos[0].EncryptedDigest)
-		if err != nil {
-			return nil, fmt.Errorf("get timestamp: %w", err)
-		}
-
-		ts, err := timestamp.ParseResponse(timestamp_response)
-		if err != nil {
-			return nil, fmt.Errorf("parse timestamp: %w", err)
-		}
-
-		_, err = pkcs7.Parse(ts.RawToken)
-		if err != nil {
-			return nil, fmt.Errorf("parse timestamp token: %w", err)
-		}
-
-		timestamp_attribute := pkcs7.Attribute{
-			Type:  asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 14},
-			Value: asn1.RawValue{FullBytes: ts.RawToken},
-		}
-		if err := signature_data.SignerInfos[0].SetUnauthenticatedAttributes([]pkcs7.Attribute{timestamp_attribute}); err != nil {
+		if err := context.timestampSignedData(signed_data); err != nil {
 			return nil, err
 		}
 	}
 
-	return signed_data.Finish()
+	return signed_data.finish()
 }
 
-func (context *SignContext) GetTSA(sign_content []byte) (timestamp_response []byte, err error) {
-	sign_reader := bytes.NewReader(sign_content)
-	ts_request, err := timestamp.CreateRequest(sign_reader, &timestamp.RequestOptions{
-		Hash:         context.SignData.DigestAlgorithm,
-		Certificates: true,
-	})
+// signedAttributes returns the signed attributes of the signer besides the
+// content type, message digest and signing time.
+func (context *SignContext) signedAttributes() ([]cmsAttribute, error) {
+	signingCertificate, err := context.createSigningCertificateAttribute()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, err
 	}
+	policyAttributes, err := context.policyAttributes()
+	if err != nil {
+		return nil, err
+	}
+	attributes := append([]cmsAttribute{*signingCertificate}, policyAttributes...)
 
-	ts_request_reader := bytes.NewReader(ts_request)
-	req, err := http.NewRequest("POST", context.SignData.TSA.URL, ts_request_reader)
+	// The revocation data of CAdES signatures is added to the DSS instead of
+	// the adbe-revocationInfoArchival attribute, which is only added when
+	// there is revocation data to archive.
+	if context.cades() || !context.hasRevocationData() {
+		return attributes, nil
+	}
+	revocationData, err := newCMSAttribute(asn1.ObjectIdentifier{1, 2, 840, 113583, 1, 1, 8}, context.SignData.RevocationData)
 	if err != nil {
-		return nil, fmt.Errorf("failed to prepare request (%s): %w", context.SignData.TSA.URL, err)
+		return nil, err
 	}
+	return append([]cmsAttribute{revocationData}, attributes...), nil
+}
 
-	req.Header.Add("Content-Type", "application/timestamp-query")
-	req.Header.Add("Content-Transfer-Encoding", "binary")
+// timestampSignedData adds a signature time-stamp token of the TSA over the
+// signature value to the SignedData.
+func (context *SignContext) timestampSignedData(signed_data *cmsSignedData) error {
+	signature := signed_data.SignerInfos[0].EncryptedDigest
 
-	if context.SignData.TSA.Username != "" && context.SignData.TSA.Password != "" {
-		req.SetBasicAuth(context.SignData.TSA.Username, context.SignData.TSA.Password)
+	timestamp_response, err := context.GetTSA(signature)
+	if err != nil {
+		return fmt.Errorf("get timestamp: %w", err)
 	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	code := 0
+	ts, err := timestamp.ParseResponse(timestamp_response)
+	if err != nil {
+		return fmt.Errorf("parse timestamp: %w", err)
+	}
 
-	if resp != nil {
-		code = resp.StatusCode
+	ts_token, err := pkcs7.Parse(ts.RawToken)
+	if err != nil {
+		return fmt.Errorf("parse timestamp token: %w", err)
 	}
+	context.timestampCertificates = ts_token.Certificates
 
-	if err != nil || (code < 200 || code > 299) {
-		if err == nil {
-			defer func() {
-				_ = resp.Body.Close()
-			}()
-			body, _ := io.ReadAll(resp.Body)
-			return nil, errors.New("non success response (" + strconv.Itoa(code) + "): " + string(body))
-		}
+	if err := context.checkTimestampImprint(ts, signature); err != nil {
+		return err
+	}
+
+	return signed_data.setTimestamp(ts.RawToken)
+}
 
-		return nil, errors.New("non success response (" + strconv.Itoa(code) + ")")
+// timestampHash returns the digest algorithm of a time-stamp request. The
+// timestamp package only knows the SHA-1 and SHA-2 digests, SHA-3 digests are
+// replaced by the SHA-2 digest of the same size.
+func timestampHash(hash crypto.Hash) crypto.Hash {
+	switch hash {
+	case crypto.SHA3_256:
+		return crypto.SHA256
+	case crypto.SHA3_384:
+		return crypto.SHA384
+	case crypto.SHA3_512:
+		return crypto.SHA512
+	}
+	return hash
+}
+
+// GetTSA returns the time-stamp response of the TSA for sign_content. Failed
+// requests are retried and the fallback TSAs tried in order, the error
+// reports the failure of every TSA.
+func (context *SignContext) GetTSA(sign_content []byte) (timestamp_response []byte, err error) {
+	// The timestamp package defaults to SHA-256 as well.
+	hash := timestampHash(context.SignData.DigestAlgorithm)
+	if hash == 0 {
+		hash = crypto.SHA256
 	}
+	if !hash.Available() {
+		return nil, fmt.Errorf("failed to create request: %w", x509.ErrUnsupportedAlgorithm)
+	}
+	h := hash.New()
+	h.Write(sign_content)
+	return context.getTSADigest(hash, h.Sum(nil))
+}
 
-	defer func() {
-		_ = resp.Body.Close()
-	}()
-	timestamp_response_body, err := io.ReadAll(resp.Body)
+// getTSADigest returns the time-stamp response of the TSA for the digest
+// with hash of the data to timestamp, see GetTSA.
+func (context *SignContext) getTSADigest(hash crypto.Hash, digest []byte) ([]byte, error) {
+	ts_request, err := (&timestamp.Request{
+		HashAlgorithm: hash,
+		HashedMessage: digest,
+		Certificates:  true,
+	}).Marshal()
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	return timestamp_response_body, nil
+	// The fallbacks are not tried once the context of the signature is done.
+	ctx := signingContext(&context.SignData)
+	tsas := append([]TSA{context.SignData.TSA}, context.SignData.TSA.Fallbacks...)
+	var errs []error
+	for i := range tsas {
+		timestamp_response, err := tsas[i].request(ctx, ts_request)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", tsas[i].URL, err))
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		recordTimestampTokenSize(tsas[i].URL, len(timestamp_response))
+		if context.SignData.TSA.OnUsed != nil {
+			context.SignData.TSA.OnUsed(tsas[i].URL)
+		}
+		return timestamp_response, nil
+	}
+	return nil, errors.Join(errs...)
 }
 
 func (context *SignContext) replaceSignature() error {
@@ -443,44 +534,24 @@ func (context *SignContext) replaceSignature() error {
 	hex.Encode(dst, signature)
 
 	if uint32(len(dst)) > context.SignatureMaxLength {
-		log.Println("Signature too long, retrying with increased buffer size.")
-		// set new base and try signing again
-		context.SignatureMaxLengthBase += (uint32(len(dst)) - context.SignatureMaxLength) + 1
-		return context.SignPDF()
-	}
-
-	if _, err := context.OutputBuffer.Seek(0, 0); err != nil {
-		return err
-	}
-	file_content := context.OutputBuffer.Buff.Bytes()
-
-	// Write the file content up to the signature
-	if _, err := context.OutputBuffer.Write(file_content[context.ByteRangeValues[0]:context.ByteRangeValues[1]]); err != nil {
-		return err
+		// set new base for the next attempt
+		context.SignatureMaxLengthBase += (uint32(len(dst)) - context.SignatureMaxLength) + uint32(hex.EncodedLen(placeholderMargin))
+		return fmt.Errorf("%w (%d > %d)", errSignatureTooLong, len(dst), context.SignatureMaxLength)
 	}
 
-	// Write new signature
-	if _, err := context.OutputBuffer.Write([]byte("<")); err != nil {
-		return err
-	}
+	return context.writeSignature(dst)
+}
 
-	if _, err := context.OutputBuffer.Write([]byte(dst)); err != nil {
-		return err
-	}
+// writeSignature writes the hex encoded signature into the Contents
+// placeholder of the signature dictionary.
+func (context *SignContext) writeSignature(dst []byte) error {
+	// The placeholder is in the incremental update, after the < delimiter.
+	start := context.ByteRangeValues[1] - context.inputLength + 1
+	contents := context.OutputBuffer.Buff.Bytes()[start : start+int64(context.SignatureMaxLength)]
 
 	// Write 0s to ensure the signature remains the same size
-	zeroPadding := bytes.Repeat([]byte("0"), int(context.SignatureMaxLength)-len(dst))
-	if _, err := context.OutputBuffer.Write(zeroPadding); err != nil {
-		return err
-	}
-
-	if _, err := context.OutputBuffer.Write([]byte(">")); err != nil {
-		return err
-	}
-
-	if _, err := context.OutputBuffer.Write(file_content[context.ByteRangeValues[2] : context.ByteRangeValues[2]+context.ByteRangeValues[3]]); err != nil {
-		return err
-	}
+	n := copy(contents, dst)
+	copy(contents[n:], bytes.Repeat([]byte("0"), len(contents)-n))
 
 	return nil
 }
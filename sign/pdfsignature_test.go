@@ -1,12 +1,24 @@
 package sign
 
 import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/asn1"
 	"fmt"
+	"math/big"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/revocation"
+	"github.com/digitorus/pdfsign/verify"
+	"github.com/digitorus/pkcs7"
+	"golang.org/x/crypto/ocsp"
 )
 
 var signatureTests = []struct {
@@ -80,3 +92,187 @@ func TestCreateSignaturePlaceholder(t *testing.T) {
 		}
 	}
 }
+
+func TestCreateSigningCertificateAttribute(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	sha256Hash := sha256.Sum256(cert.Raw)
+	sha512Hash := sha512.Sum512(cert.Raw)
+
+	tests := []struct {
+		digest        crypto.Hash
+		wantAlgorithm asn1.ObjectIdentifier
+		wantHash      []byte
+	}{
+		{digest: crypto.SHA256, wantHash: sha256Hash[:]},
+		{digest: crypto.SHA512, wantAlgorithm: getOIDFromHashAlgorithm(crypto.SHA512), wantHash: sha512Hash[:]},
+		{digest: crypto.SHA1, wantHash: sha256Hash[:]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.digest.String(), func(t *testing.T) {
+			context := SignContext{SignData: SignData{
+				Signer:          pkey,
+				Certificate:     cert,
+				DigestAlgorithm: tt.digest,
+			}}
+			attribute, err := context.createSigningCertificateAttribute()
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if !attribute.Type.Equal(asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}) {
+				t.Fatalf("expected the signing-certificate-v2 attribute, got %s", attribute.Type)
+			}
+
+			var signingCertificate struct {
+				Certs []struct {
+					HashAlgorithm struct {
+						Algorithm asn1.ObjectIdentifier
+					} `asn1:"optional"`
+					CertHash     []byte
+					IssuerSerial struct {
+						Issuer       asn1.RawValue
+						SerialNumber *big.Int
+					}
+				}
+			}
+			if _, err := asn1.Unmarshal(attribute.Value.Bytes, &signingCertificate); err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if len(signingCertificate.Certs) != 1 {
+				t.Fatalf("expected a single ESSCertIDv2, got %d", len(signingCertificate.Certs))
+			}
+			certID := signingCertificate.Certs[0]
+			if !certID.HashAlgorithm.Algorithm.Equal(tt.wantAlgorithm) {
+				t.Errorf("expected hash algorithm %v, got %v", tt.wantAlgorithm, certID.HashAlgorithm.Algorithm)
+			}
+			if !bytes.Equal(certID.CertHash, tt.wantHash) {
+				t.Errorf("certHash does not match the signing certificate")
+			}
+
+			var directoryName asn1.RawValue
+			if _, err := asn1.Unmarshal(certID.IssuerSerial.Issuer.Bytes, &directoryName); err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if directoryName.Class != asn1.ClassContextSpecific || directoryName.Tag != 4 || !bytes.Equal(directoryName.Bytes, cert.RawIssuer) {
+				t.Errorf("expected the issuer as directoryName")
+			}
+			if certID.IssuerSerial.SerialNumber.Cmp(cert.SerialNumber) != 0 {
+				t.Errorf("expected serial number %s, got %s", cert.SerialNumber, certID.IssuerSerial.SerialNumber)
+			}
+		})
+	}
+}
+
+func TestSignPDFRevocationInfoArchival(t *testing.T) {
+	h := newIssuerHierarchy(t)
+
+	ocspResponse, err := ocsp.CreateResponse(h.intermediate, h.intermediate, ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: h.leaf.SerialNumber,
+		ThisUpdate:   time.Now().Add(-time.Minute),
+		NextUpdate:   time.Now().Add(time.Hour),
+	}, h.intermediateKey)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Minute),
+		NextUpdate: time.Now().Add(time.Hour),
+	}, h.root, h.rootKey)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	input, err := os.ReadFile("../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	tests := []struct {
+		name               string
+		revocationFunction RevocationFunction
+		wantOCSP, wantCRL  int
+	}{
+		{name: "without revocation data"},
+		{
+			name: "OCSP response and CRL",
+			revocationFunction: func(cert, issuer *x509.Certificate, i *revocation.InfoArchival) error {
+				switch {
+				case cert.Equal(h.leaf):
+					return i.AddOCSP(ocspResponse)
+				case cert.Equal(h.intermediate):
+					return i.AddCRL(crl)
+				}
+				return nil
+			},
+			wantOCSP: 1,
+			wantCRL:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output bytes.Buffer
+			err := Sign(bytes.NewReader(input), &output, nil, int64(len(input)), SignData{
+				Signature: SignDataSignature{
+					Info: SignDataSignatureInfo{
+						Name: "John Doe",
+						Date: time.Now().Local(),
+					},
+					CertType: ApprovalSignature,
+				},
+				Signer:             h.leafKey,
+				Certificate:        h.leaf,
+				CertificateChains:  [][]*x509.Certificate{{h.leaf, h.intermediate, h.root}},
+				DigestAlgorithm:    crypto.SHA256,
+				RevocationFunction: tt.revocationFunction,
+			})
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			rdr, err := pdf.NewReader(bytes.NewReader(output.Bytes()), int64(output.Len()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			v := rdr.Trailer().Key("Root").Key("AcroForm").Key("Fields").Index(0).Key("V")
+			p7, err := pkcs7.Parse([]byte(v.Key("Contents").RawString()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			var info revocation.InfoArchival
+			err = p7.UnmarshalSignedAttribute(asn1.ObjectIdentifier{1, 2, 840, 113583, 1, 1, 8}, &info)
+			if tt.wantOCSP == 0 && tt.wantCRL == 0 {
+				if err == nil {
+					t.Fatalf("expected no adbe-revocationInfoArchival attribute without revocation data")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if len(info.OCSP) != tt.wantOCSP || len(info.CRL) != tt.wantCRL {
+				t.Fatalf("expected %d OCSP responses and %d CRLs, got %d and %d", tt.wantOCSP, tt.wantCRL, len(info.OCSP), len(info.CRL))
+			}
+			if !bytes.Equal(info.OCSP[0].FullBytes, ocspResponse) || !bytes.Equal(info.CRL[0].FullBytes, crl) {
+				t.Errorf("the archived revocation data does not match")
+			}
+
+			result, err := verify.Verify(bytes.NewReader(output.Bytes()), int64(output.Len()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if len(result.Signers) != 1 || !result.Signers[0].ValidSignature {
+				t.Fatalf("expected a valid signature")
+			}
+			for _, certificate := range result.Signers[0].Certificates {
+				if certificate.Certificate.Equal(h.leaf) && (!certificate.OCSPEmbedded || !certificate.CRLEmbedded) {
+					t.Errorf("expected the embedded revocation data of the signer, got OCSP %v and CRL %v", certificate.OCSPEmbedded, certificate.CRLEmbedded)
+				}
+			}
+		})
+	}
+}
@@ -1,10 +1,17 @@
 package sign
 
 import (
+	"regexp"
 	"strconv"
 	"strings"
 )
 
+var (
+	trailerSize    = regexp.MustCompile(`\bSize\s+\d+`)
+	trailerPrev    = regexp.MustCompile(`\bPrev\s+\d+`)
+	trailerXRefStm = regexp.MustCompile(`\s*/XRefStm\s+\d+`)
+)
+
 func (context *SignContext) writeTrailer() error {
 	switch context.PDFReader.XrefInformation.Type {
 	case "table":
@@ -22,20 +29,24 @@ func (context *SignContext) writeTrailer() error {
 		root_string := "Root " + context.CatalogData.RootString
 		new_root := "Root " + strconv.FormatInt(int64(context.CatalogData.ObjectId), 10) + " 0 R"
 
-		size_string := "Size " + strconv.FormatInt(context.PDFReader.XrefInformation.ItemCount, 10)
 		new_size := "Size " + strconv.FormatInt(context.PDFReader.XrefInformation.ItemCount+int64(len(context.newXrefEntries)+1), 10)
-
-		prev_string := "Prev " + context.PDFReader.Trailer().Key("Prev").String()
 		new_prev := "Prev " + strconv.FormatInt(context.PDFReader.XrefInformation.StartPos, 10)
 
+		// The entries are replaced in the text of the trailer, the trailer of
+		// the reader of a hybrid-reference file has no Prev entry. The update
+		// has no cross-reference stream of its own, see xref.Extend.
 		trailer_string := string(trailer_buf)
 		trailer_string = strings.ReplaceAll(trailer_string, root_string, new_root)
-		trailer_string = strings.ReplaceAll(trailer_string, size_string, new_size)
-		if strings.Contains(trailer_string, prev_string) {
-			trailer_string = strings.ReplaceAll(trailer_string, prev_string, new_prev)
+		trailer_string = trailerSize.ReplaceAllLiteralString(trailer_string, new_size)
+		trailer_string = trailerXRefStm.ReplaceAllLiteralString(trailer_string, "")
+		if trailerPrev.MatchString(trailer_string) {
+			trailer_string = trailerPrev.ReplaceAllLiteralString(trailer_string, new_prev)
 		} else {
 			trailer_string = strings.ReplaceAll(trailer_string, new_root, new_root+"\n  /"+new_prev)
 		}
+		if context.InfoData.ObjectId != 0 {
+			trailer_string = strings.ReplaceAll(trailer_string, new_root, new_root+"\n  /Info "+strconv.FormatInt(int64(context.InfoData.ObjectId), 10)+" 0 R")
+		}
 
 		// Ensure the same amount of padding (two spaces) for each line, except when the line does not start with a whitespace already.
 		lines := strings.Split(trailer_string, "\n")
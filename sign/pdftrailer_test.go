@@ -0,0 +1,102 @@
+package sign
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdfsign/internal/xref"
+	"github.com/digitorus/pdfsign/verify"
+)
+
+// hybridReferenceDocument returns a hybrid-reference file, in which the
+// document information 5 is stored in the object stream 4 and listed in the
+// cross-reference stream 6 of the XRefStm entry only.
+func hybridReferenceDocument() []byte {
+	document := bytes.NewBufferString("%PDF-1.5\n")
+	offsets := make([]int, 4)
+	for id, object := range []string{
+		1: "<< /Type /Catalog /Pages 2 0 R >>",
+		2: "<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		3: "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >>",
+	} {
+		if object != "" {
+			offsets[id] = document.Len()
+			_, _ = fmt.Fprintf(document, "%d 0 obj\n%s\nendobj\n", id, object)
+		}
+	}
+	objects := "5 0 << /Producer (hybrid) >>\n"
+	stream := document.Len()
+	_, _ = fmt.Fprintf(document, "4 0 obj\n<< /Type /ObjStm /N 1 /First 4 /Length %d >>\nstream\n%s\nendstream\nendobj\n", len(objects), objects)
+	xrefStm := document.Len()
+	_, _ = fmt.Fprintf(document, "6 0 obj\n<< /Type /XRef /Size 7 /Index [5 1] /W [1 2 1] /Length 4 >>\nstream\n\x02\x00\x04\x00\nendstream\nendobj\n")
+
+	table := document.Len()
+	_, _ = fmt.Fprintf(document, "xref\n0 7\n0000000000 65535 f \n%010d 00000 n \n%010d 00000 n \n%010d 00000 n \n%010d 00000 n \n0000000000 00000 f \n0000000000 00000 f \n",
+		offsets[1], offsets[2], offsets[3], stream)
+	_, _ = fmt.Fprintf(document, "trailer\n<< /Size 7 /Root 1 0 R /Info 5 0 R /XRefStm %d >>\nstartxref\n%d\n%%%%EOF\n", xrefStm, table)
+	return document.Bytes()
+}
+
+func TestSignHybridReference(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+	document := hybridReferenceDocument()
+	table := bytes.LastIndex(document, []byte("\nxref\n")) + 1
+
+	for i := 1; i <= 2; i++ {
+		var output bytes.Buffer
+		err := Sign(bytes.NewReader(document), &output, nil, int64(len(document)), SignData{
+			Signature: SignDataSignature{
+				Info: SignDataSignatureInfo{
+					Name: fmt.Sprintf("Signer %d", i),
+					Date: time.Now().Local(),
+				},
+				CertType: ApprovalSignature,
+			},
+			Signer:      pkey,
+			Certificate: cert,
+		})
+		if err != nil {
+			t.Fatalf("signature %d: %s", i, err.Error())
+		}
+
+		// The update refers to the previous table and has no
+		// cross-reference stream of its own.
+		update := output.String()[len(document):]
+		trailer := update[strings.LastIndex(update, "trailer"):]
+		if !strings.Contains(trailer, fmt.Sprintf("/Prev %d", table)) || strings.Contains(trailer, "XRefStm") {
+			t.Errorf("signature %d: expected a trailer with /Prev %d and without XRefStm, got %q", i, table, trailer)
+		}
+		// The objects of the cross-reference stream keep their numbers.
+		for _, id := range []int{4, 5, 6} {
+			if strings.Contains(update, fmt.Sprintf("\n%d 0 obj", id)) {
+				t.Errorf("signature %d: the update reuses the object number %d", i, id)
+			}
+		}
+		table = len(document) + strings.LastIndex(update, "\nxref\n") + 1
+		document = output.Bytes()
+
+		rdr, err := xref.NewReader(bytes.NewReader(document), int64(len(document)))
+		if err != nil {
+			t.Fatalf("signature %d: %s", i, err.Error())
+		}
+		if producer := rdr.Trailer().Key("Info").Key("Producer").Text(); producer != "hybrid" {
+			t.Errorf("signature %d: expected the document information of the object stream, got %q", i, producer)
+		}
+
+		info, err := verify.Verify(bytes.NewReader(document), int64(len(document)))
+		if err != nil {
+			t.Fatalf("signature %d: %s", i, err.Error())
+		}
+		if len(info.Signers) != i {
+			t.Fatalf("expected %d signers, got %d", i, len(info.Signers))
+		}
+		for j, signer := range info.Signers {
+			if !signer.ValidSignature || signer.DisallowedModifications {
+				t.Errorf("after signature %d, signature %d is not valid: %v", i, j+1, signer.Modifications)
+			}
+		}
+	}
+}
@@ -3,6 +3,7 @@ package sign
 import (
 	"bytes"
 	"fmt"
+	"slices"
 	"strconv"
 
 	"github.com/digitorus/pdf"
@@ -102,18 +103,320 @@ func (context *SignContext) createVisualSignature(visible bool, pageNumber uint3
 	// Define the field type as a signature.
 	visual_signature.WriteString("  /FT /Sig\n")
 	// Set a unique title for the signature field.
-	visual_signature.WriteString(fmt.Sprintf("  /T %s\n", pdfString("Signature "+strconv.Itoa(len(context.existingSignatures)+1))))
+	visual_signature.WriteString(fmt.Sprintf("  /T %s\n", pdfString(context.signatureFieldName())))
 
 	// Reference the signature dictionary.
 	visual_signature.WriteString(fmt.Sprintf("  /V %d 0 R\n", context.SignData.objectId))
 
+	// Lock the form fields once the field is signed.
+	if lock := context.SignData.Signature.FieldLock; lock != nil {
+		visual_signature.WriteString("  /Lock " + lock.lockDictionary() + "\n")
+	}
+
 	// Close the dictionary and end the object.
 	visual_signature.WriteString(">>\n")
 
 	return visual_signature.Bytes(), nil
 }
 
-func (context *SignContext) createIncPageUpdate(pageNumber, annot uint32) ([]byte, error) {
+// signatureFieldName returns a name for the new signature field that is not used
+// by any of the existing fields, fields with the same fully qualified name would
+// otherwise be treated as a single field.
+func (context *SignContext) signatureFieldName() string {
+	used := make(map[string]bool)
+
+	fields := context.PDFReader.Trailer().Key("Root").Key("AcroForm").Key("Fields")
+	for i := 0; i < fields.Len(); i++ {
+		used[fields.Index(i).Key("T").Text()] = true
+	}
+
+	for n := len(context.existingSignatures) + 1; ; n++ {
+		name := "Signature " + strconv.Itoa(n)
+		if !used[name] {
+			return name
+		}
+	}
+}
+
+// appearancePages returns the page numbers the visible signature is placed on.
+func (context *SignContext) appearancePages() ([]uint32, error) {
+	appearance := context.SignData.Appearance
+
+	if appearance.AllPages {
+		count := context.PDFReader.NumPage()
+		if count < 1 {
+			return nil, fmt.Errorf("document has no pages")
+		}
+
+		pages := make([]uint32, count)
+		for i := range pages {
+			pages[i] = uint32(i + 1)
+		}
+		return pages, nil
+	}
+
+	if len(appearance.Pages) == 0 {
+		return []uint32{appearance.Page}, nil
+	}
+
+	// A page can only contain one widget of the field.
+	var pages []uint32
+	seen := make(map[uint32]bool)
+	for _, page := range appearance.Pages {
+		if !seen[page] {
+			seen[page] = true
+			pages = append(pages, page)
+		}
+	}
+	return pages, nil
+}
+
+// addMultiPageVisualSignature adds a signature field with a widget annotation on
+// each of the given pages. All widgets are kids of the same field and share the
+// appearance stream, so they represent a single signature.
+func (context *SignContext) addMultiPageVisualSignature(pages []uint32, rect [4]float64) error {
+	appearance, err := context.createAppearance(rect)
+	if err != nil {
+		return fmt.Errorf("failed to create appearance: %w", err)
+	}
+
+	appearanceObjectId, err := context.addObject(appearance)
+	if err != nil {
+		return fmt.Errorf("failed to add appearance object: %w", err)
+	}
+
+	// The field is written after its widgets, which reference it as parent.
+	fieldObjectId := context.getNextObjectID() + uint32(len(pages))
+
+	root := context.PDFReader.Trailer().Key("Root")
+
+	widgets := make([]uint32, 0, len(pages))
+	for _, pageNumber := range pages {
+		page, err := findPageByNumber(root.Key("Pages"), pageNumber)
+		if err != nil {
+			return err
+		}
+		page_ptr := page.GetPtr()
+
+		var widget bytes.Buffer
+		widget.WriteString("<<\n")
+		widget.WriteString("  /Type /Annot\n")
+		widget.WriteString("  /Subtype /Widget\n")
+		widget.WriteString(fmt.Sprintf("  /Rect [%f %f %f %f]\n", rect[0], rect[1], rect[2], rect[3]))
+		widget.WriteString(fmt.Sprintf("  /AP << /N %d 0 R >>\n", appearanceObjectId))
+		widget.WriteString("  /P " + strconv.Itoa(int(page_ptr.GetID())) + " " + strconv.Itoa(int(page_ptr.GetGen())) + " R\n")
+		widget.WriteString(fmt.Sprintf("  /F %d\n", AnnotationFlagPrint|AnnotationFlagLocked))
+		widget.WriteString(fmt.Sprintf("  /Parent %d 0 R\n", fieldObjectId))
+		widget.WriteString(">>\n")
+
+		widgetObjectId, err := context.addObject(widget.Bytes())
+		if err != nil {
+			return fmt.Errorf("failed to add widget object: %w", err)
+		}
+		widgets = append(widgets, widgetObjectId)
+
+		inc_page_update, err := context.createIncPageUpdate(pageNumber, widgetObjectId)
+		if err != nil {
+			return fmt.Errorf("failed to create incremental page update: %w", err)
+		}
+		if err := context.updateObject(page_ptr.GetID(), inc_page_update); err != nil {
+			return fmt.Errorf("failed to add incremental page update object: %w", err)
+		}
+	}
+
+	var field bytes.Buffer
+	field.WriteString("<<\n")
+	field.WriteString("  /FT /Sig\n")
+	field.WriteString(fmt.Sprintf("  /T %s\n", pdfString(context.signatureFieldName())))
+	field.WriteString(fmt.Sprintf("  /V %d 0 R\n", context.SignData.objectId))
+	if lock := context.SignData.Signature.FieldLock; lock != nil {
+		field.WriteString("  /Lock " + lock.lockDictionary() + "\n")
+	}
+	field.WriteString("  /Kids [")
+	for i, widget := range widgets {
+		if i > 0 {
+			field.WriteString(" ")
+		}
+		field.WriteString(strconv.Itoa(int(widget)) + " 0 R")
+	}
+	field.WriteString("]\n")
+	field.WriteString(">>\n")
+
+	context.VisualSignData.objectId, err = context.addObject(field.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to add signature field object: %w", err)
+	}
+	if context.VisualSignData.objectId != fieldObjectId {
+		return fmt.Errorf("signature field written as object %d, expected %d", context.VisualSignData.objectId, fieldObjectId)
+	}
+
+	return nil
+}
+
+// fillSignatureField signs the existing, empty signature field with the given
+// fully qualified name. The field and its widgets keep their rectangle and
+// page, a new appearance is only created if the signature is visible.
+func (context *SignContext) fillSignatureField(name string, visible bool) error {
+	fields := context.PDFReader.Trailer().Key("Root").Key("AcroForm").Key("Fields")
+	field, fieldType, found := findFieldByName(fields, "", "", name)
+	if !found {
+		return fmt.Errorf("signature field %q not found", name)
+	}
+	if fieldType != "Sig" {
+		return fmt.Errorf("field %q is not a signature field", name)
+	}
+	if !field.Key("V").IsNull() {
+		return fmt.Errorf("signature field %q is already signed", name)
+	}
+
+	// The widget annotations are either merged with the field dictionary, or
+	// kids of the field without a partial name.
+	var widgets []pdf.Value
+	kids := field.Key("Kids")
+	for i := 0; i < kids.Len(); i++ {
+		widgets = append(widgets, kids.Index(i))
+	}
+	merged := len(widgets) == 0
+	if merged {
+		widgets = append(widgets, field)
+	}
+
+	var appearanceObjectId uint32
+	if visible {
+		rect, err := widgetRect(widgets[0])
+		if err != nil {
+			return err
+		}
+
+		appearance, err := context.createAppearance(rect)
+		if err != nil {
+			return fmt.Errorf("failed to create appearance: %w", err)
+		}
+
+		appearanceObjectId, err = context.addObject(appearance)
+		if err != nil {
+			return fmt.Errorf("failed to add appearance object: %w", err)
+		}
+	}
+
+	appearanceEntry := ""
+	if visible {
+		appearanceEntry = fmt.Sprintf("  /AP << /N %d 0 R >>\n", appearanceObjectId)
+	}
+
+	signatureEntry := fmt.Sprintf("  /V %d 0 R\n", context.SignData.objectId)
+	if lock := context.SignData.Signature.FieldLock; lock != nil {
+		signatureEntry += "  /Lock " + lock.lockDictionary() + "\n"
+	}
+	if merged {
+		signatureEntry += appearanceEntry
+	} else if visible {
+		for _, widget := range widgets {
+			widgetPtr := widget.GetPtr()
+			if err := context.updateObject(widgetPtr.GetID(), context.rewriteDictionary(widget, appearanceEntry, "AP")); err != nil {
+				return fmt.Errorf("failed to update widget object: %w", err)
+			}
+		}
+	}
+
+	skip := []string{"V", "Lock"}
+	if merged && visible {
+		skip = append(skip, "AP")
+	}
+	fieldPtr := field.GetPtr()
+	if err := context.updateObject(fieldPtr.GetID(), context.rewriteDictionary(field, signatureEntry, skip...)); err != nil {
+		return fmt.Errorf("failed to update signature field object: %w", err)
+	}
+
+	context.VisualSignData.objectId = fieldPtr.GetID()
+	context.VisualSignData.existingField = true
+
+	return nil
+}
+
+// findFieldByName searches the field hierarchy for the field with the given
+// fully qualified name (see 12.7.3.2, "Field names"), it also returns the field
+// type, which may be inherited from a parent field.
+func findFieldByName(fields pdf.Value, parentName, parentType, name string) (pdf.Value, string, bool) {
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Index(i)
+
+		partialName := field.Key("T").Text()
+		if partialName == "" {
+			// Widget annotation without a field of its own
+			continue
+		}
+
+		fullName := partialName
+		if parentName != "" {
+			fullName = parentName + "." + partialName
+		}
+
+		fieldType := parentType
+		if ft := field.Key("FT").Name(); ft != "" {
+			fieldType = ft
+		}
+
+		if fullName == name {
+			return field, fieldType, true
+		}
+
+		if kid, kidType, found := findFieldByName(field.Key("Kids"), fullName, fieldType, name); found {
+			return kid, kidType, true
+		}
+	}
+
+	return pdf.Value{}, "", false
+}
+
+// widgetRect returns the normalized rectangle of a widget annotation.
+func widgetRect(widget pdf.Value) ([4]float64, error) {
+	value := widget.Key("Rect")
+	if value.Len() != 4 {
+		return [4]float64{}, fmt.Errorf("signature widget has no valid rectangle")
+	}
+
+	var rect [4]float64
+	for i := range rect {
+		rect[i] = value.Index(i).Float64()
+	}
+
+	// The corners may be given in any order.
+	if rect[0] > rect[2] {
+		rect[0], rect[2] = rect[2], rect[0]
+	}
+	if rect[1] > rect[3] {
+		rect[1], rect[3] = rect[3], rect[1]
+	}
+
+	return rect, nil
+}
+
+// rewriteDictionary serializes an existing dictionary object for an incremental
+// update, without the skipped keys and with the extra entries appended.
+func (context *SignContext) rewriteDictionary(dict pdf.Value, extra string, skip ...string) []byte {
+	var buffer bytes.Buffer
+
+	dictPtr := dict.GetPtr()
+
+	buffer.WriteString("<<\n")
+	for _, key := range dict.Keys() {
+		if slices.Contains(skip, key) {
+			continue
+		}
+		_, _ = fmt.Fprintf(&buffer, "  /%s ", key)
+		context.serializeCatalogEntry(&buffer, dictPtr.GetID(), dict.Key(key))
+		buffer.WriteString("\n")
+	}
+	buffer.WriteString(extra)
+	buffer.WriteString(">>\n")
+
+	return buffer.Bytes()
+}
+
+// createIncPageUpdate returns the page dictionary with the annotations added to
+// its /Annots array.
+func (context *SignContext) createIncPageUpdate(pageNumber uint32, annots ...uint32) ([]byte, error) {
 	var page_buffer bytes.Buffer
 
 	// Retrieve the root object from the PDF trailer.
@@ -153,7 +456,9 @@ func (context *SignContext) createIncPageUpdate(pageNumber, annot uint32) ([]byt
 				ptr := page.Key(key).Index(i).GetPtr()
 				page_buffer.WriteString(fmt.Sprintf("    %d 0 R\n", ptr.GetID()))
 			}
-			page_buffer.WriteString(fmt.Sprintf("    %d 0 R\n", annot))
+			for _, annot := range annots {
+				page_buffer.WriteString(fmt.Sprintf("    %d 0 R\n", annot))
+			}
 			page_buffer.WriteString("  ]\n")
 		default:
 			page_buffer.WriteString(fmt.Sprintf("  /%s %s\n", key, page.Key(key).String()))
@@ -161,7 +466,14 @@ func (context *SignContext) createIncPageUpdate(pageNumber, annot uint32) ([]byt
 	}
 
 	if page.Key("Annots").IsNull() {
-		page_buffer.WriteString(fmt.Sprintf("  /Annots [%d 0 R]\n", annot))
+		page_buffer.WriteString("  /Annots [")
+		for i, annot := range annots {
+			if i > 0 {
+				page_buffer.WriteString(" ")
+			}
+			page_buffer.WriteString(fmt.Sprintf("%d 0 R", annot))
+		}
+		page_buffer.WriteString("]\n")
 	}
 
 	page_buffer.WriteString(">>\n")
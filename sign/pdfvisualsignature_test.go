@@ -1,11 +1,14 @@
 package sign
 
 import (
+	"bytes"
+	"fmt"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/verify"
 )
 
 func TestVisualSignature(t *testing.T) {
@@ -65,3 +68,216 @@ func TestVisualSignature(t *testing.T) {
 		t.Errorf("Visual signature mismatch, expected\n%q\nbut got\n%q", expected_visual_signature, visual_signature)
 	}
 }
+
+func TestSignPDFVisibleOnMultiplePages(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	tests := []struct {
+		name       string
+		file       string
+		appearance Appearance
+		pages      []int
+	}{
+		{
+			name:       "all pages",
+			file:       "testfile16.pdf",
+			appearance: Appearance{AllPages: true},
+			pages:      []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14},
+		},
+		{
+			name:       "selected pages",
+			file:       "testfile16.pdf",
+			appearance: Appearance{Pages: []uint32{2, 5, 2}},
+			pages:      []int{2, 5},
+		},
+		{
+			name:       "two page document",
+			file:       "testfile12.pdf",
+			appearance: Appearance{AllPages: true},
+			pages:      []int{1, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, err := os.ReadFile("../testfiles/" + tt.file)
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			rdr, err := pdf.NewReader(bytes.NewReader(input), int64(len(input)))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			appearance := tt.appearance
+			appearance.Visible = true
+			appearance.LowerLeftX = 350
+			appearance.LowerLeftY = 75
+			appearance.UpperRightX = 600
+			appearance.UpperRightY = 100
+
+			var output bytes.Buffer
+			err = Sign(bytes.NewReader(input), &output, rdr, int64(len(input)), SignData{
+				Signature: SignDataSignature{
+					Info: SignDataSignatureInfo{
+						Name: "John Doe",
+						Date: time.Now().Local(),
+					},
+					CertType: ApprovalSignature,
+				},
+				Appearance:  appearance,
+				Signer:      pkey,
+				Certificate: cert,
+			})
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			signed, err := pdf.NewReader(bytes.NewReader(output.Bytes()), int64(output.Len()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			fields := signed.Trailer().Key("Root").Key("AcroForm").Key("Fields")
+			field := fields.Index(fields.Len() - 1)
+			kids := field.Key("Kids")
+			if kids.Len() != len(tt.pages) {
+				t.Fatalf("expected %d widgets, got %d", len(tt.pages), kids.Len())
+			}
+
+			for i, pageNumber := range tt.pages {
+				widget := kids.Index(i)
+				if widget.Key("Parent").Key("FT").Name() != "Sig" {
+					t.Errorf("widget %d does not reference the signature field", i)
+				}
+
+				annots := signed.Page(pageNumber).V.Key("Annots")
+				last := annots.Index(annots.Len() - 1).GetPtr()
+				widgetPtr := widget.GetPtr()
+				if last.GetID() != widgetPtr.GetID() {
+					t.Errorf("page %d does not contain the signature widget", pageNumber)
+				}
+			}
+
+			info, err := verify.Verify(bytes.NewReader(output.Bytes()), int64(output.Len()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if len(info.Signers) != 1 || !info.Signers[0].ValidSignature {
+				t.Errorf("expected a single valid signature")
+			}
+		})
+	}
+}
+
+// addEmptySignatureField adds an unsigned signature field on the first page, as
+// created by a form editor. The corners of the rectangle are given in reverse.
+func addEmptySignatureField(t *testing.T, document []byte, name string) []byte {
+	t.Helper()
+
+	var output bytes.Buffer
+	err := PrepareFields(bytes.NewReader(document), &output, []SignatureField{{
+		Name:        name,
+		Page:        1,
+		LowerLeftX:  300,
+		LowerLeftY:  150,
+		UpperRightX: 100,
+		UpperRightY: 50,
+	}})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	return output.Bytes()
+}
+
+func TestSignPDFExistingField(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	input, err := os.ReadFile("../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	input = addEmptySignatureField(t, input, "Approver")
+
+	sign := func(document []byte, fieldName string, visible bool) ([]byte, error) {
+		rdr, err := pdf.NewReader(bytes.NewReader(document), int64(len(document)))
+		if err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+
+		var output bytes.Buffer
+		err = Sign(bytes.NewReader(document), &output, rdr, int64(len(document)), SignData{
+			Signature: SignDataSignature{
+				Info: SignDataSignatureInfo{
+					Name: "John Doe",
+					Date: time.Now().Local(),
+				},
+				CertType: ApprovalSignature,
+			},
+			Appearance: Appearance{
+				Visible: visible,
+			},
+			FieldName:   fieldName,
+			Signer:      pkey,
+			Certificate: cert,
+		})
+		return output.Bytes(), err
+	}
+
+	for _, visible := range []bool{false, true} {
+		t.Run(fmt.Sprintf("visible %t", visible), func(t *testing.T) {
+			output, err := sign(input, "Approver", visible)
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			signed, err := pdf.NewReader(bytes.NewReader(output), int64(len(output)))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			fields := signed.Trailer().Key("Root").Key("AcroForm").Key("Fields")
+			if fields.Len() != 1 {
+				t.Fatalf("expected the existing field only, got %d fields", fields.Len())
+			}
+			field := fields.Index(0)
+			if field.Key("T").Text() != "Approver" {
+				t.Errorf("expected field name Approver, got %q", field.Key("T").Text())
+			}
+			if field.Key("V").Key("Contents").IsNull() {
+				t.Errorf("expected the field to reference the signature")
+			}
+			if rect := field.Key("Rect"); rect.Index(0).Float64() != 300 || rect.Index(3).Float64() != 50 {
+				t.Errorf("expected the widget rectangle to be preserved, got %s", rect)
+			}
+			if hasAppearance := !field.Key("AP").IsNull(); hasAppearance != visible {
+				t.Errorf("expected appearance %t, got %t", visible, hasAppearance)
+			}
+			if visible {
+				bbox := field.Key("AP").Key("N").Key("BBox")
+				if bbox.Index(2).Float64() != 200 || bbox.Index(3).Float64() != 100 {
+					t.Errorf("expected the appearance to fill the widget, got %s", bbox)
+				}
+			}
+			if annots := signed.Page(1).V.Key("Annots"); annots.Len() != 1 {
+				t.Errorf("expected the page to keep a single widget, got %d", annots.Len())
+			}
+
+			info, err := verify.Verify(bytes.NewReader(output), int64(len(output)))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if len(info.Signers) != 1 || !info.Signers[0].ValidSignature {
+				t.Errorf("expected a single valid signature")
+			}
+
+			if _, err := sign(output, "Approver", false); err == nil {
+				t.Errorf("expected an error when signing a signed field")
+			}
+		})
+	}
+
+	if _, err := sign(input, "Reviewer", false); err == nil {
+		t.Errorf("expected an error for an unknown field")
+	}
+}
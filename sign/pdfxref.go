@@ -41,7 +41,7 @@ func (context *SignContext) addObject(object []byte) (uint32, error) {
 	objectID := context.lastXrefID + uint32(len(context.newXrefEntries)) + 1
 	context.newXrefEntries = append(context.newXrefEntries, xrefEntry{
 		ID:     objectID,
-		Offset: int64(context.OutputBuffer.Buff.Len()) + 1,
+		Offset: context.outputLength() + 1,
 	})
 
 	err := context.writeObject(objectID, object)
@@ -55,7 +55,7 @@ func (context *SignContext) addObject(object []byte) (uint32, error) {
 func (context *SignContext) updateObject(id uint32, object []byte) error {
 	context.updatedXrefEntries = append(context.updatedXrefEntries, xrefEntry{
 		ID:     id,
-		Offset: int64(context.OutputBuffer.Buff.Len()) + 1,
+		Offset: context.outputLength() + 1,
 	})
 
 	err := context.writeObject(id, object)
@@ -74,6 +74,12 @@ func (context *SignContext) writeObject(id uint32, object []byte) error {
 
 	// Write the object content
 	object = bytes.TrimSpace(object)
+	if context.security != nil {
+		var err error
+		if object, err = context.security.encryptObject(id, object); err != nil {
+			return fmt.Errorf("failed to encrypt object: %w", err)
+		}
+	}
 	if _, err := context.OutputBuffer.Write(object); err != nil {
 		return fmt.Errorf("failed to write object content: %w", err)
 	}
@@ -91,7 +97,7 @@ func (context *SignContext) writeXref() error {
 	if _, err := context.OutputBuffer.Write([]byte("\n")); err != nil {
 		return fmt.Errorf("failed to write newline before xref: %w", err)
 	}
-	context.NewXrefStart = int64(context.OutputBuffer.Buff.Len())
+	context.NewXrefStart = context.outputLength()
 
 	switch context.PDFReader.XrefInformation.Type {
 	case "table":
@@ -3,22 +3,23 @@ package sign
 import (
 	"bytes"
 	"compress/zlib"
-	"encoding/binary"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"sort"
 )
 
 const (
-	xrefStreamColumns   = 6 // Column width (1+4+1)
 	xrefStreamPredictor = 12
 	defaultPredictor    = 1  // No prediction (the default value)
 	pngSubPredictor     = 11 // PNG prediction (on encoding, PNG Sub on all rows)
 	pngUpPredictor      = 12 // PNG prediction (on encoding, PNG Up on all rows)
 )
 
-// writeXrefStream writes the cross-reference stream to the output buffer.
+// writeXrefStream writes the cross-reference stream to the output buffer, for
+// documents whose last cross-reference section is a stream as well. The
+// stream has an entry for itself, like the streams of most PDF writers.
 func (context *SignContext) writeXrefStream() error {
 	var buffer bytes.Buffer
 
@@ -27,7 +28,12 @@ func (context *SignContext) writeXrefStream() error {
 		predictor = xrefStreamPredictor
 	}
 
-	if err := writeXrefStreamEntries(&buffer, context); err != nil {
+	// The stream is the next object, written after a newline.
+	entries := context.xrefStreamEntries(xrefEntry{
+		ID:     context.getNextObjectID(),
+		Offset: context.outputLength() + 1,
+	})
+	if err := writeXrefStreamEntries(&buffer, entries, xrefOffsetWidth(entries)); err != nil {
 		return fmt.Errorf("failed to write xref stream entries: %w", err)
 	}
 
@@ -38,7 +44,7 @@ func (context *SignContext) writeXrefStream() error {
 
 	var xrefStreamObject bytes.Buffer
 
-	if err := writeXrefStreamHeader(&xrefStreamObject, context, len(streamBytes)); err != nil {
+	if err := writeXrefStreamHeader(&xrefStreamObject, context, entries, len(streamBytes)); err != nil {
 		return fmt.Errorf("failed to write xref stream header: %w", err)
 	}
 
@@ -54,21 +60,66 @@ func (context *SignContext) writeXrefStream() error {
 	return nil
 }
 
-// writeXrefStreamEntries writes the individual entries for the xref stream.
-func writeXrefStreamEntries(buffer *bytes.Buffer, context *SignContext) error {
-	// Write updated entries first
-	for _, entry := range context.updatedXrefEntries {
-		writeXrefStreamLine(buffer, 1, int(entry.Offset), 0)
+// xrefStreamEntries returns the updated and new entries and the entry of the
+// xref stream self, in the order of their object numbers. Of the entries of
+// an object that is written more than once, the last applies.
+func (context *SignContext) xrefStreamEntries(self xrefEntry) []xrefEntry {
+	entries := make([]xrefEntry, 0, len(context.updatedXrefEntries)+len(context.newXrefEntries)+1)
+	entries = append(entries, context.updatedXrefEntries...)
+	entries = append(entries, context.newXrefEntries...)
+	entries = append(entries, self)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].ID < entries[j].ID
+	})
+
+	unique := entries[:0]
+	for _, entry := range entries {
+		if n := len(unique); n > 0 && unique[n-1].ID == entry.ID {
+			unique[n-1] = entry
+			continue
+		}
+		unique = append(unique, entry)
 	}
+	return unique
+}
 
-	// Write new entries
-	for _, entry := range context.newXrefEntries {
-		writeXrefStreamLine(buffer, 1, int(entry.Offset), 0)
+// writeXrefStreamEntries writes the individual entries for the xref stream,
+// with offsets of width bytes.
+func writeXrefStreamEntries(buffer *bytes.Buffer, entries []xrefEntry, width int) error {
+	for _, entry := range entries {
+		writeXrefStreamLine(buffer, 1, entry.Offset, width, 0)
 	}
 
 	return nil
 }
 
+// xrefOffsetWidth returns the number of bytes of the offsets of the entries,
+// 4 bytes for documents up to 4 GB and up to 8 bytes for larger ones.
+func xrefOffsetWidth(entries []xrefEntry) int {
+	width := 4
+	for _, entry := range entries {
+		for width < 8 && entry.Offset>>(8*width) != 0 {
+			width++
+		}
+	}
+	return width
+}
+
+// xrefStreamIndex returns the Index array of the entries, ordered by object
+// number, a pair of the first object number and the number of objects for
+// each run of consecutive objects.
+func xrefStreamIndex(entries []xrefEntry) []uint32 {
+	var index []uint32
+	for i, entry := range entries {
+		if i > 0 && entries[i-1].ID+1 == entry.ID {
+			index[len(index)-1]++
+			continue
+		}
+		index = append(index, entry.ID, 1)
+	}
+	return index
+}
+
 // encodeXrefStream applies the appropriate encoding to the xref stream.
 func encodeXrefStream(data []byte, predictor int64) ([]byte, error) {
 	// Use FlateDecode without prediction for xref streams
@@ -83,34 +134,27 @@ func encodeXrefStream(data []byte, predictor int64) ([]byte, error) {
 	return b.Bytes(), nil
 }
 
-// writeXrefStreamHeader writes the header for the xref stream.
-func writeXrefStreamHeader(buffer *bytes.Buffer, context *SignContext, streamLength int) error {
-	id := context.PDFReader.Trailer().Key("ID")
-
-	// Calculate total entries and create index array
-	totalEntries := uint32(context.PDFReader.XrefInformation.ItemCount)
-	var indexArray []uint32
-
-	// Add existing entries section
-	if len(context.updatedXrefEntries) > 0 {
-		for _, entry := range context.updatedXrefEntries {
-			indexArray = append(indexArray, entry.ID, 1)
-		}
-	}
-
-	// Add new entries section
-	if len(context.newXrefEntries) > 0 {
-		indexArray = append(indexArray, context.lastXrefID+1, uint32(len(context.newXrefEntries)))
-		totalEntries += uint32(len(context.newXrefEntries))
+// writeXrefStreamHeader writes the header for the xref stream with the
+// entries, ordered by object number. The entries of the previous trailer that
+// apply to the whole document, Info and ID, are repeated, as readers only
+// use those of the last cross-reference stream.
+func writeXrefStreamHeader(buffer *bytes.Buffer, context *SignContext, entries []xrefEntry, streamLength int) error {
+	trailer := context.PDFReader.Trailer()
+	id := trailer.Key("ID")
+	indexArray := xrefStreamIndex(entries)
+
+	// The size covers the objects of the previous sections and the new ones.
+	size := uint32(context.PDFReader.XrefInformation.ItemCount)
+	if n := len(entries); n > 0 && entries[n-1].ID+1 > size {
+		size = entries[n-1].ID + 1
 	}
 
 	buffer.WriteString("<< /Type /XRef\n")
 	fmt.Fprintf(buffer, "  /Length %d\n", streamLength)
 	buffer.WriteString("  /Filter /FlateDecode\n")
-	// Change W array to [1 4 1] to accommodate larger offsets
-	buffer.WriteString("  /W [ 1 4 1 ]\n")
+	fmt.Fprintf(buffer, "  /W [ 1 %d 1 ]\n", xrefOffsetWidth(entries))
 	fmt.Fprintf(buffer, "  /Prev %d\n", context.PDFReader.XrefInformation.StartPos)
-	fmt.Fprintf(buffer, "  /Size %d\n", totalEntries+1)
+	fmt.Fprintf(buffer, "  /Size %d\n", size)
 
 	// Write index array if we have entries
 	if len(indexArray) > 0 {
@@ -122,6 +166,15 @@ func writeXrefStreamHeader(buffer *bytes.Buffer, context *SignContext, streamLen
 	}
 
 	fmt.Fprintf(buffer, "  /Root %d 0 R\n", context.CatalogData.ObjectId)
+	if context.InfoData.ObjectId != 0 {
+		fmt.Fprintf(buffer, "  /Info %d 0 R\n", context.InfoData.ObjectId)
+	} else if info := trailer.Key("Info"); !info.IsNull() {
+		ptr := info.GetPtr()
+		fmt.Fprintf(buffer, "  /Info %d %d R\n", ptr.GetID(), ptr.GetGen())
+	}
+	if context.security != nil {
+		fmt.Fprintf(buffer, "  /Encrypt %s\n", context.security.encryptEntry)
+	}
 
 	if !id.IsNull() {
 		id0 := hex.EncodeToString([]byte(id.Index(0).RawString()))
@@ -150,15 +203,16 @@ func writeXrefStreamContent(buffer *bytes.Buffer, streamBytes []byte) error {
 	return nil
 }
 
-// writeXrefStreamLine writes a single line in the xref stream.
-func writeXrefStreamLine(b *bytes.Buffer, xreftype byte, offset int, gen byte) {
+// writeXrefStreamLine writes a single line in the xref stream, with an
+// offset of width bytes.
+func writeXrefStreamLine(b *bytes.Buffer, xreftype byte, offset int64, width int, gen byte) {
 	// Write type (1 byte)
 	b.WriteByte(xreftype)
 
-	// Write offset (4 bytes)
-	offsetBytes := make([]byte, 4)
-	binary.BigEndian.PutUint32(offsetBytes, uint32(offset))
-	b.Write(offsetBytes)
+	// Write offset (width bytes, big-endian)
+	for shift := 8 * (width - 1); shift >= 0; shift -= 8 {
+		b.WriteByte(byte(offset >> shift))
+	}
 
 	// Write generation (1 byte)
 	b.WriteByte(gen)
@@ -5,8 +5,12 @@ import (
 	"compress/zlib"
 	"io"
 	"os"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/digitorus/pdf"
 	"github.com/mattetti/filebuffer"
@@ -16,7 +20,8 @@ func TestWriteXrefStreamLine(t *testing.T) {
 	tests := []struct {
 		name     string
 		xreftype byte
-		offset   int
+		offset   int64
+		width    int
 		gen      byte
 		expected []byte
 	}{
@@ -24,6 +29,7 @@ func TestWriteXrefStreamLine(t *testing.T) {
 			name:     "basic entry",
 			xreftype: 1,
 			offset:   1234,
+			width:    4,
 			gen:      0,
 			expected: []byte{1, 0, 0, 4, 210, 0},
 		},
@@ -31,6 +37,7 @@ func TestWriteXrefStreamLine(t *testing.T) {
 			name:     "zero entry",
 			xreftype: 0,
 			offset:   0,
+			width:    4,
 			gen:      0,
 			expected: []byte{0, 0, 0, 0, 0, 0},
 		},
@@ -38,22 +45,31 @@ func TestWriteXrefStreamLine(t *testing.T) {
 			name:     "max offset",
 			xreftype: 1,
 			offset:   16777215, // 2^24 - 1
+			width:    4,
 			gen:      255,
 			expected: []byte{1, 0, 255, 255, 255, 255},
 		},
+		{
+			name:     "offset beyond 4 GB",
+			xreftype: 1,
+			offset:   5 << 30,
+			width:    5,
+			gen:      0,
+			expected: []byte{1, 1, 64, 0, 0, 0, 0},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			var buf bytes.Buffer
-			writeXrefStreamLine(&buf, tt.xreftype, tt.offset, tt.gen)
+			writeXrefStreamLine(&buf, tt.xreftype, tt.offset, tt.width, tt.gen)
 			result := buf.Bytes()
 			if !bytes.Equal(result, tt.expected) {
 				t.Errorf("writeXrefStreamLine() = %v, want %v", result, tt.expected)
 				t.Errorf("hex: got %x, want %x", result, tt.expected)
 			}
-			if len(result) != xrefStreamColumns {
-				t.Errorf("incorrect length: got %d bytes, want %d bytes", len(result), xrefStreamColumns)
+			if len(result) != tt.width+2 {
+				t.Errorf("incorrect length: got %d bytes, want %d bytes", len(result), tt.width+2)
 			}
 		})
 	}
@@ -229,3 +245,100 @@ func TestWriteXrefStream(t *testing.T) {
 		}
 	}
 }
+
+func TestXrefStreamEntries(t *testing.T) {
+	context := &SignContext{
+		updatedXrefEntries: []xrefEntry{
+			{ID: 9, Offset: 300},
+			{ID: 2, Offset: 200},
+			{ID: 9, Offset: 400},
+		},
+		newXrefEntries: []xrefEntry{
+			{ID: 21, Offset: 500},
+			{ID: 22, Offset: 600},
+		},
+	}
+
+	entries := context.xrefStreamEntries(xrefEntry{ID: 23, Offset: 700})
+	var offsets []int64
+	for _, entry := range entries {
+		offsets = append(offsets, entry.Offset)
+	}
+	if want := []int64{200, 400, 500, 600, 700}; !slices.Equal(offsets, want) {
+		t.Errorf("xrefStreamEntries() offsets = %v, want %v", offsets, want)
+	}
+	if index, want := xrefStreamIndex(entries), []uint32{2, 1, 9, 1, 21, 3}; !slices.Equal(index, want) {
+		t.Errorf("xrefStreamIndex() = %v, want %v", index, want)
+	}
+}
+
+// TestSignXrefStreamUpdate signs the documents with a cross-reference stream
+// and checks that the stream of the update covers itself and keeps the
+// document information of the previous trailer.
+func TestSignXrefStreamUpdate(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	for _, file := range []string{"testfile17.pdf", "testfile30.pdf"} {
+		t.Run(file, func(t *testing.T) {
+			document, err := os.ReadFile("../testfiles/" + file)
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			rdr, err := pdf.NewReader(bytes.NewReader(document), int64(len(document)))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if rdr.XrefInformation.Type != "stream" {
+				t.Fatalf("expected a cross-reference stream, got %q", rdr.XrefInformation.Type)
+			}
+
+			var output bytes.Buffer
+			err = Sign(bytes.NewReader(document), &output, rdr, int64(len(document)), SignData{
+				Signature: SignDataSignature{
+					Info: SignDataSignatureInfo{
+						Name: "John Doe",
+						Date: time.Now().Local(),
+					},
+					CertType: ApprovalSignature,
+				},
+				Signer:      pkey,
+				Certificate: cert,
+			})
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			signed, err := pdf.NewReader(bytes.NewReader(output.Bytes()), int64(output.Len()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if signed.XrefInformation.Type != "stream" {
+				t.Errorf("expected a cross-reference stream in the update, got %q", signed.XrefInformation.Type)
+			}
+
+			// The last object of the update is the cross-reference stream.
+			update := output.String()[len(document):]
+			objects := regexp.MustCompile(`(?m)^(\d+) 0 obj$`).FindAllStringSubmatch(update, -1)
+			id, err := strconv.Atoi(objects[len(objects)-1][1])
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if size := signed.Trailer().Key("Size").Int64(); size != int64(id)+1 {
+				t.Errorf("expected the size %d, got %d", id+1, size)
+			}
+			xref := signed.Xref()
+			if len(xref) <= id {
+				t.Fatalf("expected an entry of the cross-reference stream %d", id)
+			}
+			if ptr := xref[id].Ptr(); ptr.GetID() != uint32(id) {
+				t.Errorf("expected an entry of the cross-reference stream %d, got %d", id, ptr.GetID())
+			}
+
+			if info := rdr.Trailer().Key("Info"); !info.IsNull() {
+				if got := signed.Trailer().Key("Info").GetPtr(); got != info.GetPtr() {
+					t.Errorf("expected the document information %v, got %v", info.GetPtr(), got)
+				}
+			}
+		})
+	}
+}
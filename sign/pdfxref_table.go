@@ -4,8 +4,18 @@ import (
 	"fmt"
 )
 
+// maxXrefTableOffset is the largest offset of the 10 digits of the entries of
+// a cross-reference table.
+const maxXrefTableOffset = 9999999999
+
 // writeIncrXrefTable writes the incremental cross-reference table to the output buffer.
 func (context *SignContext) writeIncrXrefTable() error {
+	// Larger documents need a cross-reference stream, the offsets of a
+	// table cannot be written.
+	if end := context.outputLength(); end > maxXrefTableOffset {
+		return fmt.Errorf("the offset %d does not fit in a cross-reference table, documents of 10 GB and more need a cross-reference stream", end)
+	}
+
 	// Write xref header
 	if _, err := context.OutputBuffer.Write([]byte("xref\n")); err != nil {
 		return fmt.Errorf("failed to write incremental xref header: %w", err)
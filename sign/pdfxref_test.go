@@ -2,7 +2,10 @@ package sign
 
 import (
 	"bytes"
+	"compress/zlib"
+	"io"
 	"os"
+	"regexp"
 	"strings"
 	"testing"
 
@@ -268,8 +271,8 @@ func TestWriteXrefTypeStream(t *testing.T) {
 			Buff: new(bytes.Buffer),
 		},
 		newXrefEntries: []xrefEntry{
-			{ID: 1, Offset: 100, Generation: 0, Free: false},
-			{ID: 2, Offset: 200, Generation: 0, Free: false},
+			{ID: 3, Offset: 100, Generation: 0, Free: false},
+			{ID: 4, Offset: 200, Generation: 0, Free: false},
 		},
 		lastXrefID: 2,
 	}
@@ -286,9 +289,30 @@ func TestWriteXrefTypeStream(t *testing.T) {
 		return
 	}
 
+	// The compressed bytes and their length depend on the zlib
+	// implementation, the entries are compared after decompression.
 	got := context.OutputBuffer.Buff.String()
-	expect := "\n\n5 0 obj\n<< /Type /XRef\n  /Length 22\n  /Filter /FlateDecode\n  /W [ 1 4 1 ]\n  /Prev 0\n  /Size 3\n  /Index [ 3 2 ]\n  /Root 0 0 R\n>>\nstream\nx\x9cbd``Ha\x00\x91'\x18\x00\x01\x00\x00\xff\xff\x04\xce\x01/\nendstream\nendobj\n"
-	if got != expect {
-		t.Errorf("writeXref() output = %q, want %q", got, expect)
+	header, stream, found := strings.Cut(got, ">>\nstream\n")
+	if !found {
+		t.Fatalf("writeXref() output = %q, want a stream", got)
+	}
+	header = regexp.MustCompile(`/Length \d+`).ReplaceAllString(header, "/Length N")
+	expect := "\n\n5 0 obj\n<< /Type /XRef\n  /Length N\n  /Filter /FlateDecode\n  /W [ 1 4 1 ]\n  /Prev 0\n  /Size 6\n  /Index [ 3 3 ]\n  /Root 0 0 R\n"
+	if header != expect {
+		t.Errorf("writeXref() header = %q, want %q", header, expect)
+	}
+
+	r, err := zlib.NewReader(strings.NewReader(strings.TrimSuffix(stream, "\nendstream\nendobj\n")))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	entries, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	// The entries of objects 3 and 4, and of the stream at offset 2.
+	want := []byte{1, 0, 0, 0, 100, 0, 1, 0, 0, 0, 200, 0, 1, 0, 0, 0, 2, 0}
+	if !bytes.Equal(entries, want) {
+		t.Errorf("writeXref() entries = %v, want %v", entries, want)
 	}
 }
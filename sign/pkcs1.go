@@ -0,0 +1,76 @@
+package sign
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// The adbe.x509.rsa_sha1 SubFilter (ISO 32000-1, 12.8.3.2) signs the
+// ByteRange with PKCS #1 v1.5, the Contents are the DER encoded OCTET STRING
+// of the signature value.
+
+// validatePKCS1 checks that the signer can create an adbe.x509.rsa_sha1
+// signature.
+func (context *SignContext) validatePKCS1() error {
+	if context.SignData.TSA.URL != "" {
+		return fmt.Errorf("signature timestamps can not be embedded in %s signatures", SubFilterAdbeX509RSASHA1)
+	}
+	if context.SignData.RevocationFunction != nil || context.SignData.CRLFetcher != nil {
+		return fmt.Errorf("revocation data can not be embedded in %s signatures", SubFilterAdbeX509RSASHA1)
+	}
+
+	switch context.SignData.SignatureAlgorithm {
+	case 0, RSAPKCS1v15:
+	default:
+		return fmt.Errorf("the %s SubFilter requires PKCS #1 v1.5, got %s", SubFilterAdbeX509RSASHA1, context.SignData.SignatureAlgorithm)
+	}
+	if _, ok := context.publicKey().(*rsa.PublicKey); !ok {
+		return fmt.Errorf("the %s SubFilter requires an RSA key", SubFilterAdbeX509RSASHA1)
+	}
+
+	switch context.SignData.DigestAlgorithm {
+	case crypto.SHA1, crypto.SHA256, crypto.SHA384, crypto.SHA512:
+	default:
+		return fmt.Errorf("unsupported digest algorithm %s for the %s SubFilter", context.SignData.DigestAlgorithm, SubFilterAdbeX509RSASHA1)
+	}
+
+	return nil
+}
+
+// certEntry returns the Cert entry of the signature dictionary, the signing
+// certificate followed by the rest of the first certificate chain.
+func (context *SignContext) certEntry() string {
+	certificates := []*x509.Certificate{context.SignData.Certificate}
+	if len(context.SignData.CertificateChains) > 0 && len(context.SignData.CertificateChains[0]) > 1 {
+		certificates = append(certificates, context.SignData.CertificateChains[0][1:]...)
+	}
+
+	// A single certificate is a byte string rather than an array.
+	if len(certificates) == 1 {
+		return "<" + hex.EncodeToString(certificates[0].Raw) + ">"
+	}
+	entries := make([]string, len(certificates))
+	for i, certificate := range certificates {
+		entries[i] = "<" + hex.EncodeToString(certificate.Raw) + ">"
+	}
+	return "[" + strings.Join(entries, " ") + "]"
+}
+
+// createPKCS1Signature returns the Contents of an adbe.x509.rsa_sha1
+// signature over the digest of the ByteRange content.
+func (context *SignContext) createPKCS1Signature(digest []byte) ([]byte, error) {
+	if context.SignData.Signer == nil {
+		return nil, fmt.Errorf("signer is required")
+	}
+
+	signature, err := context.SignData.Signer.Sign(context.random(), digest, context.SignData.DigestAlgorithm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+	return asn1.Marshal(signature)
+}
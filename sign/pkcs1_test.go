@@ -0,0 +1,221 @@
+package sign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/revocation"
+	"github.com/digitorus/pdfsign/verify"
+)
+
+// newRSAChain returns an RSA signing certificate issued by a test CA, and
+// the chain of both.
+func newRSAChain(t *testing.T) (*rsa.PrivateKey, []*x509.Certificate) {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	now := time.Now()
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "pdfsign Test CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "pdfsign Test RSA Signer"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	return key, []*x509.Certificate{certificate, ca}
+}
+
+func TestSignPDFAdbeX509RSASHA1(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+	chainKey, chain := newRSAChain(t)
+
+	input, err := os.ReadFile("../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	tests := []struct {
+		name   string
+		signer crypto.Signer
+		chain  []*x509.Certificate
+		digest crypto.Hash
+		want   crypto.Hash
+	}{
+		{name: "default digest", signer: pkey, chain: []*x509.Certificate{cert}, want: crypto.SHA1},
+		{name: "SHA-256 with chain", signer: chainKey, chain: chain, digest: crypto.SHA256, want: crypto.SHA256},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output bytes.Buffer
+			err := Sign(bytes.NewReader(input), &output, nil, int64(len(input)), SignData{
+				Signature: SignDataSignature{
+					Info: SignDataSignatureInfo{
+						Name: "John Doe",
+						Date: time.Now().Local(),
+					},
+					CertType:   CertificationSignature,
+					DocMDPPerm: AllowFillingExistingFormFieldsAndSignaturesPerms,
+				},
+				Signer:            tt.signer,
+				Certificate:       tt.chain[0],
+				CertificateChains: [][]*x509.Certificate{tt.chain},
+				DigestAlgorithm:   tt.digest,
+				SubFilter:         SubFilterAdbeX509RSASHA1,
+			})
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			rdr, err := pdf.NewReader(bytes.NewReader(output.Bytes()), int64(output.Len()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			v := rdr.Trailer().Key("Root").Key("AcroForm").Key("Fields").Index(0).Key("V")
+			if got := v.Key("SubFilter").Name(); got != "adbe.x509.rsa_sha1" {
+				t.Errorf("expected SubFilter adbe.x509.rsa_sha1, got %s", got)
+			}
+
+			// A single certificate is a string, a chain an array.
+			certs := v.Key("Cert")
+			if len(tt.chain) == 1 {
+				if certs.Kind() != pdf.String || certs.RawString() != string(tt.chain[0].Raw) {
+					t.Errorf("expected the signing certificate as Cert string")
+				}
+			} else if certs.Kind() != pdf.Array || certs.Len() != len(tt.chain) || certs.Index(1).RawString() != string(tt.chain[1].Raw) {
+				t.Errorf("expected the certificate chain as Cert array")
+			}
+
+			var content []byte
+			byteRange := v.Key("ByteRange")
+			for i := 0; i+1 < byteRange.Len(); i += 2 {
+				start := byteRange.Index(i).Int64()
+				content = append(content, output.Bytes()[start:start+byteRange.Index(i+1).Int64()]...)
+			}
+			var signature []byte
+			if _, err := asn1.Unmarshal([]byte(v.Key("Contents").RawString()), &signature); err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			h := tt.want.New()
+			h.Write(content)
+			if err := rsa.VerifyPKCS1v15(tt.chain[0].PublicKey.(*rsa.PublicKey), tt.want, h.Sum(nil), signature); err != nil {
+				t.Errorf("%s", err.Error())
+			}
+
+			info, err := verify.Verify(bytes.NewReader(output.Bytes()), int64(output.Len()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if len(info.Signers) != 1 || !info.Signers[0].ValidSignature {
+				t.Fatalf("expected a valid signature")
+			}
+			if len(info.Signers[0].Certificates) != len(tt.chain) {
+				t.Errorf("expected %d certificates, got %d", len(tt.chain), len(info.Signers[0].Certificates))
+			}
+		})
+	}
+}
+
+func TestValidatePKCS1(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	tests := []struct {
+		name     string
+		signData SignData
+		wantErr  bool
+	}{
+		{
+			name:     "RSA key",
+			signData: SignData{Signer: pkey, DigestAlgorithm: crypto.SHA512},
+		},
+		{
+			name:     "TSA",
+			signData: SignData{Signer: pkey, DigestAlgorithm: crypto.SHA1, TSA: TSA{URL: "http://localhost"}},
+			wantErr:  true,
+		},
+		{
+			name: "revocation data",
+			signData: SignData{Signer: pkey, DigestAlgorithm: crypto.SHA1, RevocationFunction: func(cert, issuer *x509.Certificate, i *revocation.InfoArchival) error {
+				return nil
+			}},
+			wantErr: true,
+		},
+		{
+			name:     "RSASSA-PSS",
+			signData: SignData{Signer: pkey, DigestAlgorithm: crypto.SHA256, SignatureAlgorithm: RSAPSS},
+			wantErr:  true,
+		},
+		{
+			name:     "ECDSA key",
+			signData: SignData{Signer: ecdsaKey, DigestAlgorithm: crypto.SHA256},
+			wantErr:  true,
+		},
+		{
+			name:     "SHA-3 digest",
+			signData: SignData{Signer: pkey, DigestAlgorithm: crypto.SHA3_256},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.signData.Certificate = cert
+			tt.signData.SubFilter = SubFilterAdbeX509RSASHA1
+			context := SignContext{SignData: tt.signData}
+			err := context.validateSignatureAlgorithm()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateSignatureAlgorithm() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package sign
+
+import (
+	"encoding/hex"
+	"errors"
+	"sync"
+
+	"github.com/digitorus/pdfsign/revocation"
+)
+
+// defaultTimestampTokenSize is the estimated size of a time-stamp response of
+// a TSA that did not respond before. Responses are mostly between 3 and 8 KB,
+// depending on the certificates the TSA includes.
+const defaultTimestampTokenSize = 9000
+
+// placeholderMargin is added to the placeholder when a signature is retried
+// because it did not fit, a new time-stamp token may be slightly larger.
+const placeholderMargin = 256
+
+var errSignatureTooLong = errors.New("signature does not fit in the placeholder")
+
+// timestampTokenSizes holds the size of the largest time-stamp response of
+// each TSA URL, so later signatures do not reserve the default size.
+var timestampTokenSizes sync.Map
+
+// recordTimestampTokenSize records the size of a time-stamp response of the
+// TSA at url.
+func recordTimestampTokenSize(url string, size int) {
+	for {
+		previous, loaded := timestampTokenSizes.LoadOrStore(url, size)
+		if !loaded || previous.(int) >= size || timestampTokenSizes.CompareAndSwap(url, previous, size) {
+			return
+		}
+	}
+}
+
+// timestampTokenSize returns the estimated size of a time-stamp response of
+// tsa or any of its fallbacks: the largest earlier response with a margin for
+// the nonce, the serial number and the time, or the default size.
+func timestampTokenSize(tsa TSA) int {
+	size := 0
+	for _, t := range append([]TSA{tsa}, tsa.Fallbacks...) {
+		estimate := defaultTimestampTokenSize
+		if recorded, ok := timestampTokenSizes.Load(t.URL); ok {
+			estimate = recorded.(int) + recorded.(int)/20 + 64
+		}
+		size = max(size, estimate)
+	}
+	return size
+}
+
+// timestampPlaceholderSize returns the hex encoded size that is reserved for
+// the time-stamp token. The estimate of the first attempt is kept for a
+// retry so the added length is not lost to a smaller estimate. Deterministic
+// signatures do not depend on earlier responses and reserve the default size.
+func (context *SignContext) timestampPlaceholderSize() uint32 {
+	if context.timestampTokenSize == 0 {
+		context.timestampTokenSize = defaultTimestampTokenSize
+		if !context.SignData.Deterministic {
+			context.timestampTokenSize = timestampTokenSize(context.SignData.TSA)
+		}
+	}
+	return uint32(hex.EncodedLen(context.timestampTokenSize))
+}
+
+// revisionState is the state of a SignContext that prepareSignature adds to,
+// it is restored before a signature is retried with a larger placeholder.
+type revisionState struct {
+	revocationData revocation.InfoArchival
+}
+
+func (context *SignContext) saveRevisionState() revisionState {
+	data := context.SignData.RevocationData
+	return revisionState{revocationData: revocation.InfoArchival{
+		CRL:   append(revocation.CRL(nil), data.CRL...),
+		OCSP:  append(revocation.OCSP(nil), data.OCSP...),
+		Other: data.Other,
+	}}
+}
+
+func (context *SignContext) restoreRevisionState(state revisionState) {
+	context.SignData.RevocationData = state.revocationData
+	context.newXrefEntries = nil
+	context.updatedXrefEntries = nil
+	context.preparedFields = nil
+	context.timestampCertificates = nil
+	context.dssObjectId = 0
+	context.InfoData = InfoData{}
+}
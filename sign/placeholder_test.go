@@ -0,0 +1,101 @@
+package sign
+
+import (
+	"bytes"
+	"crypto"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdf"
+)
+
+func TestTimestampTokenSize(t *testing.T) {
+	tsa := TSA{
+		URL:       "https://tsa.example.com/size",
+		Fallbacks: []TSA{{URL: "https://backup.example.com/size"}},
+	}
+	if size := timestampTokenSize(tsa); size != defaultTimestampTokenSize {
+		t.Errorf("expected the default size for unknown TSAs, got %d", size)
+	}
+
+	recordTimestampTokenSize(tsa.URL, 4000)
+	recordTimestampTokenSize(tsa.URL, 3000)
+	if size := timestampTokenSize(TSA{URL: tsa.URL}); size < 4000 || size >= defaultTimestampTokenSize {
+		t.Errorf("expected an estimate of the largest response, got %d", size)
+	}
+
+	// Any of the fallbacks may answer.
+	if size := timestampTokenSize(tsa); size != defaultTimestampTokenSize {
+		t.Errorf("expected the default size of the unknown fallback, got %d", size)
+	}
+}
+
+// signWithTSA signs testfile20.pdf with a signature timestamp of tsa.
+func signWithTSA(t *testing.T, tsa TSA) []byte {
+	t.Helper()
+
+	input, err := os.ReadFile("../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	rdr, err := pdf.NewReader(bytes.NewReader(input), int64(len(input)))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	cert, pkey := loadCertificateAndKey(t)
+	var output bytes.Buffer
+	err = Sign(bytes.NewReader(input), &output, rdr, int64(len(input)), SignData{
+		Signature: SignDataSignature{
+			Info: SignDataSignatureInfo{
+				Name: "John Doe",
+				Date: time.Now().Local(),
+			},
+			CertType: ApprovalSignature,
+		},
+		Signer:          pkey,
+		Certificate:     cert,
+		DigestAlgorithm: crypto.SHA256,
+		TSA:             tsa,
+	})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if count := bytes.Count(output.Bytes(), []byte("%%EOF")); count != bytes.Count(input, []byte("%%EOF"))+1 {
+		t.Errorf("expected a single incremental update, got %d revisions", count)
+	}
+
+	tmpfile, err := os.CreateTemp("", "pdfsign-placeholder")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer func() {
+		_ = os.Remove(tmpfile.Name())
+	}()
+	if _, err := tmpfile.Write(output.Bytes()); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	verifySignedFile(t, tmpfile, "testfile20.pdf")
+
+	return output.Bytes()
+}
+
+func TestSignPDFPlaceholderSize(t *testing.T) {
+	tsa := newTestTSA(t)
+
+	first := signWithTSA(t, TSA{URL: tsa.URL})
+	second := signWithTSA(t, TSA{URL: tsa.URL})
+	// The test TSA answers with about 1 KB instead of the default 9 KB.
+	if len(second) > len(first)-defaultTimestampTokenSize {
+		t.Errorf("expected the placeholder to shrink to the size of the earlier token, %d and %d bytes", len(first), len(second))
+	}
+}
+
+func TestSignPDFPlaceholderRetry(t *testing.T) {
+	tsa := newTestTSA(t)
+
+	// An estimate that is far too small requires a second attempt.
+	recordTimestampTokenSize(tsa.URL, 100)
+	signWithTSA(t, TSA{URL: tsa.URL})
+}
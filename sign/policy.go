@@ -0,0 +1,127 @@
+package sign
+
+import (
+	"crypto"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+)
+
+var (
+	oidAttributeSignaturePolicy = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 15}
+	oidSPQualifierURI           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 5, 1}
+)
+
+// signaturePolicyID reflects SignaturePolicyId, see RFC 5126, 5.8.1.
+type signaturePolicyID struct {
+	SigPolicyID         asn1.ObjectIdentifier
+	SigPolicyHash       otherHashAlgAndValue
+	SigPolicyQualifiers []sigPolicyQualifierInfo `asn1:"optional,omitempty"`
+}
+
+type otherHashAlgAndValue struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashValue     []byte
+}
+
+type sigPolicyQualifierInfo struct {
+	SigPolicyQualifierID asn1.ObjectIdentifier
+	SigQualifier         asn1.RawValue
+}
+
+// validateSignaturePolicy checks the signature policy of the signature and
+// calculates the digest of the policy document.
+func (context *SignContext) validateSignaturePolicy() error {
+	policy := context.SignData.SignaturePolicy
+	if policy == nil {
+		return nil
+	}
+
+	switch {
+	case context.SignData.Signature.CertType == TimeStampSignature:
+		return fmt.Errorf("document timestamps can not have a signature policy")
+	case context.SignData.SubFilter == SubFilterAdbeX509RSASHA1:
+		return fmt.Errorf("%s signatures have no signed attributes for a signature policy", SubFilterAdbeX509RSASHA1)
+	case len(policy.OID) == 0:
+		return fmt.Errorf("signature policy OID is required")
+	}
+
+	hash := policy.HashAlgorithm
+	if hash == 0 {
+		hash = crypto.SHA256
+	}
+	if !hash.Available() || getOIDFromHashAlgorithm(hash) == nil {
+		return fmt.Errorf("unsupported signature policy digest algorithm %s", hash)
+	}
+
+	digest := policy.Hash
+	switch {
+	case len(digest) == 0 && policy.Document == nil:
+		return fmt.Errorf("signature policy requires the hash or the document of the policy")
+	case len(digest) == 0:
+		h := hash.New()
+		h.Write(policy.Document)
+		digest = h.Sum(nil)
+	case len(digest) != hash.Size():
+		return fmt.Errorf("signature policy hash has %d bytes, %s digests have %d", len(digest), hash, hash.Size())
+	}
+
+	// The policy of the context is a copy, the caller's policy is not
+	// changed.
+	context.SignData.SignaturePolicy = &SignaturePolicy{
+		OID:           policy.OID,
+		Hash:          digest,
+		HashAlgorithm: hash,
+		URL:           policy.URL,
+	}
+	return nil
+}
+
+// signaturePolicyAttribute returns the signature-policy-identifier signed
+// attribute, or nil if the signature has no signature policy.
+func (context *SignContext) signaturePolicyAttribute() (*cmsAttribute, error) {
+	policy := context.SignData.SignaturePolicy
+	if policy == nil {
+		return nil, nil
+	}
+
+	id := signaturePolicyID{
+		SigPolicyID: policy.OID,
+		SigPolicyHash: otherHashAlgAndValue{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: getOIDFromHashAlgorithm(policy.HashAlgorithm)},
+			HashValue:     policy.Hash,
+		},
+	}
+	if policy.URL != "" {
+		uri, err := asn1.MarshalWithParams(policy.URL, "ia5")
+		if err != nil {
+			return nil, fmt.Errorf("invalid signature policy URL: %w", err)
+		}
+		id.SigPolicyQualifiers = []sigPolicyQualifierInfo{{
+			SigPolicyQualifierID: oidSPQualifierURI,
+			SigQualifier:         asn1.RawValue{FullBytes: uri},
+		}}
+	}
+
+	attribute, err := newCMSAttribute(oidAttributeSignaturePolicy, id)
+	if err != nil {
+		return nil, err
+	}
+	return &attribute, nil
+}
+
+// policyAttributes returns the signed attributes of the commitment type and
+// the signature policy that the signature has.
+func (context *SignContext) policyAttributes() ([]cmsAttribute, error) {
+	var attributes []cmsAttribute
+	for _, create := range []func() (*cmsAttribute, error){context.commitmentTypeAttribute, context.signaturePolicyAttribute} {
+		attribute, err := create()
+		if err != nil {
+			return nil, err
+		}
+		if attribute != nil {
+			attributes = append(attributes, *attribute)
+		}
+	}
+	return attributes, nil
+}
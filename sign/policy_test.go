@@ -0,0 +1,168 @@
+package sign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/asn1"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/verify"
+	"github.com/digitorus/pkcs7"
+)
+
+func TestSignPDFSignaturePolicy(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	input, err := os.ReadFile("../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	document := []byte("signature policy")
+	policy := &SignaturePolicy{
+		OID:      asn1.ObjectIdentifier{2, 16, 724, 1, 3, 1, 1, 2, 1, 9},
+		Document: document,
+		URL:      "https://example.com/policy.pdf",
+	}
+
+	var output bytes.Buffer
+	err = Sign(bytes.NewReader(input), &output, nil, int64(len(input)), SignData{
+		Signature: SignDataSignature{
+			Info: SignDataSignatureInfo{
+				Name: "John Doe",
+				Date: time.Now().Local(),
+			},
+			CertType:       CertificationSignature,
+			DocMDPPerm:     AllowFillingExistingFormFieldsAndSignaturesPerms,
+			CommitmentType: ProofOfOrigin,
+		},
+		Signer:          pkey,
+		Certificate:     cert,
+		DigestAlgorithm: crypto.SHA256,
+		Profile:         PAdESBaselineB,
+		SignaturePolicy: policy,
+	})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if policy.Hash != nil || policy.HashAlgorithm != 0 {
+		t.Errorf("expected the signature policy of the caller to be unchanged")
+	}
+
+	rdr, err := pdf.NewReader(bytes.NewReader(output.Bytes()), int64(output.Len()))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	v := rdr.Trailer().Key("Root").Key("AcroForm").Key("Fields").Index(0).Key("V")
+	p7, err := pkcs7.Parse([]byte(v.Key("Contents").RawString()))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	var id signaturePolicyID
+	if err := p7.UnmarshalSignedAttribute(oidAttributeSignaturePolicy, &id); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if !id.SigPolicyID.Equal(policy.OID) {
+		t.Errorf("expected policy %s, got %s", policy.OID, id.SigPolicyID)
+	}
+	digest := sha256.Sum256(document)
+	if !id.SigPolicyHash.HashAlgorithm.Algorithm.Equal(getOIDFromHashAlgorithm(crypto.SHA256)) || !bytes.Equal(id.SigPolicyHash.HashValue, digest[:]) {
+		t.Errorf("expected the SHA-256 digest of the policy document")
+	}
+	if len(id.SigPolicyQualifiers) != 1 || !id.SigPolicyQualifiers[0].SigPolicyQualifierID.Equal(oidSPQualifierURI) {
+		t.Fatalf("expected an SPuri qualifier")
+	}
+	var uri string
+	if _, err := asn1.UnmarshalWithParams(id.SigPolicyQualifiers[0].SigQualifier.FullBytes, &uri, "ia5"); err != nil || uri != policy.URL {
+		t.Errorf("expected the policy URL, got %q", uri)
+	}
+
+	var indication commitmentTypeIndication
+	if err := p7.UnmarshalSignedAttribute(oidAttributeCommitmentType, &indication); err != nil {
+		t.Errorf("expected the commitment type next to the signature policy: %s", err.Error())
+	}
+
+	info, err := verify.Verify(bytes.NewReader(output.Bytes()), int64(output.Len()))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if len(info.Signers) != 1 || !info.Signers[0].ValidSignature {
+		t.Errorf("expected a valid signature")
+	}
+}
+
+func TestValidateSignaturePolicy(t *testing.T) {
+	oid := asn1.ObjectIdentifier{1, 2, 3, 4}
+	sha512Digest := sha512.Sum512([]byte("policy"))
+
+	tests := []struct {
+		name     string
+		signData SignData
+		wantErr  bool
+	}{
+		{
+			name: "no signature policy",
+		},
+		{
+			name:     "hash",
+			signData: SignData{SignaturePolicy: &SignaturePolicy{OID: oid, Hash: sha512Digest[:], HashAlgorithm: crypto.SHA512}},
+		},
+		{
+			name:     "hash of the wrong size",
+			signData: SignData{SignaturePolicy: &SignaturePolicy{OID: oid, Hash: sha512Digest[:]}},
+			wantErr:  true,
+		},
+		{
+			name:     "no hash or document",
+			signData: SignData{SignaturePolicy: &SignaturePolicy{OID: oid}},
+			wantErr:  true,
+		},
+		{
+			name:     "no OID",
+			signData: SignData{SignaturePolicy: &SignaturePolicy{Document: []byte("policy")}},
+			wantErr:  true,
+		},
+		{
+			name:     "unsupported digest",
+			signData: SignData{SignaturePolicy: &SignaturePolicy{OID: oid, Document: []byte("policy"), HashAlgorithm: crypto.MD5}},
+			wantErr:  true,
+		},
+		{
+			name: "document timestamp",
+			signData: SignData{
+				Signature:       SignDataSignature{CertType: TimeStampSignature},
+				SignaturePolicy: &SignaturePolicy{OID: oid, Document: []byte("policy")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "PKCS #1 signature",
+			signData: SignData{
+				SubFilter:       SubFilterAdbeX509RSASHA1,
+				SignaturePolicy: &SignaturePolicy{OID: oid, Document: []byte("policy")},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			context := SignContext{SignData: tt.signData}
+			err := context.validateSignaturePolicy()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateSignaturePolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && tt.signData.SignaturePolicy != nil {
+				if _, err := context.signaturePolicyAttribute(); err != nil {
+					t.Errorf("%s", err.Error())
+				}
+			}
+		})
+	}
+}
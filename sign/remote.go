@@ -0,0 +1,234 @@
+package sign
+
+import (
+	"context"
+	"crypto"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/digitorus/pdf"
+	"github.com/mattetti/filebuffer"
+)
+
+// PreparedSignature is the result of the first phase of remote signing. The
+// key never has to be available to Prepare, the signature value is created
+// elsewhere and passed to Complete, or a complete CMS to CompleteCMS.
+type PreparedSignature struct {
+	Digest                 []byte      // Digest of the ByteRange, the message digest of an externally created CMS; of its SHA-1 digest for adbe.pkcs7.sha1
+	DigestAlgorithm        crypto.Hash // Digest algorithm of Digest and SignedAttributesDigest
+	SignedAttributes       []byte      // DER encoded signed attributes, signed as is by Ed25519 keys
+	SignedAttributesDigest []byte      // Digest of SignedAttributes, signed by RSA and ECDSA keys
+	State                  []byte      // Opaque state of the prepared document, passed to Complete or CompleteCMS
+}
+
+// remoteState is the State of a PreparedSignature.
+type remoteState struct {
+	Document           []byte
+	ByteRange          []int64
+	SignatureMaxLength uint32
+	SignedData         []byte
+	DigestAlgorithm    crypto.Hash
+}
+
+// Prepare writes the signature placeholder for sign_data and returns the
+// digests to sign, sign_data.Signer is not used. The Certificate is required
+// as it is part of the signed attributes.
+//
+// Set sign_data.TSA when a signature timestamp is added by Complete, the
+// placeholder reserves room for it. PAdES baseline-LT and LTA need the
+// validation material of the signature and are not supported, neither are a
+// RevocationFunction of ETSI.CAdES.detached signatures and adbe.x509.rsa_sha1
+// signatures.
+func Prepare(input io.ReadSeeker, rdr *pdf.Reader, size int64, sign_data SignData) (*PreparedSignature, error) {
+	if sign_data.Signature.CertType == TimeStampSignature {
+		return nil, fmt.Errorf("timestamp signatures can not be signed remotely")
+	}
+	if sign_data.Profile >= PAdESBaselineLT {
+		return nil, fmt.Errorf("profile %s is not supported for remote signing", sign_data.Profile)
+	}
+	if sign_data.SubFilter == SubFilterAdbeX509RSASHA1 {
+		return nil, fmt.Errorf("the %s SubFilter is not supported for remote signing", SubFilterAdbeX509RSASHA1)
+	}
+	// CAdES signatures keep the revocation data in the DSS, which is
+	// written after the signature.
+	if (sign_data.SubFilter == SubFilterETSICAdESDetached || sign_data.Profile != 0) && sign_data.RevocationFunction != nil {
+		return nil, fmt.Errorf("revocation data of %s signatures is not supported for remote signing", SubFilterETSICAdESDetached)
+	}
+	if sign_data.Certificate == nil {
+		return nil, fmt.Errorf("certificate is required")
+	}
+	sign_data.Signer = nil
+
+	input, rdr, size, err := repairDocument(input, rdr, size, sign_data)
+	if err != nil {
+		return nil, err
+	}
+	rdr, security, err := openSigningDocument(input, rdr, size, sign_data)
+	if err != nil {
+		return nil, err
+	}
+	sign_data.objectId = uint32(rdr.XrefInformation.ItemCount) + 2
+
+	context := SignContext{
+		PDFReader:              rdr,
+		InputFile:              input,
+		SignData:               sign_data,
+		SignatureMaxLengthBase: uint32(hex.EncodedLen(512)),
+		security:               security,
+	}
+
+	existingSignatures, err := context.fetchExistingSignatures()
+	if err != nil {
+		return nil, err
+	}
+	context.existingSignatures = existingSignatures
+
+	if err := context.prepareSignature(); err != nil {
+		return nil, err
+	}
+
+	// The state holds the complete document.
+	if err := context.bufferOutput(); err != nil {
+		return nil, err
+	}
+	digest, err := context.byteRangeDigest(context.contentHash())
+	if err != nil {
+		return nil, err
+	}
+	signedAttributes, err := context.signedAttributes()
+	if err != nil {
+		return nil, fmt.Errorf("new signed data: %w", err)
+	}
+	signed_data, signed, err := context.prepareSignedData(digest, signedAttributes)
+	if err != nil {
+		return nil, fmt.Errorf("new signed data: %w", err)
+	}
+	sd, err := asn1.Marshal(*signed_data)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := json.Marshal(remoteState{
+		Document:           context.OutputBuffer.Buff.Bytes(),
+		ByteRange:          context.ByteRangeValues,
+		SignatureMaxLength: context.SignatureMaxLength,
+		SignedData:         sd,
+		DigestAlgorithm:    context.SignData.DigestAlgorithm,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The CMS of adbe.pkcs7.sha1 signatures encapsulates the SHA-1 digest
+	// of the ByteRange, the message digest is calculated over it.
+	hash := context.SignData.DigestAlgorithm
+	if context.SignData.SubFilter == SubFilterAdbePKCS7SHA1 {
+		h := hash.New()
+		h.Write(digest)
+		digest = h.Sum(nil)
+	}
+	attributesDigest := hash.New()
+	attributesDigest.Write(signed)
+	noteLinearization(input, size, sign_data)
+
+	return &PreparedSignature{
+		Digest:                 digest,
+		DigestAlgorithm:        hash,
+		SignedAttributes:       signed,
+		SignedAttributesDigest: attributesDigest.Sum(nil),
+		State:                  state,
+	}, nil
+}
+
+// Complete finishes a prepared signature with the raw signature value over
+// the signed attributes, and writes the signed document to output. A
+// signature timestamp is requested from tsa if its URL is set.
+func Complete(output io.Writer, state []byte, signature []byte, tsa TSA) error {
+	return CompleteContext(context.Background(), output, state, signature, tsa)
+}
+
+// CompleteContext is Complete with a context that cancels the request to
+// the TSA.
+func CompleteContext(ctx context.Context, output io.Writer, state []byte, signature []byte, tsa TSA) error {
+	context, s, err := restoreRemoteState(state)
+	if err != nil {
+		return err
+	}
+	context.SignData.Context = ctx
+
+	var signed_data cmsSignedData
+	if rest, err := asn1.Unmarshal(s.SignedData, &signed_data); err != nil || len(rest) > 0 || len(signed_data.SignerInfos) != 1 {
+		return fmt.Errorf("invalid state: malformed signed data")
+	}
+	signed_data.SignerInfos[0].EncryptedDigest = signature
+
+	if tsa.URL != "" {
+		context.SignData.TSA = tsa
+		if err := context.timestampSignedData(&signed_data); err != nil {
+			return err
+		}
+	}
+
+	cms, err := signed_data.finish()
+	if err != nil {
+		return err
+	}
+
+	return context.completeSignature(output, cms)
+}
+
+// CompleteCMS finishes a prepared signature with an externally created CMS
+// SignedData over the Digest, and writes the signed document to output.
+func CompleteCMS(output io.Writer, state []byte, cms []byte) error {
+	context, _, err := restoreRemoteState(state)
+	if err != nil {
+		return err
+	}
+	return context.completeSignature(output, cms)
+}
+
+func restoreRemoteState(state []byte) (*SignContext, *remoteState, error) {
+	var s remoteState
+	if err := json.Unmarshal(state, &s); err != nil {
+		return nil, nil, fmt.Errorf("invalid state: %w", err)
+	}
+	// The byte range must enclose exactly the delimited placeholder of
+	// SignatureMaxLength and end with the document, the signature is
+	// written between its first two ranges.
+	r := s.ByteRange
+	if len(r) != 4 || r[0] != 0 || r[1] <= 0 || s.SignatureMaxLength == 0 ||
+		r[1]+int64(s.SignatureMaxLength)+2 != r[2] || r[3] < 0 || r[2]+r[3] != int64(len(s.Document)) ||
+		s.Document[r[1]] != '<' || s.Document[r[2]-1] != '>' {
+		return nil, nil, fmt.Errorf("invalid state: byte range does not match the document")
+	}
+
+	return &SignContext{
+		OutputBuffer:       filebuffer.New(s.Document),
+		ByteRangeValues:    s.ByteRange,
+		SignatureMaxLength: s.SignatureMaxLength,
+		SignData: SignData{
+			DigestAlgorithm: s.DigestAlgorithm,
+		},
+	}, &s, nil
+}
+
+// completeSignature writes the signature into the prepared document and the
+// document to output.
+func (context *SignContext) completeSignature(output io.Writer, signature []byte) error {
+	dst := make([]byte, hex.EncodedLen(len(signature)))
+	hex.Encode(dst, signature)
+
+	if uint32(len(dst)) > context.SignatureMaxLength {
+		return fmt.Errorf("signature does not fit in the prepared placeholder (%d > %d)", len(dst), context.SignatureMaxLength)
+	}
+
+	if err := context.writeSignature(dst); err != nil {
+		return err
+	}
+
+	_, err := output.Write(context.OutputBuffer.Buff.Bytes())
+	return err
+}
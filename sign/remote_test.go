@@ -0,0 +1,179 @@
+package sign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/verify"
+	"github.com/digitorus/pkcs7"
+)
+
+func prepareTestSignature(t *testing.T, sign_data SignData) *PreparedSignature {
+	t.Helper()
+
+	input, err := os.ReadFile("../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	rdr, err := pdf.NewReader(bytes.NewReader(input), int64(len(input)))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	sign_data.Signature = SignDataSignature{
+		Info: SignDataSignatureInfo{
+			Name: "John Doe",
+			Date: time.Now().Local(),
+		},
+		CertType: ApprovalSignature,
+	}
+	prepared, err := Prepare(bytes.NewReader(input), rdr, int64(len(input)), sign_data)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	return prepared
+}
+
+func verifyTestSignature(t *testing.T, output []byte) {
+	t.Helper()
+
+	info, err := verify.Verify(bytes.NewReader(output), int64(len(output)))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if len(info.Signers) != 1 || !info.Signers[0].ValidSignature {
+		t.Errorf("expected a single valid signature")
+	}
+}
+
+func TestPrepareComplete(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	ecdsaCert := createTestCertificate(t, ecdsaKey)
+	tsa := newTestTSA(t)
+
+	tests := []struct {
+		name string
+		key  crypto.Signer
+		data SignData
+	}{
+		{name: "rsa", key: pkey, data: SignData{Certificate: cert}},
+		{name: "ecdsa", key: ecdsaKey, data: SignData{Certificate: ecdsaCert, DigestAlgorithm: crypto.SHA384}},
+		{name: "timestamp", key: pkey, data: SignData{Certificate: cert, TSA: TSA{URL: tsa.URL}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prepared := prepareTestSignature(t, tt.data)
+
+			// The remote service only receives the digest.
+			signature, err := tt.key.Sign(rand.Reader, prepared.SignedAttributesDigest, prepared.DigestAlgorithm)
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			var output bytes.Buffer
+			if err := Complete(&output, prepared.State, signature, tt.data.TSA); err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			verifyTestSignature(t, output.Bytes())
+		})
+	}
+}
+
+func TestPrepareCompleteCMS(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+	prepared := prepareTestSignature(t, SignData{Certificate: cert})
+
+	context, _, err := restoreRemoteState(prepared.State)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	content, err := context.byteRangeContent()
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	signed_data, err := pkcs7.NewSignedData(content)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	signed_data.SetDigestAlgorithm(pkcs7.OIDDigestAlgorithmSHA256)
+	if err := signed_data.AddSigner(cert, pkey, pkcs7.SignerInfoConfig{}); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	signed_data.Detach()
+	cms, err := signed_data.Finish()
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	var output bytes.Buffer
+	if err := CompleteCMS(&output, prepared.State, cms); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	verifyTestSignature(t, output.Bytes())
+
+	if err := CompleteCMS(&output, prepared.State, make([]byte, len(cms)*10)); err == nil {
+		t.Errorf("expected an error for a signature that does not fit the placeholder")
+	}
+	if err := Complete(&output, []byte("{}"), nil, TSA{}); err == nil {
+		t.Errorf("expected an error for an invalid state")
+	}
+}
+
+func TestCompleteCorruptedState(t *testing.T) {
+	cert, _ := loadCertificateAndKey(t)
+	prepared := prepareTestSignature(t, SignData{Certificate: cert})
+
+	var valid remoteState
+	if err := json.Unmarshal(prepared.State, &valid); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	r := valid.ByteRange
+
+	tests := []struct {
+		name    string
+		corrupt func(s *remoteState)
+	}{
+		{"byte range not at the start", func(s *remoteState) { s.ByteRange = []int64{1, r[1], r[2], r[3] - 1} }},
+		{"byte range beyond the document", func(s *remoteState) { s.ByteRange = []int64{0, r[1] + 1000, r[2] + 1000, r[3] - 1000} }},
+		{"gap larger than the placeholder", func(s *remoteState) { s.ByteRange = []int64{0, r[1], r[2] + 2, r[3] - 2} }},
+		{"placeholder larger than the gap", func(s *remoteState) { s.SignatureMaxLength += 100 }},
+		{"short document", func(s *remoteState) { s.Document = s.Document[:len(s.Document)-10] }},
+		{"shifted byte range", func(s *remoteState) { s.ByteRange = []int64{0, r[1] - 2, r[2] - 2, r[3] + 2} }},
+		{"negative byte range", func(s *remoteState) {
+			s.ByteRange = []int64{0, -int64(s.SignatureMaxLength) - 2, 0, int64(len(s.Document))}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := valid
+			s.Document = append([]byte(nil), valid.Document...)
+			tt.corrupt(&s)
+			state, err := json.Marshal(s)
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			var output bytes.Buffer
+			if err := Complete(&output, state, []byte("signature"), TSA{}); err == nil {
+				t.Errorf("expected an error for a corrupted state")
+			}
+			if err := CompleteCMS(&output, state, []byte("cms")); err == nil {
+				t.Errorf("expected an error for a corrupted state")
+			}
+		})
+	}
+}
@@ -92,7 +92,7 @@ func TestEmbedRevocationStatus(t *testing.T) {
 func TestEmbedOCSPRevocationStatus(t *testing.T) {
 	var ia revocation.InfoArchival
 
-	err := embedOCSPRevocationStatus(pemToCert(certPem), pemToCert(issuerPem), &ia)
+	err := DefaultOCSPFetcher.Embed(pemToCert(certPem), pemToCert(issuerPem), &ia)
 	if err != nil {
 		t.Errorf("%s", err.Error())
 	}
@@ -105,7 +105,7 @@ func TestEmbedOCSPRevocationStatus(t *testing.T) {
 func TestEmbedCRLRevocationStatus(t *testing.T) {
 	var ia revocation.InfoArchival
 
-	err := embedCRLRevocationStatus(pemToCert(certPem), nil, &ia)
+	err := DefaultCRLFetcher.Embed(pemToCert(certPem), pemToCert(issuerPem), &ia)
 	if err != nil {
 		t.Errorf("%s", err.Error())
 	}
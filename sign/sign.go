@@ -1,11 +1,15 @@
 package sign
 
 import (
-	"crypto"
+	"context"
+	"crypto/sha1"
 	"crypto/x509"
+	"encoding/asn1"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"os"
 
 	"github.com/digitorus/pdf"
@@ -37,15 +41,25 @@ func SignFile(input string, output string, sign_data SignData) error {
 	}
 	size := finfo.Size()
 
-	rdr, err := pdf.NewReader(input_file, size)
-	if err != nil {
-		return err
-	}
-
-	return Sign(input_file, output_file, rdr, size, sign_data)
+	return Sign(input_file, output_file, nil, size, sign_data)
 }
 
+// Sign signs the document in input and writes it to output. rdr is opened
+// from input when nil, encrypted documents are always read from input and
+// decrypted with sign_data.Password.
 func Sign(input io.ReadSeeker, output io.Writer, rdr *pdf.Reader, size int64, sign_data SignData) error {
+	if err := signingContext(&sign_data).Err(); err != nil {
+		return err
+	}
+
+	input, rdr, size, err := repairDocument(input, rdr, size, sign_data)
+	if err != nil {
+		return err
+	}
+	rdr, security, err := openSigningDocument(input, rdr, size, sign_data)
+	if err != nil {
+		return err
+	}
 	sign_data.objectId = uint32(rdr.XrefInformation.ItemCount) + 2
 
 	context := SignContext{
@@ -54,6 +68,7 @@ func Sign(input io.ReadSeeker, output io.Writer, rdr *pdf.Reader, size int64, si
 		OutputFile:             output,
 		SignData:               sign_data,
 		SignatureMaxLengthBase: uint32(hex.EncodedLen(512)),
+		security:               security,
 	}
 
 	// Fetch existing signatures
@@ -67,11 +82,99 @@ func Sign(input io.ReadSeeker, output io.Writer, rdr *pdf.Reader, size int64, si
 	if err != nil {
 		return err
 	}
+	noteLinearization(input, size, sign_data)
 
 	return nil
 }
 
+// signingContext returns the Context of sign_data, context.Background() if
+// it is nil, with the HTTPClient of sign_data.
+func signingContext(sign_data *SignData) context.Context {
+	ctx := sign_data.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if sign_data.HTTPClient != nil {
+		ctx = WithHTTPClient(ctx, sign_data.HTTPClient)
+	}
+	return ctx
+}
+
+// SignTimestampOnlyFile adds a document timestamp to the input file, see
+// SignTimestampOnly.
+func SignTimestampOnlyFile(input string, output string, tsa TSA) error {
+	return SignFile(input, output, timestampOnlySignData(tsa))
+}
+
+// SignTimestampOnly adds a document timestamp signature (SubFilter
+// ETSI.RFC3161) to the document. The signature field only contains a
+// timestamp token from the TSA over the complete document, no signer
+// certificate is needed. This proves the existence of the document at the time
+// of the timestamp and is used to build PAdES B-LTA chains.
+func SignTimestampOnly(input io.ReadSeeker, output io.Writer, rdr *pdf.Reader, size int64, tsa TSA) error {
+	return Sign(input, output, rdr, size, timestampOnlySignData(tsa))
+}
+
+func timestampOnlySignData(tsa TSA) SignData {
+	return SignData{
+		Signature: SignDataSignature{
+			CertType: TimeStampSignature,
+		},
+		TSA: tsa,
+	}
+}
+
 func (context *SignContext) SignPDF() error {
+	state := context.saveRevisionState()
+	for retried := false; ; retried = true {
+		if err := context.prepareSignature(); err != nil {
+			return err
+		}
+
+		// Replace signature, a signature that does not fit is retried once
+		// with a larger placeholder.
+		err := context.replaceSignature()
+		if errors.Is(err, errSignatureTooLong) && !retried {
+			log.Println("Signature too long, retrying with increased buffer size.")
+			context.restoreRevisionState(state)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to replace signature: %w", err)
+		}
+		break
+	}
+
+	// PAdES baseline-LT and above require the validation material to be
+	// present in the DSS of the document, as does the revocation data of
+	// other CAdES signatures.
+	if context.SignData.Profile >= PAdESBaselineLT || context.cades() && context.hasRevocationData() {
+		if err := context.bufferOutput(); err != nil {
+			return err
+		}
+		if err := context.addValidationInfo(); err != nil {
+			return fmt.Errorf("failed to add validation info: %w", err)
+		}
+	}
+
+	if context.SignData.Profile == PAdESBaselineLTA {
+		if err := context.addArchiveTimestamp(); err != nil {
+			return fmt.Errorf("failed to add archive timestamp: %w", err)
+		}
+	}
+
+	// Write final output
+	if _, err := io.Copy(context.OutputFile, context.outputSection(0, context.outputLength())); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// prepareSignature writes the incremental update with the signature
+// placeholder to the output buffer and fills in the ByteRange, the Contents
+// are left empty.
+func (context *SignContext) prepareSignature() error {
 	// set defaults
 	if context.SignData.Signature.CertType == 0 {
 		context.SignData.Signature.CertType = 1
@@ -79,24 +182,53 @@ func (context *SignContext) SignPDF() error {
 	if context.SignData.Signature.DocMDPPerm == 0 {
 		context.SignData.Signature.DocMDPPerm = 1
 	}
+	if context.SignData.Signature.DocMDPPerm > AllowFillingExistingFormFieldsAndSignaturesAndCRUDAnnotationsPerms {
+		return fmt.Errorf("invalid DocMDP permission level: %s", context.SignData.Signature.DocMDPPerm)
+	}
 	if !context.SignData.DigestAlgorithm.Available() {
-		context.SignData.DigestAlgorithm = crypto.SHA256
+		context.SignData.DigestAlgorithm = context.defaultDigestAlgorithm()
 	}
 	if context.SignData.Appearance.Page == 0 {
 		context.SignData.Appearance.Page = 1
 	}
 
-	context.OutputBuffer = filebuffer.New([]byte{})
+	if err := context.resolveSigner(); err != nil {
+		return err
+	}
 
-	// Copy old file into new buffer.
-	_, err := context.InputFile.Seek(0, 0)
-	if err != nil {
+	if err := context.validateProfile(); err != nil {
+		return err
+	}
+
+	if err := context.validateCommitmentType(); err != nil {
 		return err
 	}
-	if _, err := io.Copy(context.OutputBuffer, context.InputFile); err != nil {
+
+	if err := context.validateSignaturePolicy(); err != nil {
 		return err
 	}
 
+	if err := context.validateSignatureAlgorithm(); err != nil {
+		return err
+	}
+
+	if err := context.resolveFieldLock(); err != nil {
+		return err
+	}
+
+	if err := context.checkSeedValue(); err != nil {
+		return err
+	}
+
+	// The buffer holds the incremental update only, the old file is read
+	// from the input when the output is written.
+	context.OutputBuffer = filebuffer.New([]byte{})
+	inputLength, err := context.InputFile.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	context.inputLength = inputLength
+
 	// File always needs an empty line after %%EOF.
 	if _, err := context.OutputBuffer.Write([]byte("\n")); err != nil {
 		return err
@@ -105,32 +237,48 @@ func (context *SignContext) SignPDF() error {
 	// Base size for signature.
 	context.SignatureMaxLength = context.SignatureMaxLengthBase
 
+	// A document timestamp consists of the timestamp token only.
+	if context.SignData.Signature.CertType == TimeStampSignature && context.SignData.TSA.URL == "" {
+		return fmt.Errorf("TSA URL is required for timestamp signatures")
+	}
+
 	// If not a timestamp signature
 	if context.SignData.Signature.CertType != TimeStampSignature {
 		if context.SignData.Certificate == nil {
 			return fmt.Errorf("certificate is required")
 		}
 
-		switch context.SignData.Certificate.SignatureAlgorithm.String() {
-		case "SHA1-RSA":
-		case "ECDSA-SHA1":
-		case "DSA-SHA1":
-			context.SignatureMaxLength += uint32(hex.EncodedLen(128))
-		case "SHA256-RSA":
-		case "ECDSA-SHA256":
-		case "DSA-SHA256":
-			context.SignatureMaxLength += uint32(hex.EncodedLen(256))
-		case "SHA384-RSA":
-		case "ECDSA-SHA384":
-			context.SignatureMaxLength += uint32(hex.EncodedLen(384))
-		case "SHA512-RSA":
-		case "ECDSA-SHA512":
-			context.SignatureMaxLength += uint32(hex.EncodedLen(512))
+		// Add size of the signature value.
+		context.SignatureMaxLength += uint32(hex.EncodedLen(context.signatureSize()))
+
+		// Add size of the signature algorithm parameters.
+		signature_algorithm, err := context.signatureAlgorithmIdentifier()
+		if err != nil {
+			return fmt.Errorf("failed to create signature algorithm: %w", err)
 		}
+		context.SignatureMaxLength += uint32(hex.EncodedLen(len(signature_algorithm.Parameters.FullBytes)))
 
 		// Add size of digest algorithm twice (for file digist and signing certificate attribute)
 		context.SignatureMaxLength += uint32(hex.EncodedLen(context.SignData.DigestAlgorithm.Size() * 2))
 
+		// Add size of the commitment type and signature policy attributes.
+		policyAttributes, err := context.policyAttributes()
+		if err != nil {
+			return err
+		}
+		for _, attribute := range policyAttributes {
+			der, err := asn1.Marshal(attribute)
+			if err != nil {
+				return err
+			}
+			context.SignatureMaxLength += uint32(hex.EncodedLen(len(der)))
+		}
+
+		// Add size of the encapsulated SHA-1 digest and its headers.
+		if context.SignData.SubFilter == SubFilterAdbePKCS7SHA1 {
+			context.SignatureMaxLength += uint32(hex.EncodedLen(sha1.Size + 4))
+		}
+
 		// Add size for my certificate.
 		degenerated, err := pkcs7.DegenerateCertificate(context.SignData.Certificate.Raw)
 		if err != nil {
@@ -139,8 +287,13 @@ func (context *SignContext) SignPDF() error {
 
 		context.SignatureMaxLength += uint32(hex.EncodedLen(len(degenerated)))
 
-		// Add size of the raw issuer which is added by AddSignerChain
+		// Add size of the raw issuer which is added by AddSignerChain, and
+		// of the issuer and serial number of the signing certificate
+		// attribute.
 		context.SignatureMaxLength += uint32(hex.EncodedLen(len(context.SignData.Certificate.RawIssuer)))
+		context.SignatureMaxLength += uint32(hex.EncodedLen(len(context.SignData.Certificate.RawIssuer) + len(context.SignData.Certificate.SerialNumber.Bytes()) + 16))
+
+		context.completeCertificateChain()
 
 		// Add size for certificate chain.
 		var certificate_chain []*x509.Certificate
@@ -164,15 +317,16 @@ func (context *SignContext) SignPDF() error {
 		if err := context.fetchRevocationData(); err != nil {
 			return fmt.Errorf("failed to fetch revocation data: %w", err)
 		}
+		if err := context.fetchCRLs(); err != nil {
+			return fmt.Errorf("failed to fetch CRLs: %w", err)
+		}
 	}
 
 	// Add estimated size for TSA.
-	// We can't kow actual size of TSA until after signing.
-	//
-	// Different TSA servers provide different response sizes, we
-	// might need to make this configurable or detect and store.
+	// We can't know the actual size of the token until after signing, the
+	// size of earlier responses of the TSA is used if there are any.
 	if context.SignData.TSA.URL != "" {
-		context.SignatureMaxLength += uint32(hex.EncodedLen(9000))
+		context.SignatureMaxLength += context.timestampPlaceholderSize()
 	}
 
 	// Create the signature object
@@ -206,26 +360,55 @@ func (context *SignContext) SignPDF() error {
 		}
 	}
 
-	// Example usage: passing page number and default rect values
-	visual_signature, err := context.createVisualSignature(visible, context.SignData.Appearance.Page, rectangle)
-	if err != nil {
-		return fmt.Errorf("failed to create visual signature: %w", err)
-	}
-
-	// Write the new visual signature object.
-	context.VisualSignData.objectId, err = context.addObject(visual_signature)
-	if err != nil {
-		return fmt.Errorf("failed to add visual signature object: %w", err)
+	pages := []uint32{context.SignData.Appearance.Page}
+	if visible {
+		pages, err = context.appearancePages()
+		if err != nil {
+			return fmt.Errorf("failed to determine signature pages: %w", err)
+		}
 	}
 
-	if context.SignData.Appearance.Visible {
-		inc_page_update, err := context.createIncPageUpdate(context.SignData.Appearance.Page, context.VisualSignData.objectId)
+	if context.SignData.FieldName != "" {
+		// The widgets of the existing field keep their rectangle and page.
+		if len(context.SignData.Appearance.Pages) > 0 || context.SignData.Appearance.AllPages {
+			return fmt.Errorf("an existing signature field can not be placed on other pages")
+		}
+		if err := context.fillSignatureField(context.SignData.FieldName, visible); err != nil {
+			return fmt.Errorf("failed to fill signature field: %w", err)
+		}
+	} else if len(pages) > 1 {
+		// A single signature field with a linked widget on each page.
+		if err := context.addMultiPageVisualSignature(pages, rectangle); err != nil {
+			return fmt.Errorf("failed to create visual signature: %w", err)
+		}
+	} else {
+		// Example usage: passing page number and default rect values
+		visual_signature, err := context.createVisualSignature(visible, pages[0], rectangle)
 		if err != nil {
-			return fmt.Errorf("failed to create incremental page update: %w", err)
+			return fmt.Errorf("failed to create visual signature: %w", err)
 		}
-		err = context.updateObject(context.VisualSignData.pageObjectId, inc_page_update)
+
+		// Write the new visual signature object.
+		context.VisualSignData.objectId, err = context.addObject(visual_signature)
 		if err != nil {
-			return fmt.Errorf("failed to add incremental page update object: %w", err)
+			return fmt.Errorf("failed to add visual signature object: %w", err)
+		}
+
+		if visible {
+			inc_page_update, err := context.createIncPageUpdate(pages[0], context.VisualSignData.objectId)
+			if err != nil {
+				return fmt.Errorf("failed to create incremental page update: %w", err)
+			}
+			err = context.updateObject(context.VisualSignData.pageObjectId, inc_page_update)
+			if err != nil {
+				return fmt.Errorf("failed to add incremental page update object: %w", err)
+			}
+		}
+	}
+
+	if context.SignData.UpdateMetadata {
+		if err := context.updateMetadata(); err != nil {
+			return fmt.Errorf("failed to update metadata: %w", err)
 		}
 	}
 
@@ -256,20 +439,5 @@ func (context *SignContext) SignPDF() error {
 		return fmt.Errorf("failed to update byte range: %w", err)
 	}
 
-	// Replace signature
-	if err := context.replaceSignature(); err != nil {
-		return fmt.Errorf("failed to replace signature: %w", err)
-	}
-
-	// Write final output
-	if _, err := context.OutputBuffer.Seek(0, 0); err != nil {
-		return err
-	}
-	file_content := context.OutputBuffer.Buff.Bytes()
-
-	if _, err := context.OutputFile.Write(file_content); err != nil {
-		return err
-	}
-
 	return nil
 }
@@ -1,14 +1,18 @@
 package sign
 
 import (
+	"bytes"
+	"context"
 	"crypto"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -641,6 +645,21 @@ func TestSignPDFWithTwoImages(t *testing.T) {
 	}
 
 	verifySignedFile(t, secondSignature, filepath.Base(tbsFile))
+
+	// The second signature and its appearance are allowed changes after the
+	// first signature.
+	info, err := verify.VerifyFile(secondSignature)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	for _, signer := range info.Signers {
+		if signer.DisallowedModifications {
+			t.Errorf("expected only allowed modifications after %s, got %+v (%s)", signer.Name, signer.Modifications, signer.ModificationError)
+		}
+		if !signer.ByteRangeValid {
+			t.Errorf("expected the byte range of %s to cover its revision: %v", signer.Name, signer.ByteRangeErrors)
+		}
+	}
 }
 
 // TestSignPDFWithWatermarkImageJPG tests signing a PDF with a JPG image and text above
@@ -819,3 +838,332 @@ func TestVisualSignLastPage(t *testing.T) {
 
 	verifySignedFile(t, tmpfile, originalFileName)
 }
+
+func TestSignTimestampOnlyFile(t *testing.T) {
+	tsa := newTestTSA(t)
+
+	tmpfile, err := os.CreateTemp("", t.Name())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer func() {
+		if err := os.Remove(tmpfile.Name()); err != nil {
+			t.Errorf("Failed to remove tmpfile: %v", err)
+		}
+	}()
+
+	err = SignTimestampOnlyFile("../testfiles/testfile20.pdf", tmpfile.Name(), TSA{URL: tsa.URL})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	content, err := os.ReadFile(tmpfile.Name())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if !strings.Contains(string(content), "/SubFilter /ETSI.RFC3161") {
+		t.Errorf("expected ETSI.RFC3161 SubFilter")
+	}
+
+	verifySignedFile(t, tmpfile, "testfile20.pdf")
+
+	err = SignTimestampOnlyFile("../testfiles/testfile20.pdf", tmpfile.Name(), TSA{})
+	if err == nil {
+		t.Errorf("expected an error without TSA URL")
+	}
+}
+
+func TestSignPDFCertificationPermissions(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	tests := []struct {
+		name    string
+		perm    DocMDPPerm
+		wantErr bool
+	}{
+		{name: "no changes", perm: DoNotAllowAnyChangesPerms},
+		{name: "form filling", perm: AllowFillingExistingFormFieldsAndSignaturesPerms},
+		{name: "annotations", perm: AllowFillingExistingFormFieldsAndSignaturesAndCRUDAnnotationsPerms},
+		{name: "invalid", perm: DocMDPPerm(4), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output bytes.Buffer
+
+			input, err := os.ReadFile("../testfiles/testfile20.pdf")
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			rdr, err := pdf.NewReader(bytes.NewReader(input), int64(len(input)))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			err = Sign(bytes.NewReader(input), &output, rdr, int64(len(input)), SignData{
+				Signature: SignDataSignature{
+					CertType:   CertificationSignature,
+					DocMDPPerm: tt.perm,
+				},
+				Signer:      pkey,
+				Certificate: cert,
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Sign() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			signed, err := pdf.NewReader(bytes.NewReader(output.Bytes()), int64(output.Len()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			docMDP := signed.Trailer().Key("Root").Key("Perms").Key("DocMDP")
+			if docMDP.Key("Type").Name() != "Sig" {
+				t.Fatalf("expected /Perms /DocMDP to reference the signature dictionary")
+			}
+
+			params := docMDP.Key("Reference").Index(0).Key("TransformParams")
+			if params.Key("P").Int64() != int64(tt.perm) {
+				t.Errorf("expected permission level %d, got %d", tt.perm, params.Key("P").Int64())
+			}
+
+			// An approval signature is only a violation of level 1.
+			var approved bytes.Buffer
+			err = Sign(bytes.NewReader(output.Bytes()), &approved, signed, int64(output.Len()), SignData{
+				Signature: SignDataSignature{
+					CertType: ApprovalSignature,
+				},
+				Signer:      pkey,
+				Certificate: cert,
+			})
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			info, err := verify.Verify(bytes.NewReader(approved.Bytes()), int64(approved.Len()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if len(info.Signers) != 2 || info.Signers[0].CertificationLevel != int(tt.perm) {
+				t.Fatalf("expected a certification signature at level %d", tt.perm)
+			}
+			violations := info.Signers[0].DocMDPViolations
+			if (len(violations) != 0) != (tt.perm == DoNotAllowAnyChangesPerms) {
+				t.Errorf("unexpected DocMDP violations %q", violations)
+			}
+		})
+	}
+}
+
+// TestSignPDFIncrementalSignatures adds several signatures to the same document
+// and checks that every revision keeps the bytes of the previous one, and that
+// all earlier signatures remain valid.
+func TestSignPDFIncrementalSignatures(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	for _, file := range []string{"testfile12.pdf", "testfile16.pdf", "testfile17.pdf", "testfile20.pdf", "testfile30.pdf"} {
+		t.Run(file, func(t *testing.T) {
+			document, err := os.ReadFile("../testfiles/" + file)
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			initial, err := verify.Verify(bytes.NewReader(document), int64(len(document)))
+			existing := 0
+			if err == nil {
+				existing = len(initial.Signers)
+			}
+
+			for i := 1; i <= 3; i++ {
+				rdr, err := pdf.NewReader(bytes.NewReader(document), int64(len(document)))
+				if err != nil {
+					t.Fatalf("%s", err.Error())
+				}
+
+				var output bytes.Buffer
+				err = Sign(bytes.NewReader(document), &output, rdr, int64(len(document)), SignData{
+					Signature: SignDataSignature{
+						Info: SignDataSignatureInfo{
+							Name:   fmt.Sprintf("Signer %d", i),
+							Reason: fmt.Sprintf("Approval Signature %d", i),
+							Date:   time.Now().Local(),
+						},
+						CertType: ApprovalSignature,
+					},
+					Signer:      pkey,
+					Certificate: cert,
+				})
+				if err != nil {
+					t.Fatalf("signature %d: %s", i, err.Error())
+				}
+
+				if !bytes.HasPrefix(output.Bytes(), document) {
+					t.Fatalf("signature %d modified the bytes of the previous revision", i)
+				}
+				document = output.Bytes()
+
+				// The new signature must cover the complete revision.
+				signed, err := pdf.NewReader(bytes.NewReader(document), int64(len(document)))
+				if err != nil {
+					t.Fatalf("%s", err.Error())
+				}
+				fields := signed.Trailer().Key("Root").Key("AcroForm").Key("Fields")
+				byteRange := fields.Index(fields.Len() - 1).Key("V").Key("ByteRange")
+				if end := byteRange.Index(2).Int64() + byteRange.Index(3).Int64(); end != int64(len(document)) {
+					t.Errorf("signature %d covers %d bytes, revision has %d", i, end, len(document))
+				}
+
+				info, err := verify.Verify(bytes.NewReader(document), int64(len(document)))
+				if err != nil {
+					t.Fatalf("signature %d: %s", i, err.Error())
+				}
+				if len(info.Signers) != existing+i {
+					t.Fatalf("expected %d signers, got %d", existing+i, len(info.Signers))
+				}
+				for j, signer := range info.Signers[existing:] {
+					if !signer.ValidSignature {
+						t.Errorf("after signature %d, signature %d is no longer valid", i, j+1)
+					}
+				}
+			}
+		})
+	}
+}
+
+// objectStreamDocument returns a document with a cross-reference stream in
+// which the catalog, the page tree, the AcroForm and the empty signature
+// field Signature1 are stored in an object stream.
+func objectStreamDocument() []byte {
+	objects := map[int]string{
+		1: "<< /Type /Catalog /Pages 2 0 R /AcroForm 5 0 R >>",
+		2: "<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		3: "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R /Annots [6 0 R] /Resources << >> >>",
+		5: "<< /Fields [6 0 R] >>",
+		6: "<< /FT /Sig /T (Signature1) /Type /Annot /Subtype /Widget /Rect [0 0 0 0] /P 3 0 R /F 132 >>",
+	}
+	var header, body bytes.Buffer
+	index := make(map[int]int)
+	for i, id := range []int{1, 2, 3, 5, 6} {
+		_, _ = fmt.Fprintf(&header, "%d %d ", id, body.Len())
+		body.WriteString(objects[id] + "\n")
+		index[id] = i
+	}
+
+	document := bytes.NewBufferString("%PDF-1.7\n")
+	offsets := make(map[int]int)
+	offsets[4] = document.Len()
+	document.WriteString("4 0 obj\n<< /Length 0 >>\nstream\n\nendstream\nendobj\n")
+	offsets[7] = document.Len()
+	_, _ = fmt.Fprintf(document, "7 0 obj\n<< /Type /ObjStm /N 5 /First %d /Length %d >>\nstream\n%s%s\nendstream\nendobj\n",
+		header.Len(), header.Len()+body.Len(), header.Bytes(), body.Bytes())
+
+	offsets[8] = document.Len()
+	var entries bytes.Buffer
+	entries.Write([]byte{0, 0, 0, 0, 0, 255})
+	for id := 1; id < 9; id++ {
+		if n, ok := index[id]; ok {
+			entries.Write([]byte{2, 0, 0, 0, 7, byte(n)})
+			continue
+		}
+		entries.Write([]byte{1, 0, 0, byte(offsets[id] >> 8), byte(offsets[id]), 0})
+	}
+	_, _ = fmt.Fprintf(document, "8 0 obj\n<< /Type /XRef /Size 9 /W [1 4 1] /Root 1 0 R /Length %d >>\nstream\n%s\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n",
+		entries.Len(), entries.Bytes(), offsets[8])
+	return document.Bytes()
+}
+
+// TestSignPDFObjectStreams signs a document whose catalog, pages and form
+// fields are stored in an object stream: the existing field, an empty field
+// added by PrepareFields, a new invisible and a new visible field.
+func TestSignPDFObjectStreams(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	var prepared bytes.Buffer
+	err := PrepareFields(bytes.NewReader(objectStreamDocument()), &prepared, []SignatureField{
+		{Name: "Prepared", Page: 1, LowerLeftX: 50, LowerLeftY: 50, UpperRightX: 150, UpperRightY: 100},
+	})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	document := prepared.Bytes()
+
+	for i, field := range []string{"Signature1", "Prepared", "", ""} {
+		rdr, err := pdf.NewReader(bytes.NewReader(document), int64(len(document)))
+		if err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+
+		var output bytes.Buffer
+		err = Sign(bytes.NewReader(document), &output, rdr, int64(len(document)), SignData{
+			Signature: SignDataSignature{
+				Info: SignDataSignatureInfo{
+					Name: fmt.Sprintf("Signer %d", i+1),
+					Date: time.Now().Local(),
+				},
+				CertType: ApprovalSignature,
+			},
+			Appearance: Appearance{
+				Visible:     i == 3,
+				Page:        1,
+				LowerLeftX:  200,
+				LowerLeftY:  50,
+				UpperRightX: 300,
+				UpperRightY: 100,
+			},
+			FieldName:   field,
+			Signer:      pkey,
+			Certificate: cert,
+		})
+		if err != nil {
+			t.Fatalf("signature %d: %s", i+1, err.Error())
+		}
+		document = output.Bytes()
+
+		info, err := verify.Verify(bytes.NewReader(document), int64(len(document)))
+		if err != nil {
+			t.Fatalf("signature %d: %s", i+1, err.Error())
+		}
+		if len(info.Signers) != i+1 {
+			t.Fatalf("expected %d signers, got %d", i+1, len(info.Signers))
+		}
+		for j, signer := range info.Signers {
+			if !signer.ValidSignature || !signer.ByteRangeValid {
+				t.Errorf("after signature %d, signature %d is not valid: %v", i+1, j+1, signer.ByteRangeErrors)
+			}
+		}
+	}
+}
+
+func TestSignCanceled(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+
+	input, err := os.ReadFile("../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var output bytes.Buffer
+	err = Sign(bytes.NewReader(input), &output, nil, int64(len(input)), SignData{
+		Signature: SignDataSignature{
+			Info: SignDataSignatureInfo{
+				Name: "John Doe",
+				Date: time.Now().Local(),
+			},
+			CertType: ApprovalSignature,
+		},
+		Signer:      pkey,
+		Certificate: cert,
+		Context:     ctx,
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the signature to be canceled, got %v", err)
+	}
+	if output.Len() != 0 {
+		t.Errorf("expected no output, got %d bytes", output.Len())
+	}
+}
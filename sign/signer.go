@@ -0,0 +1,69 @@
+package sign
+
+import (
+	"crypto"
+	"crypto/x509"
+	"fmt"
+)
+
+// CertificateSigner is a signing backend that holds the certificate of its
+// key, such as an HSM, a smartcard or a remote signing service. Any
+// crypto.Signer can be used as SignData.Signer; a CertificateSigner also
+// provides the signing certificate and chain when SignData leaves them empty.
+type CertificateSigner interface {
+	crypto.Signer
+
+	// CertificateChain returns the signing certificate followed by its
+	// issuers, up to the root if available.
+	CertificateChain() ([]*x509.Certificate, error)
+}
+
+// AlgorithmSigner is a signing backend whose key can only be used with one
+// digest and signature algorithm, such as Cloud KMS keys. They are used when
+// SignData.DigestAlgorithm and SignData.SignatureAlgorithm are not set.
+type AlgorithmSigner interface {
+	crypto.Signer
+
+	// SignatureAlgorithm returns the digest and signature algorithm of the
+	// key.
+	SignatureAlgorithm() (crypto.Hash, SignatureAlgorithm)
+}
+
+// resolveSigner takes the certificate and chain from a CertificateSigner, and
+// the signature algorithm from an AlgorithmSigner, if they are not set. It
+// checks that the signer belongs to the certificate.
+func (context *SignContext) resolveSigner() error {
+	if context.SignData.Signature.CertType == TimeStampSignature || context.SignData.Signer == nil {
+		return nil
+	}
+
+	if signer, ok := context.SignData.Signer.(AlgorithmSigner); ok && context.SignData.SignatureAlgorithm == 0 {
+		_, context.SignData.SignatureAlgorithm = signer.SignatureAlgorithm()
+	}
+
+	if signer, ok := context.SignData.Signer.(CertificateSigner); ok && context.SignData.Certificate == nil {
+		chain, err := signer.CertificateChain()
+		if err != nil {
+			return fmt.Errorf("failed to get certificate chain from signer: %w", err)
+		}
+		if len(chain) == 0 {
+			return fmt.Errorf("signer returned no certificate")
+		}
+		context.SignData.Certificate = chain[0]
+		if len(context.SignData.CertificateChains) == 0 {
+			context.SignData.CertificateChains = [][]*x509.Certificate{chain}
+		}
+	}
+
+	if context.SignData.Certificate == nil {
+		return nil
+	}
+
+	// All public keys of the standard library implement Equal.
+	public, ok := context.SignData.Signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if ok && !public.Equal(context.SignData.Certificate.PublicKey) {
+		return fmt.Errorf("signer public key does not match the certificate")
+	}
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package sign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/verify"
+)
+
+// backendSigner hides the private key behind crypto.Signer, the way an HSM
+// or remote signing service does.
+type backendSigner struct {
+	key   crypto.Signer
+	chain []*x509.Certificate
+}
+
+func (s *backendSigner) Public() crypto.PublicKey {
+	return s.key.Public()
+}
+
+func (s *backendSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return s.key.Sign(rand, digest, opts)
+}
+
+func (s *backendSigner) CertificateChain() ([]*x509.Certificate, error) {
+	return s.chain, nil
+}
+
+func TestSignPDFCertificateSigner(t *testing.T) {
+	input, err := os.ReadFile("../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	cert, pkey := loadCertificateAndKey(t)
+	signer := &backendSigner{key: pkey, chain: []*x509.Certificate{cert}}
+
+	rdr, err := pdf.NewReader(bytes.NewReader(input), int64(len(input)))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	var output bytes.Buffer
+	err = Sign(bytes.NewReader(input), &output, rdr, int64(len(input)), SignData{
+		Signature: SignDataSignature{
+			Info: SignDataSignatureInfo{
+				Name: "John Doe",
+				Date: time.Now().Local(),
+			},
+			CertType: ApprovalSignature,
+		},
+		Signer:          signer,
+		DigestAlgorithm: crypto.SHA256,
+	})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	info, err := verify.Verify(bytes.NewReader(output.Bytes()), int64(output.Len()))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if len(info.Signers) != 1 || !info.Signers[0].ValidSignature {
+		t.Errorf("expected a single valid signature")
+	}
+}
+
+func TestResolveSigner(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	tests := []struct {
+		name        string
+		signer      crypto.Signer
+		certificate *x509.Certificate
+		wantErr     bool
+	}{
+		{name: "key", signer: pkey, certificate: cert},
+		{name: "certificate signer", signer: &backendSigner{key: pkey, chain: []*x509.Certificate{cert}}},
+		{name: "certificate signer without chain", signer: &backendSigner{key: pkey}, wantErr: true},
+		{name: "key mismatch", signer: otherKey, certificate: cert, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			context := SignContext{SignData: SignData{
+				Signer:      tt.signer,
+				Certificate: tt.certificate,
+			}}
+			err := context.resolveSigner()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveSigner() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && context.SignData.Certificate != cert {
+				t.Errorf("expected the signing certificate to be set")
+			}
+		})
+	}
+}
+
+// algorithmSigner is a backend that only signs with RSASSA-PSS and SHA-384.
+type algorithmSigner struct {
+	backendSigner
+}
+
+func (s *algorithmSigner) SignatureAlgorithm() (crypto.Hash, SignatureAlgorithm) {
+	return crypto.SHA384, RSAPSS
+}
+
+func TestSignPDFAlgorithmSigner(t *testing.T) {
+	input, err := os.ReadFile("../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	cert, pkey := loadCertificateAndKey(t)
+	signer := &algorithmSigner{backendSigner{key: pkey, chain: []*x509.Certificate{cert}}}
+
+	context := SignContext{SignData: SignData{Signer: signer}}
+	if hash := context.defaultDigestAlgorithm(); hash != crypto.SHA384 {
+		t.Errorf("expected the digest algorithm of the signer, got %s", hash)
+	}
+	if err := context.resolveSigner(); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if context.SignData.SignatureAlgorithm != RSAPSS {
+		t.Errorf("expected the signature algorithm of the signer, got %s", context.SignData.SignatureAlgorithm)
+	}
+
+	rdr, err := pdf.NewReader(bytes.NewReader(input), int64(len(input)))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	var output bytes.Buffer
+	err = Sign(bytes.NewReader(input), &output, rdr, int64(len(input)), SignData{
+		Signature: SignDataSignature{
+			Info: SignDataSignatureInfo{
+				Name: "John Doe",
+				Date: time.Now().Local(),
+			},
+			CertType: ApprovalSignature,
+		},
+		Signer: signer,
+	})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	info, err := verify.Verify(bytes.NewReader(output.Bytes()), int64(output.Len()))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if len(info.Signers) != 1 || !info.Signers[0].ValidSignature {
+		t.Errorf("expected a single valid signature")
+	}
+}
@@ -0,0 +1,127 @@
+package sign
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"fmt"
+	"io"
+
+	"github.com/mattetti/filebuffer"
+)
+
+// SignStream signs the document in input of size bytes and writes it to
+// output, see Sign. The document is read in chunks as it is needed and not
+// held in memory, so large documents can be signed with little memory.
+//
+// Encrypted documents are decrypted in memory, as are documents that are
+// signed with PAdES baseline-LT and above or CAdES signatures with revocation
+// data, which add the validation material after the signature.
+func SignStream(input io.ReaderAt, output io.Writer, size int64, sign_data SignData) error {
+	return Sign(io.NewSectionReader(input, 0, size), output, nil, size, sign_data)
+}
+
+// readerAt returns input as io.ReaderAt, input is seeked for every read when
+// it does not implement io.ReaderAt.
+func readerAt(input io.ReadSeeker) io.ReaderAt {
+	if r, ok := input.(io.ReaderAt); ok {
+		return r
+	}
+	return readSeekerAt{input}
+}
+
+type readSeekerAt struct {
+	io.ReadSeeker
+}
+
+func (r readSeekerAt) ReadAt(p []byte, off int64) (int, error) {
+	if _, err := r.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(r.ReadSeeker, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// outputLength returns the length of the output, the input followed by the
+// incremental update in OutputBuffer, if any.
+func (context *SignContext) outputLength() int64 {
+	if context.OutputBuffer == nil {
+		return context.inputLength
+	}
+	return context.inputLength + int64(context.OutputBuffer.Buff.Len())
+}
+
+// outputSection returns a reader of n bytes of the output at offset off, the
+// part of the input is read from InputFile.
+func (context *SignContext) outputSection(off, n int64) io.Reader {
+	var readers []io.Reader
+	if off < context.inputLength {
+		length := min(n, context.inputLength-off)
+		readers = append(readers, io.NewSectionReader(readerAt(context.InputFile), off, length))
+		off += length
+		n -= length
+	}
+	if n > 0 {
+		update := context.OutputBuffer.Buff.Bytes()
+		readers = append(readers, bytes.NewReader(update[off-context.inputLength:off-context.inputLength+n]))
+	}
+	return io.MultiReader(readers...)
+}
+
+// byteRangeReader returns a reader of the parts of the output that the
+// ByteRange covers.
+func (context *SignContext) byteRangeReader() io.Reader {
+	var readers []io.Reader
+	for i := 0; i+1 < len(context.ByteRangeValues); i += 2 {
+		readers = append(readers, context.outputSection(context.ByteRangeValues[i], context.ByteRangeValues[i+1]))
+	}
+	return io.MultiReader(readers...)
+}
+
+// byteRangeDigest returns the digest with hash of the parts of the output
+// that the ByteRange covers, they are hashed in chunks until the context of
+// the signature is done.
+func (context *SignContext) byteRangeDigest(hash crypto.Hash) ([]byte, error) {
+	if !hash.Available() {
+		return nil, fmt.Errorf("digest algorithm %s is not available", hash)
+	}
+	h := hash.New()
+	r := contextReader{ctx: signingContext(&context.SignData), r: context.byteRangeReader()}
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, fmt.Errorf("failed to read byte range: %w", err)
+	}
+	return h.Sum(nil), nil
+}
+
+// contextReader reads from r until ctx is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// bufferOutput reads the input into OutputBuffer in front of the incremental
+// update, for the steps that rewrite the complete output.
+func (context *SignContext) bufferOutput() error {
+	if context.inputLength == 0 {
+		return nil
+	}
+	document := make([]byte, context.inputLength, context.outputLength())
+	if _, err := io.ReadFull(context.outputSection(0, context.inputLength), document); err != nil {
+		return fmt.Errorf("failed to read document: %w", err)
+	}
+	document = append(document, context.OutputBuffer.Buff.Bytes()...)
+
+	context.OutputBuffer = filebuffer.New(document)
+	context.inputLength = 0
+	return nil
+}
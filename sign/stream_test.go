@@ -0,0 +1,262 @@
+package sign
+
+import (
+	"bytes"
+	"crypto"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdfsign/verify"
+)
+
+// recordingReaderAt records the largest read from a document.
+type recordingReaderAt struct {
+	io.ReaderAt
+	largest int
+}
+
+func (r *recordingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	r.largest = max(r.largest, len(p))
+	return r.ReaderAt.ReadAt(p, off)
+}
+
+func TestSignStream(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+	tsa := newTestTSA(t)
+
+	input, err := os.ReadFile("../testfiles/testfile16.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	tests := []struct {
+		name      string
+		certType  CertType
+		subFilter SubFilter
+		digest    crypto.Hash
+	}{
+		{name: "adbe.pkcs7.detached", certType: ApprovalSignature, digest: crypto.SHA256},
+		{name: "ETSI.CAdES.detached", certType: ApprovalSignature, subFilter: SubFilterETSICAdESDetached, digest: crypto.SHA512},
+		{name: "adbe.pkcs7.sha1", certType: ApprovalSignature, subFilter: SubFilterAdbePKCS7SHA1, digest: crypto.SHA1},
+		{name: "adbe.x509.rsa_sha1", certType: ApprovalSignature, subFilter: SubFilterAdbeX509RSASHA1, digest: crypto.SHA1},
+		{name: "ETSI.RFC3161", certType: TimeStampSignature, digest: crypto.SHA256},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sign_data := SignData{
+				Signature: SignDataSignature{
+					Info: SignDataSignatureInfo{
+						Name: "John Doe",
+						Date: time.Now().Local(),
+					},
+					CertType: tt.certType,
+				},
+				SubFilter:       tt.subFilter,
+				DigestAlgorithm: tt.digest,
+				TSA:             TSA{URL: tsa.URL},
+			}
+			if tt.certType != TimeStampSignature {
+				sign_data.Signer = pkey
+				sign_data.Certificate = cert
+			}
+			// The test TSA does not sign SHA-1 requests.
+			if tt.digest == crypto.SHA1 {
+				sign_data.TSA = TSA{}
+			}
+
+			reader := &recordingReaderAt{ReaderAt: bytes.NewReader(input)}
+			var output bytes.Buffer
+			if err := SignStream(reader, &output, int64(len(input)), sign_data); err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			// The document is read in chunks, not as a whole.
+			if reader.largest >= len(input)/2 {
+				t.Errorf("expected the document to be read in chunks, read %d of %d bytes at once", reader.largest, len(input))
+			}
+			if !bytes.HasPrefix(output.Bytes(), input) {
+				t.Fatalf("expected the signed document to start with the input")
+			}
+
+			result, err := verify.Verify(bytes.NewReader(output.Bytes()), int64(output.Len()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if len(result.Signers) != 1 {
+				t.Fatalf("expected a single signature, got %d", len(result.Signers))
+			}
+			if !result.Signers[0].ValidSignature {
+				t.Errorf("expected a valid signature")
+			}
+		})
+	}
+}
+
+func TestReadSeekerAt(t *testing.T) {
+	data := []byte("0123456789")
+	r := readerAt(io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data))))
+	if _, ok := r.(readSeekerAt); ok {
+		t.Fatalf("expected the io.ReaderAt of the input to be used")
+	}
+
+	// Hide the io.ReaderAt of the input.
+	r = readerAt(struct{ io.ReadSeeker }{bytes.NewReader(data)})
+	p := make([]byte, 4)
+	if n, err := r.ReadAt(p, 3); n != 4 || err != nil || string(p) != "3456" {
+		t.Errorf("expected 3456, got %q (%v)", p[:n], err)
+	}
+	if n, err := r.ReadAt(p, 8); n != 2 || err != io.EOF || string(p[:n]) != "89" {
+		t.Errorf("expected 89 and io.EOF, got %q (%v)", p[:n], err)
+	}
+}
+
+// sparseDocument is a document of head, padding bytes of spaces and tail,
+// for documents larger than the memory of the tests.
+type sparseDocument struct {
+	head    []byte
+	padding int64
+	tail    []byte
+}
+
+var spaces = bytes.Repeat([]byte(" "), 1<<16)
+
+func (d *sparseDocument) size() int64 {
+	return int64(len(d.head)) + d.padding + int64(len(d.tail))
+}
+
+func (d *sparseDocument) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) && off+int64(n) < d.size() {
+		at := off + int64(n)
+		switch {
+		case at < int64(len(d.head)):
+			n += copy(p[n:], d.head[at:])
+		case at < int64(len(d.head))+d.padding:
+			end := min(int64(len(p)-n), int64(len(d.head))+d.padding-at, int64(len(spaces)))
+			n += copy(p[n:n+int(end)], spaces)
+		default:
+			n += copy(p[n:], d.tail[at-int64(len(d.head))-d.padding:])
+		}
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// largeDocument returns a document whose objects follow padding bytes after
+// the header, with a cross-reference table, or stream with xrefStream.
+func largeDocument(padding int64, xrefStream bool) *sparseDocument {
+	d := &sparseDocument{head: []byte("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n"), padding: padding}
+	base := int64(len(d.head)) + padding
+	var tail bytes.Buffer
+	offsets := make([]int64, 6)
+	for id, object := range []string{
+		1: "<< /Type /Catalog /Pages 2 0 R >>",
+		2: "<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		3: "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >>",
+		4: "<< /Producer (archive) >>",
+	} {
+		if object != "" {
+			offsets[id] = base + int64(tail.Len())
+			_, _ = fmt.Fprintf(&tail, "%d 0 obj\n%s\nendobj\n", id, object)
+		}
+	}
+	if xrefStream {
+		offsets[5] = base + int64(tail.Len())
+		var entries bytes.Buffer
+		writeXrefStreamLine(&entries, 0, 0, 8, 0)
+		for _, offset := range offsets[1:] {
+			writeXrefStreamLine(&entries, 1, offset, 8, 0)
+		}
+		_, _ = fmt.Fprintf(&tail, "5 0 obj\n<< /Type /XRef /Size 6 /W [1 8 1] /Root 1 0 R /Info 4 0 R /Length %d >>\nstream\n%s\nendstream\nendobj\n", entries.Len(), entries.Bytes())
+		_, _ = fmt.Fprintf(&tail, "startxref\n%d\n%%%%EOF\n", offsets[5])
+	} else {
+		table := base + int64(tail.Len())
+		tail.WriteString("xref\n0 5\n0000000000 65535 f \n")
+		for _, offset := range offsets[1:5] {
+			_, _ = fmt.Fprintf(&tail, "%010d 00000 n \n", offset)
+		}
+		_, _ = fmt.Fprintf(&tail, "trailer\n<< /Size 5 /Root 1 0 R /Info 4 0 R >>\nstartxref\n%d\n%%%%EOF\n", table)
+	}
+	d.tail = tail.Bytes()
+	return d
+}
+
+// tailWriter keeps the bytes written after the first skip bytes.
+type tailWriter struct {
+	skip    int64
+	written int64
+	tail    bytes.Buffer
+}
+
+func (w *tailWriter) Write(p []byte) (int, error) {
+	if start := w.skip - w.written; start < int64(len(p)) {
+		w.tail.Write(p[max(start, 0):])
+	}
+	w.written += int64(len(p))
+	return len(p), nil
+}
+
+func TestSignLargeDocument(t *testing.T) {
+	if testing.Short() {
+		t.Skip("hashes documents of several GB")
+	}
+	cert, pkey := loadCertificateAndKey(t)
+
+	for _, tt := range []struct {
+		name       string
+		padding    int64
+		xrefStream bool
+	}{
+		{"table beyond 2 GB", 1 << 31, false},
+		{"stream beyond 4 GB", 1 << 32, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			input := largeDocument(tt.padding, tt.xrefStream)
+			size := input.size()
+
+			output := &tailWriter{skip: int64(len(input.head)) + input.padding}
+			err := Sign(io.NewSectionReader(input, 0, size), output, nil, size, SignData{
+				Signature: SignDataSignature{
+					Info: SignDataSignatureInfo{
+						Name: "Archive",
+						Date: time.Now().Local(),
+					},
+					CertType: ApprovalSignature,
+				},
+				Signer:      pkey,
+				Certificate: cert,
+			})
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			signed := &sparseDocument{head: input.head, padding: input.padding, tail: output.tail.Bytes()}
+			if !bytes.HasPrefix(signed.tail, input.tail) {
+				t.Fatalf("expected the document to be kept")
+			}
+
+			info, err := verify.Verify(signed, signed.size())
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if len(info.Signers) != 1 {
+				t.Fatalf("expected 1 signer, got %d", len(info.Signers))
+			}
+			signer := info.Signers[0]
+			if !signer.ValidSignature || signer.DisallowedModifications || len(signer.ByteRangeErrors) > 0 {
+				t.Errorf("expected a valid signature, got %v %v", signer.ByteRangeErrors, signer.Modifications)
+			}
+			if len(signer.ByteRange) != 4 || signer.ByteRange[1] <= size || signer.ByteRange[2]+signer.ByteRange[3] != signed.size() {
+				t.Errorf("expected a byte range to the end of the %d bytes, got %v", signed.size(), signer.ByteRange)
+			}
+			if info.DocumentInfo.Producer != "archive" {
+				t.Errorf("expected the document information, got %q", info.DocumentInfo.Producer)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package sign
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/digitorus/timestamp"
+)
+
+const defaultRetryBackoff = time.Second
+
+// statusError is a non success HTTP response of a TSA.
+type statusError struct {
+	code int
+	body string
+}
+
+func (e *statusError) Error() string {
+	if e.body == "" {
+		return "non success response (" + strconv.Itoa(e.code) + ")"
+	}
+	return "non success response (" + strconv.Itoa(e.code) + "): " + e.body
+}
+
+// rejectedError is a time-stamp response that does not grant the request.
+type rejectedError struct {
+	err error
+}
+
+func (e *rejectedError) Error() string {
+	return "invalid time-stamp response: " + e.err.Error()
+}
+
+func (e *rejectedError) Unwrap() error {
+	return e.err
+}
+
+// temporary reports whether a failed request to a TSA may succeed when it is
+// retried. Timeouts, network errors, rate limits and server errors are
+// temporary, other responses and rejected requests are not.
+func temporary(err error) bool {
+	var status *statusError
+	if errors.As(err, &status) {
+		return status.code == http.StatusTooManyRequests || status.code >= 500
+	}
+	var rejected *rejectedError
+	return !errors.As(err, &rejected)
+}
+
+// request sends a time-stamp query to the TSA, retrying temporary failures
+// with an exponential backoff until ctx is done.
+func (tsa *TSA) request(ctx context.Context, query []byte) ([]byte, error) {
+	backoff := tsa.RetryBackoff
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+	}
+
+	for attempt := 0; ; attempt++ {
+		response, err := tsa.send(ctx, query)
+		if err == nil {
+			return response, nil
+		}
+		if attempt >= tsa.Retries || !temporary(err) || ctx.Err() != nil {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// send sends a time-stamp query to the TSA once.
+func (tsa *TSA) send(ctx context.Context, query []byte) ([]byte, error) {
+	req, err := tsa.newRequest(query)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if tsa.Timeout > 0 {
+		ctx, cancel := context.WithTimeout(ctx, tsa.Timeout)
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
+
+	resp, err := tsa.httpClient(ctx).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, &statusError{code: resp.StatusCode, body: string(body)}
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	// A TSA that rejects the request, for example for an unsupported policy
+	// or digest algorithm, answers with a status other than granted.
+	if _, err := timestamp.ParseResponse(body); err != nil {
+		return nil, &rejectedError{err: err}
+	}
+	return body, nil
+}
+
+// newRequest returns the HTTP request of a time-stamp query with the
+// authentication and the headers of the TSA.
+func (tsa *TSA) newRequest(query []byte) (*http.Request, error) {
+	req, err := http.NewRequest("POST", tsa.URL, bytes.NewReader(query))
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare request (%s): %w", tsa.URL, err)
+	}
+
+	req.Header.Add("Content-Type", "application/timestamp-query")
+	req.Header.Add("Content-Transfer-Encoding", "binary")
+
+	switch {
+	case tsa.Token != "":
+		req.Header.Set("Authorization", "Bearer "+tsa.Token)
+	case tsa.Username != "" && tsa.Password != "":
+		req.SetBasicAuth(tsa.Username, tsa.Password)
+	}
+
+	// Additional headers replace the default headers of the same name.
+	for name, values := range tsa.Header {
+		req.Header.Del(name)
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+
+	return req, nil
+}
+
+// httpClient returns the client of the requests to the TSA, the client of
+// ctx if the TSA has no settings of its own.
+func (tsa *TSA) httpClient(ctx context.Context) *http.Client {
+	if tsa.HTTPClient != nil {
+		return tsa.HTTPClient
+	}
+	if tsa.ClientCertificate == nil && tsa.RootCAs == nil && tsa.Proxy == nil {
+		return httpClient(ctx, nil, http.DefaultClient)
+	}
+
+	transport := tsa.transport()
+	// The client is created for a single request.
+	transport.DisableKeepAlives = true
+	return &http.Client{Transport: transport}
+}
+
+// transport returns a transport with the TLS and proxy settings of the TSA.
+func (tsa *TSA) transport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		RootCAs:    tsa.RootCAs,
+		MinVersion: tls.VersionTLS12,
+	}
+	if tsa.ClientCertificate != nil {
+		transport.TLSClientConfig.Certificates = []tls.Certificate{*tsa.ClientCertificate}
+	}
+	if tsa.Proxy != nil {
+		transport.Proxy = http.ProxyURL(tsa.Proxy)
+	}
+	return transport
+}
+
+// withSharedClient returns a copy of the TSA whose requests, and those of
+// its fallbacks, are sent by a client that keeps up to connections idle
+// connections to the TSA open.
+func (tsa TSA) withSharedClient(connections int) TSA {
+	if tsa.URL != "" && tsa.HTTPClient == nil {
+		transport := tsa.transport()
+		transport.MaxIdleConnsPerHost = connections
+		tsa.HTTPClient = &http.Client{Transport: transport}
+	}
+
+	fallbacks := make([]TSA, len(tsa.Fallbacks))
+	for i, fallback := range tsa.Fallbacks {
+		fallbacks[i] = fallback.withSharedClient(connections)
+	}
+	if len(fallbacks) > 0 {
+		tsa.Fallbacks = fallbacks
+	}
+	return tsa
+}
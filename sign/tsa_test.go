@@ -0,0 +1,337 @@
+package sign
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTSANewRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		tsa    TSA
+		header http.Header
+	}{
+		{
+			name:   "anonymous",
+			tsa:    TSA{URL: "https://tsa.example.com/"},
+			header: http.Header{"Content-Type": {"application/timestamp-query"}},
+		},
+		{
+			name:   "basic authentication",
+			tsa:    TSA{URL: "https://tsa.example.com/", Username: "user", Password: "secret"},
+			header: http.Header{"Authorization": {"Basic dXNlcjpzZWNyZXQ="}},
+		},
+		{
+			name:   "bearer token",
+			tsa:    TSA{URL: "https://tsa.example.com/", Username: "user", Password: "secret", Token: "abc"},
+			header: http.Header{"Authorization": {"Bearer abc"}},
+		},
+		{
+			name: "headers",
+			tsa: TSA{URL: "https://tsa.example.com/", Header: http.Header{
+				"X-Api-Key":    {"key"},
+				"Content-Type": {"application/timestamp-query; charset=binary"},
+			}},
+			header: http.Header{
+				"X-Api-Key":    {"key"},
+				"Content-Type": {"application/timestamp-query; charset=binary"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := tt.tsa.newRequest([]byte("query"))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			for name, values := range tt.header {
+				if got := req.Header.Values(name); len(got) != len(values) || got[0] != values[0] {
+					t.Errorf("expected %s %q, got %q", name, values, got)
+				}
+			}
+		})
+	}
+}
+
+// newMutualTLSTSA returns a TSA that requires a client certificate issued by
+// client and a bearer token.
+func newMutualTLSTSA(t *testing.T, client *x509.Certificate, token string) *httptest.Server {
+	t.Helper()
+
+	upstream, err := url.Parse(newTestTSA(t).URL)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	proxy := httputil.NewSingleHostReverseProxy(upstream)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+	clients := x509.NewCertPool()
+	clients.AddCert(client)
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clients,
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestSignPDFTSAClientCertificate(t *testing.T) {
+	cert, pkey := loadCertificateAndKey(t)
+	tsa := newMutualTLSTSA(t, cert, "token")
+
+	roots := x509.NewCertPool()
+	roots.AddCert(tsa.Certificate())
+
+	tests := []struct {
+		name    string
+		tsa     TSA
+		wantErr bool
+	}{
+		{
+			name: "client certificate",
+			tsa: TSA{
+				URL:               tsa.URL,
+				Token:             "token",
+				ClientCertificate: &tls.Certificate{Certificate: [][]byte{cert.Raw}, PrivateKey: pkey},
+				RootCAs:           roots,
+			},
+		},
+		{
+			name:    "without client certificate",
+			tsa:     TSA{URL: tsa.URL, Token: "token", RootCAs: roots},
+			wantErr: true,
+		},
+		{
+			name: "without token",
+			tsa: TSA{
+				URL:               tsa.URL,
+				ClientCertificate: &tls.Certificate{Certificate: [][]byte{cert.Raw}, PrivateKey: pkey},
+				RootCAs:           roots,
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpfile, err := os.CreateTemp("", "pdfsign-tsa")
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			defer func() {
+				_ = os.Remove(tmpfile.Name())
+			}()
+
+			err = SignFile("../testfiles/testfile20.pdf", tmpfile.Name(), SignData{
+				Signature: SignDataSignature{
+					Info: SignDataSignatureInfo{
+						Name: "John Doe",
+						Date: time.Now().Local(),
+					},
+					CertType: ApprovalSignature,
+				},
+				Signer:      pkey,
+				Certificate: cert,
+				TSA:         tt.tsa,
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SignFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				verifySignedFile(t, tmpfile, "testfile20.pdf")
+			}
+		})
+	}
+}
+
+func TestTSAProxy(t *testing.T) {
+	upstream := newTestTSA(t)
+
+	var requests atomic.Int32
+	forward := &httputil.ReverseProxy{Rewrite: func(r *httputil.ProxyRequest) {
+		r.Out.URL = r.In.URL
+	}}
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		forward.ServeHTTP(w, r)
+	}))
+	t.Cleanup(proxy.Close)
+
+	proxyURL, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	context := SignContext{SignData: SignData{TSA: TSA{URL: upstream.URL, Proxy: proxyURL}}}
+	if _, err := context.GetTSA([]byte("signature")); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if requests.Load() != 1 {
+		t.Errorf("expected the request to be sent through the proxy, got %d requests", requests.Load())
+	}
+}
+
+// newFailingTSA returns a TSA that answers every request with handler and
+// counts the requests.
+func newFailingTSA(t *testing.T, requests *atomic.Int32, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestGetTSAFailover(t *testing.T) {
+	var unavailable, unauthorized, slow, rejecting atomic.Int32
+	unavailableTSA := newFailingTSA(t, &unavailable, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "maintenance", http.StatusServiceUnavailable)
+	})
+	unauthorizedTSA := newFailingTSA(t, &unauthorized, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	})
+	done := make(chan struct{})
+	slowTSA := newFailingTSA(t, &slow, func(w http.ResponseWriter, r *http.Request) {
+		// The request context is canceled when the client disconnects
+		// after the body was read.
+		_, _ = io.Copy(io.Discard, r.Body)
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	})
+	t.Cleanup(func() { close(done) })
+	rejectingTSA := newFailingTSA(t, &rejecting, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("not a time-stamp response"))
+	})
+	tsa := newTestTSA(t)
+
+	var used []string
+	context := SignContext{SignData: SignData{TSA: TSA{
+		URL:          unavailableTSA.URL,
+		Retries:      2,
+		RetryBackoff: time.Millisecond,
+		Fallbacks: []TSA{
+			{URL: unauthorizedTSA.URL, Retries: 2},
+			{URL: slowTSA.URL, Timeout: 50 * time.Millisecond},
+			{URL: rejectingTSA.URL, Retries: 2},
+			{URL: tsa.URL},
+		},
+		OnUsed: func(url string) {
+			used = append(used, url)
+		},
+	}}}
+
+	if _, err := context.GetTSA([]byte("signature")); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if len(used) != 1 || used[0] != tsa.URL {
+		t.Errorf("expected %s to be used, got %q", tsa.URL, used)
+	}
+	for name, tt := range map[string]struct {
+		requests *atomic.Int32
+		expected int32
+	}{
+		"unavailable":  {&unavailable, 3},
+		"unauthorized": {&unauthorized, 1},
+		"slow":         {&slow, 1},
+		"rejecting":    {&rejecting, 1},
+	} {
+		if got := tt.requests.Load(); got != tt.expected {
+			t.Errorf("expected %d requests to the %s TSA, got %d", tt.expected, name, got)
+		}
+	}
+
+	// Without a working TSA, the failures of all TSAs are reported.
+	context.SignData.TSA.Fallbacks = context.SignData.TSA.Fallbacks[:1]
+	_, err := context.GetTSA([]byte("signature"))
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	for _, url := range []string{unavailableTSA.URL, unauthorizedTSA.URL} {
+		if !strings.Contains(err.Error(), url) {
+			t.Errorf("expected the error to report %s: %s", url, err.Error())
+		}
+	}
+	var status *statusError
+	if !errors.As(err, &status) {
+		t.Errorf("expected a status error, got %T", err)
+	}
+}
+
+func TestGetTSAContext(t *testing.T) {
+	var slow, unavailable, fallback atomic.Int32
+	done := make(chan struct{})
+	slowTSA := newFailingTSA(t, &slow, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	})
+	t.Cleanup(func() { close(done) })
+	unavailableTSA := newFailingTSA(t, &unavailable, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "maintenance", http.StatusServiceUnavailable)
+	})
+	fallbackTSA := newFailingTSA(t, &fallback, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "maintenance", http.StatusServiceUnavailable)
+	})
+
+	tests := []struct {
+		name     string
+		tsa      TSA
+		requests *atomic.Int32
+	}{
+		{name: "slow response", tsa: TSA{URL: slowTSA.URL, Retries: 2}, requests: &slow},
+		{name: "retry backoff", tsa: TSA{URL: unavailableTSA.URL, Retries: 2, RetryBackoff: time.Hour}, requests: &unavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			tt.tsa.Fallbacks = []TSA{{URL: fallbackTSA.URL}}
+			sign_context := SignContext{SignData: SignData{TSA: tt.tsa, Context: ctx}}
+
+			start := time.Now()
+			_, err := sign_context.GetTSA([]byte("signature"))
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("expected the deadline to be exceeded, got %v", err)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("expected the request to be canceled, took %s", elapsed)
+			}
+			if got := tt.requests.Load(); got != 1 {
+				t.Errorf("expected a single request without retries, got %d", got)
+			}
+			if got := fallback.Load(); got != 0 {
+				t.Errorf("expected the fallback not to be tried, got %d requests", got)
+			}
+		})
+	}
+}
@@ -1,9 +1,16 @@
 package sign
 
 import (
+	"context"
 	"crypto"
+	"crypto/tls"
 	"crypto/x509"
+	"encoding/asn1"
+	"image/color"
 	"io"
+	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/digitorus/pdf"
@@ -16,24 +23,52 @@ type CatalogData struct {
 	RootString string
 }
 
+// TSA is a time-stamp authority (RFC 3161) and the settings of the requests
+// to it.
 type TSA struct {
-	URL      string
-	Username string
-	Password string
+	URL               string
+	Username          string           // User of the HTTP basic authentication
+	Password          string           // Password of the HTTP basic authentication
+	Token             string           // Bearer token, used instead of Username and Password
+	Header            http.Header      // Additional request headers, such as API keys
+	ClientCertificate *tls.Certificate // TLS client certificate of TSAs that require mutual TLS
+	RootCAs           *x509.CertPool   // Roots of the TSA server certificate, the system roots if nil
+	Proxy             *url.URL         // Proxy of the requests, the HTTPS_PROXY or HTTP_PROXY environment variable if nil
+	HTTPClient        *http.Client     // Sends the requests instead, ClientCertificate, RootCAs and Proxy are not used; SignData.HTTPClient if nil and none of them is set
+	Timeout           time.Duration    // Timeout of a request, none if zero
+	Retries           int              // Retries of timeouts, network errors and 429 and 5xx responses
+	RetryBackoff      time.Duration    // Delay before the first retry, doubled for every further retry; 1 second if zero
+	Fallbacks         []TSA            // Tried in order when the TSA fails, with their own settings; their Fallbacks and OnUsed are not used
+	OnUsed            func(url string) // Called with the URL of the TSA that returned the time-stamp response
 }
 
 type RevocationFunction func(cert, issuer *x509.Certificate, i *revocation.InfoArchival) error
 
 type SignData struct {
 	Signature          SignDataSignature
-	Signer             crypto.Signer
+	Signer             crypto.Signer // Any signing backend, see CertificateSigner for backends that hold the certificate
 	DigestAlgorithm    crypto.Hash
 	Certificate        *x509.Certificate
 	CertificateChains  [][]*x509.Certificate
+	IssuerFetcher      *IssuerFetcher // Completes the first certificate chain, or the Certificate alone, from caIssuers URLs; DefaultIssuerFetcher if nil
 	TSA                TSA
 	RevocationData     revocation.InfoArchival
 	RevocationFunction RevocationFunction
+	CRLFetcher         *CRLFetcher     // Embeds the CRLs of the first certificate chain in the crls field of the CMS when set
+	Context            context.Context // Cancels the network requests and the hashing of the document; context.Background() if nil
+	HTTPClient         *http.Client    // Sends the TSA, OCSP, CRL and caIssuers requests of a TSA or fetcher without a client of its own, see WithHTTPClient
 	Appearance         Appearance
+	Profile            PAdESProfile
+	SubFilter          SubFilter          // Defaults to ETSI.CAdES.detached with a Profile and adbe.pkcs7.detached otherwise
+	SignaturePolicy    *SignaturePolicy   // Adds the signature-policy-identifier signed attribute of an explicit policy (PAdES-EPES)
+	FieldName          string             // Fully qualified name of an existing empty signature field to sign, a new field is created if empty
+	SignatureAlgorithm SignatureAlgorithm // Defaults to the algorithm of the signer's key, PKCS #1 v1.5 for RSA keys
+	PDF20              bool               // Allows PDF 2.0 features such as Ed25519 signatures, the document version is raised to 2.0
+	Deterministic      bool               // Creates identical output for identical input, the signing time is taken from Signature.Info.Date
+	Password           string             // User or owner password of an encrypted document
+	RepairXref         bool               // Rebuilds a corrupt cross-reference table from the objects of the document, the rebuilt section is signed along
+	UpdateMetadata     bool               // Sets the modification date of the document information and XMP metadata to the signing date in the signed revision, and records the signing in the XMP history
+	OnLinearized       func(length int64) // Called by Sign and Prepare for a linearized document of length bytes, whose linearization (fast web view) the update invalidates
 
 	objectId uint32
 }
@@ -43,6 +78,8 @@ type Appearance struct {
 	Visible bool
 
 	Page        uint32
+	Pages       []uint32 // Places linked widgets of the signature on each page, overrides Page
+	AllPages    bool     // Places linked widgets of the signature on every page, overrides Page and Pages
 	LowerLeftX  float64
 	LowerLeftY  float64
 	UpperRightX float64
@@ -50,11 +87,34 @@ type Appearance struct {
 
 	Image            []byte // Image data to use as signature appearance
 	ImageAsWatermark bool   // If true, the text will be drawn over the image
+
+	// Text layout, used when there is no image or the image is a watermark.
+	ShowDetails     bool          // If true, the reason, location and date are drawn below the name
+	Font            []byte        // TrueType or OpenType font data, a subset is embedded; defaults to Times-Roman
+	FontIndex       int           // Font of a TrueType or OpenType collection (.ttc, .otc) in Font, the first by default
+	FontSize        float64       // Font size in points, zero fits the text to the rectangle
+	TextAlignment   TextAlignment // Horizontal alignment of the text lines
+	TextColor       color.Color   // Defaults to a ballpoint-like blue
+	BackgroundColor color.Color   // Fills the rectangle if set
+	BorderColor     color.Color   // Draws a border around the rectangle if set
 }
 
+//go:generate stringer -type=TextAlignment
+type TextAlignment uint
+
+const (
+	TextAlignCenter TextAlignment = iota
+	TextAlignLeft
+	TextAlignRight
+)
+
 type VisualSignData struct {
 	pageObjectId uint32
 	objectId     uint32
+
+	// existingField is set when objectId refers to a field that is already
+	// part of the AcroForm.
+	existingField bool
 }
 
 type InfoData struct {
@@ -80,12 +140,120 @@ const (
 	AllowFillingExistingFormFieldsAndSignaturesAndCRUDAnnotationsPerms
 )
 
+// PAdESProfile selects the PAdES baseline level (ETSI EN 319 142-1) the
+// signature is produced for. The zero value creates a plain adbe.pkcs7.detached
+// signature without any baseline guarantees.
+//
+//go:generate stringer -type=PAdESProfile
+type PAdESProfile uint
+
+const (
+	PAdESBaselineB PAdESProfile = iota + 1
+	PAdESBaselineT
+	PAdESBaselineLT
+	PAdESBaselineLTA
+)
+
+// SubFilter selects the encoding of the signature, the SubFilter entry of the
+// signature dictionary (ISO 32000-2, 12.8.3.3).
+type SubFilter uint
+
+const (
+	// SubFilterAdbePKCS7Detached is a CMS signature with the signing-time and
+	// adbe-revocationInfoArchival signed attributes.
+	SubFilterAdbePKCS7Detached SubFilter = iota + 1
+	// SubFilterETSICAdESDetached is a CAdES signature (ETSI EN 319 142-1),
+	// the signing time is in the M entry and the revocation data in the DSS.
+	SubFilterETSICAdESDetached
+	// SubFilterAdbePKCS7SHA1 is the legacy adbe.pkcs7.sha1 form, the SHA-1
+	// digest of the ByteRange is encapsulated as the content of the CMS
+	// signature, which requires a SHA-1 digest algorithm.
+	SubFilterAdbePKCS7SHA1
+	// SubFilterAdbeX509RSASHA1 is the legacy adbe.x509.rsa_sha1 form, a
+	// PKCS #1 v1.5 signature of an RSA key without CMS, the certificate
+	// chain is the Cert entry of the signature dictionary. Signature
+	// timestamps and revocation data can not be embedded.
+	SubFilterAdbeX509RSASHA1
+)
+
+func (s SubFilter) String() string {
+	switch s {
+	case SubFilterAdbePKCS7Detached:
+		return "adbe.pkcs7.detached"
+	case SubFilterETSICAdESDetached:
+		return "ETSI.CAdES.detached"
+	case SubFilterAdbePKCS7SHA1:
+		return "adbe.pkcs7.sha1"
+	case SubFilterAdbeX509RSASHA1:
+		return "adbe.x509.rsa_sha1"
+	}
+	return "SubFilter(" + strconv.FormatUint(uint64(s), 10) + ")"
+}
+
+// SignatureAlgorithm selects the signature algorithm of the CMS SignerInfo.
+//
+//go:generate stringer -type=SignatureAlgorithm
+type SignatureAlgorithm uint
+
+const (
+	RSAPKCS1v15 SignatureAlgorithm = iota + 1
+	RSAPSS
+	ECDSA
+	Ed25519
+)
+
+// FieldLockAction selects which form fields are locked by a FieldLock.
+//
+//go:generate stringer -type=FieldLockAction
+type FieldLockAction uint
+
+const (
+	LockAllFields FieldLockAction = iota + 1
+	LockIncludedFields
+	LockExcludedFields
+)
+
+// FieldLock describes the form fields that must not change after the
+// signature is applied (FieldMDP, see ISO 32000-1, 12.8.2.4).
+type FieldLock struct {
+	Action FieldLockAction
+	Fields []string // Fully qualified field names, for LockIncludedFields and LockExcludedFields
+}
+
 type SignDataSignature struct {
-	CertType   CertType
-	DocMDPPerm DocMDPPerm
-	Info       SignDataSignatureInfo
+	CertType         CertType
+	DocMDPPerm       DocMDPPerm
+	FieldLock        *FieldLock     // Locks form fields once signed, defaults to the /Lock of an existing field
+	CommitmentType   CommitmentType // Adds the commitment-type-indication signed attribute
+	CommitmentReason bool           // Uses the commitment type as Reason if the Reason is empty
+	Info             SignDataSignatureInfo
+}
+
+// SignaturePolicy identifies the signature policy that the signature claims
+// conformance to, see ETSI EN 319 122-1, 5.2.9.
+type SignaturePolicy struct {
+	OID           asn1.ObjectIdentifier // Identifier of the policy
+	Hash          []byte                // Digest of the policy document, calculated from Document if empty
+	HashAlgorithm crypto.Hash           // Digest algorithm of Hash, SHA-256 if zero
+	Document      []byte                // Policy document, only used to calculate the Hash
+	URL           string                // Where the policy document can be retrieved, the SPuri qualifier
 }
 
+// CommitmentType is the commitment of the signer to the signed document,
+// see ETSI EN 319 122-1, 5.2.3, with the commitment types of RFC 5126, 5.11.1.
+//
+//go:generate stringer -type=CommitmentType
+type CommitmentType uint
+
+const (
+	ProofOfOrigin CommitmentType = iota + 1
+	ProofOfReceipt
+	ProofOfDelivery
+	ProofOfSender
+	ProofOfApproval
+	ProofOfCreation
+)
+
 type SignDataSignatureInfo struct {
 	Name        string
 	Location    string
@@ -112,4 +280,32 @@ type SignContext struct {
 	lastXrefID         uint32
 	newXrefEntries     []xrefEntry
 	updatedXrefEntries []xrefEntry
+
+	// timestampCertificates holds the certificates of the signature timestamp
+	// token, they are added to the DSS for PAdES baseline-LT and above.
+	timestampCertificates []*x509.Certificate
+
+	// dssObjectId is the object id of a DSS dictionary written in this
+	// revision, it replaces the DSS of the previous revision in the catalog.
+	dssObjectId uint32
+
+	// timestampTokenSize is the estimated size of the time-stamp token, see
+	// timestampPlaceholderSize.
+	timestampTokenSize int
+
+	// crls holds the CRLs of the CRLFetcher, they are added to the crls
+	// field of the SignedData.
+	crls [][]byte
+
+	// preparedFields holds the object ids of unsigned signature fields that
+	// are added to the AcroForm in this revision.
+	preparedFields []uint32
+
+	// security encrypts the objects of the revision when the document is
+	// encrypted, PDFReader then reads the decrypted copy of InputFile.
+	security *securityHandler
+
+	// inputLength is the number of bytes of the output that are read from
+	// InputFile, OutputBuffer holds the incremental update that follows them.
+	inputLength int64
 }
@@ -0,0 +1,177 @@
+// Package awskms implements a signer for asymmetric AWS KMS keys. Requests
+// are signed with AWS Signature Version 4, the AWS SDK is not required.
+package awskms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Config holds the settings of the KMS service.
+type Config struct {
+	Region      string       // AWS region of the key, e.g. eu-west-1
+	Endpoint    string       // Defaults to https://kms.<region>.amazonaws.com
+	Credentials Credentials  // Defaults to EnvironmentCredentials
+	HTTPClient  *http.Client // Defaults to http.DefaultClient
+}
+
+// Credentials are the AWS credentials to sign requests with.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string // Optional, for temporary credentials
+}
+
+// EnvironmentCredentials returns the credentials of the AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables.
+func EnvironmentCredentials() Credentials {
+	return Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// Client calls the KMS API.
+type Client struct {
+	config Config
+	now    func() time.Time
+}
+
+// Error is an error response of KMS.
+type Error struct {
+	StatusCode int
+	Type       string `json:"__type"`
+	Message    string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("awskms: %s: %s (%d)", e.Type, e.Message, e.StatusCode)
+	}
+	return fmt.Sprintf("awskms: %s (%d)", e.Type, e.StatusCode)
+}
+
+// PublicKey is the response of GetPublicKey.
+type PublicKey struct {
+	KeyID             string   `json:"KeyId"`
+	KeySpec           string   `json:"KeySpec"`
+	KeyUsage          string   `json:"KeyUsage"`
+	PublicKey         []byte   `json:"PublicKey"` // DER encoded SubjectPublicKeyInfo
+	SigningAlgorithms []string `json:"SigningAlgorithms"`
+}
+
+// SignRequest is the request of Sign.
+type SignRequest struct {
+	KeyID            string `json:"KeyId"`
+	Message          []byte `json:"Message"`
+	MessageType      string `json:"MessageType"` // RAW or DIGEST
+	SigningAlgorithm string `json:"SigningAlgorithm"`
+}
+
+// NewClient returns a client of the KMS service in config.
+func NewClient(config Config) *Client {
+	if config.Credentials.AccessKeyID == "" {
+		config.Credentials = EnvironmentCredentials()
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = "https://kms." + config.Region + ".amazonaws.com"
+	}
+	config.Endpoint = strings.TrimSuffix(config.Endpoint, "/")
+	return &Client{config: config, now: time.Now}
+}
+
+// GetPublicKey returns the public key and the signing algorithms of a key.
+func (c *Client) GetPublicKey(ctx context.Context, keyID string) (*PublicKey, error) {
+	request := struct {
+		KeyID string `json:"KeyId"`
+	}{keyID}
+
+	var response PublicKey
+	if err := c.call(ctx, "GetPublicKey", request, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// Sign returns the signature of the message in the request.
+func (c *Client) Sign(ctx context.Context, request SignRequest) ([]byte, error) {
+	var response struct {
+		Signature []byte `json:"Signature"`
+	}
+	if err := c.call(ctx, "Sign", request, &response); err != nil {
+		return nil, err
+	}
+	if len(response.Signature) == 0 {
+		return nil, errors.New("awskms: Sign response without signature")
+	}
+	return response.Signature, nil
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.config.HTTPClient != nil {
+		return c.config.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// call posts the JSON request to the KMS action and decodes the response.
+func (c *Client) call(ctx context.Context, action string, request, response interface{}) error {
+	if c.config.Region == "" {
+		return errors.New("awskms: region is required")
+	}
+	if c.config.Credentials.AccessKeyID == "" || c.config.Credentials.SecretAccessKey == "" {
+		return errors.New("awskms: credentials are required")
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.config.Endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("awskms: failed to prepare request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService."+action)
+	signV4(req, body, c.config.Credentials, c.config.Region, "kms", c.now())
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("awskms: %s failed: %w", action, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("awskms: failed to read %s response: %w", action, err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		e := &Error{StatusCode: resp.StatusCode}
+		if json.Unmarshal(body, e) != nil || e.Type == "" {
+			e.Type = http.StatusText(resp.StatusCode)
+		}
+		// Types may be qualified, e.g. com.amazonaws.kms#NotFoundException.
+		if i := strings.LastIndexByte(e.Type, '#'); i >= 0 {
+			e.Type = e.Type[i+1:]
+		}
+		return e
+	}
+
+	if err := json.Unmarshal(body, response); err != nil {
+		return fmt.Errorf("awskms: invalid %s response: %w", action, err)
+	}
+	return nil
+}
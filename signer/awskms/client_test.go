@@ -0,0 +1,165 @@
+package awskms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdfsign/sign"
+)
+
+// testService is a KMS API with a single key.
+type testService struct {
+	*httptest.Server
+	key         crypto.Signer
+	certificate *x509.Certificate
+	algorithms  []string
+	lastRequest SignRequest
+}
+
+func newTestService(t *testing.T, key crypto.Signer, algorithms ...string) *testService {
+	t.Helper()
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "pdfsign AWS KMS test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	public, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	s := &testService{key: key, certificate: certificate, algorithms: algorithms}
+
+	fail := func(w http.ResponseWriter, status int, typ, message string) {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(map[string]string{"__type": typ, "message": message})
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") ||
+			!strings.Contains(r.Header.Get("Authorization"), "/eu-west-1/kms/aws4_request") {
+			fail(w, http.StatusBadRequest, "com.amazon.coral.service#UnrecognizedClientException", "The security token included in the request is invalid.")
+			return
+		}
+
+		switch r.Header.Get("X-Amz-Target") {
+		case "TrentService.GetPublicKey":
+			var request struct{ KeyId string }
+			if json.NewDecoder(r.Body).Decode(&request) != nil || request.KeyId != "key" {
+				fail(w, http.StatusBadRequest, "NotFoundException", "Key 'key' does not exist")
+				return
+			}
+			_ = json.NewEncoder(w).Encode(PublicKey{
+				KeyID:             "arn:aws:kms:eu-west-1:111122223333:key/key",
+				KeyUsage:          "SIGN_VERIFY",
+				PublicKey:         public,
+				SigningAlgorithms: s.algorithms,
+			})
+		case "TrentService.Sign":
+			var request SignRequest
+			if json.NewDecoder(r.Body).Decode(&request) != nil || request.MessageType != "DIGEST" {
+				fail(w, http.StatusBadRequest, "ValidationException", "invalid request")
+				return
+			}
+			s.lastRequest = request
+
+			hash, algorithm, err := SignatureAlgorithm(request.SigningAlgorithm)
+			if err != nil {
+				fail(w, http.StatusBadRequest, "ValidationException", err.Error())
+				return
+			}
+			var opts crypto.SignerOpts = hash
+			if algorithm == sign.RSAPSS {
+				opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: hash}
+			}
+			signature, err := key.Sign(rand.Reader, request.Message, opts)
+			if err != nil {
+				fail(w, http.StatusBadRequest, "KMSInvalidSignatureException", err.Error())
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"KeyId": request.KeyID, "Signature": signature})
+		default:
+			fail(w, http.StatusBadRequest, "UnknownOperationException", "")
+		}
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func newTestClient(service *testService) *Client {
+	return NewClient(Config{
+		Region:      "eu-west-1",
+		Endpoint:    service.URL,
+		Credentials: Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"},
+	})
+}
+
+func TestClientError(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	service := newTestService(t, key, "ECDSA_SHA_256")
+
+	_, err = newTestClient(service).GetPublicKey(context.Background(), "missing")
+	var e *Error
+	if !errors.As(err, &e) || e.StatusCode != http.StatusBadRequest || e.Type != "NotFoundException" {
+		t.Fatalf("expected a NotFoundException, got %v", err)
+	}
+
+	client := NewClient(Config{
+		Region:      "eu-west-1",
+		Endpoint:    service.URL,
+		Credentials: Credentials{AccessKeyID: "other", SecretAccessKey: "secret"},
+	})
+	_, err = client.GetPublicKey(context.Background(), "key")
+	if !errors.As(err, &e) || e.Type != "UnrecognizedClientException" {
+		t.Fatalf("expected an UnrecognizedClientException, got %v", err)
+	}
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	if _, err := NewClient(Config{Region: "eu-west-1"}).GetPublicKey(context.Background(), "key"); err == nil {
+		t.Errorf("expected an error without credentials")
+	}
+}
+
+func TestEnvironmentCredentials(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "session")
+
+	client := NewClient(Config{Region: "eu-west-1"})
+	if client.config.Credentials != (Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret", SessionToken: "session"}) {
+		t.Errorf("expected the credentials of the environment, got %+v", client.config.Credentials)
+	}
+	if client.config.Endpoint != "https://kms.eu-west-1.amazonaws.com" {
+		t.Errorf("unexpected endpoint %s", client.config.Endpoint)
+	}
+}
@@ -0,0 +1,155 @@
+package awskms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/digitorus/pdfsign/sign"
+)
+
+// signingAlgorithms maps the KMS signing algorithms to the digest algorithm
+// and the signature algorithm of the CMS SignerInfo.
+var signingAlgorithms = map[string]struct {
+	hash      crypto.Hash
+	algorithm sign.SignatureAlgorithm
+}{
+	"RSASSA_PKCS1_V1_5_SHA_256": {crypto.SHA256, sign.RSAPKCS1v15},
+	"RSASSA_PKCS1_V1_5_SHA_384": {crypto.SHA384, sign.RSAPKCS1v15},
+	"RSASSA_PKCS1_V1_5_SHA_512": {crypto.SHA512, sign.RSAPKCS1v15},
+	"RSASSA_PSS_SHA_256":        {crypto.SHA256, sign.RSAPSS},
+	"RSASSA_PSS_SHA_384":        {crypto.SHA384, sign.RSAPSS},
+	"RSASSA_PSS_SHA_512":        {crypto.SHA512, sign.RSAPSS},
+	"ECDSA_SHA_256":             {crypto.SHA256, sign.ECDSA},
+	"ECDSA_SHA_384":             {crypto.SHA384, sign.ECDSA},
+	"ECDSA_SHA_512":             {crypto.SHA512, sign.ECDSA},
+}
+
+// SignatureAlgorithm returns the SignData.DigestAlgorithm and
+// SignData.SignatureAlgorithm of a KMS signing algorithm.
+func SignatureAlgorithm(signingAlgorithm string) (crypto.Hash, sign.SignatureAlgorithm, error) {
+	a, ok := signingAlgorithms[signingAlgorithm]
+	if !ok {
+		return 0, 0, fmt.Errorf("awskms: unsupported signing algorithm %s", signingAlgorithm)
+	}
+	return a.hash, a.algorithm, nil
+}
+
+// Signer signs with an asymmetric KMS key. It implements crypto.Signer and
+// sign.CertificateSigner.
+type Signer struct {
+	client     *Client
+	keyID      string
+	public     crypto.PublicKey
+	algorithms []string
+	chain      []*x509.Certificate
+}
+
+// NewSigner returns the signer of a key with the SIGN_VERIFY key usage. KMS
+// does not store certificates, chain is the certificate of the key followed
+// by its issuers.
+func (c *Client) NewSigner(ctx context.Context, keyID string, chain []*x509.Certificate) (*Signer, error) {
+	if len(chain) == 0 {
+		return nil, errors.New("awskms: certificate chain is required")
+	}
+
+	key, err := c.GetPublicKey(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+	if key.KeyUsage != "SIGN_VERIFY" {
+		return nil, fmt.Errorf("awskms: key %s has key usage %s", keyID, key.KeyUsage)
+	}
+
+	public, err := x509.ParsePKIXPublicKey(key.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("awskms: unsupported public key: %w", err)
+	}
+	certified, ok := chain[0].PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !certified.Equal(public) {
+		return nil, fmt.Errorf("awskms: certificate does not match key %s", keyID)
+	}
+
+	return &Signer{
+		client:     c,
+		keyID:      keyID,
+		public:     public,
+		algorithms: key.SigningAlgorithms,
+		chain:      chain,
+	}, nil
+}
+
+// Public returns the public key of the KMS key.
+func (s *Signer) Public() crypto.PublicKey {
+	return s.public
+}
+
+// CertificateChain returns the signing certificate followed by its issuers.
+func (s *Signer) CertificateChain() ([]*x509.Certificate, error) {
+	return s.chain, nil
+}
+
+// SigningAlgorithms returns the KMS signing algorithms of the key.
+func (s *Signer) SigningAlgorithms() []string {
+	return s.algorithms
+}
+
+// Sign signs the digest with the KMS Sign action, the digest is passed as
+// is with the DIGEST message type. *rsa.PSSOptions select RSASSA-PSS, which
+// KMS only supports with a salt as long as the digest.
+func (s *Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	hash := opts.HashFunc()
+	if len(digest) != hash.Size() {
+		return nil, errors.New("awskms: digest length does not match the digest algorithm")
+	}
+
+	var algorithm sign.SignatureAlgorithm
+	switch s.public.(type) {
+	case *rsa.PublicKey:
+		algorithm = sign.RSAPKCS1v15
+		if pss, ok := opts.(*rsa.PSSOptions); ok {
+			if pss.SaltLength != rsa.PSSSaltLengthEqualsHash && pss.SaltLength != rsa.PSSSaltLengthAuto && pss.SaltLength != hash.Size() {
+				return nil, errors.New("awskms: RSASSA-PSS requires a salt length equal to the digest length")
+			}
+			algorithm = sign.RSAPSS
+		}
+	case *ecdsa.PublicKey:
+		algorithm = sign.ECDSA
+	default:
+		return nil, fmt.Errorf("awskms: unsupported key type %T", s.public)
+	}
+
+	name := signingAlgorithmName(hash, algorithm)
+	if name == "" {
+		return nil, fmt.Errorf("awskms: unsupported digest algorithm %s for %s", hash, algorithm)
+	}
+	supported := false
+	for _, a := range s.algorithms {
+		supported = supported || a == name
+	}
+	if !supported {
+		return nil, fmt.Errorf("awskms: key %s does not support %s", s.keyID, name)
+	}
+
+	// ECDSA signatures of KMS are ASN.1 encoded already.
+	return s.client.Sign(context.Background(), SignRequest{
+		KeyID:            s.keyID,
+		Message:          digest,
+		MessageType:      "DIGEST",
+		SigningAlgorithm: name,
+	})
+}
+
+func signingAlgorithmName(hash crypto.Hash, algorithm sign.SignatureAlgorithm) string {
+	for name, a := range signingAlgorithms {
+		if a.hash == hash && a.algorithm == algorithm {
+			return name
+		}
+	}
+	return ""
+}
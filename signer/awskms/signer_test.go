@@ -0,0 +1,145 @@
+package awskms
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/sign"
+	"github.com/digitorus/pdfsign/verify"
+)
+
+func TestSignerSignPDF(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	rsaAlgorithms := []string{"RSASSA_PKCS1_V1_5_SHA_256", "RSASSA_PSS_SHA_256", "RSASSA_PSS_SHA_512"}
+
+	tests := []struct {
+		name             string
+		key              crypto.Signer
+		algorithms       []string
+		signingAlgorithm string
+	}{
+		{name: "rsa", key: rsaKey, algorithms: rsaAlgorithms, signingAlgorithm: "RSASSA_PKCS1_V1_5_SHA_256"},
+		{name: "rsa-pss", key: rsaKey, algorithms: rsaAlgorithms, signingAlgorithm: "RSASSA_PSS_SHA_512"},
+		{name: "ecdsa", key: ecdsaKey, algorithms: []string{"ECDSA_SHA_384"}, signingAlgorithm: "ECDSA_SHA_384"},
+	}
+
+	input, err := os.ReadFile("../../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := newTestService(t, tt.key, tt.algorithms...)
+			signer, err := newTestClient(service).NewSigner(context.Background(), "key", []*x509.Certificate{service.certificate})
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			hash, algorithm, err := SignatureAlgorithm(tt.signingAlgorithm)
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			rdr, err := pdf.NewReader(bytes.NewReader(input), int64(len(input)))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			var output bytes.Buffer
+			err = sign.Sign(bytes.NewReader(input), &output, rdr, int64(len(input)), sign.SignData{
+				Signature: sign.SignDataSignature{
+					Info: sign.SignDataSignatureInfo{
+						Name: "John Doe",
+						Date: time.Now().Local(),
+					},
+					CertType: sign.ApprovalSignature,
+				},
+				Signer:             signer,
+				DigestAlgorithm:    hash,
+				SignatureAlgorithm: algorithm,
+			})
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if service.lastRequest.SigningAlgorithm != tt.signingAlgorithm {
+				t.Errorf("expected signing algorithm %s, got %s", tt.signingAlgorithm, service.lastRequest.SigningAlgorithm)
+			}
+
+			info, err := verify.Verify(bytes.NewReader(output.Bytes()), int64(output.Len()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if len(info.Signers) != 1 || !info.Signers[0].ValidSignature {
+				t.Errorf("expected a single valid signature")
+			}
+		})
+	}
+}
+
+func TestSignerUnsupportedAlgorithm(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	service := newTestService(t, key, "ECDSA_SHA_256")
+	client := newTestClient(service)
+
+	signer, err := client.NewSigner(context.Background(), "key", []*x509.Certificate{service.certificate})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	digest := sha256.Sum256([]byte("pdfsign"))
+	if _, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256); err != nil {
+		t.Errorf("%s", err.Error())
+	}
+	digest512 := make([]byte, 64)
+	if _, err := signer.Sign(rand.Reader, digest512, crypto.SHA512); err == nil {
+		t.Errorf("expected an error for a signing algorithm of another key")
+	}
+	if _, err := signer.Sign(rand.Reader, digest[:], crypto.SHA3_256); err == nil {
+		t.Errorf("expected an error for a digest algorithm without KMS signing algorithm")
+	}
+
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if _, err := client.NewSigner(context.Background(), "key", []*x509.Certificate{newTestService(t, other).certificate}); err == nil {
+		t.Errorf("expected an error for a certificate of another key")
+	}
+}
+
+func TestSignatureAlgorithm(t *testing.T) {
+	hash, algorithm, err := SignatureAlgorithm("RSASSA_PSS_SHA_384")
+	if err != nil || hash != crypto.SHA384 || algorithm != sign.RSAPSS {
+		t.Errorf("unexpected mapping %s %s %v", hash, algorithm, err)
+	}
+	if _, _, err := SignatureAlgorithm("SM2DSA"); err == nil {
+		t.Errorf("expected an error for an unsupported signing algorithm")
+	}
+	for name, a := range signingAlgorithms {
+		if signingAlgorithmName(a.hash, a.algorithm) != name {
+			t.Errorf("expected %s for %s %s", name, a.hash, a.algorithm)
+		}
+	}
+}
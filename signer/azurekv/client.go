@@ -0,0 +1,349 @@
+// Package azurekv implements a signer for RSA and EC keys in Azure Key Vault
+// and Azure Managed HSM, with the Key Vault REST API. The Azure SDK is not
+// required, access tokens come from a TokenCredential.
+package azurekv
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const apiVersion = "7.4"
+
+// retryDelay is the first delay between retries of throttled requests
+// without Retry-After header, it doubles with every retry.
+var retryDelay = 500 * time.Millisecond
+
+// TokenCredential provides Microsoft Entra ID access tokens for a scope. It
+// can wrap azidentity credentials of the Azure SDK:
+//
+//	func (c sdkCredential) Token(ctx context.Context, scope string) (string, error) {
+//		token, err := c.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{scope}})
+//		return token.Token, err
+//	}
+type TokenCredential interface {
+	Token(ctx context.Context, scope string) (string, error)
+}
+
+// StaticToken is a TokenCredential that always returns the same access
+// token.
+type StaticToken string
+
+// Token returns the access token.
+func (t StaticToken) Token(context.Context, string) (string, error) {
+	return string(t), nil
+}
+
+// ClientSecretCredential requests access tokens for an application with the
+// client credentials grant of the Microsoft identity platform.
+type ClientSecretCredential struct {
+	TenantID      string
+	ClientID      string
+	ClientSecret  string
+	AuthorityHost string       // Defaults to https://login.microsoftonline.com
+	HTTPClient    *http.Client // Defaults to http.DefaultClient
+
+	mu     sync.Mutex
+	tokens map[string]cachedToken
+}
+
+type cachedToken struct {
+	token  string
+	expiry time.Time
+}
+
+// Token returns a cached access token for the scope, or requests a new one.
+func (c *ClientSecretCredential) Token(ctx context.Context, scope string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cached, ok := c.tokens[scope]; ok && time.Now().Before(cached.expiry) {
+		return cached.token, nil
+	}
+
+	authority := c.AuthorityHost
+	if authority == "" {
+		authority = "https://login.microsoftonline.com"
+	}
+	tokenURL := strings.TrimSuffix(authority, "/") + "/" + url.PathEscape(c.TenantID) + "/oauth2/v2.0/token"
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {c.ClientID},
+		"client_secret": {c.ClientSecret},
+		"scope":         {scope},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("azurekv: failed to prepare token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("azurekv: token request failed: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	var response struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int    `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return "", fmt.Errorf("azurekv: invalid token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || response.AccessToken == "" {
+		return "", fmt.Errorf("azurekv: token request failed: %s %s (%d)", response.Error, response.ErrorDescription, resp.StatusCode)
+	}
+
+	// Renew the token a little before it expires.
+	expiresIn := time.Duration(response.ExpiresIn) * time.Second
+	if expiresIn <= 0 {
+		expiresIn = time.Hour
+	}
+	if c.tokens == nil {
+		c.tokens = make(map[string]cachedToken)
+	}
+	c.tokens[scope] = cachedToken{response.AccessToken, time.Now().Add(expiresIn - expiresIn/10)}
+
+	return response.AccessToken, nil
+}
+
+// Config holds the settings of a key vault.
+type Config struct {
+	VaultURL   string          // e.g. https://example.vault.azure.net or https://example.managedhsm.azure.net
+	Credential TokenCredential // Provides the access tokens
+	Scope      string          // Defaults to the Key Vault or Managed HSM scope of the public cloud
+	MaxRetries int             // Retries of throttled requests, defaults to 3, negative disables retries
+	HTTPClient *http.Client    // Defaults to http.DefaultClient
+}
+
+// Client calls the Key Vault REST API.
+type Client struct {
+	config Config
+}
+
+// Error is an error response of Key Vault.
+type Error struct {
+	StatusCode int
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("azurekv: %s: %s (%d)", e.Code, e.Message, e.StatusCode)
+	}
+	return fmt.Sprintf("azurekv: %s (%d)", e.Code, e.StatusCode)
+}
+
+// JSONWebKey is the public part of a Key Vault key (RFC 7517), the key
+// parameters are base64url encoded.
+type JSONWebKey struct {
+	KID    string   `json:"kid"` // Key identifier including the version
+	KTY    string   `json:"kty"` // RSA, RSA-HSM, EC or EC-HSM
+	KeyOps []string `json:"key_ops"`
+	N      string   `json:"n"`
+	E      string   `json:"e"`
+	CRV    string   `json:"crv"` // P-256, P-384 or P-521
+	X      string   `json:"x"`
+	Y      string   `json:"y"`
+}
+
+// NewClient returns a client of the key vault in config.
+func NewClient(config Config) *Client {
+	config.VaultURL = strings.TrimSuffix(config.VaultURL, "/")
+	if config.Scope == "" {
+		config.Scope = "https://vault.azure.net/.default"
+		if u, err := url.Parse(config.VaultURL); err == nil && strings.HasSuffix(u.Hostname(), ".managedhsm.azure.net") {
+			config.Scope = "https://managedhsm.azure.net/.default"
+		}
+	}
+	if config.MaxRetries == 0 {
+		config.MaxRetries = 3
+	}
+	return &Client{config: config}
+}
+
+// GetKey returns the public key of a key, the latest version if version is
+// empty.
+func (c *Client) GetKey(ctx context.Context, name, version string) (*JSONWebKey, error) {
+	var response struct {
+		Key JSONWebKey `json:"key"`
+	}
+	if err := c.call(ctx, http.MethodGet, keyPath(name, version), nil, &response); err != nil {
+		return nil, err
+	}
+	return &response.Key, nil
+}
+
+// GetCertificate returns the DER encoded certificate of a Key Vault
+// certificate, the latest version if version is empty.
+func (c *Client) GetCertificate(ctx context.Context, name, version string) ([]byte, error) {
+	var response struct {
+		CER string `json:"cer"`
+	}
+	path := "certificates/" + url.PathEscape(name)
+	if version != "" {
+		path += "/" + url.PathEscape(version)
+	}
+	if err := c.call(ctx, http.MethodGet, path, nil, &response); err != nil {
+		return nil, err
+	}
+	der, err := decodeBase64URL(response.CER)
+	if err != nil {
+		return nil, fmt.Errorf("azurekv: invalid certificate encoding: %w", err)
+	}
+	return der, nil
+}
+
+// Sign signs the digest with a key version and a JSON web signature
+// algorithm, e.g. PS256 or ES384 (keys/sign).
+func (c *Client) Sign(ctx context.Context, name, version, algorithm string, digest []byte) ([]byte, error) {
+	request := map[string]string{
+		"alg":   algorithm,
+		"value": base64.RawURLEncoding.EncodeToString(digest),
+	}
+	var response struct {
+		Value string `json:"value"`
+	}
+	if err := c.call(ctx, http.MethodPost, keyPath(name, version)+"/sign", request, &response); err != nil {
+		return nil, err
+	}
+	signature, err := decodeBase64URL(response.Value)
+	if err != nil || len(signature) == 0 {
+		return nil, errors.New("azurekv: invalid signature encoding")
+	}
+	return signature, nil
+}
+
+// decodeBase64URL decodes base64url, with or without padding. Standard base64
+// is accepted as well, certificates are encoded with it.
+func decodeBase64URL(s string) ([]byte, error) {
+	s = strings.NewReplacer("+", "-", "/", "_").Replace(strings.TrimRight(s, "="))
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+func keyPath(name, version string) string {
+	path := "keys/" + url.PathEscape(name)
+	if version != "" {
+		path += "/" + url.PathEscape(version)
+	}
+	return path
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.config.HTTPClient != nil {
+		return c.config.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// call sends the JSON request to the API path and decodes the response.
+// Throttled (429) and unavailable (503) responses are retried after the
+// Retry-After delay, or an exponential backoff.
+func (c *Client) call(ctx context.Context, method, path string, request, response interface{}) error {
+	if c.config.Credential == nil {
+		return errors.New("azurekv: credential is required")
+	}
+
+	var body []byte
+	if request != nil {
+		var err error
+		if body, err = json.Marshal(request); err != nil {
+			return err
+		}
+	}
+
+	delay := retryDelay
+	for attempt := 0; ; attempt++ {
+		token, err := c.config.Credential.Token(ctx, c.config.Scope)
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, c.config.VaultURL+"/"+path+"?api-version="+apiVersion, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("azurekv: failed to prepare request: %w", err)
+		}
+		if request != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		retryAfter, err := c.do(req, path, response)
+		if err == nil || retryAfter < 0 || attempt >= c.config.MaxRetries {
+			return err
+		}
+
+		if retryAfter == 0 {
+			retryAfter = delay
+			delay *= 2
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retryAfter):
+		}
+	}
+}
+
+// do sends the request and decodes the response. The returned delay is not
+// negative when the request can be retried.
+func (c *Client) do(req *http.Request, method string, response interface{}) (time.Duration, error) {
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return -1, fmt.Errorf("azurekv: %s failed: %w", method, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return -1, fmt.Errorf("azurekv: failed to read %s response: %w", method, err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var e struct {
+			Error *Error `json:"error"`
+		}
+		if json.Unmarshal(body, &e) != nil || e.Error == nil {
+			e.Error = &Error{Code: http.StatusText(resp.StatusCode)}
+		}
+		e.Error.StatusCode = resp.StatusCode
+
+		retryAfter := time.Duration(-1)
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+			retryAfter = 0
+			if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+				retryAfter = time.Duration(seconds) * time.Second
+			}
+		}
+		return retryAfter, e.Error
+	}
+
+	if err := json.Unmarshal(body, response); err != nil {
+		return -1, fmt.Errorf("azurekv: invalid %s response: %w", method, err)
+	}
+	return -1, nil
+}
@@ -0,0 +1,226 @@
+package azurekv
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testService is a key vault with a single key and certificate named "pdf".
+type testService struct {
+	*httptest.Server
+	key         crypto.Signer
+	certificate *x509.Certificate
+	throttle    atomic.Int32 // Number of sign requests to reject with 429
+	signs       atomic.Int32
+	tokens      atomic.Int32
+	lastAlg     string
+}
+
+func newTestService(t *testing.T, key crypto.Signer) *testService {
+	t.Helper()
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "pdfsign Azure Key Vault test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	s := &testService{key: key, certificate: certificate}
+
+	encode := base64.RawURLEncoding.EncodeToString
+	jwk := map[string]interface{}{"key_ops": []string{"sign", "verify"}}
+	switch public := key.Public().(type) {
+	case *rsa.PublicKey:
+		jwk["kty"] = "RSA-HSM"
+		jwk["n"] = encode(public.N.Bytes())
+		jwk["e"] = encode(big.NewInt(int64(public.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (public.Curve.Params().BitSize + 7) / 8
+		jwk["kty"] = "EC"
+		jwk["crv"] = public.Curve.Params().Name
+		jwk["x"] = encode(public.X.FillBytes(make([]byte, size)))
+		jwk["y"] = encode(public.Y.FillBytes(make([]byte, size)))
+	}
+
+	fail := func(w http.ResponseWriter, status int, code, message string) {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]string{"code": code, "message": message}})
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/tenant/oauth2/v2.0/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("client_secret") != "secret" || r.FormValue("scope") != "https://vault.azure.net/.default" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+		s.tokens.Add(1)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "token", "expires_in": 3600})
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			fail(w, http.StatusUnauthorized, "Unauthorized", "AKV10000: Request is missing a Bearer or PoP token.")
+			return
+		}
+		if r.URL.Query().Get("api-version") != apiVersion {
+			fail(w, http.StatusBadRequest, "BadParameter", "missing api-version")
+			return
+		}
+
+		switch r.URL.Path {
+		case "/keys/pdf", "/keys/pdf/v1":
+			jwk["kid"] = s.URL + "/keys/pdf/v1"
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"key": jwk})
+		case "/certificates/pdf/v1":
+			_ = json.NewEncoder(w).Encode(map[string]string{"cer": base64.StdEncoding.EncodeToString(certificate.Raw)})
+		case "/keys/pdf/v1/sign":
+			if s.throttle.Add(-1) >= 0 {
+				w.Header().Set("Retry-After", "0")
+				fail(w, http.StatusTooManyRequests, "Throttled", "Request was not processed because too many requests were received.")
+				return
+			}
+			var request struct{ Alg, Value string }
+			if json.NewDecoder(r.Body).Decode(&request) != nil {
+				fail(w, http.StatusBadRequest, "BadParameter", "invalid request")
+				return
+			}
+			s.signs.Add(1)
+			s.lastAlg = request.Alg
+
+			digest, _ := base64.RawURLEncoding.DecodeString(request.Value)
+			var opts crypto.SignerOpts
+			switch request.Alg[2:] {
+			case "256":
+				opts = crypto.SHA256
+			case "384":
+				opts = crypto.SHA384
+			case "512":
+				opts = crypto.SHA512
+			}
+			if strings.HasPrefix(request.Alg, "PS") {
+				opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: opts.HashFunc()}
+			}
+
+			var signature []byte
+			var err error
+			if k, ok := key.(*ecdsa.PrivateKey); ok {
+				var sigR, sigS *big.Int
+				if sigR, sigS, err = ecdsa.Sign(rand.Reader, k, digest); err == nil {
+					size := (k.Curve.Params().BitSize + 7) / 8
+					signature = append(sigR.FillBytes(make([]byte, size)), sigS.FillBytes(make([]byte, size))...)
+				}
+			} else {
+				signature, err = key.Sign(rand.Reader, digest, opts)
+			}
+			if err != nil {
+				fail(w, http.StatusBadRequest, "BadParameter", err.Error())
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]string{"kid": s.URL + "/keys/pdf/v1", "value": encode(signature)})
+		default:
+			fail(w, http.StatusNotFound, "KeyNotFound", "A key with (name/id) "+r.URL.Path+" was not found in this key vault.")
+		}
+	})
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func TestClientRetry(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	service := newTestService(t, key)
+
+	delay := retryDelay
+	retryDelay = time.Millisecond
+	t.Cleanup(func() { retryDelay = delay })
+
+	client := NewClient(Config{VaultURL: service.URL, Credential: StaticToken("token")})
+	service.throttle.Store(2)
+	if _, err := client.Sign(context.Background(), "pdf", "v1", "ES256", make([]byte, 32)); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if service.signs.Load() != 1 {
+		t.Errorf("expected a single signature, got %d", service.signs.Load())
+	}
+
+	client = NewClient(Config{VaultURL: service.URL, Credential: StaticToken("token"), MaxRetries: -1})
+	service.throttle.Store(1)
+	_, err = client.Sign(context.Background(), "pdf", "v1", "ES256", make([]byte, 32))
+	var e *Error
+	if !errors.As(err, &e) || e.StatusCode != http.StatusTooManyRequests || e.Code != "Throttled" {
+		t.Fatalf("expected a throttling error, got %v", err)
+	}
+}
+
+func TestClientSecretCredential(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	service := newTestService(t, key)
+
+	credential := &ClientSecretCredential{TenantID: "tenant", ClientID: "client", ClientSecret: "secret", AuthorityHost: service.URL}
+	client := NewClient(Config{VaultURL: service.URL, Credential: credential})
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetKey(context.Background(), "pdf", ""); err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+	}
+	if n := service.tokens.Load(); n != 1 {
+		t.Errorf("expected the access token to be reused, requested %d tokens", n)
+	}
+
+	credential = &ClientSecretCredential{TenantID: "tenant", ClientID: "client", ClientSecret: "wrong", AuthorityHost: service.URL}
+	if _, err := NewClient(Config{VaultURL: service.URL, Credential: credential}).GetKey(context.Background(), "pdf", ""); err == nil {
+		t.Errorf("expected an error for an invalid client secret")
+	}
+}
+
+func TestClientError(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	service := newTestService(t, key)
+
+	var e *Error
+	_, err = NewClient(Config{VaultURL: service.URL, Credential: StaticToken("token")}).GetKey(context.Background(), "missing", "")
+	if !errors.As(err, &e) || e.StatusCode != http.StatusNotFound || e.Code != "KeyNotFound" {
+		t.Fatalf("expected a KeyNotFound error, got %v", err)
+	}
+
+	if scope := NewClient(Config{VaultURL: "https://example.managedhsm.azure.net/"}).config.Scope; scope != "https://managedhsm.azure.net/.default" {
+		t.Errorf("unexpected Managed HSM scope %s", scope)
+	}
+}
@@ -0,0 +1,205 @@
+package azurekv
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+
+	"github.com/digitorus/pdfsign/sign"
+)
+
+// curves are the EC curves of Key Vault keys, with the digest algorithm of
+// their ES256, ES384 and ES512 signature algorithm.
+var curves = map[string]struct {
+	curve elliptic.Curve
+	ecdh  ecdh.Curve
+	hash  crypto.Hash
+}{
+	"P-256": {elliptic.P256(), ecdh.P256(), crypto.SHA256},
+	"P-384": {elliptic.P384(), ecdh.P384(), crypto.SHA384},
+	"P-521": {elliptic.P521(), ecdh.P521(), crypto.SHA512},
+}
+
+// Signer signs with an RSA or EC key of Key Vault or Managed HSM. It
+// implements crypto.Signer, sign.CertificateSigner and sign.AlgorithmSigner.
+type Signer struct {
+	client  *Client
+	name    string
+	version string
+	public  crypto.PublicKey
+	chain   []*x509.Certificate
+}
+
+// NewSigner returns the signer of a key version, the latest version if
+// version is empty. Without chain, the certificate of the Key Vault
+// certificate with the same name and version is used; Managed HSM does not
+// store certificates.
+func (c *Client) NewSigner(ctx context.Context, name, version string, chain []*x509.Certificate) (*Signer, error) {
+	key, err := c.GetKey(ctx, name, version)
+	if err != nil {
+		return nil, err
+	}
+	public, err := publicKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pin the version, the latest version may change while signing.
+	if i := strings.LastIndexByte(key.KID, '/'); version == "" && i >= 0 {
+		version = key.KID[i+1:]
+	}
+
+	if len(chain) == 0 {
+		der, err := c.GetCertificate(ctx, name, version)
+		if err != nil {
+			return nil, err
+		}
+		certificate, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("azurekv: invalid certificate: %w", err)
+		}
+		chain = []*x509.Certificate{certificate}
+	}
+	certified, ok := chain[0].PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !certified.Equal(public) {
+		return nil, fmt.Errorf("azurekv: certificate does not match key %s", name)
+	}
+
+	return &Signer{
+		client:  c,
+		name:    name,
+		version: version,
+		public:  public,
+		chain:   chain,
+	}, nil
+}
+
+// publicKey returns the public key of a JSON web key.
+func publicKey(key *JSONWebKey) (crypto.PublicKey, error) {
+	switch key.KTY {
+	case "RSA", "RSA-HSM":
+		n, err := decodeBase64URL(key.N)
+		if err != nil {
+			return nil, fmt.Errorf("azurekv: invalid RSA modulus: %w", err)
+		}
+		e, err := decodeBase64URL(key.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("azurekv: invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC", "EC-HSM":
+		c, ok := curves[key.CRV]
+		if !ok {
+			return nil, fmt.Errorf("azurekv: unsupported curve %s", key.CRV)
+		}
+		x, err := decodeBase64URL(key.X)
+		if err != nil {
+			return nil, fmt.Errorf("azurekv: invalid EC key: %w", err)
+		}
+		y, err := decodeBase64URL(key.Y)
+		if err != nil {
+			return nil, fmt.Errorf("azurekv: invalid EC key: %w", err)
+		}
+		size := (c.curve.Params().BitSize + 7) / 8
+		if len(x) > size || len(y) > size {
+			return nil, errors.New("azurekv: invalid EC key")
+		}
+		// crypto/ecdh checks that the point is on the curve.
+		point := make([]byte, 1+2*size)
+		point[0] = 4
+		copy(point[1+size-len(x):1+size], x)
+		copy(point[1+2*size-len(y):], y)
+		if _, err := c.ecdh.NewPublicKey(point); err != nil {
+			return nil, fmt.Errorf("azurekv: invalid EC key: %w", err)
+		}
+		return &ecdsa.PublicKey{Curve: c.curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+	return nil, fmt.Errorf("azurekv: unsupported key type %s", key.KTY)
+}
+
+// Public returns the public key of the key version.
+func (s *Signer) Public() crypto.PublicKey {
+	return s.public
+}
+
+// CertificateChain returns the signing certificate followed by its issuers.
+func (s *Signer) CertificateChain() ([]*x509.Certificate, error) {
+	return s.chain, nil
+}
+
+// SignatureAlgorithm returns the default digest and signature algorithm of
+// the key: SHA-256 with PKCS #1 v1.5 for RSA keys, and the digest of the
+// curve's ES algorithm for EC keys.
+func (s *Signer) SignatureAlgorithm() (crypto.Hash, sign.SignatureAlgorithm) {
+	if key, ok := s.public.(*ecdsa.PublicKey); ok {
+		return curves[key.Curve.Params().Name].hash, sign.ECDSA
+	}
+	return crypto.SHA256, sign.RSAPKCS1v15
+}
+
+// Sign signs the digest with keys/sign. RSA keys sign with RS256, RS384 or
+// RS512, or PS256, PS384 or PS512 for *rsa.PSSOptions. EC keys sign with the
+// ES algorithm of their curve.
+func (s *Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	hash := opts.HashFunc()
+	if len(digest) != hash.Size() {
+		return nil, errors.New("azurekv: digest length does not match the digest algorithm")
+	}
+
+	var bits string
+	switch hash {
+	case crypto.SHA256:
+		bits = "256"
+	case crypto.SHA384:
+		bits = "384"
+	case crypto.SHA512:
+		bits = "512"
+	default:
+		return nil, fmt.Errorf("azurekv: unsupported digest algorithm %s", hash)
+	}
+
+	var algorithm string
+	switch key := s.public.(type) {
+	case *rsa.PublicKey:
+		algorithm = "RS" + bits
+		if pss, ok := opts.(*rsa.PSSOptions); ok {
+			if pss.SaltLength != rsa.PSSSaltLengthEqualsHash && pss.SaltLength != rsa.PSSSaltLengthAuto && pss.SaltLength != hash.Size() {
+				return nil, errors.New("azurekv: RSASSA-PSS requires a salt length equal to the digest length")
+			}
+			algorithm = "PS" + bits
+		}
+	case *ecdsa.PublicKey:
+		if curves[key.Curve.Params().Name].hash != hash {
+			return nil, fmt.Errorf("azurekv: curve %s does not sign %s digests", key.Curve.Params().Name, hash)
+		}
+		algorithm = "ES" + bits
+	}
+
+	signature, err := s.client.Sign(context.Background(), s.name, s.version, algorithm, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	// ES signatures are the concatenation of r and s (RFC 7518, section 3.4).
+	if key, ok := s.public.(*ecdsa.PublicKey); ok {
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return nil, errors.New("azurekv: invalid ECDSA signature length")
+		}
+		return asn1.Marshal(struct{ R, S *big.Int }{
+			R: new(big.Int).SetBytes(signature[:size]),
+			S: new(big.Int).SetBytes(signature[size:]),
+		})
+	}
+	return signature, nil
+}
@@ -0,0 +1,136 @@
+package azurekv
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/sign"
+	"github.com/digitorus/pdfsign/verify"
+)
+
+func TestSignerSignPDF(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	tests := []struct {
+		name      string
+		key       crypto.Signer
+		algorithm sign.SignatureAlgorithm
+		alg       string
+	}{
+		{name: "rsa", key: rsaKey, alg: "RS256"},
+		{name: "rsa-pss", key: rsaKey, algorithm: sign.RSAPSS, alg: "PS256"},
+		{name: "ecdsa", key: ecdsaKey, alg: "ES384"},
+	}
+
+	input, err := os.ReadFile("../../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := newTestService(t, tt.key)
+			client := NewClient(Config{VaultURL: service.URL, Credential: StaticToken("token")})
+
+			// The certificate is read from the vault.
+			signer, err := client.NewSigner(context.Background(), "pdf", "", nil)
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			rdr, err := pdf.NewReader(bytes.NewReader(input), int64(len(input)))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			var output bytes.Buffer
+			err = sign.Sign(bytes.NewReader(input), &output, rdr, int64(len(input)), sign.SignData{
+				Signature: sign.SignDataSignature{
+					Info: sign.SignDataSignatureInfo{
+						Name: "John Doe",
+						Date: time.Now().Local(),
+					},
+					CertType: sign.ApprovalSignature,
+				},
+				Signer:             signer,
+				SignatureAlgorithm: tt.algorithm,
+			})
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if service.lastAlg != tt.alg {
+				t.Errorf("expected algorithm %s, got %s", tt.alg, service.lastAlg)
+			}
+
+			info, err := verify.Verify(bytes.NewReader(output.Bytes()), int64(output.Len()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if len(info.Signers) != 1 || !info.Signers[0].ValidSignature {
+				t.Errorf("expected a single valid signature")
+			}
+		})
+	}
+}
+
+func TestSignerCertificateMismatch(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	service := newTestService(t, key)
+	client := NewClient(Config{VaultURL: service.URL, Credential: StaticToken("token")})
+
+	chain := []*x509.Certificate{newTestService(t, other).certificate}
+	if _, err := client.NewSigner(context.Background(), "pdf", "v1", chain); err == nil {
+		t.Errorf("expected an error for a certificate of another key")
+	}
+
+	signer, err := client.NewSigner(context.Background(), "pdf", "v1", nil)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if _, err := signer.Sign(rand.Reader, make([]byte, 48), crypto.SHA384); err == nil {
+		t.Errorf("expected an error for a digest that does not match the curve")
+	}
+}
+
+func TestPublicKey(t *testing.T) {
+	tests := []struct {
+		name string
+		key  JSONWebKey
+	}{
+		{name: "octet key", key: JSONWebKey{KTY: "oct"}},
+		{name: "unknown curve", key: JSONWebKey{KTY: "EC", CRV: "P-256K"}},
+		{name: "point not on curve", key: JSONWebKey{KTY: "EC", CRV: "P-256", X: "AQ", Y: "AQ"}},
+		{name: "invalid exponent", key: JSONWebKey{KTY: "RSA", N: "AQAB", E: ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := publicKey(&tt.key); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+// Package cng implements a signer for certificates in the Windows certificate
+// store. Signatures are created with CNG (NCrypt) by the key storage provider
+// of the certificate, so keys on smartcards, in the TPM or marked as not
+// exportable can be used.
+package cng
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"sync"
+)
+
+// Location is the location of a system certificate store.
+type Location int
+
+const (
+	CurrentUser  Location = iota // Stores of the current user
+	LocalMachine                 // Stores of the computer, usually requires administrator rights for the key
+)
+
+// Config selects the certificate.
+type Config struct {
+	Store      string              // Name of the system store, defaults to "MY", the personal store
+	Location   Location            // Location of the store, defaults to CurrentUser
+	Thumbprint string              // SHA-1 thumbprint of the certificate in hex, or
+	Subject    string              // Part of the subject of the certificate, used when Thumbprint is empty
+	Chain      []*x509.Certificate // Signing certificate followed by its issuers, defaults to the chain built by Windows
+}
+
+// Padding flags of NCryptSignHash, ECDSA signatures have no padding.
+const (
+	bcryptPadNone  = 0x0
+	bcryptPadPKCS1 = 0x2
+	bcryptPadPSS   = 0x8
+)
+
+// padding is the padding scheme of NCryptSignHash.
+type padding struct {
+	flags      uint32
+	hash       crypto.Hash // Digest algorithm of the PKCS #1 v1.5 DigestInfo or of PSS
+	saltLength int
+}
+
+// key is the part of an NCrypt key handle that the signer uses.
+type key interface {
+	sign(padding padding, digest []byte) ([]byte, error)
+	close() error
+}
+
+// Signer signs with the private key of a certificate in the Windows
+// certificate store. It implements crypto.Signer and sign.CertificateSigner.
+type Signer struct {
+	mu    sync.Mutex
+	key   key
+	chain []*x509.Certificate
+}
+
+// Open finds the certificate and acquires its private key. A subject matches
+// several certificates more easily than a thumbprint, the first certificate
+// that is valid now is used. Close the signer to release the key.
+func Open(config Config) (*Signer, error) {
+	var thumbprint []byte
+	if config.Thumbprint != "" {
+		var err error
+		if thumbprint, err = parseThumbprint(config.Thumbprint); err != nil {
+			return nil, err
+		}
+	} else if config.Subject == "" {
+		return nil, errors.New("cng: certificate thumbprint or subject is required")
+	}
+	if config.Store == "" {
+		config.Store = "MY"
+	}
+
+	k, chain, err := openKey(config, thumbprint)
+	if err != nil {
+		return nil, err
+	}
+	if len(config.Chain) > 0 {
+		chain = config.Chain
+	}
+	s, err := newSigner(k, chain)
+	if err != nil {
+		_ = k.close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func newSigner(k key, chain []*x509.Certificate) (*Signer, error) {
+	if len(chain) == 0 {
+		return nil, errors.New("cng: certificate chain is empty")
+	}
+	switch chain[0].PublicKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return nil, fmt.Errorf("cng: unsupported public key type %T", chain[0].PublicKey)
+	}
+	return &Signer{key: k, chain: chain}, nil
+}
+
+// parseThumbprint decodes a hex thumbprint. Spaces, colons and the invisible
+// left-to-right mark that the certificate dialog of Windows puts in front of
+// copied thumbprints are ignored.
+func parseThumbprint(s string) ([]byte, error) {
+	s = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', ':', '\u200e':
+			return -1
+		}
+		return r
+	}, s)
+	thumbprint, err := hex.DecodeString(s)
+	if err != nil || len(thumbprint) != 20 {
+		return nil, fmt.Errorf("cng: invalid SHA-1 thumbprint %q", s)
+	}
+	return thumbprint, nil
+}
+
+// Public returns the public key of the signing certificate.
+func (s *Signer) Public() crypto.PublicKey {
+	return s.chain[0].PublicKey
+}
+
+// CertificateChain returns the signing certificate followed by its issuers.
+func (s *Signer) CertificateChain() ([]*x509.Certificate, error) {
+	return s.chain, nil
+}
+
+// Sign signs the digest with PKCS #1 v1.5, PSS for *rsa.PSSOptions, or
+// ECDSA. Windows may show a PIN dialog for keys on smartcards.
+func (s *Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	hash := opts.HashFunc()
+	if _, ok := algorithmIDs[hash]; !ok {
+		return nil, fmt.Errorf("cng: unsupported digest algorithm %s", hash)
+	}
+	if len(digest) != hash.Size() {
+		return nil, errors.New("cng: digest length does not match the digest algorithm")
+	}
+
+	p := padding{flags: bcryptPadNone, hash: hash}
+	_, isECDSA := s.Public().(*ecdsa.PublicKey)
+	if !isECDSA {
+		p.flags = bcryptPadPKCS1
+		if pss, ok := opts.(*rsa.PSSOptions); ok {
+			p.flags = bcryptPadPSS
+			p.saltLength = pss.SaltLength
+			if p.saltLength == rsa.PSSSaltLengthEqualsHash || p.saltLength == rsa.PSSSaltLengthAuto {
+				p.saltLength = hash.Size()
+			}
+		}
+	}
+
+	s.mu.Lock()
+	signature, err := s.key.sign(p, digest)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if isECDSA {
+		return ecdsaSignature(signature)
+	}
+	return signature, nil
+}
+
+// Close releases the private key.
+func (s *Signer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.key.close()
+}
+
+// algorithmIDs are the CNG algorithm identifiers of the digest algorithms,
+// used in the padding information of RSA signatures.
+var algorithmIDs = map[crypto.Hash]string{
+	crypto.SHA1:   "SHA1",
+	crypto.SHA256: "SHA256",
+	crypto.SHA384: "SHA384",
+	crypto.SHA512: "SHA512",
+}
+
+// ecdsaSignature converts the NCrypt ECDSA signature, the concatenation of r
+// and s, to its ASN.1 encoding.
+func ecdsaSignature(signature []byte) ([]byte, error) {
+	if len(signature) == 0 || len(signature)%2 != 0 {
+		return nil, errors.New("cng: invalid ECDSA signature length")
+	}
+	size := len(signature) / 2
+	return asn1.Marshal(struct{ R, S *big.Int }{
+		R: new(big.Int).SetBytes(signature[:size]),
+		S: new(big.Int).SetBytes(signature[size:]),
+	})
+}
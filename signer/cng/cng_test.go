@@ -0,0 +1,202 @@
+package cng
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/sign"
+	"github.com/digitorus/pdfsign/verify"
+)
+
+// fakeKey is a key storage provider with a software key. ECDSA signatures
+// are the concatenation of r and s, as returned by NCryptSignHash.
+type fakeKey struct {
+	key         crypto.Signer
+	lastPadding padding
+	closed      bool
+}
+
+func (k *fakeKey) sign(p padding, digest []byte) ([]byte, error) {
+	k.lastPadding = p
+	switch key := k.key.(type) {
+	case *rsa.PrivateKey:
+		switch p.flags {
+		case bcryptPadPKCS1:
+			return rsa.SignPKCS1v15(nil, key, p.hash, digest)
+		case bcryptPadPSS:
+			return rsa.SignPSS(rand.Reader, key, p.hash, digest, &rsa.PSSOptions{SaltLength: p.saltLength})
+		}
+	case *ecdsa.PrivateKey:
+		if p.flags == bcryptPadNone {
+			r, s, err := ecdsa.Sign(rand.Reader, key, digest)
+			if err != nil {
+				return nil, err
+			}
+			size := (key.Curve.Params().BitSize + 7) / 8
+			return append(r.FillBytes(make([]byte, size)), s.FillBytes(make([]byte, size))...), nil
+		}
+	}
+	return nil, errors.New("NTE_INVALID_PARAMETER")
+}
+
+func (k *fakeKey) close() error {
+	k.closed = true
+	return nil
+}
+
+func newTestCertificate(t *testing.T, key crypto.Signer) *x509.Certificate {
+	t.Helper()
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "pdfsign CNG test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	return certificate
+}
+
+func TestSignerSignPDF(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	tests := []struct {
+		name      string
+		key       crypto.Signer
+		algorithm sign.SignatureAlgorithm
+		padding   padding
+	}{
+		{name: "rsa", key: rsaKey, padding: padding{flags: bcryptPadPKCS1, hash: crypto.SHA256}},
+		{name: "rsa-pss", key: rsaKey, algorithm: sign.RSAPSS, padding: padding{flags: bcryptPadPSS, hash: crypto.SHA256, saltLength: 32}},
+		{name: "ecdsa", key: ecdsaKey, padding: padding{flags: bcryptPadNone, hash: crypto.SHA256}},
+	}
+
+	input, err := os.ReadFile("../../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := &fakeKey{key: tt.key}
+			signer, err := newSigner(key, []*x509.Certificate{newTestCertificate(t, tt.key)})
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			rdr, err := pdf.NewReader(bytes.NewReader(input), int64(len(input)))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			var output bytes.Buffer
+			err = sign.Sign(bytes.NewReader(input), &output, rdr, int64(len(input)), sign.SignData{
+				Signature: sign.SignDataSignature{
+					Info: sign.SignDataSignatureInfo{
+						Name: "John Doe",
+						Date: time.Now().Local(),
+					},
+					CertType: sign.ApprovalSignature,
+				},
+				Signer:             signer,
+				DigestAlgorithm:    crypto.SHA256,
+				SignatureAlgorithm: tt.algorithm,
+			})
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if key.lastPadding != tt.padding {
+				t.Errorf("expected padding %+v, got %+v", tt.padding, key.lastPadding)
+			}
+
+			info, err := verify.Verify(bytes.NewReader(output.Bytes()), int64(output.Len()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if len(info.Signers) != 1 || !info.Signers[0].ValidSignature {
+				t.Errorf("expected a single valid signature")
+			}
+
+			if err := signer.Close(); err != nil || !key.closed {
+				t.Errorf("expected the key to be released, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSignerSignUnsupportedDigest(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	signer, err := newSigner(&fakeKey{key: key}, []*x509.Certificate{newTestCertificate(t, key)})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	digest := sha256.Sum256([]byte("pdfsign"))
+	if _, err := signer.Sign(rand.Reader, digest[:], crypto.SHA3_256); err == nil {
+		t.Errorf("expected an error for SHA3-256")
+	}
+	if _, err := signer.Sign(rand.Reader, digest[:20], crypto.SHA256); err == nil {
+		t.Errorf("expected an error for a truncated digest")
+	}
+}
+
+func TestParseThumbprint(t *testing.T) {
+	expected := []byte{0x0f, 0x12, 0xa3, 0x4b, 0xc5, 0x6d, 0x78, 0xe9, 0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef, 0xfe, 0xdc, 0xba, 0x98}
+	for _, s := range []string{
+		"0f12a34bc56d78e90123456789abcdeffedcba98",
+		"\u200e0F 12 A3 4B C5 6D 78 E9 01 23 45 67 89 AB CD EF FE DC BA 98",
+		"0f:12:a3:4b:c5:6d:78:e9:01:23:45:67:89:ab:cd:ef:fe:dc:ba:98",
+	} {
+		thumbprint, err := parseThumbprint(s)
+		if err != nil || !bytes.Equal(thumbprint, expected) {
+			t.Errorf("parseThumbprint(%q) = %x, %v", s, thumbprint, err)
+		}
+	}
+
+	if _, err := parseThumbprint("0f12a34b"); err == nil {
+		t.Errorf("expected an error for a short thumbprint")
+	}
+}
+
+func TestOpen(t *testing.T) {
+	if _, err := Open(Config{}); err == nil {
+		t.Errorf("expected an error without thumbprint and subject")
+	}
+	if runtime.GOOS != "windows" {
+		if _, err := Open(Config{Subject: "John Doe"}); err == nil {
+			t.Errorf("expected an error outside of Windows")
+		}
+	}
+}
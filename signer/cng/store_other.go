@@ -0,0 +1,12 @@
+//go:build !windows
+
+package cng
+
+import (
+	"crypto/x509"
+	"errors"
+)
+
+func openKey(config Config, thumbprint []byte) (key, []*x509.Certificate, error) {
+	return nil, nil, errors.New("cng: the Windows certificate store is only available on Windows")
+}
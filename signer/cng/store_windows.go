@@ -0,0 +1,208 @@
+//go:build windows
+
+package cng
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	ncrypt               = windows.NewLazySystemDLL("ncrypt.dll")
+	procNCryptSignHash   = ncrypt.NewProc("NCryptSignHash")
+	procNCryptFreeObject = ncrypt.NewProc("NCryptFreeObject")
+)
+
+// BCRYPT_PKCS1_PADDING_INFO and BCRYPT_PSS_PADDING_INFO.
+type pkcs1PaddingInfo struct {
+	algorithmID *uint16
+}
+
+type pssPaddingInfo struct {
+	algorithmID *uint16
+	saltLength  uint32
+}
+
+// ncryptKey is an NCrypt key handle with the certificate context it was
+// acquired from, a handle that is not freed by the caller belongs to the
+// context.
+type ncryptKey struct {
+	handle      windows.Handle
+	callerFree  bool
+	certificate *windows.CertContext
+}
+
+func openKey(config Config, thumbprint []byte) (key, []*x509.Certificate, error) {
+	name, err := windows.UTF16PtrFromString(config.Store)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cng: invalid store name: %w", err)
+	}
+	flags := uint32(windows.CERT_STORE_READONLY_FLAG | windows.CERT_STORE_OPEN_EXISTING_FLAG)
+	if config.Location == LocalMachine {
+		flags |= windows.CERT_SYSTEM_STORE_LOCAL_MACHINE
+	} else {
+		flags |= windows.CERT_SYSTEM_STORE_CURRENT_USER
+	}
+	store, err := windows.CertOpenStore(windows.CERT_STORE_PROV_SYSTEM, 0, 0, flags, uintptr(unsafe.Pointer(name)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("cng: failed to open store %s: %w", config.Store, err)
+	}
+	defer func() {
+		_ = windows.CertCloseStore(store, 0)
+	}()
+
+	certificate, err := findCertificate(store, config, thumbprint)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	k := &ncryptKey{certificate: certificate}
+	var keySpec uint32
+	if err := windows.CryptAcquireCertificatePrivateKey(certificate, windows.CRYPT_ACQUIRE_ONLY_NCRYPT_KEY_FLAG, nil, &k.handle, &keySpec, &k.callerFree); err != nil {
+		_ = windows.CertFreeCertificateContext(certificate)
+		return nil, nil, fmt.Errorf("cng: failed to acquire the private key of the certificate: %w", err)
+	}
+
+	chain, err := certificateChain(certificate)
+	if err != nil {
+		_ = k.close()
+		return nil, nil, err
+	}
+	return k, chain, nil
+}
+
+// findCertificate returns the first certificate of the store that matches
+// the thumbprint or the subject and is valid now.
+func findCertificate(store windows.Handle, config Config, thumbprint []byte) (*windows.CertContext, error) {
+	const encoding = windows.X509_ASN_ENCODING | windows.PKCS_7_ASN_ENCODING
+
+	findType := uint32(windows.CERT_FIND_SUBJECT_STR)
+	var findPara unsafe.Pointer
+	if thumbprint != nil {
+		findType = windows.CERT_FIND_HASH
+		findPara = unsafe.Pointer(&windows.CryptHashBlob{Size: uint32(len(thumbprint)), Data: &thumbprint[0]})
+	} else {
+		subject, err := windows.UTF16PtrFromString(config.Subject)
+		if err != nil {
+			return nil, fmt.Errorf("cng: invalid subject: %w", err)
+		}
+		findPara = unsafe.Pointer(subject)
+	}
+
+	now := time.Now()
+	var previous *windows.CertContext
+	for {
+		// The previous context is freed by CertFindCertificateInStore.
+		context, err := windows.CertFindCertificateInStore(store, encoding, 0, findType, findPara, previous)
+		if err != nil {
+			if config.Thumbprint != "" {
+				return nil, fmt.Errorf("cng: no certificate with thumbprint %s in store %s", config.Thumbprint, config.Store)
+			}
+			return nil, fmt.Errorf("cng: no valid certificate with subject %q in store %s", config.Subject, config.Store)
+		}
+		certificate, err := parseCertificate(context)
+		if err == nil && now.After(certificate.NotBefore) && now.Before(certificate.NotAfter) {
+			return context, nil
+		}
+		previous = context
+	}
+}
+
+// certificateChain returns the chain that Windows builds for the
+// certificate, from the certificate to the root.
+func certificateChain(certificate *windows.CertContext) ([]*x509.Certificate, error) {
+	para := windows.CertChainPara{Size: uint32(unsafe.Sizeof(windows.CertChainPara{}))}
+	var context *windows.CertChainContext
+	if err := windows.CertGetCertificateChain(0, certificate, nil, certificate.Store, &para, 0, 0, &context); err != nil {
+		return nil, fmt.Errorf("cng: failed to build the certificate chain: %w", err)
+	}
+	defer windows.CertFreeCertificateChain(context)
+
+	if context.ChainCount == 0 {
+		return nil, errors.New("cng: empty certificate chain")
+	}
+	simple := unsafe.Slice(context.Chains, context.ChainCount)[0]
+
+	var chain []*x509.Certificate
+	for _, element := range unsafe.Slice(simple.Elements, simple.NumElements) {
+		c, err := parseCertificate(element.CertContext)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, c)
+	}
+	return chain, nil
+}
+
+func parseCertificate(context *windows.CertContext) (*x509.Certificate, error) {
+	// The certificate keeps a reference to its DER encoding, which is freed
+	// with the context.
+	der := bytes.Clone(unsafe.Slice(context.EncodedCert, context.Length))
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("cng: invalid certificate in store: %w", err)
+	}
+	return certificate, nil
+}
+
+func (k *ncryptKey) sign(p padding, digest []byte) ([]byte, error) {
+	var info unsafe.Pointer
+	if p.flags != bcryptPadNone {
+		algorithmID, err := windows.UTF16PtrFromString(algorithmIDs[p.hash])
+		if err != nil {
+			return nil, err
+		}
+		if p.flags == bcryptPadPSS {
+			info = unsafe.Pointer(&pssPaddingInfo{algorithmID: algorithmID, saltLength: uint32(p.saltLength)})
+		} else {
+			info = unsafe.Pointer(&pkcs1PaddingInfo{algorithmID: algorithmID})
+		}
+	}
+
+	var size uint32
+	if err := ncryptSignHash(k.handle, info, digest, nil, &size, p.flags); err != nil {
+		return nil, err
+	}
+	signature := make([]byte, size)
+	if err := ncryptSignHash(k.handle, info, digest, signature, &size, p.flags); err != nil {
+		return nil, err
+	}
+	return signature[:size], nil
+}
+
+func ncryptSignHash(handle windows.Handle, info unsafe.Pointer, digest, signature []byte, size *uint32, flags uint32) error {
+	var output *byte
+	if len(signature) > 0 {
+		output = &signature[0]
+	}
+	status, _, _ := procNCryptSignHash.Call(
+		uintptr(handle),
+		uintptr(info),
+		uintptr(unsafe.Pointer(&digest[0])),
+		uintptr(len(digest)),
+		uintptr(unsafe.Pointer(output)),
+		uintptr(len(signature)),
+		uintptr(unsafe.Pointer(size)),
+		uintptr(flags),
+	)
+	if status != 0 {
+		return fmt.Errorf("cng: NCryptSignHash failed: %w", windows.Errno(status))
+	}
+	return nil
+}
+
+func (k *ncryptKey) close() error {
+	if k.callerFree {
+		if status, _, _ := procNCryptFreeObject.Call(uintptr(k.handle)); status != 0 {
+			_ = windows.CertFreeCertificateContext(k.certificate)
+			return fmt.Errorf("cng: NCryptFreeObject failed: %w", windows.Errno(status))
+		}
+	}
+	return windows.CertFreeCertificateContext(k.certificate)
+}
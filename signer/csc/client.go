@@ -0,0 +1,268 @@
+// Package csc implements a signer for remote signing services that provide
+// the Cloud Signature Consortium API v2, see "Architectures and protocols for
+// remote signature applications", version 2.0.
+package csc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config holds the settings of a CSC service.
+type Config struct {
+	BaseURL     string       // Base URL of the API, including the version, e.g. https://example.com/csc/v2
+	AccessToken string       // OAuth2 access token, for example from the authorization code flow of the service
+	OAuth2      *OAuth2      // Client credentials to request access tokens with, used when AccessToken is empty
+	HTTPClient  *http.Client // Defaults to http.DefaultClient
+}
+
+// OAuth2 holds the client credentials of the client_credentials grant (RFC
+// 6749, section 4.4).
+type OAuth2 struct {
+	TokenURL     string // Defaults to BaseURL + "/oauth2/token"
+	ClientID     string
+	ClientSecret string
+	Scope        string // Optional, for example "service"
+}
+
+// Client calls the CSC API of a service.
+type Client struct {
+	config Config
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// Error is an error response of the service.
+type Error struct {
+	StatusCode  int
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *Error) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("csc: %s: %s (%d)", e.Code, e.Description, e.StatusCode)
+	}
+	return fmt.Sprintf("csc: %s (%d)", e.Code, e.StatusCode)
+}
+
+// CredentialInfo is the response of credentials/info.
+type CredentialInfo struct {
+	Description string `json:"description"`
+	Key         struct {
+		Status string   `json:"status"`
+		Algo   []string `json:"algo"`
+		Len    int      `json:"len"`
+		Curve  string   `json:"curve"`
+	} `json:"key"`
+	Cert struct {
+		Status       string   `json:"status"`
+		Certificates []string `json:"certificates"` // Base64 encoded DER, the signing certificate first
+	} `json:"cert"`
+	AuthMode string `json:"authMode"`
+	SCAL     string `json:"SCAL"`
+}
+
+// SignHashRequest is the request of signatures/signHash.
+type SignHashRequest struct {
+	CredentialID     string   `json:"credentialID"`
+	SAD              string   `json:"SAD,omitempty"`
+	Hashes           []string `json:"hashes"` // Base64 encoded
+	HashAlgorithmOID string   `json:"hashAlgorithmOID,omitempty"`
+	SignAlgo         string   `json:"signAlgo"`
+	SignAlgoParams   string   `json:"signAlgoParams,omitempty"` // Base64 encoded DER
+}
+
+// AuthorizeRequest is the request of credentials/authorize, which returns the
+// signature activation data (SAD) for explicit authorization.
+type AuthorizeRequest struct {
+	CredentialID     string   `json:"credentialID"`
+	NumSignatures    int      `json:"numSignatures"`
+	Hashes           []string `json:"hashes,omitempty"`
+	HashAlgorithmOID string   `json:"hashAlgorithmOID,omitempty"`
+	PIN              string   `json:"PIN,omitempty"`
+	OTP              string   `json:"OTP,omitempty"`
+}
+
+// NewClient returns a client of the service in config.
+func NewClient(config Config) *Client {
+	config.BaseURL = strings.TrimSuffix(config.BaseURL, "/")
+	return &Client{config: config}
+}
+
+// ListCredentials returns the credential IDs of the user (credentials/list).
+func (c *Client) ListCredentials(ctx context.Context) ([]string, error) {
+	var response struct {
+		CredentialIDs []string `json:"credentialIDs"`
+	}
+	if err := c.call(ctx, "credentials/list", struct{}{}, &response); err != nil {
+		return nil, err
+	}
+	return response.CredentialIDs, nil
+}
+
+// CredentialInfo returns the key and the certificate chain of a credential
+// (credentials/info).
+func (c *Client) CredentialInfo(ctx context.Context, credentialID string) (*CredentialInfo, error) {
+	request := struct {
+		CredentialID string `json:"credentialID"`
+		Certificates string `json:"certificates"`
+		CertInfo     bool   `json:"certInfo"`
+	}{credentialID, "chain", false}
+
+	var info CredentialInfo
+	if err := c.call(ctx, "credentials/info", request, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Authorize returns the signature activation data of a credential
+// (credentials/authorize).
+func (c *Client) Authorize(ctx context.Context, request AuthorizeRequest) (string, error) {
+	var response struct {
+		SAD string `json:"SAD"`
+	}
+	if err := c.call(ctx, "credentials/authorize", request, &response); err != nil {
+		return "", err
+	}
+	return response.SAD, nil
+}
+
+// SignHash signs the hashes of the request and returns the base64 encoded
+// signature values in the same order (signatures/signHash).
+func (c *Client) SignHash(ctx context.Context, request SignHashRequest) ([]string, error) {
+	var response struct {
+		Signatures []string `json:"signatures"`
+	}
+	if err := c.call(ctx, "signatures/signHash", request, &response); err != nil {
+		return nil, err
+	}
+	if len(response.Signatures) != len(request.Hashes) {
+		return nil, fmt.Errorf("csc: expected %d signatures, got %d", len(request.Hashes), len(response.Signatures))
+	}
+	return response.Signatures, nil
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.config.HTTPClient != nil {
+		return c.config.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// call posts the JSON request to the API method and decodes the response.
+func (c *Client) call(ctx context.Context, method string, request, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	token, err := c.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.config.BaseURL+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("csc: failed to prepare request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return c.do(req, method, response)
+}
+
+// accessToken returns the configured access token, or requests a new one
+// with the client credentials when the previous one expired.
+func (c *Client) accessToken(ctx context.Context) (string, error) {
+	if c.config.AccessToken != "" || c.config.OAuth2 == nil {
+		return c.config.AccessToken, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && time.Now().Before(c.expiry) {
+		return c.token, nil
+	}
+
+	tokenURL := c.config.OAuth2.TokenURL
+	if tokenURL == "" {
+		tokenURL = c.config.BaseURL + "/oauth2/token"
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if c.config.OAuth2.Scope != "" {
+		form.Set("scope", c.config.OAuth2.Scope)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("csc: failed to prepare token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(c.config.OAuth2.ClientID), url.QueryEscape(c.config.OAuth2.ClientSecret))
+
+	var response struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := c.do(req, "oauth2/token", &response); err != nil {
+		return "", err
+	}
+	if response.AccessToken == "" {
+		return "", fmt.Errorf("csc: token response without access token")
+	}
+
+	// Renew the token a little before it expires, a token without expiry is
+	// requested again after an hour.
+	expiresIn := time.Duration(response.ExpiresIn) * time.Second
+	if expiresIn <= 0 {
+		expiresIn = time.Hour
+	}
+	c.token = response.AccessToken
+	c.expiry = time.Now().Add(expiresIn - expiresIn/10)
+
+	return c.token, nil
+}
+
+func (c *Client) do(req *http.Request, method string, response interface{}) error {
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("csc: %s failed: %w", method, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("csc: failed to read %s response: %w", method, err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		e := &Error{StatusCode: resp.StatusCode}
+		if json.Unmarshal(body, e) != nil || e.Code == "" {
+			e.Code = http.StatusText(resp.StatusCode)
+		}
+		return e
+	}
+
+	if err := json.Unmarshal(body, response); err != nil {
+		return fmt.Errorf("csc: invalid %s response: %w", method, err)
+	}
+	return nil
+}
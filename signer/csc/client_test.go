@@ -0,0 +1,185 @@
+package csc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testService is a CSC service with a single credential.
+type testService struct {
+	*httptest.Server
+
+	key         crypto.Signer
+	certificate *x509.Certificate
+	pin         string
+	tokens      atomic.Int32
+	lastRequest SignHashRequest
+}
+
+func newTestService(t *testing.T, key crypto.Signer) *testService {
+	t.Helper()
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "pdfsign CSC test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	s := &testService{key: key, certificate: certificate}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "client" || secret != "secret" || r.FormValue("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+		s.tokens.Add(1)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "token", "token_type": "Bearer", "expires_in": 3600})
+	})
+	authorized := func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_token", "error_description": "missing access token"})
+			return false
+		}
+		return true
+	}
+	mux.HandleFunc("/credentials/list", func(w http.ResponseWriter, r *http.Request) {
+		if authorized(w, r) {
+			_ = json.NewEncoder(w).Encode(map[string][]string{"credentialIDs": {"credential"}})
+		}
+	})
+	mux.HandleFunc("/credentials/info", func(w http.ResponseWriter, r *http.Request) {
+		if authorized(w, r) {
+			var info CredentialInfo
+			info.Cert.Certificates = []string{base64.StdEncoding.EncodeToString(certificate.Raw)}
+			_ = json.NewEncoder(w).Encode(info)
+		}
+	})
+	mux.HandleFunc("/credentials/authorize", func(w http.ResponseWriter, r *http.Request) {
+		var request AuthorizeRequest
+		if !authorized(w, r) || json.NewDecoder(r.Body).Decode(&request) != nil || request.PIN != s.pin {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_pin"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"SAD": "sad"})
+	})
+	mux.HandleFunc("/signatures/signHash", func(w http.ResponseWriter, r *http.Request) {
+		var request SignHashRequest
+		if !authorized(w, r) || json.NewDecoder(r.Body).Decode(&request) != nil {
+			return
+		}
+		s.lastRequest = request
+		if s.pin != "" && request.SAD != "sad" {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_request", "error_description": "missing SAD"})
+			return
+		}
+
+		hash := crypto.SHA256
+		for h, oid := range hashOIDs {
+			if oid.String() == request.HashAlgorithmOID {
+				hash = h
+			}
+		}
+		var opts crypto.SignerOpts = hash
+		if request.SignAlgo == oidSignatureRSAPSS.String() {
+			opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: hash}
+		}
+
+		signatures := make([]string, 0, len(request.Hashes))
+		for _, encoded := range request.Hashes {
+			digest, _ := base64.StdEncoding.DecodeString(encoded)
+			signature, err := key.Sign(rand.Reader, digest, opts)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			signatures = append(signatures, base64.StdEncoding.EncodeToString(signature))
+		}
+		_ = json.NewEncoder(w).Encode(map[string][]string{"signatures": signatures})
+	})
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func TestClientOAuth2(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	service := newTestService(t, key)
+
+	client := NewClient(Config{
+		BaseURL: service.URL + "/",
+		OAuth2:  &OAuth2{ClientID: "client", ClientSecret: "secret"},
+	})
+	for i := 0; i < 2; i++ {
+		credentials, err := client.ListCredentials(context.Background())
+		if err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+		if len(credentials) != 1 || credentials[0] != "credential" {
+			t.Errorf("expected a single credential, got %v", credentials)
+		}
+	}
+	if got := service.tokens.Load(); got != 1 {
+		t.Errorf("expected the access token to be reused, requested %d tokens", got)
+	}
+
+	client = NewClient(Config{
+		BaseURL: service.URL,
+		OAuth2:  &OAuth2{ClientID: "client", ClientSecret: "wrong"},
+	})
+	_, err = client.ListCredentials(context.Background())
+	var e *Error
+	if !errors.As(err, &e) || e.Code != "invalid_client" || e.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected an invalid_client error, got %v", err)
+	}
+}
+
+func TestClientError(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	service := newTestService(t, key)
+
+	client := NewClient(Config{BaseURL: service.URL})
+	_, err = client.CredentialInfo(context.Background(), "credential")
+	var e *Error
+	if !errors.As(err, &e) || e.Code != "invalid_token" || e.Description != "missing access token" {
+		t.Errorf("expected an invalid_token error, got %v", err)
+	}
+}
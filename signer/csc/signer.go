@@ -0,0 +1,219 @@
+package csc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+var (
+	oidSignatureRSA    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidSignatureRSAPSS = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+	oidMGF1            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 8}
+)
+
+var hashOIDs = map[crypto.Hash]asn1.ObjectIdentifier{
+	crypto.SHA1:     {1, 3, 14, 3, 2, 26},
+	crypto.SHA256:   {2, 16, 840, 1, 101, 3, 4, 2, 1},
+	crypto.SHA384:   {2, 16, 840, 1, 101, 3, 4, 2, 2},
+	crypto.SHA512:   {2, 16, 840, 1, 101, 3, 4, 2, 3},
+	crypto.SHA3_256: {2, 16, 840, 1, 101, 3, 4, 2, 8},
+	crypto.SHA3_384: {2, 16, 840, 1, 101, 3, 4, 2, 9},
+	crypto.SHA3_512: {2, 16, 840, 1, 101, 3, 4, 2, 10},
+}
+
+var ecdsaOIDs = map[crypto.Hash]asn1.ObjectIdentifier{
+	crypto.SHA1:     {1, 2, 840, 10045, 4, 1},
+	crypto.SHA256:   {1, 2, 840, 10045, 4, 3, 2},
+	crypto.SHA384:   {1, 2, 840, 10045, 4, 3, 3},
+	crypto.SHA512:   {1, 2, 840, 10045, 4, 3, 4},
+	crypto.SHA3_256: {2, 16, 840, 1, 101, 3, 4, 3, 10},
+	crypto.SHA3_384: {2, 16, 840, 1, 101, 3, 4, 3, 11},
+	crypto.SHA3_512: {2, 16, 840, 1, 101, 3, 4, 3, 12},
+}
+
+// pssParameters reflects RSASSA-PSS-params, see RFC 4055, section 3.1.
+type pssParameters struct {
+	Hash         pkix.AlgorithmIdentifier `asn1:"explicit,tag:0"`
+	MGF          pkix.AlgorithmIdentifier `asn1:"explicit,tag:1"`
+	SaltLength   int                      `asn1:"explicit,tag:2"`
+	TrailerField int                      `asn1:"optional,explicit,tag:3,default:1"`
+}
+
+// Signer signs with a credential of a CSC service. It implements
+// crypto.Signer and sign.CertificateSigner.
+type Signer struct {
+	client       *Client
+	credentialID string
+	certificates []*x509.Certificate
+
+	// PIN and OTP authorize each signature with credentials/authorize, for
+	// credentials with the explicit authorization mode.
+	PIN string
+	OTP string
+}
+
+// NewSigner returns the signer of a credential, the certificate chain is
+// fetched with credentials/info.
+func (c *Client) NewSigner(ctx context.Context, credentialID string) (*Signer, error) {
+	info, err := c.CredentialInfo(ctx, credentialID)
+	if err != nil {
+		return nil, err
+	}
+	if len(info.Cert.Certificates) == 0 {
+		return nil, fmt.Errorf("csc: credential %s has no certificate", credentialID)
+	}
+
+	certificates := make([]*x509.Certificate, 0, len(info.Cert.Certificates))
+	for _, encoded := range info.Cert.Certificates {
+		der, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("csc: invalid certificate encoding: %w", err)
+		}
+		certificate, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("csc: invalid certificate: %w", err)
+		}
+		certificates = append(certificates, certificate)
+	}
+
+	return &Signer{
+		client:       c,
+		credentialID: credentialID,
+		certificates: certificates,
+	}, nil
+}
+
+// Public returns the public key of the signing certificate.
+func (s *Signer) Public() crypto.PublicKey {
+	return s.certificates[0].PublicKey
+}
+
+// CertificateChain returns the signing certificate followed by its issuers.
+func (s *Signer) CertificateChain() ([]*x509.Certificate, error) {
+	return s.certificates, nil
+}
+
+// Sign signs the digest with signatures/signHash. The signature algorithm
+// follows the key, *rsa.PSSOptions select RSASSA-PSS.
+func (s *Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	hash := opts.HashFunc()
+	hashOID, ok := hashOIDs[hash]
+	if !ok {
+		return nil, fmt.Errorf("csc: unsupported digest algorithm %s", hash)
+	}
+	if len(digest) != hash.Size() {
+		return nil, errors.New("csc: digest length does not match the digest algorithm")
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(digest)
+	request := SignHashRequest{
+		CredentialID:     s.credentialID,
+		Hashes:           []string{encoded},
+		HashAlgorithmOID: hashOID.String(),
+	}
+
+	switch s.Public().(type) {
+	case *rsa.PublicKey:
+		if pss, ok := opts.(*rsa.PSSOptions); ok {
+			params, err := pssAlgorithmParameters(hash, pss.SaltLength)
+			if err != nil {
+				return nil, err
+			}
+			request.SignAlgo = oidSignatureRSAPSS.String()
+			request.SignAlgoParams = base64.StdEncoding.EncodeToString(params)
+		} else {
+			request.SignAlgo = oidSignatureRSA.String()
+		}
+	case *ecdsa.PublicKey:
+		oid, ok := ecdsaOIDs[hash]
+		if !ok {
+			return nil, fmt.Errorf("csc: unsupported digest algorithm %s for ECDSA", hash)
+		}
+		request.SignAlgo = oid.String()
+	default:
+		return nil, fmt.Errorf("csc: unsupported key type %T", s.Public())
+	}
+
+	ctx := context.Background()
+	if s.PIN != "" || s.OTP != "" {
+		sad, err := s.client.Authorize(ctx, AuthorizeRequest{
+			CredentialID:     s.credentialID,
+			NumSignatures:    1,
+			Hashes:           request.Hashes,
+			HashAlgorithmOID: request.HashAlgorithmOID,
+			PIN:              s.PIN,
+			OTP:              s.OTP,
+		})
+		if err != nil {
+			return nil, err
+		}
+		request.SAD = sad
+	}
+
+	signatures, err := s.client.SignHash(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.StdEncoding.DecodeString(signatures[0])
+	if err != nil {
+		return nil, fmt.Errorf("csc: invalid signature encoding: %w", err)
+	}
+
+	if key, ok := s.Public().(*ecdsa.PublicKey); ok {
+		return ecdsaSignature(key, signature), nil
+	}
+	return signature, nil
+}
+
+// pssAlgorithmParameters returns the DER encoded RSASSA-PSS parameters with
+// MGF1 of the same hash.
+func pssAlgorithmParameters(hash crypto.Hash, saltLength int) ([]byte, error) {
+	if saltLength == rsa.PSSSaltLengthEqualsHash || saltLength == rsa.PSSSaltLengthAuto {
+		saltLength = hash.Size()
+	}
+
+	hashAlgorithm := pkix.AlgorithmIdentifier{Algorithm: hashOIDs[hash], Parameters: asn1.NullRawValue}
+	mgf, err := asn1.Marshal(hashAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(pssParameters{
+		Hash:         hashAlgorithm,
+		MGF:          pkix.AlgorithmIdentifier{Algorithm: oidMGF1, Parameters: asn1.RawValue{FullBytes: mgf}},
+		SaltLength:   saltLength,
+		TrailerField: 1,
+	})
+}
+
+// ecdsaSignature returns the ASN.1 encoding of an ECDSA signature. Some
+// services return the concatenation of r and s instead (IEEE P1363).
+func ecdsaSignature(key *ecdsa.PublicKey, signature []byte) []byte {
+	var value struct{ R, S *big.Int }
+	if rest, err := asn1.Unmarshal(signature, &value); err == nil && len(rest) == 0 {
+		return signature
+	}
+
+	size := (key.Curve.Params().BitSize + 7) / 8
+	if len(signature) != 2*size {
+		return signature
+	}
+
+	der, err := asn1.Marshal(struct{ R, S *big.Int }{
+		R: new(big.Int).SetBytes(signature[:size]),
+		S: new(big.Int).SetBytes(signature[size:]),
+	})
+	if err != nil {
+		return signature
+	}
+	return der
+}
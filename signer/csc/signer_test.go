@@ -0,0 +1,122 @@
+package csc
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/sign"
+	"github.com/digitorus/pdfsign/verify"
+)
+
+func TestSignerSignPDF(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	tests := []struct {
+		name      string
+		key       crypto.Signer
+		algorithm sign.SignatureAlgorithm
+		pin       string
+		signAlgo  string
+	}{
+		{name: "rsa", key: rsaKey, signAlgo: "1.2.840.113549.1.1.1"},
+		{name: "rsa-pss", key: rsaKey, algorithm: sign.RSAPSS, signAlgo: "1.2.840.113549.1.1.10"},
+		{name: "ecdsa", key: ecdsaKey, signAlgo: "1.2.840.10045.4.3.2"},
+		{name: "explicit authorization", key: ecdsaKey, pin: "1234", signAlgo: "1.2.840.10045.4.3.2"},
+	}
+
+	input, err := os.ReadFile("../../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := newTestService(t, tt.key)
+			service.pin = tt.pin
+
+			client := NewClient(Config{BaseURL: service.URL, AccessToken: "token"})
+			signer, err := client.NewSigner(context.Background(), "credential")
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			signer.PIN = tt.pin
+
+			rdr, err := pdf.NewReader(bytes.NewReader(input), int64(len(input)))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			var output bytes.Buffer
+			err = sign.Sign(bytes.NewReader(input), &output, rdr, int64(len(input)), sign.SignData{
+				Signature: sign.SignDataSignature{
+					Info: sign.SignDataSignatureInfo{
+						Name: "John Doe",
+						Date: time.Now().Local(),
+					},
+					CertType: sign.ApprovalSignature,
+				},
+				Signer:             signer,
+				DigestAlgorithm:    crypto.SHA256,
+				SignatureAlgorithm: tt.algorithm,
+			})
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if service.lastRequest.SignAlgo != tt.signAlgo {
+				t.Errorf("expected signAlgo %s, got %s", tt.signAlgo, service.lastRequest.SignAlgo)
+			}
+
+			info, err := verify.Verify(bytes.NewReader(output.Bytes()), int64(output.Len()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if len(info.Signers) != 1 || !info.Signers[0].ValidSignature {
+				t.Errorf("expected a single valid signature")
+			}
+		})
+	}
+}
+
+func TestECDSASignature(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	digest := sha256.Sum256([]byte("pdfsign"))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	raw := make([]byte, 64)
+	r.FillBytes(raw[:32])
+	s.FillBytes(raw[32:])
+	if !ecdsa.VerifyASN1(&key.PublicKey, digest[:], ecdsaSignature(&key.PublicKey, raw)) {
+		t.Errorf("expected the IEEE P1363 signature to be converted")
+	}
+
+	der, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if got := ecdsaSignature(&key.PublicKey, der); !bytes.Equal(got, der) {
+		t.Errorf("expected the ASN.1 signature to be unchanged")
+	}
+}
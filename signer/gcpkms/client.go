@@ -0,0 +1,329 @@
+// Package gcpkms implements a signer for asymmetric Google Cloud KMS keys,
+// including Cloud HSM keys, with the REST API of Cloud KMS. The Google Cloud
+// client libraries are not required.
+package gcpkms
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config holds the settings of the Cloud KMS API.
+type Config struct {
+	Endpoint       string          // Defaults to https://cloudkms.googleapis.com/v1
+	AccessToken    string          // OAuth2 access token, e.g. of "gcloud auth print-access-token"
+	ServiceAccount *ServiceAccount // Service account to request access tokens with, used when AccessToken is empty
+	HTTPClient     *http.Client    // Defaults to http.DefaultClient
+}
+
+// ServiceAccount holds the service account key to request access tokens with
+// the JWT bearer grant (RFC 7523).
+type ServiceAccount struct {
+	ClientEmail  string
+	PrivateKeyID string
+	PrivateKey   crypto.Signer // RSA key of the service account
+	TokenURI     string        // Defaults to https://oauth2.googleapis.com/token
+}
+
+// ParseServiceAccount parses a JSON service account key file.
+func ParseServiceAccount(data []byte) (*ServiceAccount, error) {
+	var file struct {
+		Type         string `json:"type"`
+		ClientEmail  string `json:"client_email"`
+		PrivateKeyID string `json:"private_key_id"`
+		PrivateKey   string `json:"private_key"`
+		TokenURI     string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("gcpkms: invalid service account key: %w", err)
+	}
+	if file.Type != "service_account" {
+		return nil, fmt.Errorf("gcpkms: unsupported credentials type %q", file.Type)
+	}
+
+	block, _ := pem.Decode([]byte(file.PrivateKey))
+	if block == nil {
+		return nil, errors.New("gcpkms: service account key without private key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("gcpkms: invalid service account private key: %w", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("gcpkms: unsupported service account private key")
+	}
+
+	return &ServiceAccount{
+		ClientEmail:  file.ClientEmail,
+		PrivateKeyID: file.PrivateKeyID,
+		PrivateKey:   signer,
+		TokenURI:     file.TokenURI,
+	}, nil
+}
+
+// Client calls the Cloud KMS API.
+type Client struct {
+	config Config
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// Error is an error response of the API.
+type Error struct {
+	StatusCode int
+	Status     string `json:"status"`
+	Message    string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("gcpkms: %s: %s (%d)", e.Status, e.Message, e.StatusCode)
+	}
+	return fmt.Sprintf("gcpkms: %s (%d)", e.Status, e.StatusCode)
+}
+
+// PublicKey is the public key of a CryptoKeyVersion.
+type PublicKey struct {
+	Name            string `json:"name"`
+	PEM             string `json:"pem"`
+	PEMCRC32C       int64  `json:"pemCrc32c,string"`
+	Algorithm       string `json:"algorithm"` // CryptoKeyVersionAlgorithm, e.g. EC_SIGN_P256_SHA256
+	ProtectionLevel string `json:"protectionLevel"`
+}
+
+// NewClient returns a client of the Cloud KMS API.
+func NewClient(config Config) *Client {
+	if config.Endpoint == "" {
+		config.Endpoint = "https://cloudkms.googleapis.com/v1"
+	}
+	config.Endpoint = strings.TrimSuffix(config.Endpoint, "/")
+	return &Client{config: config}
+}
+
+// GetPublicKey returns the public key and the algorithm of a CryptoKeyVersion,
+// name is its resource name:
+// projects/*/locations/*/keyRings/*/cryptoKeys/*/cryptoKeyVersions/*.
+func (c *Client) GetPublicKey(ctx context.Context, name string) (*PublicKey, error) {
+	var response PublicKey
+	if err := c.call(ctx, http.MethodGet, name+"/publicKey", nil, &response); err != nil {
+		return nil, err
+	}
+	if crc32c(response.PEM) != response.PEMCRC32C {
+		return nil, errors.New("gcpkms: public key checksum mismatch")
+	}
+	return &response, nil
+}
+
+// AsymmetricSign signs the digest with a CryptoKeyVersion, the digest
+// algorithm must be the one of the key's algorithm.
+func (c *Client) AsymmetricSign(ctx context.Context, name string, hash crypto.Hash, digest []byte) ([]byte, error) {
+	var field string
+	switch hash {
+	case crypto.SHA256:
+		field = "sha256"
+	case crypto.SHA384:
+		field = "sha384"
+	case crypto.SHA512:
+		field = "sha512"
+	default:
+		return nil, fmt.Errorf("gcpkms: unsupported digest algorithm %s", hash)
+	}
+
+	request := struct {
+		Digest       map[string][]byte `json:"digest"`
+		DigestCRC32C int64             `json:"digestCrc32c,string"`
+	}{map[string][]byte{field: digest}, crc32c(string(digest))}
+
+	var response struct {
+		Signature            []byte `json:"signature"`
+		SignatureCRC32C      int64  `json:"signatureCrc32c,string"`
+		VerifiedDigestCRC32C bool   `json:"verifiedDigestCrc32c"`
+	}
+	if err := c.call(ctx, http.MethodPost, name+":asymmetricSign", request, &response); err != nil {
+		return nil, err
+	}
+	// The checksums detect corruption of the digest and the signature in
+	// transit.
+	if !response.VerifiedDigestCRC32C {
+		return nil, errors.New("gcpkms: digest checksum was not verified")
+	}
+	if crc32c(string(response.Signature)) != response.SignatureCRC32C {
+		return nil, errors.New("gcpkms: signature checksum mismatch")
+	}
+	return response.Signature, nil
+}
+
+func crc32c(data string) int64 {
+	return int64(crc32.Checksum([]byte(data), crc32.MakeTable(crc32.Castagnoli)))
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.config.HTTPClient != nil {
+		return c.config.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// call sends the JSON request to the API path and decodes the response.
+func (c *Client) call(ctx context.Context, method, path string, request, response interface{}) error {
+	var body io.Reader
+	if request != nil {
+		data, err := json.Marshal(request)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	token, err := c.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.config.Endpoint+"/"+strings.TrimPrefix(path, "/"), body)
+	if err != nil {
+		return fmt.Errorf("gcpkms: failed to prepare request: %w", err)
+	}
+	if request != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return c.do(req, path, response)
+}
+
+// accessToken returns the configured access token, or requests a new one
+// for the service account when the previous one expired.
+func (c *Client) accessToken(ctx context.Context) (string, error) {
+	if c.config.AccessToken != "" || c.config.ServiceAccount == nil {
+		return c.config.AccessToken, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && time.Now().Before(c.expiry) {
+		return c.token, nil
+	}
+
+	account := c.config.ServiceAccount
+	tokenURI := account.TokenURI
+	if tokenURI == "" {
+		tokenURI = "https://oauth2.googleapis.com/token"
+	}
+
+	assertion, err := jwtAssertion(account, tokenURI, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("gcpkms: failed to prepare token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var response struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := c.do(req, "token", &response); err != nil {
+		return "", err
+	}
+	if response.AccessToken == "" {
+		return "", errors.New("gcpkms: token response without access token")
+	}
+
+	// Renew the token a little before it expires.
+	expiresIn := time.Duration(response.ExpiresIn) * time.Second
+	if expiresIn <= 0 {
+		expiresIn = time.Hour
+	}
+	c.token = response.AccessToken
+	c.expiry = time.Now().Add(expiresIn - expiresIn/10)
+
+	return c.token, nil
+}
+
+// jwtAssertion returns the RS256 signed JWT of the service account for the
+// cloudkms scope.
+func jwtAssertion(account *ServiceAccount, audience string, now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": account.PrivateKeyID})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   account.ClientEmail,
+		"scope": "https://www.googleapis.com/auth/cloudkms",
+		"aud":   audience,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := account.PrivateKey.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return "", fmt.Errorf("gcpkms: failed to sign token request: %w", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func (c *Client) do(req *http.Request, method string, response interface{}) error {
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("gcpkms: %s failed: %w", method, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("gcpkms: failed to read %s response: %w", method, err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var e struct {
+			Error *Error `json:"error"`
+		}
+		if json.Unmarshal(body, &e) != nil || e.Error == nil {
+			e.Error = &Error{Status: http.StatusText(resp.StatusCode)}
+		}
+		e.Error.StatusCode = resp.StatusCode
+		return e.Error
+	}
+
+	if err := json.Unmarshal(body, response); err != nil {
+		return fmt.Errorf("gcpkms: invalid %s response: %w", method, err)
+	}
+	return nil
+}
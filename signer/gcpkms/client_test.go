@@ -0,0 +1,213 @@
+package gcpkms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdfsign/sign"
+)
+
+const testKeyName = "projects/pdfsign/locations/europe-west1/keyRings/signing/cryptoKeys/pdf/cryptoKeyVersions/1"
+
+// testService is a Cloud KMS API with a single key version.
+type testService struct {
+	*httptest.Server
+	key         crypto.Signer
+	algorithm   string
+	certificate *x509.Certificate
+	account     *rsa.PrivateKey
+	tokens      atomic.Int32
+	signs       atomic.Int32
+}
+
+func newTestService(t *testing.T, key crypto.Signer, algorithm string) *testService {
+	t.Helper()
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "pdfsign Cloud KMS test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	public, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	publicPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public}))
+
+	account, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	s := &testService{key: key, algorithm: algorithm, certificate: certificate, account: account}
+
+	fail := func(w http.ResponseWriter, status int, code, message string) {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": map[string]interface{}{"code": status, "status": code, "message": message},
+		})
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(r.FormValue("assertion"), ".")
+		if r.FormValue("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" || len(parts) != 3 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if rsa.VerifyPKCS1v15(&account.PublicKey, crypto.SHA256, digest[:], signature) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		s.tokens.Add(1)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "token", "expires_in": 3600})
+	})
+	mux.HandleFunc("/v1/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			fail(w, http.StatusUnauthorized, "UNAUTHENTICATED", "Request had invalid authentication credentials.")
+			return
+		}
+
+		path := strings.TrimPrefix(r.URL.Path, "/v1/")
+		switch {
+		case r.Method == http.MethodGet && path == testKeyName+"/publicKey":
+			_ = json.NewEncoder(w).Encode(map[string]string{
+				"name":            testKeyName,
+				"pem":             publicPEM,
+				"pemCrc32c":       big.NewInt(crc32c(publicPEM)).String(),
+				"algorithm":       s.algorithm,
+				"protectionLevel": "HSM",
+			})
+		case r.Method == http.MethodPost && path == testKeyName+":asymmetricSign":
+			var request struct {
+				Digest       map[string][]byte `json:"digest"`
+				DigestCRC32C int64             `json:"digestCrc32c,string"`
+			}
+			if json.NewDecoder(r.Body).Decode(&request) != nil || len(request.Digest) != 1 {
+				fail(w, http.StatusBadRequest, "INVALID_ARGUMENT", "invalid digest")
+				return
+			}
+			s.signs.Add(1)
+
+			hash, algorithm := algorithms[s.algorithm].hash, algorithms[s.algorithm].algorithm
+			digest := request.Digest[strings.ToLower(strings.ReplaceAll(hash.String(), "-", ""))]
+			if digest == nil || crc32c(string(digest)) != request.DigestCRC32C {
+				fail(w, http.StatusBadRequest, "INVALID_ARGUMENT", "digest does not match the key algorithm")
+				return
+			}
+			var opts crypto.SignerOpts = hash
+			if algorithm == sign.RSAPSS {
+				opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: hash}
+			}
+			signature, err := key.Sign(rand.Reader, digest, opts)
+			if err != nil {
+				fail(w, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"signature":            signature,
+				"signatureCrc32c":      big.NewInt(crc32c(string(signature))).String(),
+				"verifiedDigestCrc32c": true,
+				"name":                 testKeyName,
+			})
+		default:
+			fail(w, http.StatusNotFound, "NOT_FOUND", "CryptoKeyVersion "+path+" not found.")
+		}
+	})
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func TestClientServiceAccount(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	service := newTestService(t, key, "EC_SIGN_P256_SHA256")
+
+	der, err := x509.MarshalPKCS8PrivateKey(service.account)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	file, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"client_email":   "pdfsign@pdfsign.iam.gserviceaccount.com",
+		"private_key_id": "1",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":      service.URL + "/token",
+	})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	account, err := ParseServiceAccount(file)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	client := NewClient(Config{Endpoint: service.URL + "/v1", ServiceAccount: account})
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetPublicKey(context.Background(), testKeyName); err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+	}
+	if n := service.tokens.Load(); n != 1 {
+		t.Errorf("expected the access token to be reused, requested %d tokens", n)
+	}
+
+	if _, err := ParseServiceAccount([]byte(`{"type":"authorized_user"}`)); err == nil {
+		t.Errorf("expected an error for user credentials")
+	}
+}
+
+func TestClientError(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	service := newTestService(t, key, "EC_SIGN_P256_SHA256")
+
+	var e *Error
+	_, err = NewClient(Config{Endpoint: service.URL + "/v1", AccessToken: "token"}).GetPublicKey(context.Background(), "projects/missing")
+	if !errors.As(err, &e) || e.StatusCode != http.StatusNotFound || e.Status != "NOT_FOUND" {
+		t.Fatalf("expected a NOT_FOUND error, got %v", err)
+	}
+
+	_, err = NewClient(Config{Endpoint: service.URL + "/v1"}).GetPublicKey(context.Background(), testKeyName)
+	if !errors.As(err, &e) || e.Status != "UNAUTHENTICATED" {
+		t.Fatalf("expected an UNAUTHENTICATED error, got %v", err)
+	}
+}
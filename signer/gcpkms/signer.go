@@ -0,0 +1,129 @@
+package gcpkms
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/digitorus/pdfsign/sign"
+)
+
+// algorithms maps the CryptoKeyVersionAlgorithms of asymmetric signing keys
+// to their digest algorithm and the signature algorithm of the CMS
+// SignerInfo. A key version only signs with its own algorithm.
+var algorithms = map[string]struct {
+	hash      crypto.Hash
+	algorithm sign.SignatureAlgorithm
+}{
+	"RSA_SIGN_PSS_2048_SHA256":   {crypto.SHA256, sign.RSAPSS},
+	"RSA_SIGN_PSS_3072_SHA256":   {crypto.SHA256, sign.RSAPSS},
+	"RSA_SIGN_PSS_4096_SHA256":   {crypto.SHA256, sign.RSAPSS},
+	"RSA_SIGN_PSS_4096_SHA512":   {crypto.SHA512, sign.RSAPSS},
+	"RSA_SIGN_PKCS1_2048_SHA256": {crypto.SHA256, sign.RSAPKCS1v15},
+	"RSA_SIGN_PKCS1_3072_SHA256": {crypto.SHA256, sign.RSAPKCS1v15},
+	"RSA_SIGN_PKCS1_4096_SHA256": {crypto.SHA256, sign.RSAPKCS1v15},
+	"RSA_SIGN_PKCS1_4096_SHA512": {crypto.SHA512, sign.RSAPKCS1v15},
+	"EC_SIGN_P256_SHA256":        {crypto.SHA256, sign.ECDSA},
+	"EC_SIGN_P384_SHA384":        {crypto.SHA384, sign.ECDSA},
+}
+
+// Signer signs with an asymmetric CryptoKeyVersion. It implements
+// crypto.Signer, sign.CertificateSigner and sign.AlgorithmSigner, so the
+// digest and signature algorithm of the key are used by default.
+type Signer struct {
+	client    *Client
+	name      string
+	public    crypto.PublicKey
+	algorithm string
+	chain     []*x509.Certificate
+}
+
+// NewSigner returns the signer of a CryptoKeyVersion, name is its resource
+// name. Cloud KMS does not store certificates, chain is the certificate of
+// the key followed by its issuers.
+func (c *Client) NewSigner(ctx context.Context, name string, chain []*x509.Certificate) (*Signer, error) {
+	if len(chain) == 0 {
+		return nil, errors.New("gcpkms: certificate chain is required")
+	}
+
+	key, err := c.GetPublicKey(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := algorithms[key.Algorithm]; !ok {
+		return nil, fmt.Errorf("gcpkms: unsupported key algorithm %s", key.Algorithm)
+	}
+
+	block, _ := pem.Decode([]byte(key.PEM))
+	if block == nil {
+		return nil, errors.New("gcpkms: invalid public key encoding")
+	}
+	public, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("gcpkms: unsupported public key: %w", err)
+	}
+	certified, ok := chain[0].PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !certified.Equal(public) {
+		return nil, fmt.Errorf("gcpkms: certificate does not match key %s", name)
+	}
+
+	return &Signer{
+		client:    c,
+		name:      name,
+		public:    public,
+		algorithm: key.Algorithm,
+		chain:     chain,
+	}, nil
+}
+
+// Public returns the public key of the key version.
+func (s *Signer) Public() crypto.PublicKey {
+	return s.public
+}
+
+// CertificateChain returns the signing certificate followed by its issuers.
+func (s *Signer) CertificateChain() ([]*x509.Certificate, error) {
+	return s.chain, nil
+}
+
+// Algorithm returns the CryptoKeyVersionAlgorithm of the key version.
+func (s *Signer) Algorithm() string {
+	return s.algorithm
+}
+
+// SignatureAlgorithm returns the digest and signature algorithm of the key
+// version.
+func (s *Signer) SignatureAlgorithm() (crypto.Hash, sign.SignatureAlgorithm) {
+	a := algorithms[s.algorithm]
+	return a.hash, a.algorithm
+}
+
+// Sign signs the digest with asymmetricSign. The digest algorithm, and
+// whether opts are *rsa.PSSOptions, must match the algorithm of the key.
+func (s *Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	hash, algorithm := s.SignatureAlgorithm()
+	if opts.HashFunc() != hash {
+		return nil, fmt.Errorf("gcpkms: key %s requires digest algorithm %s, not %s", s.algorithm, hash, opts.HashFunc())
+	}
+	if len(digest) != hash.Size() {
+		return nil, errors.New("gcpkms: digest length does not match the digest algorithm")
+	}
+
+	pss, isPSS := opts.(*rsa.PSSOptions)
+	switch {
+	case algorithm == sign.RSAPSS && !isPSS:
+		return nil, fmt.Errorf("gcpkms: key %s requires RSASSA-PSS", s.algorithm)
+	case algorithm != sign.RSAPSS && isPSS:
+		return nil, fmt.Errorf("gcpkms: key %s does not support RSASSA-PSS", s.algorithm)
+	case isPSS && pss.SaltLength != rsa.PSSSaltLengthEqualsHash && pss.SaltLength != rsa.PSSSaltLengthAuto && pss.SaltLength != hash.Size():
+		return nil, errors.New("gcpkms: RSASSA-PSS requires a salt length equal to the digest length")
+	}
+
+	// ECDSA signatures of Cloud KMS are ASN.1 encoded already.
+	return s.client.AsymmetricSign(context.Background(), s.name, hash, digest)
+}
@@ -0,0 +1,123 @@
+package gcpkms
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/sign"
+	"github.com/digitorus/pdfsign/verify"
+)
+
+func TestSignerSignPDF(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	tests := []struct {
+		name      string
+		key       crypto.Signer
+		algorithm string
+	}{
+		{name: "rsa", key: rsaKey, algorithm: "RSA_SIGN_PKCS1_2048_SHA256"},
+		{name: "rsa-pss", key: rsaKey, algorithm: "RSA_SIGN_PSS_2048_SHA256"},
+		{name: "ecdsa", key: ecdsaKey, algorithm: "EC_SIGN_P384_SHA384"},
+	}
+
+	input, err := os.ReadFile("../../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := newTestService(t, tt.key, tt.algorithm)
+			client := NewClient(Config{Endpoint: service.URL + "/v1", AccessToken: "token"})
+			signer, err := client.NewSigner(context.Background(), testKeyName, []*x509.Certificate{service.certificate})
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			rdr, err := pdf.NewReader(bytes.NewReader(input), int64(len(input)))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			// The digest and signature algorithm follow the key version.
+			var output bytes.Buffer
+			err = sign.Sign(bytes.NewReader(input), &output, rdr, int64(len(input)), sign.SignData{
+				Signature: sign.SignDataSignature{
+					Info: sign.SignDataSignatureInfo{
+						Name: "John Doe",
+						Date: time.Now().Local(),
+					},
+					CertType: sign.ApprovalSignature,
+				},
+				Signer: signer,
+			})
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if service.signs.Load() != 1 {
+				t.Errorf("expected a single asymmetricSign request, got %d", service.signs.Load())
+			}
+
+			info, err := verify.Verify(bytes.NewReader(output.Bytes()), int64(output.Len()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if len(info.Signers) != 1 || !info.Signers[0].ValidSignature {
+				t.Errorf("expected a single valid signature")
+			}
+		})
+	}
+}
+
+func TestSignerAlgorithm(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	service := newTestService(t, key, "RSA_SIGN_PSS_4096_SHA512")
+	client := NewClient(Config{Endpoint: service.URL + "/v1", AccessToken: "token"})
+
+	signer, err := client.NewSigner(context.Background(), testKeyName, []*x509.Certificate{service.certificate})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if hash, algorithm := signer.SignatureAlgorithm(); hash != crypto.SHA512 || algorithm != sign.RSAPSS {
+		t.Errorf("unexpected algorithm %s %s", hash, algorithm)
+	}
+
+	digest := sha256.Sum256([]byte("pdfsign"))
+	if _, err := signer.Sign(rand.Reader, digest[:], &rsa.PSSOptions{Hash: crypto.SHA256}); err == nil {
+		t.Errorf("expected an error for the digest algorithm of another key")
+	}
+	digest512 := make([]byte, 64)
+	if _, err := signer.Sign(rand.Reader, digest512, crypto.SHA512); err == nil {
+		t.Errorf("expected an error for PKCS #1 v1.5 with a PSS key")
+	}
+	if _, err := signer.Sign(rand.Reader, digest512, &rsa.PSSOptions{Hash: crypto.SHA512}); err != nil {
+		t.Errorf("%s", err.Error())
+	}
+
+	service.algorithm = "RSA_DECRYPT_OAEP_2048_SHA256"
+	if _, err := client.NewSigner(context.Background(), testKeyName, []*x509.Certificate{service.certificate}); err == nil {
+		t.Errorf("expected an error for a decryption key")
+	}
+}
@@ -0,0 +1,164 @@
+// Package keychain implements a signer for identities in the macOS Keychain,
+// such as certificates enrolled through MDM. Signatures are created by the
+// Security framework, which requires cgo, and the private key never leaves
+// the Keychain.
+package keychain
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config selects the identity.
+type Config struct {
+	Thumbprint string              // SHA-1 thumbprint of the certificate in hex, or
+	Subject    string              // Part of the subject of the certificate, case insensitive, used when Thumbprint is empty
+	Chain      []*x509.Certificate // Signing certificate followed by its issuers, defaults to the chain built by the Security framework
+}
+
+// Signature schemes of SecKeyCreateSignature.
+const (
+	schemePKCS1v15 = iota + 1
+	schemePSS
+	schemeECDSA
+)
+
+// key is the part of a SecKeyRef that the signer uses.
+type key interface {
+	sign(scheme int, hash crypto.Hash, digest []byte) ([]byte, error)
+	close() error
+}
+
+// Signer signs with the private key of a Keychain identity. It implements
+// crypto.Signer and sign.CertificateSigner.
+type Signer struct {
+	mu    sync.Mutex
+	key   key
+	chain []*x509.Certificate
+}
+
+// Open finds the identity and returns its signer. The first identity that
+// matches and is valid now is used. macOS may ask the user to allow access
+// to the key. Close the signer to release the key.
+func Open(config Config) (*Signer, error) {
+	var thumbprint []byte
+	if config.Thumbprint != "" {
+		var err error
+		if thumbprint, err = parseThumbprint(config.Thumbprint); err != nil {
+			return nil, err
+		}
+	} else if config.Subject == "" {
+		return nil, errors.New("keychain: certificate thumbprint or subject is required")
+	}
+
+	now := time.Now()
+	k, chain, err := openIdentity(func(certificate *x509.Certificate) bool {
+		return matches(certificate, thumbprint, config.Subject, now)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(config.Chain) > 0 {
+		chain = config.Chain
+	}
+	s, err := newSigner(k, chain)
+	if err != nil {
+		_ = k.close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func newSigner(k key, chain []*x509.Certificate) (*Signer, error) {
+	if len(chain) == 0 {
+		return nil, errors.New("keychain: certificate chain is empty")
+	}
+	switch chain[0].PublicKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return nil, fmt.Errorf("keychain: unsupported public key type %T", chain[0].PublicKey)
+	}
+	return &Signer{key: k, chain: chain}, nil
+}
+
+// matches reports whether the certificate has the thumbprint, or a subject
+// that contains subject, and is valid at now.
+func matches(certificate *x509.Certificate, thumbprint []byte, subject string, now time.Time) bool {
+	if now.Before(certificate.NotBefore) || now.After(certificate.NotAfter) {
+		return false
+	}
+	if thumbprint != nil {
+		sum := sha1.Sum(certificate.Raw)
+		return string(sum[:]) == string(thumbprint)
+	}
+	return strings.Contains(strings.ToLower(certificate.Subject.String()), strings.ToLower(subject))
+}
+
+// parseThumbprint decodes a hex thumbprint, spaces and colons are ignored.
+func parseThumbprint(s string) ([]byte, error) {
+	s = strings.NewReplacer(" ", "", ":", "").Replace(s)
+	thumbprint, err := hex.DecodeString(s)
+	if err != nil || len(thumbprint) != sha1.Size {
+		return nil, fmt.Errorf("keychain: invalid SHA-1 thumbprint %q", s)
+	}
+	return thumbprint, nil
+}
+
+// Public returns the public key of the signing certificate.
+func (s *Signer) Public() crypto.PublicKey {
+	return s.chain[0].PublicKey
+}
+
+// CertificateChain returns the signing certificate followed by its issuers.
+func (s *Signer) CertificateChain() ([]*x509.Certificate, error) {
+	return s.chain, nil
+}
+
+// Sign signs the digest with PKCS #1 v1.5, PSS for *rsa.PSSOptions, or
+// ECDSA. The Security framework only creates PSS signatures with a salt as
+// long as the digest.
+func (s *Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	hash := opts.HashFunc()
+	switch hash {
+	case crypto.SHA1, crypto.SHA256, crypto.SHA384, crypto.SHA512:
+	default:
+		return nil, fmt.Errorf("keychain: unsupported digest algorithm %s", hash)
+	}
+	if len(digest) != hash.Size() {
+		return nil, errors.New("keychain: digest length does not match the digest algorithm")
+	}
+
+	scheme := schemePKCS1v15
+	switch s.Public().(type) {
+	case *rsa.PublicKey:
+		if pss, ok := opts.(*rsa.PSSOptions); ok {
+			if pss.SaltLength != rsa.PSSSaltLengthEqualsHash && pss.SaltLength != rsa.PSSSaltLengthAuto && pss.SaltLength != hash.Size() {
+				return nil, errors.New("keychain: RSASSA-PSS requires a salt length equal to the digest length")
+			}
+			scheme = schemePSS
+		}
+	case *ecdsa.PublicKey:
+		scheme = schemeECDSA
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.key.sign(scheme, hash, digest)
+}
+
+// Close releases the private key.
+func (s *Signer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.key.close()
+}
@@ -0,0 +1,232 @@
+//go:build darwin && cgo
+
+package keychain
+
+/*
+#cgo CFLAGS: -Wno-deprecated-declarations
+#cgo LDFLAGS: -framework CoreFoundation -framework Security
+
+#include <CoreFoundation/CoreFoundation.h>
+#include <Security/Security.h>
+#include <stdlib.h>
+
+// copy_identities returns the identities of the keychain search list.
+static CFArrayRef copy_identities(OSStatus *status) {
+	const void *keys[] = {kSecClass, kSecMatchLimit, kSecReturnRef};
+	const void *values[] = {kSecClassIdentity, kSecMatchLimitAll, kCFBooleanTrue};
+	CFDictionaryRef query = CFDictionaryCreate(NULL, keys, values, 3,
+		&kCFTypeDictionaryKeyCallBacks, &kCFTypeDictionaryValueCallBacks);
+	CFTypeRef result = NULL;
+	*status = SecItemCopyMatching(query, &result);
+	CFRelease(query);
+	return (CFArrayRef)result;
+}
+
+static SecIdentityRef identity_at(CFArrayRef identities, CFIndex i) {
+	return (SecIdentityRef)CFArrayGetValueAtIndex(identities, i);
+}
+
+static CFDataRef copy_certificate(CFArrayRef identities, CFIndex i) {
+	SecCertificateRef certificate = NULL;
+	if (SecIdentityCopyCertificate(identity_at(identities, i), &certificate) != errSecSuccess) {
+		return NULL;
+	}
+	CFDataRef der = SecCertificateCopyData(certificate);
+	CFRelease(certificate);
+	return der;
+}
+
+static SecKeyRef copy_key(CFArrayRef identities, CFIndex i, OSStatus *status) {
+	SecKeyRef key = NULL;
+	*status = SecIdentityCopyPrivateKey(identity_at(identities, i), &key);
+	return key;
+}
+
+// copy_chain returns the DER encoded certificates of the chain that the
+// trust settings build for the identity, or only its certificate.
+static CFArrayRef copy_chain(CFArrayRef identities, CFIndex i) {
+	SecCertificateRef certificate = NULL;
+	if (SecIdentityCopyCertificate(identity_at(identities, i), &certificate) != errSecSuccess) {
+		return NULL;
+	}
+
+	CFMutableArrayRef chain = CFArrayCreateMutable(NULL, 0, &kCFTypeArrayCallBacks);
+	SecPolicyRef policy = SecPolicyCreateBasicX509();
+	SecTrustRef trust = NULL;
+	if (SecTrustCreateWithCertificates(certificate, policy, &trust) == errSecSuccess) {
+		// The chain is built even if it is not trusted.
+		SecTrustEvaluateWithError(trust, NULL);
+		CFIndex count = SecTrustGetCertificateCount(trust);
+		for (CFIndex j = 0; j < count; j++) {
+			CFDataRef der = SecCertificateCopyData(SecTrustGetCertificateAtIndex(trust, j));
+			CFArrayAppendValue(chain, der);
+			CFRelease(der);
+		}
+		CFRelease(trust);
+	}
+	CFRelease(policy);
+
+	if (CFArrayGetCount(chain) == 0) {
+		CFDataRef der = SecCertificateCopyData(certificate);
+		CFArrayAppendValue(chain, der);
+		CFRelease(der);
+	}
+	CFRelease(certificate);
+	return chain;
+}
+
+static CFDataRef data_at(CFArrayRef array, CFIndex i) {
+	return (CFDataRef)CFArrayGetValueAtIndex(array, i);
+}
+
+// algorithm returns the SecKeyAlgorithm of a scheme and a digest size.
+static SecKeyAlgorithm algorithm(int scheme, int size) {
+	switch (scheme) {
+	case 1:
+		switch (size) {
+		case 20: return kSecKeyAlgorithmRSASignatureDigestPKCS1v15SHA1;
+		case 32: return kSecKeyAlgorithmRSASignatureDigestPKCS1v15SHA256;
+		case 48: return kSecKeyAlgorithmRSASignatureDigestPKCS1v15SHA384;
+		case 64: return kSecKeyAlgorithmRSASignatureDigestPKCS1v15SHA512;
+		}
+		break;
+	case 2:
+		switch (size) {
+		case 20: return kSecKeyAlgorithmRSASignatureDigestPSSSHA1;
+		case 32: return kSecKeyAlgorithmRSASignatureDigestPSSSHA256;
+		case 48: return kSecKeyAlgorithmRSASignatureDigestPSSSHA384;
+		case 64: return kSecKeyAlgorithmRSASignatureDigestPSSSHA512;
+		}
+		break;
+	case 3:
+		switch (size) {
+		case 20: return kSecKeyAlgorithmECDSASignatureDigestX962SHA1;
+		case 32: return kSecKeyAlgorithmECDSASignatureDigestX962SHA256;
+		case 48: return kSecKeyAlgorithmECDSASignatureDigestX962SHA384;
+		case 64: return kSecKeyAlgorithmECDSASignatureDigestX962SHA512;
+		}
+		break;
+	}
+	return NULL;
+}
+
+// sign_digest signs the digest, on failure it returns NULL and the
+// description of the error in message, which has to be freed.
+static CFDataRef sign_digest(SecKeyRef key, int scheme, const UInt8 *digest, CFIndex length, char **message) {
+	SecKeyAlgorithm a = algorithm(scheme, (int)length);
+	if (a == NULL || !SecKeyIsAlgorithmSupported(key, kSecKeyOperationTypeSign, a)) {
+		*message = strdup("algorithm not supported by the key");
+		return NULL;
+	}
+
+	CFDataRef data = CFDataCreate(NULL, digest, length);
+	CFErrorRef error = NULL;
+	CFDataRef signature = SecKeyCreateSignature(key, a, data, &error);
+	CFRelease(data);
+	if (signature != NULL) {
+		return signature;
+	}
+
+	CFStringRef description = CFErrorCopyDescription(error);
+	CFIndex size = CFStringGetMaximumSizeForEncoding(CFStringGetLength(description), kCFStringEncodingUTF8) + 1;
+	*message = calloc(size, 1);
+	CFStringGetCString(description, *message, size, kCFStringEncodingUTF8);
+	CFRelease(description);
+	CFRelease(error);
+	return NULL;
+}
+*/
+import "C"
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"unsafe"
+)
+
+// errSecItemNotFound is returned by SecItemCopyMatching without results.
+const errSecItemNotFound = -25300
+
+// secKey is a private key of the Keychain. CoreFoundation references are
+// uintptr values in Go.
+type secKey struct {
+	ref C.SecKeyRef
+}
+
+func openIdentity(match func(*x509.Certificate) bool) (key, []*x509.Certificate, error) {
+	var status C.OSStatus
+	identities := C.copy_identities(&status)
+	if status == errSecItemNotFound {
+		return nil, nil, errors.New("keychain: no identities in the Keychain")
+	}
+	if status != C.errSecSuccess {
+		return nil, nil, fmt.Errorf("keychain: SecItemCopyMatching failed: %d", int(status))
+	}
+	defer C.CFRelease(C.CFTypeRef(identities))
+
+	count := C.CFArrayGetCount(identities)
+	for i := C.CFIndex(0); i < count; i++ {
+		der := C.copy_certificate(identities, i)
+		if der == 0 {
+			continue
+		}
+		certificate, err := x509.ParseCertificate(goBytes(der))
+		C.CFRelease(C.CFTypeRef(der))
+		if err != nil || !match(certificate) {
+			continue
+		}
+
+		ref := C.copy_key(identities, i, &status)
+		if status != C.errSecSuccess {
+			return nil, nil, fmt.Errorf("keychain: SecIdentityCopyPrivateKey failed: %d", int(status))
+		}
+
+		chain := []*x509.Certificate{certificate}
+		if array := C.copy_chain(identities, i); array != 0 {
+			if built, err := parseChain(array); err == nil && len(built) > 0 {
+				chain = built
+			}
+			C.CFRelease(C.CFTypeRef(array))
+		}
+		return &secKey{ref: ref}, chain, nil
+	}
+	return nil, nil, errors.New("keychain: no valid identity matches the certificate")
+}
+
+func parseChain(array C.CFArrayRef) ([]*x509.Certificate, error) {
+	var chain []*x509.Certificate
+	count := C.CFArrayGetCount(array)
+	for i := C.CFIndex(0); i < count; i++ {
+		certificate, err := x509.ParseCertificate(goBytes(C.data_at(array, i)))
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, certificate)
+	}
+	return chain, nil
+}
+
+func goBytes(data C.CFDataRef) []byte {
+	return C.GoBytes(unsafe.Pointer(C.CFDataGetBytePtr(data)), C.int(C.CFDataGetLength(data)))
+}
+
+func (k *secKey) sign(scheme int, hash crypto.Hash, digest []byte) ([]byte, error) {
+	var message *C.char
+	signature := C.sign_digest(k.ref, C.int(scheme), (*C.UInt8)(unsafe.Pointer(&digest[0])), C.CFIndex(len(digest)), &message)
+	if signature == 0 {
+		defer C.free(unsafe.Pointer(message))
+		return nil, fmt.Errorf("keychain: failed to sign with %s: %s", hash, C.GoString(message))
+	}
+	defer C.CFRelease(C.CFTypeRef(signature))
+	return goBytes(signature), nil
+}
+
+func (k *secKey) close() error {
+	if k.ref != 0 {
+		C.CFRelease(C.CFTypeRef(k.ref))
+		k.ref = 0
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build !darwin || !cgo
+
+package keychain
+
+import (
+	"crypto/x509"
+	"errors"
+)
+
+func openIdentity(match func(*x509.Certificate) bool) (key, []*x509.Certificate, error) {
+	return nil, nil, errors.New("keychain: the Keychain is only available on macOS with cgo")
+}
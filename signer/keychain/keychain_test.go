@@ -0,0 +1,209 @@
+package keychain
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/sign"
+	"github.com/digitorus/pdfsign/verify"
+)
+
+// fakeKey signs like SecKeyCreateSignature with the digest algorithms.
+type fakeKey struct {
+	key        crypto.Signer
+	lastScheme int
+	closed     bool
+}
+
+func (k *fakeKey) sign(scheme int, hash crypto.Hash, digest []byte) ([]byte, error) {
+	k.lastScheme = scheme
+	switch key := k.key.(type) {
+	case *rsa.PrivateKey:
+		switch scheme {
+		case schemePKCS1v15:
+			return rsa.SignPKCS1v15(nil, key, hash, digest)
+		case schemePSS:
+			return rsa.SignPSS(rand.Reader, key, hash, digest, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+	case *ecdsa.PrivateKey:
+		if scheme == schemeECDSA {
+			return ecdsa.SignASN1(rand.Reader, key, digest)
+		}
+	}
+	return nil, errors.New("algorithm not supported by the key")
+}
+
+func (k *fakeKey) close() error {
+	k.closed = true
+	return nil
+}
+
+func newTestCertificate(t *testing.T, key crypto.Signer, notAfter time.Time) *x509.Certificate {
+	t.Helper()
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "John Doe", Organization: []string{"pdfsign"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	return certificate
+}
+
+func TestSignerSignPDF(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	tests := []struct {
+		name      string
+		key       crypto.Signer
+		algorithm sign.SignatureAlgorithm
+		scheme    int
+	}{
+		{name: "rsa", key: rsaKey, scheme: schemePKCS1v15},
+		{name: "rsa-pss", key: rsaKey, algorithm: sign.RSAPSS, scheme: schemePSS},
+		{name: "ecdsa", key: ecdsaKey, scheme: schemeECDSA},
+	}
+
+	input, err := os.ReadFile("../../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := &fakeKey{key: tt.key}
+			signer, err := newSigner(key, []*x509.Certificate{newTestCertificate(t, tt.key, time.Now().Add(time.Hour))})
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			rdr, err := pdf.NewReader(bytes.NewReader(input), int64(len(input)))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			var output bytes.Buffer
+			err = sign.Sign(bytes.NewReader(input), &output, rdr, int64(len(input)), sign.SignData{
+				Signature: sign.SignDataSignature{
+					Info: sign.SignDataSignatureInfo{
+						Name: "John Doe",
+						Date: time.Now().Local(),
+					},
+					CertType: sign.ApprovalSignature,
+				},
+				Signer:             signer,
+				DigestAlgorithm:    crypto.SHA256,
+				SignatureAlgorithm: tt.algorithm,
+			})
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if key.lastScheme != tt.scheme {
+				t.Errorf("expected scheme %d, got %d", tt.scheme, key.lastScheme)
+			}
+
+			info, err := verify.Verify(bytes.NewReader(output.Bytes()), int64(output.Len()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if len(info.Signers) != 1 || !info.Signers[0].ValidSignature {
+				t.Errorf("expected a single valid signature")
+			}
+
+			if err := signer.Close(); err != nil || !key.closed {
+				t.Errorf("expected the key to be released, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSignerSignPSSSaltLength(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	signer, err := newSigner(&fakeKey{key: key}, []*x509.Certificate{newTestCertificate(t, key, time.Now().Add(time.Hour))})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	digest := sha256.Sum256([]byte("pdfsign"))
+	if _, err := signer.Sign(rand.Reader, digest[:], &rsa.PSSOptions{Hash: crypto.SHA256, SaltLength: 20}); err == nil {
+		t.Errorf("expected an error for a salt shorter than the digest")
+	}
+	if _, err := signer.Sign(rand.Reader, digest[:], crypto.SHA3_256); err == nil {
+		t.Errorf("expected an error for SHA3-256")
+	}
+}
+
+func TestMatches(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	valid := newTestCertificate(t, key, time.Now().Add(time.Hour))
+	expired := newTestCertificate(t, key, time.Now().Add(-time.Minute))
+
+	sum := sha1.Sum(valid.Raw)
+	thumbprint, err := parseThumbprint(hex.EncodeToString(sum[:]))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	now := time.Now()
+	if !matches(valid, thumbprint, "", now) {
+		t.Errorf("expected the thumbprint to match")
+	}
+	if matches(expired, thumbprint, "", now) {
+		t.Errorf("expected the thumbprint of another certificate not to match")
+	}
+	if !matches(valid, nil, "john doe", now) {
+		t.Errorf("expected the subject to match")
+	}
+	if matches(expired, nil, "John Doe", now) {
+		t.Errorf("expected an expired certificate not to match")
+	}
+	if matches(valid, nil, "Jane Doe", now) {
+		t.Errorf("expected another subject not to match")
+	}
+}
+
+func TestOpen(t *testing.T) {
+	if _, err := Open(Config{}); err == nil {
+		t.Errorf("expected an error without thumbprint and subject")
+	}
+	if _, err := Open(Config{Thumbprint: "0f12"}); err == nil {
+		t.Errorf("expected an error for a short thumbprint")
+	}
+}
@@ -0,0 +1,110 @@
+package piv
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// digestInfoPrefixes are the DER encoded DigestInfo headers of RFC 8017,
+// section 9.2.
+var digestInfoPrefixes = map[crypto.Hash][]byte{
+	crypto.SHA1:     {0x30, 0x21, 0x30, 0x09, 0x06, 0x05, 0x2b, 0x0e, 0x03, 0x02, 0x1a, 0x05, 0x00, 0x04, 0x14},
+	crypto.SHA256:   {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA384:   {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA512:   {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+	crypto.SHA3_256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x08, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA3_384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x09, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA3_512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x0a, 0x05, 0x00, 0x04, 0x40},
+}
+
+// encodePKCS1v15 returns the EMSA-PKCS1-v1_5 encoding of the digest (RFC
+// 8017, section 9.2), as long as the modulus.
+func encodePKCS1v15(key *rsa.PublicKey, hash crypto.Hash, digest []byte) ([]byte, error) {
+	prefix, ok := digestInfoPrefixes[hash]
+	if !ok {
+		return nil, fmt.Errorf("piv: unsupported digest algorithm %s", hash)
+	}
+
+	k := key.Size()
+	t := len(prefix) + len(digest)
+	if k < t+11 {
+		return nil, errors.New("piv: RSA key too short for the digest")
+	}
+
+	em := make([]byte, k)
+	em[1] = 0x01
+	for i := 2; i < k-t-1; i++ {
+		em[i] = 0xff
+	}
+	copy(em[k-t:], prefix)
+	copy(em[k-len(digest):], digest)
+	return em, nil
+}
+
+// encodePSS returns the EMSA-PSS encoding of the digest with MGF1 of the same
+// hash (RFC 8017, section 9.1.1), left padded to the length of the modulus.
+func encodePSS(random io.Reader, key *rsa.PublicKey, hash crypto.Hash, digest []byte, saltLength int) ([]byte, error) {
+	hLen := hash.Size()
+	emBits := key.N.BitLen() - 1
+	emLen := (emBits + 7) / 8
+
+	switch saltLength {
+	case rsa.PSSSaltLengthEqualsHash, rsa.PSSSaltLengthAuto:
+		saltLength = hLen
+	}
+	if saltLength < 0 || emLen < hLen+saltLength+2 {
+		return nil, errors.New("piv: RSA key too short for the PSS parameters")
+	}
+
+	salt := make([]byte, saltLength)
+	if _, err := io.ReadFull(random, salt); err != nil {
+		return nil, err
+	}
+
+	h := hash.New()
+	h.Write(make([]byte, 8))
+	h.Write(digest)
+	h.Write(salt)
+	mHash := h.Sum(nil)
+
+	// DB = PS || 0x01 || salt, masked with MGF1(H).
+	db := make([]byte, emLen-hLen-1)
+	db[len(db)-saltLength-1] = 0x01
+	copy(db[len(db)-saltLength:], salt)
+	mgf1XOR(db, hash, mHash)
+	db[0] &= 0xff >> (8*emLen - emBits)
+
+	em := make([]byte, key.Size())
+	offset := len(em) - emLen
+	copy(em[offset:], db)
+	copy(em[offset+len(db):], mHash)
+	em[len(em)-1] = 0xbc
+	return em, nil
+}
+
+// mgf1XOR masks out with MGF1 of the seed.
+func mgf1XOR(out []byte, hash crypto.Hash, seed []byte) {
+	var counter [4]byte
+	done := 0
+	for done < len(out) {
+		h := hash.New()
+		h.Write(seed)
+		h.Write(counter[:])
+		for _, b := range h.Sum(nil) {
+			if done == len(out) {
+				break
+			}
+			out[done] ^= b
+			done++
+		}
+		for i := 3; i >= 0; i-- {
+			counter[i]++
+			if counter[i] != 0 {
+				break
+			}
+		}
+	}
+}
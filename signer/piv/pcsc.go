@@ -0,0 +1,208 @@
+//go:build cgo && (linux || darwin || freebsd)
+
+package piv
+
+/*
+#cgo linux freebsd LDFLAGS: -ldl
+
+#include <dlfcn.h>
+#include <stdint.h>
+#include <stdlib.h>
+
+// pcsc-lite uses the native long, the macOS PCSC framework 32 bit integers.
+#ifdef __APPLE__
+typedef uint32_t DWORD;
+typedef int32_t LONG;
+#define PCSC_LIBRARY "/System/Library/Frameworks/PCSC.framework/PCSC"
+#elif defined(__FreeBSD__)
+typedef unsigned long DWORD;
+typedef long LONG;
+#define PCSC_LIBRARY "libpcsclite.so"
+#else
+typedef unsigned long DWORD;
+typedef long LONG;
+#define PCSC_LIBRARY "libpcsclite.so.1"
+#endif
+
+typedef LONG SCARDCONTEXT;
+typedef LONG SCARDHANDLE;
+
+typedef struct {
+	DWORD dwProtocol;
+	DWORD cbPciLength;
+} SCARD_IO_REQUEST;
+
+#define SCARD_S_SUCCESS 0
+#define SCARD_SCOPE_SYSTEM 2
+#define SCARD_SHARE_SHARED 2
+#define SCARD_PROTOCOL_T1 2
+#define SCARD_LEAVE_CARD 0
+
+typedef LONG (*establish_fn)(DWORD, const void *, const void *, SCARDCONTEXT *);
+typedef LONG (*release_fn)(SCARDCONTEXT);
+typedef LONG (*list_readers_fn)(SCARDCONTEXT, const char *, char *, DWORD *);
+typedef LONG (*connect_fn)(SCARDCONTEXT, const char *, DWORD, DWORD, SCARDHANDLE *, DWORD *);
+typedef LONG (*disconnect_fn)(SCARDHANDLE, DWORD);
+typedef LONG (*transmit_fn)(SCARDHANDLE, const SCARD_IO_REQUEST *, const unsigned char *, DWORD,
+	SCARD_IO_REQUEST *, unsigned char *, DWORD *);
+
+static struct {
+	void *handle;
+	establish_fn establish;
+	release_fn release;
+	list_readers_fn list_readers;
+	connect_fn connect;
+	disconnect_fn disconnect;
+	transmit_fn transmit;
+} pcsc;
+
+static int pcsc_load(void) {
+	if (pcsc.handle != NULL) {
+		return 1;
+	}
+	void *handle = dlopen(PCSC_LIBRARY, RTLD_NOW | RTLD_LOCAL);
+	if (handle == NULL) {
+		return 0;
+	}
+	pcsc.establish = (establish_fn)dlsym(handle, "SCardEstablishContext");
+	pcsc.release = (release_fn)dlsym(handle, "SCardReleaseContext");
+	pcsc.list_readers = (list_readers_fn)dlsym(handle, "SCardListReaders");
+	pcsc.connect = (connect_fn)dlsym(handle, "SCardConnect");
+	pcsc.disconnect = (disconnect_fn)dlsym(handle, "SCardDisconnect");
+	pcsc.transmit = (transmit_fn)dlsym(handle, "SCardTransmit");
+	if (!pcsc.establish || !pcsc.release || !pcsc.list_readers || !pcsc.connect || !pcsc.disconnect || !pcsc.transmit) {
+		dlclose(handle);
+		return 0;
+	}
+	pcsc.handle = handle;
+	return 1;
+}
+
+static LONG pcsc_establish(SCARDCONTEXT *context) {
+	return pcsc.establish(SCARD_SCOPE_SYSTEM, NULL, NULL, context);
+}
+
+static LONG pcsc_release(SCARDCONTEXT context) {
+	return pcsc.release(context);
+}
+
+static LONG pcsc_list_readers(SCARDCONTEXT context, char **readers, DWORD *length) {
+	LONG rv = pcsc.list_readers(context, NULL, NULL, length);
+	if (rv != SCARD_S_SUCCESS) {
+		return rv;
+	}
+	*readers = calloc(*length + 2, 1);
+	return pcsc.list_readers(context, NULL, *readers, length);
+}
+
+static LONG pcsc_connect(SCARDCONTEXT context, const char *reader, SCARDHANDLE *card) {
+	DWORD protocol;
+	return pcsc.connect(context, reader, SCARD_SHARE_SHARED, SCARD_PROTOCOL_T1, card, &protocol);
+}
+
+static LONG pcsc_disconnect(SCARDHANDLE card) {
+	return pcsc.disconnect(card, SCARD_LEAVE_CARD);
+}
+
+static LONG pcsc_transmit(SCARDHANDLE card, const unsigned char *command, DWORD command_length,
+		unsigned char *response, DWORD *response_length) {
+	SCARD_IO_REQUEST pci = {SCARD_PROTOCOL_T1, sizeof(SCARD_IO_REQUEST)};
+	return pcsc.transmit(card, &pci, command, command_length, NULL, response, response_length);
+}
+*/
+import "C"
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"unsafe"
+)
+
+var loadMu sync.Mutex
+
+type pcscCard struct {
+	context C.SCARDCONTEXT
+	card    C.SCARDHANDLE
+}
+
+func pcscError(function string, rv C.LONG) error {
+	return fmt.Errorf("piv: %s failed: 0x%08x", function, uint32(rv))
+}
+
+// connect connects to the first card whose reader name contains reader, or
+// "Yubico" if reader is empty.
+func connect(reader string) (card, error) {
+	loadMu.Lock()
+	loaded := C.pcsc_load() == 1
+	loadMu.Unlock()
+	if !loaded {
+		return nil, errors.New("piv: failed to load the PC/SC library, install pcsc-lite")
+	}
+
+	c := &pcscCard{}
+	if rv := C.pcsc_establish(&c.context); rv != C.SCARD_S_SUCCESS {
+		return nil, pcscError("SCardEstablishContext", rv)
+	}
+
+	var list *C.char
+	var length C.DWORD
+	rv := C.pcsc_list_readers(c.context, &list, &length)
+	if list != nil {
+		defer C.free(unsafe.Pointer(list))
+	}
+	if rv != C.SCARD_S_SUCCESS {
+		C.pcsc_release(c.context)
+		return nil, pcscError("SCardListReaders", rv)
+	}
+
+	if reader == "" {
+		reader = "Yubico"
+	}
+	// The reader names are a list of NUL terminated strings.
+	names := C.GoBytes(unsafe.Pointer(list), C.int(length))
+	for _, name := range bytes.Split(names, []byte{0}) {
+		if len(name) == 0 || !strings.Contains(string(name), reader) {
+			continue
+		}
+
+		cname := C.CString(string(name))
+		rv := C.pcsc_connect(c.context, cname, &c.card)
+		C.free(unsafe.Pointer(cname))
+		if rv != C.SCARD_S_SUCCESS {
+			C.pcsc_release(c.context)
+			return nil, pcscError("SCardConnect", rv)
+		}
+		return c, nil
+	}
+
+	C.pcsc_release(c.context)
+	return nil, fmt.Errorf("piv: no reader matching %q", reader)
+}
+
+func (c *pcscCard) transmit(command []byte) ([]byte, error) {
+	ccommand := (*C.uchar)(C.CBytes(command))
+	defer C.free(unsafe.Pointer(ccommand))
+
+	// Responses are at most 256 bytes and the status word.
+	const size = 258
+	response := (*C.uchar)(C.malloc(size))
+	defer C.free(unsafe.Pointer(response))
+
+	length := C.DWORD(size)
+	if rv := C.pcsc_transmit(c.card, ccommand, C.DWORD(len(command)), response, &length); rv != C.SCARD_S_SUCCESS {
+		return nil, pcscError("SCardTransmit", rv)
+	}
+	return C.GoBytes(unsafe.Pointer(response), C.int(length)), nil
+}
+
+func (c *pcscCard) close() error {
+	rv := C.pcsc_disconnect(c.card)
+	C.pcsc_release(c.context)
+	if rv != C.SCARD_S_SUCCESS {
+		return pcscError("SCardDisconnect", rv)
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build !cgo || !(linux || darwin || freebsd)
+
+package piv
+
+import "errors"
+
+func connect(reader string) (card, error) {
+	return nil, errors.New("piv: PC/SC access requires cgo on Linux, macOS or FreeBSD")
+}
@@ -0,0 +1,447 @@
+// Package piv implements a signer for keys in the PIV application of smart
+// cards such as the YubiKey, see NIST SP 800-73-4. Cards are accessed with
+// PC/SC, the system's PC/SC library is loaded at runtime, which requires cgo.
+package piv
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Slot is a PIV key slot.
+type Slot byte
+
+// Key slots of SP 800-73-4, section 3.1.
+const (
+	SlotAuthentication Slot = 0x9a // PIV Authentication, the PIN is verified once per session
+	SlotSignature      Slot = 0x9c // Digital Signature, the PIN is verified for every signature
+)
+
+// ParseSlot parses a slot in its hexadecimal notation, e.g. "9c".
+func ParseSlot(s string) (Slot, error) {
+	switch strings.ToLower(s) {
+	case "9a":
+		return SlotAuthentication, nil
+	case "9c":
+		return SlotSignature, nil
+	}
+	return 0, fmt.Errorf("piv: unsupported slot %q, use 9a or 9c", s)
+}
+
+func (s Slot) String() string {
+	return fmt.Sprintf("%x", byte(s))
+}
+
+// object returns the tag of the data object of the slot's certificate.
+func (s Slot) object() []byte {
+	if s == SlotAuthentication {
+		return []byte{0x5f, 0xc1, 0x05}
+	}
+	return []byte{0x5f, 0xc1, 0x0a}
+}
+
+// PIN and touch policies of the YubiKey GET METADATA command.
+const (
+	pinPolicyNever  = 0x1
+	pinPolicyOnce   = 0x2
+	pinPolicyAlways = 0x3
+
+	touchPolicyNever  = 0x1
+	touchPolicyAlways = 0x2
+	touchPolicyCached = 0x3
+)
+
+// Config selects the card and the slot to sign with.
+type Config struct {
+	Reader      string                 // Part of the PC/SC reader name, defaults to the first reader with "Yubico" in its name
+	Slot        Slot                   // Defaults to SlotSignature
+	PIN         string                 // PIV PIN, or
+	PINPrompt   func() (string, error) // Asks for the PIN the first time it is required
+	TouchPrompt func()                 // Called before signing with a key that requires touch
+	Chain       []*x509.Certificate    // Signing certificate followed by its issuers, defaults to the certificate in the slot
+}
+
+// PINError is returned for a wrong PIN.
+type PINError struct {
+	Retries int // Remaining tries before the PIN is blocked
+}
+
+func (e *PINError) Error() string {
+	return fmt.Sprintf("piv: wrong PIN, %d tries left", e.Retries)
+}
+
+// ErrPINBlocked is returned when the PIN is blocked and has to be reset with
+// the PUK.
+var ErrPINBlocked = errors.New("piv: PIN is blocked")
+
+// statusError is an unexpected status word of a response.
+type statusError uint16
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("piv: card returned status %04x", uint16(e))
+}
+
+// card is a connection to a smart card.
+type card interface {
+	transmit(command []byte) ([]byte, error)
+	close() error
+}
+
+// Signer signs with the key in a PIV slot. It implements crypto.Signer and
+// sign.CertificateSigner.
+type Signer struct {
+	mu          sync.Mutex
+	card        card
+	config      Config
+	algorithm   byte
+	chain       []*x509.Certificate
+	pinPolicy   byte
+	touchPolicy byte
+	verified    bool
+}
+
+// Open connects to the card and returns the signer of the slot. Close the
+// signer to release the card.
+func Open(config Config) (*Signer, error) {
+	c, err := connect(config.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := newSigner(c, config)
+	if err != nil {
+		_ = c.close()
+		return nil, err
+	}
+	return signer, nil
+}
+
+func newSigner(c card, config Config) (*Signer, error) {
+	if config.Slot == 0 {
+		config.Slot = SlotSignature
+	}
+
+	s := &Signer{card: c, config: config}
+	if err := s.selectApplication(); err != nil {
+		return nil, err
+	}
+
+	s.chain = config.Chain
+	if len(s.chain) == 0 {
+		certificate, err := s.certificate()
+		if err != nil {
+			return nil, err
+		}
+		s.chain = []*x509.Certificate{certificate}
+	}
+
+	switch key := s.chain[0].PublicKey.(type) {
+	case *rsa.PublicKey:
+		switch key.N.BitLen() {
+		case 1024:
+			s.algorithm = 0x06
+		case 2048:
+			s.algorithm = 0x07
+		case 3072:
+			s.algorithm = 0x05
+		case 4096:
+			s.algorithm = 0x16
+		default:
+			return nil, fmt.Errorf("piv: unsupported RSA key size %d", key.N.BitLen())
+		}
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256():
+			s.algorithm = 0x11
+		case elliptic.P384():
+			s.algorithm = 0x14
+		default:
+			return nil, fmt.Errorf("piv: unsupported curve %s", key.Curve.Params().Name)
+		}
+	default:
+		return nil, fmt.Errorf("piv: unsupported key type %T", s.chain[0].PublicKey)
+	}
+
+	// Cards without GET METADATA (YubiKey before 5.3) use the policies of
+	// SP 800-73-4, the touch policy is unknown.
+	s.pinPolicy = pinPolicyOnce
+	if config.Slot == SlotSignature {
+		s.pinPolicy = pinPolicyAlways
+	}
+	if metadata, err := s.command(0x00, 0xf7, 0x00, byte(config.Slot), nil); err == nil {
+		if policy := findTLV(metadata, 0x02); len(policy) == 2 {
+			s.pinPolicy, s.touchPolicy = policy[0], policy[1]
+		}
+	}
+
+	return s, nil
+}
+
+// selectApplication selects the PIV application.
+func (s *Signer) selectApplication() error {
+	_, err := s.command(0x00, 0xa4, 0x04, 0x00, []byte{0xa0, 0x00, 0x00, 0x03, 0x08})
+	if err != nil {
+		return fmt.Errorf("piv: failed to select the PIV application: %w", err)
+	}
+	return nil
+}
+
+// certificate reads the certificate of the slot (GET DATA).
+func (s *Signer) certificate() (*x509.Certificate, error) {
+	data, err := s.command(0x00, 0xcb, 0x3f, 0xff, tlv(0x5c, s.config.Slot.object()))
+	if err != nil {
+		return nil, fmt.Errorf("piv: no certificate in slot %s: %w", s.config.Slot, err)
+	}
+
+	object := findTLV(data, 0x53)
+	der := findTLV(object, 0x70)
+	if der == nil {
+		return nil, fmt.Errorf("piv: no certificate in slot %s", s.config.Slot)
+	}
+	// The CertInfo byte indicates a gzip compressed certificate.
+	if info := findTLV(object, 0x71); len(info) == 1 && info[0] == 0x01 {
+		r, err := gzip.NewReader(bytes.NewReader(der))
+		if err != nil {
+			return nil, fmt.Errorf("piv: invalid compressed certificate: %w", err)
+		}
+		if der, err = io.ReadAll(r); err != nil {
+			return nil, fmt.Errorf("piv: invalid compressed certificate: %w", err)
+		}
+	}
+
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("piv: invalid certificate in slot %s: %w", s.config.Slot, err)
+	}
+	return certificate, nil
+}
+
+// verifyPIN verifies the PIN, asking for it with the PINPrompt the first
+// time.
+func (s *Signer) verifyPIN() error {
+	if s.config.PIN == "" && s.config.PINPrompt != nil {
+		pin, err := s.config.PINPrompt()
+		if err != nil {
+			return err
+		}
+		s.config.PIN = pin
+	}
+	if len(s.config.PIN) < 6 || len(s.config.PIN) > 8 {
+		return errors.New("piv: the PIN must have 6 to 8 characters")
+	}
+
+	pin := bytes.Repeat([]byte{0xff}, 8)
+	copy(pin, s.config.PIN)
+	_, err := s.command(0x00, 0x20, 0x00, 0x80, pin)
+
+	var status statusError
+	switch {
+	case errors.As(err, &status) && status&0xfff0 == 0x63c0:
+		// Ask again next time instead of blocking the PIN.
+		if s.config.PINPrompt != nil {
+			s.config.PIN = ""
+		}
+		return &PINError{Retries: int(status & 0xf)}
+	case errors.As(err, &status) && status == 0x6983:
+		return ErrPINBlocked
+	case err != nil:
+		return err
+	}
+	s.verified = true
+	return nil
+}
+
+// Public returns the public key of the signing certificate.
+func (s *Signer) Public() crypto.PublicKey {
+	return s.chain[0].PublicKey
+}
+
+// CertificateChain returns the signing certificate followed by its issuers.
+func (s *Signer) CertificateChain() ([]*x509.Certificate, error) {
+	return s.chain, nil
+}
+
+// Sign signs the digest with GENERAL AUTHENTICATE. The card computes raw
+// RSA, the PKCS #1 v1.5 or PSS encoding for *rsa.PSSOptions is added here.
+func (s *Signer) Sign(random io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	hash := opts.HashFunc()
+	if len(digest) != hash.Size() {
+		return nil, errors.New("piv: digest length does not match the digest algorithm")
+	}
+
+	var data []byte
+	switch key := s.Public().(type) {
+	case *rsa.PublicKey:
+		var err error
+		if pss, ok := opts.(*rsa.PSSOptions); ok {
+			if random == nil {
+				random = rand.Reader
+			}
+			data, err = encodePSS(random, key, hash, digest, pss.SaltLength)
+		} else {
+			data, err = encodePKCS1v15(key, hash, digest)
+		}
+		if err != nil {
+			return nil, err
+		}
+	case *ecdsa.PublicKey:
+		// The digest is truncated or padded to the size of the curve.
+		size := (key.Curve.Params().BitSize + 7) / 8
+		data = make([]byte, size)
+		if len(digest) > size {
+			digest = digest[:size]
+		}
+		copy(data[size-len(digest):], digest)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.selectApplication(); err != nil {
+		return nil, err
+	}
+
+	response, err := s.authenticate(data, false)
+	if err != nil {
+		return nil, err
+	}
+
+	signature := findTLV(findTLV(response, 0x7c), 0x82)
+	if signature == nil {
+		return nil, errors.New("piv: invalid GENERAL AUTHENTICATE response")
+	}
+	return signature, nil
+}
+
+// authenticate sends GENERAL AUTHENTICATE, verifying the PIN first when the
+// PIN policy of the slot requires it.
+func (s *Signer) authenticate(data []byte, retried bool) ([]byte, error) {
+	if s.pinPolicy == pinPolicyAlways || (s.pinPolicy == pinPolicyOnce && !s.verified) {
+		if err := s.verifyPIN(); err != nil {
+			return nil, err
+		}
+	}
+	if s.config.TouchPrompt != nil && (s.touchPolicy == touchPolicyAlways || s.touchPolicy == touchPolicyCached) {
+		s.config.TouchPrompt()
+	}
+
+	template := tlv(0x7c, append(tlv(0x82, nil), tlv(0x81, data)...))
+	response, err := s.command(0x00, 0x87, s.algorithm, byte(s.config.Slot), template)
+
+	// Another application may have reset the security status of the card.
+	var status statusError
+	if errors.As(err, &status) && status == 0x6982 && s.pinPolicy == pinPolicyOnce && !retried {
+		s.verified = false
+		return s.authenticate(data, true)
+	}
+	return response, err
+}
+
+// Close releases the card.
+func (s *Signer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.card.close()
+}
+
+// command sends an APDU with command chaining for long data, and collects a
+// chained response.
+func (s *Signer) command(cla, ins, p1, p2 byte, data []byte) ([]byte, error) {
+	for len(data) > 0xff {
+		apdu := append([]byte{cla | 0x10, ins, p1, p2, 0xff}, data[:0xff]...)
+		response, err := s.card.transmit(apdu)
+		if err != nil {
+			return nil, err
+		}
+		if _, sw := splitStatus(response); sw != 0x9000 {
+			return nil, statusError(sw)
+		}
+		data = data[0xff:]
+	}
+
+	apdu := []byte{cla, ins, p1, p2}
+	if len(data) > 0 {
+		apdu = append(append(apdu, byte(len(data))), data...)
+	}
+	apdu = append(apdu, 0x00)
+
+	var result []byte
+	for {
+		response, err := s.card.transmit(apdu)
+		if err != nil {
+			return nil, err
+		}
+		body, sw := splitStatus(response)
+		result = append(result, body...)
+		switch {
+		case sw == 0x9000:
+			return result, nil
+		case sw>>8 == 0x61:
+			// GET RESPONSE for the remaining bytes.
+			apdu = []byte{0x00, 0xc0, 0x00, 0x00, byte(sw)}
+		default:
+			return nil, statusError(sw)
+		}
+	}
+}
+
+func splitStatus(response []byte) ([]byte, uint16) {
+	if len(response) < 2 {
+		return nil, 0
+	}
+	n := len(response) - 2
+	return response[:n], uint16(response[n])<<8 | uint16(response[n+1])
+}
+
+// tlv encodes a BER-TLV with a one byte tag.
+func tlv(tag byte, value []byte) []byte {
+	out := []byte{tag}
+	switch n := len(value); {
+	case n < 0x80:
+		out = append(out, byte(n))
+	case n <= 0xff:
+		out = append(out, 0x81, byte(n))
+	default:
+		out = append(out, 0x82, byte(n>>8), byte(n))
+	}
+	return append(out, value...)
+}
+
+// findTLV returns the value of the first BER-TLV with a one byte tag in data.
+func findTLV(data []byte, tag byte) []byte {
+	for len(data) >= 2 {
+		t := data[0]
+		n, header := int(data[1]), 2
+		switch data[1] {
+		case 0x81:
+			if len(data) < 3 {
+				return nil
+			}
+			n, header = int(data[2]), 3
+		case 0x82:
+			if len(data) < 4 {
+				return nil
+			}
+			n, header = int(data[2])<<8|int(data[3]), 4
+		}
+		if len(data) < header+n {
+			return nil
+		}
+		if t == tag {
+			return data[header : header+n]
+		}
+		data = data[header+n:]
+	}
+	return nil
+}
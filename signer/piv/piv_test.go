@@ -0,0 +1,353 @@
+package piv
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/sign"
+	"github.com/digitorus/pdfsign/verify"
+)
+
+// fakeCard is a PIV application with a software key in one slot. Responses
+// are split into chunks of 128 bytes to exercise GET RESPONSE.
+type fakeCard struct {
+	key         crypto.Signer
+	slot        Slot
+	certificate []byte
+	compress    bool
+	metadata    bool
+	pinPolicy   byte
+	touchPolicy byte
+
+	pin       string
+	retries   int
+	verified  bool
+	chained   []byte
+	pending   []byte
+	verifies  int
+	signs     int
+	reset     bool // Reset the security status before the next signature
+	lastAlgID byte
+}
+
+func newFakeCard(t *testing.T, key crypto.Signer, slot Slot) *fakeCard {
+	t.Helper()
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "pdfsign PIV test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	return &fakeCard{key: key, slot: slot, certificate: der, pin: "123456", retries: 3, metadata: true, pinPolicy: pinPolicyAlways, touchPolicy: touchPolicyNever}
+}
+
+func (c *fakeCard) respond(data []byte, sw uint16) []byte {
+	if len(data) > 128 {
+		c.pending = data[128:]
+		remaining := len(c.pending)
+		if remaining > 0xff {
+			remaining = 0
+		}
+		return append(append([]byte(nil), data[:128]...), 0x61, byte(remaining))
+	}
+	return append(append([]byte(nil), data...), byte(sw>>8), byte(sw))
+}
+
+func (c *fakeCard) transmit(apdu []byte) ([]byte, error) {
+	cla, ins, p1, p2 := apdu[0], apdu[1], apdu[2], apdu[3]
+	var data []byte
+	if len(apdu) > 5 {
+		data = apdu[5 : 5+int(apdu[4])]
+	}
+
+	if cla&0x10 != 0 {
+		c.chained = append(c.chained, data...)
+		return []byte{0x90, 0x00}, nil
+	}
+	data = append(c.chained, data...)
+	c.chained = nil
+
+	switch ins {
+	case 0xa4:
+		if !bytes.Equal(data, []byte{0xa0, 0x00, 0x00, 0x03, 0x08}) {
+			return []byte{0x6a, 0x82}, nil
+		}
+		return c.respond(nil, 0x9000), nil
+	case 0xc0:
+		pending := c.pending
+		c.pending = nil
+		return c.respond(pending, 0x9000), nil
+	case 0xcb:
+		if !bytes.Equal(data, tlv(0x5c, c.slot.object())) {
+			return []byte{0x6a, 0x82}, nil
+		}
+		certificate, info := c.certificate, byte(0)
+		if c.compress {
+			var buf bytes.Buffer
+			w := gzip.NewWriter(&buf)
+			_, _ = w.Write(certificate)
+			_ = w.Close()
+			certificate, info = buf.Bytes(), 1
+		}
+		object := append(tlv(0x70, certificate), tlv(0x71, []byte{info})...)
+		return c.respond(tlv(0x53, append(object, tlv(0xfe, nil)...)), 0x9000), nil
+	case 0xf7:
+		if !c.metadata {
+			return []byte{0x6d, 0x00}, nil
+		}
+		return c.respond(append(tlv(0x01, []byte{0x11}), tlv(0x02, []byte{c.pinPolicy, c.touchPolicy})...), 0x9000), nil
+	case 0x20:
+		if c.retries == 0 {
+			return []byte{0x69, 0x83}, nil
+		}
+		if !bytes.Equal(data, append([]byte(c.pin), 0xff, 0xff)) {
+			c.retries--
+			return []byte{0x63, 0xc0 | byte(c.retries)}, nil
+		}
+		c.retries = 3
+		c.verified = true
+		c.verifies++
+		return c.respond(nil, 0x9000), nil
+	case 0x87:
+		if c.reset {
+			c.reset, c.verified = false, false
+		}
+		if Slot(p2) != c.slot || (c.pinPolicy != pinPolicyNever && !c.verified) {
+			return []byte{0x69, 0x82}, nil
+		}
+		if c.pinPolicy == pinPolicyAlways {
+			c.verified = false
+		}
+		c.lastAlgID = p1
+		c.signs++
+
+		input := findTLV(findTLV(data, 0x7c), 0x81)
+		var signature []byte
+		switch key := c.key.(type) {
+		case *rsa.PrivateKey:
+			// Raw RSA.
+			m := new(big.Int).SetBytes(input)
+			signature = new(big.Int).Exp(m, key.D, key.N).FillBytes(make([]byte, key.Size()))
+		case *ecdsa.PrivateKey:
+			var err error
+			if signature, err = ecdsa.SignASN1(rand.Reader, key, input); err != nil {
+				return nil, err
+			}
+		}
+		return c.respond(tlv(0x7c, tlv(0x82, signature)), 0x9000), nil
+	}
+	return []byte{0x6d, 0x00}, nil
+}
+
+func (c *fakeCard) close() error {
+	return nil
+}
+
+func TestSignerSignPDF(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	tests := []struct {
+		name      string
+		key       crypto.Signer
+		slot      Slot
+		digest    crypto.Hash
+		algorithm sign.SignatureAlgorithm
+		compress  bool
+		algID     byte
+	}{
+		{name: "rsa", key: rsaKey, slot: SlotSignature, digest: crypto.SHA256, algID: 0x07},
+		{name: "rsa-pss", key: rsaKey, slot: SlotSignature, digest: crypto.SHA512, algorithm: sign.RSAPSS, algID: 0x07},
+		{name: "ecdsa", key: ecdsaKey, slot: SlotAuthentication, digest: crypto.SHA384, compress: true, algID: 0x14},
+		{name: "ecdsa-sha512", key: ecdsaKey, slot: SlotSignature, digest: crypto.SHA512, algID: 0x14},
+	}
+
+	input, err := os.ReadFile("../../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newFakeCard(t, tt.key, tt.slot)
+			c.compress = tt.compress
+
+			prompts := 0
+			signer, err := newSigner(c, Config{
+				Slot: tt.slot,
+				PINPrompt: func() (string, error) {
+					prompts++
+					return "123456", nil
+				},
+			})
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			rdr, err := pdf.NewReader(bytes.NewReader(input), int64(len(input)))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			var output bytes.Buffer
+			err = sign.Sign(bytes.NewReader(input), &output, rdr, int64(len(input)), sign.SignData{
+				Signature: sign.SignDataSignature{
+					Info: sign.SignDataSignatureInfo{
+						Name: "John Doe",
+						Date: time.Now().Local(),
+					},
+					CertType: sign.ApprovalSignature,
+				},
+				Signer:             signer,
+				DigestAlgorithm:    tt.digest,
+				SignatureAlgorithm: tt.algorithm,
+			})
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if prompts != 1 || c.lastAlgID != tt.algID {
+				t.Errorf("expected one PIN prompt and algorithm %02x, got %d prompts and %02x", tt.algID, prompts, c.lastAlgID)
+			}
+
+			info, err := verify.Verify(bytes.NewReader(output.Bytes()), int64(output.Len()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if len(info.Signers) != 1 || !info.Signers[0].ValidSignature {
+				t.Errorf("expected a single valid signature")
+			}
+		})
+	}
+}
+
+func TestSignerPolicies(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	digest := sha256.Sum256([]byte("pdfsign"))
+
+	tests := []struct {
+		name        string
+		slot        Slot
+		metadata    bool
+		pinPolicy   byte
+		touchPolicy byte
+		reset       bool
+		verifies    int
+		touches     int
+	}{
+		{name: "pin always", slot: SlotSignature, metadata: true, pinPolicy: pinPolicyAlways, touchPolicy: touchPolicyNever, verifies: 2},
+		{name: "pin once", slot: SlotSignature, metadata: true, pinPolicy: pinPolicyOnce, touchPolicy: touchPolicyAlways, verifies: 1, touches: 2},
+		{name: "pin once after reset", slot: SlotAuthentication, metadata: true, pinPolicy: pinPolicyOnce, touchPolicy: touchPolicyCached, reset: true, verifies: 2, touches: 3},
+		{name: "pin never", slot: SlotSignature, metadata: true, pinPolicy: pinPolicyNever, touchPolicy: touchPolicyNever},
+		{name: "signature slot without metadata", slot: SlotSignature, pinPolicy: pinPolicyAlways, verifies: 2},
+		{name: "authentication slot without metadata", slot: SlotAuthentication, pinPolicy: pinPolicyOnce, verifies: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newFakeCard(t, key, tt.slot)
+			c.metadata, c.pinPolicy, c.touchPolicy = tt.metadata, tt.pinPolicy, tt.touchPolicy
+
+			touches := 0
+			signer, err := newSigner(c, Config{Slot: tt.slot, PIN: "123456", TouchPrompt: func() { touches++ }})
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			for i := 0; i < 2; i++ {
+				c.reset = tt.reset && i == 1
+				signature, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+				if err != nil {
+					t.Fatalf("%s", err.Error())
+				}
+				if !ecdsa.VerifyASN1(&key.PublicKey, digest[:], signature) {
+					t.Fatalf("invalid signature")
+				}
+			}
+			if c.verifies != tt.verifies || touches != tt.touches {
+				t.Errorf("expected %d PIN verifications and %d touch prompts, got %d and %d", tt.verifies, tt.touches, c.verifies, touches)
+			}
+		})
+	}
+}
+
+func TestSignerWrongPIN(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	c := newFakeCard(t, key, SlotSignature)
+	signer, err := newSigner(c, Config{PIN: "654321"})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	digest := sha256.Sum256([]byte("pdfsign"))
+	var pinErr *PINError
+	if _, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256); !errors.As(err, &pinErr) || pinErr.Retries != 2 {
+		t.Fatalf("expected a wrong PIN error with 2 retries, got %v", err)
+	}
+
+	c.retries = 0
+	if _, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256); !errors.Is(err, ErrPINBlocked) {
+		t.Fatalf("expected a blocked PIN, got %v", err)
+	}
+}
+
+func TestEncodePKCS1v15(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	digest := sha256.Sum256([]byte("pdfsign"))
+
+	expected, err := rsa.SignPKCS1v15(nil, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	em, err := encodePKCS1v15(&key.PublicKey, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	signature := new(big.Int).Exp(new(big.Int).SetBytes(em), key.D, key.N).FillBytes(make([]byte, key.Size()))
+	if !bytes.Equal(signature, expected) {
+		t.Errorf("expected the PKCS #1 v1.5 signature of crypto/rsa")
+	}
+}
+
+func TestParseSlot(t *testing.T) {
+	if slot, err := ParseSlot("9A"); err != nil || slot != SlotAuthentication {
+		t.Errorf("expected slot 9a, got %s %v", slot, err)
+	}
+	if _, err := ParseSlot("9d"); err == nil {
+		t.Errorf("expected an error for the key management slot")
+	}
+}
@@ -0,0 +1,467 @@
+//go:build cgo && !windows
+
+package pkcs11
+
+/*
+#cgo linux LDFLAGS: -ldl
+
+#include <dlfcn.h>
+#include <stdlib.h>
+#include <string.h>
+
+// The subset of the PKCS#11 v2.40 types this package uses, with the default
+// structure packing of Unix platforms.
+typedef unsigned long CK_ULONG;
+typedef unsigned char CK_BYTE;
+typedef CK_ULONG CK_RV;
+typedef CK_ULONG CK_SLOT_ID;
+typedef CK_ULONG CK_SESSION_HANDLE;
+typedef CK_ULONG CK_OBJECT_HANDLE;
+
+typedef struct {
+	CK_BYTE major;
+	CK_BYTE minor;
+} CK_VERSION;
+
+typedef struct {
+	CK_ULONG type;
+	void *pValue;
+	CK_ULONG ulValueLen;
+} CK_ATTRIBUTE;
+
+typedef struct {
+	CK_ULONG mechanism;
+	void *pParameter;
+	CK_ULONG ulParameterLen;
+} CK_MECHANISM;
+
+typedef struct {
+	CK_ULONG hashAlg;
+	CK_ULONG mgf;
+	CK_ULONG sLen;
+} CK_RSA_PKCS_PSS_PARAMS;
+
+typedef struct {
+	void *CreateMutex;
+	void *DestroyMutex;
+	void *LockMutex;
+	void *UnlockMutex;
+	CK_ULONG flags;
+	void *pReserved;
+} CK_C_INITIALIZE_ARGS;
+
+typedef struct {
+	CK_BYTE label[32];
+	CK_BYTE manufacturerID[32];
+	CK_BYTE model[16];
+	CK_BYTE serialNumber[16];
+	CK_ULONG flags;
+	CK_ULONG ulMaxSessionCount;
+	CK_ULONG ulSessionCount;
+	CK_ULONG ulMaxRwSessionCount;
+	CK_ULONG ulRwSessionCount;
+	CK_ULONG ulMaxPinLen;
+	CK_ULONG ulMinPinLen;
+	CK_ULONG ulTotalPublicMemory;
+	CK_ULONG ulFreePublicMemory;
+	CK_ULONG ulTotalPrivateMemory;
+	CK_ULONG ulFreePrivateMemory;
+	CK_VERSION hardwareVersion;
+	CK_VERSION firmwareVersion;
+	CK_BYTE utcTime[16];
+} CK_TOKEN_INFO;
+
+// CK_FUNCTION_LIST up to C_Sign, in the order of pkcs11f.h.
+typedef struct {
+	CK_VERSION version;
+	CK_RV (*C_Initialize)(void *);
+	CK_RV (*C_Finalize)(void *);
+	void *C_GetInfo;
+	void *C_GetFunctionList;
+	CK_RV (*C_GetSlotList)(CK_BYTE, CK_SLOT_ID *, CK_ULONG *);
+	void *C_GetSlotInfo;
+	CK_RV (*C_GetTokenInfo)(CK_SLOT_ID, CK_TOKEN_INFO *);
+	void *C_GetMechanismList;
+	void *C_GetMechanismInfo;
+	void *C_InitToken;
+	void *C_InitPIN;
+	void *C_SetPIN;
+	CK_RV (*C_OpenSession)(CK_SLOT_ID, CK_ULONG, void *, void *, CK_SESSION_HANDLE *);
+	CK_RV (*C_CloseSession)(CK_SESSION_HANDLE);
+	void *C_CloseAllSessions;
+	void *C_GetSessionInfo;
+	void *C_GetOperationState;
+	void *C_SetOperationState;
+	CK_RV (*C_Login)(CK_SESSION_HANDLE, CK_ULONG, CK_BYTE *, CK_ULONG);
+	CK_RV (*C_Logout)(CK_SESSION_HANDLE);
+	void *C_CreateObject;
+	void *C_CopyObject;
+	void *C_DestroyObject;
+	void *C_GetObjectSize;
+	CK_RV (*C_GetAttributeValue)(CK_SESSION_HANDLE, CK_OBJECT_HANDLE, CK_ATTRIBUTE *, CK_ULONG);
+	void *C_SetAttributeValue;
+	CK_RV (*C_FindObjectsInit)(CK_SESSION_HANDLE, CK_ATTRIBUTE *, CK_ULONG);
+	CK_RV (*C_FindObjects)(CK_SESSION_HANDLE, CK_OBJECT_HANDLE *, CK_ULONG, CK_ULONG *);
+	CK_RV (*C_FindObjectsFinal)(CK_SESSION_HANDLE);
+	void *C_EncryptInit;
+	void *C_Encrypt;
+	void *C_EncryptUpdate;
+	void *C_EncryptFinal;
+	void *C_DecryptInit;
+	void *C_Decrypt;
+	void *C_DecryptUpdate;
+	void *C_DecryptFinal;
+	void *C_DigestInit;
+	void *C_Digest;
+	void *C_DigestUpdate;
+	void *C_DigestKey;
+	void *C_DigestFinal;
+	CK_RV (*C_SignInit)(CK_SESSION_HANDLE, CK_MECHANISM *, CK_OBJECT_HANDLE);
+	CK_RV (*C_Sign)(CK_SESSION_HANDLE, CK_BYTE *, CK_ULONG, CK_BYTE *, CK_ULONG *);
+} CK_FUNCTION_LIST;
+
+typedef CK_RV (*CK_C_GetFunctionList)(CK_FUNCTION_LIST **);
+
+#define CKR_OK 0x0
+#define CKR_USER_ALREADY_LOGGED_IN 0x100
+#define CKR_CRYPTOKI_ALREADY_INITIALIZED 0x191
+#define CKF_OS_LOCKING_OK 0x2
+#define CKF_SERIAL_SESSION 0x4
+#define CKU_USER 0x1
+#define CKA_CLASS 0x0
+#define CKA_LABEL 0x3
+#define CKA_ID 0x102
+
+static CK_RV load_module(const char *path, void **handle, CK_FUNCTION_LIST **functions) {
+	*handle = dlopen(path, RTLD_NOW | RTLD_LOCAL);
+	if (*handle == NULL) {
+		return (CK_RV)-1;
+	}
+	CK_C_GetFunctionList get = (CK_C_GetFunctionList)dlsym(*handle, "C_GetFunctionList");
+	if (get == NULL) {
+		dlclose(*handle);
+		return (CK_RV)-2;
+	}
+	CK_RV rv = get(functions);
+	if (rv != CKR_OK) {
+		dlclose(*handle);
+		return rv;
+	}
+
+	CK_C_INITIALIZE_ARGS args;
+	memset(&args, 0, sizeof(args));
+	args.flags = CKF_OS_LOCKING_OK;
+	rv = (*functions)->C_Initialize(&args);
+	if (rv != CKR_OK && rv != CKR_CRYPTOKI_ALREADY_INITIALIZED) {
+		dlclose(*handle);
+		return rv;
+	}
+	return CKR_OK;
+}
+
+static void unload_module(void *handle, CK_FUNCTION_LIST *functions) {
+	functions->C_Finalize(NULL);
+	dlclose(handle);
+}
+
+static CK_RV slot_list(CK_FUNCTION_LIST *functions, CK_SLOT_ID **slots, CK_ULONG *count) {
+	CK_RV rv = functions->C_GetSlotList(1, NULL, count);
+	if (rv != CKR_OK || *count == 0) {
+		return rv;
+	}
+	*slots = calloc(*count, sizeof(CK_SLOT_ID));
+	return functions->C_GetSlotList(1, *slots, count);
+}
+
+static CK_RV token_label(CK_FUNCTION_LIST *functions, CK_SLOT_ID slot, CK_BYTE *label) {
+	CK_TOKEN_INFO info;
+	CK_RV rv = functions->C_GetTokenInfo(slot, &info);
+	if (rv == CKR_OK) {
+		memcpy(label, info.label, sizeof(info.label));
+	}
+	return rv;
+}
+
+static CK_RV open_session(CK_FUNCTION_LIST *functions, CK_SLOT_ID slot, CK_BYTE *pin, CK_ULONG pin_len, CK_SESSION_HANDLE *session) {
+	CK_RV rv = functions->C_OpenSession(slot, CKF_SERIAL_SESSION, NULL, NULL, session);
+	if (rv != CKR_OK || pin == NULL) {
+		return rv;
+	}
+	rv = functions->C_Login(*session, CKU_USER, pin, pin_len);
+	if (rv != CKR_OK && rv != CKR_USER_ALREADY_LOGGED_IN) {
+		functions->C_CloseSession(*session);
+		return rv;
+	}
+	return CKR_OK;
+}
+
+static CK_RV close_session(CK_FUNCTION_LIST *functions, CK_SESSION_HANDLE session) {
+	return functions->C_CloseSession(session);
+}
+
+static CK_RV find_objects(CK_FUNCTION_LIST *functions, CK_SESSION_HANDLE session, CK_ULONG class,
+		CK_BYTE *label, CK_ULONG label_len, CK_BYTE *id, CK_ULONG id_len,
+		CK_OBJECT_HANDLE *objects, CK_ULONG max, CK_ULONG *count) {
+	CK_ATTRIBUTE template[3];
+	CK_ULONG n = 0;
+	template[n].type = CKA_CLASS;
+	template[n].pValue = &class;
+	template[n].ulValueLen = sizeof(class);
+	n++;
+	if (label != NULL) {
+		template[n].type = CKA_LABEL;
+		template[n].pValue = label;
+		template[n].ulValueLen = label_len;
+		n++;
+	}
+	if (id != NULL) {
+		template[n].type = CKA_ID;
+		template[n].pValue = id;
+		template[n].ulValueLen = id_len;
+		n++;
+	}
+
+	CK_RV rv = functions->C_FindObjectsInit(session, template, n);
+	if (rv != CKR_OK) {
+		return rv;
+	}
+	rv = functions->C_FindObjects(session, objects, max, count);
+	functions->C_FindObjectsFinal(session);
+	return rv;
+}
+
+static CK_RV get_attribute(CK_FUNCTION_LIST *functions, CK_SESSION_HANDLE session, CK_OBJECT_HANDLE object,
+		CK_ULONG type, CK_BYTE **value, CK_ULONG *value_len) {
+	CK_ATTRIBUTE attribute = {type, NULL, 0};
+	CK_RV rv = functions->C_GetAttributeValue(session, object, &attribute, 1);
+	if (rv != CKR_OK) {
+		return rv;
+	}
+	*value = malloc(attribute.ulValueLen + 1);
+	attribute.pValue = *value;
+	rv = functions->C_GetAttributeValue(session, object, &attribute, 1);
+	*value_len = attribute.ulValueLen;
+	return rv;
+}
+
+static CK_RV sign(CK_FUNCTION_LIST *functions, CK_SESSION_HANDLE session, CK_OBJECT_HANDLE key,
+		CK_ULONG mechanism, CK_ULONG hash_alg, CK_ULONG mgf, CK_ULONG salt_length,
+		CK_BYTE *data, CK_ULONG data_len, CK_BYTE **signature, CK_ULONG *signature_len) {
+	CK_RSA_PKCS_PSS_PARAMS params = {hash_alg, mgf, salt_length};
+	CK_MECHANISM m = {mechanism, NULL, 0};
+	if (hash_alg != 0) {
+		m.pParameter = &params;
+		m.ulParameterLen = sizeof(params);
+	}
+
+	CK_RV rv = functions->C_SignInit(session, &m, key);
+	if (rv != CKR_OK) {
+		return rv;
+	}
+	rv = functions->C_Sign(session, data, data_len, NULL, signature_len);
+	if (rv != CKR_OK) {
+		return rv;
+	}
+	*signature = malloc(*signature_len + 1);
+	return functions->C_Sign(session, data, data_len, *signature, signature_len);
+}
+*/
+import "C"
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+// modules holds the loaded PKCS#11 libraries, C_Initialize and C_Finalize
+// apply to the whole process.
+var (
+	modulesMu sync.Mutex
+	modules   = make(map[string]*module)
+)
+
+type module struct {
+	path      string
+	handle    unsafe.Pointer
+	functions *C.CK_FUNCTION_LIST
+	sessions  int
+}
+
+type cgoSession struct {
+	module  *module
+	session C.CK_SESSION_HANDLE
+}
+
+func rvError(function string, rv C.CK_RV) error {
+	return fmt.Errorf("pkcs11: %s failed: CKR 0x%x", function, uint64(rv))
+}
+
+func loadModule(path string) (*module, error) {
+	modulesMu.Lock()
+	defer modulesMu.Unlock()
+
+	if m, ok := modules[path]; ok {
+		m.sessions++
+		return m, nil
+	}
+
+	cpath := C.CString(path)
+	defer C.free(unsafe.Pointer(cpath))
+
+	m := &module{path: path, sessions: 1}
+	if rv := C.load_module(cpath, &m.handle, &m.functions); rv != C.CKR_OK {
+		if rv == ^C.CK_RV(0) {
+			return nil, fmt.Errorf("pkcs11: failed to load %s: %s", path, C.GoString(C.dlerror()))
+		}
+		if rv == ^C.CK_RV(1) {
+			return nil, fmt.Errorf("pkcs11: %s is not a PKCS#11 module", path)
+		}
+		return nil, rvError("C_Initialize", rv)
+	}
+	modules[path] = m
+	return m, nil
+}
+
+func (m *module) release() {
+	modulesMu.Lock()
+	defer modulesMu.Unlock()
+
+	m.sessions--
+	if m.sessions == 0 {
+		C.unload_module(m.handle, m.functions)
+		delete(modules, m.path)
+	}
+}
+
+func (m *module) findSlot(config Config) (C.CK_SLOT_ID, error) {
+	if config.Slot != nil {
+		return C.CK_SLOT_ID(*config.Slot), nil
+	}
+	if config.TokenLabel == "" {
+		return 0, errors.New("pkcs11: slot or token label is required")
+	}
+
+	var slots *C.CK_SLOT_ID
+	var count C.CK_ULONG
+	rv := C.slot_list(m.functions, &slots, &count)
+	if slots != nil {
+		defer C.free(unsafe.Pointer(slots))
+	}
+	if rv != C.CKR_OK {
+		return 0, rvError("C_GetSlotList", rv)
+	}
+
+	for _, slot := range unsafe.Slice(slots, int(count)) {
+		label := make([]byte, 32)
+		if rv := C.token_label(m.functions, slot, (*C.CK_BYTE)(unsafe.Pointer(&label[0]))); rv != C.CKR_OK {
+			continue
+		}
+		// Token labels are padded with blanks.
+		if string(bytes.TrimRight(label, " \x00")) == config.TokenLabel {
+			return slot, nil
+		}
+	}
+	return 0, fmt.Errorf("pkcs11: token %q not found", config.TokenLabel)
+}
+
+func openSession(config Config) (session, error) {
+	if config.Module == "" {
+		return nil, errors.New("pkcs11: module path is required")
+	}
+
+	m, err := loadModule(config.Module)
+	if err != nil {
+		return nil, err
+	}
+
+	slot, err := m.findSlot(config)
+	if err != nil {
+		m.release()
+		return nil, err
+	}
+
+	var pin *C.CK_BYTE
+	if config.PIN != "" {
+		pin = (*C.CK_BYTE)(C.CBytes([]byte(config.PIN)))
+		defer C.free(unsafe.Pointer(pin))
+	}
+
+	s := &cgoSession{module: m}
+	if rv := C.open_session(m.functions, slot, pin, C.CK_ULONG(len(config.PIN)), &s.session); rv != C.CKR_OK {
+		m.release()
+		return nil, rvError("C_OpenSession", rv)
+	}
+	return s, nil
+}
+
+func (s *cgoSession) findObjects(class uint, label string, id []byte) ([]uint, error) {
+	var clabel, cid *C.CK_BYTE
+	if label != "" {
+		clabel = (*C.CK_BYTE)(C.CBytes([]byte(label)))
+		defer C.free(unsafe.Pointer(clabel))
+	}
+	if len(id) > 0 {
+		cid = (*C.CK_BYTE)(C.CBytes(id))
+		defer C.free(unsafe.Pointer(cid))
+	}
+
+	const max = 64
+	objects := (*C.CK_OBJECT_HANDLE)(C.calloc(max, C.size_t(unsafe.Sizeof(C.CK_OBJECT_HANDLE(0)))))
+	defer C.free(unsafe.Pointer(objects))
+
+	var count C.CK_ULONG
+	rv := C.find_objects(s.module.functions, s.session, C.CK_ULONG(class),
+		clabel, C.CK_ULONG(len(label)), cid, C.CK_ULONG(len(id)), objects, max, &count)
+	if rv != C.CKR_OK {
+		return nil, rvError("C_FindObjects", rv)
+	}
+
+	handles := make([]uint, 0, int(count))
+	for _, object := range unsafe.Slice(objects, int(count)) {
+		handles = append(handles, uint(object))
+	}
+	return handles, nil
+}
+
+func (s *cgoSession) attribute(object uint, attributeType uint) ([]byte, error) {
+	var value *C.CK_BYTE
+	var length C.CK_ULONG
+	rv := C.get_attribute(s.module.functions, s.session, C.CK_OBJECT_HANDLE(object), C.CK_ULONG(attributeType), &value, &length)
+	if value != nil {
+		defer C.free(unsafe.Pointer(value))
+	}
+	if rv != C.CKR_OK {
+		return nil, rvError("C_GetAttributeValue", rv)
+	}
+	return C.GoBytes(unsafe.Pointer(value), C.int(length)), nil
+}
+
+func (s *cgoSession) sign(key uint, m mechanism, data []byte) ([]byte, error) {
+	cdata := (*C.CK_BYTE)(C.CBytes(data))
+	defer C.free(unsafe.Pointer(cdata))
+
+	var signature *C.CK_BYTE
+	var length C.CK_ULONG
+	rv := C.sign(s.module.functions, s.session, C.CK_OBJECT_HANDLE(key),
+		C.CK_ULONG(m.mechanism), C.CK_ULONG(m.hashAlg), C.CK_ULONG(m.mgf), C.CK_ULONG(m.saltLength),
+		cdata, C.CK_ULONG(len(data)), &signature, &length)
+	if signature != nil {
+		defer C.free(unsafe.Pointer(signature))
+	}
+	if rv != C.CKR_OK {
+		return nil, rvError("C_Sign", rv)
+	}
+	return C.GoBytes(unsafe.Pointer(signature), C.int(length)), nil
+}
+
+func (s *cgoSession) close() error {
+	rv := C.close_session(s.module.functions, s.session)
+	s.module.release()
+	if rv != C.CKR_OK {
+		return rvError("C_CloseSession", rv)
+	}
+	return nil
+}
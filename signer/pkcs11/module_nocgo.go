@@ -0,0 +1,9 @@
+//go:build !cgo || windows
+
+package pkcs11
+
+import "errors"
+
+func openSession(config Config) (session, error) {
+	return nil, errors.New("pkcs11: loading PKCS#11 modules requires cgo")
+}
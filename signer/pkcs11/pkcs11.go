@@ -0,0 +1,275 @@
+// Package pkcs11 implements a signer for keys on a PKCS#11 token, such as
+// SoftHSM, Thales Luna or Entrust nShield HSMs and smartcards. The PKCS#11
+// library of the token is loaded at runtime, which requires cgo.
+package pkcs11
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sync"
+)
+
+// Object classes, attribute types and mechanisms of PKCS#11 v2.40.
+const (
+	ckoCertificate = 0x1
+	ckoPrivateKey  = 0x3
+
+	ckaID    = 0x102
+	ckaValue = 0x11
+
+	ckmRSAPKCS    = 0x1
+	ckmRSAPKCSPSS = 0xd
+	ckmECDSA      = 0x1041
+)
+
+// Config selects the token and the key to sign with.
+type Config struct {
+	Module     string              // Path of the PKCS#11 library, e.g. /usr/lib/softhsm/libsofthsm2.so
+	Slot       *uint               // Slot ID of the token, or
+	TokenLabel string              // Label of the token, used when Slot is nil
+	PIN        string              // User PIN, the session is not logged in if empty
+	KeyLabel   string              // CKA_LABEL of the private key
+	KeyID      []byte              // CKA_ID of the private key, at least one of KeyLabel and KeyID is required
+	Chain      []*x509.Certificate // Signing certificate followed by its issuers, read from the token if empty
+}
+
+// mechanism is a signature mechanism with the CK_RSA_PKCS_PSS_PARAMS of
+// CKM_RSA_PKCS_PSS.
+type mechanism struct {
+	mechanism  uint
+	hashAlg    uint
+	mgf        uint
+	saltLength uint
+}
+
+// session is the part of a PKCS#11 session that the signer uses.
+type session interface {
+	findObjects(class uint, label string, id []byte) ([]uint, error)
+	attribute(object uint, attributeType uint) ([]byte, error)
+	sign(key uint, mechanism mechanism, data []byte) ([]byte, error)
+	close() error
+}
+
+// Signer signs with a private key on a PKCS#11 token. It implements
+// crypto.Signer and sign.CertificateSigner.
+type Signer struct {
+	mu      sync.Mutex // PKCS#11 sessions can not be used concurrently
+	session session
+	key     uint
+	chain   []*x509.Certificate
+}
+
+// Open logs in to the token and returns the signer of the key. The
+// certificate with the same CKA_ID as the key is the signing certificate,
+// unless Chain is set. Close the signer to end the session.
+func Open(config Config) (*Signer, error) {
+	if config.KeyLabel == "" && len(config.KeyID) == 0 {
+		return nil, errors.New("pkcs11: key label or ID is required")
+	}
+
+	s, err := openSession(config)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := newSigner(s, config)
+	if err != nil {
+		_ = s.close()
+		return nil, err
+	}
+	return signer, nil
+}
+
+func newSigner(s session, config Config) (*Signer, error) {
+	keys, err := s.findObjects(ckoPrivateKey, config.KeyLabel, config.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	switch len(keys) {
+	case 0:
+		return nil, errors.New("pkcs11: private key not found")
+	case 1:
+	default:
+		return nil, fmt.Errorf("pkcs11: %d private keys match, select the key by label and ID", len(keys))
+	}
+
+	chain := config.Chain
+	if len(chain) == 0 {
+		chain, err = tokenChain(s, keys[0])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch chain[0].PublicKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return nil, fmt.Errorf("pkcs11: unsupported key type %T", chain[0].PublicKey)
+	}
+
+	return &Signer{session: s, key: keys[0], chain: chain}, nil
+}
+
+// tokenChain returns the certificate of the key followed by its issuers that
+// are stored on the token.
+func tokenChain(s session, key uint) ([]*x509.Certificate, error) {
+	id, err := s.attribute(key, ckaID)
+	if err != nil {
+		return nil, err
+	}
+
+	objects, err := s.findObjects(ckoCertificate, "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var leaf *x509.Certificate
+	var certificates []*x509.Certificate
+	for _, object := range objects {
+		der, err := s.attribute(object, ckaValue)
+		if err != nil {
+			return nil, err
+		}
+		certificate, err := x509.ParseCertificate(der)
+		if err != nil {
+			continue
+		}
+		certificates = append(certificates, certificate)
+
+		if len(id) > 0 && leaf == nil {
+			certificateID, err := s.attribute(object, ckaID)
+			if err == nil && bytes.Equal(certificateID, id) {
+				leaf = certificate
+			}
+		}
+	}
+	if leaf == nil {
+		return nil, errors.New("pkcs11: no certificate with the ID of the key, set Config.Chain")
+	}
+
+	chain := []*x509.Certificate{leaf}
+	for current := leaf; !bytes.Equal(current.RawIssuer, current.RawSubject); {
+		var issuer *x509.Certificate
+		for _, candidate := range certificates {
+			if bytes.Equal(candidate.RawSubject, current.RawIssuer) && current.CheckSignatureFrom(candidate) == nil {
+				issuer = candidate
+				break
+			}
+		}
+		if issuer == nil || len(chain) > len(certificates) {
+			break
+		}
+		chain = append(chain, issuer)
+		current = issuer
+	}
+
+	return chain, nil
+}
+
+// Public returns the public key of the signing certificate.
+func (s *Signer) Public() crypto.PublicKey {
+	return s.chain[0].PublicKey
+}
+
+// CertificateChain returns the signing certificate followed by its issuers.
+func (s *Signer) CertificateChain() ([]*x509.Certificate, error) {
+	return s.chain, nil
+}
+
+// Sign signs the digest with CKM_RSA_PKCS, CKM_RSA_PKCS_PSS for
+// *rsa.PSSOptions, or CKM_ECDSA.
+func (s *Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	hash := opts.HashFunc()
+	if len(digest) != hash.Size() {
+		return nil, errors.New("pkcs11: digest length does not match the digest algorithm")
+	}
+
+	var m mechanism
+	data := digest
+	switch s.Public().(type) {
+	case *rsa.PublicKey:
+		if pss, ok := opts.(*rsa.PSSOptions); ok {
+			h, ok := hashMechanisms[hash]
+			if !ok {
+				return nil, fmt.Errorf("pkcs11: unsupported digest algorithm %s for RSASSA-PSS", hash)
+			}
+			saltLength := pss.SaltLength
+			if saltLength == rsa.PSSSaltLengthEqualsHash || saltLength == rsa.PSSSaltLengthAuto {
+				saltLength = hash.Size()
+			}
+			m = mechanism{mechanism: ckmRSAPKCSPSS, hashAlg: h.mechanism, mgf: h.mgf, saltLength: uint(saltLength)}
+		} else {
+			prefix, ok := digestInfoPrefixes[hash]
+			if !ok {
+				return nil, fmt.Errorf("pkcs11: unsupported digest algorithm %s", hash)
+			}
+			m = mechanism{mechanism: ckmRSAPKCS}
+			data = append(append([]byte(nil), prefix...), digest...)
+		}
+	case *ecdsa.PublicKey:
+		m = mechanism{mechanism: ckmECDSA}
+	}
+
+	s.mu.Lock()
+	signature, err := s.session.sign(s.key, m, data)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if m.mechanism == ckmECDSA {
+		return ecdsaSignature(signature)
+	}
+	return signature, nil
+}
+
+// Close ends the session with the token.
+func (s *Signer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.session.close()
+}
+
+// hashMechanisms are the CKM and CKG_MGF1 values of the digest algorithms.
+var hashMechanisms = map[crypto.Hash]struct{ mechanism, mgf uint }{
+	crypto.SHA1:     {0x220, 0x1},
+	crypto.SHA256:   {0x250, 0x2},
+	crypto.SHA384:   {0x260, 0x3},
+	crypto.SHA512:   {0x270, 0x4},
+	crypto.SHA3_256: {0x2b0, 0x7},
+	crypto.SHA3_384: {0x2c0, 0x8},
+	crypto.SHA3_512: {0x2d0, 0x9},
+}
+
+// digestInfoPrefixes are the DER encoded DigestInfo headers of RFC 8017,
+// section 9.2, that CKM_RSA_PKCS expects in front of the digest.
+var digestInfoPrefixes = map[crypto.Hash][]byte{
+	crypto.SHA1:     {0x30, 0x21, 0x30, 0x09, 0x06, 0x05, 0x2b, 0x0e, 0x03, 0x02, 0x1a, 0x05, 0x00, 0x04, 0x14},
+	crypto.SHA256:   {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA384:   {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA512:   {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+	crypto.SHA3_256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x08, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA3_384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x09, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA3_512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x0a, 0x05, 0x00, 0x04, 0x40},
+}
+
+// ecdsaSignature converts the CKM_ECDSA signature, the concatenation of r
+// and s, to its ASN.1 encoding.
+func ecdsaSignature(signature []byte) ([]byte, error) {
+	if len(signature) == 0 || len(signature)%2 != 0 {
+		return nil, errors.New("pkcs11: invalid ECDSA signature length")
+	}
+	size := len(signature) / 2
+	return asn1.Marshal(struct{ R, S *big.Int }{
+		R: new(big.Int).SetBytes(signature[:size]),
+		S: new(big.Int).SetBytes(signature[size:]),
+	})
+}
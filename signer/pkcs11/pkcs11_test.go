@@ -0,0 +1,333 @@
+package pkcs11
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/sign"
+	"github.com/digitorus/pdfsign/verify"
+)
+
+type fakeObject struct {
+	class uint
+	label string
+	id    []byte
+	value []byte
+	key   crypto.Signer
+}
+
+// fakeSession is a token with software keys.
+type fakeSession struct {
+	objects       []fakeObject
+	lastMechanism mechanism
+	closed        bool
+}
+
+func (s *fakeSession) findObjects(class uint, label string, id []byte) ([]uint, error) {
+	var handles []uint
+	for i, object := range s.objects {
+		if object.class != class || (label != "" && object.label != label) || (len(id) > 0 && !bytes.Equal(object.id, id)) {
+			continue
+		}
+		handles = append(handles, uint(i))
+	}
+	return handles, nil
+}
+
+func (s *fakeSession) attribute(object uint, attributeType uint) ([]byte, error) {
+	switch attributeType {
+	case ckaID:
+		return s.objects[object].id, nil
+	case ckaValue:
+		return s.objects[object].value, nil
+	}
+	return nil, errors.New("attribute not supported")
+}
+
+func (s *fakeSession) sign(key uint, m mechanism, data []byte) ([]byte, error) {
+	s.lastMechanism = m
+	switch k := s.objects[key].key.(type) {
+	case *rsa.PrivateKey:
+		switch m.mechanism {
+		case ckmRSAPKCS:
+			// Without a hash the data is signed as is, the DigestInfo has
+			// to be part of it.
+			return rsa.SignPKCS1v15(nil, k, crypto.Hash(0), data)
+		case ckmRSAPKCSPSS:
+			for hash, h := range hashMechanisms {
+				if h.mechanism == m.hashAlg && h.mgf == m.mgf {
+					return rsa.SignPSS(rand.Reader, k, hash, data, &rsa.PSSOptions{SaltLength: int(m.saltLength)})
+				}
+			}
+		}
+	case *ecdsa.PrivateKey:
+		if m.mechanism == ckmECDSA {
+			r, s, err := ecdsa.Sign(rand.Reader, k, data)
+			if err != nil {
+				return nil, err
+			}
+			size := (k.Curve.Params().BitSize + 7) / 8
+			signature := make([]byte, 2*size)
+			r.FillBytes(signature[:size])
+			s.FillBytes(signature[size:])
+			return signature, nil
+		}
+	}
+	return nil, errors.New("mechanism not supported")
+}
+
+func (s *fakeSession) close() error {
+	s.closed = true
+	return nil
+}
+
+func createCertificate(t *testing.T, serial int64, name string, key crypto.Signer, issuer *x509.Certificate, issuerKey crypto.Signer) *x509.Certificate {
+	t.Helper()
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  issuer == nil,
+	}
+	if issuer == nil {
+		issuer, issuerKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, key.Public(), issuerKey)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	return certificate
+}
+
+// newFakeToken returns a token with the key, its certificate issued by a CA
+// on the token, and an unrelated certificate.
+func newFakeToken(t *testing.T, key crypto.Signer) (*fakeSession, []*x509.Certificate) {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	ca := createCertificate(t, 1, "pdfsign PKCS#11 test CA", caKey, nil, nil)
+	leaf := createCertificate(t, 2, "pdfsign PKCS#11 test", key, ca, caKey)
+	other := createCertificate(t, 3, "pdfsign PKCS#11 other", otherKey, nil, nil)
+
+	return &fakeSession{objects: []fakeObject{
+		{class: ckoCertificate, id: []byte{2}, value: other.Raw},
+		{class: ckoCertificate, label: "ca", value: ca.Raw},
+		{class: ckoPrivateKey, label: "other", id: []byte{2}, key: otherKey},
+		{class: ckoPrivateKey, label: "signing", id: []byte{1}, key: key},
+		{class: ckoCertificate, label: "signing", id: []byte{1}, value: leaf.Raw},
+	}}, []*x509.Certificate{leaf, ca}
+}
+
+func TestNewSigner(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	token, chain := newFakeToken(t, key)
+
+	signer, err := newSigner(token, Config{KeyLabel: "signing"})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	certificates, err := signer.CertificateChain()
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if len(certificates) != 2 || !certificates[0].Equal(chain[0]) || !certificates[1].Equal(chain[1]) {
+		t.Errorf("expected the chain of the key, got %d certificates", len(certificates))
+	}
+
+	signer, err = newSigner(token, Config{KeyID: []byte{1}, Chain: chain[:1]})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if certificates, _ := signer.CertificateChain(); len(certificates) != 1 {
+		t.Errorf("expected the configured chain, got %d certificates", len(certificates))
+	}
+
+	if _, err := newSigner(token, Config{KeyLabel: "missing"}); err == nil {
+		t.Errorf("expected an error for a missing key")
+	}
+	if _, err := newSigner(token, Config{KeyID: []byte{2}, KeyLabel: "signing"}); err == nil {
+		t.Errorf("expected an error for a label and ID of different keys")
+	}
+
+	token.objects = append(token.objects, fakeObject{class: ckoPrivateKey, label: "signing", id: []byte{3}})
+	if _, err := newSigner(token, Config{KeyLabel: "signing"}); err == nil {
+		t.Errorf("expected an error for an ambiguous label")
+	}
+
+	if err := signer.Close(); err != nil || !token.closed {
+		t.Errorf("expected the session to be closed")
+	}
+}
+
+func TestSignerSign(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	tests := []struct {
+		name      string
+		key       crypto.Signer
+		algorithm sign.SignatureAlgorithm
+		digest    crypto.Hash
+		mechanism uint
+	}{
+		{name: "rsa", key: rsaKey, digest: crypto.SHA256, mechanism: ckmRSAPKCS},
+		{name: "rsa-sha3", key: rsaKey, digest: crypto.SHA3_256, mechanism: ckmRSAPKCS},
+		{name: "rsa-pss", key: rsaKey, algorithm: sign.RSAPSS, digest: crypto.SHA384, mechanism: ckmRSAPKCSPSS},
+		{name: "ecdsa", key: ecdsaKey, digest: crypto.SHA384, mechanism: ckmECDSA},
+	}
+
+	input, err := os.ReadFile("../../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, _ := newFakeToken(t, tt.key)
+			signer, err := newSigner(token, Config{KeyLabel: "signing"})
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			rdr, err := pdf.NewReader(bytes.NewReader(input), int64(len(input)))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			var output bytes.Buffer
+			err = sign.Sign(bytes.NewReader(input), &output, rdr, int64(len(input)), sign.SignData{
+				Signature: sign.SignDataSignature{
+					Info: sign.SignDataSignatureInfo{
+						Name: "John Doe",
+						Date: time.Now().Local(),
+					},
+					CertType: sign.ApprovalSignature,
+				},
+				Signer:             signer,
+				DigestAlgorithm:    tt.digest,
+				SignatureAlgorithm: tt.algorithm,
+			})
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if token.lastMechanism.mechanism != tt.mechanism {
+				t.Errorf("expected mechanism 0x%x, got 0x%x", tt.mechanism, token.lastMechanism.mechanism)
+			}
+
+			info, err := verify.Verify(bytes.NewReader(output.Bytes()), int64(output.Len()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if len(info.Signers) != 1 || !info.Signers[0].ValidSignature {
+				t.Errorf("expected a single valid signature")
+			}
+		})
+	}
+}
+
+func TestSignerSignPSSParameters(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	token, _ := newFakeToken(t, key)
+	signer, err := newSigner(token, Config{KeyLabel: "signing"})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	digest := sha256.Sum256([]byte("pdfsign"))
+	signature, err := signer.Sign(rand.Reader, digest[:], &rsa.PSSOptions{Hash: crypto.SHA256, SaltLength: rsa.PSSSaltLengthEqualsHash})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if token.lastMechanism != (mechanism{mechanism: ckmRSAPKCSPSS, hashAlg: 0x250, mgf: 0x2, saltLength: 32}) {
+		t.Errorf("unexpected mechanism %+v", token.lastMechanism)
+	}
+	if err := rsa.VerifyPSS(&key.PublicKey, crypto.SHA256, digest[:], signature, &rsa.PSSOptions{SaltLength: 32}); err != nil {
+		t.Errorf("%s", err.Error())
+	}
+
+	if _, err := signer.Sign(rand.Reader, digest[:16], crypto.SHA256); err == nil {
+		t.Errorf("expected an error for a truncated digest")
+	}
+}
+
+func TestECDSASignature(t *testing.T) {
+	if _, err := ecdsaSignature([]byte{1, 2, 3}); err == nil {
+		t.Errorf("expected an error for an odd signature length")
+	}
+}
+
+// TestSoftHSM signs with a key on a SoftHSM token, set PDFSIGN_PKCS11_MODULE,
+// PDFSIGN_PKCS11_TOKEN, PDFSIGN_PKCS11_PIN and PDFSIGN_PKCS11_KEY to run it.
+func TestSoftHSM(t *testing.T) {
+	module := os.Getenv("PDFSIGN_PKCS11_MODULE")
+	if module == "" {
+		t.Skip("PDFSIGN_PKCS11_MODULE is not set")
+	}
+
+	signer, err := Open(Config{
+		Module:     module,
+		TokenLabel: os.Getenv("PDFSIGN_PKCS11_TOKEN"),
+		PIN:        os.Getenv("PDFSIGN_PKCS11_PIN"),
+		KeyLabel:   os.Getenv("PDFSIGN_PKCS11_KEY"),
+	})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer func() {
+		_ = signer.Close()
+	}()
+
+	digest := sha256.Sum256([]byte("pdfsign"))
+	signature, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	certificates, _ := signer.CertificateChain()
+	if err := certificates[0].CheckSignature(x509.SHA256WithRSA, []byte("pdfsign"), signature); err != nil {
+		if err := certificates[0].CheckSignature(x509.ECDSAWithSHA256, []byte("pdfsign"), signature); err != nil {
+			t.Errorf("%s", err.Error())
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package pkcs12
+
+import (
+	"encoding/asn1"
+	"errors"
+)
+
+var errInvalidBER = errors.New("pkcs12: invalid BER encoding")
+
+// toDER converts the BER encoding that some implementations, such as older
+// versions of Windows, use for PKCS #12 files to DER: indefinite lengths
+// become definite and constructed OCTET STRINGs are joined.
+func toDER(data []byte) ([]byte, error) {
+	der, rest, err := berElement(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("pkcs12: trailing data after the BER encoding")
+	}
+	return der, nil
+}
+
+// berElement returns the DER encoding of the first element of data and the
+// data after it.
+func berElement(data []byte) ([]byte, []byte, error) {
+	if len(data) < 2 {
+		return nil, nil, errInvalidBER
+	}
+
+	// High tag numbers use more than one identifier octet.
+	n := 1
+	if data[0]&0x1f == 0x1f {
+		for n < len(data) && data[n]&0x80 != 0 {
+			n++
+		}
+		n++
+	}
+	if n >= len(data) {
+		return nil, nil, errInvalidBER
+	}
+	identifier, constructed := data[:n], data[0]&0x20 != 0
+	data = data[n:]
+
+	indefinite := data[0] == 0x80
+	var content, rest []byte
+	switch l := data[0]; {
+	case indefinite:
+		if !constructed {
+			return nil, nil, errInvalidBER
+		}
+		content = data[1:]
+	case l < 0x80:
+		if int(l) > len(data)-1 {
+			return nil, nil, errInvalidBER
+		}
+		content, rest = data[1:1+int(l)], data[1+int(l):]
+	default:
+		k := int(l & 0x7f)
+		if k > 4 || len(data) < 1+k {
+			return nil, nil, errInvalidBER
+		}
+		length := 0
+		for _, b := range data[1 : 1+k] {
+			length = length<<8 | int(b)
+		}
+		if length < 0 || length > len(data)-1-k {
+			return nil, nil, errInvalidBER
+		}
+		content, rest = data[1+k:1+k+length], data[1+k+length:]
+	}
+
+	if !constructed {
+		return encodeTLV(identifier, content), rest, nil
+	}
+
+	var children []byte
+	for {
+		if indefinite {
+			// The end-of-contents octets end an indefinite length.
+			if len(content) >= 2 && content[0] == 0 && content[1] == 0 {
+				rest = content[2:]
+				break
+			}
+		} else if len(content) == 0 {
+			break
+		}
+		child, r, err := berElement(content)
+		if err != nil {
+			return nil, nil, err
+		}
+		children = append(children, child...)
+		content = r
+	}
+
+	// A constructed OCTET STRING is the concatenation of its segments.
+	if len(identifier) == 1 && identifier[0] == 0x24 {
+		octets, err := joinOctets(children)
+		if err != nil {
+			return nil, nil, err
+		}
+		return encodeTLV([]byte{0x04}, octets), rest, nil
+	}
+	return encodeTLV(identifier, children), rest, nil
+}
+
+// joinOctets concatenates the values of a list of DER encoded elements.
+func joinOctets(data []byte) ([]byte, error) {
+	var octets []byte
+	for len(data) > 0 {
+		var segment asn1.RawValue
+		var err error
+		if data, err = asn1.Unmarshal(data, &segment); err != nil {
+			return nil, err
+		}
+		octets = append(octets, segment.Bytes...)
+	}
+	return octets, nil
+}
+
+// encodeTLV returns the element with a DER length.
+func encodeTLV(identifier, content []byte) []byte {
+	out := append([]byte(nil), identifier...)
+	switch n := len(content); {
+	case n < 0x80:
+		out = append(out, byte(n))
+	case n <= 0xff:
+		out = append(out, 0x81, byte(n))
+	case n <= 0xffff:
+		out = append(out, 0x82, byte(n>>8), byte(n))
+	case n <= 0xffffff:
+		out = append(out, 0x83, byte(n>>16), byte(n>>8), byte(n))
+	default:
+		out = append(out, 0x84, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(out, content...)
+}
@@ -0,0 +1,55 @@
+package pkcs12
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestToDER(t *testing.T) {
+	tests := []struct {
+		name     string
+		ber, der []byte
+	}{
+		{
+			name: "der",
+			ber:  []byte{0x30, 0x03, 0x02, 0x01, 0x05},
+			der:  []byte{0x30, 0x03, 0x02, 0x01, 0x05},
+		},
+		{
+			name: "indefinite length",
+			ber:  []byte{0x30, 0x80, 0xa0, 0x80, 0x02, 0x01, 0x05, 0x00, 0x00, 0x00, 0x00},
+			der:  []byte{0x30, 0x05, 0xa0, 0x03, 0x02, 0x01, 0x05},
+		},
+		{
+			name: "constructed octet string",
+			ber:  []byte{0x30, 0x80, 0x24, 0x80, 0x04, 0x02, 0x01, 0x02, 0x04, 0x01, 0x03, 0x00, 0x00, 0x00, 0x00},
+			der:  []byte{0x30, 0x05, 0x04, 0x03, 0x01, 0x02, 0x03},
+		},
+		{
+			name: "long form length",
+			ber:  []byte{0x04, 0x82, 0x00, 0x02, 0x01, 0x02},
+			der:  []byte{0x04, 0x02, 0x01, 0x02},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			der, err := toDER(tt.ber)
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if !bytes.Equal(der, tt.der) {
+				t.Errorf("expected %x, got %x", tt.der, der)
+			}
+		})
+	}
+
+	for _, ber := range [][]byte{
+		{0x30, 0x80, 0x02, 0x01, 0x05},
+		{0x04, 0x80, 0x00, 0x00},
+		{0x30, 0x05, 0x02, 0x01},
+	} {
+		if _, err := toDER(ber); err == nil {
+			t.Errorf("expected an error for %x", ber)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package pkcs12
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"hash"
+	"unicode/utf16"
+
+	// Digest algorithms of the MAC and the key derivation functions.
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+var (
+	oidPBEWithSHAAnd3KeyTripleDESCBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 3}
+	oidPBEWithSHAAnd128BitRC2CBC     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 5}
+	oidPBEWithSHAAnd40BitRC2CBC      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 6}
+	oidPBES2                         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2                        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+
+	oidDESEDE3CBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+	oidAES128CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// hmacHashes are the PRFs of PBKDF2.
+var hmacHashes = map[string]crypto.Hash{
+	"1.2.840.113549.2.7":  crypto.SHA1,
+	"1.2.840.113549.2.8":  crypto.SHA224,
+	"1.2.840.113549.2.9":  crypto.SHA256,
+	"1.2.840.113549.2.10": crypto.SHA384,
+	"1.2.840.113549.2.11": crypto.SHA512,
+}
+
+// digestHashes are the digest algorithms of the MAC.
+var digestHashes = map[string]crypto.Hash{
+	"1.3.14.3.2.26":          crypto.SHA1,
+	"2.16.840.1.101.3.4.2.4": crypto.SHA224,
+	"2.16.840.1.101.3.4.2.1": crypto.SHA256,
+	"2.16.840.1.101.3.4.2.2": crypto.SHA384,
+	"2.16.840.1.101.3.4.2.3": crypto.SHA512,
+}
+
+// pbeParams are the parameters of the PKCS #12 password based encryption
+// schemes, RFC 7292, appendix C.
+type pbeParams struct {
+	Salt       []byte
+	Iterations int
+}
+
+// pbes2Params are the parameters of PBES2, RFC 8018, appendix A.4.
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// pbkdf2Params are the parameters of PBKDF2, RFC 8018, appendix A.2.
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// bmpPassword returns the password as a NUL terminated BMPString, the
+// password format of the PKCS #12 key derivation function.
+func bmpPassword(password string) []byte {
+	encoded := utf16.Encode([]rune(password))
+	b := make([]byte, 0, 2*len(encoded)+2)
+	for _, c := range encoded {
+		b = append(b, byte(c>>8), byte(c))
+	}
+	return append(b, 0, 0)
+}
+
+// deriveKey is the PKCS #12 key derivation function of RFC 7292, appendix
+// B.2: id 1 derives a key, 2 an IV and 3 a MAC key.
+func deriveKey(h crypto.Hash, password, salt []byte, iterations int, id byte, size int) []byte {
+	v := 64
+	if h == crypto.SHA384 || h == crypto.SHA512 {
+		v = 128
+	}
+
+	fill := func(b []byte) []byte {
+		if len(b) == 0 {
+			return nil
+		}
+		n := v * ((len(b) + v - 1) / v)
+		out := make([]byte, n)
+		for i := range out {
+			out[i] = b[i%len(b)]
+		}
+		return out
+	}
+
+	d := make([]byte, v)
+	for i := range d {
+		d[i] = id
+	}
+	i := append(fill(salt), fill(password)...)
+
+	var key []byte
+	for len(key) < size {
+		digest := h.New()
+		digest.Write(d)
+		digest.Write(i)
+		a := digest.Sum(nil)
+		for r := 1; r < iterations; r++ {
+			digest.Reset()
+			digest.Write(a)
+			a = digest.Sum(a[:0])
+		}
+		key = append(key, a...)
+
+		// I_j = (I_j + B + 1) mod 2^v for each v bit block of I.
+		b := fill(a)[:v]
+		for j := 0; j < len(i); j += v {
+			carry := 1
+			for k := v - 1; k >= 0; k-- {
+				carry += int(i[j+k]) + int(b[k])
+				i[j+k] = byte(carry)
+				carry >>= 8
+			}
+		}
+	}
+	return key[:size]
+}
+
+// decrypt decrypts data that is encrypted with a PKCS #12 password based
+// encryption scheme or with PBES2.
+func decrypt(algorithm pkix.AlgorithmIdentifier, password string, data []byte) ([]byte, error) {
+	var block cipher.Block
+	var iv []byte
+
+	switch {
+	case algorithm.Algorithm.Equal(oidPBES2):
+		var params pbes2Params
+		if _, err := asn1.Unmarshal(algorithm.Parameters.FullBytes, &params); err != nil {
+			return nil, fmt.Errorf("pkcs12: invalid PBES2 parameters: %w", err)
+		}
+		var err error
+		if block, iv, err = pbes2Cipher(params, password); err != nil {
+			return nil, err
+		}
+	case algorithm.Algorithm.Equal(oidPBEWithSHAAnd3KeyTripleDESCBC),
+		algorithm.Algorithm.Equal(oidPBEWithSHAAnd128BitRC2CBC),
+		algorithm.Algorithm.Equal(oidPBEWithSHAAnd40BitRC2CBC):
+		var params pbeParams
+		if _, err := asn1.Unmarshal(algorithm.Parameters.FullBytes, &params); err != nil {
+			return nil, fmt.Errorf("pkcs12: invalid PBE parameters: %w", err)
+		}
+		p := bmpPassword(password)
+		switch {
+		case algorithm.Algorithm.Equal(oidPBEWithSHAAnd3KeyTripleDESCBC):
+			var err error
+			if block, err = des.NewTripleDESCipher(deriveKey(crypto.SHA1, p, params.Salt, params.Iterations, 1, 24)); err != nil {
+				return nil, err
+			}
+		case algorithm.Algorithm.Equal(oidPBEWithSHAAnd128BitRC2CBC):
+			block = newRC2Cipher(deriveKey(crypto.SHA1, p, params.Salt, params.Iterations, 1, 16), 128)
+		default:
+			block = newRC2Cipher(deriveKey(crypto.SHA1, p, params.Salt, params.Iterations, 1, 5), 40)
+		}
+		iv = deriveKey(crypto.SHA1, p, params.Salt, params.Iterations, 2, 8)
+	default:
+		return nil, fmt.Errorf("pkcs12: unsupported encryption algorithm %s", algorithm.Algorithm)
+	}
+
+	if len(data) == 0 || len(data)%block.BlockSize() != 0 {
+		return nil, errors.New("pkcs12: invalid encrypted data length")
+	}
+	decrypted := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, data)
+
+	// A wrong password results in invalid padding in most cases.
+	padding := int(decrypted[len(decrypted)-1])
+	if padding == 0 || padding > block.BlockSize() {
+		return nil, ErrIncorrectPassword
+	}
+	for _, b := range decrypted[len(decrypted)-padding:] {
+		if int(b) != padding {
+			return nil, ErrIncorrectPassword
+		}
+	}
+	return decrypted[:len(decrypted)-padding], nil
+}
+
+// pbes2Cipher returns the cipher and the IV of PBES2 with PBKDF2. The
+// password is used as UTF-8, like OpenSSL does.
+func pbes2Cipher(params pbes2Params, password string) (cipher.Block, []byte, error) {
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, nil, fmt.Errorf("pkcs12: unsupported key derivation function %s", params.KeyDerivationFunc.Algorithm)
+	}
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, nil, fmt.Errorf("pkcs12: invalid PBKDF2 parameters: %w", err)
+	}
+	prf := crypto.SHA1
+	if len(kdf.PRF.Algorithm) > 0 {
+		var ok bool
+		if prf, ok = hmacHashes[kdf.PRF.Algorithm.String()]; !ok {
+			return nil, nil, fmt.Errorf("pkcs12: unsupported PBKDF2 PRF %s", kdf.PRF.Algorithm)
+		}
+	}
+
+	var newCipher func([]byte) (cipher.Block, error)
+	var size int
+	switch scheme := params.EncryptionScheme.Algorithm; {
+	case scheme.Equal(oidAES128CBC):
+		newCipher, size = aes.NewCipher, 16
+	case scheme.Equal(oidAES192CBC):
+		newCipher, size = aes.NewCipher, 24
+	case scheme.Equal(oidAES256CBC):
+		newCipher, size = aes.NewCipher, 32
+	case scheme.Equal(oidDESEDE3CBC):
+		newCipher, size = des.NewTripleDESCipher, 24
+	default:
+		return nil, nil, fmt.Errorf("pkcs12: unsupported encryption scheme %s", scheme)
+	}
+	if kdf.KeyLength != 0 && kdf.KeyLength != size {
+		return nil, nil, errors.New("pkcs12: PBKDF2 key length does not match the encryption scheme")
+	}
+
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, nil, fmt.Errorf("pkcs12: invalid IV: %w", err)
+	}
+	key := pbkdf2.Key([]byte(password), kdf.Salt, kdf.IterationCount, size, prf.New)
+	block, err := newCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(iv) != block.BlockSize() {
+		return nil, nil, errors.New("pkcs12: invalid IV length")
+	}
+	return block, iv, nil
+}
+
+// verifyMAC checks the MAC of the authenticated safe, RFC 7292, section 5.
+func verifyMAC(mac macData, password []byte, content []byte) error {
+	h, ok := digestHashes[mac.MAC.Algorithm.Algorithm.String()]
+	if !ok {
+		return fmt.Errorf("pkcs12: unsupported MAC algorithm %s", mac.MAC.Algorithm.Algorithm)
+	}
+	key := deriveKey(h, password, mac.MACSalt, mac.Iterations, 3, h.Size())
+	m := hmac.New(func() hash.Hash { return h.New() }, key)
+	m.Write(content)
+	if !hmac.Equal(m.Sum(nil), mac.MAC.Digest) {
+		return ErrIncorrectPassword
+	}
+	return nil
+}
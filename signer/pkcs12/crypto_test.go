@@ -0,0 +1,32 @@
+package pkcs12
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/hex"
+	"testing"
+)
+
+func TestDeriveKey(t *testing.T) {
+	tests := []struct {
+		password []byte
+		salt     string
+		expected string
+	}{
+		{bmpPassword("sesame"), "ffffffffffffffff", "7cd9fd3e2b3be7691a44e3bef0f9ea0fb9b897d4e325d9d1"},
+		// I ends with a leading zero byte after the first block.
+		{bmpPassword(""), "f37e05b518324b4b", "00f759ff47d14dd03665d5943cb3c4a39a2555c02aed66e1"},
+	}
+	for _, tt := range tests {
+		salt, _ := hex.DecodeString(tt.salt)
+		if key := hex.EncodeToString(deriveKey(crypto.SHA1, tt.password, salt, 2048, 1, 24)); key != tt.expected {
+			t.Errorf("expected key %s, got %s", tt.expected, key)
+		}
+	}
+}
+
+func TestBMPPassword(t *testing.T) {
+	if p := bmpPassword("Bé😀"); !bytes.Equal(p, []byte{0x00, 0x42, 0x00, 0xe9, 0xd8, 0x3d, 0xde, 0x00, 0x00, 0x00}) {
+		t.Errorf("unexpected BMPString %x", p)
+	}
+}
@@ -0,0 +1,302 @@
+// Package pkcs12 loads the private key and the certificate chain of a
+// PKCS #12 file (.p12 or .pfx). Besides the legacy encryption schemes with
+// 3DES and RC2, it decrypts files that use PBES2 with AES, the default of
+// OpenSSL 3 and current versions of Windows and macOS.
+package pkcs12
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrIncorrectPassword is returned when the MAC or the decryption of the file
+// fails with the password.
+var ErrIncorrectPassword = errors.New("pkcs12: incorrect password")
+
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidEncryptedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 6}
+
+	oidKeyBag              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 1}
+	oidPKCS8ShroudedKeyBag = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidCertBag             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidX509Certificate     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+)
+
+// ASN.1 structures of RFC 7292.
+type pfx struct {
+	Version  int
+	AuthSafe contentInfo
+	MACData  macData `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"tag:0,explicit,optional"`
+}
+
+type macData struct {
+	MAC        digestInfo
+	MACSalt    []byte
+	Iterations int `asn1:"optional,default:1"`
+}
+
+type digestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+type encryptedData struct {
+	Version              int
+	EncryptedContentInfo struct {
+		ContentType                asn1.ObjectIdentifier
+		ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+		EncryptedContent           asn1.RawValue `asn1:"tag:0,optional"`
+	}
+}
+
+type safeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue   `asn1:"tag:0,explicit"`
+	Attributes []asn1.RawValue `asn1:"set,optional"`
+}
+
+type certBag struct {
+	ID   asn1.ObjectIdentifier
+	Data []byte `asn1:"tag:0,explicit"`
+}
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// Bundle is the private key and the certificates of a PKCS #12 file. It
+// implements crypto.Signer and sign.CertificateSigner, and can be used as
+// SignData.Signer.
+type Bundle struct {
+	PrivateKey  crypto.Signer
+	Certificate *x509.Certificate   // Certificate of the private key
+	Chain       []*x509.Certificate // Certificate followed by its issuers in the file, in order
+}
+
+// Load reads and decodes a PKCS #12 file.
+func Load(path, password string) (*Bundle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(data, password)
+}
+
+// Decode decodes a PKCS #12 file with a private key and its certificate.
+// Certificates that are not part of the chain of the private key are
+// ignored.
+func Decode(data []byte, password string) (*Bundle, error) {
+	der, err := toDER(data)
+	if err != nil {
+		return nil, err
+	}
+	var p pfx
+	if _, err := asn1.Unmarshal(der, &p); err != nil {
+		return nil, fmt.Errorf("pkcs12: invalid file: %w", err)
+	}
+	if p.Version != 3 {
+		return nil, fmt.Errorf("pkcs12: unsupported version %d", p.Version)
+	}
+	if !p.AuthSafe.ContentType.Equal(oidData) {
+		return nil, errors.New("pkcs12: only password integrity mode is supported")
+	}
+	var authSafe []byte
+	if _, err := asn1.Unmarshal(p.AuthSafe.Content.Bytes, &authSafe); err != nil {
+		return nil, fmt.Errorf("pkcs12: invalid authenticated safe: %w", err)
+	}
+
+	if len(p.MACData.MAC.Algorithm.Algorithm) > 0 {
+		err := verifyMAC(p.MACData, bmpPassword(password), authSafe)
+		// An empty password is also written without the NUL terminator.
+		if errors.Is(err, ErrIncorrectPassword) && password == "" {
+			err = verifyMAC(p.MACData, nil, authSafe)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	bags, err := safeBags(authSafe, password)
+	if err != nil {
+		return nil, err
+	}
+
+	var key crypto.Signer
+	var certificates []*x509.Certificate
+	for _, bag := range bags {
+		switch {
+		case bag.ID.Equal(oidKeyBag), bag.ID.Equal(oidPKCS8ShroudedKeyBag):
+			if key != nil {
+				return nil, errors.New("pkcs12: more than one private key")
+			}
+			if key, err = privateKey(bag, password); err != nil {
+				return nil, err
+			}
+		case bag.ID.Equal(oidCertBag):
+			var c certBag
+			if _, err := asn1.Unmarshal(bag.Value.Bytes, &c); err != nil {
+				return nil, fmt.Errorf("pkcs12: invalid certificate bag: %w", err)
+			}
+			if !c.ID.Equal(oidX509Certificate) {
+				continue
+			}
+			certificate, err := x509.ParseCertificate(c.Data)
+			if err != nil {
+				return nil, fmt.Errorf("pkcs12: invalid certificate: %w", err)
+			}
+			certificates = append(certificates, certificate)
+		}
+	}
+	if key == nil {
+		return nil, errors.New("pkcs12: no private key")
+	}
+
+	public, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool })
+	for _, certificate := range certificates {
+		if ok && public.Equal(certificate.PublicKey) {
+			return &Bundle{
+				PrivateKey:  key,
+				Certificate: certificate,
+				Chain:       orderChain(certificate, certificates),
+			}, nil
+		}
+	}
+	return nil, errors.New("pkcs12: no certificate for the private key")
+}
+
+// safeBags returns the bags of all safe contents of the authenticated safe,
+// decrypting the encrypted ones.
+func safeBags(authSafe []byte, password string) ([]safeBag, error) {
+	der, err := toDER(authSafe)
+	if err != nil {
+		return nil, err
+	}
+	var contents []contentInfo
+	if _, err := asn1.Unmarshal(der, &contents); err != nil {
+		return nil, fmt.Errorf("pkcs12: invalid authenticated safe: %w", err)
+	}
+
+	var bags []safeBag
+	for _, content := range contents {
+		var data []byte
+		switch {
+		case content.ContentType.Equal(oidData):
+			if _, err := asn1.Unmarshal(content.Content.Bytes, &data); err != nil {
+				return nil, fmt.Errorf("pkcs12: invalid safe contents: %w", err)
+			}
+		case content.ContentType.Equal(oidEncryptedData):
+			var encrypted encryptedData
+			if _, err := asn1.Unmarshal(content.Content.Bytes, &encrypted); err != nil {
+				return nil, fmt.Errorf("pkcs12: invalid encrypted data: %w", err)
+			}
+			info := encrypted.EncryptedContentInfo
+			// The encrypted content is an implicitly tagged OCTET STRING,
+			// which BER allows to be constructed.
+			ciphertext := info.EncryptedContent.Bytes
+			if info.EncryptedContent.IsCompound {
+				if ciphertext, err = joinOctets(ciphertext); err != nil {
+					return nil, fmt.Errorf("pkcs12: invalid encrypted data: %w", err)
+				}
+			}
+			if data, err = decrypt(info.ContentEncryptionAlgorithm, password, ciphertext); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("pkcs12: unsupported content type %s", content.ContentType)
+		}
+
+		if der, err = toDER(data); err != nil {
+			return nil, err
+		}
+		var safeContents []safeBag
+		if _, err := asn1.Unmarshal(der, &safeContents); err != nil {
+			return nil, fmt.Errorf("pkcs12: invalid safe contents: %w", err)
+		}
+		bags = append(bags, safeContents...)
+	}
+	return bags, nil
+}
+
+// privateKey returns the PKCS #8 private key of a key bag or a shrouded key
+// bag.
+func privateKey(bag safeBag, password string) (crypto.Signer, error) {
+	der := bag.Value.Bytes
+	if bag.ID.Equal(oidPKCS8ShroudedKeyBag) {
+		var info encryptedPrivateKeyInfo
+		if _, err := asn1.Unmarshal(der, &info); err != nil {
+			return nil, fmt.Errorf("pkcs12: invalid shrouded key bag: %w", err)
+		}
+		var err error
+		if der, err = decrypt(info.Algorithm, password, info.EncryptedData); err != nil {
+			return nil, err
+		}
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs12: invalid private key: %w", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("pkcs12: unsupported private key type %T", key)
+	}
+	return signer, nil
+}
+
+// orderChain returns the certificate followed by its issuers, found by name
+// and, if both are present, by key identifier. Certificates are not checked,
+// the signature and the validity of the chain are verified when signing and
+// verifying.
+func orderChain(certificate *x509.Certificate, certificates []*x509.Certificate) []*x509.Certificate {
+	chain := []*x509.Certificate{certificate}
+	used := map[*x509.Certificate]bool{certificate: true}
+	for current := certificate; !bytes.Equal(current.RawIssuer, current.RawSubject); {
+		var issuer *x509.Certificate
+		for _, c := range certificates {
+			if used[c] || !bytes.Equal(current.RawIssuer, c.RawSubject) {
+				continue
+			}
+			if len(current.AuthorityKeyId) > 0 && len(c.SubjectKeyId) > 0 && !bytes.Equal(current.AuthorityKeyId, c.SubjectKeyId) {
+				continue
+			}
+			issuer = c
+			break
+		}
+		if issuer == nil {
+			break
+		}
+		chain = append(chain, issuer)
+		used[issuer] = true
+		current = issuer
+	}
+	return chain
+}
+
+// Public returns the public key of the private key.
+func (b *Bundle) Public() crypto.PublicKey {
+	return b.PrivateKey.Public()
+}
+
+// Sign signs the digest with the private key.
+func (b *Bundle) Sign(random io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return b.PrivateKey.Sign(random, digest, opts)
+}
+
+// CertificateChain returns the certificate followed by its issuers.
+func (b *Bundle) CertificateChain() ([]*x509.Certificate, error) {
+	return b.Chain, nil
+}
@@ -0,0 +1,118 @@
+package pkcs12
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/sign"
+	"github.com/digitorus/pdfsign/verify"
+)
+
+// The test files were created with OpenSSL 3, with the chain in the order
+// root, intermediate:
+//
+//	openssl pkcs12 -export -inkey leaf.key -in leaf.crt -certfile chain.pem -out pdfsign-aes.p12
+//	openssl pkcs12 -export -legacy -inkey leaf.key -in leaf.crt -certfile chain.pem -out pdfsign-legacy.p12
+//	openssl pkcs12 -export -inkey ec.key -in ec.crt -certfile chain.pem -macalg sha512 \
+//		-keypbe AES-128-CBC -certpbe AES-128-CBC -passout pass: -out pdfsign-ecdsa.p12
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		file     string
+		password string
+		subject  string
+		rsa      bool
+	}{
+		{file: "pdfsign-aes.p12", password: "pdfsign", subject: "pdfsign test signer", rsa: true},
+		{file: "pdfsign-legacy.p12", password: "pdfsign", subject: "pdfsign test signer", rsa: true},
+		{file: "pdfsign-ecdsa.p12", subject: "pdfsign test ecdsa signer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			bundle, err := Load("../../testfiles/"+tt.file, tt.password)
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			if bundle.Certificate.Subject.CommonName != tt.subject {
+				t.Errorf("expected certificate %s, got %s", tt.subject, bundle.Certificate.Subject.CommonName)
+			}
+			switch bundle.PrivateKey.(type) {
+			case *rsa.PrivateKey:
+				if !tt.rsa {
+					t.Errorf("expected an ECDSA key")
+				}
+			case *ecdsa.PrivateKey:
+				if tt.rsa {
+					t.Errorf("expected an RSA key")
+				}
+			}
+
+			var names []string
+			for _, c := range bundle.Chain {
+				names = append(names, c.Subject.CommonName)
+			}
+			if len(names) != 3 || names[0] != tt.subject || names[1] != "pdfsign test intermediate" || names[2] != "pdfsign test root" {
+				t.Errorf("unexpected chain order %q", names)
+			}
+		})
+	}
+}
+
+func TestLoadIncorrectPassword(t *testing.T) {
+	for _, file := range []string{"pdfsign-aes.p12", "pdfsign-legacy.p12", "pdfsign-ecdsa.p12"} {
+		if _, err := Load("../../testfiles/"+file, "incorrect"); !errors.Is(err, ErrIncorrectPassword) {
+			t.Errorf("%s: expected ErrIncorrectPassword, got %v", file, err)
+		}
+	}
+}
+
+func TestBundleSignPDF(t *testing.T) {
+	bundle, err := Load("../../testfiles/pdfsign-aes.p12", "pdfsign")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	input, err := os.ReadFile("../../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	rdr, err := pdf.NewReader(bytes.NewReader(input), int64(len(input)))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	var output bytes.Buffer
+	err = sign.Sign(bytes.NewReader(input), &output, rdr, int64(len(input)), sign.SignData{
+		Signature: sign.SignDataSignature{
+			Info: sign.SignDataSignatureInfo{
+				Name: "John Doe",
+				Date: time.Now().Local(),
+			},
+			CertType: sign.ApprovalSignature,
+		},
+		Signer:          bundle,
+		DigestAlgorithm: crypto.SHA256,
+	})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	info, err := verify.Verify(bytes.NewReader(output.Bytes()), int64(output.Len()))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if len(info.Signers) != 1 || !info.Signers[0].ValidSignature {
+		t.Fatalf("expected a single valid signature")
+	}
+	if len(info.Signers[0].Certificates) != 3 {
+		t.Errorf("expected the chain of 3 certificates in the signature, got %d", len(info.Signers[0].Certificates))
+	}
+}
@@ -0,0 +1,40 @@
+package pkcs12
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// TestRC2 uses the test vectors of RFC 2268, section 5.
+func TestRC2(t *testing.T) {
+	tests := []struct {
+		key, plaintext, ciphertext string
+		bits                       int
+	}{
+		{"0000000000000000", "0000000000000000", "ebb773f993278eff", 63},
+		{"ffffffffffffffff", "ffffffffffffffff", "278b27e42e2f0d49", 64},
+		{"3000000000000000", "1000000000000001", "30649edf9be7d2c2", 64},
+		{"88", "0000000000000000", "61a8a244adacccf0", 64},
+		{"88bca90e90875a", "0000000000000000", "6ccf4308974c267f", 64},
+		{"88bca90e90875a7f0f79c384627bafb2", "0000000000000000", "1a807d272bbe5db1", 64},
+		{"88bca90e90875a7f0f79c384627bafb2", "0000000000000000", "2269552ab0f85ca6", 128},
+		{"88bca90e90875a7f0f79c384627bafb216f80a6f85920584c42fceb0be255daf1e", "0000000000000000", "5b78d3a43dfff1f1", 129},
+	}
+	for _, tt := range tests {
+		key, _ := hex.DecodeString(tt.key)
+		plaintext, _ := hex.DecodeString(tt.plaintext)
+		ciphertext, _ := hex.DecodeString(tt.ciphertext)
+
+		block := newRC2Cipher(key, tt.bits)
+		out := make([]byte, 8)
+		block.Encrypt(out, plaintext)
+		if !bytes.Equal(out, ciphertext) {
+			t.Errorf("key %s: expected ciphertext %x, got %x", tt.key, ciphertext, out)
+		}
+		block.Decrypt(out, ciphertext)
+		if !bytes.Equal(out, plaintext) {
+			t.Errorf("key %s: expected plaintext %x, got %x", tt.key, plaintext, out)
+		}
+	}
+}
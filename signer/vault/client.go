@@ -0,0 +1,203 @@
+// Package vault implements a signer for keys of the transit secrets engine of
+// HashiCorp Vault, with the HTTP API of Vault.
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Config holds the settings of the Vault server and the transit mount.
+type Config struct {
+	Address    string       // Defaults to VAULT_ADDR
+	Token      string       // Defaults to VAULT_TOKEN
+	Namespace  string       // Vault Enterprise namespace, defaults to VAULT_NAMESPACE
+	Mount      string       // Mount path of the transit secrets engine, defaults to "transit"
+	HTTPClient *http.Client // Defaults to http.DefaultClient
+}
+
+// Client calls the transit secrets engine.
+type Client struct {
+	config Config
+}
+
+// Error is an error response of Vault.
+type Error struct {
+	StatusCode int
+	Errors     []string `json:"errors"`
+}
+
+func (e *Error) Error() string {
+	if len(e.Errors) > 0 {
+		return fmt.Sprintf("vault: %s (%d)", strings.Join(e.Errors, "; "), e.StatusCode)
+	}
+	return fmt.Sprintf("vault: %s (%d)", http.StatusText(e.StatusCode), e.StatusCode)
+}
+
+// Key is the public part of a transit key.
+type Key struct {
+	Name          string // Name of the key
+	Type          string // rsa-2048, rsa-3072, rsa-4096, ecdsa-p256, ecdsa-p384, ecdsa-p521 or ed25519
+	LatestVersion int
+	PublicKeys    map[int]string // PEM encoded public keys by version
+}
+
+// SignRequest is the request of the sign endpoint for a prehashed input.
+type SignRequest struct {
+	Name                string `json:"-"`
+	HashAlgorithm       string `json:"-"` // e.g. sha2-256 or sha3-384
+	Input               []byte `json:"input"`
+	Prehashed           bool   `json:"prehashed"`
+	KeyVersion          int    `json:"key_version,omitempty"`
+	SignatureAlgorithm  string `json:"signature_algorithm,omitempty"` // pss or pkcs1v15 for RSA keys
+	SaltLength          string `json:"salt_length,omitempty"`
+	MarshalingAlgorithm string `json:"marshaling_algorithm,omitempty"` // asn1 or jws for ECDSA keys
+}
+
+// NewClient returns a client of the transit mount in config.
+func NewClient(config Config) *Client {
+	if config.Address == "" {
+		config.Address = os.Getenv("VAULT_ADDR")
+	}
+	if config.Token == "" {
+		config.Token = os.Getenv("VAULT_TOKEN")
+	}
+	if config.Namespace == "" {
+		config.Namespace = os.Getenv("VAULT_NAMESPACE")
+	}
+	if config.Mount == "" {
+		config.Mount = "transit"
+	}
+	config.Address = strings.TrimSuffix(config.Address, "/")
+	config.Mount = strings.Trim(config.Mount, "/")
+	return &Client{config: config}
+}
+
+// ReadKey returns the type and the public keys of a transit key.
+func (c *Client) ReadKey(ctx context.Context, name string) (*Key, error) {
+	var response struct {
+		Name          string `json:"name"`
+		Type          string `json:"type"`
+		LatestVersion int    `json:"latest_version"`
+		Keys          map[int]struct {
+			PublicKey string `json:"public_key"`
+		} `json:"keys"`
+	}
+	if err := c.call(ctx, http.MethodGet, "keys/"+url.PathEscape(name), nil, &response); err != nil {
+		return nil, err
+	}
+
+	key := &Key{
+		Name:          response.Name,
+		Type:          response.Type,
+		LatestVersion: response.LatestVersion,
+		PublicKeys:    make(map[int]string, len(response.Keys)),
+	}
+	for version, k := range response.Keys {
+		key.PublicKeys[version] = k.PublicKey
+	}
+	return key, nil
+}
+
+// Sign returns the signature of the request.
+func (c *Client) Sign(ctx context.Context, request SignRequest) ([]byte, error) {
+	path := "sign/" + url.PathEscape(request.Name)
+	if request.HashAlgorithm != "" {
+		path += "/" + url.PathEscape(request.HashAlgorithm)
+	}
+
+	var response struct {
+		Signature string `json:"signature"`
+	}
+	if err := c.call(ctx, http.MethodPost, path, request, &response); err != nil {
+		return nil, err
+	}
+
+	// Signatures are prefixed with the key version, e.g. vault:v1:MEUCIQ...
+	parts := strings.SplitN(response.Signature, ":", 3)
+	if len(parts) != 3 || parts[0] != "vault" {
+		return nil, errors.New("vault: invalid signature format")
+	}
+	signature, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("vault: invalid signature encoding: %w", err)
+	}
+	return signature, nil
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.config.HTTPClient != nil {
+		return c.config.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// call sends the JSON request to the mount path and decodes the data of the
+// response.
+func (c *Client) call(ctx context.Context, method, path string, request, data interface{}) error {
+	if c.config.Address == "" {
+		return errors.New("vault: address is required")
+	}
+
+	var body io.Reader
+	if request != nil {
+		encoded, err := json.Marshal(request)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.config.Address+"/v1/"+c.config.Mount+"/"+path, body)
+	if err != nil {
+		return fmt.Errorf("vault: failed to prepare request: %w", err)
+	}
+	if request != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.config.Token != "" {
+		req.Header.Set("X-Vault-Token", c.config.Token)
+	}
+	if c.config.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.config.Namespace)
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("vault: %s failed: %w", path, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	encoded, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("vault: failed to read %s response: %w", path, err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		e := &Error{StatusCode: resp.StatusCode}
+		_ = json.Unmarshal(encoded, e)
+		return e
+	}
+
+	var response struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(encoded, &response); err != nil || len(response.Data) == 0 {
+		return fmt.Errorf("vault: invalid %s response", path)
+	}
+	if err := json.Unmarshal(response.Data, data); err != nil {
+		return fmt.Errorf("vault: invalid %s response: %w", path, err)
+	}
+	return nil
+}
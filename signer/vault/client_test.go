@@ -0,0 +1,158 @@
+package vault
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testService is a Vault server with the transit key "pdf" mounted at
+// signing/transit, in the namespace "team".
+type testService struct {
+	*httptest.Server
+	key         crypto.Signer
+	certificate *x509.Certificate
+	lastRequest SignRequest
+	lastHash    string
+}
+
+func newTestService(t *testing.T, key crypto.Signer, keyType string) *testService {
+	t.Helper()
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "pdfsign Vault test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	public, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	publicPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public}))
+
+	s := &testService{key: key, certificate: certificate}
+
+	fail := func(w http.ResponseWriter, status int, message string) {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(map[string][]string{"errors": {message}})
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/signing/transit/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" || r.Header.Get("X-Vault-Namespace") != "team" {
+			fail(w, http.StatusForbidden, "permission denied")
+			return
+		}
+
+		path := strings.TrimPrefix(r.URL.Path, "/v1/signing/transit/")
+		switch {
+		case r.Method == http.MethodGet && path == "keys/pdf":
+			// Version 2 is the latest, version 1 was rotated.
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{
+				"name":           "pdf",
+				"type":           keyType,
+				"latest_version": 2,
+				"keys": map[string]interface{}{
+					"1": map[string]string{"public_key": ""},
+					"2": map[string]string{"public_key": publicPEM},
+				},
+			}})
+		case r.Method == http.MethodPost && strings.HasPrefix(path, "sign/pdf/"):
+			var request SignRequest
+			if json.NewDecoder(r.Body).Decode(&request) != nil || !request.Prehashed || request.KeyVersion != 2 {
+				fail(w, http.StatusBadRequest, "invalid request")
+				return
+			}
+			s.lastRequest = request
+			s.lastHash = strings.TrimPrefix(path, "sign/pdf/")
+
+			var opts crypto.SignerOpts
+			for hash, name := range hashAlgorithms {
+				if name == s.lastHash {
+					opts = hash
+				}
+			}
+			if opts == nil {
+				fail(w, http.StatusBadRequest, "unsupported hash algorithm")
+				return
+			}
+			if request.SignatureAlgorithm == "pss" {
+				opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: opts.HashFunc()}
+			}
+			signature, err := key.Sign(rand.Reader, request.Input, opts)
+			if err != nil {
+				fail(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{
+				"signature": "vault:v2:" + base64.StdEncoding.EncodeToString(signature),
+			}})
+		default:
+			fail(w, http.StatusNotFound, "no handler for route")
+		}
+	})
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func newTestClient(service *testService) *Client {
+	return NewClient(Config{Address: service.URL, Token: "token", Namespace: "team", Mount: "/signing/transit/"})
+}
+
+func TestClientError(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	service := newTestService(t, key, "ecdsa-p256")
+
+	var e *Error
+	_, err = NewClient(Config{Address: service.URL, Token: "other", Namespace: "team", Mount: "signing/transit"}).ReadKey(context.Background(), "pdf")
+	if !errors.As(err, &e) || e.StatusCode != http.StatusForbidden || len(e.Errors) != 1 || e.Errors[0] != "permission denied" {
+		t.Fatalf("expected a permission denied error, got %v", err)
+	}
+
+	_, err = newTestClient(service).ReadKey(context.Background(), "missing")
+	if !errors.As(err, &e) || e.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected a not found error, got %v", err)
+	}
+}
+
+func TestNewClientEnvironment(t *testing.T) {
+	t.Setenv("VAULT_ADDR", "https://vault.example.com:8200/")
+	t.Setenv("VAULT_TOKEN", "token")
+	t.Setenv("VAULT_NAMESPACE", "")
+
+	client := NewClient(Config{})
+	if client.config.Address != "https://vault.example.com:8200" || client.config.Token != "token" || client.config.Mount != "transit" {
+		t.Errorf("unexpected config %+v", client.config)
+	}
+}
@@ -0,0 +1,124 @@
+package vault
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// hashAlgorithms are the hash_algorithm names of the sign endpoint.
+var hashAlgorithms = map[crypto.Hash]string{
+	crypto.SHA1:     "sha1",
+	crypto.SHA256:   "sha2-256",
+	crypto.SHA384:   "sha2-384",
+	crypto.SHA512:   "sha2-512",
+	crypto.SHA3_256: "sha3-256",
+	crypto.SHA3_384: "sha3-384",
+	crypto.SHA3_512: "sha3-512",
+}
+
+// Signer signs with a version of a transit key. It implements crypto.Signer
+// and sign.CertificateSigner.
+type Signer struct {
+	client  *Client
+	name    string
+	version int
+	public  crypto.PublicKey
+	chain   []*x509.Certificate
+}
+
+// NewSigner returns the signer of the latest version of a transit key with an
+// RSA or ECDSA key type. Transit does not store certificates, chain is the
+// certificate of the key followed by its issuers.
+func (c *Client) NewSigner(ctx context.Context, name string, chain []*x509.Certificate) (*Signer, error) {
+	if len(chain) == 0 {
+		return nil, errors.New("vault: certificate chain is required")
+	}
+
+	key, err := c.ReadKey(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// The version is pinned, a rotation while signing would not match the
+	// certificate.
+	block, _ := pem.Decode([]byte(key.PublicKeys[key.LatestVersion]))
+	if block == nil {
+		return nil, fmt.Errorf("vault: key %s of type %s has no PEM public key", name, key.Type)
+	}
+	public, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("vault: unsupported public key: %w", err)
+	}
+	switch public.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return nil, fmt.Errorf("vault: unsupported key type %s", key.Type)
+	}
+
+	certified, ok := chain[0].PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !certified.Equal(public) {
+		return nil, fmt.Errorf("vault: certificate does not match version %d of key %s", key.LatestVersion, name)
+	}
+
+	return &Signer{
+		client:  c,
+		name:    name,
+		version: key.LatestVersion,
+		public:  public,
+		chain:   chain,
+	}, nil
+}
+
+// Public returns the public key of the key version.
+func (s *Signer) Public() crypto.PublicKey {
+	return s.public
+}
+
+// CertificateChain returns the signing certificate followed by its issuers.
+func (s *Signer) CertificateChain() ([]*x509.Certificate, error) {
+	return s.chain, nil
+}
+
+// Sign signs the prehashed digest. RSA keys sign with PKCS #1 v1.5, or PSS
+// with a salt as long as the digest for *rsa.PSSOptions; ECDSA signatures are
+// ASN.1 encoded.
+func (s *Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	hash := opts.HashFunc()
+	name, ok := hashAlgorithms[hash]
+	if !ok {
+		return nil, fmt.Errorf("vault: unsupported digest algorithm %s", hash)
+	}
+	if len(digest) != hash.Size() {
+		return nil, errors.New("vault: digest length does not match the digest algorithm")
+	}
+
+	request := SignRequest{
+		Name:          s.name,
+		HashAlgorithm: name,
+		Input:         digest,
+		Prehashed:     true,
+		KeyVersion:    s.version,
+	}
+	switch s.public.(type) {
+	case *rsa.PublicKey:
+		request.SignatureAlgorithm = "pkcs1v15"
+		if pss, ok := opts.(*rsa.PSSOptions); ok {
+			if pss.SaltLength != rsa.PSSSaltLengthEqualsHash && pss.SaltLength != rsa.PSSSaltLengthAuto && pss.SaltLength != hash.Size() {
+				return nil, errors.New("vault: RSASSA-PSS requires a salt length equal to the digest length")
+			}
+			request.SignatureAlgorithm = "pss"
+			request.SaltLength = "hash"
+		}
+	case *ecdsa.PublicKey:
+		request.MarshalingAlgorithm = "asn1"
+	}
+
+	return s.client.Sign(context.Background(), request)
+}
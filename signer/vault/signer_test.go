@@ -0,0 +1,105 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/sign"
+	"github.com/digitorus/pdfsign/verify"
+)
+
+func TestSignerSignPDF(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	tests := []struct {
+		name      string
+		key       crypto.Signer
+		keyType   string
+		digest    crypto.Hash
+		algorithm sign.SignatureAlgorithm
+		hash      string
+		signature string
+	}{
+		{name: "rsa", key: rsaKey, keyType: "rsa-2048", digest: crypto.SHA256, hash: "sha2-256", signature: "pkcs1v15"},
+		{name: "rsa-pss", key: rsaKey, keyType: "rsa-2048", digest: crypto.SHA512, algorithm: sign.RSAPSS, hash: "sha2-512", signature: "pss"},
+		{name: "ecdsa", key: ecdsaKey, keyType: "ecdsa-p384", digest: crypto.SHA384, hash: "sha2-384"},
+		{name: "ecdsa-sha3", key: ecdsaKey, keyType: "ecdsa-p384", digest: crypto.SHA3_384, hash: "sha3-384"},
+	}
+
+	input, err := os.ReadFile("../../testfiles/testfile20.pdf")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := newTestService(t, tt.key, tt.keyType)
+			signer, err := newTestClient(service).NewSigner(context.Background(), "pdf", []*x509.Certificate{service.certificate})
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			rdr, err := pdf.NewReader(bytes.NewReader(input), int64(len(input)))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			var output bytes.Buffer
+			err = sign.Sign(bytes.NewReader(input), &output, rdr, int64(len(input)), sign.SignData{
+				Signature: sign.SignDataSignature{
+					Info: sign.SignDataSignatureInfo{
+						Name: "John Doe",
+						Date: time.Now().Local(),
+					},
+					CertType: sign.ApprovalSignature,
+				},
+				Signer:             signer,
+				DigestAlgorithm:    tt.digest,
+				SignatureAlgorithm: tt.algorithm,
+			})
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if service.lastHash != tt.hash || service.lastRequest.SignatureAlgorithm != tt.signature {
+				t.Errorf("expected %s %s, got %s %s", tt.hash, tt.signature, service.lastHash, service.lastRequest.SignatureAlgorithm)
+			}
+
+			info, err := verify.Verify(bytes.NewReader(output.Bytes()), int64(output.Len()))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if len(info.Signers) != 1 || !info.Signers[0].ValidSignature {
+				t.Errorf("expected a single valid signature")
+			}
+		})
+	}
+}
+
+func TestNewSignerUnsupportedKey(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	service := newTestService(t, key, "ed25519")
+	if _, err := newTestClient(service).NewSigner(context.Background(), "pdf", []*x509.Certificate{service.certificate}); err == nil {
+		t.Errorf("expected an error for an Ed25519 key")
+	}
+}
@@ -0,0 +1,246 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/digitorus/pdf"
+)
+
+// DefaultAATLURL is the location of the Adobe Approved Trust List.
+const DefaultAATLURL = "https://trustlist.adobe.com/tl12.acrobatsecuritysettings"
+
+// AATLProvider is a TrustProvider of the certificates of the Adobe Approved
+// Trust List, the roots Acrobat and Reader trust out of the box. The list is
+// a PDF with the security settings of Acrobat as an embedded XML file, it is
+// kept for the RefreshInterval and stored in the Cache to share it between
+// runs.
+//
+// The list is only used when its document signature is valid, covers the
+// whole list and chains to one of the Roots, the root of Adobe that signs
+// the list, which must be given.
+type AATLProvider struct {
+	Roots           []*x509.Certificate // Roots the signature of the list must chain to, required
+	URL             string              // HTTPS location of the list, DefaultAATLURL if empty
+	Path            string              // Read the list from this file instead of downloading it
+	HTTPClient      *http.Client        // Client for the download, VerifyOptions.HTTPClient or a client with a timeout of 30 seconds if nil
+	Cache           RevocationCache     // Stores the downloaded list for the RefreshInterval, nothing is stored if nil
+	RefreshInterval time.Duration       // How long the list is used before it is loaded again, 24 hours if zero
+
+	mu      sync.Mutex
+	anchors []TrustAnchor
+	err     error
+	expires time.Time
+}
+
+// TrustAnchors implements TrustProvider. Identities that cannot be parsed
+// are reported in the error, the anchors of the others are returned.
+func (p *AATLProvider) TrustAnchors(ctx context.Context) ([]TrustAnchor, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.expires.After(time.Now()) {
+		return p.anchors, p.err
+	}
+
+	data, err := p.fetchList(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the Adobe Approved Trust List: %w", err)
+	}
+	anchors, err := ParseAATL(data)
+	if err != nil {
+		err = fmt.Errorf("failed to parse the Adobe Approved Trust List: %w", err)
+		if len(anchors) == 0 {
+			return nil, err
+		}
+	}
+
+	p.anchors, p.err = anchors, err
+	p.expires = time.Now().Add(p.refreshInterval())
+	return p.anchors, p.err
+}
+
+// refreshInterval returns the RefreshInterval, 24 hours if it is zero.
+func (p *AATLProvider) refreshInterval() time.Duration {
+	if p.RefreshInterval == 0 {
+		return 24 * time.Hour
+	}
+	return p.RefreshInterval
+}
+
+// fetchList returns the list from the Path, the Cache or the URL, after
+// its signature is verified. A cached list with an invalid signature is
+// downloaded again.
+func (p *AATLProvider) fetchList(ctx context.Context) ([]byte, error) {
+	if len(p.Roots) == 0 {
+		return nil, errors.New("no roots to verify the signature of the list")
+	}
+	if p.Path != "" {
+		data, err := os.ReadFile(p.Path)
+		if err != nil {
+			return nil, err
+		}
+		if err := verifyAATL(data, p.Roots); err != nil {
+			return nil, fmt.Errorf("invalid list %s: %w", p.Path, err)
+		}
+		return data, nil
+	}
+
+	url := p.URL
+	if url == "" {
+		url = DefaultAATLURL
+	}
+	key := "aatl/" + url
+	if p.Cache != nil {
+		if data := p.Cache.Get(key); data != nil && verifyAATL(data, p.Roots) == nil {
+			return data, nil
+		}
+	}
+
+	data, err := downloadTrustList(ctx, p.HTTPClient, url)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyAATL(data, p.Roots); err != nil {
+		return nil, fmt.Errorf("invalid list %s: %w", url, err)
+	}
+	if anchors, err := ParseAATL(data); len(anchors) == 0 {
+		return nil, err
+	}
+	if p.Cache != nil {
+		_ = p.Cache.Put(key, data, time.Now().Add(p.refreshInterval()))
+	}
+	return data, nil
+}
+
+// verifyAATL verifies that the list data is a PDF with a valid document
+// signature that covers all of it, by a certificate that chains to one of
+// the roots. Only the roots are trusted, not the system roots.
+func verifyAATL(data []byte, roots []*x509.Certificate) error {
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		return errors.New("the list is not a signed PDF document")
+	}
+	anchors := make(rootTrust, 0, len(roots))
+	for _, root := range roots {
+		anchors = append(anchors, TrustAnchor{Certificate: root, Source: "aatl"})
+	}
+	response, err := VerifyWithOptions(bytes.NewReader(data), int64(len(data)), &VerifyOptions{
+		TrustProviders:     []TrustProvider{anchors},
+		DisableSystemRoots: true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to verify the signature of the list: %w", err)
+	}
+	for _, s := range response.Signers {
+		if s.SignatureType == "signature" && s.ValidSignature && s.TrustedIssuer && !s.RevokedCertificate &&
+			s.ByteRangeValid && !s.ModifiedAfterSigning {
+			return nil
+		}
+	}
+	return errors.New("the list has no valid signature of a certificate of the roots that covers all of it")
+}
+
+// rootTrust is a TrustProvider of fixed anchors.
+type rootTrust []TrustAnchor
+
+// TrustAnchors implements TrustProvider.
+func (r rootTrust) TrustAnchors(context.Context) ([]TrustAnchor, error) {
+	return r, nil
+}
+
+// securitySettings is the XML of the security settings of Acrobat, of which
+// the trusted identities are the certificates of the list.
+type securitySettings struct {
+	XMLName    xml.Name `xml:"SecuritySettings"`
+	Identities []struct {
+		Certificates []string `xml:"Certificate"`
+	} `xml:"TrustedIdentities>Identity"`
+}
+
+// ParseAATL returns the trust anchors of the Adobe Approved Trust List data,
+// the PDF that is distributed or the security settings XML embedded in it.
+func ParseAATL(data []byte) ([]TrustAnchor, error) {
+	if bytes.HasPrefix(data, []byte("%PDF-")) {
+		embedded, err := securitySettingsFile(data)
+		if err != nil {
+			return nil, err
+		}
+		data = embedded
+	}
+
+	var settings securitySettings
+	if err := xml.Unmarshal(data, &settings); err != nil {
+		return nil, fmt.Errorf("invalid security settings: %w", err)
+	}
+
+	var anchors []TrustAnchor
+	var errs []error
+	for _, identity := range settings.Identities {
+		for _, encoded := range identity.Certificates {
+			der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(encoded), ""))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid trusted identity: %w", err))
+				continue
+			}
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid trusted identity: %w", err))
+				continue
+			}
+			anchors = append(anchors, TrustAnchor{
+				Certificate: cert,
+				Source:      "aatl",
+			})
+		}
+	}
+	if len(anchors) == 0 {
+		return nil, errors.Join(append(errs, errors.New("no trusted identities"))...)
+	}
+	return anchors, errors.Join(errs...)
+}
+
+// securitySettingsFile returns the first embedded file of the PDF document,
+// which holds the security settings.
+func securitySettingsFile(document []byte) (settings []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			settings, err = nil, fmt.Errorf("failed to read the trust list (%v)", r)
+		}
+	}()
+
+	rdr, err := pdf.NewReader(bytes.NewReader(document), int64(len(document)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the trust list: %w", err)
+	}
+
+	// The file specifications are in the name tree of EmbeddedFiles
+	nodes := []pdf.Value{rdr.Trailer().Key("Root").Key("Names").Key("EmbeddedFiles")}
+	for len(nodes) > 0 {
+		node := nodes[0]
+		nodes = nodes[1:]
+		names := node.Key("Names")
+		for i := 1; i < names.Len(); i += 2 {
+			stream := names.Index(i).Key("EF").Key("F")
+			if stream.Kind() != pdf.Stream {
+				continue
+			}
+			return io.ReadAll(stream.Reader())
+		}
+		kids := node.Key("Kids")
+		for i := 0; i < kids.Len(); i++ {
+			nodes = append(nodes, kids.Index(i))
+		}
+	}
+	return nil, errors.New("the trust list has no embedded security settings")
+}
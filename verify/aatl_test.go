@@ -0,0 +1,225 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pkcs7"
+)
+
+// newTestAATL returns the security settings XML with the certificates as
+// trusted identities, and a PDF that embeds it like the distributed list.
+func newTestAATL(t *testing.T, certificates ...[]byte) (settings, document []byte) {
+	t.Helper()
+
+	settings = []byte("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<SecuritySettings>\n<TrustedIdentities>\n")
+	for _, der := range certificates {
+		settings = fmt.Appendf(settings, "<Identity>\n<ImportAction>3</ImportAction>\n<Certificate>%s</Certificate>\n</Identity>\n",
+			base64.StdEncoding.EncodeToString(der))
+	}
+	settings = append(settings, "</TrustedIdentities>\n</SecuritySettings>\n"...)
+
+	document, _ = appendRevision([]byte("%PDF-1.7\n"), 0, map[int]string{
+		1: "<< /Type /Catalog /Pages 2 0 R /AcroForm << /Fields [] /SigFlags 3 >> /Names << /EmbeddedFiles << /Names [(SecuritySettings.xml) 3 0 R] >> >> >>",
+		2: "<< /Type /Pages /Kids [] /Count 0 >>",
+		3: "<< /Type /Filespec /F (SecuritySettings.xml) /EF << /F 4 0 R >> >>",
+		4: fmt.Sprintf("<< /Type /EmbeddedFile /Length %d >>\nstream\n%s\nendstream", len(settings), settings),
+	})
+	return settings, document
+}
+
+// signTestAATL returns the document with a signature of cert in a new
+// revision, whose byte range covers all of the document but the contents of
+// the signature, like the distributed list.
+func signTestAATL(t *testing.T, document []byte, cert *x509.Certificate, key *ecdsa.PrivateKey) []byte {
+	t.Helper()
+
+	placeholder := "[0 0000000000 0000000000 0000000000]"
+	signed, _ := appendRevision(document, lastXref(t, document), map[int]string{
+		10: fmt.Sprintf("<< /Type /Sig /Filter /Adobe.PPKLite /SubFilter /adbe.pkcs7.detached /ByteRange %s /Contents <%s> >>",
+			placeholder, strings.Repeat("0", 8192)),
+	})
+
+	start := bytes.Index(signed, []byte("/Contents <")) + len("/Contents ")
+	end := start + 8192 + 2
+	byteRange := fmt.Sprintf("[0 %010d %010d %010d]", start, end, len(signed)-end)
+	copy(signed[bytes.Index(signed, []byte(placeholder)):], byteRange)
+
+	sd, err := pkcs7.NewSignedData(append(append([]byte(nil), signed[:start]...), signed[end:]...))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	sd.SetDigestAlgorithm(pkcs7.OIDDigestAlgorithmSHA256)
+	if err := sd.AddSigner(cert, key, pkcs7.SignerInfoConfig{}); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	sd.Detach()
+	der, err := sd.Finish()
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	hex.Encode(signed[start+1:], der)
+	return signed
+}
+
+// lastXref returns the offset of the last cross-reference table of the
+// document.
+func lastXref(t *testing.T, document []byte) int {
+	t.Helper()
+
+	startxref := bytes.LastIndex(document, []byte("startxref\n")) + len("startxref\n")
+	xref, err := strconv.Atoi(string(bytes.Fields(document[startxref:])[0]))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	return xref
+}
+
+func TestParseAATL(t *testing.T) {
+	root, _ := newTestCRLIssuer(t, "pdfsign Approved Root")
+	other, _ := newTestCRLIssuer(t, "pdfsign Other Root")
+	settings, document := newTestAATL(t, root.Raw, other.Raw)
+
+	for name, data := range map[string][]byte{"XML": settings, "PDF": document} {
+		t.Run(name, func(t *testing.T) {
+			anchors, err := ParseAATL(data)
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if len(anchors) != 2 {
+				t.Fatalf("expected 2 trust anchors, got %d", len(anchors))
+			}
+			if !anchors[0].Certificate.Equal(root) || !anchors[1].Certificate.Equal(other) || anchors[0].Source != "aatl" {
+				t.Errorf("expected the trusted identities as aatl anchors, got %+v", anchors)
+			}
+		})
+	}
+
+	// Invalid identities are reported with the others
+	_, invalid := newTestAATL(t, root.Raw, []byte("invalid"))
+	anchors, err := ParseAATL(invalid)
+	if err == nil || len(anchors) != 1 {
+		t.Errorf("expected 1 trust anchor and an error, got %d and %v", len(anchors), err)
+	}
+
+	if _, err := ParseAATL([]byte("%PDF-1.7\nnot a document")); err == nil {
+		t.Errorf("expected an error for an invalid document")
+	}
+	if _, err := ParseAATL([]byte("<SecuritySettings/>")); err == nil {
+		t.Errorf("expected an error without trusted identities")
+	}
+}
+
+func TestAATLProvider(t *testing.T) {
+	adobe, adobeKey := newTestCRLIssuer(t, "pdfsign Adobe Root")
+	root, _ := newTestCRLIssuer(t, "pdfsign Approved Root")
+	_, list := newTestAATL(t, root.Raw)
+	document := signTestAATL(t, list, adobe, adobeKey)
+	roots := []*x509.Certificate{adobe}
+
+	var requests atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		_, _ = w.Write(document)
+	}))
+	defer server.Close()
+
+	cache := NewMemoryRevocationCache()
+	provider := &AATLProvider{Roots: roots, URL: server.URL, Cache: cache, HTTPClient: server.Client()}
+	for range 2 {
+		anchors, err := provider.TrustAnchors(context.Background())
+		if err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+		if len(anchors) != 1 || !anchors[0].Certificate.Equal(root) {
+			t.Fatalf("expected the approved root as trust anchor, got %+v", anchors)
+		}
+	}
+	if requests.Load() != 1 {
+		t.Errorf("expected 1 download, got %d", requests.Load())
+	}
+
+	// The list is shared through the cache
+	other := &AATLProvider{Roots: roots, URL: server.URL, Cache: cache, HTTPClient: server.Client()}
+	if _, err := other.TrustAnchors(context.Background()); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if requests.Load() != 1 {
+		t.Errorf("expected the list to be read from the cache")
+	}
+
+	// A cached list with an invalid signature is downloaded again
+	_ = cache.Put("aatl/"+server.URL, list, time.Now().Add(time.Hour))
+	tampered := &AATLProvider{Roots: roots, URL: server.URL, Cache: cache, HTTPClient: server.Client()}
+	if anchors, err := tampered.TrustAnchors(context.Background()); err != nil || len(anchors) != 1 {
+		t.Errorf("expected 1 trust anchor of the downloaded list, got %d and %v", len(anchors), err)
+	}
+	if requests.Load() != 2 {
+		t.Errorf("expected the unsigned cached list to be downloaded again")
+	}
+
+	path := filepath.Join(t.TempDir(), "tl12.acrobatsecuritysettings")
+	if err := os.WriteFile(path, document, 0o600); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	file := &AATLProvider{Roots: roots, Path: path}
+	if anchors, err := file.TrustAnchors(context.Background()); err != nil || len(anchors) != 1 {
+		t.Errorf("expected 1 trust anchor from the file, got %d and %v", len(anchors), err)
+	}
+}
+
+func TestAATLProviderSignature(t *testing.T) {
+	adobe, adobeKey := newTestCRLIssuer(t, "pdfsign Adobe Root")
+	other, otherKey := newTestCRLIssuer(t, "pdfsign Other Root")
+	root, _ := newTestCRLIssuer(t, "pdfsign Approved Root")
+	settings, list := newTestAATL(t, root.Raw)
+	signed := signTestAATL(t, list, adobe, adobeKey)
+	modified, _ := appendRevision(signed, lastXref(t, signed), map[int]string{
+		2: "<< /Type /Pages /Kids [] /Count 0 /Modified true >>",
+	})
+
+	tests := []struct {
+		name    string
+		data    []byte
+		roots   []*x509.Certificate
+		wantErr bool
+	}{
+		{name: "signed", data: signed, roots: []*x509.Certificate{other, adobe}},
+		{name: "without roots", data: signed, wantErr: true},
+		{name: "unsigned", data: list, roots: []*x509.Certificate{adobe}, wantErr: true},
+		{name: "security settings", data: settings, roots: []*x509.Certificate{adobe}, wantErr: true},
+		{name: "other signer", data: signTestAATL(t, list, other, otherKey), roots: []*x509.Certificate{adobe}, wantErr: true},
+		{name: "modified after signing", data: modified, roots: []*x509.Certificate{adobe}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tl12.acrobatsecuritysettings")
+			if err := os.WriteFile(path, tt.data, 0o600); err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			provider := &AATLProvider{Roots: tt.roots, Path: path}
+			anchors, err := provider.TrustAnchors(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %t, got %v", tt.wantErr, err)
+			}
+			if err != nil && len(anchors) > 0 {
+				t.Errorf("expected no trust anchors of an invalid list, got %d", len(anchors))
+			}
+		})
+	}
+}
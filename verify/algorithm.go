@@ -0,0 +1,379 @@
+package verify
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/digitorus/pkcs7"
+	_ "golang.org/x/crypto/sha3" // Registers the SHA-3 digest algorithms
+)
+
+var (
+	oidAttributeMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidAttributeSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidSignatureRSA           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidSignatureRSAPSS        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+	oidMGF1                   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 8}
+	oidSignatureEd25519       = asn1.ObjectIdentifier{1, 3, 101, 112}
+	oidPublicKeyECDSA         = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+)
+
+// ecdsaCurveOIDs are the named curves, which some signers give as the
+// signature algorithm of ECDSA signatures instead of id-ecPublicKey.
+var ecdsaCurveOIDs = map[elliptic.Curve]asn1.ObjectIdentifier{
+	elliptic.P224(): {1, 3, 132, 0, 33},
+	elliptic.P256(): {1, 2, 840, 10045, 3, 1, 7},
+	elliptic.P384(): {1, 3, 132, 0, 34},
+	elliptic.P521(): {1, 3, 132, 0, 35},
+}
+
+var hashOIDs = map[crypto.Hash]asn1.ObjectIdentifier{
+	crypto.SHA1:     {1, 3, 14, 3, 2, 26},
+	crypto.SHA224:   {2, 16, 840, 1, 101, 3, 4, 2, 4},
+	crypto.SHA256:   {2, 16, 840, 1, 101, 3, 4, 2, 1},
+	crypto.SHA384:   {2, 16, 840, 1, 101, 3, 4, 2, 2},
+	crypto.SHA512:   {2, 16, 840, 1, 101, 3, 4, 2, 3},
+	crypto.SHA3_256: {2, 16, 840, 1, 101, 3, 4, 2, 8},
+	crypto.SHA3_384: {2, 16, 840, 1, 101, 3, 4, 2, 9},
+	crypto.SHA3_512: {2, 16, 840, 1, 101, 3, 4, 2, 10},
+}
+
+// rsaOIDs are the sha*WithRSAEncryption (RFC 4055) and
+// id-rsassa-pkcs1-v1_5-with-sha3 (RFC 8702) signature algorithms.
+var rsaOIDs = map[crypto.Hash]asn1.ObjectIdentifier{
+	crypto.SHA1:     {1, 2, 840, 113549, 1, 1, 5},
+	crypto.SHA256:   {1, 2, 840, 113549, 1, 1, 11},
+	crypto.SHA384:   {1, 2, 840, 113549, 1, 1, 12},
+	crypto.SHA512:   {1, 2, 840, 113549, 1, 1, 13},
+	crypto.SHA3_256: {2, 16, 840, 1, 101, 3, 4, 3, 14},
+	crypto.SHA3_384: {2, 16, 840, 1, 101, 3, 4, 3, 15},
+	crypto.SHA3_512: {2, 16, 840, 1, 101, 3, 4, 3, 16},
+}
+
+// ecdsaOIDs are the ecdsa-with-SHA2 (RFC 5758) and id-ecdsa-with-sha3 (RFC
+// 8702) signature algorithms.
+var ecdsaOIDs = map[crypto.Hash]asn1.ObjectIdentifier{
+	crypto.SHA1:     {1, 2, 840, 10045, 4, 1},
+	crypto.SHA224:   {1, 2, 840, 10045, 4, 3, 1},
+	crypto.SHA256:   {1, 2, 840, 10045, 4, 3, 2},
+	crypto.SHA384:   {1, 2, 840, 10045, 4, 3, 3},
+	crypto.SHA512:   {1, 2, 840, 10045, 4, 3, 4},
+	crypto.SHA3_256: {2, 16, 840, 1, 101, 3, 4, 3, 10},
+	crypto.SHA3_384: {2, 16, 840, 1, 101, 3, 4, 3, 11},
+	crypto.SHA3_512: {2, 16, 840, 1, 101, 3, 4, 3, 12},
+}
+
+// ecdsaPlainOIDs are the ecdsa-plain signature algorithms of BSI TR-03111,
+// whose signature values are the concatenation of r and s instead of their
+// DER encoding.
+var ecdsaPlainOIDs = map[crypto.Hash]asn1.ObjectIdentifier{
+	crypto.SHA1:     {0, 4, 0, 127, 0, 7, 1, 1, 4, 1, 1},
+	crypto.SHA224:   {0, 4, 0, 127, 0, 7, 1, 1, 4, 1, 2},
+	crypto.SHA256:   {0, 4, 0, 127, 0, 7, 1, 1, 4, 1, 3},
+	crypto.SHA384:   {0, 4, 0, 127, 0, 7, 1, 1, 4, 1, 4},
+	crypto.SHA512:   {0, 4, 0, 127, 0, 7, 1, 1, 4, 1, 5},
+	crypto.SHA3_256: {0, 4, 0, 127, 0, 7, 1, 1, 4, 1, 9},
+	crypto.SHA3_384: {0, 4, 0, 127, 0, 7, 1, 1, 4, 1, 10},
+	crypto.SHA3_512: {0, 4, 0, 127, 0, 7, 1, 1, 4, 1, 11},
+}
+
+// pssParameters reflects RSASSA-PSS-params, see RFC 4055, section 3.1. The
+// hash and mask generation function left out default to SHA-1 and MGF1 with
+// SHA-1.
+type pssParameters struct {
+	Hash         pkix.AlgorithmIdentifier `asn1:"optional,explicit,tag:0"`
+	MGF          pkix.AlgorithmIdentifier `asn1:"optional,explicit,tag:1"`
+	SaltLength   int                      `asn1:"optional,explicit,tag:2,default:20"`
+	TrailerField int                      `asn1:"optional,explicit,tag:3,default:1"`
+}
+
+// attribute mirrors the pkcs7 attribute, to marshal the signed attributes.
+type attribute struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue `asn1:"set"`
+}
+
+func hashForOID(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	for hash, hashOID := range hashOIDs {
+		if hashOID.Equal(oid) {
+			return hash, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported digest algorithm %s", oid)
+}
+
+func isRSAWithDigest(oid asn1.ObjectIdentifier, hash crypto.Hash) bool {
+	rsaOID, ok := rsaOIDs[hash]
+	return ok && rsaOID.Equal(oid)
+}
+
+// requiresLocalVerification reports whether one of the signers uses an
+// algorithm the pkcs7 package can not verify, or not in all its forms:
+// RSASSA-PSS, ECDSA and Ed25519 signatures, and SHA-224 and SHA-3 digests.
+func requiresLocalVerification(p7 *pkcs7.PKCS7) bool {
+	for _, s := range p7.Signers {
+		algorithm := s.DigestEncryptionAlgorithm.Algorithm
+		if algorithm.Equal(oidSignatureRSAPSS) || algorithm.Equal(oidSignatureEd25519) || isECDSAAlgorithm(algorithm) {
+			return true
+		}
+		switch hash, _ := hashForOID(s.DigestAlgorithm.Algorithm); hash {
+		case crypto.SHA224, crypto.SHA3_256, crypto.SHA3_384, crypto.SHA3_512:
+			return true
+		}
+	}
+	return false
+}
+
+// isECDSAAlgorithm reports whether oid identifies ECDSA signatures, with
+// any digest or value encoding.
+func isECDSAAlgorithm(oid asn1.ObjectIdentifier) bool {
+	if oid.Equal(oidPublicKeyECDSA) {
+		return true
+	}
+	for _, oids := range []map[crypto.Hash]asn1.ObjectIdentifier{ecdsaOIDs, ecdsaPlainOIDs} {
+		for _, o := range oids {
+			if o.Equal(oid) {
+				return true
+			}
+		}
+	}
+	for _, o := range ecdsaCurveOIDs {
+		if o.Equal(oid) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyECDSA reports whether signature is a valid ECDSA signature of digest
+// by key, DER encoded or the concatenation of r and s. The plain encoding is
+// tried first when plain is set.
+func verifyECDSA(key *ecdsa.PublicKey, digest, signature []byte, plain bool) bool {
+	verifyPlain := func() bool {
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(key, digest, r, s)
+	}
+	if plain && verifyPlain() {
+		return true
+	}
+	if ecdsa.VerifyASN1(key, digest, signature) {
+		return true
+	}
+	return !plain && verifyPlain()
+}
+
+// pssOptions returns the verification options for RSASSA-PSS parameters,
+// with the defaults of RFC 4055 for the parameters left out, or for all of
+// them when parameters is absent. Any salt length is accepted, but only MGF1
+// with the same hash as the digest and the trailer field 0xbc.
+func pssOptions(parameters asn1.RawValue, digest pkix.AlgorithmIdentifier) (*rsa.PSSOptions, error) {
+	params := pssParameters{SaltLength: 20, TrailerField: 1}
+	if len(parameters.FullBytes) > 0 && !bytes.Equal(parameters.FullBytes, asn1.NullBytes) {
+		if _, err := asn1.Unmarshal(parameters.FullBytes, &params); err != nil {
+			return nil, fmt.Errorf("invalid RSASSA-PSS parameters: %v", err)
+		}
+	}
+	if len(params.Hash.Algorithm) == 0 {
+		params.Hash.Algorithm = hashOIDs[crypto.SHA1]
+	}
+	mgfHash := pkix.AlgorithmIdentifier{Algorithm: hashOIDs[crypto.SHA1]}
+	if len(params.MGF.Algorithm) > 0 {
+		if !params.MGF.Algorithm.Equal(oidMGF1) {
+			return nil, fmt.Errorf("unsupported RSASSA-PSS mask generation function %s", params.MGF.Algorithm)
+		}
+		if _, err := asn1.Unmarshal(params.MGF.Parameters.FullBytes, &mgfHash); err != nil {
+			return nil, fmt.Errorf("invalid RSASSA-PSS mask generation function parameters: %v", err)
+		}
+	}
+
+	hash, err := hashForOID(params.Hash.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if !params.Hash.Algorithm.Equal(digest.Algorithm) {
+		return nil, fmt.Errorf("RSASSA-PSS hash %s does not match the digest algorithm %s", params.Hash.Algorithm, digest.Algorithm)
+	}
+
+	// crypto/rsa generates the mask with the hash of the message.
+	if !mgfHash.Algorithm.Equal(params.Hash.Algorithm) {
+		return nil, fmt.Errorf("unsupported RSASSA-PSS mask generation hash %s", mgfHash.Algorithm)
+	}
+	if params.SaltLength < 0 {
+		return nil, fmt.Errorf("invalid RSASSA-PSS salt length %d", params.SaltLength)
+	}
+	if params.TrailerField != 1 {
+		return nil, fmt.Errorf("unsupported RSASSA-PSS trailer field %d", params.TrailerField)
+	}
+
+	// A salt length of 0 is rsa.PSSSaltLengthAuto, which accepts the
+	// signatures without a salt as well.
+	return &rsa.PSSOptions{SaltLength: params.SaltLength, Hash: hash}, nil
+}
+
+// checkSignature verifies the signature value of a signer over the signed
+// bytes with the public key of the signer certificate.
+func checkSignature(ee *x509.Certificate, digestAlgorithm, signatureAlgorithm pkix.AlgorithmIdentifier, hash crypto.Hash, signed, signature []byte) error {
+	algorithm := signatureAlgorithm.Algorithm
+
+	if key, ok := ee.PublicKey.(ed25519.PublicKey); ok {
+		if !algorithm.Equal(oidSignatureEd25519) {
+			return fmt.Errorf("unsupported signature algorithm %s for Ed25519 keys", algorithm)
+		}
+		if !ed25519.Verify(key, signed, signature) {
+			return errors.New("ed25519: verification failure")
+		}
+		return nil
+	}
+
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch key := ee.PublicKey.(type) {
+	case *rsa.PublicKey:
+		switch {
+		case algorithm.Equal(oidSignatureRSAPSS):
+			opts, err := pssOptions(signatureAlgorithm.Parameters, digestAlgorithm)
+			if err != nil {
+				return err
+			}
+			return rsa.VerifyPSS(key, hash, digest, signature, opts)
+		case algorithm.Equal(oidSignatureRSA), isRSAWithDigest(algorithm, hash):
+			return rsa.VerifyPKCS1v15(key, hash, digest, signature)
+		}
+	case *ecdsa.PublicKey:
+		// The digest algorithm of id-ecPublicKey and of a named curve is
+		// that of the signer, the curve must be that of the key.
+		withDigest, ok := ecdsaOIDs[hash]
+		plainWithDigest, plain := ecdsaPlainOIDs[hash]
+		plain = plain && plainWithDigest.Equal(algorithm)
+		curve, named := ecdsaCurveOIDs[key.Curve]
+		if (ok && withDigest.Equal(algorithm)) || plain || algorithm.Equal(oidPublicKeyECDSA) || (named && curve.Equal(algorithm)) {
+			if !verifyECDSA(key, digest, signature, plain) {
+				return errors.New("ecdsa: verification failure")
+			}
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unsupported signature algorithm %s for %T", algorithm, ee.PublicKey)
+}
+
+// verifyLocally verifies the signers of a detached signature without the
+// pkcs7 package, in the same way as pkcs7 VerifyWithChain does. The message
+// digests are compared with digests, the digests of the content by digest
+// algorithm, if set. It reports whether the signer certificates chain to a
+// certificate in the signature.
+func verifyLocally(p7 *pkcs7.PKCS7, digests map[crypto.Hash][]byte) (trusted bool, err error) {
+	if len(p7.Signers) == 0 {
+		return false, errors.New("message has no signers")
+	}
+
+	certPool := x509.NewCertPool()
+	for _, cert := range p7.Certificates {
+		certPool.AddCert(cert)
+	}
+
+	trusted = true
+	for _, s := range p7.Signers {
+		var ee *x509.Certificate
+		for _, cert := range p7.Certificates {
+			if cert.SerialNumber.Cmp(s.IssuerAndSerialNumber.SerialNumber) == 0 && bytes.Equal(cert.RawIssuer, s.IssuerAndSerialNumber.IssuerName.FullBytes) {
+				ee = cert
+				break
+			}
+		}
+		if ee == nil {
+			return false, ErrNoSignerCertificate
+		}
+
+		hash, err := hashForOID(s.DigestAlgorithm.Algorithm)
+		if err != nil {
+			return false, err
+		}
+		if !hash.Available() {
+			return false, fmt.Errorf("digest algorithm %s is not available", hash)
+		}
+
+		signed := p7.Content
+		signingTime := time.Now().UTC()
+		if len(s.AuthenticatedAttributes) > 0 {
+			attrs := make([]attribute, 0, len(s.AuthenticatedAttributes))
+			var digest []byte
+			for _, attr := range s.AuthenticatedAttributes {
+				attrs = append(attrs, attribute{Type: attr.Type, Value: attr.Value})
+				switch {
+				case attr.Type.Equal(oidAttributeMessageDigest):
+					if _, err := asn1.Unmarshal(attr.Value.Bytes, &digest); err != nil {
+						return false, fmt.Errorf("invalid message digest attribute: %v", err)
+					}
+				case attr.Type.Equal(oidAttributeSigningTime):
+					if _, err := asn1.Unmarshal(attr.Value.Bytes, &signingTime); err != nil {
+						return false, fmt.Errorf("invalid signing time attribute: %v", err)
+					}
+					if signingTime.After(ee.NotAfter) || signingTime.Before(ee.NotBefore) {
+						return false, fmt.Errorf("signing time %q is outside of certificate validity %q to %q",
+							signingTime.Format(time.RFC3339),
+							ee.NotBefore.Format(time.RFC3339),
+							ee.NotAfter.Format(time.RFC3339))
+					}
+				}
+			}
+
+			contentDigest, ok := digests[hash]
+			if !ok {
+				h := hash.New()
+				h.Write(p7.Content)
+				contentDigest = h.Sum(nil)
+			}
+			if subtle.ConstantTimeCompare(digest, contentDigest) != 1 {
+				return false, ErrDigestMismatch
+			}
+
+			// The signature is calculated over the DER encoding of the
+			// SET OF signed attributes.
+			encoded, err := asn1.Marshal(struct {
+				A []attribute `asn1:"set"`
+			}{A: attrs})
+			if err != nil {
+				return false, err
+			}
+			var raw asn1.RawValue
+			if _, err := asn1.Unmarshal(encoded, &raw); err != nil {
+				return false, err
+			}
+			signed = raw.Bytes
+		}
+
+		if err := checkSignature(ee, s.DigestAlgorithm, s.DigestEncryptionAlgorithm, hash, signed, s.EncryptedDigest); err != nil {
+			return false, err
+		}
+
+		_, err = ee.Verify(x509.VerifyOptions{
+			Roots:         certPool,
+			Intermediates: certPool,
+			CurrentTime:   signingTime,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		trusted = trusted && err == nil
+	}
+
+	return trusted, nil
+}
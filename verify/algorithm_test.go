@@ -0,0 +1,323 @@
+package verify
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/digitorus/pkcs7"
+)
+
+func TestPSSOptions(t *testing.T) {
+	sha256 := pkix.AlgorithmIdentifier{Algorithm: hashOIDs[crypto.SHA256], Parameters: asn1.NullRawValue}
+	sha384 := pkix.AlgorithmIdentifier{Algorithm: hashOIDs[crypto.SHA384], Parameters: asn1.NullRawValue}
+
+	mgf := func(hash pkix.AlgorithmIdentifier) pkix.AlgorithmIdentifier {
+		params, err := asn1.Marshal(hash)
+		if err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+		return pkix.AlgorithmIdentifier{
+			Algorithm:  asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 8},
+			Parameters: asn1.RawValue{FullBytes: params},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		params  pssParameters
+		digest  pkix.AlgorithmIdentifier
+		want    int
+		wantErr bool
+	}{
+		{
+			name:   "sha256",
+			params: pssParameters{Hash: sha256, MGF: mgf(sha256), SaltLength: 32, TrailerField: 1},
+			digest: sha256,
+			want:   32,
+		},
+		{
+			name:   "sha384",
+			params: pssParameters{Hash: sha384, MGF: mgf(sha384), SaltLength: 48, TrailerField: 1},
+			digest: sha384,
+			want:   48,
+		},
+		{
+			name:    "digest mismatch",
+			params:  pssParameters{Hash: sha256, MGF: mgf(sha256), SaltLength: 32, TrailerField: 1},
+			digest:  sha384,
+			wantErr: true,
+		},
+		{
+			name:    "mask generation hash mismatch",
+			params:  pssParameters{Hash: sha256, MGF: mgf(sha384), SaltLength: 32, TrailerField: 1},
+			digest:  sha256,
+			wantErr: true,
+		},
+		{
+			name:   "salt length",
+			params: pssParameters{Hash: sha256, MGF: mgf(sha256), SaltLength: 20, TrailerField: 1},
+			digest: sha256,
+			want:   20,
+		},
+		{
+			name:   "maximum salt length",
+			params: pssParameters{Hash: sha256, MGF: mgf(sha256), SaltLength: 222, TrailerField: 1},
+			digest: sha256,
+			want:   222,
+		},
+		{
+			name:    "negative salt length",
+			params:  pssParameters{Hash: sha256, MGF: mgf(sha256), SaltLength: -1, TrailerField: 1},
+			digest:  sha256,
+			wantErr: true,
+		},
+		{
+			name:    "trailer field",
+			params:  pssParameters{Hash: sha256, MGF: mgf(sha256), SaltLength: 32, TrailerField: 2},
+			digest:  sha256,
+			wantErr: true,
+		},
+		{
+			name: "mask generation function",
+			params: pssParameters{Hash: sha256, MGF: pkix.AlgorithmIdentifier{
+				Algorithm:  asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 9},
+				Parameters: mgf(sha256).Parameters,
+			}, SaltLength: 32, TrailerField: 1},
+			digest:  sha256,
+			wantErr: true,
+		},
+		{
+			name:   "no salt",
+			params: pssParameters{Hash: sha256, MGF: mgf(sha256), SaltLength: 0, TrailerField: 1},
+			digest: sha256,
+			want:   0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := asn1.Marshal(tt.params)
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			got, err := pssOptions(asn1.RawValue{FullBytes: params}, tt.digest)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("pssOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.SaltLength != tt.want {
+				t.Errorf("expected salt length %d, got %d", tt.want, got.SaltLength)
+			}
+		})
+	}
+
+	// Absent parameters and an empty sequence are SHA-1, MGF1 with SHA-1 and
+	// a salt of 20 bytes.
+	sha1 := pkix.AlgorithmIdentifier{Algorithm: hashOIDs[crypto.SHA1]}
+	for _, params := range []asn1.RawValue{{}, asn1.NullRawValue, {FullBytes: []byte{0x30, 0x00}}} {
+		got, err := pssOptions(params, sha1)
+		if err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+		if got.Hash != crypto.SHA1 || got.SaltLength != 20 {
+			t.Errorf("expected SHA-1 and a salt length of 20, got %v and %d", got.Hash, got.SaltLength)
+		}
+		if _, err := pssOptions(params, sha256); err == nil {
+			t.Errorf("expected the default hash not to match SHA-256")
+		}
+	}
+}
+
+func TestCheckSignaturePSS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	cert := &x509.Certificate{PublicKey: &key.PublicKey}
+	digestAlgorithm := pkix.AlgorithmIdentifier{Algorithm: hashOIDs[crypto.SHA256], Parameters: asn1.NullRawValue}
+	mgf, err := asn1.Marshal(digestAlgorithm)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	signed := []byte("signed attributes")
+	digest := sha256.Sum256(signed)
+	for _, saltLength := range []int{20, 32, 64} {
+		signature, err := rsa.SignPSS(rand.Reader, key, crypto.SHA256, digest[:], &rsa.PSSOptions{SaltLength: saltLength})
+		if err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+		algorithm := func(saltLength int) pkix.AlgorithmIdentifier {
+			params, err := asn1.Marshal(pssParameters{
+				Hash:         digestAlgorithm,
+				MGF:          pkix.AlgorithmIdentifier{Algorithm: oidMGF1, Parameters: asn1.RawValue{FullBytes: mgf}},
+				SaltLength:   saltLength,
+				TrailerField: 1,
+			})
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			return pkix.AlgorithmIdentifier{Algorithm: oidSignatureRSAPSS, Parameters: asn1.RawValue{FullBytes: params}}
+		}
+
+		if err := checkSignature(cert, digestAlgorithm, algorithm(saltLength), crypto.SHA256, signed, signature); err != nil {
+			t.Errorf("salt length %d: %v", saltLength, err)
+		}
+		if err := checkSignature(cert, digestAlgorithm, algorithm(saltLength+1), crypto.SHA256, signed, signature); err == nil {
+			t.Errorf("salt length %d: expected an error for another salt length", saltLength)
+		}
+	}
+}
+
+func TestCheckSignatureECDSA(t *testing.T) {
+	signed := []byte("signed attributes")
+	for _, curve := range []elliptic.Curve{elliptic.P224(), elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+		cert := &x509.Certificate{PublicKey: &key.PublicKey}
+
+		for _, hash := range []crypto.Hash{crypto.SHA224, crypto.SHA256, crypto.SHA384, crypto.SHA512} {
+			h := hash.New()
+			h.Write(signed)
+			der, err := ecdsa.SignASN1(rand.Reader, key, h.Sum(nil))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			r, s, err := ecdsa.Sign(rand.Reader, key, h.Sum(nil))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			size := (curve.Params().BitSize + 7) / 8
+			plain := append(r.FillBytes(make([]byte, size)), s.FillBytes(make([]byte, size))...)
+
+			digest := pkix.AlgorithmIdentifier{Algorithm: hashOIDs[hash]}
+			name := curve.Params().Name + " " + hash.String()
+			for algorithm, signature := range map[string]struct {
+				oid   asn1.ObjectIdentifier
+				value []byte
+			}{
+				"ecdsa-with":         {ecdsaOIDs[hash], der},
+				"ecdsa-with plain":   {ecdsaOIDs[hash], plain},
+				"id-ecPublicKey":     {oidPublicKeyECDSA, der},
+				"named curve":        {ecdsaCurveOIDs[curve], plain},
+				"ecdsa-plain":        {ecdsaPlainOIDs[hash], plain},
+				"ecdsa-plain as DER": {ecdsaPlainOIDs[hash], der},
+			} {
+				if err := checkSignature(cert, digest, pkix.AlgorithmIdentifier{Algorithm: signature.oid}, hash, signed, signature.value); err != nil {
+					t.Errorf("%s %s: %v", name, algorithm, err)
+				}
+			}
+
+			// The digest of ecdsa-with and ecdsa-plain algorithms must be
+			// that of the signer.
+			other := crypto.SHA256
+			if hash == crypto.SHA256 {
+				other = crypto.SHA384
+			}
+			if err := checkSignature(cert, digest, pkix.AlgorithmIdentifier{Algorithm: ecdsaOIDs[other]}, hash, signed, der); err == nil {
+				t.Errorf("%s: expected an error for the digest of %s", name, other)
+			}
+			if err := checkSignature(cert, digest, pkix.AlgorithmIdentifier{Algorithm: oidPublicKeyECDSA}, hash, []byte("other"), der); err == nil {
+				t.Errorf("%s: expected an error for other signed data", name)
+			}
+		}
+	}
+
+	// The curve of a named curve algorithm must be that of the key.
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	digest := sha256.Sum256(signed)
+	der, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	cert := &x509.Certificate{PublicKey: &key.PublicKey}
+	algorithm := pkix.AlgorithmIdentifier{Algorithm: ecdsaCurveOIDs[elliptic.P384()]}
+	if err := checkSignature(cert, pkix.AlgorithmIdentifier{Algorithm: hashOIDs[crypto.SHA256]}, algorithm, crypto.SHA256, signed, der); err == nil {
+		t.Errorf("expected an error for the algorithm of another curve")
+	}
+}
+
+func TestCheckSignatureEd25519(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	cert := &x509.Certificate{PublicKey: public}
+	signed := []byte("signed attributes")
+	digest := pkix.AlgorithmIdentifier{Algorithm: hashOIDs[crypto.SHA512]}
+	algorithm := pkix.AlgorithmIdentifier{Algorithm: oidSignatureEd25519}
+
+	if err := checkSignature(cert, digest, algorithm, crypto.SHA512, signed, ed25519.Sign(private, signed)); err != nil {
+		t.Errorf("%s", err.Error())
+	}
+	if err := checkSignature(cert, digest, algorithm, crypto.SHA512, []byte("other"), ed25519.Sign(private, signed)); err == nil {
+		t.Errorf("expected an error for other signed data")
+	}
+	if err := checkSignature(cert, digest, pkix.AlgorithmIdentifier{Algorithm: ecdsaOIDs[crypto.SHA512]}, crypto.SHA512, signed, ed25519.Sign(private, signed)); err == nil {
+		t.Errorf("expected an error for an ECDSA algorithm")
+	}
+}
+
+func TestVerifyLocallyECDSA(t *testing.T) {
+	cert, key := newTestCRLIssuer(t, "pdfsign Test Signer")
+	sd, err := pkcs7.NewSignedData([]byte("content"))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	sd.SetDigestAlgorithm(pkcs7.OIDDigestAlgorithmSHA256)
+	if err := sd.AddSigner(cert, key, pkcs7.SignerInfoConfig{}); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	der, err := sd.Finish()
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	// Signers that give the key algorithm and a plain signature value, as
+	// some signing devices do, which the pkcs7 package does not verify.
+	p7, err := pkcs7.Parse(der)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	var value struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(p7.Signers[0].EncryptedDigest, &value); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	p7.Signers[0].DigestEncryptionAlgorithm = pkix.AlgorithmIdentifier{Algorithm: oidPublicKeyECDSA}
+	p7.Signers[0].EncryptedDigest = append(value.R.FillBytes(make([]byte, 32)), value.S.FillBytes(make([]byte, 32))...)
+	if p7.Verify() == nil {
+		t.Fatalf("expected the pkcs7 package to reject the signature")
+	}
+
+	if !requiresLocalVerification(p7) {
+		t.Fatalf("expected ECDSA signatures to be verified locally")
+	}
+	trusted, err := verifyLocally(p7, nil)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if !trusted {
+		t.Errorf("expected the self-signed certificate to be trusted")
+	}
+
+	p7.Content = []byte("other content")
+	if _, err := verifyLocally(p7, nil); !errors.Is(err, ErrDigestMismatch) {
+		t.Errorf("expected a digest mismatch, got %v", err)
+	}
+}
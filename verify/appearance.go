@@ -0,0 +1,255 @@
+package verify
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/digitorus/pdf"
+)
+
+// maxAppearanceDepth limits the nesting of form XObjects in appearance
+// streams, which ends the recursion for XObjects that draw themselves.
+const maxAppearanceDepth = 8
+
+// Attribute types of X.520 for the names of a person, which pkix.Name does
+// not parse.
+var (
+	oidAttributeSurname   = asn1.ObjectIdentifier{2, 5, 4, 4}
+	oidAttributeGivenName = asn1.ObjectIdentifier{2, 5, 4, 42}
+)
+
+// appearanceDate matches the dates appearances commonly show, with the time
+// and time zone if any.
+var appearanceDate = regexp.MustCompile(`\d{4}[-./]\d{2}[-./]\d{2}(?:[ T]\d{2}:\d{2}(?::\d{2})?(?: ?(?:Z|[+-]\d{2}'?:?\d{2}'?))?)?`)
+
+// appearanceDateLayouts are the layouts of the dates of appearanceDate, the
+// separators of the date replaced by "-" and of the time zone removed.
+var appearanceDateLayouts = []string{
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05-0700",
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02 15:04:05Z",
+	"2006-01-02T15:04:05Z",
+	"2006-01-02 15:04 -0700",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// checkAppearance returns the text of the appearance streams of the widgets
+// of the signature field with the signature dictionary v, and how it
+// contradicts the signer: a name that is not the name of the signing
+// certificate, or a date far from the time of the signature. The check
+// needs text in the appearance, an appearance of only an image is not
+// compared.
+func checkAppearance(v pdf.Value, rdr *pdf.Reader, signer *Signer) (text string, mismatches []string) {
+	field := signatureField(rdr.Trailer().Key("Root").Key("AcroForm").Key("Fields"), v, 0)
+	if field.IsNull() {
+		return "", nil
+	}
+	var lines []string
+	for _, widget := range signatureWidgets(field) {
+		appearance := widget.Key("AP").Key("N")
+		if appearance.Kind() != pdf.Stream {
+			continue
+		}
+		lines = append(lines, appearanceLines(appearance, appearance.Key("Resources"), 0)...)
+	}
+	text = strings.Join(lines, "\n")
+	if strings.TrimSpace(text) == "" {
+		return "", nil
+	}
+
+	if c := signingCertificate(*signer); c != nil {
+		if names := certificateNames(c.Certificate.Subject); len(names) > 0 && !containsAny(text, names) {
+			mismatches = append(mismatches, fmt.Sprintf("the appearance does not show the name %q of the signing certificate", names[0]))
+		}
+	}
+
+	signed := signer.TimestampTime
+	if signed == nil {
+		signed = signer.SignatureTime
+	}
+	if signed != nil {
+		for _, match := range appearanceDate.FindAllString(text, -1) {
+			shown, tolerance, ok := parseAppearanceDate(match)
+			if !ok {
+				continue
+			}
+			if d := shown.Sub(*signed); d > tolerance || d < -tolerance {
+				mismatches = append(mismatches, fmt.Sprintf("the appearance shows the date %q, the signature was made at %s", match, signed.UTC().Format(time.RFC3339)))
+			}
+		}
+	}
+	return text, mismatches
+}
+
+// appearanceLines returns the lines of text that the appearance stream, or
+// form XObject, shows with the resources, and the form XObjects it draws.
+func appearanceLines(stream, resources pdf.Value, depth int) (lines []string) {
+	if depth > maxAppearanceDepth {
+		return nil
+	}
+	// The interpreter panics on malformed content, the text up to there is
+	// kept.
+	defer func() {
+		_ = recover()
+	}()
+
+	var line strings.Builder
+	newLine := func() {
+		if s := strings.TrimSpace(line.String()); s != "" {
+			lines = append(lines, s)
+		}
+		line.Reset()
+	}
+	defer newLine()
+
+	var font pdf.TextEncoding
+	decode := func(s pdf.Value) string {
+		if font == nil {
+			return s.Text()
+		}
+		return font.Decode(s.RawString())
+	}
+	pdf.Interpret(stream, func(stk *pdf.Stack, op string) {
+		switch op {
+		case "Tf":
+			stk.Pop()
+			font = fontEncoding(resources.Key("Font").Key(stk.Pop().Name()))
+		case "Tj":
+			line.WriteString(decode(stk.Pop()))
+		case "'", "\"":
+			newLine()
+			line.WriteString(decode(stk.Pop()))
+		case "TJ":
+			array := stk.Pop()
+			for i := 0; i < array.Len(); i++ {
+				switch item := array.Index(i); item.Kind() {
+				case pdf.String:
+					line.WriteString(decode(item))
+				case pdf.Integer, pdf.Real:
+					// A large negative adjustment separates words.
+					if item.Float64() < -200 {
+						line.WriteString(" ")
+					}
+				}
+			}
+		case "Td", "TD", "T*", "Tm", "ET":
+			newLine()
+		case "Do":
+			xobject := resources.Key("XObject").Key(stk.Pop().Name())
+			if xobject.Key("Subtype").Name() == "Form" {
+				newLine()
+				inner := xobject.Key("Resources")
+				if inner.IsNull() {
+					inner = resources
+				}
+				lines = append(lines, appearanceLines(xobject, inner, depth+1)...)
+			}
+		}
+		for stk.Len() > 0 {
+			stk.Pop()
+		}
+	})
+	return lines
+}
+
+// fontEncoding returns the encoding of the text of the font, nil for the
+// standard encoding of PDF strings. Encodings the pdf package does not know
+// are not decoded. The text of composite fonts, such as the embedded fonts
+// of CJK text, is decoded with their ToUnicode CMap.
+func fontEncoding(font pdf.Value) pdf.TextEncoding {
+	if font.IsNull() {
+		return nil
+	}
+	if font.Key("Subtype").Name() == "Type0" {
+		if e := readToUnicode(font.Key("ToUnicode")); e != nil {
+			return e
+		}
+		return nil
+	}
+	encoding := font.Key("Encoding")
+	switch {
+	case encoding.Kind() == pdf.Dict, encoding.IsNull() && !font.Key("ToUnicode").IsNull():
+	case encoding.Kind() == pdf.Name && (encoding.Name() == "WinAnsiEncoding" || encoding.Name() == "MacRomanEncoding"):
+	default:
+		return nil
+	}
+	return pdf.Font{V: font}.Encoder()
+}
+
+// parseAppearanceDate parses a date of the appearance, and returns how far
+// it may be from the signing time by its precision and time zone.
+func parseAppearanceDate(s string) (time.Time, time.Duration, bool) {
+	normalized := []byte(s)
+	for i := 4; i < len(normalized) && i < 8; i++ {
+		if normalized[i] == '.' || normalized[i] == '/' {
+			normalized[i] = '-'
+		}
+	}
+	value := strings.ReplaceAll(string(normalized), "'", "")
+	if i := strings.LastIndexAny(value, "+-"); i > 10 && strings.Count(value[i:], ":") == 1 {
+		value = value[:i] + strings.Replace(value[i:], ":", "", 1)
+	}
+	for _, layout := range appearanceDateLayouts {
+		t, err := time.Parse(layout, value)
+		if err != nil {
+			continue
+		}
+		switch {
+		case layout == "2006-01-02":
+			// A date in an unknown time zone may be a day off.
+			return t, 48 * time.Hour, true
+		case !strings.Contains(layout, "Z") && !strings.Contains(layout, "-0700"):
+			// A local time in an unknown time zone.
+			return t, 14 * time.Hour, true
+		}
+		return t, time.Hour, true
+	}
+	return time.Time{}, 0, false
+}
+
+// certificateNames returns the names to find in an appearance for the
+// subject of a certificate, its common name first and then its given name and
+// surname in the common orders.
+func certificateNames(subject pkix.Name) []string {
+	var names []string
+	if subject.CommonName != "" {
+		names = append(names, subject.CommonName)
+	}
+	var givenName, surname string
+	for _, name := range subject.Names {
+		value, _ := name.Value.(string)
+		switch {
+		case name.Type.Equal(oidAttributeGivenName):
+			givenName = value
+		case name.Type.Equal(oidAttributeSurname):
+			surname = value
+		}
+	}
+	if givenName != "" && surname != "" {
+		names = append(names, givenName+" "+surname, surname+" "+givenName, surname+", "+givenName)
+	}
+	return names
+}
+
+// containsAny reports whether text contains one of the names, ignoring case
+// and differences in white space.
+func containsAny(text string, names []string) bool {
+	normalize := func(s string) string {
+		return strings.ToLower(strings.Join(strings.Fields(s), " "))
+	}
+	text = normalize(text)
+	for _, name := range names {
+		if strings.Contains(text, normalize(name)) {
+			return true
+		}
+	}
+	return false
+}
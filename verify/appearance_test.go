@@ -0,0 +1,113 @@
+package verify
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdf"
+)
+
+func TestCheckAppearance(t *testing.T) {
+	signed := time.Date(2026, 3, 4, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name           string
+		content        string
+		subject        pkix.Name
+		wantText       string
+		wantMismatches []string
+	}{
+		{
+			name:     "consistent",
+			content:  "BT /F1 10 Tf 2 30 Td (Digitally signed by Alice Example) Tj 0 -12 Td (Date: 2026-03-04 11:30:00 +01:00) Tj ET",
+			subject:  pkix.Name{CommonName: "Alice Example"},
+			wantText: "Digitally signed by Alice Example\nDate: 2026-03-04 11:30:00 +01:00",
+		},
+		{
+			name:           "other name",
+			content:        "BT /F1 10 Tf 2 30 Td (Alice Example) Tj ET",
+			subject:        pkix.Name{CommonName: "Bob Example"},
+			wantText:       "Alice Example",
+			wantMismatches: []string{`the appearance does not show the name "Bob Example" of the signing certificate`},
+		},
+		{
+			name:    "given name and surname",
+			content: "BT /F1 10 Tf 2 30 Td [(EXAMPLE,) -250 (Alice)] TJ ET",
+			subject: pkix.Name{CommonName: "Alice Example 12345", Names: []pkix.AttributeTypeAndValue{
+				{Type: oidAttributeGivenName, Value: "Alice"},
+				{Type: oidAttributeSurname, Value: "Example"},
+			}},
+			wantText: "EXAMPLE, Alice",
+		},
+		{
+			name:           "other date",
+			content:        "BT /F1 10 Tf 2 30 Td (Alice Example) Tj T* (2026.03.01) Tj ET",
+			subject:        pkix.Name{CommonName: "Alice Example"},
+			wantText:       "Alice Example\n2026.03.01",
+			wantMismatches: []string{`the appearance shows the date "2026.03.01", the signature was made at 2026-03-04T10:30:00Z`},
+		},
+		{
+			name:    "image",
+			content: "q 100 0 0 50 0 0 cm /Im1 Do Q",
+			subject: pkix.Name{CommonName: "Bob Example"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The widget draws the text by a form XObject with the font
+			form := fmt.Sprintf("<< /Type /XObject /Subtype /Form /BBox [0 0 200 50] /Resources << /Font << /F1 8 0 R >> >> /Length %d >>\nstream\n%s\nendstream", len(tt.content), tt.content)
+			appearance := "/FRM Do"
+			document, _ := appendRevision([]byte("%PDF-1.7\n"), 0, map[int]string{
+				1:  "<< /Type /Catalog /Pages 2 0 R /AcroForm << /Fields [5 0 R] /SigFlags 3 >> >>",
+				2:  "<< /Type /Pages /Kids [3 0 R] /Count 1 /MediaBox [0 0 612 792] >>",
+				3:  "<< /Type /Page /Parent 2 0 R /Annots [5 0 R] >>",
+				5:  "<< /FT /Sig /T (Signature1) /V 10 0 R /Subtype /Widget /Rect [72 72 272 122] /AP << /N 6 0 R >> >>",
+				6:  fmt.Sprintf("<< /Type /XObject /Subtype /Form /BBox [0 0 200 50] /Resources << /XObject << /FRM 7 0 R >> >> /Length %d >>\nstream\n%s\nendstream", len(appearance), appearance),
+				7:  form,
+				8:  "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+				10: "<< /Type /Sig /Filter /Adobe.PPKLite /SubFilter /ETSI.CAdES.detached >>",
+			})
+			rdr, err := pdf.NewReader(bytes.NewReader(document), int64(len(document)))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			signer := Signer{
+				SignatureTime: &signed,
+				Certificates:  []Certificate{{Certificate: &x509.Certificate{Subject: tt.subject}}},
+			}
+			ptr := rdr.Xref()[10].Ptr()
+			text, mismatches := checkAppearance(rdr.Resolve(ptr, ptr), rdr, &signer)
+			if text != tt.wantText || !reflect.DeepEqual(mismatches, tt.wantMismatches) {
+				t.Errorf("expected %q with %q, got %q with %q", tt.wantText, tt.wantMismatches, text, mismatches)
+			}
+		})
+	}
+}
+
+func TestParseAppearanceDate(t *testing.T) {
+	tests := []struct {
+		date          string
+		want          time.Time
+		wantTolerance time.Duration
+	}{
+		{"2026-03-04 11:30:00 +01:00", time.Date(2026, 3, 4, 10, 30, 0, 0, time.UTC), time.Hour},
+		{"2026.03.04 11:30:00 +01'00'", time.Date(2026, 3, 4, 10, 30, 0, 0, time.UTC), time.Hour},
+		{"2026-03-04T10:30:00Z", time.Date(2026, 3, 4, 10, 30, 0, 0, time.UTC), time.Hour},
+		{"2026/03/04 11:30", time.Date(2026, 3, 4, 11, 30, 0, 0, time.UTC), 14 * time.Hour},
+		{"2026-03-04", time.Date(2026, 3, 4, 0, 0, 0, 0, time.UTC), 48 * time.Hour},
+	}
+	for _, tt := range tests {
+		got, tolerance, ok := parseAppearanceDate(tt.date)
+		if !ok || !got.Equal(tt.want) || tolerance != tt.wantTolerance {
+			t.Errorf("%s: expected %s within %s, got %s within %s (%t)", tt.date, tt.want, tt.wantTolerance, got, tolerance, ok)
+		}
+	}
+	if _, _, ok := parseAppearanceDate("2026-13-40"); ok {
+		t.Errorf("expected an invalid date not to parse")
+	}
+}
@@ -0,0 +1,217 @@
+package verify
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/digitorus/pdf"
+)
+
+// checkByteRange verifies that the ByteRange of the signature dictionary v
+// covers the revision that ends with it, except for the hex string of the
+// signature contents, in a document of size bytes.
+func checkByteRange(v pdf.Value, file io.ReaderAt, size int64, signer *Signer) {
+	byteRange := v.Key("ByteRange")
+	n := byteRange.Len()
+	if n == 0 || n%2 != 0 {
+		signer.ByteRangeErrors = append(signer.ByteRangeErrors, "byte range does not consist of offset and length pairs")
+		return
+	}
+	if n != 4 {
+		signer.ByteRangeErrors = append(signer.ByteRangeErrors, fmt.Sprintf("byte range has %d ranges instead of 2", n/2))
+	}
+
+	var end int64
+	var contentsHole bool
+	for i := 0; i < n; i += 2 {
+		if byteRange.Index(i).Kind() != pdf.Integer || byteRange.Index(i+1).Kind() != pdf.Integer {
+			signer.ByteRangeErrors = append(signer.ByteRangeErrors, fmt.Sprintf("range %d is not a pair of integers", i/2+1))
+			return
+		}
+		start, length := byteRange.Index(i).Int64(), byteRange.Index(i+1).Int64()
+		if start < 0 || length < 0 {
+			signer.ByteRangeErrors = append(signer.ByteRangeErrors, fmt.Sprintf("range %d is inverted", i/2+1))
+			return
+		}
+
+		switch {
+		case start < end:
+			signer.ByteRangeErrors = append(signer.ByteRangeErrors, fmt.Sprintf("range %d overlaps the previous range", i/2+1))
+		case start > end && i == 0:
+			signer.ByteRangeErrors = append(signer.ByteRangeErrors, fmt.Sprintf("the first %d bytes are not signed", start))
+			signer.UnsignedBytes += start
+		case start > end:
+			// The first gap must be the hex string of the signature
+			// contents, any other gap is unsigned.
+			if !contentsHole && isContentsHole(v, file, end, start, size) {
+				contentsHole = true
+				break
+			}
+			signer.ByteRangeErrors = append(signer.ByteRangeErrors, fmt.Sprintf("%d bytes at offset %d are not signed", start-end, end))
+			signer.UnsignedBytes += start - end
+		}
+		end = max(end, start+length)
+	}
+	if !contentsHole {
+		signer.ByteRangeErrors = append(signer.ByteRangeErrors, "byte range does not exclude exactly the signature contents")
+	}
+
+	switch {
+	case end > size:
+		signer.ByteRangeErrors = append(signer.ByteRangeErrors, fmt.Sprintf("byte range ends at %d, after the end of the file at %d", end, size))
+	case !isRevisionEnd(file, end, size):
+		signer.ByteRangeErrors = append(signer.ByteRangeErrors, fmt.Sprintf("byte range ends at %d, which is not the end of a revision", end))
+	}
+	signer.ByteRangeValid = len(signer.ByteRangeErrors) == 0
+}
+
+// checkObjectStream records that the signature dictionary v of rdr is stored
+// in an object stream. Its contents are compressed with the other objects of
+// the stream, no byte range can exclude them.
+func checkObjectStream(v pdf.Value, rdr *pdf.Reader, signer *Signer) {
+	ptr := v.GetPtr()
+	xrefs := rdr.Xref()
+	if int(ptr.GetID()) >= len(xrefs) || xrefs[ptr.GetID()].Ptr() != ptr {
+		return
+	}
+	if stream := xrefs[ptr.GetID()].Stream(); stream.GetID() != 0 {
+		signer.ByteRangeErrors = append(signer.ByteRangeErrors, fmt.Sprintf("the signature dictionary is stored in the object stream %d, its contents cannot be excluded from the byte range", stream.GetID()))
+		signer.ByteRangeValid = false
+	}
+}
+
+// byteRangeDigest returns the hex digest of the bytes of the ByteRange of the
+// signature dictionary v with hash, so that the message digest of a signature
+// can be compared with the document independently of the signature. It is
+// empty if the byte range cannot be read.
+func byteRangeDigest(v pdf.Value, file io.ReaderAt, hash crypto.Hash) string {
+	if !hash.Available() {
+		return ""
+	}
+	byteRange := v.Key("ByteRange")
+	if byteRange.Len() == 0 || byteRange.Len()%2 != 0 {
+		return ""
+	}
+	h := hash.New()
+	for i := 0; i < byteRange.Len(); i += 2 {
+		start, length := byteRange.Index(i).Int64(), byteRange.Index(i+1).Int64()
+		if start < 0 || length < 0 {
+			return ""
+		}
+		if n, err := io.Copy(h, io.NewSectionReader(file, start, length)); err != nil || n != length {
+			return ""
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// byteRangeLength returns the number of bytes of the ByteRange of the
+// signature dictionary v.
+func byteRangeLength(v pdf.Value) int64 {
+	var length int64
+	byteRange := v.Key("ByteRange")
+	for i := 1; i < byteRange.Len(); i += 2 {
+		length += byteRange.Index(i).Int64()
+	}
+	return length
+}
+
+// digestByteRange returns the digests with each of hashes of the bytes of
+// the ByteRange of the signature dictionary v. The file is read once, in
+// chunks, instead of into memory.
+func digestByteRange(v pdf.Value, file io.ReaderAt, hashes ...crypto.Hash) (map[crypto.Hash][]byte, error) {
+	digests := make(map[crypto.Hash][]byte, len(hashes))
+	writers := make([]io.Writer, 0, len(hashes))
+	states := make(map[crypto.Hash]hash.Hash, len(hashes))
+	for _, h := range hashes {
+		if _, ok := states[h]; ok {
+			continue
+		}
+		if !h.Available() {
+			return nil, fmt.Errorf("digest algorithm %s is not available", h)
+		}
+		states[h] = h.New()
+		writers = append(writers, states[h])
+	}
+
+	w := io.MultiWriter(writers...)
+	byteRange := v.Key("ByteRange")
+	for i := 1; i < byteRange.Len(); i += 2 {
+		if _, err := io.Copy(w, io.NewSectionReader(file, byteRange.Index(i-1).Int64(), byteRange.Index(i).Int64())); err != nil {
+			return nil, fmt.Errorf("failed to read byte range %d: %v", i, err)
+		}
+	}
+	for h, state := range states {
+		digests[h] = state.Sum(nil)
+	}
+	return digests, nil
+}
+
+// isContentsHole reports whether the bytes of file from start to end are the
+// hex string of the Contents of the signature dictionary v, in a document of
+// size bytes. The hex string is compared as it is read, the gap between the
+// ranges comes from the document and is not allocated.
+func isContentsHole(v pdf.Value, file io.ReaderAt, start, end, size int64) bool {
+	if end > size {
+		return false
+	}
+	contents := v.Key("Contents").RawString()
+	r := bufio.NewReader(io.NewSectionReader(file, start, end-start))
+	if c, err := r.ReadByte(); err != nil || c != '<' {
+		return false
+	}
+
+	// Hex strings may contain white space, an odd number of digits is
+	// completed with a zero.
+	var digits []byte
+	var n int
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return false
+		}
+		switch {
+		case c == '>':
+			if _, err := r.ReadByte(); err != io.EOF {
+				return false
+			}
+			if len(digits) == 1 {
+				digits = append(digits, '0')
+			}
+		case bytes.IndexByte([]byte(" \t\n\v\f\r"), c) >= 0:
+			continue
+		default:
+			digits = append(digits, c)
+		}
+		if len(digits) == 2 {
+			var b [1]byte
+			if _, err := hex.Decode(b[:], digits); err != nil || n >= len(contents) || b[0] != contents[n] {
+				return false
+			}
+			digits = digits[:0]
+			n++
+		}
+		if c == '>' {
+			return n == len(contents)
+		}
+	}
+}
+
+// isRevisionEnd reports whether end is the end of a revision of a document of
+// size bytes, the end of the file or right after an end-of-file marker.
+func isRevisionEnd(file io.ReaderAt, end, size int64) bool {
+	if end == size {
+		return true
+	}
+	start := max(end-1024, 0)
+	tail := make([]byte, end-start)
+	if _, err := file.ReadAt(tail, start); err != nil {
+		return false
+	}
+	return bytes.HasSuffix(bytes.TrimRight(tail, " \t\r\n\x00"), []byte("%%EOF"))
+}
@@ -0,0 +1,203 @@
+package verify
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/digitorus/pdf"
+)
+
+func TestCheckByteRange(t *testing.T) {
+	// signedDocument returns a document with a signature dictionary as
+	// object 2 with the byte range of byteRange, which is called with the
+	// offsets of the contents hex string and the end of the document.
+	signedDocument := func(byteRange func(start, end, size int) [4]int) []byte {
+		build := func(r [4]int) []byte {
+			document, _ := appendRevision([]byte("%PDF-1.7\n"), 0, map[int]string{
+				1: "<< /Type /Catalog >>",
+				2: fmt.Sprintf("<< /Type /Sig /ByteRange [%010d %010d %010d %010d] /Contents <0102030400000000> >>", r[0], r[1], r[2], r[3]),
+			})
+			return document
+		}
+		document := build([4]int{})
+		start := bytes.Index(document, []byte("<0102"))
+		end := start + len("<0102030400000000>")
+		return build(byteRange(start, end, len(document)))
+	}
+	valid := func(start, end, size int) [4]int {
+		return [4]int{0, start, end, size - end}
+	}
+
+	tests := []struct {
+		name         string
+		byteRange    func(start, end, size int) [4]int
+		appended     string
+		wantError    string
+		wantUnsigned int64
+	}{
+		{
+			name:      "entire revision",
+			byteRange: valid,
+		},
+		{
+			name:      "incremental update",
+			byteRange: valid,
+			appended:  "3 0 obj\n<< >>\nendobj\n",
+		},
+		{
+			name: "unsigned start",
+			byteRange: func(start, end, size int) [4]int {
+				return [4]int{9, start - 9, end, size - end}
+			},
+			wantError:    "the first 9 bytes are not signed",
+			wantUnsigned: 9,
+		},
+		{
+			name: "hole larger than the contents",
+			byteRange: func(start, end, size int) [4]int {
+				return [4]int{0, start - 10, end, size - end}
+			},
+			wantError:    "does not exclude exactly the signature contents",
+			wantUnsigned: 10 + int64(len("<0102030400000000>")),
+		},
+		{
+			name: "overlapping ranges",
+			byteRange: func(start, end, size int) [4]int {
+				return [4]int{0, end + 5, end, size - end}
+			},
+			wantError: "range 2 overlaps the previous range",
+		},
+		{
+			name: "beyond the end of the file",
+			byteRange: func(start, end, size int) [4]int {
+				return [4]int{0, start, end, size - end + 100}
+			},
+			wantError: "after the end of the file",
+		},
+		{
+			name: "truncated revision",
+			byteRange: func(start, end, size int) [4]int {
+				return [4]int{0, start, end, size - end - 20}
+			},
+			appended:  "trailing",
+			wantError: "not the end of a revision",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signed := signedDocument(tt.byteRange)
+			document := append(signed[:len(signed):len(signed)], tt.appended...)
+			rdr, err := pdf.NewReader(bytes.NewReader(signed), int64(len(signed)))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			ptr := rdr.Xref()[2].Ptr()
+			v := rdr.Resolve(ptr, ptr)
+
+			var signer Signer
+			checkByteRange(v, bytes.NewReader(document), int64(len(document)), &signer)
+			if tt.wantError == "" {
+				if !signer.ByteRangeValid || len(signer.ByteRangeErrors) != 0 {
+					t.Errorf("expected a valid byte range, got %v", signer.ByteRangeErrors)
+				}
+				return
+			}
+			if signer.ByteRangeValid {
+				t.Fatalf("expected an invalid byte range")
+			}
+			if !strings.Contains(strings.Join(signer.ByteRangeErrors, "; "), tt.wantError) {
+				t.Errorf("expected an error containing %q, got %v", tt.wantError, signer.ByteRangeErrors)
+			}
+			if signer.UnsignedBytes != tt.wantUnsigned {
+				t.Errorf("expected %d unsigned bytes, got %d", tt.wantUnsigned, signer.UnsignedBytes)
+			}
+		})
+	}
+
+	// A gap of gigabytes between the ranges is not read into memory.
+	document := signedDocument(func(start, end, size int) [4]int {
+		return [4]int{0, start, 9999999999, 10}
+	})
+	rdr, err := pdf.NewReader(bytes.NewReader(document), int64(len(document)))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	ptr := rdr.Xref()[2].Ptr()
+	var signer Signer
+	checkByteRange(rdr.Resolve(ptr, ptr), bytes.NewReader(document), int64(len(document)), &signer)
+	if signer.ByteRangeValid || !strings.Contains(strings.Join(signer.ByteRangeErrors, "; "), "after the end of the file") {
+		t.Errorf("expected an invalid byte range after the end of the file, got %v", signer.ByteRangeErrors)
+	}
+}
+
+func TestByteRangeDigest(t *testing.T) {
+	file := bytes.NewReader([]byte("signed<00>bytes"))
+	document := func(byteRange string) pdf.Value {
+		objects, _ := appendRevision([]byte("%PDF-1.7\n"), 0, map[int]string{
+			1: "<< /Type /Catalog >>",
+			2: "<< /Type /Sig /ByteRange " + byteRange + " >>",
+		})
+		rdr, err := pdf.NewReader(bytes.NewReader(objects), int64(len(objects)))
+		if err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+		ptr := rdr.Xref()[2].Ptr()
+		return rdr.Resolve(ptr, ptr)
+	}
+
+	want := sha256.Sum256([]byte("signedbytes"))
+	if digest := byteRangeDigest(document("[0 6 10 5]"), file, crypto.SHA256); digest != hex.EncodeToString(want[:]) {
+		t.Errorf("expected the digest %x, got %s", want, digest)
+	}
+	for _, byteRange := range []string{"[0 6 10]", "[0 6 10 50]", "[0 -6 10 5]"} {
+		if digest := byteRangeDigest(document(byteRange), file, crypto.SHA256); digest != "" {
+			t.Errorf("%s: expected no digest, got %s", byteRange, digest)
+		}
+	}
+	if digest := byteRangeDigest(document("[0 6 10 5]"), file, 0); digest != "" {
+		t.Errorf("expected no digest without a digest algorithm, got %s", digest)
+	}
+}
+
+func TestCheckObjectStream(t *testing.T) {
+	// The signature dictionary is object 2 in the object stream 3, the
+	// catalog object 1 and the cross-reference stream object 4 are not.
+	objects := "2 0 << /Type /Sig /Contents <01020304> >>\n"
+	document := bytes.NewBufferString("%PDF-1.7\n")
+	catalog := document.Len()
+	document.WriteString("1 0 obj\n<< /Type /Catalog >>\nendobj\n")
+	stream := document.Len()
+	_, _ = fmt.Fprintf(document, "3 0 obj\n<< /Type /ObjStm /N 1 /First 4 /Length %d >>\nstream\n%s\nendstream\nendobj\n", len(objects), objects)
+	xref := document.Len()
+	entries := []byte{
+		0, 0, 0, 0, 0, 255,
+		1, 0, 0, 0, byte(catalog), 0,
+		2, 0, 0, 0, 3, 0,
+		1, 0, 0, 0, byte(stream), 0,
+		1, 0, 0, byte(xref >> 8), byte(xref), 0,
+	}
+	_, _ = fmt.Fprintf(document, "4 0 obj\n<< /Type /XRef /Size 5 /W [1 4 1] /Root 1 0 R /Length %d >>\nstream\n%s\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", len(entries), entries, xref)
+
+	rdr, err := pdf.NewReader(bytes.NewReader(document.Bytes()), int64(document.Len()))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	for id, want := range map[int]string{1: "", 2: "the signature dictionary is stored in the object stream 3"} {
+		ptr := rdr.Xref()[id].Ptr()
+		signer := Signer{ByteRangeValid: true}
+		checkObjectStream(rdr.Resolve(ptr, ptr), rdr, &signer)
+		got := strings.Join(signer.ByteRangeErrors, "; ")
+		if want == "" && (got != "" || !signer.ByteRangeValid) || !strings.Contains(got, want) {
+			t.Errorf("object %d: expected the errors %q, got %q", id, want, got)
+		}
+		if want != "" && signer.ByteRangeValid {
+			t.Errorf("object %d: expected an invalid byte range", id)
+		}
+	}
+}
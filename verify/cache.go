@@ -0,0 +1,163 @@
+package verify
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// RevocationCache stores the OCSP responses and CRLs of external revocation
+// checks until they expire, so the same status is not requested for every
+// document. Implementations must be safe for concurrent use.
+type RevocationCache interface {
+	// Get returns the cached DER data for key, nil if it is missing or expired
+	Get(key string) []byte
+	// Put stores the DER data for key until expires
+	Put(key string, data []byte, expires time.Time) error
+}
+
+// ocspCacheKey returns the cache key of the OCSP response for cert, by the
+// issuer name and key and the serial number of cert.
+func ocspCacheKey(cert, issuer *x509.Certificate) string {
+	h := sha256.New()
+	h.Write(issuer.RawSubject)
+	h.Write(issuer.RawSubjectPublicKeyInfo)
+	return fmt.Sprintf("ocsp/%x/%x", h.Sum(nil), cert.SerialNumber)
+}
+
+// crlCacheKey returns the cache key of the CRL at url.
+func crlCacheKey(url string) string {
+	return "crl/" + url
+}
+
+// cachedRevocationData returns the data for key from the RevocationCache, nil
+// if there is no cache.
+func (options *VerifyOptions) cachedRevocationData(key string) []byte {
+	if options.RevocationCache == nil {
+		return nil
+	}
+	return options.RevocationCache.Get(key)
+}
+
+// cacheRevocationData stores the data for key in the RevocationCache, data
+// without an expiry is not cached. Failures only cost a repeated request and
+// are ignored.
+func (options *VerifyOptions) cacheRevocationData(key string, data []byte, expires time.Time) {
+	if options.RevocationCache == nil || expires.IsZero() || !expires.After(time.Now()) {
+		return
+	}
+	_ = options.RevocationCache.Put(key, data, expires)
+}
+
+// MemoryRevocationCache is a RevocationCache that holds the data in memory,
+// expired data is removed when it is requested.
+type MemoryRevocationCache struct {
+	mu      sync.Mutex
+	entries map[string]memoryCacheEntry
+}
+
+type memoryCacheEntry struct {
+	data    []byte
+	expires time.Time
+}
+
+// NewMemoryRevocationCache returns an empty MemoryRevocationCache.
+func NewMemoryRevocationCache() *MemoryRevocationCache {
+	return &MemoryRevocationCache{entries: make(map[string]memoryCacheEntry)}
+}
+
+// Get implements RevocationCache.
+func (c *MemoryRevocationCache) Get(key string) []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	if !entry.expires.After(time.Now()) {
+		delete(c.entries, key)
+		return nil
+	}
+	return entry.data
+}
+
+// Put implements RevocationCache.
+func (c *MemoryRevocationCache) Put(key string, data []byte, expires time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[string]memoryCacheEntry)
+	}
+	c.entries[key] = memoryCacheEntry{data: data, expires: expires}
+	return nil
+}
+
+// DiskRevocationCache is a RevocationCache that stores the data as files in
+// a directory, so it is shared between processes and kept across runs.
+type DiskRevocationCache struct {
+	dir string
+}
+
+// NewDiskRevocationCache returns a DiskRevocationCache in dir, which is
+// created if it does not exist.
+func NewDiskRevocationCache(dir string) (*DiskRevocationCache, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create revocation cache directory: %w", err)
+	}
+	return &DiskRevocationCache{dir: dir}, nil
+}
+
+// path returns the file of key, named by its hash as keys contain URLs.
+func (c *DiskRevocationCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
+
+// Get implements RevocationCache, the file of expired data is removed.
+func (c *DiskRevocationCache) Get(key string) []byte {
+	path := c.path(key)
+	content, err := os.ReadFile(path)
+	if err != nil || len(content) < 8 {
+		return nil
+	}
+	expires := time.Unix(0, int64(binary.BigEndian.Uint64(content[:8])))
+	if !expires.After(time.Now()) {
+		_ = os.Remove(path)
+		return nil
+	}
+	return content[8:]
+}
+
+// Put implements RevocationCache, the data is written to a temporary file
+// first so a concurrent Get never reads a partial file.
+func (c *DiskRevocationCache) Put(key string, data []byte, expires time.Time) error {
+	file, err := os.CreateTemp(c.dir, "tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create revocation cache file: %w", err)
+	}
+	defer func() {
+		_ = os.Remove(file.Name())
+	}()
+
+	content := binary.BigEndian.AppendUint64(make([]byte, 0, 8+len(data)), uint64(expires.UnixNano()))
+	content = append(content, data...)
+	if _, err := file.Write(content); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to write revocation cache file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write revocation cache file: %w", err)
+	}
+	if err := os.Rename(file.Name(), c.path(key)); err != nil {
+		return fmt.Errorf("failed to store revocation cache file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package verify
+
+import (
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestRevocationCache(t *testing.T) {
+	tests := []struct {
+		name  string
+		cache func(t *testing.T) RevocationCache
+	}{
+		{name: "memory", cache: func(t *testing.T) RevocationCache {
+			return NewMemoryRevocationCache()
+		}},
+		{name: "disk", cache: func(t *testing.T) RevocationCache {
+			cache, err := NewDiskRevocationCache(t.TempDir() + "/cache")
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			return cache
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := tt.cache(t)
+			if data := cache.Get("crl/http://crl.example.com/ca.crl"); data != nil {
+				t.Fatalf("expected an empty cache, got %q", data)
+			}
+
+			if err := cache.Put("crl/http://crl.example.com/ca.crl", []byte("crl"), time.Now().Add(time.Hour)); err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if err := cache.Put("ocsp/issuer/10", []byte("expired"), time.Now().Add(-time.Second)); err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			if data := cache.Get("crl/http://crl.example.com/ca.crl"); string(data) != "crl" {
+				t.Errorf("expected the cached CRL, got %q", data)
+			}
+			if data := cache.Get("ocsp/issuer/10"); data != nil {
+				t.Errorf("expected expired data to be missing, got %q", data)
+			}
+
+			// Put replaces the data of a key.
+			if err := cache.Put("crl/http://crl.example.com/ca.crl", []byte("newer crl"), time.Now().Add(time.Hour)); err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if data := cache.Get("crl/http://crl.example.com/ca.crl"); string(data) != "newer crl" {
+				t.Errorf("expected the newer CRL, got %q", data)
+			}
+		})
+	}
+}
+
+func TestDiskRevocationCacheShared(t *testing.T) {
+	dir := t.TempDir()
+	first, err := NewDiskRevocationCache(dir)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if err := first.Put("crl/http://crl.example.com/ca.crl", []byte("crl"), time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if err := first.Put("ocsp/issuer/10", []byte("expired"), time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	second, err := NewDiskRevocationCache(dir)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if data := second.Get("crl/http://crl.example.com/ca.crl"); string(data) != "crl" {
+		t.Errorf("expected the CRL of the first cache, got %q", data)
+	}
+	if data := second.Get("ocsp/issuer/10"); data != nil {
+		t.Errorf("expected expired data to be missing, got %q", data)
+	}
+
+	// The file of the expired data is removed, no temporary files are left.
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected a single cache file, got %d", len(entries))
+	}
+}
+
+func TestExternalRevocationCache(t *testing.T) {
+	issuer, issuerKey := newTestCRLIssuer(t, "pdfsign Test CRL Issuer")
+	crl := newTestCRL(t, issuer, issuerKey, time.Now().Add(time.Hour))
+
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+		if r.URL.Path == "/ca.crl" {
+			_, _ = w.Write(crl)
+			return
+		}
+		der, _ := io.ReadAll(r.Body)
+		request, err := ocsp.ParseRequest(der)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		response, err := ocsp.CreateResponse(issuer, issuer, ocsp.Response{
+			Status:       ocsp.Good,
+			SerialNumber: request.SerialNumber,
+			ThisUpdate:   time.Now().Add(-time.Minute),
+			NextUpdate:   time.Now().Add(time.Hour),
+		}, issuerKey)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write(response)
+	}))
+	defer server.Close()
+
+	newLeaf := func(serial int64) *x509.Certificate {
+		leaf, _ := newTestLeaf(t, issuer, issuerKey, serial, func(template *x509.Certificate) {
+			template.OCSPServer = []string{server.URL + "/ocsp"}
+			template.CRLDistributionPoints = []string{server.URL + "/ca.crl"}
+		})
+		return leaf
+	}
+
+	options := &VerifyOptions{
+		EnableExternalRevocationCheck: true,
+		RevocationCache:               NewMemoryRevocationCache(),
+	}
+	first, second := newLeaf(10), newLeaf(11)
+	for _, leaf := range []*x509.Certificate{first, second, first, second} {
+		if _, err := performExternalOCSPCheck(leaf, issuer, options); err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+		if _, _, err := performExternalCRLCheck(leaf, issuer, options); err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+	}
+
+	// OCSP responses are cached by serial, the CRL by URL.
+	if requests["/ocsp"] != 2 {
+		t.Errorf("expected an OCSP request per certificate, got %d", requests["/ocsp"])
+	}
+	if requests["/ca.crl"] != 1 {
+		t.Errorf("expected a single CRL request, got %d", requests["/ca.crl"])
+	}
+}
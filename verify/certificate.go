@@ -1,8 +1,10 @@
 package verify
 
 import (
+	"bytes"
 	"crypto/x509"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/digitorus/pdfsign/revocation"
@@ -12,12 +14,16 @@ import (
 )
 
 // buildCertificateChainsWithOptions builds certificate chains with custom verification options
-func buildCertificateChainsWithOptions(p7 *pkcs7.PKCS7, signer *Signer, revInfo revocation.InfoArchival, options *VerifyOptions) (string, error) {
-	// Directory of certificates, including OCSP
+func buildCertificateChainsWithOptions(p7 *pkcs7.PKCS7, signer *Signer, revInfo revocation.InfoArchival, dssCertificates []*x509.Certificate, options *VerifyOptions) (string, error) {
+	// Directory of certificates, including OCSP and the DSS of the document
 	certPool := x509.NewCertPool()
 	for _, cert := range p7.Certificates {
 		certPool.AddCert(cert)
 	}
+	for _, cert := range dssCertificates {
+		certPool.AddCert(cert)
+	}
+	embeddedCertificates := slices.Concat(p7.Certificates, dssCertificates)
 
 	// Determine the verification time and set up time tracking fields
 	var verificationTime *time.Time
@@ -27,28 +33,39 @@ func buildCertificateChainsWithOptions(p7 *pkcs7.PKCS7, signer *Signer, revInfo
 	signer.TimeWarnings = []string{}
 	signer.TimestampStatus = "missing"
 	signer.TimestampTrusted = false
+	if signer.TimestampError != "" {
+		signer.TimestampStatus = "invalid"
+	}
 
-	// Always prioritize embedded timestamp if present
-	if signer.TimeStamp != nil && !signer.TimeStamp.Time.IsZero() {
+	// Always prioritize a valid embedded timestamp if present
+	if signer.TimeStamp != nil && !signer.TimeStamp.Time.IsZero() && signer.TimestampError == "" {
 		verificationTime = &signer.TimeStamp.Time
+		signer.TimestampTime = verificationTime
 		signer.TimeSource = "embedded_timestamp"
 		signer.TimestampStatus = "valid"
 
 		// Validate timestamp certificate if enabled
 		if options.ValidateTimestampCertificates {
-			timestampTrusted, timestampWarning := validateTimestampCertificate(signer.TimeStamp, options)
+			timestampTrusted, timestampWarning := validateTimestampCertificate(signer.TimeStamp, embeddedCertificates, options)
 			signer.TimestampTrusted = timestampTrusted
 			if timestampWarning != "" {
 				signer.TimeWarnings = append(signer.TimeWarnings, timestampWarning)
 			}
 		}
-	} else if options.TrustSignatureTime && signer.SignatureTime != nil {
+	} else if options.TrustSignatureTime && signer.SignatureTime != nil && options.ValidationTime.IsZero() {
 		// Use signature time as fallback with warning about its untrusted nature
 		verificationTime = signer.SignatureTime
 		signer.TimeSource = "signature_time"
 		signer.TimeWarnings = append(signer.TimeWarnings,
 			"Using signature time as fallback - this time is provided by the signatory and should be considered untrusted")
 	}
+
+	// The validation time of the options replaces any other time
+	if !options.ValidationTime.IsZero() {
+		validationTime := options.ValidationTime
+		verificationTime = &validationTime
+		signer.TimeSource = "validation_time"
+	}
 	// If verificationTime is nil, x509.Verify will use current time (default behavior)
 
 	// Set the verification time used
@@ -109,15 +126,26 @@ func buildCertificateChainsWithOptions(p7 *pkcs7.PKCS7, signer *Signer, revInfo
 		}
 	}
 
+	anchors, anchorErr := options.trustAnchors()
+	if anchorErr != nil && errorMsg == "" {
+		errorMsg = fmt.Sprintf("Failed to load trust anchors: %v", anchorErr)
+	}
+
 	// Get appropriate EKUs for certificate verification
 	verificationEKUs := getVerificationEKUs()
+	if options.chainEKUs != nil {
+		verificationEKUs = options.chainEKUs
+	}
+
+	ekuOIDs := slices.Concat(options.RequiredEKUOIDs, options.AllowedEKUOIDs)
 
 	// Helper function to create x509.VerifyOptions with the appropriate time
+	var keyUsages []x509.ExtKeyUsage
 	createVerifyOptions := func(roots, intermediates *x509.CertPool) x509.VerifyOptions {
 		opts := x509.VerifyOptions{
 			Roots:         roots,
 			Intermediates: intermediates,
-			KeyUsages:     verificationEKUs,
+			KeyUsages:     keyUsages,
 		}
 		if verificationTime != nil {
 			opts.CurrentTime = *verificationTime
@@ -125,6 +153,8 @@ func buildCertificateChainsWithOptions(p7 *pkcs7.PKCS7, signer *Signer, revInfo
 		return opts
 	}
 
+	signer.signingCertificate = p7.GetOnlySigner()
+
 	for _, cert := range p7.Certificates {
 		var c Certificate
 		c.Certificate = cert
@@ -132,8 +162,35 @@ func buildCertificateChainsWithOptions(p7 *pkcs7.PKCS7, signer *Signer, revInfo
 		// Validate Key Usage and Extended Key Usage for PDF signing
 		c.KeyUsageValid, c.KeyUsageError, c.ExtKeyUsageValid, c.ExtKeyUsageError = validateKeyUsage(cert, options)
 
-		// Try to verify with system root CAs first
-		chain, err := cert.Verify(createVerifyOptions(nil, certPool))
+		// crypto/x509 only matches the EKUs it has constants for, those given
+		// by OID were checked by validateKeyUsage
+		keyUsages = verificationEKUs
+		if options.chainEKUs == nil && hasExtKeyUsageOID(cert, ekuOIDs) {
+			keyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageAny}
+		}
+
+		// Try to verify with system root CAs first, unless they are disabled
+		chain, err := cert.Verify(createVerifyOptions(options.systemRoots(), certPool))
+
+		// The trust anchors of the providers complete the system roots, the
+		// anchor of the signing certificate determines its qualified status
+		signing := signer.signingCertificate != nil && cert.Equal(signer.signingCertificate)
+		if len(anchors) > 0 && (err != nil || signing) {
+			anchorChain, anchor, anchorErr := verifyTrustAnchors(cert, anchors, createVerifyOptions(nil, certPool), *signer.VerificationTime)
+			switch {
+			case anchorErr == nil:
+				if err != nil {
+					chain, err = anchorChain, nil
+				}
+				if signing {
+					signer.TrustAnchor = anchor
+					signer.Qualified = anchor.qualifiedAt(*signer.VerificationTime)
+					signer.TrustSources = trustSources(anchorChain, anchors, *signer.VerificationTime)
+				}
+			case anchorChain != nil && err != nil:
+				err = anchorErr
+			}
+		}
 
 		if err == nil {
 			// Successfully verified against system trusted roots
@@ -160,10 +217,21 @@ func buildCertificateChainsWithOptions(p7 *pkcs7.PKCS7, signer *Signer, revInfo
 
 		if err != nil {
 			c.VerifyError = err.Error()
+			c.verifyErr = err
+		}
+
+		// The issuer is needed to check the OCSP responses of certificates
+		// whose chain could not be verified as well.
+		issuer := certificateIssuer(cert, chain, embeddedCertificates)
+
+		// An expired certificate can be valid at the time of the timestamp
+		c.Expired = options.validationTime().After(cert.NotAfter)
+		if c.Expired && err == nil && signer.TimeSource == "embedded_timestamp" {
+			acceptExpiredCertificate(&c, issuer, revInfo, signer)
 		}
 
 		if resp, ok := ocspStatus[fmt.Sprintf("%x", cert.SerialNumber)]; ok {
-			c.OCSPResponse = resp
+			c.setOCSPResponse(resp)
 			c.OCSPEmbedded = true
 
 			if resp.Status != ocsp.Good {
@@ -176,7 +244,7 @@ func buildCertificateChainsWithOptions(p7 *pkcs7.PKCS7, signer *Signer, revInfo
 					signer.RevokedCertificate = true
 				} else {
 					// Add warning that certificate was revoked after signing
-					if signer.TimeSource == "embedded_timestamp" {
+					if isTrustedTimeSource(signer.TimeSource) {
 						signer.TimeWarnings = append(signer.TimeWarnings,
 							fmt.Sprintf("Certificate was revoked after signing time (revoked: %v, signed: %v)",
 								resp.RevokedAt, signer.VerificationTime))
@@ -189,8 +257,7 @@ func buildCertificateChainsWithOptions(p7 *pkcs7.PKCS7, signer *Signer, revInfo
 				}
 			}
 
-			if len(chain) > 0 && len(chain[0]) > 1 {
-				issuer := chain[0][1]
+			if issuer != nil {
 				if resp.Certificate != nil {
 					err = resp.Certificate.CheckSignatureFrom(issuer)
 					if err != nil {
@@ -220,7 +287,7 @@ func buildCertificateChainsWithOptions(p7 *pkcs7.PKCS7, signer *Signer, revInfo
 				signer.RevokedCertificate = true
 			} else {
 				// Add warning that certificate was revoked after signing
-				if signer.TimeSource == "embedded_timestamp" {
+				if isTrustedTimeSource(signer.TimeSource) {
 					signer.TimeWarnings = append(signer.TimeWarnings,
 						fmt.Sprintf("Certificate was revoked after signing time (revoked: %v, signed: %v)",
 							revocationTime, signer.VerificationTime))
@@ -236,13 +303,17 @@ func buildCertificateChainsWithOptions(p7 *pkcs7.PKCS7, signer *Signer, revInfo
 			c.CRLEmbedded = true
 		}
 
-		// Perform external revocation checks if enabled
-		if options.EnableExternalRevocationCheck {
+		// Perform external revocation checks if enabled, or with the
+		// revocation bundle
+		if options.EnableExternalRevocationCheck || options.RevocationBundle != nil {
 			// External OCSP check
-			if !c.OCSPEmbedded && len(cert.OCSPServer) > 0 && len(chain) > 0 && len(chain[0]) > 1 {
-				issuer := chain[0][1]
-				if externalOCSPResp, err := performExternalOCSPCheck(cert, issuer, options); err == nil {
-					c.OCSPResponse = externalOCSPResp
+			if !c.OCSPEmbedded && len(cert.OCSPServer) > 0 && issuer == nil {
+				c.OCSPError = "issuer certificate not found"
+			} else if !c.OCSPEmbedded && len(cert.OCSPServer) > 0 {
+				if externalOCSPResp, err := performExternalOCSPCheck(cert, issuer, options); err != nil {
+					c.OCSPError = err.Error()
+				} else {
+					c.setOCSPResponse(externalOCSPResp)
 					c.OCSPExternal = true
 
 					if externalOCSPResp.Status != ocsp.Good {
@@ -255,7 +326,7 @@ func buildCertificateChainsWithOptions(p7 *pkcs7.PKCS7, signer *Signer, revInfo
 							signer.RevokedCertificate = true
 						} else {
 							// Add warning that certificate was revoked after signing
-							if signer.TimeSource == "embedded_timestamp" {
+							if isTrustedTimeSource(signer.TimeSource) {
 								signer.TimeWarnings = append(signer.TimeWarnings,
 									fmt.Sprintf("Certificate was revoked after signing time (external OCSP - revoked: %v, signed: %v)",
 										externalOCSPResp.RevokedAt, signer.VerificationTime))
@@ -270,9 +341,13 @@ func buildCertificateChainsWithOptions(p7 *pkcs7.PKCS7, signer *Signer, revInfo
 				}
 			}
 
-			// External CRL check
-			if !c.CRLEmbedded && len(cert.CRLDistributionPoints) > 0 {
-				if revocationTime, isRevoked, err := performExternalCRLCheck(cert, options); err == nil {
+			// External CRL check, skipped when OCSP provided the status and
+			// CRLs are only a fallback
+			hasOCSPStatus := c.OCSPEmbedded || c.OCSPExternal
+			if !c.CRLEmbedded && len(cert.CRLDistributionPoints) > 0 && !(options.CRLFallbackOnly && hasOCSPStatus) {
+				if revocationTime, isRevoked, err := performExternalCRLCheck(cert, issuer, options); err != nil {
+					c.CRLError = err.Error()
+				} else {
 					c.CRLExternal = true
 					if isRevoked {
 						c.RevocationTime = revocationTime
@@ -284,7 +359,7 @@ func buildCertificateChainsWithOptions(p7 *pkcs7.PKCS7, signer *Signer, revInfo
 							signer.RevokedCertificate = true
 						} else {
 							// Add warning that certificate was revoked after signing
-							if signer.TimeSource == "embedded_timestamp" {
+							if isTrustedTimeSource(signer.TimeSource) {
 								signer.TimeWarnings = append(signer.TimeWarnings,
 									fmt.Sprintf("Certificate was revoked after signing time (external CRL - revoked: %v, signed: %v)",
 										revocationTime, signer.VerificationTime))
@@ -314,6 +389,8 @@ func buildCertificateChainsWithOptions(p7 *pkcs7.PKCS7, signer *Signer, revInfo
 			if canCheckExternally {
 				if options.EnableExternalRevocationCheck {
 					c.RevocationWarning = "External revocation checking enabled but failed to retrieve status from distribution points."
+				} else if options.RevocationBundle != nil {
+					c.RevocationWarning = "No embedded revocation status found and none in the revocation bundle."
 				} else {
 					c.RevocationWarning = "No embedded revocation status found. Certificate has distribution points but external checking is not enabled."
 				}
@@ -345,14 +422,59 @@ func buildCertificateChainsWithOptions(p7 *pkcs7.PKCS7, signer *Signer, revInfo
 		signer.Certificates = append(signer.Certificates, c)
 	}
 
+	// Expired certificates without revocation data of their validity period
+	// are not trusted
+	for _, c := range signer.Certificates {
+		if c.ExpiryError != "" {
+			trustedIssuer = false
+		}
+	}
+
 	// Set trusted issuer flag based on whether any certificate was verified against system roots
 	signer.TrustedIssuer = trustedIssuer
 
 	return errorMsg, nil
 }
 
-// validateTimestampCertificate validates the timestamp token's signing certificate
-func validateTimestampCertificate(ts *timestamp.Timestamp, options *VerifyOptions) (bool, string) {
+// certificateIssuer returns the issuer of cert, the second certificate of its
+// verified chain or else the certificate of the signature that signed it, nil
+// if it is not known.
+func certificateIssuer(cert *x509.Certificate, chain [][]*x509.Certificate, certificates []*x509.Certificate) *x509.Certificate {
+	if len(chain) > 0 && len(chain[0]) > 1 {
+		return chain[0][1]
+	}
+	for _, candidate := range certificates {
+		if candidate != cert && bytes.Equal(candidate.RawSubject, cert.RawIssuer) && cert.CheckSignatureFrom(candidate) == nil {
+			return candidate
+		}
+	}
+	return nil
+}
+
+// setOCSPResponse records the OCSP response of the certificate and its status.
+func (c *Certificate) setOCSPResponse(resp *ocsp.Response) {
+	c.OCSPResponse = resp
+	switch resp.Status {
+	case ocsp.Good:
+		c.OCSPStatus = "good"
+	case ocsp.Revoked:
+		c.OCSPStatus = "revoked"
+	default:
+		c.OCSPStatus = "unknown"
+	}
+	if !resp.ThisUpdate.IsZero() {
+		thisUpdate := resp.ThisUpdate
+		c.OCSPThisUpdate = &thisUpdate
+	}
+	if !resp.NextUpdate.IsZero() {
+		nextUpdate := resp.NextUpdate
+		c.OCSPNextUpdate = &nextUpdate
+	}
+}
+
+// validateTimestampCertificate validates the timestamp token's signing certificate,
+// certificates of the signature and the DSS complete the chain of the token
+func validateTimestampCertificate(ts *timestamp.Timestamp, certificates []*x509.Certificate, options *VerifyOptions) (bool, string) {
 	if ts == nil {
 		return false, "No timestamp to validate"
 	}
@@ -362,30 +484,26 @@ func validateTimestampCertificate(ts *timestamp.Timestamp, options *VerifyOption
 	if err != nil {
 		return false, fmt.Sprintf("Failed to parse timestamp token: %v", err)
 	}
+	if len(p7.Certificates) == 0 {
+		p7.Certificates = certificates
+	}
 
 	// Create certificate pool from timestamp certificates
 	certPool := x509.NewCertPool()
-	for _, cert := range p7.Certificates {
+	for _, cert := range slices.Concat(p7.Certificates, certificates) {
 		certPool.AddCert(cert)
 	}
 
-	// Find the timestamp signing certificate
-	var timestampCert *x509.Certificate
-	for _, cert := range p7.Certificates {
-		// Look for the certificate that signed the timestamp
-		// Usually this will be the first one, but we should verify
-		if cert.KeyUsage&x509.KeyUsageDigitalSignature != 0 {
-			timestampCert = cert
-			break
-		}
-	}
-
+	// Find the timestamp signing certificate by the issuer and serial
+	// number of the signer of the token
+	timestampCert := p7.GetOnlySigner()
 	if timestampCert == nil {
 		return false, "No timestamp signing certificate found"
 	}
 
 	// Verify the timestamp certificate chain against system trusted roots
 	opts := x509.VerifyOptions{
+		Roots:         options.systemRoots(),
 		Intermediates: certPool,
 		CurrentTime:   ts.Time, // Use timestamp time for validation
 		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
@@ -393,6 +511,12 @@ func validateTimestampCertificate(ts *timestamp.Timestamp, options *VerifyOption
 
 	_, err = timestampCert.Verify(opts)
 	if err != nil {
+		// Try the trust anchors of the providers, such as qualified TSAs
+		if anchors, _ := options.trustAnchors(); len(anchors) > 0 {
+			if _, _, anchorErr := verifyTrustAnchors(timestampCert, anchors, opts, ts.Time); anchorErr == nil {
+				return true, ""
+			}
+		}
 		// Try with embedded certificates as roots if allowed
 		if options.AllowUntrustedRoots {
 			opts.Roots = certPool
@@ -420,11 +544,18 @@ func isRevokedBeforeSigning(revocationTime time.Time, signingTime *time.Time, ti
 		return true
 	}
 
-	// For embedded timestamps (trusted), we can make a proper determination
-	if timeSource == "embedded_timestamp" {
+	// For embedded timestamps (trusted) and the validation time of the
+	// options, we can make a proper determination
+	if isTrustedTimeSource(timeSource) {
 		return revocationTime.Before(*signingTime)
 	}
 
 	// Default to conservative behavior
 	return true
 }
+
+// isTrustedTimeSource reports whether the verification time of timeSource
+// is proven or chosen by the caller, rather than assumed.
+func isTrustedTimeSource(timeSource string) bool {
+	return timeSource == "embedded_timestamp" || timeSource == "validation_time"
+}
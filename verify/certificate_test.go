@@ -0,0 +1,253 @@
+package verify
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdfsign/revocation"
+	"github.com/digitorus/pkcs7"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestBuildCertificateChainsOCSPStatus(t *testing.T) {
+	issuerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	issuerDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "pdfsign Test Untrusted CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, &x509.Certificate{Subject: pkix.Name{CommonName: "pdfsign Test Untrusted CA"}}, &issuerKey.PublicKey, issuerKey)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	issuer, err := x509.ParseCertificate(issuerDER)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	thisUpdate := time.Now().Add(-time.Minute).Truncate(time.Second)
+	nextUpdate := time.Now().Add(time.Hour).Truncate(time.Second)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		der, _ := io.ReadAll(r.Body)
+		request, err := ocsp.ParseRequest(der)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		serial := request.SerialNumber
+		status := map[int64]int{10: ocsp.Good, 11: ocsp.Revoked}[serial.Int64()]
+		if serial.Int64() > 11 {
+			status = ocsp.Unknown
+		}
+		// The response for serial 13 is about another certificate.
+		if serial.Int64() == 13 {
+			serial = big.NewInt(10)
+		}
+		response, err := ocsp.CreateResponse(issuer, issuer, ocsp.Response{
+			Status:       status,
+			SerialNumber: serial,
+			ThisUpdate:   thisUpdate,
+			NextUpdate:   nextUpdate,
+			RevokedAt:    time.Now().Add(-time.Hour),
+		}, issuerKey)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write(response)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		serial     int64
+		wantStatus string
+		wantError  string
+	}{
+		{name: "good", serial: 10, wantStatus: "good"},
+		{name: "revoked", serial: 11, wantStatus: "revoked"},
+		{name: "unknown", serial: 12, wantStatus: "unknown"},
+		{name: "response for another certificate", serial: 13, wantError: "failed to parse OCSP response"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			leafDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+				SerialNumber: big.NewInt(tt.serial),
+				Subject:      pkix.Name{CommonName: "pdfsign Test OCSP Signer"},
+				NotBefore:    time.Now().Add(-time.Hour),
+				NotAfter:     time.Now().Add(time.Hour),
+				KeyUsage:     x509.KeyUsageDigitalSignature,
+				OCSPServer:   []string{server.URL},
+			}, issuer, &leafKey.PublicKey, issuerKey)
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			leaf, err := x509.ParseCertificate(leafDER)
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			// The issuer is not trusted, it is found in the certificates
+			// of the signature.
+			signer := &Signer{}
+			options := DefaultVerifyOptions()
+			options.EnableExternalRevocationCheck = true
+			p7 := &pkcs7.PKCS7{Certificates: []*x509.Certificate{leaf, issuer}}
+			if _, err := buildCertificateChainsWithOptions(p7, signer, revocation.InfoArchival{}, nil, options); err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			c := signer.Certificates[0]
+			if c.VerifyError == "" {
+				t.Errorf("expected the chain of the untrusted issuer to fail")
+			}
+			if tt.wantError != "" {
+				if c.OCSPExternal || !strings.Contains(c.OCSPError, tt.wantError) {
+					t.Fatalf("expected an OCSP error containing %q, got %q", tt.wantError, c.OCSPError)
+				}
+				return
+			}
+			if !c.OCSPExternal || c.OCSPError != "" {
+				t.Fatalf("expected an external OCSP response, got %q", c.OCSPError)
+			}
+			if c.OCSPStatus != tt.wantStatus {
+				t.Errorf("expected status %q, got %q", tt.wantStatus, c.OCSPStatus)
+			}
+			if c.OCSPThisUpdate == nil || !c.OCSPThisUpdate.Equal(thisUpdate) {
+				t.Errorf("expected this update %s, got %v", thisUpdate, c.OCSPThisUpdate)
+			}
+			if c.OCSPNextUpdate == nil || !c.OCSPNextUpdate.Equal(nextUpdate) {
+				t.Errorf("expected next update %s, got %v", nextUpdate, c.OCSPNextUpdate)
+			}
+			// Responses other than good are treated as revoked.
+			if revoked := tt.wantStatus != "good"; signer.RevokedCertificate != revoked {
+				t.Errorf("expected revoked %t, got %t", revoked, signer.RevokedCertificate)
+			}
+
+			// The issuer has no OCSP responder.
+			if signer.Certificates[1].OCSPStatus != "" || signer.Certificates[1].OCSPError != "" {
+				t.Errorf("expected no OCSP check of the issuer")
+			}
+		})
+	}
+}
+
+func TestBuildCertificateChainsCRLFallback(t *testing.T) {
+	issuer, issuerKey := newTestCRLIssuer(t, "pdfsign Test Untrusted CA")
+	crl := newTestCRL(t, issuer, issuerKey, time.Now().Add(time.Hour))
+
+	var crlRequests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ca.crl" {
+			crlRequests++
+			_, _ = w.Write(crl)
+			return
+		}
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		der, _ := io.ReadAll(r.Body)
+		request, err := ocsp.ParseRequest(der)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// Only serial 10 is known to the responder.
+		status := ocsp.Unknown
+		if request.SerialNumber.Int64() == 10 {
+			status = ocsp.Good
+		}
+		response, err := ocsp.CreateResponse(issuer, issuer, ocsp.Response{
+			Status:       status,
+			SerialNumber: request.SerialNumber,
+			ThisUpdate:   time.Now().Add(-time.Minute),
+			NextUpdate:   time.Now().Add(time.Hour),
+		}, issuerKey)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write(response)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		ocspServers  []string
+		fallbackOnly bool
+		wantCRL      bool
+	}{
+		{name: "complement", ocspServers: []string{server.URL}, wantCRL: true},
+		{name: "fallback with OCSP status", ocspServers: []string{server.URL}, fallbackOnly: true},
+		{name: "fallback without OCSP responder", fallbackOnly: true, wantCRL: true},
+		{name: "fallback with failing OCSP responder", ocspServers: []string{server.URL + "/missing"}, fallbackOnly: true, wantCRL: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			crlRequests = 0
+			leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			leafDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+				SerialNumber:          big.NewInt(10),
+				Subject:               pkix.Name{CommonName: "pdfsign Test CRL Signer"},
+				NotBefore:             time.Now().Add(-time.Hour),
+				NotAfter:              time.Now().Add(time.Hour),
+				KeyUsage:              x509.KeyUsageDigitalSignature,
+				OCSPServer:            tt.ocspServers,
+				CRLDistributionPoints: []string{server.URL + "/ca.crl"},
+			}, issuer, &leafKey.PublicKey, issuerKey)
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			leaf, err := x509.ParseCertificate(leafDER)
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			signer := &Signer{}
+			options := DefaultVerifyOptions()
+			options.EnableExternalRevocationCheck = true
+			options.CRLFallbackOnly = tt.fallbackOnly
+			p7 := &pkcs7.PKCS7{Certificates: []*x509.Certificate{leaf, issuer}}
+			if _, err := buildCertificateChainsWithOptions(p7, signer, revocation.InfoArchival{}, nil, options); err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			c := signer.Certificates[0]
+			if c.CRLExternal != tt.wantCRL || c.CRLError != "" {
+				t.Errorf("expected external CRL %t, got %t (%s)", tt.wantCRL, c.CRLExternal, c.CRLError)
+			}
+			if wantRequests := map[bool]int{true: 1}[tt.wantCRL]; crlRequests != wantRequests {
+				t.Errorf("expected %d CRL requests, got %d", wantRequests, crlRequests)
+			}
+			if signer.RevokedCertificate {
+				t.Errorf("expected the certificate not to be revoked")
+			}
+		})
+	}
+}
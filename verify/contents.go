@@ -0,0 +1,112 @@
+package verify
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/digitorus/pdf"
+)
+
+// checkContents records the anomalies of the Contents of the signature
+// dictionary v. The hex string of the contents is excluded from the byte
+// range, so any data in it besides the signature and its zero padding is
+// unsigned and may be used to wrap a different signature; such contents
+// invalidate the byte range.
+func checkContents(v pdf.Value, signer *Signer) {
+	signer.ContentsAnomalies = contentsAnomalies([]byte(v.Key("Contents").RawString()))
+	if len(signer.ContentsAnomalies) > 0 {
+		signer.ByteRangeErrors = append(signer.ByteRangeErrors, "the signature contents hold data besides the signature and its zero padding")
+		signer.ByteRangeValid = false
+	}
+}
+
+// contentsAnomalies returns the anomalies of the signature contents: a
+// structure that does not fit into the contents, structures concatenated to
+// the first one and other data in place of the zero padding.
+func contentsAnomalies(contents []byte) []string {
+	if len(contents) == 0 {
+		return nil
+	}
+	n, err := berLength(contents, 0)
+	if err != nil {
+		return []string{fmt.Sprintf("the signature contents are not a valid structure: %v", err)}
+	}
+
+	var anomalies []string
+	rest := contents[n:]
+	structures := 1
+	for len(rest) > 0 && rest[0] != 0 {
+		n, err := berLength(rest, 0)
+		if err != nil {
+			break
+		}
+		structures++
+		rest = rest[n:]
+	}
+	if structures > 1 {
+		anomalies = append(anomalies, fmt.Sprintf("%d structures are concatenated in the signature contents", structures))
+	}
+	if i := bytes.IndexFunc(rest, func(r rune) bool { return r != 0 }); i >= 0 {
+		anomalies = append(anomalies, fmt.Sprintf("non-zero bytes at offset %d of the signature contents, where zero padding is expected", len(contents)-len(rest)+i))
+	}
+	return anomalies
+}
+
+// berLength returns the length of the BER encoded element at the start of
+// data, with its tag and length, also of elements of indefinite length.
+// The depth of nested elements of indefinite length is limited.
+func berLength(data []byte, depth int) (int, error) {
+	if depth > 32 {
+		return 0, errors.New("elements of indefinite length are nested too deeply")
+	}
+	i := 1
+	if len(data) > 0 && data[0]&0x1f == 0x1f {
+		for i < len(data) && data[i]&0x80 != 0 {
+			i++
+		}
+		i++
+	}
+	if i >= len(data) {
+		return 0, errors.New("truncated element header")
+	}
+
+	l := data[i]
+	i++
+	switch {
+	case l < 0x80:
+		if int(l) > len(data)-i {
+			return 0, fmt.Errorf("an element declares %d bytes, more than the %d bytes that remain", int(l), len(data)-i)
+		}
+		return i + int(l), nil
+	case l == 0x80:
+		if data[0]&0x20 == 0 {
+			return 0, errors.New("primitive element of indefinite length")
+		}
+		for i+2 <= len(data) {
+			if data[i] == 0 && data[i+1] == 0 {
+				return i + 2, nil
+			}
+			n, err := berLength(data[i:], depth+1)
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+		return 0, errors.New("element of indefinite length without end-of-contents")
+	}
+
+	size := int(l & 0x7f)
+	if size > 4 || size > len(data)-i {
+		return 0, fmt.Errorf("invalid length of %d bytes", size)
+	}
+	length := 0
+	for _, b := range data[i : i+size] {
+		length = length<<8 | int(b)
+	}
+	i += size
+	if length > len(data)-i {
+		return 0, fmt.Errorf("an element declares %d bytes, more than the %d bytes that remain", length, len(data)-i)
+	}
+	return i + length, nil
+}
@@ -0,0 +1,68 @@
+package verify
+
+import (
+	"encoding/asn1"
+	"reflect"
+	"testing"
+)
+
+func TestContentsAnomalies(t *testing.T) {
+	cms, err := asn1.Marshal(struct {
+		Version int
+		Content []byte
+	}{1, make([]byte, 300)})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	padded := append(append([]byte(nil), cms...), make([]byte, 64)...)
+	join := func(parts ...[]byte) []byte {
+		var b []byte
+		for _, p := range parts {
+			b = append(b, p...)
+		}
+		return b
+	}
+
+	tests := []struct {
+		name     string
+		contents []byte
+		want     []string
+	}{
+		{
+			name:     "zero padding",
+			contents: padded,
+		},
+		{
+			name:     "indefinite length",
+			contents: []byte{0x30, 0x80, 0x02, 0x01, 0x01, 0x24, 0x80, 0x04, 0x01, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+		},
+		{
+			name:     "garbage after the CMS",
+			contents: join(cms, []byte{0, 0, 0xde, 0xad}, make([]byte, 8)),
+			want:     []string{"non-zero bytes at offset 313 of the signature contents, where zero padding is expected"},
+		},
+		{
+			name:     "concatenated structures",
+			contents: join(cms, cms, make([]byte, 8)),
+			want:     []string{"2 structures are concatenated in the signature contents"},
+		},
+		{
+			name:     "larger than the contents",
+			contents: cms[:200],
+			want:     []string{"the signature contents are not a valid structure: an element declares 307 bytes, more than the 196 bytes that remain"},
+		},
+		{
+			name:     "no end-of-contents",
+			contents: []byte{0x30, 0x80, 0x02, 0x01, 0x01},
+			want:     []string{"the signature contents are not a valid structure: element of indefinite length without end-of-contents"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := contentsAnomalies(tt.contents); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected the anomalies %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package verify
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"time"
+
+	"github.com/digitorus/pkcs7"
+)
+
+var (
+	oidAttributeContentType      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttributeCounterSignature = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 6}
+)
+
+// Countersignature is a CMS countersignature of RFC 5652 in the unsigned
+// attributes of a signature, a signature of another party over the
+// signature value, such as a notary or an approving manager.
+type Countersignature struct {
+	Subject         string     `json:"subject,omitempty"`          // Subject of the countersigner certificate
+	Issuer          string     `json:"issuer,omitempty"`           // Issuer of the countersigner certificate
+	SerialNumber    string     `json:"serial_number,omitempty"`    // Hex encoded serial number of the countersigner certificate
+	SigningTime     *time.Time `json:"signing_time,omitempty"`     // Claimed by the countersigner, not proven
+	DigestAlgorithm string     `json:"digest_algorithm,omitempty"` // Such as "SHA-256"
+	Status          string     `json:"status"`                     // "valid", "invalid" or "indeterminate"
+	ValidSignature  bool       `json:"valid_signature"`            // Whether the countersignature matches the signature value
+	Trusted         bool       `json:"trusted"`                    // Whether the countersigner certificate chains to a trusted root or anchor
+	Error           string     `json:"error,omitempty"`            // Why the countersignature is invalid or indeterminate
+
+	Certificate *x509.Certificate `json:"-"` // The countersigner certificate, if the signature contains it
+}
+
+// counterSignerInfo is the SignerInfo of a countersignature, with the raw
+// signer identifier and signed attributes, which the signature covers.
+type counterSignerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttributes   asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttributes asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+// processCountersignatures verifies the countersignature attributes of the
+// signers of p7 with the certificates of the signature and the DSS. The
+// countersigner certificates are validated at the verification time of the
+// signature, their revocation status is not checked.
+func processCountersignatures(p7 *pkcs7.PKCS7, signer *Signer, certificates []*x509.Certificate, options *VerifyOptions) {
+	t := options.validationTime()
+	if signer.VerificationTime != nil {
+		t = *signer.VerificationTime
+	}
+	for _, s := range p7.Signers {
+		for _, attr := range s.UnauthenticatedAttributes {
+			if attr.Type.Equal(oidAttributeCounterSignature) {
+				signer.Countersignatures = append(signer.Countersignatures, verifyCountersignatures(attr.Value.Bytes, s.EncryptedDigest, certificates, options, t)...)
+			}
+		}
+	}
+}
+
+// verifyCountersignatures verifies the SignerInfos of the value of a
+// countersignature attribute over the signature value.
+func verifyCountersignatures(value, signature []byte, certificates []*x509.Certificate, options *VerifyOptions, t time.Time) []Countersignature {
+	var countersignatures []Countersignature
+	for len(value) > 0 {
+		var info counterSignerInfo
+		rest, err := asn1.Unmarshal(value, &info)
+		if err != nil {
+			return append(countersignatures, Countersignature{
+				Status: "invalid",
+				Error:  fmt.Sprintf("invalid countersignature: %v", err),
+			})
+		}
+		value = rest
+		countersignatures = append(countersignatures, verifyCountersignature(info, signature, certificates, options, t))
+	}
+	return countersignatures
+}
+
+// verifyCountersignature verifies a countersignature over the signature
+// value: its message digest, its signature by the countersigner
+// certificate and the chain of that certificate at t.
+func verifyCountersignature(info counterSignerInfo, signature []byte, certificates []*x509.Certificate, options *VerifyOptions, t time.Time) Countersignature {
+	cs := Countersignature{Status: "invalid"}
+
+	cert, err := countersignerCertificate(info.SID, certificates, &cs)
+	if err != nil {
+		cs.Error = err.Error()
+		return cs
+	}
+	cs.Certificate = cert
+	cs.Subject = cert.Subject.String()
+	cs.Issuer = cert.Issuer.String()
+	cs.SerialNumber = hex.EncodeToString(cert.SerialNumber.Bytes())
+
+	hash, err := hashForOID(info.DigestAlgorithm.Algorithm)
+	if err != nil {
+		cs.Error = err.Error()
+		return cs
+	}
+	if !hash.Available() {
+		cs.Error = fmt.Sprintf("digest algorithm %s is not available", hash)
+		return cs
+	}
+	cs.DigestAlgorithm = hash.String()
+
+	signed := signature
+	if len(info.SignedAttributes.FullBytes) > 0 {
+		var digest []byte
+		for attrs := info.SignedAttributes.Bytes; len(attrs) > 0; {
+			var attr attribute
+			if attrs, err = asn1.Unmarshal(attrs, &attr); err != nil {
+				cs.Error = fmt.Sprintf("invalid signed attributes: %v", err)
+				return cs
+			}
+			switch {
+			case attr.Type.Equal(oidAttributeContentType):
+				// RFC 5652 section 11.4: a countersignature has no content
+				// type, it signs the signature value rather than content.
+				cs.Error = "countersignature must not have a content type attribute"
+				return cs
+			case attr.Type.Equal(oidAttributeMessageDigest):
+				if _, err := asn1.Unmarshal(attr.Value.Bytes, &digest); err != nil {
+					cs.Error = fmt.Sprintf("invalid message digest attribute: %v", err)
+					return cs
+				}
+			case attr.Type.Equal(oidAttributeSigningTime):
+				var signingTime time.Time
+				if _, err := asn1.Unmarshal(attr.Value.Bytes, &signingTime); err != nil {
+					cs.Error = fmt.Sprintf("invalid signing time attribute: %v", err)
+					return cs
+				}
+				cs.SigningTime = &signingTime
+			}
+		}
+
+		h := hash.New()
+		h.Write(signature)
+		if subtle.ConstantTimeCompare(digest, h.Sum(nil)) != 1 {
+			cs.Error = "countersignature message digest does not match the signature value"
+			return cs
+		}
+
+		// The signature is calculated over the DER encoding of the SET OF
+		// signed attributes rather than their [0] IMPLICIT encoding.
+		signed = slices.Clone(info.SignedAttributes.FullBytes)
+		signed[0] = 0x31
+	}
+
+	if err := checkSignature(cert, info.DigestAlgorithm, info.SignatureAlgorithm, hash, signed, info.Signature); err != nil {
+		cs.Error = fmt.Sprintf("countersignature verification failed: %v", err)
+		return cs
+	}
+	cs.ValidSignature = true
+
+	if err := verifyCountersignerChain(cert, certificates, options, t); err != nil {
+		cs.Status = "indeterminate"
+		cs.Error = err.Error()
+		return cs
+	}
+	cs.Trusted = true
+	cs.Status = "valid"
+	return cs
+}
+
+// countersignerCertificate returns the certificate of certificates the
+// signer identifier sid names by its issuer and serial number or subject key
+// identifier. Without the certificate the issuer and serial number of sid,
+// if any, are set on cs.
+func countersignerCertificate(sid asn1.RawValue, certificates []*x509.Certificate, cs *Countersignature) (*x509.Certificate, error) {
+	switch {
+	case sid.Class == asn1.ClassUniversal && sid.Tag == asn1.TagSequence:
+		var ias struct {
+			IssuerName   asn1.RawValue
+			SerialNumber *big.Int
+		}
+		if _, err := asn1.Unmarshal(sid.FullBytes, &ias); err != nil {
+			return nil, fmt.Errorf("invalid countersigner identifier: %v", err)
+		}
+		for _, cert := range certificates {
+			if cert.SerialNumber.Cmp(ias.SerialNumber) == 0 && bytes.Equal(cert.RawIssuer, ias.IssuerName.FullBytes) {
+				return cert, nil
+			}
+		}
+		var issuer pkix.RDNSequence
+		if _, err := asn1.Unmarshal(ias.IssuerName.FullBytes, &issuer); err == nil {
+			cs.Issuer = issuer.String()
+		}
+		cs.SerialNumber = hex.EncodeToString(ias.SerialNumber.Bytes())
+	case sid.Class == asn1.ClassContextSpecific && sid.Tag == 0:
+		for _, cert := range certificates {
+			if len(cert.SubjectKeyId) > 0 && bytes.Equal(cert.SubjectKeyId, sid.Bytes) {
+				return cert, nil
+			}
+		}
+	default:
+		return nil, errors.New("invalid countersigner identifier")
+	}
+	return nil, errors.New("no certificate for countersigner")
+}
+
+// verifyCountersignerChain verifies the chain of the countersigner
+// certificate at t to the system roots or a trust anchor, or with
+// AllowUntrustedRoots to the certificates of the signature.
+func verifyCountersignerChain(cert *x509.Certificate, certificates []*x509.Certificate, options *VerifyOptions, t time.Time) error {
+	certPool := x509.NewCertPool()
+	for _, c := range certificates {
+		certPool.AddCert(c)
+	}
+	opts := x509.VerifyOptions{
+		Roots:         options.systemRoots(),
+		Intermediates: certPool,
+		CurrentTime:   t,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+
+	_, err := cert.Verify(opts)
+	if err == nil {
+		return nil
+	}
+	if anchors, _ := options.trustAnchors(); len(anchors) > 0 {
+		if _, _, anchorErr := verifyTrustAnchors(cert, anchors, opts, t); anchorErr == nil {
+			return nil
+		}
+	}
+	if options.AllowUntrustedRoots {
+		opts.Roots = certPool
+		if _, rootErr := cert.Verify(opts); rootErr == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("countersigner certificate chain validation failed: %v", err)
+}
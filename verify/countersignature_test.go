@@ -0,0 +1,214 @@
+package verify
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/digitorus/pkcs7"
+)
+
+// newTestCountersignature returns the DER SignerInfo of a countersignature
+// of cert over the signature value, with the signed attributes and the
+// message digest attribute of signature.
+func newTestCountersignature(t *testing.T, cert *x509.Certificate, key *ecdsa.PrivateKey, signature []byte, attrs ...attribute) []byte {
+	t.Helper()
+
+	digest := sha256.Sum256(signature)
+	digestDER, err := asn1.Marshal(digest[:])
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	attrs = append(attrs, attribute{
+		Type:  oidAttributeMessageDigest,
+		Value: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: digestDER},
+	})
+	encoded, err := asn1.Marshal(struct {
+		A []attribute `asn1:"set"`
+	}{A: attrs})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	var sequence, set asn1.RawValue
+	if _, err := asn1.Unmarshal(encoded, &sequence); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if _, err := asn1.Unmarshal(sequence.Bytes, &set); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	signed := sha256.Sum256(set.FullBytes)
+	value, err := ecdsa.SignASN1(rand.Reader, key, signed[:])
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	der, err := asn1.Marshal(struct {
+		Version int
+		SID     struct {
+			IssuerName   asn1.RawValue
+			SerialNumber *big.Int
+		}
+		DigestAlgorithm    pkix.AlgorithmIdentifier
+		SignedAttributes   asn1.RawValue
+		SignatureAlgorithm pkix.AlgorithmIdentifier
+		Signature          []byte
+	}{
+		Version: 1,
+		SID: struct {
+			IssuerName   asn1.RawValue
+			SerialNumber *big.Int
+		}{asn1.RawValue{FullBytes: cert.RawIssuer}, cert.SerialNumber},
+		DigestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: hashOIDs[crypto.SHA256]},
+		SignedAttributes:   asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: set.Bytes},
+		SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: ecdsaOIDs[crypto.SHA256]},
+		Signature:          value,
+	})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	return der
+}
+
+// newTestAttribute returns the attribute of type typ with the value.
+func newTestAttribute(t *testing.T, typ asn1.ObjectIdentifier, value any) attribute {
+	t.Helper()
+
+	der, err := asn1.Marshal(value)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	return attribute{Type: typ, Value: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: der}}
+}
+
+func TestVerifyCountersignatures(t *testing.T) {
+	notary, key := newTestCRLIssuer(t, "pdfsign Notary")
+	other, _ := newTestCRLIssuer(t, "pdfsign Other")
+	signature := []byte("signature value")
+	signingTime := time.Now().UTC().Truncate(time.Second)
+	valid := newTestCountersignature(t, notary, key, signature, newTestAttribute(t, oidAttributeSigningTime, signingTime))
+
+	trusted := DefaultVerifyOptions()
+	trusted.DisableSystemRoots = true
+	trusted.TrustProviders = []TrustProvider{&PEMTrustProvider{
+		FS:   fstest.MapFS{"notary.pem": {Data: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: notary.Raw})}},
+		Path: "notary.pem",
+	}}
+	untrusted := DefaultVerifyOptions()
+	untrusted.DisableSystemRoots = true
+	embedded := DefaultVerifyOptions()
+	embedded.DisableSystemRoots = true
+	embedded.AllowUntrustedRoots = true
+
+	tests := []struct {
+		name         string
+		value        []byte
+		signature    []byte
+		certificates []*x509.Certificate
+		options      *VerifyOptions
+		wantStatus   string
+		wantValid    bool
+	}{
+		{name: "trusted", value: valid, options: trusted, wantStatus: "valid", wantValid: true},
+		{name: "untrusted", value: valid, options: untrusted, wantStatus: "indeterminate", wantValid: true},
+		{name: "embedded root", value: valid, options: embedded, wantStatus: "valid", wantValid: true},
+		{name: "other signature", value: valid, signature: []byte("other signature value"), options: trusted, wantStatus: "invalid"},
+		{name: "no certificate", value: valid, certificates: []*x509.Certificate{other}, options: trusted, wantStatus: "invalid"},
+		{
+			name:       "content type",
+			value:      newTestCountersignature(t, notary, key, signature, newTestAttribute(t, oidAttributeContentType, asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1})),
+			options:    trusted,
+			wantStatus: "invalid",
+		},
+		{name: "invalid", value: []byte{0x30, 0x03, 0x02, 0x01}, options: trusted, wantStatus: "invalid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.signature == nil {
+				tt.signature = signature
+			}
+			if tt.certificates == nil {
+				tt.certificates = []*x509.Certificate{notary}
+			}
+			countersignatures := verifyCountersignatures(tt.value, tt.signature, tt.certificates, tt.options, time.Now())
+			if len(countersignatures) != 1 {
+				t.Fatalf("expected 1 countersignature, got %d", len(countersignatures))
+			}
+			cs := countersignatures[0]
+			if cs.Status != tt.wantStatus || cs.ValidSignature != tt.wantValid {
+				t.Errorf("expected status %s and valid signature %t, got %s and %t: %s", tt.wantStatus, tt.wantValid, cs.Status, cs.ValidSignature, cs.Error)
+			}
+			if cs.Status != "valid" && cs.Error == "" {
+				t.Errorf("expected an error for status %s", cs.Status)
+			}
+		})
+	}
+
+	cs := verifyCountersignatures(valid, signature, []*x509.Certificate{notary}, trusted, time.Now())[0]
+	if cs.Subject != "CN=pdfsign Notary" || cs.SerialNumber != "01" || cs.DigestAlgorithm != "SHA-256" || cs.Certificate != notary {
+		t.Errorf("expected the countersigner identity, got %+v", cs)
+	}
+	if cs.SigningTime == nil || !cs.SigningTime.Equal(signingTime) {
+		t.Errorf("expected signing time %s, got %v", signingTime, cs.SigningTime)
+	}
+	if cs := verifyCountersignatures(valid, signature, nil, trusted, time.Now())[0]; cs.Issuer != "CN=pdfsign Notary" || cs.SerialNumber != "01" {
+		t.Errorf("expected the identifier of a missing countersigner certificate, got %+v", cs)
+	}
+}
+
+func TestProcessCountersignatures(t *testing.T) {
+	signerCert, signerKey := newTestCRLIssuer(t, "pdfsign Signer")
+	notary, key := newTestCRLIssuer(t, "pdfsign Notary")
+	value := []byte("signature value")
+
+	sd, err := pkcs7.NewSignedData([]byte("content"))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	err = sd.AddSigner(signerCert, signerKey, pkcs7.SignerInfoConfig{
+		ExtraUnsignedAttributes: []pkcs7.Attribute{{
+			Type:  oidAttributeCounterSignature,
+			Value: asn1.RawValue{FullBytes: newTestCountersignature(t, notary, key, value)},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	sd.AddCertificate(notary)
+	der, err := sd.Finish()
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	p7, err := pkcs7.Parse(der)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	// The countersignature covers the signature value of its signer
+	options := DefaultVerifyOptions()
+	options.AllowUntrustedRoots = true
+	var signer Signer
+	processCountersignatures(p7, &signer, p7.Certificates, options)
+	if len(signer.Countersignatures) != 1 || signer.Countersignatures[0].Status != "invalid" {
+		t.Fatalf("expected an invalid countersignature, got %+v", signer.Countersignatures)
+	}
+
+	p7.Signers[0].EncryptedDigest = value
+	signer = Signer{}
+	processCountersignatures(p7, &signer, p7.Certificates, options)
+	if len(signer.Countersignatures) != 1 || signer.Countersignatures[0].Status != "valid" {
+		t.Fatalf("expected a valid countersignature, got %+v", signer.Countersignatures)
+	}
+	if report := newReportSignature(signer); len(report.Countersignatures) != 1 {
+		t.Errorf("expected the countersignature in the report")
+	}
+}
@@ -0,0 +1,128 @@
+package verify
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/digitorus/pdf"
+)
+
+// docMDPLevel returns the DocMDP permission level of the signature dictionary
+// v when it is the certification signature of the document, the DocMDP entry
+// perms of the Perms dictionary of the catalog, and 0 otherwise. A missing or
+// invalid level is level 2, see ISO 32000-1, 12.8.2.2.
+func docMDPLevel(v, perms pdf.Value) int {
+	if perms.IsNull() || perms.GetPtr() != v.GetPtr() {
+		return 0
+	}
+	if level := docMDPReference(v); level > 0 {
+		return level
+	}
+	return 2
+}
+
+// docMDPReference returns the DocMDP permission level of the DocMDP transform
+// in the Reference array of the signature dictionary v, and 0 when v has no
+// such transform. A missing or invalid level is level 2.
+func docMDPReference(v pdf.Value) int {
+	reference := v.Key("Reference")
+	for i := 0; i < reference.Len(); i++ {
+		if reference.Index(i).Key("TransformMethod").Name() != "DocMDP" {
+			continue
+		}
+		if p := reference.Index(i).Key("TransformParams").Key("P").Int64(); p >= 1 && p <= 3 {
+			return int(p)
+		}
+		return 2
+	}
+	return 0
+}
+
+// checkCertifications walks over the signatures in the order of their
+// revisions and records the certifications that do not come first: a
+// certification after an approval signature, and a certification of a
+// document that is already certified. Both the later certification and the
+// signature it follows are flagged, and a replaced certification keeps the
+// level of its DocMDP transform, so that the changes after it are checked by
+// checkDocMDP. A certification must be the first signature of a document,
+// see ISO 32000-1, 12.8.2.2.
+func checkCertifications(signers []Signer) {
+	var order []*Signer
+	for i := range signers {
+		if signers[i].RevisionEnd > 0 && signers[i].SignatureType == "signature" {
+			order = append(order, &signers[i])
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return order[i].RevisionEnd < order[j].RevisionEnd
+	})
+
+	var certification, approval *Signer
+	for _, s := range order {
+		if s.CertificationLevel == 0 && s.docMDPReference == 0 {
+			if approval == nil && certification == nil {
+				approval = s
+			}
+			continue
+		}
+		switch {
+		case certification != nil:
+			if certification.CertificationLevel == 0 {
+				certification.CertificationLevel = certification.docMDPReference
+			}
+			certification.DocMDPViolations = append(certification.DocMDPViolations, fmt.Sprintf("certification replaced by the signature of revision %d", s.Revision))
+			certification.DisallowedModifications = true
+			s.DocMDPViolations = append(s.DocMDPViolations, fmt.Sprintf("re-certification of the document certified by the signature of revision %d", certification.Revision))
+			s.DisallowedModifications = true
+			continue
+		case approval != nil:
+			approval.DocMDPViolations = append(approval.DocMDPViolations, fmt.Sprintf("document certified by the signature of revision %d after approval", s.Revision))
+			approval.DisallowedModifications = true
+			s.DocMDPViolations = append(s.DocMDPViolations, fmt.Sprintf("certification after the approval signature of revision %d", approval.Revision))
+			s.DisallowedModifications = true
+		}
+		certification = s
+	}
+}
+
+// docMDPPermits reports whether a modification of type kind is permitted
+// after a certification signature with level. Document timestamps and DSS
+// updates are permitted at every level, see ETSI EN 319 142-1, 5.4.
+func docMDPPermits(level int, kind string) bool {
+	switch kind {
+	case "document_timestamp", "dss":
+		return true
+	case "signature", "form_fill", "metadata":
+		return level >= 2
+	case "annotation":
+		return level >= 3
+	}
+	return false
+}
+
+// checkDocMDP evaluates the modifications after the certification signature
+// against its DocMDP level and records the changes it does not permit.
+func checkDocMDP(signers []Signer) {
+	for i := range signers {
+		s := &signers[i]
+		if s.CertificationLevel == 0 {
+			continue
+		}
+		if s.ModificationError != "" {
+			s.DocMDPViolations = append(s.DocMDPViolations, fmt.Sprintf("modifications after certification at level %d could not be analyzed", s.CertificationLevel))
+		}
+		for _, m := range s.Modifications {
+			if docMDPPermits(s.CertificationLevel, m.Type) {
+				continue
+			}
+			change := "modified"
+			if m.Added {
+				change = "added"
+			}
+			s.DocMDPViolations = append(s.DocMDPViolations, fmt.Sprintf("%s %s after certification at level %d", m.Description, change, s.CertificationLevel))
+		}
+		if len(s.DocMDPViolations) > 0 {
+			s.DisallowedModifications = true
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package verify
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/digitorus/pdf"
+)
+
+func TestDocMDPLevel(t *testing.T) {
+	tests := []struct {
+		name      string
+		catalog   string
+		signature string
+		want      int
+	}{
+		{
+			name:      "no changes",
+			catalog:   "<< /Type /Catalog /Perms << /DocMDP 2 0 R >> >>",
+			signature: "<< /Type /Sig /Reference [<< /TransformMethod /DocMDP /TransformParams << /P 1 >> >>] >>",
+			want:      1,
+		},
+		{
+			name:      "annotations",
+			catalog:   "<< /Type /Catalog /Perms << /DocMDP 2 0 R >> >>",
+			signature: "<< /Type /Sig /Reference [<< /TransformMethod /DocMDP /TransformParams << /P 3 >> >>] >>",
+			want:      3,
+		},
+		{
+			name:      "default level",
+			catalog:   "<< /Type /Catalog /Perms << /DocMDP 2 0 R >> >>",
+			signature: "<< /Type /Sig /Reference [<< /TransformMethod /DocMDP /TransformParams << >> >>] >>",
+			want:      2,
+		},
+		{
+			name:      "invalid level",
+			catalog:   "<< /Type /Catalog /Perms << /DocMDP 2 0 R >> >>",
+			signature: "<< /Type /Sig /Reference [<< /TransformMethod /DocMDP /TransformParams << /P 7 >> >>] >>",
+			want:      2,
+		},
+		{
+			// Only the signature of the Perms dictionary is a certification
+			// signature.
+			name:      "approval signature",
+			catalog:   "<< /Type /Catalog >>",
+			signature: "<< /Type /Sig /Reference [<< /TransformMethod /DocMDP /TransformParams << /P 1 >> >>] >>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			document, _ := appendRevision([]byte("%PDF-1.7\n"), 0, map[int]string{1: tt.catalog, 2: tt.signature})
+			rdr, err := pdf.NewReader(bytes.NewReader(document), int64(len(document)))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			ptr := rdr.Xref()[2].Ptr()
+			perms := rdr.Trailer().Key("Root").Key("Perms").Key("DocMDP")
+			if got := docMDPLevel(rdr.Resolve(ptr, ptr), perms); got != tt.want {
+				t.Errorf("expected level %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCheckDocMDP(t *testing.T) {
+	modifications := []Modification{
+		{Type: "dss", Object: "20 0 R", Description: "DSS", Added: true},
+		{Type: "signature", Object: "21 0 R", Description: "signature dictionary", Added: true},
+		{Type: "annotation", Object: "22 0 R", Description: "page 1 annotation", Added: true},
+		{Type: "content_change", Object: "5 0 R", Description: "page 3 content stream"},
+	}
+
+	tests := []struct {
+		level          int
+		wantViolations []string
+	}{
+		{
+			level: 1,
+			wantViolations: []string{
+				"signature dictionary added after certification at level 1",
+				"page 1 annotation added after certification at level 1",
+				"page 3 content stream modified after certification at level 1",
+			},
+		},
+		{
+			level: 2,
+			wantViolations: []string{
+				"page 1 annotation added after certification at level 2",
+				"page 3 content stream modified after certification at level 2",
+			},
+		},
+		{
+			level:          3,
+			wantViolations: []string{"page 3 content stream modified after certification at level 3"},
+		},
+	}
+
+	for _, tt := range tests {
+		signers := []Signer{
+			{CertificationLevel: tt.level, Modifications: modifications},
+			// Approval signatures have no DocMDP restrictions.
+			{Modifications: modifications[:3]},
+		}
+		checkDocMDP(signers)
+		if !reflect.DeepEqual(signers[0].DocMDPViolations, tt.wantViolations) {
+			t.Errorf("level %d: expected violations %q, got %q", tt.level, tt.wantViolations, signers[0].DocMDPViolations)
+		}
+		if !signers[0].DisallowedModifications {
+			t.Errorf("level %d: expected disallowed modifications", tt.level)
+		}
+		if signers[1].DocMDPViolations != nil || signers[1].DisallowedModifications {
+			t.Errorf("level %d: expected no violations for the approval signature", tt.level)
+		}
+	}
+}
+
+func TestCheckCertifications(t *testing.T) {
+	approval := func(revision int) Signer {
+		return Signer{SignatureType: "signature", Revision: revision, RevisionEnd: int64(revision * 100)}
+	}
+	certification := func(revision, level, reference int) Signer {
+		s := approval(revision)
+		s.CertificationLevel, s.docMDPReference = level, reference
+		return s
+	}
+
+	tests := []struct {
+		name       string
+		signers    []Signer
+		want       [][]string
+		wantLevels []int
+	}{
+		{
+			name:       "certification first",
+			signers:    []Signer{certification(1, 2, 2), approval(2), approval(3)},
+			want:       [][]string{nil, nil, nil},
+			wantLevels: []int{2, 0, 0},
+		},
+		{
+			name:    "certification after approval",
+			signers: []Signer{approval(2), certification(3, 1, 1), approval(1)},
+			want: [][]string{
+				nil,
+				{"certification after the approval signature of revision 1"},
+				{"document certified by the signature of revision 3 after approval"},
+			},
+			wantLevels: []int{0, 1, 0},
+		},
+		{
+			// The Perms dictionary refers to the later certification, the
+			// first keeps the level of its DocMDP transform.
+			name:    "re-certification",
+			signers: []Signer{certification(1, 0, 1), approval(2), certification(3, 3, 3)},
+			want: [][]string{
+				{"certification replaced by the signature of revision 3"},
+				nil,
+				{"re-certification of the document certified by the signature of revision 1"},
+			},
+			wantLevels: []int{1, 0, 3},
+		},
+		{
+			// A DocMDP transform without the Perms dictionary still claims
+			// a certification.
+			name:    "claimed certification after approval",
+			signers: []Signer{approval(1), certification(2, 0, 2)},
+			want: [][]string{
+				{"document certified by the signature of revision 2 after approval"},
+				{"certification after the approval signature of revision 1"},
+			},
+			wantLevels: []int{0, 0},
+		},
+		{
+			// Document timestamps are neither approvals nor certifications.
+			name: "document timestamp first",
+			signers: []Signer{
+				{SignatureType: "document_timestamp", Revision: 1, RevisionEnd: 100},
+				certification(2, 2, 2),
+			},
+			want:       [][]string{nil, nil},
+			wantLevels: []int{0, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkCertifications(tt.signers)
+			for i, s := range tt.signers {
+				if !reflect.DeepEqual(s.DocMDPViolations, tt.want[i]) {
+					t.Errorf("signature %d: expected violations %q, got %q", i, tt.want[i], s.DocMDPViolations)
+				}
+				if s.DisallowedModifications != (tt.want[i] != nil) {
+					t.Errorf("signature %d: expected disallowed modifications %t", i, tt.want[i] != nil)
+				}
+				if s.CertificationLevel != tt.wantLevels[i] {
+					t.Errorf("signature %d: expected level %d, got %d", i, tt.wantLevels[i], s.CertificationLevel)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package verify
+
+import (
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/revocation"
+	"github.com/digitorus/pkcs7"
+	"github.com/digitorus/timestamp"
+)
+
+// processDocumentTimestamp verifies an ETSI.RFC3161 document timestamp, a
+// timestamp token over the byte range of the revision that added it, and
+// validates the certificate chain of its TSA with the revocation data in the
+// DSS dictionary dss.
+func processDocumentTimestamp(v pdf.Value, dss pdf.Value, file io.ReaderAt, signer *Signer, options *VerifyOptions) (string, error) {
+	signer.SignatureType = "document_timestamp"
+
+	contents := []byte(v.Key("Contents").RawString())
+	ts, err := timestamp.Parse(contents)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse document timestamp: %v", err)
+	}
+	signer.TimeStamp = ts
+	signer.setDigestAlgorithm(nil, ts.HashAlgorithm)
+	signer.MessageDigest = hex.EncodeToString(ts.HashedMessage)
+
+	// The byte range is hashed in chunks, an unsupported algorithm is
+	// reported by the verification of the token.
+	var digest []byte
+	if ts.HashAlgorithm.Available() {
+		digests, err := digestByteRange(v, file, ts.HashAlgorithm)
+		if err != nil {
+			return fmt.Sprintf("Failed to process ByteRange: %v", err), nil
+		}
+		digest = digests[ts.HashAlgorithm]
+	}
+
+	dssData := dssValidationData(dss, contents)
+	tsaCert, err := verifyTimestampImprint(ts, digest, dssData.certificates)
+	if err != nil {
+		signer.TimestampError = err.Error()
+		signer.signatureError = err
+		return fmt.Sprintf("Failed to verify document timestamp: %v", err), nil
+	}
+	signer.ValidSignature = true
+	signer.timestampCertificate = tsaCert
+
+	// The certificates of the token, or the TSA certificate from the DSS,
+	// are reported like the certificates of a signature.
+	p7, err := pkcs7.Parse(contents)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse document timestamp: %v", err)
+	}
+	if len(p7.Certificates) == 0 {
+		p7.Certificates = []*x509.Certificate{tsaCert}
+	}
+
+	var revInfo revocation.InfoArchival
+	dssData.addTo(&revInfo)
+
+	tsaOptions := *options
+	tsaOptions.RequiredEKUs = []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping}
+	tsaOptions.AllowedEKUs = nil
+	tsaOptions.RequiredEKUOIDs = nil
+	tsaOptions.AllowedEKUOIDs = nil
+	tsaOptions.RequireNonRepudiation = false
+	tsaOptions.chainEKUs = []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping}
+	certError, err := buildCertificateChainsWithOptions(p7, signer, revInfo, dssData.certificates, &tsaOptions)
+	if err != nil {
+		return certError, err
+	}
+	signer.LTVEnabled, signer.LTVError = ltvStatus(tsaCert, slices.Concat(p7.Certificates, dssData.certificates), revInfo)
+	return certError, nil
+}
+
+// evaluateDocumentTimestamps evaluates the chain of document timestamps of
+// the signers in the order of the revisions that added them, nil if there
+// are none. Each document timestamp must be valid, not be older than the
+// previous one and be added before the TSA certificate of the previous one
+// expired, so the earlier revisions stay protected, and the TSA certificate
+// of the last one must not have expired at now. Signers covered by a valid
+// document timestamp are marked as such.
+func evaluateDocumentTimestamps(signers []Signer, now time.Time) *DocumentTimestampChain {
+	order := make([]int, len(signers))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return signers[order[a]].RevisionEnd < signers[order[b]].RevisionEnd
+	})
+
+	var chain *DocumentTimestampChain
+	var previous *Signer
+	for n, i := range order {
+		s := &signers[i]
+		if s.SignatureType != "document_timestamp" {
+			continue
+		}
+		if chain == nil {
+			chain = &DocumentTimestampChain{Valid: true}
+		}
+		chain.Count++
+
+		if !s.ValidSignature || s.timestampCertificate == nil {
+			chain.Errors = append(chain.Errors, fmt.Sprintf("document timestamp %d is invalid", chain.Count))
+			previous = nil
+			continue
+		}
+		// The earlier revisions, including earlier document timestamps, are
+		// covered by this document timestamp.
+		for _, j := range order[:n] {
+			signers[j].DocumentTimestampProtected = true
+		}
+
+		if previous != nil {
+			if s.TimeStamp.Time.Before(previous.TimeStamp.Time) {
+				chain.Errors = append(chain.Errors, fmt.Sprintf("document timestamp %d is older than the previous document timestamp", chain.Count))
+			}
+			if previous.timestampCertificate.NotAfter.Before(s.TimeStamp.Time) {
+				chain.Errors = append(chain.Errors, fmt.Sprintf("document timestamp %d was added after the TSA certificate of the previous document timestamp expired at %v", chain.Count, previous.timestampCertificate.NotAfter))
+			}
+		}
+		previous = s
+	}
+	if chain == nil {
+		return nil
+	}
+
+	if previous != nil {
+		until := previous.timestampCertificate.NotAfter
+		chain.ProtectedUntil = &until
+		if until.Before(now) {
+			chain.Errors = append(chain.Errors, fmt.Sprintf("the TSA certificate of the last document timestamp expired at %v", until))
+		}
+	}
+	chain.Valid = len(chain.Errors) == 0 && previous != nil
+	return chain
+}
+
+// checkArchiveTimestamps records the earliest time each of the signers is
+// proven to have existed, by its own timestamp or a valid document
+// timestamp of a later revision, and whether the chain of document
+// timestamps is unbroken: it is valid, and the revisions before each
+// document timestamp but the first add validation data to the DSS, such as
+// the revocation data of the TSA of the previous one, as PAdES baseline-LTA
+// renews them. The timeline has the changes between the signatures.
+func checkArchiveTimestamps(signers []Signer, chain *DocumentTimestampChain, timeline *Timeline) {
+	if timeline == nil {
+		return
+	}
+
+	// The entries are visited from the last revision, later holds the
+	// earliest valid document timestamp of the revisions after the entry.
+	var later *time.Time
+	for n := len(timeline.Entries) - 1; n >= 0; n-- {
+		s := &signers[timeline.Entries[n].Signature]
+		var own *time.Time
+		documentTimestamp := s.SignatureType == "document_timestamp" && s.ValidSignature && s.timestampCertificate != nil
+		switch {
+		case documentTimestamp:
+			own, s.ProvenBy = &s.TimeStamp.Time, "document_timestamp"
+		case s.SignatureType != "document_timestamp" && s.TimestampTime != nil:
+			own, s.ProvenBy = s.TimestampTime, "signature_timestamp"
+		}
+		s.ProvenTime = own
+		if later != nil && (own == nil || later.Before(*own)) {
+			s.ProvenTime, s.ProvenBy = later, "document_timestamp"
+		}
+		if documentTimestamp && (later == nil || own.Before(*later)) {
+			later = own
+		}
+	}
+
+	if chain == nil {
+		return
+	}
+	count, previous := 0, -1
+	for n, entry := range timeline.Entries {
+		if entry.Type != "document_timestamp" {
+			continue
+		}
+		count++
+		if previous >= 0 {
+			if gap := validationDataGap(timeline.Entries[previous:n]); gap != "" {
+				chain.Gaps = append(chain.Gaps, fmt.Sprintf("%s between document timestamps %d and %d", gap, count-1, count))
+			}
+		}
+		previous = n
+	}
+	chain.Unbroken = chain.Valid && len(chain.Gaps) == 0
+}
+
+// validationDataGap returns why the changes after the timeline entries, up
+// to the next entry, add no validation data to the DSS, "" if they do.
+func validationDataGap(entries []TimelineEntry) string {
+	for _, entry := range entries {
+		if entry.ChangesError != "" {
+			return "the changes could not be analyzed"
+		}
+		for _, m := range entry.Changes {
+			if m.Type == "dss" {
+				return ""
+			}
+		}
+	}
+	return "no validation data was added to the DSS"
+}
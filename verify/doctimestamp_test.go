@@ -0,0 +1,216 @@
+package verify
+
+import (
+	"crypto/x509"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitorus/timestamp"
+)
+
+func TestEvaluateDocumentTimestamps(t *testing.T) {
+	now := time.Now()
+	// documentTimestamp returns a document timestamp at end of the byte
+	// range at time, by a TSA certificate that expires at notAfter.
+	documentTimestamp := func(end int64, at, notAfter time.Time) Signer {
+		return Signer{
+			SignatureType:        "document_timestamp",
+			ValidSignature:       true,
+			TimeStamp:            &timestamp.Timestamp{Time: at},
+			RevisionEnd:          end,
+			timestampCertificate: &x509.Certificate{NotAfter: notAfter},
+		}
+	}
+	signature := Signer{SignatureType: "signature", ValidSignature: true, RevisionEnd: 100}
+	invalid := documentTimestamp(300, now.Add(-time.Hour), now.Add(time.Hour))
+	invalid.ValidSignature = false
+
+	tests := []struct {
+		name          string
+		signers       []Signer
+		wantCount     int
+		wantError     string
+		wantProtected []bool
+	}{
+		{
+			name:          "no document timestamps",
+			signers:       []Signer{signature},
+			wantProtected: []bool{false},
+		},
+		{
+			name: "renewed archive timestamps",
+			signers: []Signer{
+				signature,
+				// The signers are sorted by revision.
+				documentTimestamp(300, now.Add(-time.Hour), now.Add(time.Hour)),
+				documentTimestamp(200, now.Add(-48*time.Hour), now.Add(-30*time.Minute)),
+			},
+			wantCount:     2,
+			wantProtected: []bool{true, false, true},
+		},
+		{
+			name: "expired TSA certificate of the last document timestamp",
+			signers: []Signer{
+				signature,
+				documentTimestamp(200, now.Add(-48*time.Hour), now.Add(-24*time.Hour)),
+			},
+			wantCount:     1,
+			wantError:     "the TSA certificate of the last document timestamp expired",
+			wantProtected: []bool{true, false},
+		},
+		{
+			name: "gap in the chain",
+			signers: []Signer{
+				signature,
+				documentTimestamp(200, now.Add(-48*time.Hour), now.Add(-24*time.Hour)),
+				documentTimestamp(300, now.Add(-time.Hour), now.Add(time.Hour)),
+			},
+			wantCount:     2,
+			wantError:     "document timestamp 2 was added after the TSA certificate of the previous document timestamp expired",
+			wantProtected: []bool{true, true, false},
+		},
+		{
+			name: "older than the previous",
+			signers: []Signer{
+				signature,
+				documentTimestamp(200, now.Add(-time.Hour), now.Add(time.Hour)),
+				documentTimestamp(300, now.Add(-2*time.Hour), now.Add(time.Hour)),
+			},
+			wantCount:     2,
+			wantError:     "document timestamp 2 is older than the previous document timestamp",
+			wantProtected: []bool{true, true, false},
+		},
+		{
+			name:          "invalid last document timestamp",
+			signers:       []Signer{signature, invalid},
+			wantCount:     1,
+			wantError:     "document timestamp 1 is invalid",
+			wantProtected: []bool{false, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain := evaluateDocumentTimestamps(tt.signers, now)
+			if tt.wantCount == 0 {
+				if chain != nil {
+					t.Fatalf("expected no chain, got %+v", chain)
+				}
+				return
+			}
+			if chain == nil || chain.Count != tt.wantCount {
+				t.Fatalf("expected a chain of %d document timestamps, got %+v", tt.wantCount, chain)
+			}
+			if tt.wantError == "" {
+				if !chain.Valid || len(chain.Errors) != 0 || chain.ProtectedUntil == nil {
+					t.Errorf("expected a valid chain, got %v", chain.Errors)
+				}
+			} else if chain.Valid || !strings.Contains(strings.Join(chain.Errors, "; "), tt.wantError) {
+				t.Errorf("expected an error containing %q, got %v", tt.wantError, chain.Errors)
+			}
+			for i, signer := range tt.signers {
+				if signer.DocumentTimestampProtected != tt.wantProtected[i] {
+					t.Errorf("expected signer %d to be protected %t", i, tt.wantProtected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCheckArchiveTimestamps(t *testing.T) {
+	now := time.Now()
+	documentTimestamp := func(end int64, at time.Time) Signer {
+		return Signer{
+			SignatureType:        "document_timestamp",
+			ValidSignature:       true,
+			TimeStamp:            &timestamp.Timestamp{Time: at},
+			RevisionEnd:          end,
+			timestampCertificate: &x509.Certificate{NotAfter: now.Add(time.Hour)},
+		}
+	}
+	signed := now.Add(-72 * time.Hour)
+	first, second := now.Add(-48*time.Hour), now.Add(-time.Hour)
+	dss := []Modification{{Type: "dss", Object: "30 0 R", Description: "DSS dictionary"}}
+
+	tests := []struct {
+		name         string
+		signatureTS  *time.Time
+		invalidFirst bool
+		changes      []Modification
+		wantProven   []*time.Time
+		wantBy       string
+		wantUnbroken bool
+	}{
+		{
+			name:         "renewed with validation data",
+			changes:      dss,
+			wantProven:   []*time.Time{&first, &first, &second},
+			wantBy:       "document_timestamp",
+			wantUnbroken: true,
+		},
+		{
+			name:         "signature timestamp",
+			signatureTS:  &signed,
+			changes:      dss,
+			wantProven:   []*time.Time{&signed, &first, &second},
+			wantBy:       "signature_timestamp",
+			wantUnbroken: true,
+		},
+		{
+			name:       "renewed without validation data",
+			wantProven: []*time.Time{&first, &first, &second},
+			wantBy:     "document_timestamp",
+		},
+		{
+			name:         "invalid first document timestamp",
+			invalidFirst: true,
+			changes:      dss,
+			wantProven:   []*time.Time{&second, &second, &second},
+			wantBy:       "document_timestamp",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signers := []Signer{
+				{SignatureType: "signature", ValidSignature: true, RevisionEnd: 100, TimestampTime: tt.signatureTS},
+				documentTimestamp(200, first),
+				documentTimestamp(300, second),
+			}
+			if tt.invalidFirst {
+				signers[1].ValidSignature = false
+			}
+			timeline := &Timeline{Entries: []TimelineEntry{
+				{Signature: 0, Type: "signature"},
+				{Signature: 1, Type: "document_timestamp", Changes: tt.changes},
+				{Signature: 2, Type: "document_timestamp"},
+			}}
+			chain := evaluateDocumentTimestamps(signers, now)
+			checkArchiveTimestamps(signers, chain, timeline)
+
+			for i, want := range tt.wantProven {
+				if got := signers[i].ProvenTime; got == nil || !got.Equal(*want) {
+					t.Errorf("signer %d: expected the proven time %v, got %v", i, *want, got)
+				}
+			}
+			if signers[0].ProvenBy != tt.wantBy {
+				t.Errorf("expected the signature to be proven by %q, got %q", tt.wantBy, signers[0].ProvenBy)
+			}
+			if chain.Unbroken != tt.wantUnbroken {
+				t.Errorf("expected the chain unbroken %t, got %t (%v, %v)", tt.wantUnbroken, chain.Unbroken, chain.Errors, chain.Gaps)
+			}
+			if !tt.wantUnbroken && chain.Valid && len(chain.Gaps) == 0 {
+				t.Errorf("expected a gap in the chain")
+			}
+		})
+	}
+
+	// Without document timestamps only the signature timestamp proves the
+	// signature.
+	signers := []Signer{{SignatureType: "signature", RevisionEnd: 100}}
+	checkArchiveTimestamps(signers, nil, &Timeline{Entries: []TimelineEntry{{Signature: 0, Type: "signature"}}})
+	if signers[0].ProvenTime != nil || signers[0].ProvenBy != "" {
+		t.Errorf("expected no proven time, got %v by %q", signers[0].ProvenTime, signers[0].ProvenBy)
+	}
+}
@@ -0,0 +1,128 @@
+package verify
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/revocation"
+	"golang.org/x/crypto/ocsp"
+)
+
+// validationData is the validation material of a signature in the Document
+// Security Store (DSS) of a document, see ETSI EN 319 142-1, 5.4.
+type validationData struct {
+	certificates []*x509.Certificate
+	ocsps        [][]byte
+	crls         [][]byte
+}
+
+// dssValidationData returns the validation material for the signature with
+// contents from the DSS dictionary dss. The VRI entry of the signature is
+// used when the DSS has one, otherwise all material of the DSS. Streams that
+// cannot be read and certificates that cannot be parsed are skipped.
+func dssValidationData(dss pdf.Value, contents []byte) validationData {
+	var data validationData
+	if dss.IsNull() {
+		return data
+	}
+
+	certs, ocsps, crls := dss.Key("Certs"), dss.Key("OCSPs"), dss.Key("CRLs")
+	// The key of the VRI entry is the uppercase hex encoded SHA-1 digest of
+	// the signature contents, lowercase keys are accepted as well.
+	hash := sha1.Sum(contents)
+	key := hex.EncodeToString(hash[:])
+	vri := dss.Key("VRI")
+	for _, k := range vri.Keys() {
+		if strings.EqualFold(k, key) {
+			entry := vri.Key(k)
+			certs, ocsps, crls = entry.Key("Cert"), entry.Key("OCSP"), entry.Key("CRL")
+			break
+		}
+	}
+
+	for _, der := range dssStreams(certs) {
+		if cert, err := x509.ParseCertificate(der); err == nil {
+			data.certificates = append(data.certificates, cert)
+		}
+	}
+	data.ocsps = dssStreams(ocsps)
+	data.crls = dssStreams(crls)
+	return data
+}
+
+// dssStreams returns the decoded content of the streams in array.
+func dssStreams(array pdf.Value) [][]byte {
+	var streams [][]byte
+	for i := 0; i < array.Len(); i++ {
+		content, err := io.ReadAll(array.Index(i).Reader())
+		if err != nil || len(content) == 0 {
+			continue
+		}
+		streams = append(streams, content)
+	}
+	return streams
+}
+
+// addTo adds the revocation data to revInfo, after the revocation data of the
+// signature itself.
+func (data validationData) addTo(revInfo *revocation.InfoArchival) {
+	for _, der := range data.ocsps {
+		_ = revInfo.AddOCSP(der)
+	}
+	for _, der := range data.crls {
+		_ = revInfo.AddCRL(der)
+	}
+}
+
+// ltvStatus reports whether a signature of cert is LTV enabled: the issuers
+// of cert up to a self-signed root are in certificates, the certificates of
+// the signature and the DSS, and for cert and each issuer but the root an
+// OCSP response or CRL is in revInfo. The reason is returned when it is not.
+func ltvStatus(cert *x509.Certificate, certificates []*x509.Certificate, revInfo revocation.InfoArchival) (bool, string) {
+	if cert == nil {
+		return false, "signing certificate not found"
+	}
+
+	// Every certificate is visited once, which ends the loop for chains
+	// that contain a cycle.
+	for range certificates {
+		if bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil {
+			return true, ""
+		}
+		issuer := certificateIssuer(cert, nil, certificates)
+		if issuer == nil {
+			return false, fmt.Sprintf("issuer of %s is not embedded", cert.Subject)
+		}
+		if !hasEmbeddedRevocationData(cert, issuer, revInfo) {
+			return false, fmt.Sprintf("no embedded revocation data for %s", cert.Subject)
+		}
+		cert = issuer
+	}
+	return false, "certificate chain does not end at a root certificate"
+}
+
+// hasEmbeddedRevocationData reports whether revInfo has an OCSP response for
+// cert or a CRL of its issuer, signed by issuer.
+func hasEmbeddedRevocationData(cert, issuer *x509.Certificate, revInfo revocation.InfoArchival) bool {
+	for _, o := range revInfo.OCSP {
+		if _, err := ocsp.ParseResponseForCert(o.FullBytes, cert, issuer); err == nil {
+			return true
+		}
+	}
+	for _, c := range revInfo.CRL {
+		crl, err := x509.ParseRevocationList(c.FullBytes)
+		if err != nil {
+			continue
+		}
+		if bytes.Equal(crl.RawIssuer, issuer.RawSubject) && crl.CheckSignatureFrom(issuer) == nil {
+			return true
+		}
+	}
+	return false
+}
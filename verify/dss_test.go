@@ -0,0 +1,68 @@
+package verify
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdfsign/revocation"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestLTVStatus(t *testing.T) {
+	root, rootKey := newTestCRLIssuer(t, "pdfsign Test Root")
+
+	intermediate, intermediateKey := newTestLeaf(t, root, rootKey, 2, func(template *x509.Certificate) {
+		template.Subject = pkix.Name{CommonName: "pdfsign Test Intermediate"}
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+		template.BasicConstraintsValid = true
+		template.IsCA = true
+	})
+	leaf, _ := newTestLeaf(t, intermediate, intermediateKey, 3, nil)
+
+	leafOCSP, err := ocsp.CreateResponse(intermediate, intermediate, ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: leaf.SerialNumber,
+		ThisUpdate:   time.Now().Add(-time.Minute),
+		NextUpdate:   time.Now().Add(time.Hour),
+	}, intermediateKey)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	rootCRL := newTestCRL(t, root, rootKey, time.Now().Add(time.Hour))
+	// A CRL of another CA with the name of the root.
+	impostor, impostorKey := newTestCRLIssuer(t, "pdfsign Test Root")
+	impostorCRL := newTestCRL(t, impostor, impostorKey, time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name         string
+		certificates []*x509.Certificate
+		ocsps, crls  [][]byte
+		wantError    string
+	}{
+		{name: "complete", certificates: []*x509.Certificate{leaf, intermediate, root}, ocsps: [][]byte{leafOCSP}, crls: [][]byte{rootCRL}},
+		{name: "missing root", certificates: []*x509.Certificate{leaf, intermediate}, ocsps: [][]byte{leafOCSP}, crls: [][]byte{rootCRL}, wantError: "issuer of CN=pdfsign Test Intermediate is not embedded"},
+		{name: "missing OCSP response", certificates: []*x509.Certificate{leaf, intermediate, root}, crls: [][]byte{rootCRL}, wantError: "no embedded revocation data for CN=pdfsign Test Signer"},
+		{name: "CRL of another CA", certificates: []*x509.Certificate{leaf, intermediate, root}, ocsps: [][]byte{leafOCSP}, crls: [][]byte{impostorCRL}, wantError: "no embedded revocation data for CN=pdfsign Test Intermediate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var revInfo revocation.InfoArchival
+			validationData{ocsps: tt.ocsps, crls: tt.crls}.addTo(&revInfo)
+
+			enabled, reason := ltvStatus(leaf, tt.certificates, revInfo)
+			if tt.wantError == "" {
+				if !enabled {
+					t.Errorf("expected the signature to be LTV enabled: %s", reason)
+				}
+				return
+			}
+			if enabled || !strings.Contains(reason, tt.wantError) {
+				t.Errorf("expected %q, got %t (%s)", tt.wantError, enabled, reason)
+			}
+		})
+	}
+}
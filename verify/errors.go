@@ -0,0 +1,184 @@
+package verify
+
+import (
+	"crypto/x509"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/digitorus/pkcs7"
+)
+
+// Error is a cause of a failed verification. The errors of Signer.Err wrap
+// one of the Err values, which errors.Is tells apart.
+type Error struct {
+	Code    string // Identifies the cause in JSON, such as "digest_mismatch"
+	message string
+}
+
+func (e *Error) Error() string {
+	return e.message
+}
+
+// Causes of failed verifications.
+var (
+	ErrByteRange            = &Error{"byte_range", "the byte range does not cover the signed revision"}
+	ErrDigestMismatch       = &Error{"digest_mismatch", "message digest mismatch"}
+	ErrNoSignerCertificate  = &Error{"no_signer_certificate", "no certificate for signer"}
+	ErrInvalidSignature     = &Error{"invalid_signature", "the signature is invalid"}
+	ErrCertRevoked          = &Error{"certificate_revoked", "a certificate of the chain is revoked"}
+	ErrCertExpired          = &Error{"certificate_expired", "a certificate of the chain has expired"}
+	ErrCertNotYetValid      = &Error{"certificate_not_yet_valid", "a certificate of the chain is not yet valid"}
+	ErrUntrustedChain       = &Error{"untrusted_chain", "the certificate chain does not end at a trusted root"}
+	ErrKeyUsage             = &Error{"key_usage", "the signing certificate is not meant for signing"}
+	ErrInvalidTimestamp     = &Error{"invalid_timestamp", "the timestamp is invalid"}
+	ErrWeakAlgorithm        = &Error{"weak_algorithm", "the signature uses weak algorithms"}
+	ErrPolicy               = &Error{"policy", "the signature does not meet the requirements of the verification options"}
+	ErrDisallowedChange     = &Error{"disallowed_modification", "the document was changed after signing"}
+	ErrModificationsUnknown = &Error{"modifications_unknown", "the changes after signing could not be analyzed"}
+)
+
+// SignatureError is a failure of a signature, with the cause it wraps and
+// the error it comes from, such as an x509.CertificateInvalidError, if any.
+type SignatureError struct {
+	Err     *Error // The cause, one of the Err values
+	Message string // What failed, such as the error of the chain verification
+	cause   error
+}
+
+func (e *SignatureError) Error() string {
+	if e.Message == "" {
+		return e.Err.Error()
+	}
+	return e.Message
+}
+
+// Unwrap returns the cause and the error the failure comes from.
+func (e *SignatureError) Unwrap() []error {
+	if e.cause == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Err, e.cause}
+}
+
+// Err returns why the signature failed verification, nil if it did not: the
+// SignatureErrors, joined, in the order of the validation of the byte range,
+// the signature value, the certificate chain, the timestamp and the
+// constraints on the signed document.
+func (s Signer) Err() error {
+	var errs []error
+	fail := func(cause *Error, message string, err error) {
+		errs = append(errs, &SignatureError{Err: cause, Message: message, cause: err})
+	}
+
+	if !s.ByteRangeValid {
+		fail(ErrByteRange, strings.Join(s.ByteRangeErrors, "; "), nil)
+	}
+	if !s.ValidSignature {
+		message := ""
+		if s.signatureError != nil {
+			message = s.signatureError.Error()
+		}
+		var mismatch *pkcs7.MessageDigestMismatchError
+		switch {
+		case errors.As(s.signatureError, &mismatch), errors.Is(s.signatureError, ErrDigestMismatch), errors.Is(s.signatureError, errImprintMismatch):
+			fail(ErrDigestMismatch, message, s.signatureError)
+		case errors.Is(s.signatureError, ErrNoSignerCertificate), strings.Contains(message, "No certificate for signer"):
+			fail(ErrNoSignerCertificate, message, s.signatureError)
+		default:
+			fail(ErrInvalidSignature, message, s.signatureError)
+		}
+	}
+
+	if s.RevokedCertificate {
+		var revoked []string
+		for _, c := range s.Certificates {
+			if c.RevocationTime != nil && c.Certificate != nil {
+				revoked = append(revoked, "certificate "+c.Certificate.Subject.String()+" was revoked at "+c.RevocationTime.UTC().Format(time.RFC3339))
+			}
+		}
+		fail(ErrCertRevoked, strings.Join(revoked, "; "), nil)
+	}
+	if !s.TrustedIssuer && s.ValidSignature {
+		errs = append(errs, chainError(s))
+	}
+	if c := signingCertificate(s); c != nil && s.ValidSignature {
+		if c.KeyUsageError != "" {
+			fail(ErrKeyUsage, c.KeyUsageError, nil)
+		}
+		if c.ExtKeyUsageError != "" {
+			fail(ErrKeyUsage, c.ExtKeyUsageError, nil)
+		}
+	}
+
+	if s.TimestampError != "" && s.SignatureType != "document_timestamp" {
+		fail(ErrInvalidTimestamp, s.TimestampError, nil)
+	}
+	for _, weak := range s.WeakAlgorithms {
+		fail(ErrWeakAlgorithm, weak, nil)
+	}
+	for _, policy := range s.PolicyErrors {
+		fail(ErrPolicy, policy, nil)
+	}
+	if s.DisallowedModifications {
+		messages := append(append([]string(nil), s.DocMDPViolations...), s.FieldMDPViolations...)
+		for _, m := range s.Modifications {
+			if m.Type == "content_change" {
+				messages = append(messages, m.Description+" changed after signing")
+			}
+		}
+		fail(ErrDisallowedChange, strings.Join(messages, "; "), nil)
+	}
+	if s.ModificationError != "" {
+		fail(ErrModificationsUnknown, s.ModificationError, nil)
+	}
+	return errors.Join(errs...)
+}
+
+// chainError returns why the chain of the certificates of s, which does not
+// end at a trusted root, is not valid.
+func chainError(s Signer) error {
+	for _, expired := range s.Certificates {
+		if expired.ExpiryError != "" {
+			return &SignatureError{Err: ErrCertExpired, Message: expired.ExpiryError}
+		}
+	}
+	c := signingCertificate(s)
+	if c == nil {
+		return &SignatureError{Err: ErrNoSignerCertificate}
+	}
+	if c.verifyErr == nil {
+		return &SignatureError{Err: ErrUntrustedChain}
+	}
+
+	var invalid x509.CertificateInvalidError
+	if errors.As(c.verifyErr, &invalid) && invalid.Reason == x509.Expired {
+		cert := invalid.Cert
+		if cert == nil {
+			cert = c.Certificate
+		}
+		if s.VerificationTime != nil && s.VerificationTime.Before(cert.NotBefore) {
+			return &SignatureError{Err: ErrCertNotYetValid, Message: c.verifyErr.Error(), cause: c.verifyErr}
+		}
+		return &SignatureError{Err: ErrCertExpired, Message: c.verifyErr.Error(), cause: c.verifyErr}
+	}
+	return &SignatureError{Err: ErrUntrustedChain, Message: c.verifyErr.Error(), cause: c.verifyErr}
+}
+
+// errorCodes returns the codes of the causes of err, an error of Signer.Err,
+// each once.
+func errorCodes(err error) []string {
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return nil
+	}
+	var codes []string
+	for _, e := range joined.Unwrap() {
+		var failure *SignatureError
+		if errors.As(e, &failure) && !slices.Contains(codes, failure.Err.Code) {
+			codes = append(codes, failure.Err.Code)
+		}
+	}
+	return codes
+}
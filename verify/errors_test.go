@@ -0,0 +1,168 @@
+package verify
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pkcs7"
+)
+
+func TestSignerErr(t *testing.T) {
+	notAfter := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cert := &x509.Certificate{
+		Subject:   pkix.Name{CommonName: "Signer"},
+		NotBefore: notAfter.AddDate(-1, 0, 0),
+		NotAfter:  notAfter,
+	}
+	beforeValidity := notAfter.AddDate(-2, 0, 0)
+	expired := x509.CertificateInvalidError{Cert: cert, Reason: x509.Expired}
+
+	valid := Signer{
+		SignatureType:  "signature",
+		ValidSignature: true,
+		ByteRangeValid: true,
+		TrustedIssuer:  true,
+		Certificates:   []Certificate{{Certificate: cert, KeyUsageValid: true, ExtKeyUsageValid: true}},
+	}
+
+	tests := []struct {
+		name      string
+		modify    func(s *Signer)
+		wantErrs  []*Error
+		wantCodes []string
+	}{
+		{
+			name:   "valid",
+			modify: func(s *Signer) {},
+		},
+		{
+			name: "digest mismatch",
+			modify: func(s *Signer) {
+				s.ValidSignature = false
+				s.signatureError = fmt.Errorf("signature verification failed: %w", &pkcs7.MessageDigestMismatchError{})
+			},
+			wantErrs:  []*Error{ErrDigestMismatch},
+			wantCodes: []string{"digest_mismatch"},
+		},
+		{
+			name: "no signing certificate",
+			modify: func(s *Signer) {
+				s.ValidSignature = false
+				s.signatureError = fmt.Errorf("signature verification failed: %w", ErrNoSignerCertificate)
+			},
+			wantErrs:  []*Error{ErrNoSignerCertificate},
+			wantCodes: []string{"no_signer_certificate"},
+		},
+		{
+			name: "byte range and signature value",
+			modify: func(s *Signer) {
+				s.ByteRangeValid = false
+				s.ByteRangeErrors = []string{"the first 10 bytes are not signed"}
+				s.ValidSignature = false
+			},
+			wantErrs:  []*Error{ErrByteRange, ErrInvalidSignature},
+			wantCodes: []string{"byte_range", "invalid_signature"},
+		},
+		{
+			name: "expired",
+			modify: func(s *Signer) {
+				s.TrustedIssuer = false
+				s.Certificates[0].verifyErr = expired
+			},
+			wantErrs:  []*Error{ErrCertExpired},
+			wantCodes: []string{"certificate_expired"},
+		},
+		{
+			name: "not yet valid",
+			modify: func(s *Signer) {
+				s.TrustedIssuer = false
+				s.VerificationTime = &beforeValidity
+				s.Certificates[0].verifyErr = expired
+			},
+			wantErrs:  []*Error{ErrCertNotYetValid},
+			wantCodes: []string{"certificate_not_yet_valid"},
+		},
+		{
+			name: "untrusted",
+			modify: func(s *Signer) {
+				s.TrustedIssuer = false
+				s.Certificates[0].verifyErr = x509.UnknownAuthorityError{Cert: cert}
+			},
+			wantErrs:  []*Error{ErrUntrustedChain},
+			wantCodes: []string{"untrusted_chain"},
+		},
+		{
+			name: "revoked",
+			modify: func(s *Signer) {
+				s.RevokedCertificate = true
+				s.Certificates[0].RevocationTime = &notAfter
+			},
+			wantErrs:  []*Error{ErrCertRevoked},
+			wantCodes: []string{"certificate_revoked"},
+		},
+		{
+			name: "constraints",
+			modify: func(s *Signer) {
+				s.Certificates[0].ExtKeyUsageError = "missing Document Signing EKU"
+				s.TimestampError = "timestamp message imprint does not match"
+				s.WeakAlgorithms = []string{"SHA-1 digest algorithm", "1024 bit RSA key"}
+				s.PolicyErrors = []string{"the policy requires a valid signature timestamp"}
+				s.DisallowedModifications = true
+				s.Modifications = []Modification{{Type: "content_change", Description: "page 1 content stream"}}
+			},
+			wantErrs:  []*Error{ErrKeyUsage, ErrInvalidTimestamp, ErrWeakAlgorithm, ErrPolicy, ErrDisallowedChange},
+			wantCodes: []string{"key_usage", "invalid_timestamp", "weak_algorithm", "policy", "disallowed_modification"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := valid
+			s.Certificates = append([]Certificate(nil), valid.Certificates...)
+			tt.modify(&s)
+
+			err := s.Err()
+			if len(tt.wantErrs) == 0 && err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			for _, want := range tt.wantErrs {
+				if !errors.Is(err, want) {
+					t.Errorf("expected %v to be %q", err, want.Code)
+				}
+			}
+			if codes := errorCodes(err); !reflect.DeepEqual(codes, tt.wantCodes) {
+				t.Errorf("expected the codes %q, got %q", tt.wantCodes, codes)
+			}
+		})
+	}
+}
+
+func TestSignatureErrorUnwrap(t *testing.T) {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "Signer"}}
+	s := Signer{
+		ValidSignature: true,
+		ByteRangeValid: true,
+		Certificates:   []Certificate{{Certificate: cert, verifyErr: x509.UnknownAuthorityError{Cert: cert}}},
+	}
+
+	err := s.Err()
+	var failure *SignatureError
+	if !errors.As(err, &failure) || failure.Err != ErrUntrustedChain {
+		t.Fatalf("expected a SignatureError of an untrusted chain, got %v", err)
+	}
+	var unknown x509.UnknownAuthorityError
+	if !errors.As(err, &unknown) {
+		t.Errorf("expected %v to wrap the error of the chain verification", err)
+	}
+	if errors.Is(err, ErrCertExpired) {
+		t.Errorf("expected %v not to be %q", err, ErrCertExpired.Code)
+	}
+	if failure.Error() != unknown.Error() {
+		t.Errorf("expected the message %q, got %q", unknown.Error(), failure.Error())
+	}
+}
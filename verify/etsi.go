@@ -0,0 +1,220 @@
+package verify
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/digitorus/pkcs7"
+)
+
+// Main indications of ETSI EN 319 102-1.
+const (
+	IndicationTotalPassed   = "TOTAL-PASSED"
+	IndicationTotalFailed   = "TOTAL-FAILED"
+	IndicationIndeterminate = "INDETERMINATE"
+)
+
+// Sub-indications of ETSI EN 319 102-1 that explain a TOTAL-FAILED or
+// INDETERMINATE indication.
+const (
+	SubIndicationFormatFailure                  = "FORMAT_FAILURE"
+	SubIndicationHashFailure                    = "HASH_FAILURE"
+	SubIndicationSigCryptoFailure               = "SIG_CRYPTO_FAILURE"
+	SubIndicationRevoked                        = "REVOKED"
+	SubIndicationExpired                        = "EXPIRED"
+	SubIndicationNotYetValid                    = "NOT_YET_VALID"
+	SubIndicationSigConstraintsFailure          = "SIG_CONSTRAINTS_FAILURE"
+	SubIndicationChainConstraintsFailure        = "CHAIN_CONSTRAINTS_FAILURE"
+	SubIndicationCertificateChainGeneralFailure = "CERTIFICATE_CHAIN_GENERAL_FAILURE"
+	SubIndicationNoSigningCertificateFound      = "NO_SIGNING_CERTIFICATE_FOUND"
+	SubIndicationNoCertificateChainFound        = "NO_CERTIFICATE_CHAIN_FOUND"
+	SubIndicationOutOfBoundsNoPOE               = "OUT_OF_BOUNDS_NO_POE"
+	SubIndicationRevocationOutOfBoundsNoPOE     = "REVOCATION_OUT_OF_BOUNDS_NO_POE"
+	SubIndicationCryptoConstraintsFailure       = "CRYPTO_CONSTRAINTS_FAILURE"
+	SubIndicationCryptoConstraintsFailureNoPOE  = "CRYPTO_CONSTRAINTS_FAILURE_NO_POE"
+)
+
+// ETSIReport is a validation report in the terms of ETSI EN 319 102-1, with
+// an indication and sub-indication for each signature, for validation
+// services under eIDAS.
+type ETSIReport struct {
+	ValidationTime time.Time             `json:"validation_time"` // When the report was created
+	Signatures     []ETSISignatureReport `json:"signatures"`      // Signatures and document timestamps in document order
+}
+
+// ETSISignatureReport is the validation status of a signature or document
+// timestamp of an ETSIReport.
+type ETSISignatureReport struct {
+	Type               string     `json:"type"` // "signature", "document_timestamp" or "usage_rights"
+	Name               string     `json:"name,omitempty"`
+	SigningCertificate string     `json:"signing_certificate,omitempty"` // Subject of the signing certificate
+	ClaimedSigningTime *time.Time `json:"claimed_signing_time,omitempty"`
+	BestSignatureTime  *time.Time `json:"best_signature_time,omitempty"` // Time proven by a valid timestamp
+	Indication         string     `json:"indication"`
+	SubIndication      string     `json:"sub_indication,omitempty"`
+	Messages           []string   `json:"messages,omitempty"` // Why the signature did not pass
+}
+
+// ETSIReport returns the verification result as ETSIReport.
+func (r *Response) ETSIReport() *ETSIReport {
+	report := &ETSIReport{
+		ValidationTime: time.Now().UTC(),
+		Signatures:     make([]ETSISignatureReport, 0, len(r.Signers)),
+	}
+	for _, s := range r.Signers {
+		report.Signatures = append(report.Signatures, newETSISignatureReport(s))
+	}
+	return report
+}
+
+// MarshalETSIReport returns the JSON encoding of the ETSIReport of the
+// verification result.
+func (r *Response) MarshalETSIReport() ([]byte, error) {
+	return json.Marshal(r.ETSIReport())
+}
+
+func newETSISignatureReport(s Signer) ETSISignatureReport {
+	signature := ETSISignatureReport{
+		Type:               s.SignatureType,
+		Name:               s.Name,
+		ClaimedSigningTime: s.SignatureTime,
+		BestSignatureTime:  s.TimestampTime,
+	}
+	if s.SignatureType == "document_timestamp" && s.ValidSignature && s.TimeStamp != nil {
+		signature.BestSignatureTime = &s.TimeStamp.Time
+	}
+	if c := signingCertificate(s); c != nil {
+		signature.SigningCertificate = c.Certificate.Subject.String()
+	}
+	signature.Indication, signature.SubIndication, signature.Messages = etsiIndication(s)
+	return signature
+}
+
+// signingCertificate returns the certificate of the signer of s, or the
+// first certificate when the signature does not name it.
+func signingCertificate(s Signer) *Certificate {
+	for i, c := range s.Certificates {
+		if c.Certificate != nil && c.Certificate == s.signingCertificate {
+			return &s.Certificates[i]
+		}
+	}
+	if len(s.Certificates) > 0 && s.Certificates[0].Certificate != nil {
+		return &s.Certificates[0]
+	}
+	return nil
+}
+
+// etsiIndication returns the indication and sub-indication of s in the order
+// of the validation process of ETSI EN 319 102-1: the format, the signature
+// value, the certificate chain and the constraints on the signed document.
+func etsiIndication(s Signer) (indication, subIndication string, messages []string) {
+	if !s.ByteRangeValid {
+		return IndicationTotalFailed, SubIndicationFormatFailure, s.ByteRangeErrors
+	}
+
+	if !s.ValidSignature {
+		if s.signatureError != nil {
+			messages = []string{s.signatureError.Error()}
+		}
+		var mismatch *pkcs7.MessageDigestMismatchError
+		switch {
+		case errors.As(s.signatureError, &mismatch), errors.Is(s.signatureError, ErrDigestMismatch), errors.Is(s.signatureError, errImprintMismatch):
+			return IndicationTotalFailed, SubIndicationHashFailure, messages
+		case errors.Is(s.signatureError, ErrNoSignerCertificate), s.signatureError != nil && strings.Contains(s.signatureError.Error(), "No certificate for signer"):
+			return IndicationIndeterminate, SubIndicationNoSigningCertificateFound, messages
+		case s.signatureError != nil && strings.Contains(s.signatureError.Error(), "is outside of certificate validity"):
+			return IndicationIndeterminate, SubIndicationOutOfBoundsNoPOE, messages
+		}
+		return IndicationTotalFailed, SubIndicationSigCryptoFailure, messages
+	}
+
+	c := signingCertificate(s)
+	if c == nil {
+		return IndicationIndeterminate, SubIndicationNoSigningCertificateFound, nil
+	}
+	if s.RevokedCertificate {
+		for _, revoked := range s.Certificates {
+			if revoked.RevokedBeforeSigning {
+				messages = append(messages, "certificate "+revoked.Certificate.Subject.String()+" was revoked before signing")
+			}
+		}
+		return IndicationTotalFailed, SubIndicationRevoked, messages
+	}
+	if !s.TrustedIssuer {
+		return chainIndication(s, c)
+	}
+	if !c.KeyUsageValid {
+		return IndicationIndeterminate, SubIndicationChainConstraintsFailure, []string{c.KeyUsageError}
+	}
+
+	if len(s.WeakAlgorithms) > 0 {
+		// Weak at the time proven by a timestamp, or at the current time.
+		if s.TimeSource == "embedded_timestamp" {
+			return IndicationIndeterminate, SubIndicationCryptoConstraintsFailure, s.WeakAlgorithms
+		}
+		return IndicationIndeterminate, SubIndicationCryptoConstraintsFailureNoPOE, s.WeakAlgorithms
+	}
+	if len(s.PolicyErrors) > 0 {
+		return IndicationIndeterminate, SubIndicationSigConstraintsFailure, s.PolicyErrors
+	}
+	if s.DisallowedModifications {
+		messages = append(messages, s.DocMDPViolations...)
+		messages = append(messages, s.FieldMDPViolations...)
+		for _, m := range s.Modifications {
+			if m.Type == "content_change" {
+				messages = append(messages, m.Description+" changed after signing")
+			}
+		}
+		if s.ModificationError != "" {
+			messages = append(messages, s.ModificationError)
+		}
+		return IndicationIndeterminate, SubIndicationSigConstraintsFailure, messages
+	}
+	return IndicationTotalPassed, "", nil
+}
+
+// chainIndication returns the indication of a signature whose signing
+// certificate c does not chain to a trusted root. An expired or not yet
+// valid certificate only fails the signature when a timestamp proves the
+// signing time.
+func chainIndication(s Signer, c *Certificate) (indication, subIndication string, messages []string) {
+	for _, expired := range s.Certificates {
+		if expired.ExpiryError != "" {
+			return IndicationIndeterminate, SubIndicationRevocationOutOfBoundsNoPOE, []string{expired.ExpiryError}
+		}
+	}
+	if c.verifyErr == nil {
+		// Verified with the embedded certificates only.
+		return IndicationIndeterminate, SubIndicationNoCertificateChainFound, []string{"the certificate chain does not end at a trusted root"}
+	}
+	messages = []string{c.verifyErr.Error()}
+
+	var unknown x509.UnknownAuthorityError
+	var invalid x509.CertificateInvalidError
+	switch {
+	case errors.As(c.verifyErr, &unknown):
+		return IndicationIndeterminate, SubIndicationNoCertificateChainFound, messages
+	case errors.As(c.verifyErr, &invalid) && invalid.Reason == x509.Expired:
+		cert := invalid.Cert
+		if cert == nil {
+			cert = c.Certificate
+		}
+		proven := s.TimeSource == "embedded_timestamp" && s.VerificationTime != nil
+		switch {
+		case s.VerificationTime != nil && s.VerificationTime.Before(cert.NotBefore):
+			if proven {
+				return IndicationTotalFailed, SubIndicationNotYetValid, messages
+			}
+			return IndicationIndeterminate, SubIndicationNotYetValid, messages
+		case proven && cert == c.Certificate:
+			return IndicationTotalFailed, SubIndicationExpired, messages
+		}
+		return IndicationIndeterminate, SubIndicationOutOfBoundsNoPOE, messages
+	case errors.As(c.verifyErr, &invalid) && invalid.Reason == x509.IncompatibleUsage:
+		return IndicationIndeterminate, SubIndicationChainConstraintsFailure, messages
+	}
+	return IndicationIndeterminate, SubIndicationCertificateChainGeneralFailure, messages
+}
@@ -0,0 +1,239 @@
+package verify
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pkcs7"
+)
+
+func TestETSIIndication(t *testing.T) {
+	notAfter := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cert := &x509.Certificate{
+		Subject:   pkix.Name{CommonName: "Signer"},
+		NotBefore: notAfter.AddDate(-1, 0, 0),
+		NotAfter:  notAfter,
+	}
+	afterExpiry := notAfter.AddDate(0, 1, 0)
+	expired := x509.CertificateInvalidError{Cert: cert, Reason: x509.Expired}
+
+	valid := Signer{
+		ValidSignature: true,
+		ByteRangeValid: true,
+		TrustedIssuer:  true,
+		Certificates:   []Certificate{{Certificate: cert, KeyUsageValid: true}},
+	}
+
+	tests := []struct {
+		name              string
+		modify            func(s *Signer)
+		wantIndication    string
+		wantSubIndication string
+	}{
+		{
+			name:           "passed",
+			modify:         func(s *Signer) {},
+			wantIndication: IndicationTotalPassed,
+		},
+		{
+			name: "byte range",
+			modify: func(s *Signer) {
+				s.ByteRangeValid = false
+				s.ByteRangeErrors = []string{"the first 10 bytes are not signed"}
+			},
+			wantIndication:    IndicationTotalFailed,
+			wantSubIndication: SubIndicationFormatFailure,
+		},
+		{
+			name: "digest mismatch",
+			modify: func(s *Signer) {
+				s.ValidSignature = false
+				s.signatureError = fmt.Errorf("signature verification failed: %w", &pkcs7.MessageDigestMismatchError{})
+			},
+			wantIndication:    IndicationTotalFailed,
+			wantSubIndication: SubIndicationHashFailure,
+		},
+		{
+			name: "document timestamp imprint",
+			modify: func(s *Signer) {
+				s.ValidSignature = false
+				s.signatureError = errImprintMismatch
+			},
+			wantIndication:    IndicationTotalFailed,
+			wantSubIndication: SubIndicationHashFailure,
+		},
+		{
+			name: "no signing certificate",
+			modify: func(s *Signer) {
+				s.ValidSignature = false
+				s.signatureError = fmt.Errorf("signature verification failed: %w", ErrNoSignerCertificate)
+			},
+			wantIndication:    IndicationIndeterminate,
+			wantSubIndication: SubIndicationNoSigningCertificateFound,
+		},
+		{
+			name: "signature value",
+			modify: func(s *Signer) {
+				s.ValidSignature = false
+				s.signatureError = fmt.Errorf("signature verification failed: %w", x509.ErrUnsupportedAlgorithm)
+			},
+			wantIndication:    IndicationTotalFailed,
+			wantSubIndication: SubIndicationSigCryptoFailure,
+		},
+		{
+			name: "revoked",
+			modify: func(s *Signer) {
+				s.RevokedCertificate = true
+				s.Certificates = []Certificate{{Certificate: cert, RevokedBeforeSigning: true}}
+			},
+			wantIndication:    IndicationTotalFailed,
+			wantSubIndication: SubIndicationRevoked,
+		},
+		{
+			name: "unknown authority",
+			modify: func(s *Signer) {
+				s.TrustedIssuer = false
+				s.Certificates[0].verifyErr = x509.UnknownAuthorityError{Cert: cert}
+			},
+			wantIndication:    IndicationIndeterminate,
+			wantSubIndication: SubIndicationNoCertificateChainFound,
+		},
+		{
+			name: "embedded root",
+			modify: func(s *Signer) {
+				s.TrustedIssuer = false
+			},
+			wantIndication:    IndicationIndeterminate,
+			wantSubIndication: SubIndicationNoCertificateChainFound,
+		},
+		{
+			name: "expired at the current time",
+			modify: func(s *Signer) {
+				s.TrustedIssuer = false
+				s.TimeSource = "current_time"
+				s.VerificationTime = &afterExpiry
+				s.Certificates[0].verifyErr = expired
+			},
+			wantIndication:    IndicationIndeterminate,
+			wantSubIndication: SubIndicationOutOfBoundsNoPOE,
+		},
+		{
+			name: "expired at the timestamp",
+			modify: func(s *Signer) {
+				s.TrustedIssuer = false
+				s.TimeSource = "embedded_timestamp"
+				s.VerificationTime = &afterExpiry
+				s.Certificates[0].verifyErr = expired
+			},
+			wantIndication:    IndicationTotalFailed,
+			wantSubIndication: SubIndicationExpired,
+		},
+		{
+			name: "expired without revocation data",
+			modify: func(s *Signer) {
+				s.TrustedIssuer = false
+				s.TimeSource = "embedded_timestamp"
+				s.Certificates[0].Expired = true
+				s.Certificates[0].ExpiryError = "certificate expired at 2024-01-01 00:00:00 +0000 UTC without revocation data from its validity period"
+			},
+			wantIndication:    IndicationIndeterminate,
+			wantSubIndication: SubIndicationRevocationOutOfBoundsNoPOE,
+		},
+		{
+			name: "not yet valid",
+			modify: func(s *Signer) {
+				s.TrustedIssuer = false
+				s.TimeSource = "signature_time"
+				before := cert.NotBefore.Add(-time.Hour)
+				s.VerificationTime = &before
+				s.Certificates[0].verifyErr = expired
+			},
+			wantIndication:    IndicationIndeterminate,
+			wantSubIndication: SubIndicationNotYetValid,
+		},
+		{
+			name: "incompatible usage",
+			modify: func(s *Signer) {
+				s.TrustedIssuer = false
+				s.Certificates[0].verifyErr = x509.CertificateInvalidError{Cert: cert, Reason: x509.IncompatibleUsage}
+			},
+			wantIndication:    IndicationIndeterminate,
+			wantSubIndication: SubIndicationChainConstraintsFailure,
+		},
+		{
+			name: "key usage",
+			modify: func(s *Signer) {
+				s.Certificates[0].KeyUsageValid = false
+				s.Certificates[0].KeyUsageError = "certificate does not have Non-Repudiation key usage"
+			},
+			wantIndication:    IndicationIndeterminate,
+			wantSubIndication: SubIndicationChainConstraintsFailure,
+		},
+		{
+			name: "disallowed modifications",
+			modify: func(s *Signer) {
+				s.DisallowedModifications = true
+				s.DocMDPViolations = []string{"page 1 annotation added after certification at level 1"}
+			},
+			wantIndication:    IndicationIndeterminate,
+			wantSubIndication: SubIndicationSigConstraintsFailure,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := valid
+			s.Certificates = []Certificate{valid.Certificates[0]}
+			tt.modify(&s)
+			indication, subIndication, messages := etsiIndication(s)
+			if indication != tt.wantIndication || subIndication != tt.wantSubIndication {
+				t.Errorf("expected %s/%s, got %s/%s", tt.wantIndication, tt.wantSubIndication, indication, subIndication)
+			}
+			if indication != IndicationTotalPassed && len(messages) == 0 {
+				t.Errorf("expected a message for %s", subIndication)
+			}
+		})
+	}
+}
+
+func TestETSIReport(t *testing.T) {
+	file, err := os.Open(filepath.Join("..", "testfiles", "testfile30.pdf"))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	response, err := VerifyFile(file)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	data, err := response.MarshalETSIReport()
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	var report ETSIReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if len(report.Signatures) != len(response.Signers) {
+		t.Fatalf("expected %d signatures, got %d", len(response.Signers), len(report.Signatures))
+	}
+	for i, signature := range report.Signatures {
+		want, _, _ := etsiIndication(response.Signers[i])
+		if signature.Indication != want {
+			t.Errorf("signature %d: expected indication %s, got %s", i+1, want, signature.Indication)
+		}
+		if signature.SigningCertificate == "" {
+			t.Errorf("signature %d: expected the signing certificate", i+1)
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package verify
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLOTLURL is the location of the EU List of Trusted Lists.
+const DefaultLOTLURL = "https://ec.europa.eu/tools/lotl/eu-lotl.xml"
+
+// tslMimeType is the MIME type of the XML trusted lists the LOTL points to,
+// the others are their PDF versions.
+const tslMimeType = "application/vnd.etsi.tsl+xml"
+
+// EUTLProvider is a TrustProvider of the services of the EU trusted lists:
+// it downloads the EU List of Trusted Lists and the trusted lists of the
+// member states it points to. The anchors are kept until the next update of
+// the lists, and the lists stored in the Cache to share them between runs.
+//
+// The lists are only downloaded over HTTPS. The XML signature of each
+// trusted list is verified against the signing certificates the LOTL lists
+// for it, that of the LOTL against the LOTLCertificates. Only the CA/QC and
+// CA/PKC services are anchors, the certificates of timestamping, validation
+// and other services do not issue signing certificates.
+type EUTLProvider struct {
+	URL              string              // Location of the LOTL, an https URL, DefaultLOTLURL if empty
+	LOTLCertificates []*x509.Certificate // Signing certificates of the LOTL, as published in the Official Journal of the EU; those of the pointer of the LOTL to itself if empty
+	HTTPClient       *http.Client        // Client for the downloads, VerifyOptions.HTTPClient or a client with a timeout of 30 seconds if nil
+	Territories      []string            // Only load the lists of these countries, such as "DE", all if empty
+	Cache            RevocationCache     // Stores the downloaded lists until their next update, nothing is stored if nil
+
+	mu      sync.Mutex
+	anchors []TrustAnchor
+	err     error
+	expires time.Time
+}
+
+// TrustAnchors implements TrustProvider. The lists that fail to load are
+// reported in the error and retried after an hour, the anchors of the others
+// are returned.
+func (p *EUTLProvider) TrustAnchors(ctx context.Context) ([]TrustAnchor, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.expires.After(time.Now()) {
+		return p.anchors, p.err
+	}
+
+	lotlURL := p.URL
+	if lotlURL == "" {
+		lotlURL = DefaultLOTLURL
+	}
+	lotl, err := p.fetchList(ctx, lotlURL, func(lotl *tslDocument) ([]*x509.Certificate, error) {
+		if len(p.LOTLCertificates) > 0 {
+			return p.LOTLCertificates, nil
+		}
+		for _, pointer := range lotl.SchemeInformation.Pointers {
+			if pointer.listOfLists() {
+				return pointer.certificates()
+			}
+		}
+		return nil, errors.New("the LOTL has no pointer to itself")
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the EU List of Trusted Lists: %w", err)
+	}
+
+	var anchors []TrustAnchor
+	var errs []error
+	nextUpdate := lotl.nextUpdate()
+	for _, pointer := range lotl.SchemeInformation.Pointers {
+		territory, ok := pointer.trustedList()
+		if !ok || (len(p.Territories) > 0 && !slices.Contains(p.Territories, territory)) {
+			continue
+		}
+		list, err := p.fetchList(ctx, pointer.Location, func(*tslDocument) ([]*x509.Certificate, error) {
+			return pointer.certificates()
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to load the trusted list of %s: %w", territory, err))
+			continue
+		}
+		a, err := list.trustAnchors()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to parse the trusted list of %s: %w", territory, err))
+		}
+		anchors = append(anchors, a...)
+		if next := list.nextUpdate(); !next.IsZero() && (nextUpdate.IsZero() || next.Before(nextUpdate)) {
+			nextUpdate = next
+		}
+	}
+
+	p.anchors, p.err = anchors, errors.Join(errs...)
+	p.expires = nextUpdate
+	if p.err != nil || !p.expires.After(time.Now()) {
+		p.expires = time.Now().Add(time.Hour)
+	}
+	return p.anchors, p.err
+}
+
+// fetchList returns the trusted list at url from the Cache or downloads it.
+// signers returns the certificates of the list, one of which must have
+// signed it.
+func (p *EUTLProvider) fetchList(ctx context.Context, url string, signers func(*tslDocument) ([]*x509.Certificate, error)) (*tslDocument, error) {
+	key := "tsl/" + url
+	if p.Cache != nil {
+		if data := p.Cache.Get(key); data != nil {
+			if list, err := verifyTrustedList(data, signers); err == nil {
+				return list, nil
+			}
+		}
+	}
+
+	data, err := downloadTrustList(ctx, p.HTTPClient, url)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := verifyTrustedList(data, signers)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted list %s: %w", url, err)
+	}
+	if p.Cache != nil {
+		if next := list.nextUpdate(); next.After(time.Now()) {
+			_ = p.Cache.Put(key, data, next)
+		}
+	}
+	return list, nil
+}
+
+// tslDocument is a trusted list of ETSI TS 119 612, or the LOTL that points
+// to the trusted lists. Elements are matched by their local names.
+type tslDocument struct {
+	XMLName           xml.Name `xml:"TrustServiceStatusList"`
+	SchemeInformation struct {
+		Territory  string       `xml:"SchemeTerritory"`
+		NextUpdate string       `xml:"NextUpdate>dateTime"`
+		Pointers   []tslPointer `xml:"PointersToOtherTSL>OtherTSLPointer"`
+	} `xml:"SchemeInformation"`
+	Providers []tslProvider `xml:"TrustServiceProviderList>TrustServiceProvider"`
+}
+
+type tslPointer struct {
+	Location     string   `xml:"TSLLocation"`
+	Certificates []string `xml:"ServiceDigitalIdentities>ServiceDigitalIdentity>DigitalId>X509Certificate"`
+	Information  []struct {
+		TSLType   string `xml:"TSLType"`
+		Territory string `xml:"SchemeTerritory"`
+		MimeType  string `xml:"MimeType"`
+	} `xml:"AdditionalInformation>OtherInformation"`
+}
+
+type tslProvider struct {
+	Names    []string     `xml:"TSPInformation>TSPName>Name"`
+	Services []tslService `xml:"TSPServices>TSPService"`
+}
+
+type tslService struct {
+	Information tslServiceInformation   `xml:"ServiceInformation"`
+	History     []tslServiceInformation `xml:"ServiceHistory>ServiceHistoryInstance"`
+}
+
+type tslServiceInformation struct {
+	Type         string   `xml:"ServiceTypeIdentifier"`
+	Names        []string `xml:"ServiceName>Name"`
+	Certificates []string `xml:"ServiceDigitalIdentity>DigitalId>X509Certificate"`
+	Status       string   `xml:"ServiceStatus"`
+	StatusSince  string   `xml:"StatusStartingTime"`
+	Qualifiers   []struct {
+		URI string `xml:"uri,attr"`
+	} `xml:"ServiceInformationExtensions>Extension>Qualifications>QualificationElement>Qualifiers>Qualifier"`
+	AdditionalInformation []string `xml:"ServiceInformationExtensions>Extension>AdditionalServiceInformation>URI"`
+}
+
+// parseTrustedList parses the XML trusted list data.
+func parseTrustedList(data []byte) (*tslDocument, error) {
+	var list tslDocument
+	if err := xml.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// verifyTrustedList parses the XML trusted list data and verifies its
+// signature with the certificates signers returns for the list.
+func verifyTrustedList(data []byte, signers func(*tslDocument) ([]*x509.Certificate, error)) (*tslDocument, error) {
+	list, err := parseTrustedList(data)
+	if err != nil {
+		return nil, err
+	}
+	certificates, err := signers(list)
+	if err != nil {
+		return nil, err
+	}
+	if len(certificates) == 0 {
+		return nil, errors.New("no signing certificates for the list")
+	}
+	if err := verifyXMLSignature(data, certificates); err != nil {
+		return nil, fmt.Errorf("invalid signature: %w", err)
+	}
+	return list, nil
+}
+
+// nextUpdate returns the time of the next update of the list, zero if it
+// has none, which means the list is closed.
+func (d *tslDocument) nextUpdate() time.Time {
+	t, _ := time.Parse(time.RFC3339, strings.TrimSpace(d.SchemeInformation.NextUpdate))
+	return t
+}
+
+// trustedList returns the territory of the XML trusted list of a member
+// state the pointer refers to, false for the other pointers of the LOTL.
+func (p tslPointer) trustedList() (string, bool) {
+	var territory string
+	var xmlList bool
+	for _, info := range p.Information {
+		if t := strings.TrimSpace(info.Territory); t != "" {
+			territory = t
+		}
+		xmlList = xmlList || strings.TrimSpace(info.MimeType) == tslMimeType
+	}
+	return territory, xmlList && !p.listOfLists() && p.Location != ""
+}
+
+// listOfLists reports whether the pointer refers to a list of trusted lists,
+// such as the pointer of the LOTL to itself.
+func (p tslPointer) listOfLists() bool {
+	for _, info := range p.Information {
+		if strings.HasSuffix(strings.TrimSpace(info.TSLType), "listofthelists") {
+			return true
+		}
+	}
+	return false
+}
+
+// certificates returns the signing certificates of the list the pointer
+// refers to.
+func (p tslPointer) certificates() ([]*x509.Certificate, error) {
+	var certificates []*x509.Certificate
+	for _, encoded := range p.Certificates {
+		cert, err := parseTSLCertificate(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signing certificate of %s: %w", p.Location, err)
+		}
+		certificates = append(certificates, cert)
+	}
+	return certificates, nil
+}
+
+// trustAnchors returns an anchor for each certificate of each CA service of
+// the list. The history of a service completes the status history of its
+// anchors.
+func (d *tslDocument) trustAnchors() ([]TrustAnchor, error) {
+	var anchors []TrustAnchor
+	var errs []error
+	for _, provider := range d.Providers {
+		for _, service := range provider.Services {
+			info := service.Information
+			if t := strings.TrimSpace(info.Type); t != ServiceTypeCAQC && t != ServiceTypeCAPKC {
+				continue
+			}
+			history := []TrustServiceStatus{info.status()}
+			for _, h := range service.History {
+				history = append(history, h.status())
+			}
+			slices.SortStableFunc(history, func(a, b TrustServiceStatus) int {
+				return b.Since.Compare(a.Since)
+			})
+
+			var qualifiers []string
+			for _, q := range info.Qualifiers {
+				qualifiers = append(qualifiers, strings.TrimSpace(q.URI))
+			}
+			for _, uri := range info.AdditionalInformation {
+				qualifiers = append(qualifiers, strings.TrimSpace(uri))
+			}
+
+			for _, encoded := range info.Certificates {
+				cert, err := parseTSLCertificate(encoded)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("invalid certificate of %s: %w", firstName(info.Names), err))
+					continue
+				}
+				anchors = append(anchors, TrustAnchor{
+					Certificate:   cert,
+					Source:        "eutl",
+					Territory:     strings.TrimSpace(d.SchemeInformation.Territory),
+					Provider:      firstName(provider.Names),
+					ServiceName:   firstName(info.Names),
+					ServiceType:   strings.TrimSpace(info.Type),
+					Qualifiers:    qualifiers,
+					StatusHistory: history,
+				})
+			}
+		}
+	}
+	return anchors, errors.Join(errs...)
+}
+
+// parseTSLCertificate parses the base64 encoded certificate of a trusted
+// list.
+func parseTSLCertificate(encoded string) (*x509.Certificate, error) {
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(encoded), ""))
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+// status returns the status of the service information.
+func (i tslServiceInformation) status() TrustServiceStatus {
+	since, _ := time.Parse(time.RFC3339, strings.TrimSpace(i.StatusSince))
+	return TrustServiceStatus{Status: strings.TrimSpace(i.Status), Since: since}
+}
+
+// firstName returns the first of the names, the name in the first language of a
+// trusted list, which is English for the names of providers and services.
+func firstName(names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(names[0])
+}
@@ -0,0 +1,286 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testLOTL is a LOTL that points to itself, the PDF and XML trusted list of
+// BE and the XML trusted list of DE, with the signing certificates of the
+// LOTL and of the trusted lists.
+const testLOTL = `<?xml version="1.0" encoding="UTF-8"?>
+<TrustServiceStatusList xmlns="http://uri.etsi.org/02231/v2#" xmlns:ns3="http://uri.etsi.org/02231/v2/additionaltypes#">
+  <SchemeInformation>
+    <SchemeTerritory>EU</SchemeTerritory>
+    <NextUpdate><dateTime>%[2]s</dateTime></NextUpdate>
+    <PointersToOtherTSL>
+      <OtherTSLPointer>
+        <TSLLocation>%[1]s/lotl.xml</TSLLocation>
+        <ServiceDigitalIdentities><ServiceDigitalIdentity><DigitalId><X509Certificate>%[3]s</X509Certificate></DigitalId></ServiceDigitalIdentity></ServiceDigitalIdentities>
+        <AdditionalInformation>
+          <OtherInformation><TSLType>http://uri.etsi.org/TrstSvc/TrustedList/TSLType/EUlistofthelists</TSLType></OtherInformation>
+          <OtherInformation><SchemeTerritory>EU</SchemeTerritory></OtherInformation>
+          <OtherInformation><ns3:MimeType>application/vnd.etsi.tsl+xml</ns3:MimeType></OtherInformation>
+        </AdditionalInformation>
+      </OtherTSLPointer>
+      <OtherTSLPointer>
+        <TSLLocation>%[1]s/be.pdf</TSLLocation>
+        <ServiceDigitalIdentities><ServiceDigitalIdentity><DigitalId><X509Certificate>%[4]s</X509Certificate></DigitalId></ServiceDigitalIdentity></ServiceDigitalIdentities>
+        <AdditionalInformation>
+          <OtherInformation><SchemeTerritory>BE</SchemeTerritory></OtherInformation>
+          <OtherInformation><ns3:MimeType>application/pdf</ns3:MimeType></OtherInformation>
+        </AdditionalInformation>
+      </OtherTSLPointer>
+      <OtherTSLPointer>
+        <TSLLocation>%[1]s/be.xml</TSLLocation>
+        <ServiceDigitalIdentities><ServiceDigitalIdentity><DigitalId><X509Certificate>%[4]s</X509Certificate></DigitalId></ServiceDigitalIdentity></ServiceDigitalIdentities>
+        <AdditionalInformation>
+          <OtherInformation><TSLType>http://uri.etsi.org/TrstSvc/TrustedList/TSLType/EUgeneric</TSLType></OtherInformation>
+          <OtherInformation><SchemeTerritory>BE</SchemeTerritory></OtherInformation>
+          <OtherInformation><ns3:MimeType>application/vnd.etsi.tsl+xml</ns3:MimeType></OtherInformation>
+        </AdditionalInformation>
+      </OtherTSLPointer>
+      <OtherTSLPointer>
+        <TSLLocation>%[1]s/de.xml</TSLLocation>
+        <ServiceDigitalIdentities><ServiceDigitalIdentity><DigitalId><X509Certificate>%[4]s</X509Certificate></DigitalId></ServiceDigitalIdentity></ServiceDigitalIdentities>
+        <AdditionalInformation>
+          <OtherInformation><SchemeTerritory>DE</SchemeTerritory></OtherInformation>
+          <OtherInformation><ns3:MimeType>application/vnd.etsi.tsl+xml</ns3:MimeType></OtherInformation>
+        </AdditionalInformation>
+      </OtherTSLPointer>
+    </PointersToOtherTSL>
+  </SchemeInformation>
+</TrustServiceStatusList>`
+
+// testTrustedList is a trusted list with a qualified CA service that was
+// granted in 2016 and withdrawn in 2020, and a qualified timestamping
+// service.
+const testTrustedList = `<?xml version="1.0" encoding="UTF-8"?>
+<tsl:TrustServiceStatusList xmlns:tsl="http://uri.etsi.org/02231/v2#" xmlns:ecc="http://uri.etsi.org/TrstSvc/SvcInfoExt/eSigDir-1999-93-EC-TrustedList/#">
+  <tsl:SchemeInformation>
+    <tsl:SchemeTerritory>%[1]s</tsl:SchemeTerritory>
+    <tsl:NextUpdate><tsl:dateTime>%[3]s</tsl:dateTime></tsl:NextUpdate>
+  </tsl:SchemeInformation>
+  <tsl:TrustServiceProviderList>
+    <tsl:TrustServiceProvider>
+      <tsl:TSPInformation><tsl:TSPName><tsl:Name xml:lang="en">Test Provider</tsl:Name></tsl:TSPName></tsl:TSPInformation>
+      <tsl:TSPServices>
+        <tsl:TSPService>
+          <tsl:ServiceInformation>
+            <tsl:ServiceTypeIdentifier>http://uri.etsi.org/TrstSvc/Svctype/CA/QC</tsl:ServiceTypeIdentifier>
+            <tsl:ServiceName><tsl:Name xml:lang="en">Test Qualified CA</tsl:Name></tsl:ServiceName>
+            <tsl:ServiceDigitalIdentity><tsl:DigitalId><tsl:X509Certificate>
+              %[2]s
+            </tsl:X509Certificate></tsl:DigitalId></tsl:ServiceDigitalIdentity>
+            <tsl:ServiceStatus>http://uri.etsi.org/TrstSvc/TrustedList/Svcstatus/withdrawn</tsl:ServiceStatus>
+            <tsl:StatusStartingTime>2020-01-01T00:00:00Z</tsl:StatusStartingTime>
+            <tsl:ServiceInformationExtensions>
+              <tsl:Extension Critical="true">
+                <ecc:Qualifications><ecc:QualificationElement><ecc:Qualifiers>
+                  <ecc:Qualifier uri="http://uri.etsi.org/TrstSvc/TrustedList/SvcInfoExt/QCWithQSCD"/>
+                </ecc:Qualifiers></ecc:QualificationElement></ecc:Qualifications>
+              </tsl:Extension>
+              <tsl:Extension Critical="false">
+                <tsl:AdditionalServiceInformation><tsl:URI xml:lang="en">http://uri.etsi.org/TrstSvc/TrustedList/SvcInfoExt/ForeSignatures</tsl:URI></tsl:AdditionalServiceInformation>
+              </tsl:Extension>
+            </tsl:ServiceInformationExtensions>
+          </tsl:ServiceInformation>
+          <tsl:ServiceHistory>
+            <tsl:ServiceHistoryInstance>
+              <tsl:ServiceTypeIdentifier>http://uri.etsi.org/TrstSvc/Svctype/CA/QC</tsl:ServiceTypeIdentifier>
+              <tsl:ServiceStatus>http://uri.etsi.org/TrstSvc/TrustedList/Svcstatus/granted</tsl:ServiceStatus>
+              <tsl:StatusStartingTime>2016-06-30T22:00:00Z</tsl:StatusStartingTime>
+            </tsl:ServiceHistoryInstance>
+          </tsl:ServiceHistory>
+        </tsl:TSPService>
+        <tsl:TSPService>
+          <tsl:ServiceInformation>
+            <tsl:ServiceTypeIdentifier>http://uri.etsi.org/TrstSvc/Svctype/TSA/QTST</tsl:ServiceTypeIdentifier>
+            <tsl:ServiceName><tsl:Name xml:lang="en">Test Qualified TSA</tsl:Name></tsl:ServiceName>
+            <tsl:ServiceDigitalIdentity><tsl:DigitalId><tsl:X509Certificate>%[4]s</tsl:X509Certificate></tsl:DigitalId></tsl:ServiceDigitalIdentity>
+            <tsl:ServiceStatus>http://uri.etsi.org/TrstSvc/TrustedList/Svcstatus/granted</tsl:ServiceStatus>
+            <tsl:StatusStartingTime>2016-06-30T22:00:00Z</tsl:StatusStartingTime>
+          </tsl:ServiceInformation>
+        </tsl:TSPService>
+      </tsl:TSPServices>
+    </tsl:TrustServiceProvider>
+  </tsl:TrustServiceProviderList>
+</tsl:TrustServiceStatusList>`
+
+// testEUTL is a server of the test LOTL and the trusted list of BE, signed
+// by the certificates of the LOTL, with the qualified CA service ca.
+type testEUTL struct {
+	*httptest.Server
+	lists      map[string][]byte
+	requests   atomic.Int32
+	lotlSigner *x509.Certificate
+	ca         *x509.Certificate
+}
+
+func newTestEUTL(t *testing.T) *testEUTL {
+	t.Helper()
+
+	lotlSigner, lotlKey := newTestCRLIssuer(t, "pdfsign LOTL Signer")
+	tlSigner, tlKey := newTestCRLIssuer(t, "pdfsign Trusted List Signer")
+	ca, _ := newTestCRLIssuer(t, "pdfsign Qualified CA")
+	tsa, _ := newTestCRLIssuer(t, "pdfsign Qualified TSA")
+	nextUpdate := time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339)
+
+	eutl := &testEUTL{lists: map[string][]byte{}, lotlSigner: lotlSigner, ca: ca}
+	eutl.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		eutl.requests.Add(1)
+		if list, ok := eutl.lists[r.URL.Path]; ok {
+			_, _ = w.Write(list)
+		} else {
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(eutl.Close)
+
+	encode := func(cert *x509.Certificate) string { return base64.StdEncoding.EncodeToString(cert.Raw) }
+	eutl.lists["/lotl.xml"] = signTestXML(t, fmt.Sprintf(testLOTL, eutl.URL, nextUpdate, encode(lotlSigner), encode(tlSigner)), lotlKey)
+	eutl.lists["/be.xml"] = signTestXML(t, fmt.Sprintf(testTrustedList, "BE", encode(ca), nextUpdate, encode(tsa)), tlKey)
+	return eutl
+}
+
+func TestEUTLProvider(t *testing.T) {
+	server := newTestEUTL(t)
+	ca := server.ca
+	requests := &server.requests
+
+	cache := NewMemoryRevocationCache()
+	provider := &EUTLProvider{URL: server.URL + "/lotl.xml", Cache: cache, HTTPClient: server.Client()}
+	anchors, err := provider.TrustAnchors(context.Background())
+	if err == nil {
+		t.Errorf("expected an error for the missing trusted list of DE")
+	}
+	if len(anchors) != 1 {
+		t.Fatalf("expected 1 trust anchor of the CA and none of the TSA, got %d", len(anchors))
+	}
+
+	anchor := anchors[0]
+	if !anchor.Certificate.Equal(ca) {
+		t.Errorf("expected the certificate of the service")
+	}
+	want := TrustAnchor{
+		Certificate: anchor.Certificate,
+		Source:      "eutl",
+		Territory:   "BE",
+		Provider:    "Test Provider",
+		ServiceName: "Test Qualified CA",
+		ServiceType: ServiceTypeCAQC,
+		Qualifiers: []string{
+			"http://uri.etsi.org/TrstSvc/TrustedList/SvcInfoExt/QCWithQSCD",
+			"http://uri.etsi.org/TrstSvc/TrustedList/SvcInfoExt/ForeSignatures",
+		},
+		StatusHistory: []TrustServiceStatus{
+			{Status: ServiceStatusWithdrawn, Since: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+			{Status: ServiceStatusGranted, Since: time.Date(2016, 6, 30, 22, 0, 0, 0, time.UTC)},
+		},
+	}
+	if !reflect.DeepEqual(anchor, want) {
+		t.Errorf("expected trust anchor %+v, got %+v", want, anchor)
+	}
+
+	// The anchors are kept until the next update of the lists
+	count := requests.Load()
+	if _, err := provider.TrustAnchors(context.Background()); err == nil {
+		t.Errorf("expected the error of the missing list to be kept")
+	}
+	if requests.Load() != count {
+		t.Errorf("expected no downloads for cached trust anchors")
+	}
+
+	// The lists are shared through the cache
+	if cache.Get("tsl/"+server.URL+"/be.xml") == nil {
+		t.Errorf("expected the trusted list to be cached")
+	}
+	other := &EUTLProvider{URL: server.URL + "/lotl.xml", Cache: cache, Territories: []string{"BE"}, HTTPClient: server.Client()}
+	anchors, err = other.TrustAnchors(context.Background())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if len(anchors) != 1 {
+		t.Errorf("expected 1 trust anchor, got %d", len(anchors))
+	}
+	if requests.Load() != count {
+		t.Errorf("expected the lists to be read from the cache")
+	}
+}
+
+func TestEUTLProviderSignatures(t *testing.T) {
+	other, otherKey := newTestCRLIssuer(t, "pdfsign Other Signer")
+
+	tests := []struct {
+		name    string
+		modify  func(server *testEUTL)
+		pinned  func(server *testEUTL) *x509.Certificate
+		anchors int
+	}{
+		{name: "signed", anchors: 1},
+		{name: "pinned LOTL certificate", pinned: func(s *testEUTL) *x509.Certificate { return s.lotlSigner }, anchors: 1},
+		{name: "other LOTL certificate", pinned: func(*testEUTL) *x509.Certificate { return other }},
+		{name: "modified LOTL", modify: func(s *testEUTL) {
+			s.lists["/lotl.xml"] = bytes.Replace(s.lists["/lotl.xml"], []byte("/be.xml"), []byte("/de.xml"), 1)
+		}},
+		{name: "modified trusted list", modify: func(s *testEUTL) {
+			s.lists["/be.xml"] = bytes.Replace(s.lists["/be.xml"], []byte("Svcstatus/withdrawn"), []byte("Svcstatus/granted"), 1)
+		}},
+		{name: "trusted list of another signer", modify: func(s *testEUTL) {
+			list := bytes.Split(s.lists["/be.xml"], []byte("<ds:Signature"))[0]
+			s.lists["/be.xml"] = signTestXML(t, string(list)+"</tsl:TrustServiceStatusList>", otherKey)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestEUTL(t)
+			if tt.modify != nil {
+				tt.modify(server)
+			}
+			provider := &EUTLProvider{URL: server.URL + "/lotl.xml", Territories: []string{"BE"}, HTTPClient: server.Client()}
+			if tt.pinned != nil {
+				provider.LOTLCertificates = []*x509.Certificate{tt.pinned(server)}
+			}
+			anchors, err := provider.TrustAnchors(context.Background())
+			if len(anchors) != tt.anchors {
+				t.Errorf("expected %d trust anchors, got %d", tt.anchors, len(anchors))
+			}
+			if (err != nil) != (tt.anchors == 0) {
+				t.Errorf("expected an error %t, got %v", tt.anchors == 0, err)
+			}
+		})
+	}
+
+	// Lists in the cache are verified as well
+	server := newTestEUTL(t)
+	cache := NewMemoryRevocationCache()
+	provider := &EUTLProvider{URL: server.URL + "/lotl.xml", Territories: []string{"BE"}, Cache: cache, HTTPClient: server.Client()}
+	stored := bytes.Replace(server.lists["/be.xml"], []byte("Svcstatus/withdrawn"), []byte("Svcstatus/granted"), 1)
+	_ = cache.Put("tsl/"+server.URL+"/be.xml", stored, time.Now().Add(time.Hour))
+	anchors, err := provider.TrustAnchors(context.Background())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if len(anchors) != 1 || anchors[0].StatusHistory[0].Status != ServiceStatusWithdrawn {
+		t.Errorf("expected the signed trusted list instead of the modified list of the cache, got %+v", anchors)
+	}
+}
+
+func TestEUTLProviderUnavailable(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+
+	provider := &EUTLProvider{URL: server.URL + "/lotl.xml", HTTPClient: server.Client()}
+	if _, err := provider.TrustAnchors(context.Background()); err == nil {
+		t.Errorf("expected an error for a missing LOTL")
+	}
+}
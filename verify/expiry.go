@@ -0,0 +1,47 @@
+package verify
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+
+	"github.com/digitorus/pdfsign/revocation"
+	"golang.org/x/crypto/ocsp"
+)
+
+// acceptExpiredCertificate checks the expired certificate c that was valid at
+// the time proven by the timestamp of signer. As the status of expired
+// certificates is no longer published, it is only accepted with revocation
+// data in revInfo that issuer produced while it was valid. Roots need no
+// revocation data.
+func acceptExpiredCertificate(c *Certificate, issuer *x509.Certificate, revInfo revocation.InfoArchival, signer *Signer) {
+	cert := c.Certificate
+	if !bytes.Equal(cert.RawIssuer, cert.RawSubject) && (issuer == nil || !hasRevocationDataDuringValidity(cert, issuer, revInfo)) {
+		c.ExpiryError = fmt.Sprintf("certificate expired at %v without revocation data from its validity period", cert.NotAfter)
+		return
+	}
+	signer.TimeWarnings = append(signer.TimeWarnings,
+		fmt.Sprintf("Certificate %s expired at %v, accepted as the timestamp proves the signature existed before", cert.Subject, cert.NotAfter))
+}
+
+// hasRevocationDataDuringValidity reports whether revInfo has an OCSP
+// response for cert or a CRL of issuer, signed by issuer, that was produced
+// between the start and end of the validity of cert.
+func hasRevocationDataDuringValidity(cert, issuer *x509.Certificate, revInfo revocation.InfoArchival) bool {
+	for _, o := range revInfo.OCSP {
+		resp, err := ocsp.ParseResponseForCert(o.FullBytes, cert, issuer)
+		if err == nil && !resp.ThisUpdate.Before(cert.NotBefore) && !resp.ThisUpdate.After(cert.NotAfter) {
+			return true
+		}
+	}
+	for _, c := range revInfo.CRL {
+		crl, err := x509.ParseRevocationList(c.FullBytes)
+		if err != nil || !bytes.Equal(crl.RawIssuer, issuer.RawSubject) || crl.CheckSignatureFrom(issuer) != nil {
+			continue
+		}
+		if !crl.ThisUpdate.Before(cert.NotBefore) && !crl.ThisUpdate.After(cert.NotAfter) {
+			return true
+		}
+	}
+	return false
+}
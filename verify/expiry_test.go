@@ -0,0 +1,85 @@
+package verify
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdfsign/revocation"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestAcceptExpiredCertificate(t *testing.T) {
+	issuer, issuerKey := newTestCRLIssuer(t, "pdfsign Test CA")
+	now := time.Now()
+
+	expired, _ := newTestLeaf(t, issuer, issuerKey, 2, func(template *x509.Certificate) {
+		template.Subject = pkix.Name{CommonName: "pdfsign Expired Signer"}
+		template.NotBefore = now.Add(-48 * time.Hour)
+		template.NotAfter = now.Add(-24 * time.Hour)
+		template.KeyUsage = 0
+	})
+
+	ocspAt := func(thisUpdate time.Time) revocation.InfoArchival {
+		resp, err := ocsp.CreateResponse(issuer, issuer, ocsp.Response{
+			Status:       ocsp.Good,
+			SerialNumber: expired.SerialNumber,
+			ThisUpdate:   thisUpdate,
+		}, issuerKey)
+		if err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+		var revInfo revocation.InfoArchival
+		if err := revInfo.AddOCSP(resp); err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+		return revInfo
+	}
+	crlAt := func(thisUpdate time.Time) revocation.InfoArchival {
+		crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+			Number:     big.NewInt(1),
+			ThisUpdate: thisUpdate,
+			NextUpdate: thisUpdate.Add(time.Hour),
+		}, issuer, issuerKey)
+		if err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+		var revInfo revocation.InfoArchival
+		if err := revInfo.AddCRL(crl); err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+		return revInfo
+	}
+
+	tests := []struct {
+		name     string
+		issuer   *x509.Certificate
+		revInfo  revocation.InfoArchival
+		accepted bool
+	}{
+		{name: "OCSP response during validity", issuer: issuer, revInfo: ocspAt(now.Add(-30 * time.Hour)), accepted: true},
+		{name: "CRL during validity", issuer: issuer, revInfo: crlAt(now.Add(-30 * time.Hour)), accepted: true},
+		{name: "OCSP response after expiry", issuer: issuer, revInfo: ocspAt(now.Add(-time.Hour))},
+		{name: "CRL after expiry", issuer: issuer, revInfo: crlAt(now.Add(-time.Hour))},
+		{name: "no revocation data", issuer: issuer},
+		{name: "unknown issuer", revInfo: ocspAt(now.Add(-30 * time.Hour))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Certificate{Certificate: expired, Expired: true}
+			signer := &Signer{}
+			acceptExpiredCertificate(&c, tt.issuer, tt.revInfo, signer)
+			if accepted := c.ExpiryError == ""; accepted != tt.accepted {
+				t.Errorf("expected accepted %t, got expiry error %q", tt.accepted, c.ExpiryError)
+			}
+			if tt.accepted && (len(signer.TimeWarnings) != 1 || !strings.Contains(signer.TimeWarnings[0], "accepted as the timestamp proves")) {
+				t.Errorf("expected a warning about the expired certificate, got %q", signer.TimeWarnings)
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/ocsp"
@@ -14,6 +15,19 @@ import (
 // OCSPRequestFunc allows mocking OCSP request creation for tests
 type OCSPRequestFunc func(cert, issuer *x509.Certificate) ([]byte, error)
 
+// httpClient returns the client of external revocation checks, the
+// HTTPClient of the options or a client with their HTTPTimeout.
+func (options *VerifyOptions) httpClient() *http.Client {
+	if options.HTTPClient != nil {
+		return options.HTTPClient
+	}
+	timeout := options.HTTPTimeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	return &http.Client{Timeout: timeout}
+}
+
 // performExternalOCSPCheck performs an external OCSP check for the given certificate
 func performExternalOCSPCheck(cert, issuer *x509.Certificate, options *VerifyOptions) (*ocsp.Response, error) {
 	return performExternalOCSPCheckWithFunc(cert, issuer, options, nil)
@@ -21,14 +35,31 @@ func performExternalOCSPCheck(cert, issuer *x509.Certificate, options *VerifyOpt
 
 // performExternalOCSPCheckWithFunc allows injecting a custom OCSP request function for testing
 func performExternalOCSPCheckWithFunc(cert, issuer *x509.Certificate, options *VerifyOptions, ocspRequestFunc OCSPRequestFunc) (*ocsp.Response, error) {
-	if !options.EnableExternalRevocationCheck {
+	if !options.EnableExternalRevocationCheck && options.RevocationBundle == nil {
 		return nil, fmt.Errorf("external revocation checking is disabled")
 	}
 
+	// A response of the revocation bundle is used without a request, which
+	// is not made at all offline
+	if options.RevocationBundle != nil {
+		resp, err := options.RevocationBundle.ocspResponse(cert, issuer, options.validationTime())
+		if err == nil || !options.EnableExternalRevocationCheck {
+			return resp, err
+		}
+	}
+
 	if len(cert.OCSPServer) == 0 {
 		return nil, fmt.Errorf("certificate has no OCSP server URLs")
 	}
 
+	// Use a cached response until its next update
+	cacheKey := ocspCacheKey(cert, issuer)
+	if cached := options.cachedRevocationData(cacheKey); cached != nil {
+		if ocspResp, err := ocsp.ParseResponseForCert(cached, cert, issuer); err == nil && ocspResp.NextUpdate.After(time.Now()) {
+			return ocspResp, nil
+		}
+	}
+
 	// Create OCSP request (use injected func if provided)
 	var ocspReq []byte
 	var err error
@@ -41,20 +72,18 @@ func performExternalOCSPCheckWithFunc(cert, issuer *x509.Certificate, options *V
 		return nil, fmt.Errorf("failed to create OCSP request: %v", err)
 	}
 
-	// Get HTTP client with timeout
-	client := options.HTTPClient
-	if client == nil {
-		timeout := options.HTTPTimeout
-		if timeout == 0 {
-			timeout = 10 * time.Second
-		}
-		client = &http.Client{Timeout: timeout}
-	}
+	client := options.httpClient()
 
 	// Try each OCSP server URL
 	var lastErr error
 	for _, serverURL := range cert.OCSPServer {
-		resp, err := client.Post(serverURL, "application/ocsp-request", bytes.NewReader(ocspReq))
+		req, err := http.NewRequestWithContext(options.requestContext(), http.MethodPost, serverURL, bytes.NewReader(ocspReq))
+		if err != nil {
+			lastErr = fmt.Errorf("failed to create OCSP request for %s: %v", serverURL, err)
+			continue
+		}
+		req.Header.Set("Content-Type", "application/ocsp-request")
+		resp, err := client.Do(req)
 		if err != nil {
 			lastErr = fmt.Errorf("failed to contact OCSP server %s: %v", serverURL, err)
 			continue
@@ -77,13 +106,16 @@ func performExternalOCSPCheckWithFunc(cert, issuer *x509.Certificate, options *V
 			continue
 		}
 
-		ocspResp, err := ocsp.ParseResponse(body, issuer)
+		// The response must be about this certificate and signed by its
+		// issuer or a responder it delegated to.
+		ocspResp, err := ocsp.ParseResponseForCert(body, cert, issuer)
 		if err != nil {
 			lastErr = fmt.Errorf("failed to parse OCSP response from %s: %v", serverURL, err)
 			continue
 		}
 
 		// Successfully got OCSP response
+		options.cacheRevocationData(cacheKey, body, ocspResp.NextUpdate)
 		return ocspResp, nil
 	}
 
@@ -91,57 +123,95 @@ func performExternalOCSPCheckWithFunc(cert, issuer *x509.Certificate, options *V
 }
 
 // performExternalCRLCheck performs an external CRL check for the given certificate
+// The CRL must be issued and signed by issuer and not have expired
 // Returns (revocationTime, isRevoked, error)
-func performExternalCRLCheck(cert *x509.Certificate, options *VerifyOptions) (*time.Time, bool, error) {
-	if !options.EnableExternalRevocationCheck {
+func performExternalCRLCheck(cert, issuer *x509.Certificate, options *VerifyOptions) (*time.Time, bool, error) {
+	if !options.EnableExternalRevocationCheck && options.RevocationBundle == nil {
 		return nil, false, fmt.Errorf("external revocation checking is disabled")
 	}
 
+	if options.RevocationBundle != nil {
+		revocationTime, revoked, err := options.RevocationBundle.crlStatus(cert, issuer, options.validationTime())
+		if err == nil || !options.EnableExternalRevocationCheck {
+			return revocationTime, revoked, err
+		}
+	}
+
 	if len(cert.CRLDistributionPoints) == 0 {
 		return nil, false, fmt.Errorf("certificate has no CRL distribution points")
 	}
 
-	// Get HTTP client with timeout
-	client := options.HTTPClient
-	if client == nil {
-		timeout := options.HTTPTimeout
-		if timeout == 0 {
-			timeout = 10 * time.Second
-		}
-		client = &http.Client{Timeout: timeout}
+	if issuer == nil {
+		return nil, false, fmt.Errorf("issuer certificate not found")
 	}
 
+	client := options.httpClient()
+
 	// Try each CRL distribution point
 	var lastErr error
 	for _, crlURL := range cert.CRLDistributionPoints {
-		resp, err := client.Get(crlURL)
-		if err != nil {
-			lastErr = fmt.Errorf("failed to download CRL from %s: %v", crlURL, err)
+		// Distribution points can also be LDAP URLs
+		if !strings.HasPrefix(crlURL, "http://") && !strings.HasPrefix(crlURL, "https://") {
+			lastErr = fmt.Errorf("unsupported CRL distribution point %s", crlURL)
 			continue
 		}
-		defer func() {
-			if err := resp.Body.Close(); err != nil {
-				// Log error but don't fail the operation
-				lastErr = fmt.Errorf("failed to close response body: %v", err)
+
+		// Use a cached CRL, it is validated like a downloaded one
+		cacheKey := crlCacheKey(crlURL)
+		body := options.cachedRevocationData(cacheKey)
+		cached := body != nil
+		if !cached {
+			req, err := http.NewRequestWithContext(options.requestContext(), http.MethodGet, crlURL, nil)
+			if err != nil {
+				lastErr = fmt.Errorf("failed to create CRL request for %s: %v", crlURL, err)
+				continue
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				lastErr = fmt.Errorf("failed to download CRL from %s: %v", crlURL, err)
+				continue
+			}
+			defer func() {
+				if err := resp.Body.Close(); err != nil {
+					// Log error but don't fail the operation
+					lastErr = fmt.Errorf("failed to close response body: %v", err)
+				}
+			}()
+
+			if resp.StatusCode != http.StatusOK {
+				lastErr = fmt.Errorf("CRL server %s returned status %d", crlURL, resp.StatusCode)
+				continue
 			}
-		}()
 
-		if resp.StatusCode != http.StatusOK {
-			lastErr = fmt.Errorf("CRL server %s returned status %d", crlURL, resp.StatusCode)
-			continue
+			body, err = io.ReadAll(resp.Body)
+			if err != nil {
+				lastErr = fmt.Errorf("failed to read CRL from %s: %v", crlURL, err)
+				continue
+			}
 		}
 
-		body, err := io.ReadAll(resp.Body)
+		crl, err := x509.ParseRevocationList(body)
 		if err != nil {
-			lastErr = fmt.Errorf("failed to read CRL from %s: %v", crlURL, err)
+			lastErr = fmt.Errorf("failed to parse CRL from %s: %v", crlURL, err)
 			continue
 		}
 
-		crl, err := x509.ParseRevocationList(body)
-		if err != nil {
-			lastErr = fmt.Errorf("failed to parse CRL from %s: %v", crlURL, err)
+		// Validate the CRL against the issuing CA
+		if !bytes.Equal(crl.RawIssuer, issuer.RawSubject) {
+			lastErr = fmt.Errorf("CRL from %s is not issued by %s", crlURL, issuer.Subject)
 			continue
 		}
+		if err := crl.CheckSignatureFrom(issuer); err != nil {
+			lastErr = fmt.Errorf("invalid CRL signature from %s: %v", crlURL, err)
+			continue
+		}
+		if !crl.NextUpdate.IsZero() && crl.NextUpdate.Before(time.Now()) {
+			lastErr = fmt.Errorf("CRL from %s expired at %v", crlURL, crl.NextUpdate)
+			continue
+		}
+		if !cached {
+			options.cacheRevocationData(cacheKey, body, crl.NextUpdate)
+		}
 
 		// Check if certificate is revoked
 		for _, revokedCert := range crl.RevokedCertificateEntries {
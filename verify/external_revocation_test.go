@@ -1,10 +1,16 @@
 package verify
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
@@ -130,6 +136,29 @@ func TestPerformExternalOCSPCheck(t *testing.T) {
 			expectError:   true,
 			errorContains: "failed to parse OCSP response",
 		},
+		{
+			name: "Canceled context",
+			setupServer: func() *httptest.Server {
+				return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusOK)
+				}))
+			},
+			setupOptions: func(serverURL string) *VerifyOptions {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return &VerifyOptions{
+					EnableExternalRevocationCheck: true,
+					Context:                       ctx,
+				}
+			},
+			setupCert: func(serverURL string) *x509.Certificate {
+				testCert := *cert
+				testCert.OCSPServer = []string{serverURL}
+				return &testCert
+			},
+			expectError:   true,
+			errorContains: "context canceled",
+		},
 	}
 
 	for _, tt := range tests {
@@ -171,12 +200,125 @@ func TestPerformExternalOCSPCheck(t *testing.T) {
 	}
 }
 
+// newTestCRLIssuer returns a self-signed CA certificate and its key that
+// sign CRLs.
+func newTestCRLIssuer(t *testing.T, name string) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	return certificate, key
+}
+
+// newTestLeaf returns a certificate with the serial issued by issuer, for
+// digital signatures and valid from an hour ago to an hour from now, and its
+// key. tweak, if not nil, changes the template before it is issued.
+func newTestLeaf(t *testing.T, issuer *x509.Certificate, issuerKey *ecdsa.PrivateKey, serial int64, tweak func(*x509.Certificate)) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "pdfsign Test Signer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	if tweak != nil {
+		tweak(template)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, issuerKey)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	return certificate, key
+}
+
+// newTestCRL returns a CRL of issuer that revokes the serials and expires at
+// nextUpdate.
+func newTestCRL(t *testing.T, issuer *x509.Certificate, key *ecdsa.PrivateKey, nextUpdate time.Time, serials ...int64) []byte {
+	t.Helper()
+
+	var entries []x509.RevocationListEntry
+	for _, serial := range serials {
+		entries = append(entries, x509.RevocationListEntry{
+			SerialNumber:   big.NewInt(serial),
+			RevocationTime: time.Now().Add(-time.Hour),
+		})
+	}
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:                    big.NewInt(1),
+		ThisUpdate:                time.Now().Add(-time.Hour),
+		NextUpdate:                nextUpdate,
+		RevokedCertificateEntries: entries,
+	}, issuer, key)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	return crl
+}
+
+// crlServer returns a handler that serves crl.
+func crlServer(crl []byte) func() *httptest.Server {
+	return func() *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write(crl)
+		}))
+	}
+}
+
 func TestPerformExternalCRLCheck(t *testing.T) {
 	// Create a test certificate with CRL distribution points
 	cert := &x509.Certificate{
 		SerialNumber: big.NewInt(12345),
 	}
 
+	issuer, issuerKey := newTestCRLIssuer(t, "pdfsign Test CRL Issuer")
+	other, otherKey := newTestCRLIssuer(t, "pdfsign Test Other CRL Issuer")
+	// A CA with the name of the issuer but another key.
+	impostor, impostorKey := newTestCRLIssuer(t, "pdfsign Test CRL Issuer")
+	externalOptions := func(serverURL string) *VerifyOptions {
+		return &VerifyOptions{
+			EnableExternalRevocationCheck: true,
+		}
+	}
+	distributionPoints := func(urls ...string) func(serverURL string) *x509.Certificate {
+		return func(serverURL string) *x509.Certificate {
+			testCert := *cert
+			testCert.CRLDistributionPoints = nil
+			for _, url := range urls {
+				testCert.CRLDistributionPoints = append(testCert.CRLDistributionPoints, strings.ReplaceAll(url, "SERVER", serverURL))
+			}
+			return &testCert
+		}
+	}
+
 	tests := []struct {
 		name          string
 		setupServer   func() *httptest.Server
@@ -185,6 +327,7 @@ func TestPerformExternalCRLCheck(t *testing.T) {
 		expectError   bool
 		errorContains string
 		expectRevoked bool
+		noIssuer      bool
 	}{
 		{
 			name: "External revocation disabled",
@@ -214,6 +357,14 @@ func TestPerformExternalCRLCheck(t *testing.T) {
 			expectError:   true,
 			errorContains: "certificate has no CRL distribution points",
 		},
+		{
+			name:          "No issuer certificate",
+			setupOptions:  externalOptions,
+			setupCert:     distributionPoints("http://crl.example.com/ca.crl"),
+			noIssuer:      true,
+			expectError:   true,
+			errorContains: "issuer certificate not found",
+		},
 		{
 			name: "CRL server returns error status",
 			setupServer: func() *httptest.Server {
@@ -304,6 +455,80 @@ func TestPerformExternalCRLCheck(t *testing.T) {
 			expectError:   true,
 			errorContains: "failed to parse CRL",
 		},
+		{
+			name: "Canceled context",
+			setupServer: func() *httptest.Server {
+				return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusOK)
+				}))
+			},
+			setupOptions: func(serverURL string) *VerifyOptions {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return &VerifyOptions{
+					EnableExternalRevocationCheck: true,
+					Context:                       ctx,
+				}
+			},
+			setupCert: func(serverURL string) *x509.Certificate {
+				testCert := *cert
+				testCert.CRLDistributionPoints = []string{serverURL}
+				return &testCert
+			},
+			expectError:   true,
+			errorContains: "context canceled",
+		},
+		{
+			name:         "Valid CRL without the certificate",
+			setupServer:  crlServer(newTestCRL(t, issuer, issuerKey, time.Now().Add(time.Hour), 1)),
+			setupOptions: externalOptions,
+			setupCert:    distributionPoints("SERVER"),
+		},
+		{
+			name:          "Valid CRL revoking the certificate",
+			setupServer:   crlServer(newTestCRL(t, issuer, issuerKey, time.Now().Add(time.Hour), 12345)),
+			setupOptions:  externalOptions,
+			setupCert:     distributionPoints("SERVER"),
+			expectRevoked: true,
+		},
+		{
+			name:          "CRL of another issuer",
+			setupServer:   crlServer(newTestCRL(t, other, otherKey, time.Now().Add(time.Hour), 12345)),
+			setupOptions:  externalOptions,
+			setupCert:     distributionPoints("SERVER"),
+			expectError:   true,
+			errorContains: "is not issued by",
+		},
+		{
+			name:          "CRL with an invalid signature",
+			setupServer:   crlServer(newTestCRL(t, impostor, impostorKey, time.Now().Add(time.Hour))),
+			setupOptions:  externalOptions,
+			setupCert:     distributionPoints("SERVER"),
+			expectError:   true,
+			errorContains: "invalid CRL signature",
+		},
+		{
+			name:          "Expired CRL",
+			setupServer:   crlServer(newTestCRL(t, issuer, issuerKey, time.Now().Add(-time.Minute))),
+			setupOptions:  externalOptions,
+			setupCert:     distributionPoints("SERVER"),
+			expectError:   true,
+			errorContains: "expired",
+		},
+		{
+			name:          "LDAP distribution point",
+			setupOptions:  externalOptions,
+			setupCert:     distributionPoints("ldap://ldap.example.com/cn=CRL"),
+			expectError:   true,
+			errorContains: "unsupported CRL distribution point",
+		},
+		{
+			name:          "LDAP distribution point before HTTP",
+			setupServer:   crlServer(newTestCRL(t, issuer, issuerKey, time.Now().Add(time.Hour), 12345)),
+			setupOptions:  externalOptions,
+			setupCert:     distributionPoints("ldap://ldap.example.com/cn=CRL", "SERVER"),
+			expectRevoked: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -320,7 +545,11 @@ func TestPerformExternalCRLCheck(t *testing.T) {
 			options := tt.setupOptions(serverURL)
 			testCert := tt.setupCert(serverURL)
 
-			revocationTime, isRevoked, err := performExternalCRLCheck(testCert, options)
+			crlIssuer := issuer
+			if tt.noIssuer {
+				crlIssuer = nil
+			}
+			revocationTime, isRevoked, err := performExternalCRLCheck(testCert, crlIssuer, options)
 
 			if tt.expectError {
 				if err == nil {
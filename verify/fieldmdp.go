@@ -0,0 +1,102 @@
+package verify
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/digitorus/pdf"
+)
+
+// signatureFieldLocks returns the field locks of the signature dictionary v:
+// the FieldMDP transforms of its references and the lock dictionary of its
+// signature field in the AcroForm of the catalog root.
+func signatureFieldLocks(v, root pdf.Value) []FieldLock {
+	var locks []FieldLock
+	add := func(params pdf.Value) {
+		lock := FieldLock{Action: params.Key("Action").Name()}
+		if lock.Action == "" {
+			return
+		}
+		fields := params.Key("Fields")
+		for i := 0; i < fields.Len(); i++ {
+			lock.Fields = append(lock.Fields, fields.Index(i).Text())
+		}
+		// The lock dictionary usually repeats the FieldMDP transform.
+		for _, l := range locks {
+			if l.Action == lock.Action && slices.Equal(l.Fields, lock.Fields) {
+				return
+			}
+		}
+		locks = append(locks, lock)
+	}
+
+	reference := v.Key("Reference")
+	for i := 0; i < reference.Len(); i++ {
+		if reference.Index(i).Key("TransformMethod").Name() == "FieldMDP" {
+			add(reference.Index(i).Key("TransformParams"))
+		}
+	}
+	if field := signatureField(root.Key("AcroForm").Key("Fields"), v, 0); !field.IsNull() {
+		add(field.Key("Lock"))
+	}
+	return locks
+}
+
+// signatureField returns the signature field in fields, or their kids, with
+// the signature dictionary v as value, depth is the level in the field
+// hierarchy.
+func signatureField(fields, v pdf.Value, depth int) pdf.Value {
+	if depth > 32 {
+		return pdf.Value{}
+	}
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Index(i)
+		if value := field.Key("V"); value.Kind() == pdf.Dict && value.GetPtr() == v.GetPtr() {
+			return field
+		}
+		if kid := signatureField(field.Key("Kids"), v, depth+1); !kid.IsNull() {
+			return kid
+		}
+	}
+	return pdf.Value{}
+}
+
+// locks reports whether the lock applies to the field with the fully
+// qualified name, which includes the descendants of the named fields.
+func (lock FieldLock) locks(name string) bool {
+	named := slices.ContainsFunc(lock.Fields, func(field string) bool {
+		return name == field || strings.HasPrefix(name, field+".")
+	})
+	switch lock.Action {
+	case "All":
+		return true
+	case "Include":
+		return named
+	case "Exclude":
+		return !named
+	}
+	return false
+}
+
+// checkFieldMDP records the changes of form fields after each signature that
+// its field locks do not permit. New fields are not locked.
+func checkFieldMDP(signers []Signer) {
+	for i := range signers {
+		s := &signers[i]
+		for _, m := range s.Modifications {
+			if m.Field == "" || m.Added {
+				continue
+			}
+			for _, lock := range s.FieldLocks {
+				if lock.locks(m.Field) {
+					s.FieldMDPViolations = append(s.FieldMDPViolations, fmt.Sprintf("locked field %q modified after signing", m.Field))
+					break
+				}
+			}
+		}
+		if len(s.FieldMDPViolations) > 0 {
+			s.DisallowedModifications = true
+		}
+	}
+}
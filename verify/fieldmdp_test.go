@@ -0,0 +1,120 @@
+package verify
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/digitorus/pdf"
+)
+
+func TestSignatureFieldLocks(t *testing.T) {
+	transform := "<< /Type /Sig /Reference [<< /TransformMethod /FieldMDP /TransformParams << /Action /Include /Fields [(Name) (Date)] >> >>] >>"
+
+	tests := []struct {
+		name      string
+		field     string
+		signature string
+		want      []FieldLock
+	}{
+		{
+			name:      "FieldMDP transform",
+			field:     "<< /FT /Sig /T (Signature1) /V 2 0 R >>",
+			signature: transform,
+			want:      []FieldLock{{Action: "Include", Fields: []string{"Name", "Date"}}},
+		},
+		{
+			name:      "same lock dictionary",
+			field:     "<< /FT /Sig /T (Signature1) /V 2 0 R /Lock << /Type /SigFieldLock /Action /Include /Fields [(Name) (Date)] >> >>",
+			signature: transform,
+			want:      []FieldLock{{Action: "Include", Fields: []string{"Name", "Date"}}},
+		},
+		{
+			name:      "lock dictionary",
+			field:     "<< /FT /Sig /T (Signature1) /V 2 0 R /Lock << /Type /SigFieldLock /Action /All >> >>",
+			signature: transform,
+			want: []FieldLock{
+				{Action: "Include", Fields: []string{"Name", "Date"}},
+				{Action: "All"},
+			},
+		},
+		{
+			name:      "no locks",
+			field:     "<< /FT /Sig /T (Signature1) /V 2 0 R >>",
+			signature: "<< /Type /Sig >>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			document, _ := appendRevision([]byte("%PDF-1.7\n"), 0, map[int]string{
+				1: "<< /Type /Catalog /AcroForm << /Fields [3 0 R] /SigFlags 3 >> >>",
+				2: tt.signature,
+				3: tt.field,
+			})
+			rdr, err := pdf.NewReader(bytes.NewReader(document), int64(len(document)))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			ptr := rdr.Xref()[2].Ptr()
+			locks := signatureFieldLocks(rdr.Resolve(ptr, ptr), rdr.Trailer().Key("Root"))
+			if !reflect.DeepEqual(locks, tt.want) {
+				t.Errorf("expected locks %v, got %v", tt.want, locks)
+			}
+		})
+	}
+}
+
+func TestCheckFieldMDP(t *testing.T) {
+	modifications := []Modification{
+		{Type: "form_fill", Object: "10 0 R", Description: "form field", Field: "Address.Street"},
+		{Type: "signature", Object: "11 0 R", Description: "signature field", Field: "Signature2"},
+		// New fields are not locked.
+		{Type: "form_fill", Object: "12 0 R", Description: "form field", Field: "Comments", Added: true},
+	}
+
+	tests := []struct {
+		name           string
+		locks          []FieldLock
+		wantViolations []string
+	}{
+		{
+			name:  "all fields",
+			locks: []FieldLock{{Action: "All"}},
+			wantViolations: []string{
+				`locked field "Address.Street" modified after signing`,
+				`locked field "Signature2" modified after signing`,
+			},
+		},
+		{
+			name:           "included parent field",
+			locks:          []FieldLock{{Action: "Include", Fields: []string{"Address"}}},
+			wantViolations: []string{`locked field "Address.Street" modified after signing`},
+		},
+		{
+			name:           "excluded fields",
+			locks:          []FieldLock{{Action: "Exclude", Fields: []string{"Address", "Comments"}}},
+			wantViolations: []string{`locked field "Signature2" modified after signing`},
+		},
+		{
+			name:  "other fields",
+			locks: []FieldLock{{Action: "Include", Fields: []string{"Name", "Addresses"}}},
+		},
+		{
+			name: "no locks",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signers := []Signer{{FieldLocks: tt.locks, Modifications: modifications}}
+			checkFieldMDP(signers)
+			if !reflect.DeepEqual(signers[0].FieldMDPViolations, tt.wantViolations) {
+				t.Errorf("expected violations %q, got %q", tt.wantViolations, signers[0].FieldMDPViolations)
+			}
+			if signers[0].DisallowedModifications != (len(tt.wantViolations) > 0) {
+				t.Errorf("expected disallowed modifications %v", len(tt.wantViolations) > 0)
+			}
+		})
+	}
+}
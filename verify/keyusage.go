@@ -2,8 +2,17 @@ package verify
 
 import (
 	"crypto/x509"
+	"encoding/asn1"
+	"slices"
 )
 
+// OIDExtKeyUsageDocumentSigning is the Document Signing EKU of RFC 9336, which
+// crypto/x509 reports in UnknownExtKeyUsage.
+var OIDExtKeyUsageDocumentSigning = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 36}
+
+// oidExtensionExtKeyUsage identifies the Extended Key Usage extension.
+var oidExtensionExtKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37}
+
 // validateKeyUsage validates certificate Key Usage and Extended Key Usage for PDF signing
 // according to RFC 9336 and common industry practices
 func validateKeyUsage(cert *x509.Certificate, options *VerifyOptions) (kuValid bool, kuError string, ekuValid bool, ekuError string) {
@@ -27,14 +36,14 @@ func validateKeyUsage(cert *x509.Certificate, options *VerifyOptions) (kuValid b
 	}
 
 	// Validate Extended Key Usage
-	if len(cert.ExtKeyUsage) == 0 {
+	if len(cert.ExtKeyUsage) == 0 && len(cert.UnknownExtKeyUsage) == 0 {
 		ekuValid = false
 		ekuError = "certificate has no Extended Key Usage extension"
 		return
 	}
 
 	// Check if any required EKUs are present
-	hasRequiredEKU := false
+	hasRequiredEKU := hasExtKeyUsageOID(cert, options.RequiredEKUOIDs)
 	if len(options.RequiredEKUs) > 0 {
 		for _, requiredEKU := range options.RequiredEKUs {
 			for _, certEKU := range cert.ExtKeyUsage {
@@ -50,7 +59,7 @@ func validateKeyUsage(cert *x509.Certificate, options *VerifyOptions) (kuValid b
 	}
 
 	// Check if any allowed EKUs are present (fallback)
-	hasAllowedEKU := false
+	hasAllowedEKU := hasExtKeyUsageOID(cert, options.AllowedEKUOIDs)
 	if len(options.AllowedEKUs) > 0 {
 		for _, allowedEKU := range options.AllowedEKUs {
 			for _, certEKU := range cert.ExtKeyUsage {
@@ -72,7 +81,7 @@ func validateKeyUsage(cert *x509.Certificate, options *VerifyOptions) (kuValid b
 	} else if hasAllowedEKU {
 		// Has an allowed EKU but not a required one
 		ekuValid = true
-		if len(options.RequiredEKUs) > 0 {
+		if len(options.RequiredEKUs) > 0 || len(options.RequiredEKUOIDs) > 0 {
 			ekuError = "certificate uses acceptable but not preferred Extended Key Usage"
 		}
 	} else {
@@ -84,6 +93,35 @@ func validateKeyUsage(cert *x509.Certificate, options *VerifyOptions) (kuValid b
 	return
 }
 
+// extKeyUsageOIDs returns the OIDs of the Extended Key Usage extension of
+// cert, known to crypto/x509 or not, or only the UnknownExtKeyUsage of a
+// certificate that was not parsed.
+func extKeyUsageOIDs(cert *x509.Certificate) []asn1.ObjectIdentifier {
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidExtensionExtKeyUsage) {
+			var oids []asn1.ObjectIdentifier
+			if _, err := asn1.Unmarshal(ext.Value, &oids); err == nil {
+				return oids
+			}
+		}
+	}
+	return cert.UnknownExtKeyUsage
+}
+
+// hasExtKeyUsageOID reports whether cert has one of the Extended Key Usages
+// oids.
+func hasExtKeyUsageOID(cert *x509.Certificate, oids []asn1.ObjectIdentifier) bool {
+	if len(oids) == 0 {
+		return false
+	}
+	for _, eku := range extKeyUsageOIDs(cert) {
+		if slices.ContainsFunc(oids, eku.Equal) {
+			return true
+		}
+	}
+	return false
+}
+
 // getVerificationEKUs returns the appropriate Extended Key Usages for certificate verification
 // Includes Document Signing EKU and common alternatives (ExtKeyUsageAny removed as it makes others redundant)
 func getVerificationEKUs() []x509.ExtKeyUsage {
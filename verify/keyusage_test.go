@@ -1,10 +1,18 @@
 package verify
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
 	"testing"
 	"time"
 
+	"github.com/digitorus/pdfsign/revocation"
+	"github.com/digitorus/pkcs7"
 	"github.com/digitorus/timestamp"
 )
 
@@ -468,3 +476,94 @@ func TestSecurityConfigurationExamples(t *testing.T) {
 		}
 	})
 }
+
+func TestExtKeyUsageOIDs(t *testing.T) {
+	issuer, issuerKey := newTestCRLIssuer(t, "pdfsign Test CA")
+	custom := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}
+
+	newLeaf := func(ekus []x509.ExtKeyUsage, unknown []asn1.ObjectIdentifier) *x509.Certificate {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+		der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+			SerialNumber:       big.NewInt(10),
+			Subject:            pkix.Name{CommonName: "pdfsign Test Signer"},
+			NotBefore:          time.Now().Add(-time.Hour),
+			NotAfter:           time.Now().Add(time.Hour),
+			KeyUsage:           x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:        ekus,
+			UnknownExtKeyUsage: unknown,
+		}, issuer, &key.PublicKey, issuerKey)
+		if err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+		leaf, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+		return leaf
+	}
+
+	tests := []struct {
+		name      string
+		leaf      *x509.Certificate
+		modify    func(options *VerifyOptions)
+		expectEKU bool
+		ekuError  string
+	}{
+		{
+			name:      "document signing",
+			leaf:      newLeaf(nil, []asn1.ObjectIdentifier{OIDExtKeyUsageDocumentSigning}),
+			expectEKU: true,
+		},
+		{
+			name:      "unlisted OID",
+			leaf:      newLeaf(nil, []asn1.ObjectIdentifier{custom}),
+			expectEKU: false,
+			ekuError:  "certificate does not have suitable Extended Key Usage for PDF signing",
+		},
+		{
+			name:      "allowed OID",
+			leaf:      newLeaf(nil, []asn1.ObjectIdentifier{custom}),
+			modify:    func(options *VerifyOptions) { options.AllowedEKUOIDs = []asn1.ObjectIdentifier{custom} },
+			expectEKU: true,
+			ekuError:  "certificate uses acceptable but not preferred Extended Key Usage",
+		},
+		{
+			name: "required OID of a known EKU",
+			leaf: newLeaf([]x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection}, nil),
+			modify: func(options *VerifyOptions) {
+				options.RequiredEKUOIDs = []asn1.ObjectIdentifier{{1, 3, 6, 1, 5, 5, 7, 3, 4}}
+				options.AllowedEKUs = nil
+			},
+			expectEKU: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultVerifyOptions()
+			options.AllowUntrustedRoots = true
+			if tt.modify != nil {
+				tt.modify(options)
+			}
+
+			_, _, ekuValid, ekuError := validateKeyUsage(tt.leaf, options)
+			if ekuValid != tt.expectEKU || ekuError != tt.ekuError {
+				t.Errorf("expected EKU %v (%q), got %v (%q)", tt.expectEKU, tt.ekuError, ekuValid, ekuError)
+			}
+
+			// The chain of a certificate with an accepted EKU OID is valid,
+			// although crypto/x509 does not know the EKU.
+			signer := &Signer{}
+			p7 := &pkcs7.PKCS7{Certificates: []*x509.Certificate{tt.leaf, issuer}}
+			if _, err := buildCertificateChainsWithOptions(p7, signer, revocation.InfoArchival{}, nil, options); err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if c := signer.Certificates[0]; tt.expectEKU && c.VerifyError != "" {
+				t.Errorf("expected a valid chain, got %s", c.VerifyError)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package verify
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/digitorus/pdfsign/internal/linearization"
+)
+
+// checkLinearization returns the linearization of the document file of size
+// bytes with the revision ends and pages, or nil if the document is not
+// linearized. The incremental updates of signatures invalidate the
+// linearization of the document they are appended to.
+func checkLinearization(file io.ReaderAt, size int64, ends []int64, pages int) *Linearization {
+	d := linearization.Read(file, size)
+	if d == nil {
+		return nil
+	}
+	l := &Linearization{Length: d.Length, Valid: d.Valid(size)}
+	for _, end := range ends {
+		if end > d.Length {
+			l.Updates++
+		}
+	}
+	switch {
+	case l.Updates > 0:
+		l.Valid = false
+		l.Warning = fmt.Sprintf("the %d incremental updates after the linearized file of %d bytes invalidate its linearization, the document is read without fast web view", l.Updates, d.Length)
+	case !l.Valid:
+		l.Warning = fmt.Sprintf("the file has %d bytes instead of the %d bytes of the linearized file, the document is read without fast web view", size, d.Length)
+	case d.Pages != pages:
+		l.Valid = false
+		l.Warning = fmt.Sprintf("the linearization dictionary declares %d pages, the document has %d", d.Pages, pages)
+	}
+	return l
+}
@@ -0,0 +1,56 @@
+package verify
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCheckLinearization(t *testing.T) {
+	linearized := func(length, pages int) string {
+		return fmt.Sprintf("%%PDF-1.7\n4 0 obj\n<< /Linearized 1 /L %d /N %d >>\nendobj\n", length, pages)
+	}
+	document := linearized(1000, 1)
+	document += strings.Repeat(" ", 1000-len(document)-len("%%EOF\n")) + "%%EOF\n"
+
+	tests := []struct {
+		name     string
+		document string
+		ends     []int64
+		pages    int
+		want     *Linearization
+	}{
+		{"not linearized", "%PDF-1.7\n1 0 obj\n<< /Type /Catalog >>\nendobj\n", nil, 1, nil},
+		{"linearized", document, []int64{999}, 1, &Linearization{Length: 1000, Valid: true}},
+		{
+			name:     "signed",
+			document: document + strings.Repeat(" ", 500),
+			ends:     []int64{999, 1499},
+			pages:    1,
+			want: &Linearization{Length: 1000, Updates: 1,
+				Warning: "the 1 incremental updates after the linearized file of 1000 bytes invalidate its linearization, the document is read without fast web view"},
+		},
+		{
+			name:     "truncated",
+			document: document[:900],
+			pages:    1,
+			want: &Linearization{Length: 1000,
+				Warning: "the file has 900 bytes instead of the 1000 bytes of the linearized file, the document is read without fast web view"},
+		},
+		{
+			name:     "pages",
+			document: document,
+			ends:     []int64{999},
+			pages:    2,
+			want:     &Linearization{Length: 1000, Warning: "the linearization dictionary declares 1 pages, the document has 2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := checkLinearization(strings.NewReader(tt.document), int64(len(tt.document)), tt.ends, tt.pages)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,457 @@
+package verify
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/internal/xref"
+)
+
+// objectHeader matches the "id gen obj" header of an indirect object.
+var objectHeader = regexp.MustCompile(`\b(\d+)\s+(\d+)\s+obj\b`)
+
+// detectModifications analyzes the incremental updates that follow the signed
+// revision of each signer in the document rdr and reports the objects they
+// changed.
+func detectModifications(file io.ReaderAt, size int64, rdr *pdf.Reader, signers []Signer) {
+	var roles map[uint32]string
+	var pages map[uint32]pageObject
+	for i := range signers {
+		s := &signers[i]
+		end := s.RevisionEnd
+		if end <= 0 || end > size {
+			continue
+		}
+		appended := make([]byte, size-end)
+		if _, err := file.ReadAt(appended, end); err != nil && err != io.EOF {
+			s.ModificationError = fmt.Sprintf("failed to read the incremental updates: %v", err)
+			s.DisallowedModifications = true
+			continue
+		}
+		if len(bytes.TrimSpace(bytes.Trim(appended, "\x00"))) == 0 {
+			continue
+		}
+		s.ModifiedAfterSigning = true
+
+		if roles == nil {
+			roles, pages = objectRoles(rdr), pageObjects(rdr)
+		}
+		modifications, err := revisionModifications(file, end, rdr, appended, roles, pages)
+		if err != nil {
+			s.ModificationError = err.Error()
+			s.DisallowedModifications = true
+			continue
+		}
+		s.Modifications = modifications
+		for _, m := range modifications {
+			if m.Type == "content_change" {
+				s.DisallowedModifications = true
+			}
+		}
+	}
+}
+
+// revisionModifications compares the objects defined in appended, the
+// incremental updates after the revision that ends at end, with that
+// revision and classifies the changes.
+func revisionModifications(file io.ReaderAt, end int64, rdr *pdf.Reader, appended []byte, roles map[uint32]string, pages map[uint32]pageObject) (modifications []Modification, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			modifications = nil
+			err = fmt.Errorf("failed to compare the signed revision (%v)", r)
+		}
+	}()
+
+	signed, err := xref.NewReader(io.NewSectionReader(file, 0, end), end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the signed revision: %v", err)
+	}
+
+	xrefs := rdr.Xref()
+	updated := make(map[uint32]bool)
+	for _, m := range objectHeader.FindAllSubmatch(appended, -1) {
+		if id, err := strconv.ParseUint(string(m[1]), 10, 32); err == nil {
+			updated[uint32(id)] = true
+		}
+	}
+	// Objects in an object stream of the updates are changed as well.
+	for i := range xrefs {
+		stream, ptr := xrefs[i].Stream(), xrefs[i].Ptr()
+		if stream.GetID() != 0 && updated[stream.GetID()] {
+			updated[ptr.GetID()] = true
+		}
+	}
+
+	ids := make([]uint32, 0, len(updated))
+	for id := range updated {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(a, b int) bool { return ids[a] < ids[b] })
+
+	for _, id := range ids {
+		if int(id) >= len(xrefs) {
+			continue
+		}
+		ptr := xrefs[id].Ptr()
+		if ptr.GetID() != id {
+			continue
+		}
+		current := rdr.Resolve(ptr, ptr)
+		previous := signed.Resolve(ptr, ptr)
+		added := previous.IsNull()
+		// A revision may write the catalog as a new object, it is compared
+		// with the catalog of the signed revision.
+		if current.Key("Type").Name() == "Catalog" {
+			previous, added = signed.Trailer().Key("Root"), false
+		}
+		if current.IsNull() || !added && sameValue(previous, current) {
+			continue
+		}
+		if kind := classifyModification(previous, current, added, roles[id]); kind != "" {
+			m := Modification{
+				Type:        kind,
+				Object:      fmt.Sprintf("%d %d R", ptr.GetID(), ptr.GetGen()),
+				Description: describeObject(current, roles[id], pages[id], ptr.GetID(), ptr.GetGen()),
+				Added:       added,
+			}
+			if isFormField(current) {
+				m.Field = fieldName(current)
+			}
+			modifications = append(modifications, m)
+		}
+	}
+	return modifications, nil
+}
+
+// objectRoles returns the indirect objects of the document that are part of
+// the DSS, the document metadata, the interactive form dictionary or the
+// arrays of its fields and of the annotations of the pages, which have no
+// type to classify them by.
+func objectRoles(rdr *pdf.Reader) map[uint32]string {
+	roles := make(map[uint32]string)
+	root := rdr.Trailer().Key("Root")
+
+	markIndirect(roles, root, rdr.Trailer().Key("Info"), "metadata")
+	markIndirect(roles, root, root.Key("Metadata"), "metadata")
+
+	dss := root.Key("DSS")
+	markIndirect(roles, root, dss, "dss")
+	markTree(roles, dss, "dss", make(map[uint32]bool))
+
+	acroForm := root.Key("AcroForm")
+	markIndirect(roles, root, acroForm, "acroform")
+	markIndirect(roles, acroForm, acroForm.Key("Fields"), "structure")
+	for i := 1; i <= rdr.NumPage(); i++ {
+		page := rdr.Page(i).V
+		markIndirect(roles, page, page.Key("Annots"), "structure")
+	}
+	return roles
+}
+
+// pageObject is an object that belongs to a page of the document.
+type pageObject struct {
+	page int    // Number of the page, starting at 1
+	kind string // "page", "content stream" or "annotation"
+}
+
+// pageObjects returns the pages of the document and their content streams
+// and annotations, by object number.
+func pageObjects(rdr *pdf.Reader) map[uint32]pageObject {
+	objects := make(map[uint32]pageObject)
+	add := func(parent, v pdf.Value, object pageObject) {
+		ptr := v.GetPtr()
+		if v.IsNull() || ptr == parent.GetPtr() {
+			return
+		}
+		if _, ok := objects[ptr.GetID()]; !ok {
+			objects[ptr.GetID()] = object
+		}
+	}
+
+	for i := 1; i <= rdr.NumPage(); i++ {
+		page := rdr.Page(i).V
+		ptr := page.GetPtr()
+		objects[ptr.GetID()] = pageObject{page: i, kind: "page"}
+
+		contents := page.Key("Contents")
+		if contents.Kind() == pdf.Array {
+			for j := 0; j < contents.Len(); j++ {
+				add(contents, contents.Index(j), pageObject{page: i, kind: "content stream"})
+			}
+		} else {
+			add(page, contents, pageObject{page: i, kind: "content stream"})
+		}
+
+		annots := page.Key("Annots")
+		for j := 0; j < annots.Len(); j++ {
+			add(annots, annots.Index(j), pageObject{page: i, kind: "annotation"})
+		}
+	}
+	return objects
+}
+
+// describeObject returns a description of the changed object current, such
+// as "page 3 content stream", for reports.
+func describeObject(current pdf.Value, role string, page pageObject, id uint32, gen uint16) string {
+	if page.page != 0 {
+		if page.kind == "page" {
+			return fmt.Sprintf("page %d", page.page)
+		}
+		return fmt.Sprintf("page %d %s", page.page, page.kind)
+	}
+	switch role {
+	case "dss":
+		return "DSS"
+	case "metadata":
+		return "document metadata"
+	}
+
+	switch current.Key("Type").Name() {
+	case "Catalog":
+		return "catalog"
+	case "Pages":
+		return "page tree"
+	case "Sig":
+		return "signature dictionary"
+	case "DocTimeStamp":
+		return "document timestamp dictionary"
+	case "DSS":
+		return "DSS"
+	case "Metadata":
+		return "document metadata"
+	}
+	switch {
+	case current.Key("FT").Name() == "Sig":
+		return "signature field"
+	case !current.Key("FT").IsNull():
+		return "form field"
+	}
+	return fmt.Sprintf("object %d %d R", id, gen)
+}
+
+// markIndirect records role for v when it is an indirect object and not a
+// direct value of parent.
+func markIndirect(roles map[uint32]string, parent, v pdf.Value, role string) {
+	ptr := v.GetPtr()
+	if v.IsNull() || ptr == parent.GetPtr() {
+		return
+	}
+	if _, ok := roles[ptr.GetID()]; !ok {
+		roles[ptr.GetID()] = role
+	}
+}
+
+// markTree records role for the indirect objects below v, visited holds the
+// objects already walked.
+func markTree(roles map[uint32]string, v pdf.Value, role string, visited map[uint32]bool) {
+	var children []pdf.Value
+	switch v.Kind() {
+	case pdf.Dict, pdf.Stream:
+		for _, key := range v.Keys() {
+			children = append(children, v.Key(key))
+		}
+	case pdf.Array:
+		for i := 0; i < v.Len(); i++ {
+			children = append(children, v.Index(i))
+		}
+	}
+	for _, child := range children {
+		if ptr := child.GetPtr(); ptr != v.GetPtr() {
+			if visited[ptr.GetID()] {
+				continue
+			}
+			visited[ptr.GetID()] = true
+			markIndirect(roles, v, child, role)
+		}
+		markTree(roles, child, role, visited)
+	}
+}
+
+// classifyModification returns the type of the change of an object from
+// previous to current, or "" for changes that only support other changes,
+// such as new appearance streams and cross-reference streams.
+func classifyModification(previous, current pdf.Value, added bool, role string) string {
+	switch role {
+	case "dss", "metadata":
+		return role
+	case "acroform":
+		if !added && acroFormChanged(previous, current) {
+			return "content_change"
+		}
+		return ""
+	case "structure":
+		// Fields and annotations are added to the arrays, not removed.
+		if !added && !grown(previous, current) {
+			return "content_change"
+		}
+		return ""
+	}
+
+	switch current.Key("Type").Name() {
+	case "XRef", "ObjStm":
+		return ""
+	case "DSS":
+		return "dss"
+	case "Metadata":
+		return "metadata"
+	case "Sig", "DocTimeStamp":
+		// Changing the signature dictionary of an earlier signature alters
+		// that signature.
+		if !added {
+			return "content_change"
+		}
+		return signatureModification(current)
+	case "Catalog":
+		// An indirect interactive form dictionary is compared as an object
+		// of its own.
+		acroForm := current.Key("AcroForm")
+		if changedKeys(previous, current, "DSS", "AcroForm", "Metadata", "Version", "Extensions") ||
+			acroForm.GetPtr() == current.GetPtr() && acroFormChanged(previous.Key("AcroForm"), acroForm) {
+			return "content_change"
+		}
+		return ""
+	case "Page":
+		if added || changedKeys(previous, current, "Annots") || !grown(previous.Key("Annots"), current.Key("Annots")) {
+			return "content_change"
+		}
+		return ""
+	case "Pages":
+		return "content_change"
+	}
+
+	if isFormField(current) {
+		fieldType := current.Key("FT")
+		if fieldType.IsNull() {
+			fieldType = current.Key("Parent").Key("FT")
+		}
+		if fieldType.Name() != "Sig" {
+			return "form_fill"
+		}
+		// Signing an empty signature field is a new signature, any other
+		// change of a signed field or its widgets, such as of their
+		// appearance or position, alters that signature.
+		field := previous
+		if previous.Key("FT").IsNull() {
+			field = previous.Key("Parent")
+		}
+		if !added && !field.Key("V").IsNull() {
+			return "content_change"
+		}
+		return signatureModification(current.Key("V"))
+	}
+	if current.Key("Type").Name() == "Annot" || !current.Key("Subtype").IsNull() && !current.Key("Rect").IsNull() {
+		return "annotation"
+	}
+
+	// New objects only change the document when a changed object refers to
+	// them.
+	if added {
+		return ""
+	}
+	return "content_change"
+}
+
+// isFormField reports whether v is a form field or the widget of one.
+func isFormField(v pdf.Value) bool {
+	return v.Key("Subtype").Name() == "Widget" || !v.Key("FT").IsNull()
+}
+
+// fieldName returns the fully qualified name of the form field or widget v,
+// the partial names of v and its parents joined by periods.
+func fieldName(v pdf.Value) string {
+	var names []string
+	// The depth of the field hierarchy is limited, which ends the loop for
+	// fields with a cycle of parents.
+	for i := 0; i < 32 && !v.IsNull(); i++ {
+		if name := v.Key("T"); !name.IsNull() {
+			names = append([]string{name.Text()}, names...)
+		}
+		v = v.Key("Parent")
+	}
+	return strings.Join(names, ".")
+}
+
+// signatureModification returns the type of a new signature dictionary v,
+// "document_timestamp" for document timestamps and "signature" otherwise.
+func signatureModification(v pdf.Value) string {
+	if v.Key("Type").Name() == "DocTimeStamp" || v.Key("SubFilter").Name() == "ETSI.RFC3161" {
+		return "document_timestamp"
+	}
+	return "signature"
+}
+
+// acroFormChanged reports whether the interactive form dictionary changed
+// from previous to current other than by new fields and signature flags
+// that signing sets.
+func acroFormChanged(previous, current pdf.Value) bool {
+	return changedKeys(previous, current, "Fields", "SigFlags") ||
+		!grown(previous.Key("Fields"), current.Key("Fields")) ||
+		previous.Key("SigFlags").Int64()&^current.Key("SigFlags").Int64() != 0
+}
+
+// grown reports whether the array current holds all elements of the array
+// previous, indirect objects by their references.
+func grown(previous, current pdf.Value) bool {
+	for i := 0; i < previous.Len(); i++ {
+		element := previous.Index(i)
+		found := false
+		for j := 0; j < current.Len() && !found; j++ {
+			if element.GetPtr() == previous.GetPtr() {
+				found = sameValue(element, current.Index(j))
+			} else {
+				found = element.GetPtr() == current.Index(j).GetPtr()
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// changedKeys reports whether an entry of the dictionaries previous and
+// current differs, apart from the entries ignore.
+func changedKeys(previous, current pdf.Value, ignore ...string) bool {
+	for _, key := range slices.Concat(previous.Keys(), current.Keys()) {
+		if slices.Contains(ignore, key) {
+			continue
+		}
+		if !sameValue(previous.Key(key), current.Key(key)) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameValue reports whether a and b are equal, streams are equal when their
+// dictionaries and decoded data are.
+func sameValue(a, b pdf.Value) bool {
+	if a.Kind() != b.Kind() {
+		return false
+	}
+	if a.Kind() != pdf.Stream {
+		return a.String() == b.String()
+	}
+
+	// The string of a stream ends with its offset in the file.
+	header := func(v pdf.Value) string {
+		s := v.String()
+		if i := strings.LastIndex(s, "@"); i >= 0 {
+			return s[:i]
+		}
+		return s
+	}
+	if header(a) != header(b) {
+		return false
+	}
+	dataA, errA := io.ReadAll(a.Reader())
+	dataB, errB := io.ReadAll(b.Reader())
+	return errA == nil && errB == nil && bytes.Equal(dataA, dataB)
+}
@@ -0,0 +1,230 @@
+package verify
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/digitorus/pdf"
+)
+
+// appendRevision appends a revision with objects by number to document, with
+// a cross-reference table that refers to the previous one at prev. It
+// returns the new document and the offset of its cross-reference table.
+func appendRevision(document []byte, prev int, objects map[int]string) ([]byte, int) {
+	buf := bytes.NewBuffer(append([]byte(nil), document...))
+	ids := make([]int, 0, len(objects))
+	for id := range objects {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	offsets := make(map[int]int)
+	for _, id := range ids {
+		offsets[id] = buf.Len()
+		_, _ = fmt.Fprintf(buf, "%d 0 obj\n%s\nendobj\n", id, objects[id])
+	}
+
+	xref := buf.Len()
+	buf.WriteString("xref\n")
+	if prev == 0 {
+		buf.WriteString("0 1\n0000000000 65535 f \n")
+	}
+	for _, id := range ids {
+		_, _ = fmt.Fprintf(buf, "%d 1\n%010d 00000 n \n", id, offsets[id])
+	}
+	size := ids[len(ids)-1] + 1
+	if prev == 0 {
+		_, _ = fmt.Fprintf(buf, "trailer\n<< /Size %d /Root 1 0 R >>\n", size)
+	} else {
+		_, _ = fmt.Fprintf(buf, "trailer\n<< /Size %d /Root 1 0 R /Prev %d >>\n", size, prev)
+	}
+	_, _ = fmt.Fprintf(buf, "startxref\n%d\n%%%%EOF\n", xref)
+	return buf.Bytes(), xref
+}
+
+func TestDetectModifications(t *testing.T) {
+	catalog := "<< /Type /Catalog /Pages 2 0 R /AcroForm << /Fields [] /SigFlags 3 >> >>"
+	content := "BT /F1 12 Tf 72 712 Td (Signed) Tj ET"
+	base, prev := appendRevision([]byte("%PDF-1.7\n"), 0, map[int]string{
+		1: catalog,
+		2: "<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		3: "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R >>",
+		4: fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+		7: "<< /Type /Sig /Filter /Adobe.PPKLite /SubFilter /adbe.pkcs7.detached >>",
+		8: "<< /FT /Sig /T (Signature1) /V 7 0 R /Subtype /Widget /Rect [0 0 0 0] >>",
+	})
+
+	tests := []struct {
+		name              string
+		objects           map[int]string
+		wantModifications []Modification
+		wantDisallowed    bool
+	}{
+		{
+			name: "annotation",
+			objects: map[int]string{
+				3: "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R /Annots [5 0 R] >>",
+				5: "<< /Type /Annot /Subtype /Text /Rect [0 0 20 20] /Contents (Note) >>",
+			},
+			wantModifications: []Modification{{Type: "annotation", Object: "5 0 R", Description: "page 1 annotation", Added: true}},
+		},
+		{
+			name: "form fill",
+			objects: map[int]string{
+				1: "<< /Type /Catalog /Pages 2 0 R /AcroForm << /Fields [5 0 R] /SigFlags 3 >> >>",
+				5: "<< /FT /Tx /T (Name) /V (John Doe) /Subtype /Widget /Rect [0 0 100 20] >>",
+			},
+			wantModifications: []Modification{{Type: "form_fill", Object: "5 0 R", Description: "form field", Field: "Name", Added: true}},
+		},
+		{
+			name: "new signature",
+			objects: map[int]string{
+				1: "<< /Type /Catalog /Pages 2 0 R /AcroForm << /Fields [6 0 R] /SigFlags 3 >> >>",
+				5: "<< /Type /Sig /Filter /Adobe.PPKLite /SubFilter /ETSI.CAdES.detached >>",
+				6: "<< /FT /Sig /T (Signature2) /V 5 0 R /Subtype /Widget /Rect [0 0 0 0] >>",
+			},
+			wantModifications: []Modification{
+				{Type: "signature", Object: "5 0 R", Description: "signature dictionary", Added: true},
+				{Type: "signature", Object: "6 0 R", Description: "signature field", Field: "Signature2", Added: true},
+			},
+		},
+		{
+			name: "document timestamp",
+			objects: map[int]string{
+				1: "<< /Type /Catalog /Pages 2 0 R /AcroForm << /Fields [6 0 R] /SigFlags 3 >> >>",
+				5: "<< /Type /DocTimeStamp /Filter /Adobe.PPKLite /SubFilter /ETSI.RFC3161 >>",
+				6: "<< /FT /Sig /T (Timestamp) /V 5 0 R /Subtype /Widget /Rect [0 0 0 0] >>",
+			},
+			wantModifications: []Modification{
+				{Type: "document_timestamp", Object: "5 0 R", Description: "document timestamp dictionary", Added: true},
+				{Type: "document_timestamp", Object: "6 0 R", Description: "signature field", Field: "Timestamp", Added: true},
+			},
+		},
+		{
+			name: "DSS",
+			objects: map[int]string{
+				1: "<< /Type /Catalog /Pages 2 0 R /AcroForm << /Fields [] /SigFlags 3 >> /DSS 5 0 R >>",
+				5: "<< /Certs [6 0 R] >>",
+				6: "<< /Length 4 >>\nstream\nDER!\nendstream",
+			},
+			wantModifications: []Modification{
+				{Type: "dss", Object: "5 0 R", Description: "DSS", Added: true},
+				{Type: "dss", Object: "6 0 R", Description: "DSS", Added: true},
+			},
+		},
+		{
+			name: "metadata",
+			objects: map[int]string{
+				1: "<< /Type /Catalog /Pages 2 0 R /AcroForm << /Fields [] /SigFlags 3 >> /Metadata 5 0 R >>",
+				5: "<< /Type /Metadata /Subtype /XML /Length 5 >>\nstream\n<xmp>\nendstream",
+			},
+			wantModifications: []Modification{{Type: "metadata", Object: "5 0 R", Description: "document metadata", Added: true}},
+		},
+		{
+			name: "unchanged object",
+			objects: map[int]string{
+				4: fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+			},
+		},
+		{
+			name: "page content",
+			objects: map[int]string{
+				4: "<< /Length 40 >>\nstream\nBT /F1 12 Tf 72 712 Td (Changed!) Tj ET\nendstream",
+			},
+			wantModifications: []Modification{{Type: "content_change", Object: "4 0 R", Description: "page 1 content stream"}},
+			wantDisallowed:    true,
+		},
+		{
+			name: "page size",
+			objects: map[int]string{
+				3: "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Contents 4 0 R >>",
+			},
+			wantModifications: []Modification{{Type: "content_change", Object: "3 0 R", Description: "page 1"}},
+			wantDisallowed:    true,
+		},
+		{
+			name: "appearance of a signed field replaced",
+			objects: map[int]string{
+				8: "<< /FT /Sig /T (Signature1) /V 7 0 R /Subtype /Widget /Rect [0 0 200 50] /AP << /N 9 0 R >> >>",
+				9: "<< /Type /XObject /Subtype /Form /BBox [0 0 200 50] /Length 14 >>\nstream\n0 0 200 50 re f\nendstream",
+			},
+			wantModifications: []Modification{{Type: "content_change", Object: "8 0 R", Description: "signature field", Field: "Signature1"}},
+			wantDisallowed:    true,
+		},
+		{
+			name: "XFA added",
+			objects: map[int]string{
+				1: "<< /Type /Catalog /Pages 2 0 R /AcroForm << /Fields [] /SigFlags 3 /XFA 5 0 R >> >>",
+				5: "<< /Length 6 >>\nstream\n<xdp/>\nendstream",
+			},
+			wantModifications: []Modification{{Type: "content_change", Object: "1 0 R", Description: "catalog"}},
+			wantDisallowed:    true,
+		},
+		{
+			name: "NeedAppearances set",
+			objects: map[int]string{
+				1: "<< /Type /Catalog /Pages 2 0 R /AcroForm << /Fields [] /SigFlags 3 /NeedAppearances true >> >>",
+			},
+			wantModifications: []Modification{{Type: "content_change", Object: "1 0 R", Description: "catalog"}},
+			wantDisallowed:    true,
+		},
+		{
+			name: "SigFlags removed",
+			objects: map[int]string{
+				1: "<< /Type /Catalog /Pages 2 0 R /AcroForm << /Fields [] >> >>",
+			},
+			wantModifications: []Modification{{Type: "content_change", Object: "1 0 R", Description: "catalog"}},
+			wantDisallowed:    true,
+		},
+		{
+			name: "catalog action",
+			objects: map[int]string{
+				1: "<< /Type /Catalog /Pages 2 0 R /AcroForm << /Fields [] /SigFlags 3 >> /OpenAction 5 0 R >>",
+				5: "<< /S /JavaScript /JS (app.alert(1)) >>",
+			},
+			wantModifications: []Modification{{Type: "content_change", Object: "1 0 R", Description: "catalog"}},
+			wantDisallowed:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			document, _ := appendRevision(base, prev, tt.objects)
+			rdr, err := pdf.NewReader(bytes.NewReader(document), int64(len(document)))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			signers := []Signer{{RevisionEnd: int64(len(base))}}
+			detectModifications(bytes.NewReader(document), int64(len(document)), rdr, signers)
+			s := signers[0]
+			if s.ModificationError != "" {
+				t.Fatalf("%s", s.ModificationError)
+			}
+			if !s.ModifiedAfterSigning {
+				t.Errorf("expected the document to be modified after signing")
+			}
+			if !reflect.DeepEqual(s.Modifications, tt.wantModifications) {
+				t.Errorf("expected modifications %v, got %v", tt.wantModifications, s.Modifications)
+			}
+			if s.DisallowedModifications != tt.wantDisallowed {
+				t.Errorf("expected disallowed modifications %v, got %v", tt.wantDisallowed, s.DisallowedModifications)
+			}
+		})
+	}
+
+	t.Run("last revision", func(t *testing.T) {
+		rdr, err := pdf.NewReader(bytes.NewReader(base), int64(len(base)))
+		if err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+		signers := []Signer{{RevisionEnd: int64(len(base))}}
+		detectModifications(bytes.NewReader(base), int64(len(base)), rdr, signers)
+		if signers[0].ModifiedAfterSigning || signers[0].DisallowedModifications {
+			t.Errorf("expected no modifications after signing")
+		}
+	})
+}
@@ -0,0 +1,200 @@
+package verify
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/internal/xref"
+)
+
+// PDFAConformance is the PDF/A conformance a document declares in its XMP
+// metadata and how the document and its signatures break it, see ISO 19005.
+// Only the requirements that signing affects are checked, a conforming
+// document has not been validated as PDF/A.
+type PDFAConformance struct {
+	Part        int      `json:"part,omitempty"`        // Part of ISO 19005 the document declares, such as 2 for PDF/A-2, 0 if only a signed revision declares one
+	Conformance string   `json:"conformance,omitempty"` // Conformance level the document declares, such as "B"
+	Conforming  bool     `json:"conforming"`            // Whether none of the checked requirements is broken
+	Violations  []string `json:"violations,omitempty"`  // How the document or its signatures break the declared conformance
+}
+
+// Annotation flags that PDF/A requires to be set or clear, see ISO 19005-2,
+// 6.3.2.
+const (
+	annotationInvisible    = 1 << 0
+	annotationPrint        = 1 << 2
+	annotationToggleNoView = 1 << 8
+)
+
+// pdfaPart and pdfaConformance match the PDF/A identification of XMP
+// metadata, as attributes or as elements.
+var (
+	pdfaPart        = regexp.MustCompile(`pdfaid:part\s*(?:=\s*["']|>)\s*(\d+)`)
+	pdfaConformance = regexp.MustCompile(`pdfaid:conformance\s*(?:=\s*["']|>)\s*([A-Za-z])`)
+)
+
+// checkPDFA returns the PDF/A conformance of the document rdr with the
+// signature dictionaries signatures, nil if neither the document nor a
+// revision signed by one of them declares PDF/A conformance.
+func checkPDFA(file io.ReaderAt, rdr *pdf.Reader, signatures []pdf.Value) *PDFAConformance {
+	root := rdr.Trailer().Key("Root")
+	result := &PDFAConformance{}
+	result.Part, result.Conformance = pdfaIdentification(root)
+	declared := result.Part != 0
+	violation := func(format string, args ...any) {
+		result.Violations = append(result.Violations, fmt.Sprintf(format, args...))
+	}
+
+	if !rdr.Trailer().Key("Encrypt").IsNull() {
+		violation("the document is encrypted")
+	}
+
+	fields := root.Key("AcroForm").Key("Fields")
+	for _, v := range signatures {
+		field := signatureField(fields, v, 0)
+		name := fieldName(field)
+
+		// The revision of the signature must declare the same conformance
+		// as the document.
+		if end := byteRangeEnd(v); end > 0 {
+			if part, conformance := signedPDFAIdentification(file, end); part != 0 {
+				declared = true
+				if part != result.Part || conformance != result.Conformance {
+					violation("the revision signed by signature field %q declares %s, the document %s", name, pdfaName(part, conformance), pdfaName(result.Part, result.Conformance))
+				}
+			}
+		}
+
+		switch subFilter := v.Key("SubFilter").Name(); subFilter {
+		case "adbe.x509.rsa_sha1", "adbe.pkcs7.sha1":
+			if result.Part >= 2 {
+				violation("signature field %q uses the SubFilter %s, which PDF/A-%d does not permit", name, subFilter, result.Part)
+			}
+		}
+
+		if field.IsNull() {
+			continue
+		}
+		for _, widget := range signatureWidgets(field) {
+			flags := widget.Key("F").Int64()
+			if flags&annotationPrint == 0 {
+				violation("widget of signature field %q does not have the Print annotation flag", name)
+			}
+			if flags&(annotationInvisible|annotationHidden|annotationNoView|annotationToggleNoView) != 0 {
+				violation("widget of signature field %q is hidden by its annotation flags", name)
+			}
+			appearance := widget.Key("AP").Key("N")
+			if rect, ok := normalizedRect(widget.Key("Rect")); ok && rect[2] > rect[0] && rect[3] > rect[1] && appearance.IsNull() {
+				violation("widget of signature field %q has no appearance stream", name)
+			}
+			fonts := unembeddedFonts(appearance, 0)
+			slices.Sort(fonts)
+			for _, font := range slices.Compact(fonts) {
+				violation("appearance of signature field %q uses the font %s, which is not embedded", name, font)
+			}
+		}
+	}
+
+	if !declared {
+		return nil
+	}
+	result.Conforming = len(result.Violations) == 0
+	return result
+}
+
+// pdfaIdentification returns the part and conformance level of the PDF/A
+// identification of the XMP metadata of the catalog root, 0 without one.
+func pdfaIdentification(root pdf.Value) (part int, conformance string) {
+	metadata := root.Key("Metadata")
+	if metadata.Kind() != pdf.Stream {
+		return 0, ""
+	}
+	data, err := io.ReadAll(metadata.Reader())
+	if err != nil {
+		return 0, ""
+	}
+	m := pdfaPart.FindSubmatch(data)
+	if m == nil {
+		return 0, ""
+	}
+	part, _ = strconv.Atoi(string(m[1]))
+	if m := pdfaConformance.FindSubmatch(data); m != nil {
+		conformance = string(m[1])
+	}
+	return part, conformance
+}
+
+// signedPDFAIdentification returns the PDF/A identification of the revision
+// that ends at end.
+func signedPDFAIdentification(file io.ReaderAt, end int64) (part int, conformance string) {
+	defer func() {
+		if r := recover(); r != nil {
+			part, conformance = 0, ""
+		}
+	}()
+	signed, err := xref.NewReader(io.NewSectionReader(file, 0, end), end)
+	if err != nil {
+		return 0, ""
+	}
+	return pdfaIdentification(signed.Trailer().Key("Root"))
+}
+
+// pdfaName returns the name of a PDF/A conformance, such as "PDF/A-2B".
+func pdfaName(part int, conformance string) string {
+	if part == 0 {
+		return "no PDF/A conformance"
+	}
+	return fmt.Sprintf("PDF/A-%d%s", part, conformance)
+}
+
+// byteRangeEnd returns the offset after the last byte of the ByteRange of
+// the signature dictionary v, 0 if it has none.
+func byteRangeEnd(v pdf.Value) int64 {
+	byteRange := v.Key("ByteRange")
+	n := byteRange.Len()
+	if n == 0 || n%2 != 0 {
+		return 0
+	}
+	return byteRange.Index(n-2).Int64() + byteRange.Index(n-1).Int64()
+}
+
+// unembeddedFonts returns the names of the fonts of the resources of the
+// appearance stream, and of the form XObjects it uses, that are not
+// embedded. Type 3 fonts are described by the stream itself. The depth of
+// nested form XObjects is limited.
+func unembeddedFonts(appearance pdf.Value, depth int) []string {
+	if appearance.Kind() != pdf.Stream || depth > 8 {
+		return nil
+	}
+	resources := appearance.Key("Resources")
+
+	var names []string
+	fonts := resources.Key("Font")
+	for _, key := range fonts.Keys() {
+		font := fonts.Key(key)
+		descriptor := font.Key("FontDescriptor")
+		switch font.Key("Subtype").Name() {
+		case "Type3":
+			continue
+		case "Type0":
+			descriptor = font.Key("DescendantFonts").Index(0).Key("FontDescriptor")
+		}
+		if descriptor.Key("FontFile").IsNull() && descriptor.Key("FontFile2").IsNull() && descriptor.Key("FontFile3").IsNull() {
+			names = append(names, font.Key("BaseFont").Name())
+		}
+	}
+
+	xobjects := resources.Key("XObject")
+	for _, key := range xobjects.Keys() {
+		xobject := xobjects.Key(key)
+		if xobject.Key("Subtype").Name() != "Form" {
+			continue
+		}
+		names = append(names, unembeddedFonts(xobject, depth+1)...)
+	}
+	return names
+}
@@ -0,0 +1,125 @@
+package verify
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/digitorus/pdf"
+)
+
+func TestCheckPDFA(t *testing.T) {
+	xmp := func(part int) string {
+		data := fmt.Sprintf(`<rdf:Description pdfaid:part="%d" pdfaid:conformance="B"/>`, part)
+		return fmt.Sprintf("<< /Type /Metadata /Subtype /XML /Length %d >>\nstream\n%s\nendstream", len(data), data)
+	}
+	appearance := func(font string) string {
+		return fmt.Sprintf("<< /Type /XObject /Subtype /Form /BBox [0 0 100 50] /Resources << /Font << /F1 %s >> >> /Length 0 >>\nstream\n\nendstream", font)
+	}
+	embedded := "<< /Type /Font /Subtype /TrueType /BaseFont /Embedded /FontDescriptor << /FontFile2 8 0 R >> >>"
+
+	// signedDocument returns a document with a signature of its first
+	// revision as object 4, its widget as object 5, and the later revision
+	// of objects, and the signature dictionary.
+	signedDocument := func(first, later map[int]string) ([]byte, pdf.Value) {
+		objects := map[int]string{
+			1: "<< /Type /Catalog /Pages 2 0 R /AcroForm << /Fields [5 0 R] /SigFlags 3 >> /Metadata 7 0 R >>",
+			2: "<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+			3: "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Annots [5 0 R] >>",
+			4: "<< /Type /Sig /Filter /Adobe.PPKLite /SubFilter /ETSI.CAdES.detached /ByteRange [0 10 10 %010d] /Contents <00> >>",
+			5: "<< /FT /Sig /T (Signature1) /V 4 0 R /Subtype /Widget /F 4 /Rect [0 0 100 50] /P 3 0 R /AP << /N 6 0 R >> >>",
+			6: appearance(embedded),
+			7: xmp(2),
+			8: "<< /Length 4 >>\nstream\nfont\nendstream",
+		}
+		for id, object := range first {
+			objects[id] = object
+		}
+		signature := objects[4]
+		objects[4] = fmt.Sprintf(signature, 0)
+		base, _ := appendRevision([]byte("%PDF-1.7\n"), 0, objects)
+		objects[4] = fmt.Sprintf(signature, len(base)-10)
+		base, prev := appendRevision([]byte("%PDF-1.7\n"), 0, objects)
+
+		document := base
+		if later != nil {
+			document, _ = appendRevision(base, prev, later)
+		}
+		rdr, err := pdf.NewReader(bytes.NewReader(document), int64(len(document)))
+		if err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+		ptr := rdr.Xref()[4].Ptr()
+		return document, rdr.Resolve(ptr, ptr)
+	}
+
+	tests := []struct {
+		name  string
+		first map[int]string
+		later map[int]string
+		want  *PDFAConformance
+	}{
+		{
+			name: "conforming",
+			want: &PDFAConformance{Part: 2, Conformance: "B", Conforming: true},
+		},
+		{
+			name:  "identification elements",
+			first: map[int]string{7: "<< /Type /Metadata /Subtype /XML /Length 70 >>\nstream\n<pdfaid:part>1</pdfaid:part><pdfaid:conformance>A</pdfaid:conformance>\nendstream"},
+			want:  &PDFAConformance{Part: 1, Conformance: "A", Conforming: true},
+		},
+		{
+			name:  "not declared",
+			first: map[int]string{7: "<< /Type /Metadata /Subtype /XML /Length 5 >>\nstream\n<xmp>\nendstream"},
+		},
+		{
+			name: "appearance",
+			first: map[int]string{
+				5: "<< /FT /Sig /T (Signature1) /V 4 0 R /Subtype /Widget /F 2 /Rect [0 0 100 50] /P 3 0 R /AP << /N 6 0 R >> >>",
+				6: appearance("<< /Type /Font /Subtype /Type1 /BaseFont /Times-Roman >>"),
+			},
+			want: &PDFAConformance{Part: 2, Conformance: "B", Violations: []string{
+				`widget of signature field "Signature1" does not have the Print annotation flag`,
+				`widget of signature field "Signature1" is hidden by its annotation flags`,
+				`appearance of signature field "Signature1" uses the font Times-Roman, which is not embedded`,
+			}},
+		},
+		{
+			name:  "SHA-1 signature",
+			first: map[int]string{4: "<< /Type /Sig /Filter /Adobe.PPKLite /SubFilter /adbe.pkcs7.sha1 /ByteRange [0 10 10 %010d] /Contents <00> >>"},
+			want: &PDFAConformance{Part: 2, Conformance: "B", Violations: []string{
+				`signature field "Signature1" uses the SubFilter adbe.pkcs7.sha1, which PDF/A-2 does not permit`,
+			}},
+		},
+		{
+			name: "metadata changed after signing",
+			// The unchanged object 8 extends the size of the cross-reference
+			// table of the update to object 7.
+			later: map[int]string{7: xmp(3), 8: "<< /Length 4 >>\nstream\nfont\nendstream"},
+			want: &PDFAConformance{Part: 3, Conformance: "B", Violations: []string{
+				`the revision signed by signature field "Signature1" declares PDF/A-2B, the document PDF/A-3B`,
+			}},
+		},
+		{
+			name:  "metadata removed after signing",
+			later: map[int]string{1: "<< /Type /Catalog /Pages 2 0 R /AcroForm << /Fields [5 0 R] /SigFlags 3 >> >>", 8: "<< /Length 4 >>\nstream\nfont\nendstream"},
+			want: &PDFAConformance{Violations: []string{
+				`the revision signed by signature field "Signature1" declares PDF/A-2B, the document no PDF/A conformance`,
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			document, signature := signedDocument(tt.first, tt.later)
+			rdr, err := pdf.NewReader(bytes.NewReader(document), int64(len(document)))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if got := checkPDFA(bytes.NewReader(document), rdr, []pdf.Value{signature}); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package verify
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pemExtensions are the extensions of the files in a directory that are
+// read for PEM certificates.
+var pemExtensions = []string{".pem", ".crt", ".cer"}
+
+// PEMTrustProvider is a TrustProvider of the PEM certificates in a bundle
+// file or a directory, such as a private CA or the roots of an
+// organization. With a ReloadInterval the files are checked for changes, so
+// long-running services pick up new anchors without a restart.
+type PEMTrustProvider struct {
+	FS             fs.FS         // File system of the Path, an embedded fs.FS for example, the operating system if nil
+	Path           string        // A PEM bundle, or a directory of .pem, .crt and .cer files with its subdirectories
+	ReloadInterval time.Duration // How often the files are checked for changes, never if zero
+
+	mu       sync.Mutex
+	anchors  []TrustAnchor
+	err      error
+	loaded   bool
+	checked  time.Time
+	snapshot string
+}
+
+// NewPEMTrustProvider returns a PEMTrustProvider of the bundle file or
+// directory at path of the operating system.
+func NewPEMTrustProvider(path string) *PEMTrustProvider {
+	return &PEMTrustProvider{Path: path}
+}
+
+// TrustAnchors implements TrustProvider.
+func (p *PEMTrustProvider) TrustAnchors(ctx context.Context) ([]TrustAnchor, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.loaded || (p.ReloadInterval > 0 && time.Since(p.checked) >= p.ReloadInterval) {
+		p.reload()
+	}
+	return p.anchors, p.err
+}
+
+// Reload reads the files again and returns the error of loading them, such
+// as on a signal of the service. Otherwise the files are read on first use
+// and, with a ReloadInterval, when they change.
+func (p *PEMTrustProvider) Reload() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.snapshot = ""
+	p.reload()
+	return p.err
+}
+
+// reload reads the files when they changed since they were last read,
+// judged by their names, sizes and modification times.
+func (p *PEMTrustProvider) reload() {
+	p.checked = time.Now()
+	fsys, root := p.fileSystem()
+	files, snapshot, err := pemFiles(fsys, root)
+	if err != nil {
+		p.err = fmt.Errorf("failed to read trust anchors from %s: %w", p.Path, err)
+		p.loaded = true
+		return
+	}
+	if p.loaded && snapshot == p.snapshot {
+		return
+	}
+
+	var anchors []TrustAnchor
+	var errs []error
+	for _, name := range files {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		certificates, err := parsePEMCertificates(data)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+		for _, cert := range certificates {
+			anchors = append(anchors, TrustAnchor{Certificate: cert, Source: "pem"})
+		}
+	}
+	if len(anchors) == 0 && len(errs) == 0 {
+		errs = append(errs, errors.New("no certificates"))
+	}
+
+	p.anchors, p.snapshot, p.loaded = anchors, snapshot, true
+	p.err = nil
+	if err := errors.Join(errs...); err != nil {
+		p.err = fmt.Errorf("failed to read trust anchors from %s: %w", p.Path, err)
+	}
+}
+
+// fileSystem returns the file system and the name of the Path in it.
+func (p *PEMTrustProvider) fileSystem() (fs.FS, string) {
+	if p.FS != nil {
+		name := path.Clean(strings.TrimPrefix(p.Path, "/"))
+		return p.FS, name
+	}
+	abs, err := filepath.Abs(p.Path)
+	if err != nil {
+		abs = p.Path
+	}
+	return os.DirFS(filepath.Dir(abs)), filepath.Base(abs)
+}
+
+// pemFiles returns the file root, or the files with a PEM extension in the
+// directory root and its subdirectories, with a snapshot of their names,
+// sizes and modification times.
+func pemFiles(fsys fs.FS, root string) ([]string, string, error) {
+	var files []string
+	var snapshot strings.Builder
+	err := fs.WalkDir(fsys, root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || (name != root && !hasPEMExtension(name)) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, name)
+		fmt.Fprintf(&snapshot, "%s %d %d\n", name, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	return files, snapshot.String(), err
+}
+
+// hasPEMExtension reports whether name has one of the pemExtensions.
+func hasPEMExtension(name string) bool {
+	return slices.Contains(pemExtensions, strings.ToLower(path.Ext(name)))
+}
+
+// parsePEMCertificates returns the certificates of the CERTIFICATE blocks of
+// the PEM data, other blocks are skipped.
+func parsePEMCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certificates []*x509.Certificate
+	var errs []error
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		certificates = append(certificates, cert)
+	}
+	return certificates, errors.Join(errs...)
+}
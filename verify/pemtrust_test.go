@@ -0,0 +1,125 @@
+package verify
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestPEMTrustProvider(t *testing.T) {
+	root, _ := newTestCRLIssuer(t, "pdfsign Private Root")
+	other, _ := newTestCRLIssuer(t, "pdfsign Other Root")
+	encode := func(certificates ...[]byte) []byte {
+		var data []byte
+		for _, der := range certificates {
+			data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+		}
+		return data
+	}
+
+	dir := t.TempDir()
+	bundle := filepath.Join(dir, "bundle.pem")
+	if err := os.WriteFile(bundle, encode(root.Raw, other.Raw), 0o600); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "cas"), 0o700); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cas", "root.crt"), encode(root.Raw), 0o600); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README"), []byte("not a certificate"), 0o600); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	tests := []struct {
+		name     string
+		provider *PEMTrustProvider
+		want     int
+		wantErr  bool
+	}{
+		{name: "bundle", provider: NewPEMTrustProvider(bundle), want: 2},
+		{name: "directory", provider: NewPEMTrustProvider(dir), want: 3},
+		{name: "missing", provider: NewPEMTrustProvider(filepath.Join(dir, "missing.pem")), wantErr: true},
+		{name: "not PEM", provider: NewPEMTrustProvider(filepath.Join(dir, "README")), wantErr: true},
+		{
+			name: "fs.FS",
+			provider: &PEMTrustProvider{
+				FS:   fstest.MapFS{"roots/root.pem": {Data: encode(root.Raw)}, "roots/notes.txt": {Data: []byte("notes")}},
+				Path: "roots",
+			},
+			want: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			anchors, err := tt.provider.TrustAnchors(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %t, got %v", tt.wantErr, err)
+			}
+			if len(anchors) != tt.want {
+				t.Errorf("expected %d trust anchors, got %d", tt.want, len(anchors))
+			}
+			for _, a := range anchors {
+				if a.Source != "pem" {
+					t.Errorf("expected the source pem, got %q", a.Source)
+				}
+			}
+		})
+	}
+}
+
+func TestPEMTrustProviderReload(t *testing.T) {
+	root, _ := newTestCRLIssuer(t, "pdfsign Private Root")
+	other, _ := newTestCRLIssuer(t, "pdfsign Other Root")
+	fsys := fstest.MapFS{"roots.pem": {Data: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw}), ModTime: time.Now()}}
+
+	provider := &PEMTrustProvider{FS: fsys, Path: "roots.pem"}
+	anchors, err := provider.TrustAnchors(context.Background())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if len(anchors) != 1 {
+		t.Fatalf("expected 1 trust anchor, got %d", len(anchors))
+	}
+
+	// Without a ReloadInterval changes are only read by Reload
+	fsys["roots.pem"] = &fstest.MapFile{
+		Data:    append(fsys["roots.pem"].Data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: other.Raw})...),
+		ModTime: time.Now().Add(time.Second),
+	}
+	if anchors, _ := provider.TrustAnchors(context.Background()); len(anchors) != 1 {
+		t.Errorf("expected the anchors to be kept, got %d", len(anchors))
+	}
+	provider.ReloadInterval = time.Nanosecond
+	if anchors, _ := provider.TrustAnchors(context.Background()); len(anchors) != 2 {
+		t.Errorf("expected the changed file to be read, got %d trust anchors", len(anchors))
+	}
+
+	// Anchors are kept when the files cannot be read
+	delete(fsys, "roots.pem")
+	anchors, err = provider.TrustAnchors(context.Background())
+	if err == nil || len(anchors) != 2 {
+		t.Errorf("expected the previous anchors with an error, got %d and %v", len(anchors), err)
+	}
+	if err := provider.Reload(); err == nil {
+		t.Errorf("expected an error reloading a missing file")
+	}
+}
+
+func TestDisableSystemRoots(t *testing.T) {
+	options := DefaultVerifyOptions()
+	if options.systemRoots() != nil {
+		t.Errorf("expected the system roots by default")
+	}
+	options.DisableSystemRoots = true
+	if roots := options.systemRoots(); roots == nil || !roots.Equal(x509.NewCertPool()) {
+		t.Errorf("expected an empty pool with DisableSystemRoots")
+	}
+}
@@ -0,0 +1,100 @@
+package verify
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/revocation"
+	"github.com/digitorus/pkcs7"
+)
+
+// processPKCS1Signature verifies an adbe.x509.rsa_sha1 signature, a PKCS #1
+// v1.5 signature value over the byte range, with the certificate chain in
+// the Cert entry of the signature dictionary and the revocation data in the
+// DSS dictionary dss of the document.
+func processPKCS1Signature(v pdf.Value, dss pdf.Value, file io.ReaderAt, signer *Signer, options *VerifyOptions) (string, error) {
+	certificates, err := parseCertEntry(v.Key("Cert"))
+	if err != nil {
+		return "", err
+	}
+
+	// The Contents are zero padded after the OCTET STRING.
+	var signature []byte
+	if _, err := asn1.Unmarshal([]byte(v.Key("Contents").RawString()), &signature); err != nil {
+		return "", fmt.Errorf("failed to parse PKCS #1 signature: %v", err)
+	}
+
+	// The digest algorithm is only part of the signature value, the byte
+	// range is hashed with the algorithms ISO 32000-1 allows.
+	hashes := []crypto.Hash{crypto.SHA1, crypto.SHA256, crypto.SHA384, crypto.SHA512}
+	digests, err := digestByteRange(v, file, hashes...)
+	if err != nil {
+		return fmt.Sprintf("Failed to process ByteRange: %v", err), nil
+	}
+	p7 := &pkcs7.PKCS7{Certificates: certificates}
+
+	public, ok := certificates[0].PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return "Failed to verify signature: the signing certificate has no RSA key", nil
+	}
+
+	// The algorithms are tried in turn.
+	for _, hash := range hashes {
+		digest := digests[hash]
+		if rsa.VerifyPKCS1v15(public, hash, digest, signature) == nil {
+			signer.ValidSignature = true
+			signer.setDigestAlgorithm(nil, hash)
+			signer.MessageDigest = hex.EncodeToString(digest)
+			break
+		}
+	}
+	if !signer.ValidSignature {
+		return "Failed to verify signature: signature verification failed: invalid PKCS #1 signature", nil
+	}
+
+	var revInfo revocation.InfoArchival
+	dssData := dssValidationData(dss, []byte(v.Key("Contents").RawString()))
+	dssData.addTo(&revInfo)
+
+	certError, err := buildCertificateChainsWithOptions(p7, signer, revInfo, dssData.certificates, options)
+	if err != nil {
+		return certError, err
+	}
+	checkSigningTime(signer, certificates[0], options)
+	signer.LTVEnabled, signer.LTVError = ltvStatus(certificates[0], slices.Concat(certificates, dssData.certificates), revInfo)
+	return certError, nil
+}
+
+// parseCertEntry parses the Cert entry, a byte string or an array of byte
+// strings that starts with the signing certificate.
+func parseCertEntry(cert pdf.Value) ([]*x509.Certificate, error) {
+	var raw []string
+	switch cert.Kind() {
+	case pdf.String:
+		raw = append(raw, cert.RawString())
+	case pdf.Array:
+		for i := 0; i < cert.Len(); i++ {
+			raw = append(raw, cert.Index(i).RawString())
+		}
+	}
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("no certificate in the Cert entry")
+	}
+
+	certificates := make([]*x509.Certificate, len(raw))
+	for i := range raw {
+		certificate, err := x509.ParseCertificate([]byte(raw[i]))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate of the Cert entry: %v", err)
+		}
+		certificates[i] = certificate
+	}
+	return certificates, nil
+}
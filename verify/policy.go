@@ -0,0 +1,100 @@
+package verify
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+)
+
+// Policy names a preset of verification options.
+type Policy string
+
+const (
+	// PolicyDefault are the options of DefaultVerifyOptions.
+	PolicyDefault Policy = "default"
+
+	// PolicyStrict requires the Document Signing EKU, the Non-Repudiation
+	// key usage, a signature timestamp, embedded validation data and keys
+	// of at least 3072 bits, rejects weak algorithms and checks revocation
+	// online.
+	PolicyStrict Policy = "strict"
+
+	// PolicyPAdESBaseline requires a signature timestamp and keys of at
+	// least 2048 bits, as PAdES baseline-T signatures have, and rejects weak
+	// algorithms.
+	PolicyPAdESBaseline Policy = "pades-baseline"
+
+	// PolicyLegacyCompatible accepts older signatures without the Digital
+	// Signature key usage, with the claimed signing time when they have no
+	// timestamp and with SHA-1 digests.
+	PolicyLegacyCompatible Policy = "legacy-compatible"
+)
+
+// Policies are the policies of PolicyOptions.
+var Policies = []Policy{PolicyDefault, PolicyStrict, PolicyPAdESBaseline, PolicyLegacyCompatible}
+
+// PolicyOptions returns the verification options of policy, the options of
+// DefaultVerifyOptions for an empty policy.
+func PolicyOptions(policy Policy) (*VerifyOptions, error) {
+	options := DefaultVerifyOptions()
+	switch policy {
+	case "", PolicyDefault:
+	case PolicyStrict:
+		options.AllowedEKUs = nil
+		options.AllowedEKUOIDs = nil
+		options.RequireNonRepudiation = true
+		options.EnableExternalRevocationCheck = true
+		options.RequireTimestamp = true
+		options.RequireLTV = true
+		options.MinRSAKeySize = 3072
+		options.RejectWeakAlgorithms = true
+	case PolicyPAdESBaseline:
+		options.RequireTimestamp = true
+		options.MinRSAKeySize = 2048
+		options.RejectWeakAlgorithms = true
+	case PolicyLegacyCompatible:
+		options.RequireDigitalSignatureKU = false
+		options.TrustSignatureTime = true
+		options.MinRSAKeySize = 1024
+		options.SHA1Policy = SHA1Accept
+	default:
+		return nil, fmt.Errorf("unknown verification policy %q", policy)
+	}
+	return options, nil
+}
+
+// checkPolicy records the requirements of options that each signature does
+// not meet. Document timestamps and usage rights signatures need no
+// timestamp or validation data of their own.
+func checkPolicy(signers []Signer, options *VerifyOptions) {
+	for i := range signers {
+		s := &signers[i]
+		if s.SignatureType == "signature" {
+			if options.RequireTimestamp && (s.TimeStamp == nil || s.TimestampError != "") {
+				s.PolicyErrors = append(s.PolicyErrors, "the policy requires a valid signature timestamp")
+			}
+			if options.RequireLTV && !s.LTVEnabled {
+				s.PolicyErrors = append(s.PolicyErrors, "the policy requires the validation data of the signature in the document")
+			}
+		}
+		if options.MinRSAKeySize > 0 {
+			for _, c := range s.Certificates {
+				if msg := checkRSAKeySize(c.Certificate, options.MinRSAKeySize); msg != "" {
+					s.PolicyErrors = append(s.PolicyErrors, msg)
+				}
+			}
+		}
+	}
+}
+
+// checkRSAKeySize returns why the RSA key of cert is shorter than size bits.
+func checkRSAKeySize(cert *x509.Certificate, size int) string {
+	if cert == nil {
+		return ""
+	}
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok || key.N.BitLen() >= size {
+		return ""
+	}
+	return fmt.Sprintf("the RSA key of %s has %d bits, the policy requires %d", cert.Subject.String(), key.N.BitLen(), size)
+}
@@ -0,0 +1,115 @@
+package verify
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/digitorus/timestamp"
+)
+
+func TestPolicyOptions(t *testing.T) {
+	for _, policy := range Policies {
+		if _, err := PolicyOptions(policy); err != nil {
+			t.Errorf("policy %s: %s", policy, err.Error())
+		}
+	}
+
+	options, err := PolicyOptions("")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if !reflect.DeepEqual(options, DefaultVerifyOptions()) {
+		t.Errorf("expected the default options without a policy")
+	}
+
+	strict, err := PolicyOptions(PolicyStrict)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if !strict.RequireNonRepudiation || !strict.RequireTimestamp || !strict.RequireLTV || strict.MinRSAKeySize != 3072 {
+		t.Errorf("expected the strict policy to require non-repudiation, a timestamp, LTV and 3072 bit keys")
+	}
+
+	if _, err := PolicyOptions("lenient"); err == nil {
+		t.Errorf("expected an error for an unknown policy")
+	}
+}
+
+func TestCheckPolicy(t *testing.T) {
+	// Only the size of the modulus matters.
+	certificate := func(bits int) Certificate {
+		return Certificate{Certificate: &x509.Certificate{
+			Subject:   pkix.Name{CommonName: "Signer"},
+			PublicKey: &rsa.PublicKey{N: new(big.Int).Lsh(big.NewInt(1), uint(bits-1)), E: 65537},
+		}}
+	}
+
+	tests := []struct {
+		name       string
+		policy     Policy
+		signer     Signer
+		wantErrors []string
+	}{
+		{
+			name:   "default",
+			policy: PolicyDefault,
+			signer: Signer{SignatureType: "signature", Certificates: []Certificate{certificate(1024)}},
+		},
+		{
+			name:   "baseline",
+			policy: PolicyPAdESBaseline,
+			signer: Signer{
+				SignatureType: "signature",
+				TimeStamp:     &timestamp.Timestamp{},
+				Certificates:  []Certificate{certificate(2048)},
+			},
+		},
+		{
+			name:   "baseline without timestamp",
+			policy: PolicyPAdESBaseline,
+			signer: Signer{SignatureType: "signature", Certificates: []Certificate{certificate(1024)}},
+			wantErrors: []string{
+				"the policy requires a valid signature timestamp",
+				"the RSA key of CN=Signer has 1024 bits, the policy requires 2048",
+			},
+		},
+		{
+			name:   "strict",
+			policy: PolicyStrict,
+			signer: Signer{
+				SignatureType:  "signature",
+				TimeStamp:      &timestamp.Timestamp{},
+				TimestampError: "timestamp message imprint does not match",
+				Certificates:   []Certificate{certificate(3072)},
+			},
+			wantErrors: []string{
+				"the policy requires a valid signature timestamp",
+				"the policy requires the validation data of the signature in the document",
+			},
+		},
+		{
+			// A document timestamp is a timestamp itself.
+			name:   "document timestamp",
+			policy: PolicyStrict,
+			signer: Signer{SignatureType: "document_timestamp", Certificates: []Certificate{certificate(4096)}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options, err := PolicyOptions(tt.policy)
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			signers := []Signer{tt.signer}
+			checkPolicy(signers, options)
+			if !reflect.DeepEqual(signers[0].PolicyErrors, tt.wantErrors) {
+				t.Errorf("expected policy errors %q, got %q", tt.wantErrors, signers[0].PolicyErrors)
+			}
+		})
+	}
+}
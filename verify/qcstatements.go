@@ -0,0 +1,264 @@
+package verify
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"slices"
+)
+
+// OIDs of the QCStatements extension of RFC 3739, the statements of ETSI
+// EN 319 412-5 and the PSD2 statement of ETSI TS 119 495.
+var (
+	oidExtensionQCStatements = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 3}
+
+	oidQcCompliance      = asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 1}
+	oidQcLimitValue      = asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 2}
+	oidQcRetentionPeriod = asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 3}
+	oidQcSSCD            = asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 4}
+	oidQcPDS             = asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 5}
+	oidQcType            = asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 6}
+	oidQcCClegislation   = asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 7}
+
+	oidQcPSD2 = asn1.ObjectIdentifier{0, 4, 0, 19495, 2}
+
+	oidQcTypeESign = asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 6, 1}
+	oidQcTypeESeal = asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 6, 2}
+	oidQcTypeWeb   = asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 6, 3}
+)
+
+// Qualifiers of the services of trusted lists that override the
+// QCStatements of the certificates they issued.
+const (
+	QualifierQCStatement = "http://uri.etsi.org/TrstSvc/TrustedList/SvcInfoExt/QCStatement"
+	QualifierQCWithSSCD  = "http://uri.etsi.org/TrstSvc/TrustedList/SvcInfoExt/QCWithSSCD"
+	QualifierQCWithQSCD  = "http://uri.etsi.org/TrstSvc/TrustedList/SvcInfoExt/QCWithQSCD"
+	QualifierQCNoSSCD    = "http://uri.etsi.org/TrstSvc/TrustedList/SvcInfoExt/QCNoSSCD"
+	QualifierQCNoQSCD    = "http://uri.etsi.org/TrstSvc/TrustedList/SvcInfoExt/QCNoQSCD"
+	QualifierQCForESig   = "http://uri.etsi.org/TrstSvc/TrustedList/SvcInfoExt/QCForESig"
+	QualifierQCForESeal  = "http://uri.etsi.org/TrstSvc/TrustedList/SvcInfoExt/QCForESeal"
+	QualifierQCForWSA    = "http://uri.etsi.org/TrstSvc/TrustedList/SvcInfoExt/QCForWSA"
+)
+
+// Signature levels of ETSI TS 119 615 by the qualification of the signing
+// certificate.
+const (
+	LevelQESig     = "QESig"      // Qualified electronic signature: qualified certificate for signatures on a QSCD
+	LevelQESeal    = "QESeal"     // Qualified electronic seal: qualified certificate for seals on a QSCD
+	LevelAdESigQC  = "AdESig-QC"  // Advanced electronic signature with a qualified certificate
+	LevelAdESealQC = "AdESeal-QC" // Advanced electronic seal with a qualified certificate
+	LevelAdES      = "AdES"       // Advanced electronic signature or seal without a qualified certificate
+)
+
+// QCStatements are the statements of the QCStatements extension of a
+// certificate.
+type QCStatements struct {
+	Compliance      bool            `json:"compliance"`                 // QcCompliance: the certificate is an EU qualified certificate
+	SSCD            bool            `json:"sscd"`                       // QcSSCD: the private key is on a qualified signature creation device
+	Types           []string        `json:"types,omitempty"`            // QcType: "esign", "eseal" or "web"
+	LimitValue      *QCLimitValue   `json:"limit_value,omitempty"`      // QcLimitValue: the limit of transactions
+	RetentionPeriod int             `json:"retention_period,omitempty"` // QcRetentionPeriod: years the registration information is kept
+	PDS             []QCPDSLocation `json:"pds,omitempty"`              // QcPDS: the PKI disclosure statements
+	Legislation     []string        `json:"legislation,omitempty"`      // QcCClegislation: countries of the legislation of a non-EU qualified certificate
+	PSD2            *PSD2Statement  `json:"psd2,omitempty"`             // The PSD2 statement of a payment service provider
+	Statements      []string        `json:"statements"`                 // OIDs of all statements, including those of other standards such as PSD2
+}
+
+// QCLimitValue is the limit of the value of transactions of a qualified
+// certificate, Amount times 10 to the power of Exponent in Currency.
+type QCLimitValue struct {
+	Currency string `json:"currency"` // ISO 4217 alphabetic or numeric code
+	Amount   int    `json:"amount"`
+	Exponent int    `json:"exponent"`
+}
+
+// QCPDSLocation is the location of a PKI disclosure statement.
+type QCPDSLocation struct {
+	URL      string `json:"url"`
+	Language string `json:"language"`
+}
+
+// PSD2Statement is the PSD2 QCStatement of ETSI TS 119 495 in the
+// certificates of payment service providers: their roles and the national
+// competent authority that authorized them.
+type PSD2Statement struct {
+	Roles   []PSD2Role `json:"roles"`
+	NCAName string     `json:"nca_name"` // Name of the national competent authority, such as "Federal Financial Supervisory Authority"
+	NCAID   string     `json:"nca_id"`   // Identifier of the authority, its country code and abbreviation, such as "DE-BAFIN"
+}
+
+// PSD2Role is a role of a payment service provider.
+type PSD2Role struct {
+	OID  string `json:"oid"`  // Such as "0.4.0.19495.1.1"
+	Name string `json:"name"` // "PSP_AS" account servicing, "PSP_PI" payment initiation, "PSP_AI" account information or "PSP_IC" issuing of card-based payment instruments
+}
+
+type qcStatement struct {
+	ID   asn1.ObjectIdentifier
+	Info asn1.RawValue `asn1:"optional"`
+}
+
+type qcMonetaryValue struct {
+	Currency asn1.RawValue
+	Amount   int
+	Exponent int
+}
+
+// parseQCStatements returns the QCStatements of cert, nil if it has no such
+// extension.
+func parseQCStatements(cert *x509.Certificate) (*QCStatements, error) {
+	var value []byte
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidExtensionQCStatements) {
+			value = ext.Value
+		}
+	}
+	if value == nil {
+		return nil, nil
+	}
+
+	var statements []qcStatement
+	if rest, err := asn1.Unmarshal(value, &statements); err != nil {
+		return nil, fmt.Errorf("invalid QCStatements extension: %v", err)
+	} else if len(rest) > 0 {
+		return nil, fmt.Errorf("invalid QCStatements extension: trailing data")
+	}
+
+	qc := &QCStatements{Statements: []string{}}
+	for _, statement := range statements {
+		qc.Statements = append(qc.Statements, statement.ID.String())
+		var err error
+		switch {
+		case statement.ID.Equal(oidQcCompliance):
+			qc.Compliance = true
+		case statement.ID.Equal(oidQcSSCD):
+			qc.SSCD = true
+		case statement.ID.Equal(oidQcType):
+			var types []asn1.ObjectIdentifier
+			if _, err = asn1.Unmarshal(statement.Info.FullBytes, &types); err == nil {
+				for _, t := range types {
+					switch {
+					case t.Equal(oidQcTypeESign):
+						qc.Types = append(qc.Types, "esign")
+					case t.Equal(oidQcTypeESeal):
+						qc.Types = append(qc.Types, "eseal")
+					case t.Equal(oidQcTypeWeb):
+						qc.Types = append(qc.Types, "web")
+					}
+				}
+			}
+		case statement.ID.Equal(oidQcLimitValue):
+			var limit qcMonetaryValue
+			if _, err = asn1.Unmarshal(statement.Info.FullBytes, &limit); err == nil {
+				qc.LimitValue = &QCLimitValue{Amount: limit.Amount, Exponent: limit.Exponent}
+				var code int
+				if _, codeErr := asn1.Unmarshal(limit.Currency.FullBytes, &code); codeErr == nil {
+					qc.LimitValue.Currency = fmt.Sprintf("%03d", code)
+				} else {
+					qc.LimitValue.Currency = string(limit.Currency.Bytes)
+				}
+			}
+		case statement.ID.Equal(oidQcRetentionPeriod):
+			_, err = asn1.Unmarshal(statement.Info.FullBytes, &qc.RetentionPeriod)
+		case statement.ID.Equal(oidQcPDS):
+			var locations []struct {
+				URL      string `asn1:"ia5"`
+				Language string `asn1:"printable"`
+			}
+			if _, err = asn1.Unmarshal(statement.Info.FullBytes, &locations); err == nil {
+				for _, l := range locations {
+					qc.PDS = append(qc.PDS, QCPDSLocation{URL: l.URL, Language: l.Language})
+				}
+			}
+		case statement.ID.Equal(oidQcCClegislation):
+			_, err = asn1.Unmarshal(statement.Info.FullBytes, &qc.Legislation)
+		case statement.ID.Equal(oidQcPSD2):
+			qc.PSD2, err = parsePSD2Statement(statement.Info.FullBytes)
+		}
+		if err != nil {
+			return qc, fmt.Errorf("invalid QC statement %s: %v", statement.ID, err)
+		}
+	}
+	return qc, nil
+}
+
+// parsePSD2Statement parses the PSD2QcType statement info.
+func parsePSD2Statement(der []byte) (*PSD2Statement, error) {
+	var info struct {
+		Roles []struct {
+			OID  asn1.ObjectIdentifier
+			Name string `asn1:"utf8"`
+		}
+		NCAName string `asn1:"utf8"`
+		NCAID   string `asn1:"utf8"`
+	}
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, err
+	}
+
+	psd2 := &PSD2Statement{Roles: []PSD2Role{}, NCAName: info.NCAName, NCAID: info.NCAID}
+	for _, role := range info.Roles {
+		psd2.Roles = append(psd2.Roles, PSD2Role{OID: role.OID.String(), Name: role.Name})
+	}
+	return psd2, nil
+}
+
+// checkQualification sets the QCStatements of the signing certificate of
+// each signature and its signature level. The qualifiers of the trusted
+// list service the chain ends at override the statements of the
+// certificate, as ETSI TS 119 615 describes. Only a trusted chain that ends
+// at a qualified service can make a signature qualified.
+func checkQualification(signers []Signer) {
+	for i := range signers {
+		s := &signers[i]
+		if s.SignatureType != "signature" {
+			continue
+		}
+		cert := signingCertificate(*s)
+		if cert == nil {
+			continue
+		}
+		qc, err := parseQCStatements(cert.Certificate)
+		if err != nil {
+			s.QCStatementsError = err.Error()
+		}
+		s.QCStatements = qc
+		s.SignatureLevel = signatureLevel(qc, s.TrustAnchor, s.TrustedIssuer && s.Qualified)
+	}
+}
+
+// signatureLevel returns the signature level of a signing certificate with
+// the statements qc, with the qualifiers of the anchor. Only a certificate
+// whose trusted chain ends at a granted qualified certificate service of a
+// trusted list, when serviceQualified is set, can be qualified: the
+// statements of other certificates are claims of their issuer or of
+// themselves. Without the QcType a qualified certificate is for signatures.
+func signatureLevel(qc *QCStatements, anchor *TrustAnchor, serviceQualified bool) string {
+	if anchor == nil || !serviceQualified {
+		return LevelAdES
+	}
+	qualifiers := anchor.Qualifiers
+	has := func(q ...string) bool {
+		return slices.ContainsFunc(q, func(q string) bool { return slices.Contains(qualifiers, q) })
+	}
+
+	qualified := qc != nil && qc.Compliance
+	qualified = (qualified || has(QualifierQCStatement)) && !has(QualifierNotQualified)
+	qscd := qc != nil && qc.SSCD
+	qscd = (qscd || has(QualifierQCWithSSCD, QualifierQCWithQSCD)) && !has(QualifierQCNoSSCD, QualifierQCNoQSCD)
+	seal := qc != nil && slices.Contains(qc.Types, "eseal") && !slices.Contains(qc.Types, "esign")
+	seal = (seal || has(QualifierQCForESeal)) && !has(QualifierQCForESig)
+
+	switch {
+	case !qualified:
+		return LevelAdES
+	case seal && qscd:
+		return LevelQESeal
+	case seal:
+		return LevelAdESealQC
+	case qscd:
+		return LevelQESig
+	default:
+		return LevelAdESigQC
+	}
+}
@@ -0,0 +1,254 @@
+package verify
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pkcs7"
+)
+
+// newTestQCStatements returns a certificate with a QCStatements extension of
+// the DER encoded statements.
+func newTestQCStatements(t *testing.T, statements ...[]byte) *x509.Certificate {
+	t.Helper()
+
+	var content []byte
+	for _, s := range statements {
+		content = append(content, s...)
+	}
+	value, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: content})
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	return &x509.Certificate{Extensions: []pkix.Extension{{Id: oidExtensionQCStatements, Value: value}}}
+}
+
+// qcStatementDER returns the DER encoding of the statement id with the
+// statement info, if any.
+func qcStatementDER(t *testing.T, id asn1.ObjectIdentifier, info ...any) []byte {
+	t.Helper()
+
+	var der []byte
+	var err error
+	if len(info) == 0 {
+		der, err = asn1.Marshal(struct{ ID asn1.ObjectIdentifier }{id})
+	} else {
+		der, err = asn1.Marshal(struct {
+			ID   asn1.ObjectIdentifier
+			Info any
+		}{id, info[0]})
+	}
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	return der
+}
+
+func TestParseQCStatements(t *testing.T) {
+	semantics := asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 11, 2}
+	cert := newTestQCStatements(t,
+		qcStatementDER(t, oidQcCompliance),
+		qcStatementDER(t, oidQcSSCD),
+		qcStatementDER(t, oidQcType, []asn1.ObjectIdentifier{oidQcTypeESign}),
+		qcStatementDER(t, oidQcLimitValue, struct {
+			Currency string `asn1:"printable"`
+			Amount   int
+			Exponent int
+		}{"EUR", 1000, 2}),
+		qcStatementDER(t, oidQcRetentionPeriod, 15),
+		qcStatementDER(t, oidQcPDS, []struct {
+			URL      string `asn1:"ia5"`
+			Language string `asn1:"printable"`
+		}{{"https://pds.example.com/en", "en"}}),
+		qcStatementDER(t, semantics),
+	)
+
+	qc, err := parseQCStatements(cert)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	want := &QCStatements{
+		Compliance:      true,
+		SSCD:            true,
+		Types:           []string{"esign"},
+		LimitValue:      &QCLimitValue{Currency: "EUR", Amount: 1000, Exponent: 2},
+		RetentionPeriod: 15,
+		PDS:             []QCPDSLocation{{URL: "https://pds.example.com/en", Language: "en"}},
+		Statements: []string{
+			"0.4.0.1862.1.1", "0.4.0.1862.1.4", "0.4.0.1862.1.6", "0.4.0.1862.1.2",
+			"0.4.0.1862.1.3", "0.4.0.1862.1.5", "1.3.6.1.5.5.7.11.2",
+		},
+	}
+	if !reflect.DeepEqual(qc, want) {
+		t.Errorf("expected statements %+v, got %+v", want, qc)
+	}
+
+	if qc, err := parseQCStatements(&x509.Certificate{}); qc != nil || err != nil {
+		t.Errorf("expected no statements without the extension, got %+v and %v", qc, err)
+	}
+	invalid := &x509.Certificate{Extensions: []pkix.Extension{{Id: oidExtensionQCStatements, Value: []byte{0x30, 0x03}}}}
+	if _, err := parseQCStatements(invalid); err == nil {
+		t.Errorf("expected an error for an invalid extension")
+	}
+}
+
+func TestParsePSD2Statement(t *testing.T) {
+	type role struct {
+		OID  asn1.ObjectIdentifier
+		Name string `asn1:"utf8"`
+	}
+	cert := newTestQCStatements(t,
+		qcStatementDER(t, oidQcCompliance),
+		qcStatementDER(t, oidQcPSD2, struct {
+			Roles   []role
+			NCAName string `asn1:"utf8"`
+			NCAID   string `asn1:"utf8"`
+		}{
+			Roles: []role{
+				{asn1.ObjectIdentifier{0, 4, 0, 19495, 1, 2}, "PSP_PI"},
+				{asn1.ObjectIdentifier{0, 4, 0, 19495, 1, 3}, "PSP_AI"},
+			},
+			NCAName: "Federal Financial Supervisory Authority",
+			NCAID:   "DE-BAFIN",
+		}),
+	)
+
+	qc, err := parseQCStatements(cert)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	want := &PSD2Statement{
+		Roles: []PSD2Role{
+			{OID: "0.4.0.19495.1.2", Name: "PSP_PI"},
+			{OID: "0.4.0.19495.1.3", Name: "PSP_AI"},
+		},
+		NCAName: "Federal Financial Supervisory Authority",
+		NCAID:   "DE-BAFIN",
+	}
+	if !reflect.DeepEqual(qc.PSD2, want) {
+		t.Errorf("expected PSD2 statement %+v, got %+v", want, qc.PSD2)
+	}
+
+	invalid := newTestQCStatements(t, qcStatementDER(t, oidQcPSD2, 1))
+	if _, err := parseQCStatements(invalid); err == nil {
+		t.Errorf("expected an error for an invalid PSD2 statement")
+	}
+}
+
+func TestSignatureLevel(t *testing.T) {
+	qes := &QCStatements{Compliance: true, SSCD: true}
+	qc := &QCStatements{Compliance: true}
+	seal := &QCStatements{Compliance: true, Types: []string{"eseal"}}
+	service := func(qualifiers ...string) *TrustAnchor {
+		return &TrustAnchor{
+			ServiceType:   ServiceTypeCAQC,
+			Qualifiers:    qualifiers,
+			StatusHistory: []TrustServiceStatus{{Status: ServiceStatusGranted}},
+		}
+	}
+
+	tests := []struct {
+		name             string
+		qc               *QCStatements
+		anchor           *TrustAnchor
+		serviceQualified bool
+		want             string
+	}{
+		{name: "no statements", anchor: service(), serviceQualified: true, want: LevelAdES},
+		{name: "not compliant", qc: &QCStatements{SSCD: true}, anchor: service(), serviceQualified: true, want: LevelAdES},
+		{name: "qualified signature", qc: qes, anchor: service(), serviceQualified: true, want: LevelQESig},
+		{name: "qualified certificate", qc: qc, anchor: service(), serviceQualified: true, want: LevelAdESigQC},
+		{name: "qualified seal", qc: &QCStatements{Compliance: true, SSCD: true, Types: []string{"eseal"}}, anchor: service(), serviceQualified: true, want: LevelQESeal},
+		{name: "seal with qualified certificate", qc: seal, anchor: service(), serviceQualified: true, want: LevelAdESealQC},
+		{name: "without trusted list", qc: qes, want: LevelAdES},
+		{name: "service not qualified", qc: qes, anchor: service(), want: LevelAdES},
+		{name: "NotQualified", qc: qes, anchor: service(QualifierNotQualified), serviceQualified: true, want: LevelAdES},
+		{name: "QCWithQSCD", qc: qc, anchor: service(QualifierQCWithQSCD), serviceQualified: true, want: LevelQESig},
+		{name: "QCNoQSCD", qc: qes, anchor: service(QualifierQCNoQSCD), serviceQualified: true, want: LevelAdESigQC},
+		{name: "QCStatement", anchor: service(QualifierQCStatement, QualifierQCForESeal), serviceQualified: true, want: LevelAdESealQC},
+		{name: "QCForESig", qc: seal, anchor: service(QualifierQCForESig), serviceQualified: true, want: LevelAdESigQC},
+		{name: "other anchor", qc: qes, anchor: &TrustAnchor{Source: "pem"}, want: LevelAdES},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if level := signatureLevel(tt.qc, tt.anchor, tt.serviceQualified); level != tt.want {
+				t.Errorf("expected level %s, got %s", tt.want, level)
+			}
+		})
+	}
+}
+
+func TestSelfSignedQualifiedCertificate(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	statements := newTestQCStatements(t, qcStatementDER(t, oidQcCompliance), qcStatementDER(t, oidQcSSCD))
+	template := &x509.Certificate{
+		SerialNumber:    big.NewInt(1),
+		Subject:         pkix.Name{CommonName: "pdfsign Self-Declared Qualified Signer"},
+		NotBefore:       time.Now().Add(-time.Hour),
+		NotAfter:        time.Now().Add(time.Hour),
+		KeyUsage:        x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+		ExtraExtensions: statements.Extensions,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	base, prev := appendRevision([]byte("%PDF-1.7\n"), 0, map[int]string{
+		1: "<< /Type /Catalog /Pages 2 0 R /AcroForm << /Fields [] /SigFlags 3 >> >>",
+		2: "<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		3: "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >>",
+	})
+	sd, err := pkcs7.NewSignedData(base)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	sd.SetDigestAlgorithm(pkcs7.OIDDigestAlgorithmSHA256)
+	if err := sd.AddSigner(cert, key, pkcs7.SignerInfoConfig{}); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	sd.Detach()
+	signature, err := sd.Finish()
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	document, _ := appendRevision(base, prev, map[int]string{
+		10: fmt.Sprintf("<< /Type /Sig /Filter /Adobe.PPKLite /SubFilter /adbe.pkcs7.detached /ByteRange [0 %d %d 0] /Contents <%x> >>", len(base), len(base), signature),
+	})
+
+	// The certificate claims to be qualified, but nothing confirms it
+	options := DefaultVerifyOptions()
+	options.AllowUntrustedRoots = true
+	response, err := VerifyWithOptions(bytes.NewReader(document), int64(len(document)), options)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if len(response.Signers) != 1 {
+		t.Fatalf("expected 1 signer, got %d", len(response.Signers))
+	}
+	signer := response.Signers[0]
+	if !signer.ValidSignature || signer.QCStatements == nil || !signer.QCStatements.Compliance || !signer.QCStatements.SSCD {
+		t.Fatalf("expected a valid signature with the QCStatements of the certificate, got %+v", signer)
+	}
+	if signer.SignatureLevel != LevelAdES {
+		t.Errorf("expected the level %s for a self-signed certificate, got %s", LevelAdES, signer.SignatureLevel)
+	}
+}
@@ -0,0 +1,41 @@
+package verify
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/internal/xref"
+)
+
+// openReader returns the reader of the document file of size bytes. With
+// RepairXref, a document whose cross-reference table can not be read or
+// gives wrong offsets is read with the table rebuilt by xref.Repair, and
+// repaired is true.
+func openReader(file io.ReaderAt, size int64, options *VerifyOptions) (rdr *pdf.Reader, repaired bool, err error) {
+	if options == nil || !options.RepairXref {
+		rdr, err = xref.NewReader(file, size)
+		return rdr, false, err
+	}
+	if rdr, err = readDocument(file, size); err == nil {
+		if err = xref.Check(rdr); err == nil {
+			return rdr, false, nil
+		}
+	}
+	rdr, _, repairErr := xref.Repair(file, size)
+	if repairErr != nil {
+		return nil, false, fmt.Errorf("%v, the cross-reference table can not be repaired: %v", err, repairErr)
+	}
+	return rdr, true, nil
+}
+
+// readDocument returns xref.NewReader of file, with the panics of malformed
+// documents returned as errors.
+func readDocument(file io.ReaderAt, size int64) (rdr *pdf.Reader, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			rdr, err = nil, fmt.Errorf("%v", r)
+		}
+	}()
+	return xref.NewReader(file, size)
+}
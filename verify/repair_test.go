@@ -0,0 +1,44 @@
+package verify
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestVerifyRepairXref(t *testing.T) {
+	// A line inserted before the second revision moves its objects and
+	// cross-reference table away from their offsets, the signed first
+	// revision is unchanged.
+	document, base := newTestSignedDocument(t, 1)
+	broken := append(append(append([]byte(nil), document[:base]...), "% inserted by a scanner\n"...), document[base:]...)
+	if _, err := VerifyWithOptions(bytes.NewReader(broken), int64(len(broken)), DefaultVerifyOptions()); err == nil {
+		t.Errorf("expected the document with a corrupt cross-reference table not to be read")
+	}
+
+	options := DefaultVerifyOptions()
+	options.RepairXref = true
+	for _, tt := range []struct {
+		name     string
+		document []byte
+		repaired bool
+	}{
+		{"corrupt table", broken, true},
+		{"sound table", document, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := VerifyWithOptions(bytes.NewReader(tt.document), int64(len(tt.document)), options)
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if resp.XrefRepaired != tt.repaired {
+				t.Errorf("expected XrefRepaired %v, got %v", tt.repaired, resp.XrefRepaired)
+			}
+			if resp.DocumentInfo.Pages != 1 {
+				t.Errorf("expected 1 page, got %d", resp.DocumentInfo.Pages)
+			}
+			if len(resp.Signers) != 1 || !resp.Signers[0].ValidSignature {
+				t.Fatalf("expected a valid signature, got %+v", resp.Signers)
+			}
+		})
+	}
+}
@@ -0,0 +1,389 @@
+package verify
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// ReportVersion is the version of the Report format. The minor version
+// changes when fields are added, the major version when fields are removed
+// or change their meaning.
+const ReportVersion = "1.14"
+
+// Report is a stable JSON serialization of a verification result for
+// machine consumption. Unlike Response it contains no library types, such as
+// parsed certificates, whose serialization may change.
+type Report struct {
+	Version            string                  `json:"version"`                       // ReportVersion
+	Valid              bool                    `json:"valid"`                         // Whether every signature apart from usage rights signatures has the status "valid"
+	Error              string                  `json:"error,omitempty"`               // First verification error of the document
+	Document           ReportDocument          `json:"document"`                      // Information of the document
+	Signatures         []ReportSignature       `json:"signatures"`                    // Signatures and document timestamps in document order
+	DocumentTimestamps *DocumentTimestampChain `json:"document_timestamps,omitempty"` // Chain of document timestamps, if any
+	Timeline           *Timeline               `json:"timeline,omitempty"`            // Signatures in the order of the revisions of the document
+	PDFA               *PDFAConformance        `json:"pdfa,omitempty"`                // Declared PDF/A conformance, if checked
+	Linearization      *Linearization          `json:"linearization,omitempty"`       // Linearization of the document, if it is linearized
+}
+
+// ReportDocument is the document information of a Report.
+type ReportDocument struct {
+	Title        string     `json:"title,omitempty"`
+	Author       string     `json:"author,omitempty"`
+	Subject      string     `json:"subject,omitempty"`
+	Keywords     []string   `json:"keywords,omitempty"`
+	Creator      string     `json:"creator,omitempty"`
+	Producer     string     `json:"producer,omitempty"`
+	CreationDate *time.Time `json:"creation_date,omitempty"`
+	ModDate      *time.Time `json:"mod_date,omitempty"`
+	Pages        int        `json:"pages"`
+}
+
+// ReportSignature is a signature or document timestamp of a Report.
+type ReportSignature struct {
+	Type        string     `json:"type"`   // "signature", "document_timestamp" or "usage_rights"
+	Status      string     `json:"status"` // "valid", "invalid" or "indeterminate"
+	Name        string     `json:"name,omitempty"`
+	Reason      string     `json:"reason,omitempty"`
+	Location    string     `json:"location,omitempty"`
+	ContactInfo string     `json:"contact_info,omitempty"`
+	SigningTime *time.Time `json:"signing_time,omitempty"` // Claimed by the signer, not proven
+
+	SigningTimeWarnings []string   `json:"signing_time_warnings,omitempty"` // Inconsistencies of the signing time with the timestamp and the signing certificate
+	ProvenTime          *time.Time `json:"proven_time,omitempty"`           // Earliest time the signature is proven to have existed
+	ProvenBy            string     `json:"proven_by,omitempty"`             // "signature_timestamp" or "document_timestamp"
+
+	Integrity     ReportIntegrity     `json:"integrity"`
+	Chain         ReportChain         `json:"chain"`
+	Timestamp     *ReportTimestamp    `json:"timestamp,omitempty"` // Signature timestamp or the document timestamp itself
+	Modifications ReportModifications `json:"modifications"`
+	LTV           ReportLTV           `json:"ltv"`
+	PolicyErrors  []string            `json:"policy_errors,omitempty"` // Requirements of the verification policy the signature does not meet
+
+	SignatureLevel string        `json:"signature_level,omitempty"` // Such as "QESig", by the qualification of the signing certificate
+	QCStatements   *QCStatements `json:"qc_statements,omitempty"`   // Statements of the QCStatements extension of the signing certificate
+
+	Countersignatures []Countersignature `json:"countersignatures,omitempty"` // CMS countersignatures of the signature value
+
+	UsageRights *UsageRights `json:"usage_rights,omitempty"` // Rights enabled by a usage rights signature
+
+	Hidden             bool     `json:"hidden"`                        // Whether no widget of the signature field can be seen
+	VisibilityWarnings []string `json:"visibility_warnings,omitempty"` // Why widgets of the signature field cannot be seen
+
+	AppearanceText       string   `json:"appearance_text,omitempty"`       // Text shown by the appearance of the signature field
+	AppearanceMismatches []string `json:"appearance_mismatches,omitempty"` // How the appearance contradicts the signing certificate or the signing time
+
+	ErrorCodes []string `json:"error_codes,omitempty"` // Codes of the causes of the failure of the signature, such as "digest_mismatch"
+}
+
+// ReportIntegrity is the cryptographic integrity of a signature.
+type ReportIntegrity struct {
+	SignatureValid  bool     `json:"signature_valid"` // Whether the signature matches the signed bytes
+	ByteRangeValid  bool     `json:"byte_range_valid"`
+	ByteRangeErrors []string `json:"byte_range_errors,omitempty"`
+	UnsignedBytes   int64    `json:"unsigned_bytes,omitempty"`
+
+	ContentsAnomalies []string `json:"contents_anomalies,omitempty"` // Data in the signature contents besides the signature and its zero padding
+
+	DigestAlgorithm string   `json:"digest_algorithm,omitempty"` // Such as "SHA-256"
+	WeakAlgorithms  []string `json:"weak_algorithms,omitempty"`  // Weak digest algorithms, keys and curves at the validation time
+
+	ByteRange       []int64 `json:"byte_range,omitempty"`        // Offset and length pairs of the signed bytes
+	ByteRangeDigest string  `json:"byte_range_digest,omitempty"` // Hex digest of the signed bytes with DigestAlgorithm
+	MessageDigest   string  `json:"message_digest,omitempty"`    // Hex digest the signature signs
+	Revision        int     `json:"revision,omitempty"`          // Revision covered by the signature, 1 for the original document
+	RevisionStart   int64   `json:"revision_start"`              // Offset of the first byte of that revision
+	RevisionEnd     int64   `json:"revision_end,omitempty"`      // Offset after the last byte of that revision
+}
+
+// ReportChain is the certificate chain of a signature, signing certificate
+// first.
+type ReportChain struct {
+	Trusted          bool                `json:"trusted"`
+	Revoked          bool                `json:"revoked"`
+	ValidationTime   *time.Time          `json:"validation_time,omitempty"`
+	TimeSource       string              `json:"time_source,omitempty"` // "embedded_timestamp", "signature_time", "current_time" or "validation_time"
+	TimeWarnings     []string            `json:"time_warnings,omitempty"`
+	Certificates     []ReportCertificate `json:"certificates"`
+	ValidationErrors []string            `json:"validation_errors,omitempty"` // Verification errors of the certificates
+
+	TrustAnchor *TrustAnchor `json:"trust_anchor,omitempty"` // Anchor of a TrustProvider the chain ends at
+	Qualified   bool         `json:"qualified"`              // Whether the anchor is a granted qualified certificate service
+
+	TrustSources []string `json:"trust_sources,omitempty"` // Sources of the anchors the chain ends at, such as "aatl"
+}
+
+// ReportCertificate is a certificate of a ReportChain.
+type ReportCertificate struct {
+	Subject          string           `json:"subject"`
+	Issuer           string           `json:"issuer"`
+	SerialNumber     string           `json:"serial_number"` // Hex encoded
+	NotBefore        time.Time        `json:"not_before"`
+	NotAfter         time.Time        `json:"not_after"`
+	SHA256           string           `json:"sha256"` // Hex encoded fingerprint of the DER certificate
+	VerifyError      string           `json:"verify_error,omitempty"`
+	Expired          bool             `json:"expired"`
+	ExpiryError      string           `json:"expiry_error,omitempty"`
+	KeyUsageValid    bool             `json:"key_usage_valid"`
+	KeyUsageError    string           `json:"key_usage_error,omitempty"`
+	ExtKeyUsageValid bool             `json:"ext_key_usage_valid"`
+	ExtKeyUsageError string           `json:"ext_key_usage_error,omitempty"`
+	Revocation       ReportRevocation `json:"revocation"`
+}
+
+// ReportRevocation is the revocation status of a ReportCertificate.
+type ReportRevocation struct {
+	OCSPEmbedded         bool       `json:"ocsp_embedded"`
+	OCSPExternal         bool       `json:"ocsp_external"`
+	OCSPStatus           string     `json:"ocsp_status,omitempty"` // "good", "revoked" or "unknown"
+	OCSPThisUpdate       *time.Time `json:"ocsp_this_update,omitempty"`
+	OCSPNextUpdate       *time.Time `json:"ocsp_next_update,omitempty"`
+	OCSPError            string     `json:"ocsp_error,omitempty"`
+	CRLEmbedded          bool       `json:"crl_embedded"`
+	CRLExternal          bool       `json:"crl_external"`
+	CRLError             string     `json:"crl_error,omitempty"`
+	Revoked              bool       `json:"revoked"`
+	RevocationTime       *time.Time `json:"revocation_time,omitempty"`
+	RevokedBeforeSigning bool       `json:"revoked_before_signing"`
+	Warning              string     `json:"warning,omitempty"`
+}
+
+// ReportTimestamp is a timestamp token of a signature.
+type ReportTimestamp struct {
+	Status  string     `json:"status"` // "valid", "invalid" or "missing"
+	Time    *time.Time `json:"time,omitempty"`
+	Trusted bool       `json:"trusted"`
+	Error   string     `json:"error,omitempty"`
+}
+
+// ReportModifications are the changes by the revisions after a signature.
+type ReportModifications struct {
+	ModifiedAfterSigning bool           `json:"modified_after_signing"`
+	Disallowed           bool           `json:"disallowed"`
+	Changes              []Modification `json:"changes,omitempty"`
+	Error                string         `json:"error,omitempty"`
+	ShadowAttacks        []ShadowAttack `json:"shadow_attacks,omitempty"`
+	CertificationLevel   int            `json:"certification_level,omitempty"`
+	DocMDPViolations     []string       `json:"docmdp_violations,omitempty"`
+	FieldLocks           []FieldLock    `json:"field_locks,omitempty"`
+	FieldMDPViolations   []string       `json:"fieldmdp_violations,omitempty"`
+}
+
+// ReportLTV is the long-term validation status of a signature.
+type ReportLTV struct {
+	Enabled                    bool   `json:"enabled"`
+	Error                      string `json:"error,omitempty"`
+	DocumentTimestampProtected bool   `json:"document_timestamp_protected"`
+}
+
+// Report returns the verification result as Report.
+func (r *Response) Report() *Report {
+	report := &Report{
+		Version:            ReportVersion,
+		Error:              r.Error,
+		Document:           newReportDocument(r.DocumentInfo),
+		Signatures:         make([]ReportSignature, 0, len(r.Signers)),
+		DocumentTimestamps: r.DocumentTimestamps,
+		Timeline:           r.Timeline,
+		PDFA:               r.PDFA,
+		Linearization:      r.Linearization,
+	}
+	// Usage rights signatures enable features of PDF processors, they do not
+	// sign the document for a signer and are validated separately.
+	signatures, valid := 0, true
+	for _, s := range r.Signers {
+		signature := newReportSignature(s)
+		if s.SignatureType != "usage_rights" {
+			signatures++
+			valid = valid && signature.Status == "valid"
+		}
+		report.Signatures = append(report.Signatures, signature)
+	}
+	report.Valid = signatures > 0 && valid
+	return report
+}
+
+// MarshalReport returns the JSON encoding of the Report of the verification
+// result.
+func (r *Response) MarshalReport() ([]byte, error) {
+	return json.Marshal(r.Report())
+}
+
+func newReportDocument(info DocumentInfo) ReportDocument {
+	document := ReportDocument{
+		Title:    info.Title,
+		Author:   info.Author,
+		Subject:  info.Subject,
+		Keywords: info.Keywords,
+		Creator:  info.Creator,
+		Producer: info.Producer,
+		Pages:    info.Pages,
+	}
+	if !info.CreationDate.IsZero() {
+		document.CreationDate = &info.CreationDate
+	}
+	if !info.ModDate.IsZero() {
+		document.ModDate = &info.ModDate
+	}
+	return document
+}
+
+func newReportSignature(s Signer) ReportSignature {
+	signature := ReportSignature{
+		Type:        s.SignatureType,
+		Status:      signatureStatus(s),
+		Name:        s.Name,
+		Reason:      s.Reason,
+		Location:    s.Location,
+		ContactInfo: s.ContactInfo,
+		SigningTime: s.SignatureTime,
+
+		SigningTimeWarnings: s.SigningTimeWarnings,
+		ProvenTime:          s.ProvenTime,
+		ProvenBy:            s.ProvenBy,
+
+		Integrity: ReportIntegrity{
+			SignatureValid:  s.ValidSignature,
+			ByteRangeValid:  s.ByteRangeValid,
+			ByteRangeErrors: s.ByteRangeErrors,
+			UnsignedBytes:   s.UnsignedBytes,
+
+			ContentsAnomalies: s.ContentsAnomalies,
+
+			DigestAlgorithm: s.DigestAlgorithm,
+			WeakAlgorithms:  s.WeakAlgorithms,
+
+			ByteRange:       s.ByteRange,
+			ByteRangeDigest: s.ByteRangeDigest,
+			MessageDigest:   s.MessageDigest,
+			Revision:        s.Revision,
+			RevisionStart:   s.RevisionStart,
+			RevisionEnd:     s.RevisionEnd,
+		},
+		Chain: ReportChain{
+			Trusted:        s.TrustedIssuer,
+			Revoked:        s.RevokedCertificate,
+			ValidationTime: s.VerificationTime,
+			TimeSource:     s.TimeSource,
+			TimeWarnings:   s.TimeWarnings,
+			Certificates:   make([]ReportCertificate, 0, len(s.Certificates)),
+			TrustAnchor:    s.TrustAnchor,
+			Qualified:      s.Qualified,
+			TrustSources:   s.TrustSources,
+		},
+		Modifications: ReportModifications{
+			ModifiedAfterSigning: s.ModifiedAfterSigning,
+			Disallowed:           s.DisallowedModifications,
+			Changes:              s.Modifications,
+			Error:                s.ModificationError,
+			ShadowAttacks:        s.ShadowAttacks,
+			CertificationLevel:   s.CertificationLevel,
+			DocMDPViolations:     s.DocMDPViolations,
+			FieldLocks:           s.FieldLocks,
+			FieldMDPViolations:   s.FieldMDPViolations,
+		},
+		LTV: ReportLTV{
+			Enabled:                    s.LTVEnabled,
+			Error:                      s.LTVError,
+			DocumentTimestampProtected: s.DocumentTimestampProtected,
+		},
+		PolicyErrors:   s.PolicyErrors,
+		SignatureLevel: s.SignatureLevel,
+		QCStatements:   s.QCStatements,
+
+		Countersignatures: s.Countersignatures,
+
+		UsageRights: s.UsageRights,
+
+		Hidden:             s.Hidden,
+		VisibilityWarnings: s.VisibilityWarnings,
+
+		AppearanceText:       s.AppearanceText,
+		AppearanceMismatches: s.AppearanceMismatches,
+
+		ErrorCodes: errorCodes(s.Err()),
+	}
+
+	for _, c := range s.Certificates {
+		if c.Certificate == nil {
+			continue
+		}
+		if c.VerifyError != "" {
+			signature.Chain.ValidationErrors = append(signature.Chain.ValidationErrors, c.VerifyError)
+		}
+		if c.ExpiryError != "" {
+			signature.Chain.ValidationErrors = append(signature.Chain.ValidationErrors, c.ExpiryError)
+		}
+		signature.Chain.Certificates = append(signature.Chain.Certificates, newReportCertificate(c))
+	}
+
+	if s.TimestampStatus != "" || s.TimeStamp != nil {
+		status := s.TimestampStatus
+		if status == "" {
+			status = "valid"
+			if s.TimestampError != "" {
+				status = "invalid"
+			}
+		}
+		signature.Timestamp = &ReportTimestamp{
+			Status:  status,
+			Time:    s.TimestampTime,
+			Trusted: s.TimestampTrusted,
+			Error:   s.TimestampError,
+		}
+		if s.SignatureType == "document_timestamp" && s.TimeStamp != nil {
+			signature.Timestamp.Time = &s.TimeStamp.Time
+		}
+	}
+	return signature
+}
+
+func newReportCertificate(c Certificate) ReportCertificate {
+	fingerprint := sha256.Sum256(c.Certificate.Raw)
+	certificate := ReportCertificate{
+		Subject:          c.Certificate.Subject.String(),
+		Issuer:           c.Certificate.Issuer.String(),
+		SerialNumber:     hex.EncodeToString(c.Certificate.SerialNumber.Bytes()),
+		NotBefore:        c.Certificate.NotBefore,
+		NotAfter:         c.Certificate.NotAfter,
+		SHA256:           hex.EncodeToString(fingerprint[:]),
+		VerifyError:      c.VerifyError,
+		Expired:          c.Expired,
+		ExpiryError:      c.ExpiryError,
+		KeyUsageValid:    c.KeyUsageValid,
+		KeyUsageError:    c.KeyUsageError,
+		ExtKeyUsageValid: c.ExtKeyUsageValid,
+		ExtKeyUsageError: c.ExtKeyUsageError,
+		Revocation: ReportRevocation{
+			OCSPEmbedded:         c.OCSPEmbedded,
+			OCSPExternal:         c.OCSPExternal,
+			OCSPStatus:           c.OCSPStatus,
+			OCSPThisUpdate:       c.OCSPThisUpdate,
+			OCSPNextUpdate:       c.OCSPNextUpdate,
+			OCSPError:            c.OCSPError,
+			CRLEmbedded:          c.CRLEmbedded,
+			CRLExternal:          c.CRLExternal,
+			CRLError:             c.CRLError,
+			Revoked:              c.RevocationTime != nil || !c.CRLRevoked.IsZero(),
+			RevocationTime:       c.RevocationTime,
+			RevokedBeforeSigning: c.RevokedBeforeSigning,
+			Warning:              c.RevocationWarning,
+		},
+	}
+	return certificate
+}
+
+// signatureStatus returns "invalid" for a signature that does not match the
+// document, does not cover its revision, is revoked, was followed by
+// disallowed changes or does not meet the verification policy, "valid" for a signature by a trusted chain with a
+// valid timestamp, if any, and "indeterminate" otherwise.
+func signatureStatus(s Signer) string {
+	switch {
+	case !s.ValidSignature, !s.ByteRangeValid, s.RevokedCertificate, s.DisallowedModifications, len(s.PolicyErrors) > 0:
+		return "invalid"
+	case !s.TrustedIssuer, s.TimestampError != "":
+		return "indeterminate"
+	}
+	return "valid"
+}
@@ -0,0 +1,101 @@
+package verify
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSignatureStatus(t *testing.T) {
+	valid := Signer{ValidSignature: true, ByteRangeValid: true, TrustedIssuer: true}
+
+	tests := []struct {
+		name   string
+		modify func(s *Signer)
+		want   string
+	}{
+		{name: "valid", modify: func(s *Signer) {}, want: "valid"},
+		{name: "invalid signature", modify: func(s *Signer) { s.ValidSignature = false }, want: "invalid"},
+		{name: "byte range", modify: func(s *Signer) { s.ByteRangeValid = false }, want: "invalid"},
+		{name: "revoked", modify: func(s *Signer) { s.RevokedCertificate = true }, want: "invalid"},
+		{name: "disallowed modifications", modify: func(s *Signer) { s.DisallowedModifications = true }, want: "invalid"},
+		{name: "untrusted", modify: func(s *Signer) { s.TrustedIssuer = false }, want: "indeterminate"},
+		{name: "invalid timestamp", modify: func(s *Signer) { s.TimestampError = "timestamp message imprint does not match" }, want: "indeterminate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := valid
+			tt.modify(&s)
+			if got := signatureStatus(s); got != tt.want {
+				t.Errorf("expected status %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestReport(t *testing.T) {
+	file, err := os.Open(filepath.Join("..", "testfiles", "testfile30.pdf"))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	response, err := VerifyFile(file)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	report := response.Report()
+	if report.Version != ReportVersion {
+		t.Errorf("expected version %s, got %s", ReportVersion, report.Version)
+	}
+	if len(report.Signatures) != len(response.Signers) {
+		t.Fatalf("expected %d signatures, got %d", len(response.Signers), len(report.Signatures))
+	}
+	for i, signature := range report.Signatures {
+		signer := response.Signers[i]
+		if signature.Status != signatureStatus(signer) || signature.Integrity.SignatureValid != signer.ValidSignature {
+			t.Errorf("signature %d does not match the signer", i+1)
+		}
+		if len(signature.Chain.Certificates) != len(signer.Certificates) {
+			t.Errorf("signature %d: expected %d certificates, got %d", i+1, len(signer.Certificates), len(signature.Chain.Certificates))
+		}
+		for _, certificate := range signature.Chain.Certificates {
+			if certificate.Subject == "" || len(certificate.SHA256) != 64 {
+				t.Errorf("signature %d: expected the subject and fingerprint of the certificate", i+1)
+			}
+		}
+	}
+	if report.Valid != (len(report.Signatures) > 0 && report.Signatures[0].Status == "valid") {
+		t.Errorf("expected the report to be valid only with valid signatures")
+	}
+
+	// The fields of the report are part of its format.
+	data, err := response.MarshalReport()
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	var decoded map[string]json.RawMessage
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	for _, key := range []string{"version", "valid", "document", "signatures"} {
+		if _, ok := decoded[key]; !ok {
+			t.Errorf("expected report field %q", key)
+		}
+	}
+
+	var signatures []map[string]json.RawMessage
+	if err := json.Unmarshal(decoded["signatures"], &signatures); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	for _, key := range []string{"type", "status", "integrity", "chain", "modifications", "ltv"} {
+		if _, ok := signatures[0][key]; !ok {
+			t.Errorf("expected signature field %q", key)
+		}
+	}
+}
@@ -63,6 +63,22 @@ func TestIsRevokedBeforeSigning(t *testing.T) {
 			expected:       true,
 			description:    "Using untrusted signature time - must be conservative",
 		},
+		{
+			name:           "Revoked before the validation time",
+			revocationTime: revocationBefore,
+			signingTime:    &signingTime,
+			timeSource:     "validation_time",
+			expected:       true,
+			description:    "Certificate revoked before the chosen validation time - signature should be invalid",
+		},
+		{
+			name:           "Revoked after the validation time",
+			revocationTime: revocationAfter,
+			signingTime:    &signingTime,
+			timeSource:     "validation_time",
+			expected:       false,
+			description:    "Certificate revoked after the chosen validation time - signature should remain valid",
+		},
 		{
 			name:           "Unknown time source",
 			revocationTime: revocationAfter,
@@ -0,0 +1,175 @@
+package verify
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// RevocationBundle holds OCSP responses and CRLs fetched in advance, for the
+// verification of documents without network access. The certificates whose
+// revocation data is not embedded in the document are checked against the
+// bundle like the responses of external revocation checks, before the OCSP
+// responders and CRL distribution points are contacted, if they are at all.
+// A bundle must not be changed while it is used by a verification.
+type RevocationBundle struct {
+	ocsp map[string][][]byte // DER OCSP responses by the hex serial number of their certificate
+	crls []*x509.RevocationList
+}
+
+// NewRevocationBundle returns an empty RevocationBundle.
+func NewRevocationBundle() *RevocationBundle {
+	return &RevocationBundle{ocsp: make(map[string][][]byte)}
+}
+
+// LoadRevocationBundle returns a RevocationBundle with the OCSP responses and
+// CRLs of the files in dir, each DER or PEM encoded. Files of other data are
+// an error, subdirectories are ignored.
+func LoadRevocationBundle(dir string) (*RevocationBundle, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read revocation bundle: %w", err)
+	}
+	b := NewRevocationBundle()
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read revocation bundle: %w", err)
+		}
+		if err := b.Add(data); err != nil {
+			return nil, fmt.Errorf("failed to read revocation bundle %s: %w", path, err)
+		}
+	}
+	return b, nil
+}
+
+// Add adds the OCSP response or CRL data, DER encoded, or the PEM blocks of
+// data of type "X509 CRL" and "OCSP RESPONSE".
+func (b *RevocationBundle) Add(data []byte) error {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN")) {
+		if b.AddCRL(data) == nil {
+			return nil
+		}
+		if b.AddOCSPResponse(data) == nil {
+			return nil
+		}
+		return errors.New("neither an OCSP response nor a CRL")
+	}
+
+	for n := 0; ; n++ {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil && n == 0 {
+			return errors.New("no PEM block")
+		}
+		if block == nil {
+			return nil
+		}
+		var err error
+		switch block.Type {
+		case "X509 CRL":
+			err = b.AddCRL(block.Bytes)
+		case "OCSP RESPONSE":
+			err = b.AddOCSPResponse(block.Bytes)
+		default:
+			err = fmt.Errorf("unexpected PEM block %q", block.Type)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// AddOCSPResponse adds the DER encoded OCSP response.
+func (b *RevocationBundle) AddOCSPResponse(der []byte) error {
+	// The signature is verified when the response is used, with the issuer
+	// of the certificate.
+	resp, err := ocsp.ParseResponse(der, nil)
+	if err != nil {
+		return fmt.Errorf("invalid OCSP response: %w", err)
+	}
+	if b.ocsp == nil {
+		b.ocsp = make(map[string][][]byte)
+	}
+	serial := fmt.Sprintf("%x", resp.SerialNumber)
+	b.ocsp[serial] = append(b.ocsp[serial], der)
+	return nil
+}
+
+// AddCRL adds the DER encoded CRL.
+func (b *RevocationBundle) AddCRL(der []byte) error {
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		return fmt.Errorf("invalid CRL: %w", err)
+	}
+	b.crls = append(b.crls, crl)
+	return nil
+}
+
+// ocspResponse returns the OCSP response of the bundle for cert by issuer
+// that is the most recent of those that have not expired at t.
+func (b *RevocationBundle) ocspResponse(cert, issuer *x509.Certificate, t time.Time) (*ocsp.Response, error) {
+	if issuer == nil {
+		return nil, errors.New("issuer certificate not found")
+	}
+	var found *ocsp.Response
+	lastErr := errors.New("no OCSP response for the certificate in the revocation bundle")
+	for _, der := range b.ocsp[fmt.Sprintf("%x", cert.SerialNumber)] {
+		resp, err := ocsp.ParseResponseForCert(der, cert, issuer)
+		switch {
+		case err != nil:
+			lastErr = fmt.Errorf("invalid OCSP response in the revocation bundle: %v", err)
+		case !resp.NextUpdate.IsZero() && resp.NextUpdate.Before(t):
+			lastErr = fmt.Errorf("OCSP response in the revocation bundle expired at %v", resp.NextUpdate)
+		case found == nil || resp.ThisUpdate.After(found.ThisUpdate):
+			found = resp
+		}
+	}
+	if found == nil {
+		return nil, lastErr
+	}
+	return found, nil
+}
+
+// crlStatus returns the revocation time of cert by the CRL of issuer in the
+// bundle that is the most recent of those that have not expired at t.
+func (b *RevocationBundle) crlStatus(cert, issuer *x509.Certificate, t time.Time) (*time.Time, bool, error) {
+	if issuer == nil {
+		return nil, false, errors.New("issuer certificate not found")
+	}
+	var found *x509.RevocationList
+	lastErr := fmt.Errorf("no CRL of %s in the revocation bundle", issuer.Subject)
+	for _, crl := range b.crls {
+		if !bytes.Equal(crl.RawIssuer, issuer.RawSubject) {
+			continue
+		}
+		switch err := crl.CheckSignatureFrom(issuer); {
+		case err != nil:
+			lastErr = fmt.Errorf("invalid CRL signature in the revocation bundle: %v", err)
+		case !crl.NextUpdate.IsZero() && crl.NextUpdate.Before(t):
+			lastErr = fmt.Errorf("CRL of %s in the revocation bundle expired at %v", issuer.Subject, crl.NextUpdate)
+		case found == nil || crl.ThisUpdate.After(found.ThisUpdate):
+			found = crl
+		}
+	}
+	if found == nil {
+		return nil, false, lastErr
+	}
+	for _, revoked := range found.RevokedCertificateEntries {
+		if revoked.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+			return &revoked.RevocationTime, true, nil
+		}
+	}
+	return nil, false, nil
+}
@@ -0,0 +1,143 @@
+package verify
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestRevocationBundle(t *testing.T) {
+	issuer, issuerKey := newTestCRLIssuer(t, "pdfsign Test CRL Issuer")
+	other, otherKey := newTestCRLIssuer(t, "pdfsign Other CRL Issuer")
+
+	newLeaf := func(serial int64) *x509.Certificate {
+		// The distribution points cannot be reached, the bundle is checked
+		// without requests.
+		leaf, _ := newTestLeaf(t, issuer, issuerKey, serial, func(template *x509.Certificate) {
+			template.OCSPServer = []string{"http://127.0.0.1:1/ocsp"}
+			template.CRLDistributionPoints = []string{"http://127.0.0.1:1/ca.crl"}
+		})
+		return leaf
+	}
+	newOCSP := func(serial int64, status int, thisUpdate time.Time) []byte {
+		response, err := ocsp.CreateResponse(issuer, issuer, ocsp.Response{
+			Status:       status,
+			SerialNumber: big.NewInt(serial),
+			ThisUpdate:   thisUpdate,
+			NextUpdate:   thisUpdate.Add(24 * time.Hour),
+			RevokedAt:    thisUpdate,
+		}, issuerKey)
+		if err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+		return response
+	}
+
+	now := time.Now()
+	bundle := NewRevocationBundle()
+	for _, data := range [][]byte{
+		newTestCRL(t, other, otherKey, now.Add(time.Hour), 10),
+		newTestCRL(t, issuer, issuerKey, now.Add(time.Hour), 11),
+		newOCSP(10, ocsp.Revoked, now.Add(-48*time.Hour)),
+		newOCSP(10, ocsp.Good, now.Add(-time.Hour)),
+		newOCSP(11, ocsp.Revoked, now.Add(-time.Hour)),
+	} {
+		if err := bundle.Add(data); err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+	}
+	options := &VerifyOptions{RevocationBundle: bundle}
+
+	good, revoked, missing := newLeaf(10), newLeaf(11), newLeaf(12)
+
+	// The most recent response that has not expired applies.
+	if resp, err := performExternalOCSPCheck(good, issuer, options); err != nil || resp.Status != ocsp.Good {
+		t.Errorf("expected a good OCSP status, got %v (%v)", resp, err)
+	}
+	if resp, err := performExternalOCSPCheck(revoked, issuer, options); err != nil || resp.Status != ocsp.Revoked {
+		t.Errorf("expected a revoked OCSP status, got %v (%v)", resp, err)
+	}
+	if _, err := performExternalOCSPCheck(missing, issuer, options); err == nil || !strings.Contains(err.Error(), "no OCSP response") {
+		t.Errorf("expected no OCSP response, got %v", err)
+	}
+
+	// The CRL of the other issuer does not apply.
+	if _, isRevoked, err := performExternalCRLCheck(good, issuer, options); err != nil || isRevoked {
+		t.Errorf("expected the certificate not to be revoked, got %t (%v)", isRevoked, err)
+	}
+	if _, isRevoked, err := performExternalCRLCheck(revoked, issuer, options); err != nil || !isRevoked {
+		t.Errorf("expected the certificate to be revoked, got %t (%v)", isRevoked, err)
+	}
+
+	// Data that has expired at the validation time is not used.
+	options.ValidationTime = now.Add(48 * time.Hour)
+	if _, err := performExternalOCSPCheck(good, issuer, options); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("expected an expired OCSP response, got %v", err)
+	}
+	if _, _, err := performExternalCRLCheck(good, issuer, options); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("expected an expired CRL, got %v", err)
+	}
+
+	if _, err := performExternalOCSPCheck(good, issuer, &VerifyOptions{}); err == nil {
+		t.Errorf("expected no check without external checking or a revocation bundle")
+	}
+}
+
+func TestLoadRevocationBundle(t *testing.T) {
+	issuer, issuerKey := newTestCRLIssuer(t, "pdfsign Test CRL Issuer")
+	response, err := ocsp.CreateResponse(issuer, issuer, ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: big.NewInt(10),
+		ThisUpdate:   time.Now().Add(-time.Minute),
+		NextUpdate:   time.Now().Add(time.Hour),
+	}, issuerKey)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"ca.crl":    newTestCRL(t, issuer, issuerKey, time.Now().Add(time.Hour), 11),
+		"leaf.pem":  pem.EncodeToMemory(&pem.Block{Type: "OCSP RESPONSE", Bytes: response}),
+		"chain.pem": pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: newTestCRL(t, issuer, issuerKey, time.Now().Add(time.Hour))}),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "archive"), 0o700); err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	bundle, err := LoadRevocationBundle(dir)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if len(bundle.crls) != 2 || len(bundle.ocsp["a"]) != 1 {
+		t.Errorf("expected 2 CRLs and an OCSP response, got %d and %d", len(bundle.crls), len(bundle.ocsp["a"]))
+	}
+
+	for name, data := range map[string][]byte{
+		"certificate.pem": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: issuer.Raw}),
+		"notes.txt":       []byte("not revocation data"),
+	} {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+		if _, err := LoadRevocationBundle(dir); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, err := LoadRevocationBundle(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("expected an error for a missing directory")
+	}
+}
@@ -0,0 +1,161 @@
+package verify
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/internal/xref"
+)
+
+// detectShadowAttacks reports the changes after the signed revision of each
+// signer in the document rdr that match the patterns of shadow attacks, see
+// Mainka et al., "Shadow Attacks: Hiding and Replacing Content in Signed
+// PDFs", NDSS 2021. Such attacks prepare content in the signed revision, so
+// that changes that are permitted after signing reveal or swap it: objects of
+// the signed revision that are used by no page or structure when signed but
+// by a later revision (hide-and-replace), annotations that are moved,
+// resized, hidden or shown (hide), and appearances replaced without a change
+// of the value of their form field or values of read-only fields changed
+// (replace). The modifications of the signers must have been detected.
+func detectShadowAttacks(file io.ReaderAt, rdr *pdf.Reader, signers []Signer) {
+	var used map[uint32]bool
+	for i := range signers {
+		s := &signers[i]
+		if !s.ModifiedAfterSigning || s.ModificationError != "" || s.RevisionEnd <= 0 {
+			continue
+		}
+		if used == nil {
+			used = usedObjects(rdr)
+		}
+		s.ShadowAttacks = shadowAttacks(file, s.RevisionEnd, rdr, used, s.Modifications)
+	}
+}
+
+// shadowAttacks returns the shadow attack patterns of the changes after the
+// signed revision that ends at end, by the modifications, in the document
+// rdr, of which used are the objects in use.
+func shadowAttacks(file io.ReaderAt, end int64, rdr *pdf.Reader, used map[uint32]bool, modifications []Modification) (attacks []ShadowAttack) {
+	defer func() {
+		if r := recover(); r != nil {
+			attacks = nil
+		}
+	}()
+	signed, err := xref.NewReader(io.NewSectionReader(file, 0, end), end)
+	if err != nil {
+		return nil
+	}
+
+	signedUsed := usedObjects(signed)
+	xrefs := rdr.Xref()
+	for _, x := range signed.Xref() {
+		ptr := x.Ptr()
+		id := ptr.GetID()
+		if id == 0 || signedUsed[id] || !used[id] || int(id) >= len(xrefs) || xrefs[id].Ptr() != ptr {
+			continue
+		}
+		previous := signed.Resolve(ptr, ptr)
+		switch previous.Key("Type").Name() {
+		case "XRef", "ObjStm":
+			continue
+		}
+		if previous.IsNull() || !sameValue(previous, rdr.Resolve(ptr, ptr)) {
+			continue
+		}
+		attacks = append(attacks, ShadowAttack{
+			Pattern:     "hide_and_replace",
+			Object:      fmt.Sprintf("%d %d R", id, ptr.GetGen()),
+			Description: fmt.Sprintf("object %d %d R of the signed revision, used by nothing when signed, is used by a later revision", id, ptr.GetGen()),
+		})
+	}
+
+	for _, m := range modifications {
+		if m.Added || m.Type != "annotation" && m.Type != "form_fill" {
+			continue
+		}
+		var id uint32
+		var gen uint16
+		if _, err := fmt.Sscanf(m.Object, "%d %d R", &id, &gen); err != nil || int(id) >= len(xrefs) {
+			continue
+		}
+		ptr := xrefs[id].Ptr()
+		previous, current := signed.Resolve(ptr, ptr), rdr.Resolve(ptr, ptr)
+		if previous.IsNull() {
+			continue
+		}
+		attack := func(pattern, format string, args ...any) {
+			attacks = append(attacks, ShadowAttack{Pattern: pattern, Object: m.Object, Description: fmt.Sprintf(format, args...)})
+		}
+
+		hiding := int64(annotationHidden | annotationNoView)
+		if before, after := previous.Key("F").Int64()&hiding, current.Key("F").Int64()&hiding; before != after {
+			if after == 0 {
+				attack("hide", "%s shown by a later revision", m.Description)
+			} else {
+				attack("hide", "%s hidden by a later revision", m.Description)
+			}
+		}
+		if !previous.Key("Rect").IsNull() && !sameValue(previous.Key("Rect"), current.Key("Rect")) {
+			attack("hide", "%s moved or resized by a later revision", m.Description)
+		}
+		if !sameValue(previous.Key("AP"), current.Key("AP")) && sameValue(fieldValue(previous), fieldValue(current)) {
+			attack("replace", "appearance of %s replaced by a later revision without a change of its value", m.Description)
+		}
+		if fieldFlags(previous)&1 != 0 && !sameValue(fieldValue(previous), fieldValue(current)) {
+			attack("replace", "value of the read-only %s changed by a later revision", m.Description)
+		}
+	}
+	return attacks
+}
+
+// fieldValue returns the value of the form field or widget v, inherited from
+// its parent if v has none.
+func fieldValue(v pdf.Value) pdf.Value {
+	if value := v.Key("V"); !value.IsNull() || !isFormField(v) {
+		return value
+	}
+	return v.Key("Parent").Key("V")
+}
+
+// fieldFlags returns the field flags of the form field or widget v,
+// inherited from its parent if v has none.
+func fieldFlags(v pdf.Value) int64 {
+	if flags := v.Key("Ff"); !flags.IsNull() {
+		return flags.Int64()
+	}
+	return v.Key("Parent").Key("Ff").Int64()
+}
+
+// usedObjects returns the indirect objects of the document rdr that are
+// reached from its trailer.
+func usedObjects(rdr *pdf.Reader) map[uint32]bool {
+	used := make(map[uint32]bool)
+	var walk func(v pdf.Value)
+	walk = func(v pdf.Value) {
+		var children []pdf.Value
+		switch v.Kind() {
+		case pdf.Dict, pdf.Stream:
+			for _, key := range v.Keys() {
+				children = append(children, v.Key(key))
+			}
+		case pdf.Array:
+			for i := 0; i < v.Len(); i++ {
+				children = append(children, v.Index(i))
+			}
+		}
+		for _, child := range children {
+			if child.IsNull() {
+				continue
+			}
+			if ptr := child.GetPtr(); ptr != v.GetPtr() {
+				if used[ptr.GetID()] {
+					continue
+				}
+				used[ptr.GetID()] = true
+			}
+			walk(child)
+		}
+	}
+	walk(rdr.Trailer())
+	return used
+}
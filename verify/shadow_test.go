@@ -0,0 +1,94 @@
+package verify
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/digitorus/pdf"
+)
+
+func TestDetectShadowAttacks(t *testing.T) {
+	// Object 8 is a content stream no page uses when signed.
+	base, prev := appendRevision([]byte("%PDF-1.7\n"), 0, map[int]string{
+		1: "<< /Type /Catalog /Pages 2 0 R /AcroForm << /Fields [6 0 R 7 0 R] /SigFlags 3 >> >>",
+		2: "<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		3: "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R /Annots [5 0 R] >>",
+		4: "<< /Length 6 >>\nstream\nSigned\nendstream",
+		5: "<< /Type /Annot /Subtype /Square /Rect [0 0 612 792] /F 4 >>",
+		6: "<< /FT /Tx /T (Name) /V (John Doe) /Subtype /Widget /Rect [0 0 100 20] /AP << /N 9 0 R >> >>",
+		7: "<< /FT /Tx /T (Amount) /Ff 1 /V (100) /Subtype /Widget /Rect [0 40 100 60] >>",
+		8: "<< /Length 6 >>\nstream\nShadow\nendstream",
+		9: "<< /Type /XObject /Subtype /Form /BBox [0 0 100 20] /Length 0 >>\nstream\n\nendstream",
+	})
+
+	tests := []struct {
+		name    string
+		objects map[int]string
+		want    []ShadowAttack
+	}{
+		{
+			name: "form fill",
+			objects: map[int]string{
+				6:  "<< /FT /Tx /T (Name) /V (Jane Doe) /Subtype /Widget /Rect [0 0 100 20] /AP << /N 10 0 R >> >>",
+				10: "<< /Type /XObject /Subtype /Form /BBox [0 0 100 20] /Length 0 >>\nstream\n\nendstream",
+			},
+		},
+		{
+			name: "overlay hidden",
+			objects: map[int]string{
+				5: "<< /Type /Annot /Subtype /Square /Rect [0 0 612 792] /F 6 >>",
+			},
+			want: []ShadowAttack{{Pattern: "hide", Object: "5 0 R", Description: "page 1 annotation hidden by a later revision"}},
+		},
+		{
+			name: "overlay moved",
+			objects: map[int]string{
+				5: "<< /Type /Annot /Subtype /Square /Rect [612 792 612 792] /F 4 >>",
+			},
+			want: []ShadowAttack{{Pattern: "hide", Object: "5 0 R", Description: "page 1 annotation moved or resized by a later revision"}},
+		},
+		{
+			name: "appearance replaced",
+			objects: map[int]string{
+				6:  "<< /FT /Tx /T (Name) /V (John Doe) /Subtype /Widget /Rect [0 0 100 20] /AP << /N 10 0 R >> >>",
+				10: "<< /Type /XObject /Subtype /Form /BBox [0 0 100 20] /Length 5 >>\nstream\nOther\nendstream",
+			},
+			want: []ShadowAttack{{Pattern: "replace", Object: "6 0 R", Description: "appearance of form field replaced by a later revision without a change of its value"}},
+		},
+		{
+			name: "read-only field",
+			objects: map[int]string{
+				7: "<< /FT /Tx /T (Amount) /Ff 1 /V (900) /Subtype /Widget /Rect [0 40 100 60] >>",
+			},
+			want: []ShadowAttack{{Pattern: "replace", Object: "7 0 R", Description: "value of the read-only form field changed by a later revision"}},
+		},
+		{
+			// The unchanged object 9 extends the size of the cross-reference
+			// table of the update to object 8.
+			name: "shadow content",
+			objects: map[int]string{
+				3: "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 8 0 R /Annots [5 0 R] >>",
+				9: "<< /Type /XObject /Subtype /Form /BBox [0 0 100 20] /Length 0 >>\nstream\n\nendstream",
+			},
+			want: []ShadowAttack{{Pattern: "hide_and_replace", Object: "8 0 R", Description: "object 8 0 R of the signed revision, used by nothing when signed, is used by a later revision"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			document, _ := appendRevision(base, prev, tt.objects)
+			rdr, err := pdf.NewReader(bytes.NewReader(document), int64(len(document)))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			signers := []Signer{{RevisionEnd: int64(len(base))}}
+			detectModifications(bytes.NewReader(document), int64(len(document)), rdr, signers)
+			detectShadowAttacks(bytes.NewReader(document), rdr, signers)
+			if !reflect.DeepEqual(signers[0].ShadowAttacks, tt.want) {
+				t.Errorf("expected shadow attacks %v, got %v", tt.want, signers[0].ShadowAttacks)
+			}
+		})
+	}
+}
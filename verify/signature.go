@@ -2,10 +2,15 @@ package verify
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/x509"
 	"encoding/asn1"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"slices"
+	"time"
 
 	"github.com/digitorus/pdf"
 	"github.com/digitorus/pdfsign/revocation"
@@ -13,13 +18,15 @@ import (
 	"github.com/digitorus/timestamp"
 )
 
-// processSignature processes a single digital signature found in the PDF.
-func processSignature(v pdf.Value, file io.ReaderAt, options *VerifyOptions) (Signer, string, error) {
+// processSignature processes a single digital signature found in the PDF,
+// dss is the DSS dictionary of the document.
+func processSignature(v pdf.Value, dss pdf.Value, file io.ReaderAt, options *VerifyOptions) (Signer, string, error) {
 	signer := Signer{
-		Name:        v.Key("Name").Text(),
-		Reason:      v.Key("Reason").Text(),
-		Location:    v.Key("Location").Text(),
-		ContactInfo: v.Key("ContactInfo").Text(),
+		SignatureType: "signature",
+		Name:          v.Key("Name").Text(),
+		Reason:        v.Key("Reason").Text(),
+		Location:      v.Key("Location").Text(),
+		ContactInfo:   v.Key("ContactInfo").Text(),
 	}
 
 	// Parse signature time if available from the signature object
@@ -30,27 +37,63 @@ func processSignature(v pdf.Value, file io.ReaderAt, options *VerifyOptions) (Si
 		}
 	}
 
+	if byteRange := v.Key("ByteRange"); byteRange.Len() >= 2 {
+		signer.RevisionEnd = byteRange.Index(byteRange.Len()-2).Int64() + byteRange.Index(byteRange.Len()-1).Int64()
+		for i := 0; i < byteRange.Len(); i++ {
+			signer.ByteRange = append(signer.ByteRange, byteRange.Index(i).Int64())
+		}
+	}
+
+	if v.Key("SubFilter").Name() == "ETSI.RFC3161" {
+		certError, err := processDocumentTimestamp(v, dss, file, &signer, options)
+		return signer, certError, err
+	}
+
+	if v.Key("SubFilter").Name() == "adbe.x509.rsa_sha1" {
+		certError, err := processPKCS1Signature(v, dss, file, &signer, options)
+		return signer, certError, err
+	}
+
 	// Parse PKCS#7 signature
 	p7, err := pkcs7.Parse([]byte(v.Key("Contents").RawString()))
 	if err != nil {
 		return signer, "", fmt.Errorf("failed to parse PKCS#7: %v", err)
 	}
 
+	var signingTime time.Time
+	if err := p7.UnmarshalSignedAttribute(oidAttributeSigningTime, &signingTime); err == nil {
+		signer.CMSSigningTime = &signingTime
+	}
+
+	// The byte range of adbe.pkcs7.sha1 signatures is digested with SHA-1
+	if v.Key("SubFilter").Name() == "adbe.pkcs7.sha1" {
+		signer.setDigestAlgorithm(p7, crypto.SHA1)
+	} else {
+		signer.setDigestAlgorithm(p7, 0)
+	}
+
 	// Process byte range for signature verification
-	err = processByteRange(v, file, p7)
+	digests, err := processByteRange(v, file, p7)
 	if err != nil {
+		if errors.Is(err, ErrDigestMismatch) {
+			signer.signatureError = err
+		}
 		return signer, fmt.Sprintf("Failed to process ByteRange: %v", err), nil
 	}
+	signer.MessageDigest = hex.EncodeToString(signedDigest(p7, v.Key("SubFilter").Name() == "adbe.pkcs7.sha1"))
 
-	// Process timestamp if present
-	err = processTimestamp(p7, &signer)
-	if err != nil {
-		return signer, fmt.Sprintf("Failed to process timestamp: %v", err), nil
-	}
+	// The validation material in the DSS of the document is used before
+	// going online.
+	dssData := dssValidationData(dss, []byte(v.Key("Contents").RawString()))
+
+	// Process timestamp if present, the signature is verified without the
+	// time of an invalid timestamp
+	processTimestamp(p7, &signer, slices.Concat(p7.Certificates, dssData.certificates))
 
 	// Verify the digital signature
-	err = verifySignature(p7, &signer)
+	err = verifySignature(p7, digests, &signer)
 	if err != nil {
+		signer.signatureError = err
 		return signer, fmt.Sprintf("Failed to verify signature: %v", err), nil
 	}
 
@@ -58,16 +101,62 @@ func processSignature(v pdf.Value, file io.ReaderAt, options *VerifyOptions) (Si
 	var revInfo revocation.InfoArchival
 	_ = p7.UnmarshalSignedAttribute(asn1.ObjectIdentifier{1, 2, 840, 113583, 1, 1, 8}, &revInfo)
 
-	certError, err := buildCertificateChainsWithOptions(p7, &signer, revInfo, options)
+	// CRLs can also be part of the crls field of the SignedData.
+	for _, crl := range p7.CRLs {
+		if der, err := asn1.Marshal(crl); err == nil {
+			_ = revInfo.AddCRL(der)
+		}
+	}
+
+	dssData.addTo(&revInfo)
+
+	certError, err := buildCertificateChainsWithOptions(p7, &signer, revInfo, dssData.certificates, options)
 	if err != nil {
 		return signer, fmt.Sprintf("Failed to build certificate chains: %v", err), nil
 	}
+	processCountersignatures(p7, &signer, slices.Concat(p7.Certificates, dssData.certificates), options)
+	checkSigningTime(&signer, p7.GetOnlySigner(), options)
+	signer.LTVEnabled, signer.LTVError = ltvStatus(p7.GetOnlySigner(), slices.Concat(p7.Certificates, dssData.certificates), revInfo)
 
+	if certError == "" && signer.TimestampError != "" {
+		certError = fmt.Sprintf("Failed to verify timestamp: %s", signer.TimestampError)
+	}
 	return signer, certError, nil
 }
 
-// processByteRange processes the byte range for signature verification.
-func processByteRange(v pdf.Value, file io.ReaderAt, p7 *pkcs7.PKCS7) error {
+// maxInMemoryByteRange is the size up to which the byte range of a signature
+// is read into memory. Larger byte ranges, such as those of scanned documents
+// of several GB, are hashed in chunks.
+var maxInMemoryByteRange int64 = 64 << 20
+
+// processByteRange processes the byte range for signature verification. The
+// content of p7 is set to the byte range, unless it is larger than
+// maxInMemoryByteRange and every signer signs attributes: then the digests
+// of the byte range with the digest algorithms of the signers are returned.
+func processByteRange(v pdf.Value, file io.ReaderAt, p7 *pkcs7.PKCS7) (map[crypto.Hash][]byte, error) {
+	// adbe.pkcs7.sha1 signatures encapsulate the SHA-1 digest of the byte
+	// range, which is verified here, the signature covers the digest.
+	if v.Key("SubFilter").Name() == "adbe.pkcs7.sha1" {
+		digests, err := digestByteRange(v, file, crypto.SHA1)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(digests[crypto.SHA1], p7.Content) {
+			return nil, fmt.Errorf("encapsulated SHA-1 digest does not match the byte range: %w", ErrDigestMismatch)
+		}
+		return nil, nil
+	}
+
+	if byteRangeLength(v) > maxInMemoryByteRange && signsAttributes(p7) {
+		var hashes []crypto.Hash
+		for _, s := range p7.Signers {
+			if hash, err := hashForOID(s.DigestAlgorithm.Algorithm); err == nil && hash.Available() {
+				hashes = append(hashes, hash)
+			}
+		}
+		return digestByteRange(v, file, hashes...)
+	}
+
 	for i := 0; i < v.Key("ByteRange").Len(); i++ {
 		// As the byte range comes in pairs, we increment one extra
 		i++
@@ -77,51 +166,88 @@ func processByteRange(v pdf.Value, file io.ReaderAt, p7 *pkcs7.PKCS7) error {
 		// verify the signature.
 		content, err := io.ReadAll(io.NewSectionReader(file, v.Key("ByteRange").Index(i-1).Int64(), v.Key("ByteRange").Index(i).Int64()))
 		if err != nil {
-			return fmt.Errorf("failed to read byte range %d: %v", i, err)
+			return nil, fmt.Errorf("failed to read byte range %d: %v", i, err)
 		}
 
 		p7.Content = append(p7.Content, content...)
 	}
+	return nil, nil
+}
+
+// signsAttributes reports whether every signer of p7 signs attributes with
+// the message digest of the content, rather than the content itself.
+func signsAttributes(p7 *pkcs7.PKCS7) bool {
+	for _, s := range p7.Signers {
+		if len(s.AuthenticatedAttributes) == 0 {
+			return false
+		}
+	}
+	return len(p7.Signers) > 0
+}
+
+// signedDigest returns the digest of the byte range that p7 signs, the
+// encapsulated SHA-1 digest of adbe.pkcs7.sha1 signatures or else the message
+// digest attribute, nil for signatures without signed attributes, which sign
+// the byte range itself.
+func signedDigest(p7 *pkcs7.PKCS7, encapsulated bool) []byte {
+	if encapsulated {
+		return p7.Content
+	}
+	if len(p7.Signers) == 0 {
+		return nil
+	}
+	for _, attr := range p7.Signers[0].AuthenticatedAttributes {
+		if attr.Type.Equal(oidAttributeMessageDigest) {
+			var digest []byte
+			if _, err := asn1.Unmarshal(attr.Value.Bytes, &digest); err == nil {
+				return digest
+			}
+		}
+	}
 	return nil
 }
 
-// processTimestamp processes timestamp information from the signature.
-func processTimestamp(p7 *pkcs7.PKCS7, signer *Signer) error {
+// processTimestamp processes the signature timestamp, a timestamp token over
+// the signature value. The token must be signed by its TSA, with the
+// certificates of the token or else certificates, and its message imprint
+// must match the signature value. Why a token is invalid is recorded in
+// TimestampError.
+func processTimestamp(p7 *pkcs7.PKCS7, signer *Signer, certificates []*x509.Certificate) {
 	for _, s := range p7.Signers {
 		// Timestamp - RFC 3161 id-aa-timeStampToken
 		for _, attr := range s.UnauthenticatedAttributes {
 			if attr.Type.Equal(asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 14}) {
 				ts, err := timestamp.Parse(attr.Value.Bytes)
 				if err != nil {
-					return fmt.Errorf("failed to parse timestamp: %v", err)
+					signer.TimestampError = fmt.Sprintf("failed to parse timestamp: %v", err)
+					return
 				}
 
 				signer.TimeStamp = ts
-
-				// Verify timestamp hash
-				r := bytes.NewReader(s.EncryptedDigest)
-				h := signer.TimeStamp.HashAlgorithm.New()
-				b := make([]byte, h.Size())
-				for {
-					n, err := r.Read(b)
-					if err == io.EOF {
-						break
-					}
-					h.Write(b[:n])
-				}
-
-				if !bytes.Equal(h.Sum(nil), signer.TimeStamp.HashedMessage) {
-					return fmt.Errorf("timestamp hash does not match")
+				if _, err := verifyTimestampToken(ts, s.EncryptedDigest, certificates); err != nil {
+					signer.TimestampError = err.Error()
 				}
-				break
+				return
 			}
 		}
 	}
-	return nil
 }
 
 // verifySignature verifies the digital signature.
-func verifySignature(p7 *pkcs7.PKCS7, signer *Signer) error {
+func verifySignature(p7 *pkcs7.PKCS7, digests map[crypto.Hash][]byte, signer *Signer) error {
+	// Signature algorithms the pkcs7 package does not support, such as
+	// RSASSA-PSS, and byte ranges that were hashed in chunks are verified
+	// locally.
+	if requiresLocalVerification(p7) || digests != nil {
+		trusted, err := verifyLocally(p7, digests)
+		if err != nil {
+			return fmt.Errorf("signature verification failed: %w", err)
+		}
+		signer.ValidSignature = true
+		signer.TrustedIssuer = trusted
+		return nil
+	}
+
 	// Directory of certificates, including OCSP
 	certPool := x509.NewCertPool()
 	for _, cert := range p7.Certificates {
@@ -136,7 +262,7 @@ func verifySignature(p7 *pkcs7.PKCS7, signer *Signer) error {
 			signer.ValidSignature = true
 			signer.TrustedIssuer = false
 		} else {
-			return fmt.Errorf("signature verification failed: %v", err)
+			return fmt.Errorf("signature verification failed: %w", err)
 		}
 	} else {
 		signer.ValidSignature = true
@@ -173,7 +173,7 @@ func TestBuildCertificateChainsWithOptionsUnit(t *testing.T) {
 // --- Unit test for validateTimestampCertificate ---
 func TestValidateTimestampCertificateUnit(t *testing.T) {
 	// Simulate nil timestamp
-	ok, msg := validateTimestampCertificate(nil, &VerifyOptions{})
+	ok, msg := validateTimestampCertificate(nil, nil, &VerifyOptions{})
 	if ok || msg == "" {
 		t.Error("expected failure for nil timestamp")
 	}
@@ -0,0 +1,76 @@
+package verify
+
+import (
+	"crypto/x509"
+	"fmt"
+	"time"
+)
+
+// signingTimeTolerance is the difference between the times of a signature
+// that is put down to the clocks of the signer and the TSA.
+const signingTimeTolerance = 5 * time.Minute
+
+// checkSigningTime cross-checks the times of the signature of signer by
+// cert: the /M date of the signature dictionary and the signing time
+// attribute, both claimed by the signer, the time proven by its timestamp
+// and the validity of cert. The inconsistencies are recorded in
+// SigningTimeWarnings, they do not invalidate the signature.
+func checkSigningTime(signer *Signer, cert *x509.Certificate, options *VerifyOptions) {
+	type claim struct {
+		source string
+		time   *time.Time
+	}
+	claims := []claim{
+		{"the /M date", signer.SignatureTime},
+		{"the signing time attribute", signer.CMSSigningTime},
+	}
+	warn := func(format string, args ...any) {
+		signer.SigningTimeWarnings = append(signer.SigningTimeWarnings, fmt.Sprintf(format, args...))
+	}
+	format := func(t time.Time) string {
+		return t.UTC().Format(time.RFC3339)
+	}
+
+	if m, attr := signer.SignatureTime, signer.CMSSigningTime; m != nil && attr != nil && absDuration(m.Sub(*attr)) > signingTimeTolerance {
+		warn("the /M date %s differs from the signing time attribute %s", format(*m), format(*attr))
+	}
+
+	now := options.validationTime()
+	for _, c := range claims {
+		if c.time == nil {
+			continue
+		}
+		if c.time.After(now.Add(signingTimeTolerance)) {
+			warn("%s %s is after the time of the verification %s", c.source, format(*c.time), format(now))
+		}
+		if ts := signer.TimestampTime; ts != nil {
+			tolerance := signingTimeTolerance
+			if signer.TimeStamp != nil {
+				tolerance += signer.TimeStamp.Accuracy
+			}
+			if c.time.After(ts.Add(tolerance)) {
+				warn("%s %s is after the timestamp %s", c.source, format(*c.time), format(*ts))
+			}
+		}
+		if cert == nil {
+			continue
+		}
+		if c.time.Before(cert.NotBefore) {
+			warn("%s %s is before the signing certificate was issued at %s", c.source, format(*c.time), format(cert.NotBefore))
+		}
+		if c.time.After(cert.NotAfter) {
+			warn("%s %s is after the signing certificate expired at %s", c.source, format(*c.time), format(cert.NotAfter))
+		}
+	}
+
+	if ts := signer.TimestampTime; ts != nil && cert != nil && ts.Before(cert.NotBefore) {
+		warn("the timestamp %s is before the signing certificate was issued at %s", format(*ts), format(cert.NotBefore))
+	}
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,109 @@
+package verify
+
+import (
+	"crypto/x509"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitorus/timestamp"
+)
+
+func TestCheckSigningTime(t *testing.T) {
+	notBefore := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cert := &x509.Certificate{NotBefore: notBefore, NotAfter: notBefore.AddDate(1, 0, 0)}
+	at := func(d time.Duration) *time.Time {
+		t := notBefore.AddDate(0, 6, 0).Add(d)
+		return &t
+	}
+
+	tests := []struct {
+		name   string
+		modify func(s *Signer)
+		want   []string
+	}{
+		{
+			name: "consistent",
+			modify: func(s *Signer) {
+				s.SignatureTime = at(0)
+				s.CMSSigningTime = at(time.Minute)
+				s.TimestampTime = at(2 * time.Minute)
+			},
+		},
+		{
+			name: "/M date and signing time attribute apart",
+			modify: func(s *Signer) {
+				s.SignatureTime = at(0)
+				s.CMSSigningTime = at(time.Hour)
+			},
+			want: []string{"the /M date 2024-07-01T00:00:00Z differs from the signing time attribute 2024-07-01T01:00:00Z"},
+		},
+		{
+			name: "claimed after the timestamp",
+			modify: func(s *Signer) {
+				s.CMSSigningTime = at(time.Hour)
+				s.TimestampTime = at(0)
+			},
+			want: []string{"the signing time attribute 2024-07-01T01:00:00Z is after the timestamp 2024-07-01T00:00:00Z"},
+		},
+		{
+			name: "within the accuracy of the timestamp",
+			modify: func(s *Signer) {
+				s.CMSSigningTime = at(time.Hour)
+				s.TimestampTime = at(0)
+				s.TimeStamp = &timestamp.Timestamp{Accuracy: time.Hour}
+			},
+		},
+		{
+			name: "claimed before the certificate was issued",
+			modify: func(s *Signer) {
+				m := notBefore.Add(-24 * time.Hour)
+				s.SignatureTime = &m
+			},
+			want: []string{"the /M date 2023-12-31T00:00:00Z is before the signing certificate was issued at 2024-01-01T00:00:00Z"},
+		},
+		{
+			name: "claimed after the certificate expired",
+			modify: func(s *Signer) {
+				s.CMSSigningTime = at(365 * 24 * time.Hour)
+			},
+			want: []string{
+				"the signing time attribute 2025-07-01T00:00:00Z is after the time of the verification 2024-07-02T00:00:00Z",
+				"the signing time attribute 2025-07-01T00:00:00Z is after the signing certificate expired at 2025-01-01T00:00:00Z",
+			},
+		},
+		{
+			name: "timestamp before the certificate was issued",
+			modify: func(s *Signer) {
+				ts := notBefore.Add(-time.Hour)
+				s.TimestampTime = &ts
+			},
+			want: []string{"the timestamp 2023-12-31T23:00:00Z is before the signing certificate was issued at 2024-01-01T00:00:00Z"},
+		},
+		{
+			name: "claimed after the verification",
+			modify: func(s *Signer) {
+				s.SignatureTime = at(48 * time.Hour)
+			},
+			want: []string{"the /M date 2024-07-03T00:00:00Z is after the time of the verification 2024-07-02T00:00:00Z"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s Signer
+			tt.modify(&s)
+			checkSigningTime(&s, cert, &VerifyOptions{ValidationTime: *at(24 * time.Hour)})
+			if strings.Join(s.SigningTimeWarnings, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("expected the warnings %q, got %q", tt.want, s.SigningTimeWarnings)
+			}
+		})
+	}
+
+	// Without a signing certificate, only the times are compared.
+	s := Signer{SignatureTime: at(0), CMSSigningTime: at(time.Hour)}
+	checkSigningTime(&s, nil, &VerifyOptions{ValidationTime: *at(24 * time.Hour)})
+	if len(s.SigningTimeWarnings) != 1 {
+		t.Errorf("expected a warning, got %q", s.SigningTimeWarnings)
+	}
+}
@@ -0,0 +1,183 @@
+package verify
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/internal/xref"
+)
+
+// startXref matches the startxref keyword and offset before an end-of-file
+// marker, which tells a revision end from "%%EOF" in stream data.
+var startXref = regexp.MustCompile(`startxref\s+\d+\s*$`)
+
+// Timeline is the history of the signatures of a document in the order of
+// its revisions: the revision each signature covers, what the revisions up to
+// the next signature changed and whether it is intact under the later
+// revisions.
+type Timeline struct {
+	Revisions int             `json:"revisions"` // Number of revisions of the document
+	Entries   []TimelineEntry `json:"entries"`   // Signatures and document timestamps in the order of their revisions
+}
+
+// TimelineEntry is a signature or document timestamp of a Timeline.
+type TimelineEntry struct {
+	Signature      int            `json:"signature"`               // Index of the signature in Signers, and in the Signatures of a Report
+	Type           string         `json:"type"`                    // "signature", "document_timestamp" or "usage_rights"
+	Name           string         `json:"name,omitempty"`          // Name of the signer
+	Time           *time.Time     `json:"time,omitempty"`          // Time proven by a timestamp, or else claimed by the signer
+	TimeProven     bool           `json:"time_proven"`             // Whether Time is proven by a valid timestamp
+	Revision       int            `json:"revision"`                // Revision covered by the signature, 1 for the original document, 0 if unknown
+	LaterRevisions int            `json:"later_revisions"`         // Number of revisions after that revision
+	Changes        []Modification `json:"changes,omitempty"`       // Changes of the revisions up to the next signature or the end of the document
+	ChangesError   string         `json:"changes_error,omitempty"` // Why those changes could not be analyzed
+	Intact         bool           `json:"intact"`                  // Whether the signature is valid, covers its revision and the later revisions made no disallowed changes
+}
+
+// buildTimeline returns the Timeline of the signers of the document rdr of
+// size bytes with the revisions that end at ends, nil if it has no signers.
+// The modifications of the signers must have been detected.
+func buildTimeline(file io.ReaderAt, size int64, rdr *pdf.Reader, signers []Signer, ends []int64) *Timeline {
+	if len(signers) == 0 {
+		return nil
+	}
+	order := make([]int, len(signers))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return signers[order[a]].RevisionEnd < signers[order[b]].RevisionEnd
+	})
+
+	timeline := &Timeline{Revisions: len(ends), Entries: make([]TimelineEntry, 0, len(signers))}
+	for n, i := range order {
+		s := &signers[i]
+		entry := TimelineEntry{
+			Signature: i,
+			Type:      s.SignatureType,
+			Name:      s.Name,
+			Time:      s.SignatureTime,
+			Intact:    s.ValidSignature && s.ByteRangeValid && !s.DisallowedModifications,
+		}
+		switch {
+		case s.SignatureType == "document_timestamp" && s.ValidSignature && s.TimeStamp != nil:
+			entry.Time, entry.TimeProven = &s.TimeStamp.Time, true
+		case s.TimestampTime != nil:
+			entry.Time, entry.TimeProven = s.TimestampTime, true
+		}
+		if s.RevisionEnd > 0 {
+			entry.Revision, _ = revisionOf(ends, s.RevisionEnd)
+			entry.LaterRevisions = len(ends) - entry.Revision
+		}
+
+		// The changes up to the end of the document are the modifications
+		// of the signer, those up to the next signature are compared with
+		// the revision of that signature.
+		if n == len(order)-1 {
+			entry.Changes, entry.ChangesError = s.Modifications, s.ModificationError
+		} else if next := signers[order[n+1]].RevisionEnd; s.RevisionEnd > 0 && next > s.RevisionEnd && next <= size {
+			entry.Changes, entry.ChangesError = changesBetween(file, s.RevisionEnd, next)
+		}
+		timeline.Entries = append(timeline.Entries, entry)
+	}
+	return timeline
+}
+
+// setRevisions records the revision each of the signers covers, of the
+// revisions that end at ends, and the offset it starts at.
+func setRevisions(signers []Signer, ends []int64) {
+	for i := range signers {
+		if signers[i].RevisionEnd > 0 {
+			signers[i].Revision, signers[i].RevisionStart = revisionOf(ends, signers[i].RevisionEnd)
+		}
+	}
+}
+
+// revisionOf returns the number of the revision, of those that end at ends,
+// that ends at end, or the last one before it, and the offset the revision
+// starts at, the end of the revision before it.
+func revisionOf(ends []int64, end int64) (revision int, start int64) {
+	for _, e := range ends {
+		if e > end {
+			break
+		}
+		revision++
+		if e < end {
+			start = e
+		}
+	}
+	return revision, start
+}
+
+// changesBetween returns the modifications of the revisions after the one
+// that ends at start, up to the revision that ends at end.
+func changesBetween(file io.ReaderAt, start, end int64) (modifications []Modification, errorMsg string) {
+	defer func() {
+		if r := recover(); r != nil {
+			modifications, errorMsg = nil, fmt.Sprintf("failed to read the revision (%v)", r)
+		}
+	}()
+
+	appended := make([]byte, end-start)
+	if _, err := file.ReadAt(appended, start); err != nil && err != io.EOF {
+		return nil, fmt.Sprintf("failed to read the incremental updates: %v", err)
+	}
+	if len(bytes.TrimSpace(bytes.Trim(appended, "\x00"))) == 0 {
+		return nil, ""
+	}
+	rdr, err := xref.NewReader(io.NewSectionReader(file, 0, end), end)
+	if err != nil {
+		return nil, fmt.Sprintf("failed to open the revision: %v", err)
+	}
+	modifications, err = revisionModifications(file, start, rdr, appended, objectRoles(rdr), pageObjects(rdr))
+	if err != nil {
+		return nil, err.Error()
+	}
+	return modifications, ""
+}
+
+// revisionEnds returns the offsets right after the end-of-file markers of
+// the revisions of the document of size bytes, those that follow a
+// startxref offset, in order.
+func revisionEnds(file io.ReaderAt, size int64) []int64 {
+	const chunk = 1 << 20
+	marker := []byte("%%EOF")
+	var ends []int64
+	buf := make([]byte, chunk+len(marker)-1)
+	for offset := int64(0); offset < size; offset += chunk {
+		n, err := file.ReadAt(buf[:min(int64(len(buf)), size-offset)], offset)
+		if err != nil && err != io.EOF {
+			break
+		}
+		data := buf[:n]
+		for i := 0; ; {
+			j := bytes.Index(data[i:], marker)
+			if j < 0 {
+				break
+			}
+			at := offset + int64(i+j)
+			// Markers that start after the chunk are found in the next one.
+			if i+j < chunk && followsStartXref(file, at) {
+				ends = append(ends, at+int64(len(marker)))
+			}
+			i += j + len(marker)
+		}
+	}
+	return ends
+}
+
+// followsStartXref reports whether the end-of-file marker at offset follows
+// the startxref keyword and offset.
+func followsStartXref(file io.ReaderAt, offset int64) bool {
+	start := max(offset-64, 0)
+	before := make([]byte, offset-start)
+	if _, err := file.ReadAt(before, start); err != nil {
+		return false
+	}
+	return startXref.Match(before)
+}
@@ -0,0 +1,104 @@
+package verify
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdf"
+)
+
+func TestBuildTimeline(t *testing.T) {
+	content := "BT /F1 12 Tf 72 712 Td (%%EOF) Tj ET"
+	document, prev := appendRevision([]byte("%PDF-1.7\n"), 0, map[int]string{
+		1: "<< /Type /Catalog /Pages 2 0 R /AcroForm << /Fields [] /SigFlags 3 >> >>",
+		2: "<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		3: "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R >>",
+		4: fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+	})
+	document, prev = appendRevision(document, prev, map[int]string{
+		1: "<< /Type /Catalog /Pages 2 0 R /AcroForm << /Fields [6 0 R] /SigFlags 3 >> >>",
+		5: "<< /Type /Sig /Filter /Adobe.PPKLite /SubFilter /ETSI.CAdES.detached >>",
+		6: "<< /FT /Sig /T (Author) /V 5 0 R /Subtype /Widget /Rect [0 0 0 0] >>",
+	})
+	first := int64(len(document))
+	document, prev = appendRevision(document, prev, map[int]string{
+		3: "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R /Annots [7 0 R] >>",
+		7: "<< /Type /Annot /Subtype /Text /Rect [0 0 20 20] /Contents (Note) >>",
+	})
+	document, prev = appendRevision(document, prev, map[int]string{
+		1: "<< /Type /Catalog /Pages 2 0 R /AcroForm << /Fields [6 0 R 9 0 R] /SigFlags 3 >> >>",
+		8: "<< /Type /Sig /Filter /Adobe.PPKLite /SubFilter /ETSI.CAdES.detached >>",
+		9: "<< /FT /Sig /T (Reviewer) /V 8 0 R /Subtype /Widget /Rect [0 0 0 0] >>",
+	})
+	second := int64(len(document))
+	document, _ = appendRevision(document, prev, map[int]string{
+		1:  "<< /Type /Catalog /Pages 2 0 R /AcroForm << /Fields [6 0 R 9 0 R] /SigFlags 3 >> /DSS 10 0 R >>",
+		10: "<< /Certs [] >>",
+	})
+
+	rdr, err := pdf.NewReader(bytes.NewReader(document), int64(len(document)))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	signed := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	signers := []Signer{
+		{SignatureType: "signature", Name: "Reviewer", ValidSignature: true, ByteRangeValid: true, TimestampTime: &signed, RevisionEnd: second},
+		{SignatureType: "signature", Name: "Author", ValidSignature: true, ByteRangeValid: true, SignatureTime: &signed, RevisionEnd: first},
+	}
+	detectModifications(bytes.NewReader(document), int64(len(document)), rdr, signers)
+	timeline := buildTimeline(bytes.NewReader(document), int64(len(document)), rdr, signers, revisionEnds(bytes.NewReader(document), int64(len(document))))
+
+	if timeline.Revisions != 5 || len(timeline.Entries) != 2 {
+		t.Fatalf("expected 5 revisions and 2 entries, got %d and %d", timeline.Revisions, len(timeline.Entries))
+	}
+	author, reviewer := timeline.Entries[0], timeline.Entries[1]
+	if author.Signature != 1 || author.Revision != 2 || author.LaterRevisions != 3 || author.TimeProven || !author.Intact {
+		t.Errorf("expected the author signature of revision 2 first, got %+v", author)
+	}
+	if reviewer.Signature != 0 || reviewer.Revision != 4 || reviewer.LaterRevisions != 1 || !reviewer.TimeProven || !reviewer.Intact {
+		t.Errorf("expected the reviewer signature of revision 4 second, got %+v", reviewer)
+	}
+
+	// The changes up to the next signature do not include the DSS
+	want := []Modification{
+		{Type: "annotation", Object: "7 0 R", Description: "page 1 annotation", Added: true},
+		{Type: "signature", Object: "8 0 R", Description: "signature dictionary", Added: true},
+		{Type: "signature", Object: "9 0 R", Description: "signature field", Field: "Reviewer", Added: true},
+	}
+	if !reflect.DeepEqual(author.Changes, want) {
+		t.Errorf("expected the changes %+v before the reviewer signature, got %+v", want, author.Changes)
+	}
+	want = []Modification{{Type: "dss", Object: "10 0 R", Description: "DSS", Added: true}}
+	if !reflect.DeepEqual(reviewer.Changes, want) {
+		t.Errorf("expected the changes %+v after the reviewer signature, got %+v", want, reviewer.Changes)
+	}
+
+	if buildTimeline(bytes.NewReader(document), int64(len(document)), rdr, nil, nil) != nil {
+		t.Errorf("expected no timeline without signers")
+	}
+}
+
+func TestSetRevisions(t *testing.T) {
+	signers := []Signer{{RevisionEnd: 300}, {RevisionEnd: 100}, {RevisionEnd: 250}, {}}
+	setRevisions(signers, []int64{100, 200, 300})
+	want := []Signer{
+		{RevisionEnd: 300, Revision: 3, RevisionStart: 200},
+		{RevisionEnd: 100, Revision: 1, RevisionStart: 0},
+		{RevisionEnd: 250, Revision: 2, RevisionStart: 200},
+		{},
+	}
+	if !reflect.DeepEqual(signers, want) {
+		t.Errorf("expected %+v, got %+v", want, signers)
+	}
+}
+
+func TestRevisionEnds(t *testing.T) {
+	document := []byte("%PDF-1.7\nstream\n%%EOF\nendstream\nstartxref\n9\n%%EOF\nupdate\nstartxref\r\n42\r\n%%EOF")
+	want := []int64{int64(bytes.Index(document, []byte("%%EOF\nupdate"))) + 5, int64(len(document))}
+	if ends := revisionEnds(bytes.NewReader(document), int64(len(document))); !reflect.DeepEqual(ends, want) {
+		t.Errorf("expected revision ends %v, got %v", want, ends)
+	}
+}
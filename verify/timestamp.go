@@ -0,0 +1,57 @@
+package verify
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"github.com/digitorus/pkcs7"
+	"github.com/digitorus/timestamp"
+)
+
+// errImprintMismatch is returned for a timestamp token over other data.
+var errImprintMismatch = errors.New("timestamp message imprint does not match")
+
+// verifyTimestampToken verifies the RFC 3161 timestamp token ts over message
+// and returns the certificate of the TSA that signed it. The token is
+// verified with its own certificates, or with certificates when the TSA left
+// them out of the token, and its message imprint must be the digest of
+// message.
+func verifyTimestampToken(ts *timestamp.Timestamp, message []byte, certificates []*x509.Certificate) (*x509.Certificate, error) {
+	var digest []byte
+	if ts.HashAlgorithm.Available() {
+		h := ts.HashAlgorithm.New()
+		h.Write(message)
+		digest = h.Sum(nil)
+	}
+	return verifyTimestampImprint(ts, digest, certificates)
+}
+
+// verifyTimestampImprint is verifyTimestampToken with the digest of the
+// message with the hash algorithm of ts.
+func verifyTimestampImprint(ts *timestamp.Timestamp, digest []byte, certificates []*x509.Certificate) (*x509.Certificate, error) {
+	p7, err := pkcs7.Parse(ts.RawToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse timestamp token: %v", err)
+	}
+	if len(p7.Certificates) == 0 {
+		p7.Certificates = certificates
+	}
+
+	tsaCert := p7.GetOnlySigner()
+	if tsaCert == nil {
+		return nil, fmt.Errorf("timestamp signing certificate not found")
+	}
+	if err := p7.Verify(); err != nil {
+		return nil, fmt.Errorf("invalid timestamp token signature: %v", err)
+	}
+
+	if !ts.HashAlgorithm.Available() {
+		return nil, fmt.Errorf("unsupported timestamp hash algorithm %v", ts.HashAlgorithm)
+	}
+	if !bytes.Equal(digest, ts.HashedMessage) {
+		return nil, errImprintMismatch
+	}
+	return tsaCert, nil
+}
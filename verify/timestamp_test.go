@@ -0,0 +1,176 @@
+package verify
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdfsign/revocation"
+	"github.com/digitorus/pkcs7"
+	"github.com/digitorus/timestamp"
+)
+
+// newTestTSACertificate returns a self-signed timestamping certificate and
+// its key.
+func newTestTSACertificate(t *testing.T) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "pdfsign Test TSA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	return cert, key
+}
+
+// newTestTimestamp returns a timestamp token of cert over message, with the
+// certificate of the TSA if addCertificate is set.
+func newTestTimestamp(t *testing.T, cert *x509.Certificate, key crypto.Signer, message []byte, addCertificate bool) *timestamp.Timestamp {
+	t.Helper()
+
+	digest := sha256.Sum256(message)
+	ts := timestamp.Timestamp{
+		HashAlgorithm:     crypto.SHA256,
+		HashedMessage:     digest[:],
+		Time:              time.Now().UTC().Truncate(time.Second),
+		Policy:            asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 2, 3, 4},
+		AddTSACertificate: addCertificate,
+	}
+	response, err := ts.CreateResponseWithOpts(cert, key, crypto.SHA256)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	token, err := timestamp.ParseResponse(response)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	return token
+}
+
+func TestVerifyTimestampToken(t *testing.T) {
+	tsaCert, tsaKey := newTestTSACertificate(t)
+	// A certificate with the issuer and serial number of the TSA but
+	// another key.
+	impostor, _ := newTestTSACertificate(t)
+	signature := []byte("signature value")
+
+	tests := []struct {
+		name         string
+		token        *timestamp.Timestamp
+		message      []byte
+		certificates []*x509.Certificate
+		wantError    string
+	}{
+		{name: "token with certificate", token: newTestTimestamp(t, tsaCert, tsaKey, signature, true), message: signature},
+		{name: "certificate of the signature", token: newTestTimestamp(t, tsaCert, tsaKey, signature, false), message: signature, certificates: []*x509.Certificate{tsaCert}},
+		{name: "no certificate", token: newTestTimestamp(t, tsaCert, tsaKey, signature, false), message: signature, wantError: "timestamp signing certificate not found"},
+		{name: "certificate with another key", token: newTestTimestamp(t, tsaCert, tsaKey, signature, false), message: signature, certificates: []*x509.Certificate{impostor}, wantError: "invalid timestamp token signature"},
+		{name: "other signature value", token: newTestTimestamp(t, tsaCert, tsaKey, signature, true), message: []byte("other signature value"), wantError: "message imprint does not match"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert, err := verifyTimestampToken(tt.token, tt.message, tt.certificates)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("expected an error containing %q, got %v", tt.wantError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			if !cert.Equal(tsaCert) {
+				t.Errorf("expected the certificate of the TSA")
+			}
+		})
+	}
+}
+
+func TestValidateTimestampCertificate(t *testing.T) {
+	tsaCert, tsaKey := newTestTSACertificate(t)
+	token := newTestTimestamp(t, tsaCert, tsaKey, []byte("signature value"), false)
+
+	// The self-signed TSA is only trusted as embedded certificate, which
+	// the token itself leaves out.
+	if trusted, _ := validateTimestampCertificate(token, []*x509.Certificate{tsaCert}, &VerifyOptions{}); trusted {
+		t.Errorf("expected the untrusted TSA not to be trusted")
+	}
+	if trusted, warning := validateTimestampCertificate(token, nil, &VerifyOptions{AllowUntrustedRoots: true}); trusted {
+		t.Errorf("expected no TSA certificate without certificates, got %q", warning)
+	}
+	if trusted, warning := validateTimestampCertificate(token, []*x509.Certificate{tsaCert}, &VerifyOptions{AllowUntrustedRoots: true}); !trusted {
+		t.Errorf("expected the TSA certificate of the signature to be used: %s", warning)
+	}
+}
+
+func TestBuildCertificateChainsInvalidTimestamp(t *testing.T) {
+	tsaCert, tsaKey := newTestTSACertificate(t)
+	signatureTime := time.Now().Add(-time.Hour)
+
+	validationTime := time.Now().Add(-24 * time.Hour)
+
+	tests := []struct {
+		name           string
+		timestampError string
+		validationTime time.Time
+		wantStatus     string
+		wantSource     string
+	}{
+		{name: "valid", wantStatus: "valid", wantSource: "embedded_timestamp"},
+		{name: "invalid", timestampError: "timestamp message imprint does not match", wantStatus: "invalid", wantSource: "signature_time"},
+		{name: "validation time", validationTime: validationTime, wantStatus: "valid", wantSource: "validation_time"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer := &Signer{
+				TimeStamp:      newTestTimestamp(t, tsaCert, tsaKey, []byte("signature value"), true),
+				TimestampError: tt.timestampError,
+				SignatureTime:  &signatureTime,
+			}
+			options := DefaultVerifyOptions()
+			options.TrustSignatureTime = true
+			options.ValidationTime = tt.validationTime
+			if _, err := buildCertificateChainsWithOptions(&pkcs7.PKCS7{}, signer, revocation.InfoArchival{}, nil, options); err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+
+			if signer.TimestampStatus != tt.wantStatus || signer.TimeSource != tt.wantSource {
+				t.Errorf("expected %s timestamp and time source %s, got %s and %s", tt.wantStatus, tt.wantSource, signer.TimestampStatus, signer.TimeSource)
+			}
+			if !tt.validationTime.IsZero() && !signer.VerificationTime.Equal(tt.validationTime) {
+				t.Errorf("expected verification time %v, got %v", tt.validationTime, signer.VerificationTime)
+			}
+			// Only a valid timestamp proves the time.
+			if proven := signer.TimestampTime != nil; proven != (tt.timestampError == "") {
+				t.Errorf("expected proven time %t, got %v", tt.timestampError == "", signer.TimestampTime)
+			}
+		})
+	}
+}
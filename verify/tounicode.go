@@ -0,0 +1,159 @@
+package verify
+
+import (
+	"encoding/hex"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/digitorus/pdf"
+)
+
+// The blocks of a ToUnicode CMap and the hexadecimal strings and arrays of
+// their entries, see ISO 32000-1, 9.10.3 "ToUnicode CMaps".
+var (
+	cmapCodespace = regexp.MustCompile(`(?s)begincodespacerange(.*?)endcodespacerange`)
+	cmapBFChar    = regexp.MustCompile(`(?s)beginbfchar(.*?)endbfchar`)
+	cmapBFRange   = regexp.MustCompile(`(?s)beginbfrange(.*?)endbfrange`)
+	cmapToken     = regexp.MustCompile(`<[0-9A-Fa-f\s]*>|\[[^\]]*\]`)
+)
+
+// toUnicodeRange maps the codes first to last to Unicode, to consecutive
+// text from text, or to the text of each code.
+type toUnicodeRange struct {
+	first, last uint32
+	text        []uint16
+	texts       [][]uint16
+}
+
+// toUnicodeEncoding decodes the text of a composite font with its ToUnicode
+// CMap, which the pdf package does not do for fonts with the Identity-H
+// encoding. Codes the CMap does not map are dropped.
+type toUnicodeEncoding struct {
+	width  int
+	chars  map[uint32][]uint16
+	ranges []toUnicodeRange
+}
+
+// readToUnicode returns the encoding of the ToUnicode CMap stream, nil if it
+// can not be read or maps no codes.
+func readToUnicode(stream pdf.Value) *toUnicodeEncoding {
+	if stream.Kind() != pdf.Stream {
+		return nil
+	}
+	data, err := io.ReadAll(stream.Reader())
+	if err != nil {
+		return nil
+	}
+	cmap := string(data)
+
+	// The codes of the fonts of signature appearances have a single width,
+	// that of the first codespace range, two bytes if there is none.
+	e := &toUnicodeEncoding{width: 2, chars: make(map[uint32][]uint16)}
+	if m := cmapCodespace.FindStringSubmatch(cmap); m != nil {
+		if tokens := cmapToken.FindAllString(m[1], 1); len(tokens) == 1 {
+			if code, ok := hexToken(tokens[0]); ok && len(code) > 0 && len(code) <= 4 {
+				e.width = len(code)
+			}
+		}
+	}
+
+	for _, m := range cmapBFChar.FindAllStringSubmatch(cmap, -1) {
+		tokens := cmapToken.FindAllString(m[1], -1)
+		for i := 0; i+1 < len(tokens); i += 2 {
+			code, ok1 := hexToken(tokens[i])
+			text, ok2 := hexToken(tokens[i+1])
+			if ok1 && ok2 {
+				e.chars[codeValue(code)] = utf16Units(text)
+			}
+		}
+	}
+	for _, m := range cmapBFRange.FindAllStringSubmatch(cmap, -1) {
+		tokens := cmapToken.FindAllString(m[1], -1)
+		for i := 0; i+2 < len(tokens); i += 3 {
+			first, ok1 := hexToken(tokens[i])
+			last, ok2 := hexToken(tokens[i+1])
+			if !ok1 || !ok2 {
+				continue
+			}
+			r := toUnicodeRange{first: codeValue(first), last: codeValue(last)}
+			if strings.HasPrefix(tokens[i+2], "[") {
+				for _, token := range cmapToken.FindAllString(tokens[i+2][1:], -1) {
+					text, _ := hexToken(token)
+					r.texts = append(r.texts, utf16Units(text))
+				}
+			} else if text, ok := hexToken(tokens[i+2]); ok {
+				r.text = utf16Units(text)
+			}
+			e.ranges = append(e.ranges, r)
+		}
+	}
+
+	if len(e.chars) == 0 && len(e.ranges) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Decode returns the text of the codes of raw.
+func (e *toUnicodeEncoding) Decode(raw string) string {
+	var units []uint16
+	for i := 0; i+e.width <= len(raw); i += e.width {
+		code := codeValue([]byte(raw[i : i+e.width]))
+		if text, ok := e.chars[code]; ok {
+			units = append(units, text...)
+			continue
+		}
+		for _, r := range e.ranges {
+			if code < r.first || code > r.last {
+				continue
+			}
+			offset := code - r.first
+			switch {
+			case r.texts != nil:
+				if int(offset) < len(r.texts) {
+					units = append(units, r.texts[offset]...)
+				}
+			case len(r.text) > 0:
+				// The last unit is incremented for each code of the range.
+				text := append([]uint16(nil), r.text...)
+				text[len(text)-1] += uint16(offset)
+				units = append(units, text...)
+			}
+			break
+		}
+	}
+	return string(utf16.Decode(units))
+}
+
+// hexToken returns the bytes of a hexadecimal string token.
+func hexToken(token string) ([]byte, bool) {
+	if !strings.HasPrefix(token, "<") || !strings.HasSuffix(token, ">") {
+		return nil, false
+	}
+	digits := strings.Join(strings.Fields(token[1:len(token)-1]), "")
+	if len(digits)%2 != 0 {
+		digits += "0"
+	}
+	b, err := hex.DecodeString(digits)
+	return b, err == nil
+}
+
+// codeValue returns the big-endian value of the bytes of a code.
+func codeValue(code []byte) uint32 {
+	var v uint32
+	for _, b := range code {
+		v = v<<8 | uint32(b)
+	}
+	return v
+}
+
+// utf16Units returns the UTF-16BE code units of text.
+func utf16Units(text []byte) []uint16 {
+	units := make([]uint16, len(text)/2)
+	for i := range units {
+		units[i] = uint16(text[2*i])<<8 | uint16(text[2*i+1])
+	}
+	return units
+}
@@ -0,0 +1,58 @@
+package verify
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/digitorus/pdf"
+)
+
+func TestReadToUnicode(t *testing.T) {
+	tests := []struct {
+		name string
+		cmap string
+		raw  string
+		want string
+	}{
+		{
+			name: "bfchar",
+			cmap: "1 begincodespacerange <0000> <FFFF> endcodespacerange\n2 beginbfchar\n<03EA> <4E2D>\n<03EB> <6587>\nendbfchar",
+			raw:  "\x03\xea\x03\xeb\x00\x01",
+			want: "中文",
+		},
+		{
+			name: "bfrange",
+			cmap: "1 begincodespacerange <0000> <FFFF> endcodespacerange\n2 beginbfrange\n<0010> <0012> <0041>\n<0020> <0021> [<D840DC0B> <00660069>]\nendbfrange",
+			raw:  "\x00\x12\x00\x10\x00\x20\x00\x21",
+			want: "CA\U0002000Bfi",
+		},
+		{
+			name: "one byte codes",
+			cmap: "1 begincodespacerange <00> <FF> endcodespacerange\n1 beginbfchar\n<41> <00C5>\nendbfchar",
+			raw:  "AA",
+			want: "ÅÅ",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			document, _ := appendRevision([]byte("%PDF-1.7\n"), 0, map[int]string{
+				1: "<< /Type /Catalog /Pages 2 0 R >>",
+				2: "<< /Type /Pages /Kids [] /Count 0 >>",
+				3: fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(tt.cmap), tt.cmap),
+			})
+			rdr, err := pdf.NewReader(bytes.NewReader(document), int64(len(document)))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			ptr := rdr.Xref()[3].Ptr()
+			e := readToUnicode(rdr.Resolve(ptr, ptr))
+			if e == nil {
+				t.Fatalf("expected the CMap to be read")
+			}
+			if text := e.Decode(tt.raw); text != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, text)
+			}
+		})
+	}
+}
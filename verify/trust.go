@@ -0,0 +1,225 @@
+package verify
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Trust service types and statuses of ETSI TS 119 612 trusted lists.
+const (
+	ServiceTypeCAQC  = "http://uri.etsi.org/TrstSvc/Svctype/CA/QC"
+	ServiceTypeCAPKC = "http://uri.etsi.org/TrstSvc/Svctype/CA/PKC"
+	ServiceTypeQTST  = "http://uri.etsi.org/TrstSvc/Svctype/TSA/QTST"
+
+	ServiceStatusGranted   = "http://uri.etsi.org/TrstSvc/TrustedList/Svcstatus/granted"
+	ServiceStatusWithdrawn = "http://uri.etsi.org/TrstSvc/TrustedList/Svcstatus/withdrawn"
+
+	// QualifierNotQualified declares certificates of a CA/QC service not
+	// qualified.
+	QualifierNotQualified = "http://uri.etsi.org/TrstSvc/TrustedList/SvcInfoExt/NotQualified"
+
+	// Additional service information of CA/QC services, the purposes of the
+	// qualified certificates they issue.
+	ServiceInfoForeSignatures           = "http://uri.etsi.org/TrstSvc/TrustedList/SvcInfoExt/ForeSignatures"
+	ServiceInfoForeSeals                = "http://uri.etsi.org/TrstSvc/TrustedList/SvcInfoExt/ForeSeals"
+	ServiceInfoForWebSiteAuthentication = "http://uri.etsi.org/TrstSvc/TrustedList/SvcInfoExt/ForWebSiteAuthentication"
+)
+
+// trustedServiceStatuses are the statuses of trust services whose
+// certificates are trusted: granted and recognised at national level, and
+// the statuses in use before eIDAS.
+var trustedServiceStatuses = []string{
+	ServiceStatusGranted,
+	"http://uri.etsi.org/TrstSvc/TrustedList/Svcstatus/recognisedatnationallevel",
+	"http://uri.etsi.org/TrstSvc/TrustedList/Svcstatus/undersupervision",
+	"http://uri.etsi.org/TrstSvc/TrustedList/Svcstatus/supervisionincessation",
+	"http://uri.etsi.org/TrstSvc/TrustedList/Svcstatus/accredited",
+}
+
+// TrustProvider supplies trust anchors, such as the certificates of a trusted
+// list, that are trusted in addition to the system roots. Implementations
+// must be safe for concurrent use.
+type TrustProvider interface {
+	// TrustAnchors returns the trust anchors, with an error for those that could not be loaded
+	TrustAnchors(ctx context.Context) ([]TrustAnchor, error)
+}
+
+// TrustAnchor is a certificate trusted by a TrustProvider, with the trust
+// service it identifies when it comes from a trusted list.
+type TrustAnchor struct {
+	Certificate   *x509.Certificate    `json:"-"`
+	Source        string               `json:"source"`                   // The trust source, such as "eutl"
+	Territory     string               `json:"territory,omitempty"`      // Country code of the trusted list
+	Provider      string               `json:"provider,omitempty"`       // Name of the trust service provider
+	ServiceName   string               `json:"service_name,omitempty"`   // Name of the trust service
+	ServiceType   string               `json:"service_type,omitempty"`   // Such as ServiceTypeCAQC
+	Qualifiers    []string             `json:"qualifiers,omitempty"`     // Qualifier and additional service information URIs of the service
+	StatusHistory []TrustServiceStatus `json:"status_history,omitempty"` // Statuses of the service, the current status first
+}
+
+// TrustServiceStatus is a status of a trust service since a time.
+type TrustServiceStatus struct {
+	Status string    `json:"status"` // Such as ServiceStatusGranted
+	Since  time.Time `json:"since"`
+}
+
+// StatusAt returns the status of the trust service of the anchor at t, empty
+// if the anchor has no status history or the service did not exist at t.
+func (a *TrustAnchor) StatusAt(t time.Time) string {
+	for _, s := range a.StatusHistory {
+		if !s.Since.After(t) {
+			return s.Status
+		}
+	}
+	return ""
+}
+
+// trustedAt reports whether the anchor is trusted at t, anchors without a
+// status history always are.
+func (a *TrustAnchor) trustedAt(t time.Time) bool {
+	return len(a.StatusHistory) == 0 || slices.Contains(trustedServiceStatuses, a.StatusAt(t))
+}
+
+// qualifiedAt reports whether the anchor is a qualified certificate service
+// trusted at t whose certificates are not declared NotQualified, nor only
+// qualified for website authentication.
+func (a *TrustAnchor) qualifiedAt(t time.Time) bool {
+	return a.ServiceType == ServiceTypeCAQC && len(a.StatusHistory) > 0 && a.trustedAt(t) &&
+		!slices.Contains(a.Qualifiers, QualifierNotQualified) && !a.websiteAuthenticationOnly()
+}
+
+// websiteAuthenticationOnly reports whether the qualifiers of the anchor
+// limit its qualified certificates to website authentication.
+func (a *TrustAnchor) websiteAuthenticationOnly() bool {
+	has := func(q ...string) bool {
+		return slices.ContainsFunc(q, func(q string) bool { return slices.Contains(a.Qualifiers, q) })
+	}
+	return has(ServiceInfoForWebSiteAuthentication, QualifierQCForWSA) &&
+		!has(ServiceInfoForeSignatures, ServiceInfoForeSeals, QualifierQCForESig, QualifierQCForESeal)
+}
+
+// systemRoots returns the roots for chain verification before the trust
+// anchors: nil for the system roots, or an empty pool with
+// DisableSystemRoots.
+func (options *VerifyOptions) systemRoots() *x509.CertPool {
+	if options.DisableSystemRoots {
+		return x509.NewCertPool()
+	}
+	return nil
+}
+
+// trustAnchors returns the trust anchors of all TrustProviders of the
+// options, with the errors of those that failed to load them.
+func (options *VerifyOptions) trustAnchors() ([]TrustAnchor, error) {
+	var anchors []TrustAnchor
+	var errs []error
+	ctx := options.requestContext()
+	if options.HTTPClient != nil {
+		ctx = context.WithValue(ctx, httpClientKey{}, options.HTTPClient)
+	}
+	for _, provider := range options.TrustProviders {
+		a, err := provider.TrustAnchors(ctx)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		anchors = append(anchors, a...)
+	}
+	return anchors, errors.Join(errs...)
+}
+
+// verifyTrustAnchors verifies cert with opts against the anchors as roots.
+// It returns the chains and the anchor they end at, preferring a qualified
+// certificate service, which must be trusted at t. When the chains end only
+// at anchors that are not trusted at t they are returned with an error.
+func verifyTrustAnchors(cert *x509.Certificate, anchors []TrustAnchor, opts x509.VerifyOptions, t time.Time) ([][]*x509.Certificate, *TrustAnchor, error) {
+	opts.Roots = x509.NewCertPool()
+	for _, a := range anchors {
+		opts.Roots.AddCert(a.Certificate)
+	}
+	chains, err := cert.Verify(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var trusted, untrusted *TrustAnchor
+	for _, chain := range chains {
+		root := chain[len(chain)-1]
+		for i := range anchors {
+			a := &anchors[i]
+			switch {
+			case !a.Certificate.Equal(root):
+			case !a.trustedAt(t):
+				untrusted = a
+			case trusted == nil || (a.ServiceType == ServiceTypeCAQC && trusted.ServiceType != ServiceTypeCAQC):
+				trusted = a
+			}
+		}
+	}
+	if trusted == nil {
+		return chains, nil, fmt.Errorf("the trust service %s of %s has the status %q at %v",
+			untrusted.ServiceName, untrusted.Certificate.Subject, untrusted.StatusAt(t), t)
+	}
+	anchor := *trusted
+	return chains, &anchor, nil
+}
+
+// trustSources returns the sources of the anchors trusted at t that the
+// chains end at, such as "aatl" when Acrobat would show the chain trusted.
+func trustSources(chains [][]*x509.Certificate, anchors []TrustAnchor, t time.Time) []string {
+	var sources []string
+	for _, chain := range chains {
+		root := chain[len(chain)-1]
+		for i := range anchors {
+			if anchors[i].Certificate.Equal(root) && anchors[i].trustedAt(t) && !slices.Contains(sources, anchors[i].Source) {
+				sources = append(sources, anchors[i].Source)
+			}
+		}
+	}
+	slices.Sort(sources)
+	return sources
+}
+
+// httpClientKey is the context key of the HTTPClient of the options, which
+// downloads the trust lists of providers without a client of their own.
+type httpClientKey struct{}
+
+// downloadTrustList downloads the trust list at url with client, the client
+// of ctx or a client with a timeout of 30 seconds if nil. Only https URLs
+// are downloaded, so the list can not be replaced on the way.
+func downloadTrustList(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	if !strings.HasPrefix(strings.ToLower(url), "https://") {
+		return nil, fmt.Errorf("refusing to download %s, trust lists are only downloaded over HTTPS", url)
+	}
+	if client == nil {
+		client, _ = ctx.Value(httpClientKey{}).(*http.Client)
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for %s: %w", url, err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", url, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,162 @@
+package verify
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestVerifyTrustAnchors(t *testing.T) {
+	ca, caKey := newTestCRLIssuer(t, "pdfsign Qualified CA")
+	other, _ := newTestCRLIssuer(t, "pdfsign Other CA")
+	now := time.Now()
+
+	cert, _ := newTestLeaf(t, ca, caKey, 2, func(template *x509.Certificate) {
+		template.Subject = pkix.Name{CommonName: "pdfsign Qualified Signer"}
+	})
+
+	withdrawnAt := now.Add(-30 * time.Minute)
+	service := func(serviceType string, qualifiers ...string) TrustAnchor {
+		return TrustAnchor{
+			Certificate: ca,
+			Source:      "eutl",
+			ServiceName: "Test Qualified CA",
+			ServiceType: serviceType,
+			Qualifiers:  qualifiers,
+			StatusHistory: []TrustServiceStatus{
+				{Status: ServiceStatusWithdrawn, Since: withdrawnAt},
+				{Status: ServiceStatusGranted, Since: now.Add(-time.Hour)},
+			},
+		}
+	}
+	opts := x509.VerifyOptions{KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}
+	before := withdrawnAt.Add(-time.Minute)
+
+	tests := []struct {
+		name      string
+		anchors   []TrustAnchor
+		at        time.Time
+		wantErr   bool
+		qualified bool
+	}{
+		{name: "granted", anchors: []TrustAnchor{service(ServiceTypeCAQC)}, at: before, qualified: true},
+		{name: "withdrawn", anchors: []TrustAnchor{service(ServiceTypeCAQC)}, at: now, wantErr: true},
+		{name: "not qualified", anchors: []TrustAnchor{service(ServiceTypeCAQC, QualifierNotQualified)}, at: before},
+		{name: "non-qualified service", anchors: []TrustAnchor{service(ServiceTypeCAPKC)}, at: before},
+		{name: "website authentication", anchors: []TrustAnchor{service(ServiceTypeCAQC, ServiceInfoForWebSiteAuthentication)}, at: before},
+		{name: "website authentication and signatures", anchors: []TrustAnchor{service(ServiceTypeCAQC, ServiceInfoForWebSiteAuthentication, ServiceInfoForeSignatures)}, at: before, qualified: true},
+		{name: "qualified service preferred", anchors: []TrustAnchor{service(ServiceTypeCAPKC), service(ServiceTypeCAQC)}, at: before, qualified: true},
+		{name: "without status", anchors: []TrustAnchor{{Certificate: ca, Source: "pem"}}, at: now},
+		{name: "other anchor", anchors: []TrustAnchor{{Certificate: other}}, at: now, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts.CurrentTime = tt.at
+			_, anchor, err := verifyTrustAnchors(cert, tt.anchors, opts, tt.at)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %t, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if qualified := anchor.qualifiedAt(tt.at); qualified != tt.qualified {
+				t.Errorf("expected qualified %t, got %t", tt.qualified, qualified)
+			}
+		})
+	}
+}
+
+func TestTrustAnchorStatusAt(t *testing.T) {
+	anchor := TrustAnchor{StatusHistory: []TrustServiceStatus{
+		{Status: ServiceStatusWithdrawn, Since: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{Status: ServiceStatusGranted, Since: time.Date(2016, 7, 1, 0, 0, 0, 0, time.UTC)},
+	}}
+
+	for at, want := range map[time.Time]string{
+		time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC): "",
+		time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC): ServiceStatusGranted,
+		time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC): ServiceStatusWithdrawn,
+	} {
+		if status := anchor.StatusAt(at); status != want {
+			t.Errorf("expected status %q at %v, got %q", want, at, status)
+		}
+	}
+}
+
+func TestTrustSources(t *testing.T) {
+	root, _ := newTestCRLIssuer(t, "pdfsign Root")
+	chains := [][]*x509.Certificate{{root}}
+	now := time.Now()
+
+	anchors := []TrustAnchor{
+		{Certificate: root, Source: "eutl", StatusHistory: []TrustServiceStatus{{Status: ServiceStatusWithdrawn, Since: now.Add(-time.Hour)}}},
+		{Certificate: root, Source: "eutl", StatusHistory: []TrustServiceStatus{{Status: ServiceStatusGranted, Since: now.Add(-time.Hour)}}},
+		{Certificate: root, Source: "aatl"},
+	}
+	if sources := trustSources(chains, anchors, now); !slices.Equal(sources, []string{"aatl", "eutl"}) {
+		t.Errorf("expected the sources aatl and eutl, got %q", sources)
+	}
+	if sources := trustSources(chains, anchors[:1], now); sources != nil {
+		t.Errorf("expected no sources for a withdrawn service, got %q", sources)
+	}
+}
+
+// countingTransport counts the requests it sends with its transport.
+type countingTransport struct {
+	transport http.RoundTripper
+	requests  atomic.Int32
+}
+
+func (c *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	c.requests.Add(1)
+	return c.transport.RoundTrip(r)
+}
+
+func TestTrustAnchorsHTTPClient(t *testing.T) {
+	adobe, adobeKey := newTestCRLIssuer(t, "pdfsign Adobe Root")
+	root, _ := newTestCRLIssuer(t, "pdfsign Approved Root")
+	_, list := newTestAATL(t, root.Raw)
+	document := signTestAATL(t, list, adobe, adobeKey)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(document)
+	}))
+	defer server.Close()
+
+	transport := server.Client().Transport
+	shared, own := &countingTransport{transport: transport}, &countingTransport{transport: transport}
+	options := &VerifyOptions{
+		HTTPClient: &http.Client{Transport: shared},
+		TrustProviders: []TrustProvider{
+			&AATLProvider{Roots: []*x509.Certificate{adobe}, URL: server.URL},
+			&AATLProvider{Roots: []*x509.Certificate{adobe}, URL: server.URL, HTTPClient: &http.Client{Transport: own}},
+		},
+	}
+	anchors, err := options.trustAnchors()
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	if len(anchors) != 2 {
+		t.Fatalf("expected 2 trust anchors, got %d", len(anchors))
+	}
+	if shared.requests.Load() != 1 || own.requests.Load() != 1 {
+		t.Errorf("expected a download with each client, got %d and %d", shared.requests.Load(), own.requests.Load())
+	}
+}
+
+func TestDownloadTrustListHTTPS(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("expected no request over HTTP")
+	}))
+	defer server.Close()
+
+	if _, err := downloadTrustList(context.Background(), nil, server.URL); err == nil {
+		t.Errorf("expected an error for an http URL")
+	}
+}
@@ -4,7 +4,10 @@ package verify
 // Types are defined in verify.go to maintain backward compatibility.
 
 import (
+	"context"
+	"crypto"
 	"crypto/x509"
+	"encoding/asn1"
 	"net/http"
 	"time"
 
@@ -22,6 +25,13 @@ type VerifyOptions struct {
 	// Common alternatives: Email Protection (1.3.6.1.5.5.7.3.4), Client Auth (1.3.6.1.5.5.7.3.2)
 	AllowedEKUs []x509.ExtKeyUsage
 
+	// RequiredEKUOIDs and AllowedEKUOIDs are Extended Key Usages, required
+	// or acceptable like RequiredEKUs and AllowedEKUs, given by their OIDs,
+	// for those that crypto/x509 has no ExtKeyUsage constant for
+	// Default: OIDExtKeyUsageDocumentSigning required
+	RequiredEKUOIDs []asn1.ObjectIdentifier
+	AllowedEKUOIDs  []asn1.ObjectIdentifier
+
 	// RequireDigitalSignatureKU requires the Digital Signature bit in Key Usage
 	RequireDigitalSignatureKU bool
 
@@ -41,27 +51,149 @@ type VerifyOptions struct {
 	// Only enable this for testing or when you explicitly trust the embedded certificates
 	AllowUntrustedRoots bool
 
+	// TrustProviders supply trust anchors, such as those of the EU trusted lists, trusted in addition to the
+	// system roots. Signatures whose chain ends at a qualified certificate service of a trusted list are qualified
+	TrustProviders []TrustProvider
+
+	// DisableSystemRoots trusts only the anchors of the TrustProviders, instead of in addition to the system roots
+	DisableSystemRoots bool
+
 	// EnableExternalRevocationCheck when true, performs external OCSP and CRL checks
 	// using the URLs found in certificate extensions
 	EnableExternalRevocationCheck bool
 
-	// HTTPClient specifies the HTTP client to use for external revocation checking
-	// If nil, http.DefaultClient will be used
+	// CRLFallbackOnly when true, downloads CRLs only for certificates whose OCSP status
+	// could not be determined, by default CRLs complement OCSP and are checked as well
+	CRLFallbackOnly bool
+
+	// HTTPClient specifies the HTTP client of external revocation checks and of the downloads of trust providers
+	// without an HTTPClient of their own. Proxies and TLS settings are those of its Transport, the timeout of a
+	// request its Timeout. If nil, a client with HTTPTimeout is used for revocation checks
 	HTTPClient *http.Client
 
-	// HTTPTimeout specifies the timeout for HTTP requests during external revocation checking
+	// RevocationCache stores the OCSP responses and CRLs of external revocation checks
+	// until their next update, so they are shared between documents. If nil, nothing is cached
+	RevocationCache RevocationCache
+
+	// RevocationBundle supplies OCSP responses and CRLs fetched in advance for the certificates without embedded
+	// revocation data, which are checked without network requests unless EnableExternalRevocationCheck is set too
+	RevocationBundle *RevocationBundle
+
+	// HTTPTimeout specifies the timeout for HTTP requests during external revocation checking without an HTTPClient
 	// If zero, a default timeout of 10 seconds will be used
 	HTTPTimeout time.Duration
+
+	// Context cancels the external revocation checks and stops the verification of further signatures
+	// If nil, context.Background() will be used
+	Context context.Context
+
+	// Workers verifies up to this many signatures of a document at the same time. The TrustProviders and the
+	// RevocationCache are shared between them. If zero, runtime.NumCPU() is used
+	Workers int
+
+	// ValidationTime evaluates the signatures as of this time instead of the signing time proven by a timestamp,
+	// for the validity of the certificates and whether they were revoked. If zero, the time of an embedded
+	// timestamp or else the current time is used
+	ValidationTime time.Time
+
+	// AlgorithmPolicy declares digest algorithms, RSA key sizes and curves weak from a date on
+	// If nil, DefaultAlgorithmPolicy() is used
+	AlgorithmPolicy *AlgorithmPolicy
+
+	// SHA1Policy accepts SHA-1 digests of signatures and certificates always, as for archives of
+	// adbe.pkcs7.sha1 documents, or never, instead of by the date of the AlgorithmPolicy
+	// If empty, SHA1ByDate is used
+	SHA1Policy SHA1Policy
+
+	// RejectWeakAlgorithms makes signatures with weak algorithms invalid, instead of only reporting them
+	RejectWeakAlgorithms bool
+
+	// RequireTimestamp requires a valid signature timestamp, as in PAdES baseline-T
+	RequireTimestamp bool
+
+	// RequireLTV requires the chain and revocation data of each signature in the document, as in PAdES baseline-LT
+	RequireLTV bool
+
+	// MinRSAKeySize is the minimum size in bits of the RSA keys of the certificates of a signature
+	// If zero, RSA keys of any size are accepted
+	MinRSAKeySize int
+
+	// CheckPDFA reports whether the document and its signatures break the PDF/A conformance the document, or a
+	// revision of it that is signed, declares, for archives that must keep documents PDF/A conforming
+	CheckPDFA bool
+
+	// RepairXref rebuilds the cross-reference table of a document whose table can not be read or gives wrong
+	// offsets from the objects of the document, the byte ranges of the signatures are still checked on the file
+	RepairXref bool
+
+	// chainEKUs replaces the EKUs of getVerificationEKUs for chain verification,
+	// the TSA certificates of document timestamps are verified for time stamping
+	chainEKUs []x509.ExtKeyUsage
 }
 
 type Response struct {
 	Error string
 
-	DocumentInfo DocumentInfo
-	Signers      []Signer
+	DocumentInfo       DocumentInfo
+	Signers            []Signer
+	DocumentTimestamps *DocumentTimestampChain // Chain of document timestamps, nil if the document has none
+	Timeline           *Timeline               // Signatures in the order of the revisions, nil if the document has none
+	PDFA               *PDFAConformance        // PDF/A conformance with CheckPDFA, nil if the document declares none
+	XrefRepaired       bool                    // Whether the cross-reference table was rebuilt with RepairXref
+	Linearization      *Linearization          // Linearization of the document, nil if it is not linearized
+}
+
+// Linearization is the linearization, or fast web view, of a document. The
+// incremental update of a signature invalidates it, readers then read the
+// document as one that is not linearized.
+type Linearization struct {
+	Length  int64  `json:"length"`            // Length of the linearized file, the L entry of the linearization dictionary
+	Valid   bool   `json:"valid"`             // Whether the document is still linearized
+	Updates int    `json:"updates"`           // Number of incremental updates after the linearized file
+	Warning string `json:"warning,omitempty"` // Why the document is no longer linearized
+}
+
+// DocumentTimestampChain is the evaluation of the document timestamps of a
+// document, in the order of the revisions that added them, that preserve the
+// earlier revisions as in PAdES baseline-LTA.
+type DocumentTimestampChain struct {
+	Count          int        `json:"count"`                     // Number of document timestamps
+	Valid          bool       `json:"valid"`                     // Whether every document timestamp is valid and protects the previous one
+	ProtectedUntil *time.Time `json:"protected_until,omitempty"` // When the TSA certificate of the last document timestamp expires
+	Errors         []string   `json:"errors,omitempty"`          // Why the chain is not valid
+
+	Unbroken bool     `json:"unbroken"`       // Whether the chain is valid and validation data was added to the DSS before each renewal
+	Gaps     []string `json:"gaps,omitempty"` // The renewals without new validation data in the DSS
+}
+
+// Modification is an object changed by an incremental update after a
+// signature.
+type Modification struct {
+	Type        string `json:"type"`            // "signature", "document_timestamp", "dss", "form_fill", "annotation", "metadata" or "content_change"
+	Object      string `json:"object"`          // Reference of the object, such as "12 0 R"
+	Description string `json:"description"`     // What the object is, such as "page 3 content stream"
+	Field       string `json:"field,omitempty"` // Fully qualified name of a changed form field
+	Added       bool   `json:"added"`           // Whether the object is new, rather than a changed object of the signed revision
+}
+
+// ShadowAttack is a change after signing that matches a pattern of the
+// shadow attacks, which prepare content in the signed revision to reveal or
+// swap it with changes that are permitted after signing.
+type ShadowAttack struct {
+	Pattern     string `json:"pattern"`     // "hide", "replace" or "hide_and_replace"
+	Object      string `json:"object"`      // Reference of the object, such as "12 0 R"
+	Description string `json:"description"` // What the change does, such as "page 1 annotation hidden by a later revision"
+}
+
+// FieldLock describes the form fields locked by a signature, from a FieldMDP
+// transform or the lock dictionary of its signature field.
+type FieldLock struct {
+	Action string   `json:"action"`           // "All", "Include" or "Exclude"
+	Fields []string `json:"fields,omitempty"` // Fully qualified names of the included or excluded fields
 }
 
 type Signer struct {
+	SignatureType      string               `json:"signature_type"` // "signature", "document_timestamp" or "usage_rights"
 	Name               string               `json:"name"`
 	Reason             string               `json:"reason"`
 	Location           string               `json:"location"`
@@ -74,9 +206,78 @@ type Signer struct {
 	SignatureTime      *time.Time           `json:"signature_time,omitempty"`   // Time from the signature object, may be untrusted
 	TimestampStatus    string               `json:"timestamp_status,omitempty"` // "valid", "invalid", "missing"
 	TimestampTrusted   bool                 `json:"timestamp_trusted"`          // Whether timestamp certificate chain is trusted
+	TimestampTime      *time.Time           `json:"timestamp_time,omitempty"`   // Time proven by a valid timestamp token
+	TimestampError     string               `json:"timestamp_error,omitempty"`  // Why the timestamp token is invalid
 	VerificationTime   *time.Time           `json:"verification_time"`          // Time used for certificate validation
-	TimeSource         string               `json:"time_source"`                // "embedded_timestamp", "signature_time", "current_time"
+	TimeSource         string               `json:"time_source"`                // "embedded_timestamp", "signature_time", "current_time", "validation_time"
 	TimeWarnings       []string             `json:"time_warnings,omitempty"`    // Warnings about time validation
+	LTVEnabled         bool                 `json:"ltv_enabled"`                // Whether the chain and its revocation data are embedded in the signature or DSS
+	LTVError           string               `json:"ltv_error,omitempty"`        // Why the signature is not LTV enabled
+
+	CMSSigningTime      *time.Time `json:"cms_signing_time,omitempty"`      // Signing time attribute of the signature, claimed by the signer
+	SigningTimeWarnings []string   `json:"signing_time_warnings,omitempty"` // Inconsistencies between the claimed times, the timestamp and the validity of the signing certificate
+
+	ProvenTime *time.Time `json:"proven_time,omitempty"` // Earliest time the signature is proven to have existed, by its timestamp or a valid document timestamp of a later revision
+	ProvenBy   string     `json:"proven_by,omitempty"`   // "signature_timestamp" or "document_timestamp"
+
+	DocumentTimestampProtected bool `json:"document_timestamp_protected"` // Whether a valid document timestamp of a later revision covers the signature
+
+	ByteRangeValid  bool     `json:"byte_range_valid"`            // Whether the byte range covers the signed revision except the signature contents
+	ByteRangeErrors []string `json:"byte_range_errors,omitempty"` // Why the byte range does not cover the signed revision
+	UnsignedBytes   int64    `json:"unsigned_bytes,omitempty"`    // Bytes of the signed revision outside the byte range and the signature contents
+
+	ContentsAnomalies []string `json:"contents_anomalies,omitempty"` // Data in the signature contents besides the signature and its zero padding
+
+	ModifiedAfterSigning    bool           `json:"modified_after_signing"`       // Whether incremental updates follow the signed revision
+	Modifications           []Modification `json:"modifications,omitempty"`      // The objects changed by those updates
+	DisallowedModifications bool           `json:"disallowed_modifications"`     // Whether the updates changed the content of the signed revision
+	ModificationError       string         `json:"modification_error,omitempty"` // Why the updates could not be analyzed
+	ShadowAttacks           []ShadowAttack `json:"shadow_attacks,omitempty"`     // Changes of the updates that match the patterns of shadow attacks
+
+	CertificationLevel int      `json:"certification_level,omitempty"` // DocMDP level of a certification signature: 1 no changes, 2 form filling and signing, 3 also annotations
+	DocMDPViolations   []string `json:"docmdp_violations,omitempty"`   // Changes after the certification that its level does not permit
+
+	FieldLocks         []FieldLock `json:"field_locks,omitempty"`         // The form fields locked by the signature with FieldMDP
+	FieldMDPViolations []string    `json:"fieldmdp_violations,omitempty"` // Changes of locked form fields after signing
+
+	PolicyErrors []string `json:"policy_errors,omitempty"` // Requirements of the verification options the signature does not meet
+
+	DigestAlgorithm string   `json:"digest_algorithm,omitempty"` // Digest algorithm of the signature, such as "SHA-256"
+	WeakAlgorithms  []string `json:"weak_algorithms,omitempty"`  // Algorithms and keys of the signature that are weak at its verification time
+
+	TrustAnchor *TrustAnchor `json:"trust_anchor,omitempty"` // Anchor of a TrustProvider the chain of the signing certificate ends at
+	Qualified   bool         `json:"qualified"`              // Whether that anchor is a qualified certificate service of a trusted list, granted at the verification time
+
+	TrustSources []string `json:"trust_sources,omitempty"` // Sources of the anchors the chain ends at, such as "eutl" or "aatl" when Acrobat would show the signature trusted
+
+	QCStatements      *QCStatements `json:"qc_statements,omitempty"`       // Statements of the QCStatements extension of the signing certificate
+	QCStatementsError string        `json:"qc_statements_error,omitempty"` // Why the extension could not be parsed
+	SignatureLevel    string        `json:"signature_level,omitempty"`     // Such as LevelQESig, by the qualification of the signing certificate
+
+	Countersignatures []Countersignature `json:"countersignatures,omitempty"` // CMS countersignatures of the signature value
+
+	UsageRights *UsageRights `json:"usage_rights,omitempty"` // Rights enabled by a usage rights signature
+
+	Hidden             bool     `json:"hidden"`                        // Whether no widget of the signature field can be seen on a page
+	VisibilityWarnings []string `json:"visibility_warnings,omitempty"` // Why widgets cannot be seen: annotation flags, no area, off the page or on no page
+
+	AppearanceText       string   `json:"appearance_text,omitempty"`       // Text shown by the appearance of the signature field, a line per line
+	AppearanceMismatches []string `json:"appearance_mismatches,omitempty"` // How the appearance contradicts the signing certificate or the signing time
+
+	ByteRange       []int64 `json:"byte_range,omitempty"`        // Offset and length pairs of the ByteRange of the signature dictionary
+	ByteRangeDigest string  `json:"byte_range_digest,omitempty"` // Hex digest of the bytes of the byte range with DigestAlgorithm
+	MessageDigest   string  `json:"message_digest,omitempty"`    // Hex digest the signature signs, such as its message digest attribute, equal to ByteRangeDigest if it is intact
+	Revision        int     `json:"revision,omitempty"`          // Revision covered by the signature, 1 for the original document
+	RevisionStart   int64   `json:"revision_start"`              // Offset of the first byte of that revision, after the end of the previous revision
+	RevisionEnd     int64   `json:"revision_end,omitempty"`      // Offset after the last byte of that revision, where the byte range ends
+
+	ErrorCodes []string `json:"error_codes,omitempty"` // Codes of the causes of the errors of Err, such as "digest_mismatch"
+
+	timestampCertificate *x509.Certificate // Certificate of the TSA of a valid document timestamp
+	signingCertificate   *x509.Certificate // Certificate of the signer, if the signature names it
+	signatureError       error             // Why the signature value could not be verified
+	digestAlgorithm      crypto.Hash       // The digest algorithm of DigestAlgorithm
+	docMDPReference      int               // DocMDP level of the transform of the signature dictionary, 0 without one
 }
 
 type Certificate struct {
@@ -89,12 +290,22 @@ type Certificate struct {
 	OCSPResponse         *ocsp.Response    `json:"ocsp_response"`
 	OCSPEmbedded         bool              `json:"ocsp_embedded"`
 	OCSPExternal         bool              `json:"ocsp_external"`
+	OCSPStatus           string            `json:"ocsp_status,omitempty"`      // "good", "revoked" or "unknown" from the OCSP response
+	OCSPThisUpdate       *time.Time        `json:"ocsp_this_update,omitempty"` // When the status in the OCSP response was known to be correct
+	OCSPNextUpdate       *time.Time        `json:"ocsp_next_update,omitempty"` // When newer status information will be available
+	OCSPError            string            `json:"ocsp_error,omitempty"`       // Why the external OCSP check failed
 	CRLRevoked           time.Time         `json:"crl_revoked"`
 	CRLEmbedded          bool              `json:"crl_embedded"`
 	CRLExternal          bool              `json:"crl_external"`
+	CRLError             string            `json:"crl_error,omitempty"` // Why the external CRL check failed
 	RevocationWarning    string            `json:"revocation_warning,omitempty"`
 	RevocationTime       *time.Time        `json:"revocation_time,omitempty"` // When the certificate was revoked (if applicable)
 	RevokedBeforeSigning bool              `json:"revoked_before_signing"`    // Whether revocation occurred before signing
+
+	Expired     bool   `json:"expired"`                // Whether the certificate has expired at the current or validation time
+	ExpiryError string `json:"expiry_error,omitempty"` // Why the expired certificate is not accepted with the time of the timestamp
+
+	verifyErr error // The error of VerifyError
 }
 
 // DocumentInfo contains document information.
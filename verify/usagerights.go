@@ -0,0 +1,74 @@
+package verify
+
+import (
+	"github.com/digitorus/pdf"
+)
+
+// UsageRights are the rights a usage rights signature enables in PDF
+// processors such as Adobe Reader, the UR transform parameters of ISO
+// 32000-1, 12.8.2.3.
+type UsageRights struct {
+	Document   []string `json:"document,omitempty"`   // Such as "FullSave"
+	Annots     []string `json:"annots,omitempty"`     // Such as "Create", "Delete", "Modify" or "Online"
+	Form       []string `json:"form,omitempty"`       // Such as "FillIn", "Import", "SubmitStandalone" or "SpawnTemplate"
+	Signature  []string `json:"signature,omitempty"`  // "Modify" to sign signature fields
+	EF         []string `json:"ef,omitempty"`         // Rights on embedded files, such as "Create" or "Import"
+	Message    string   `json:"message,omitempty"`    // Msg: the text PDF processors show when they open the document
+	Restricted bool     `json:"restricted,omitempty"` // P: whether the rights restrict those of the document in all PDF processors
+}
+
+// usageRightsTransform returns the UR3 or UR signature reference of the
+// signature dictionary v, and false if it has none.
+func usageRightsTransform(v pdf.Value) (pdf.Value, bool) {
+	reference := v.Key("Reference")
+	for i := 0; i < reference.Len(); i++ {
+		switch reference.Index(i).Key("TransformMethod").Name() {
+		case "UR3", "UR":
+			return reference.Index(i), true
+		}
+	}
+	return pdf.Value{}, false
+}
+
+// isUsageRightsSignature reports whether the signature dictionary v is a
+// usage rights signature: the UR3 or UR entry of the Perms dictionary perms
+// of the catalog, or a signature with a UR3 or UR signature reference.
+func isUsageRightsSignature(v, perms pdf.Value) bool {
+	if !perms.IsNull() {
+		for _, key := range []string{"UR3", "UR"} {
+			if ur := perms.Key(key); !ur.IsNull() && ur.GetPtr() == v.GetPtr() {
+				return true
+			}
+		}
+	}
+	_, ok := usageRightsTransform(v)
+	return ok
+}
+
+// usageRights returns the rights of the usage rights signature dictionary v,
+// empty if it has no UR transform parameters.
+func usageRights(v pdf.Value) *UsageRights {
+	rights := &UsageRights{}
+	reference, ok := usageRightsTransform(v)
+	if !ok {
+		return rights
+	}
+
+	params := reference.Key("TransformParams")
+	names := func(key string) []string {
+		var names []string
+		array := params.Key(key)
+		for i := 0; i < array.Len(); i++ {
+			names = append(names, array.Index(i).Name())
+		}
+		return names
+	}
+	rights.Document = names("Document")
+	rights.Annots = names("Annots")
+	rights.Form = names("Form")
+	rights.Signature = names("Signature")
+	rights.EF = names("EF")
+	rights.Message = params.Key("Msg").Text()
+	rights.Restricted = params.Key("P").Bool()
+	return rights
+}
@@ -0,0 +1,108 @@
+package verify
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/digitorus/pdf"
+)
+
+func TestIsUsageRightsSignature(t *testing.T) {
+	tests := []struct {
+		name      string
+		catalog   string
+		signature string
+		want      bool
+	}{
+		{
+			name:      "UR3",
+			catalog:   "<< /Type /Catalog /Perms << /UR3 2 0 R >> >>",
+			signature: "<< /Type /Sig /Filter /Adobe.PPKLite >>",
+			want:      true,
+		},
+		{
+			name:      "UR",
+			catalog:   "<< /Type /Catalog /Perms << /UR 2 0 R >> >>",
+			signature: "<< /Type /Sig /Filter /Adobe.PPKLite >>",
+			want:      true,
+		},
+		{
+			name:      "signature reference",
+			catalog:   "<< /Type /Catalog >>",
+			signature: "<< /Type /Sig /Reference [<< /TransformMethod /UR3 /TransformParams << /V /2.2 >> >>] >>",
+			want:      true,
+		},
+		{
+			name:      "certification signature",
+			catalog:   "<< /Type /Catalog /Perms << /DocMDP 2 0 R >> >>",
+			signature: "<< /Type /Sig /Reference [<< /TransformMethod /DocMDP /TransformParams << /P 1 >> >>] >>",
+		},
+		{
+			name:      "approval signature",
+			catalog:   "<< /Type /Catalog >>",
+			signature: "<< /Type /Sig /Filter /Adobe.PPKLite >>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			document, _ := appendRevision([]byte("%PDF-1.7\n"), 0, map[int]string{1: tt.catalog, 2: tt.signature})
+			rdr, err := pdf.NewReader(bytes.NewReader(document), int64(len(document)))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			ptr := rdr.Xref()[2].Ptr()
+			perms := rdr.Trailer().Key("Root").Key("Perms")
+			if got := isUsageRightsSignature(rdr.Resolve(ptr, ptr), perms); got != tt.want {
+				t.Errorf("expected usage rights signature %t, got %t", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestUsageRights(t *testing.T) {
+	document, _ := appendRevision([]byte("%PDF-1.7\n"), 0, map[int]string{
+		1: "<< /Type /Catalog /Perms << /UR3 2 0 R >> >>",
+		2: "<< /Type /Sig /Reference [<< /TransformMethod /UR3 /TransformParams << /Type /TransformParams /V /2.2 " +
+			"/Document [/FullSave] /Form [/FillIn /Import /SpawnTemplate] /Annots [/Create /Delete /Modify] " +
+			"/Signature [/Modify] /EF [/Create] /Msg (Reader extended) /P true >> >>] >>",
+	})
+	rdr, err := pdf.NewReader(bytes.NewReader(document), int64(len(document)))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	ptr := rdr.Xref()[2].Ptr()
+
+	want := &UsageRights{
+		Document:   []string{"FullSave"},
+		Annots:     []string{"Create", "Delete", "Modify"},
+		Form:       []string{"FillIn", "Import", "SpawnTemplate"},
+		Signature:  []string{"Modify"},
+		EF:         []string{"Create"},
+		Message:    "Reader extended",
+		Restricted: true,
+	}
+	if got := usageRights(rdr.Resolve(ptr, ptr)); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected usage rights %+v, got %+v", want, got)
+	}
+}
+
+func TestReportUsageRights(t *testing.T) {
+	valid := Signer{SignatureType: "signature", ValidSignature: true, ByteRangeValid: true, TrustedIssuer: true}
+	usageRights := Signer{SignatureType: "usage_rights", ValidSignature: true, ByteRangeValid: true, UsageRights: &UsageRights{Form: []string{"FillIn"}}}
+
+	// The untrusted usage rights signature does not change the validity of
+	// the document
+	report := (&Response{Signers: []Signer{valid, usageRights}}).Report()
+	if !report.Valid {
+		t.Errorf("expected a valid report")
+	}
+	if s := report.Signatures[1]; s.Type != "usage_rights" || s.Status != "indeterminate" || s.UsageRights == nil {
+		t.Errorf("expected the labeled usage rights signature, got %+v", s)
+	}
+
+	if report := (&Response{Signers: []Signer{usageRights}}).Report(); report.Valid {
+		t.Errorf("expected an invalid report without signatures")
+	}
+}
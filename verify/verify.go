@@ -1,10 +1,14 @@
 package verify
 
 import (
+	"context"
 	"crypto/x509"
+	"encoding/asn1"
 	"fmt"
 	"io"
 	"os"
+	"runtime"
+	"sync"
 	"time"
 
 	"github.com/digitorus/pdf"
@@ -17,6 +21,7 @@ func DefaultVerifyOptions() *VerifyOptions {
 			// Document Signing EKU per RFC 9336
 			x509.ExtKeyUsage(36), // 1.3.6.1.5.5.7.3.36 - not defined in standard library yet
 		},
+		RequiredEKUOIDs: []asn1.ObjectIdentifier{OIDExtKeyUsageDocumentSigning},
 		AllowedEKUs: []x509.ExtKeyUsage{
 			x509.ExtKeyUsageEmailProtection, // Common alternative
 			x509.ExtKeyUsageClientAuth,      // Another common alternative
@@ -32,6 +37,33 @@ func DefaultVerifyOptions() *VerifyOptions {
 	}
 }
 
+// requestContext returns the Context of the options, context.Background() if
+// none is set.
+func (options *VerifyOptions) requestContext() context.Context {
+	if options == nil || options.Context == nil {
+		return context.Background()
+	}
+	return options.Context
+}
+
+// workers returns the number of signatures verified at the same time,
+// runtime.NumCPU() if Workers is not set.
+func (options *VerifyOptions) workers() int {
+	if options == nil || options.Workers <= 0 {
+		return runtime.NumCPU()
+	}
+	return options.Workers
+}
+
+// validationTime returns the ValidationTime of the options, the current time
+// if none is set.
+func (options *VerifyOptions) validationTime() time.Time {
+	if options == nil || options.ValidationTime.IsZero() {
+		return time.Now()
+	}
+	return options.ValidationTime
+}
+
 func VerifyFile(file *os.File) (apiResp *Response, err error) {
 	return VerifyFileWithOptions(file, DefaultVerifyOptions())
 }
@@ -60,10 +92,11 @@ func VerifyWithOptions(file io.ReaderAt, size int64, options *VerifyOptions) (ap
 	}()
 	apiResp = &Response{}
 
-	rdr, err := pdf.NewReader(file, size)
+	rdr, repaired, err := openReader(file, size, options)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file: %v", err)
 	}
+	apiResp.XrefRepaired = repaired
 
 	// Parse document info from the PDF Info dictionary
 	info := rdr.Trailer().Key("Info")
@@ -77,13 +110,31 @@ func VerifyWithOptions(file io.ReaderAt, size int64, options *VerifyOptions) (ap
 		documentInfo.Pages = int(pages.Int64())
 	}
 
-	// AcroForm will contain a SigFlags value if the form contains a digital signature
+	// The Perms dictionary refers to the certification signature in DocMDP
+	// and the usage rights signature in UR3
+	permissions := rdr.Trailer().Key("Root").Key("Perms")
+
+	// AcroForm will contain a SigFlags value if the form contains a digital
+	// signature, a usage rights signature needs no signature field
 	t := rdr.Trailer().Key("Root").Key("AcroForm").Key("SigFlags")
-	if t.IsNull() {
+	if t.IsNull() && permissions.Key("UR3").IsNull() && permissions.Key("UR").IsNull() {
 		return nil, fmt.Errorf("no digital signature in document")
 	}
 
-	// Walk over the cross references in the document
+	// The Document Security Store with validation material of the signatures
+	dss := rdr.Trailer().Key("Root").Key("DSS")
+
+	// The DocMDP entry refers to the certification signature
+	perms := permissions.Key("DocMDP")
+
+	// The pages of the annotations, for the visibility of signature widgets
+	pageAnnotations := sync.OnceValue(func() map[uint32]pageObject {
+		return pageObjects(rdr)
+	})
+
+	// Walk over the cross references in the document, the signatures are
+	// verified in parallel and reported in the order of their objects
+	var signatures []pdf.Value
 	for _, x := range rdr.Xref() {
 		// Get the xref object Value
 		v := rdr.Resolve(x.Ptr(), x.Ptr())
@@ -92,20 +143,57 @@ func VerifyWithOptions(file io.ReaderAt, size int64, options *VerifyOptions) (ap
 		if v.Key("Filter").Name() != "Adobe.PPKLite" {
 			continue
 		}
+		signatures = append(signatures, v)
+	}
+
+	results := make([]signatureResult, len(signatures))
+	parallel(len(signatures), options.workers(), func(i int) {
+		v := signatures[i]
+
+		// Stop when the caller canceled the verification
+		if err := options.requestContext().Err(); err != nil {
+			results[i].err = err
+			return
+		}
 
 		// Use the new modular signature processing function
-		signer, errorMsg, err := processSignature(v, file, options)
+		signer, errorMsg, err := processSignature(v, dss, file, options)
 		if err != nil {
 			// Skip this signature if there's a critical error
+			return
+		}
+		if isUsageRightsSignature(v, permissions) {
+			signer.SignatureType = "usage_rights"
+			signer.UsageRights = usageRights(v)
+		}
+		checkByteRange(v, file, size, &signer)
+		checkContents(v, &signer)
+		checkObjectStream(v, rdr, &signer)
+		signer.ByteRangeDigest = byteRangeDigest(v, file, signer.digestAlgorithm)
+		signer.CertificationLevel = docMDPLevel(v, perms)
+		signer.docMDPReference = docMDPReference(v)
+		signer.FieldLocks = signatureFieldLocks(v, rdr.Trailer().Key("Root"))
+		if signer.SignatureType == "signature" {
+			signer.Hidden, signer.VisibilityWarnings = signatureVisibility(v, rdr, pageAnnotations())
+			signer.AppearanceText, signer.AppearanceMismatches = checkAppearance(v, rdr, &signer)
+		}
+		results[i] = signatureResult{signer: &signer, errorMsg: errorMsg}
+	})
+
+	for _, result := range results {
+		if result.err != nil {
+			return nil, result.err
+		}
+		if result.signer == nil {
 			continue
 		}
 
 		// Set any error message if present
-		if errorMsg != "" && apiResp.Error == "" {
-			apiResp.Error = errorMsg
+		if result.errorMsg != "" && apiResp.Error == "" {
+			apiResp.Error = result.errorMsg
 		}
 
-		apiResp.Signers = append(apiResp.Signers, signer)
+		apiResp.Signers = append(apiResp.Signers, *result.signer)
 	}
 
 	if apiResp == nil {
@@ -113,6 +201,79 @@ func VerifyWithOptions(file io.ReaderAt, size int64, options *VerifyOptions) (ap
 	}
 
 	apiResp.DocumentInfo = documentInfo
+	apiResp.DocumentTimestamps = evaluateDocumentTimestamps(apiResp.Signers, options.validationTime())
+	ends := revisionEnds(file, size)
+	setRevisions(apiResp.Signers, ends)
+	apiResp.Linearization = checkLinearization(file, size, ends, documentInfo.Pages)
+	detectModifications(file, size, rdr, apiResp.Signers)
+	detectShadowAttacks(file, rdr, apiResp.Signers)
+	checkCertifications(apiResp.Signers)
+	checkDocMDP(apiResp.Signers)
+	checkFieldMDP(apiResp.Signers)
+	apiResp.Timeline = buildTimeline(file, size, rdr, apiResp.Signers, ends)
+	checkArchiveTimestamps(apiResp.Signers, apiResp.DocumentTimestamps, apiResp.Timeline)
+	if options.CheckPDFA {
+		apiResp.PDFA = checkPDFA(file, rdr, signatures)
+	}
+	checkPolicy(apiResp.Signers, options)
+	checkAlgorithms(apiResp.Signers, options)
+	checkQualification(apiResp.Signers)
+	for i := range apiResp.Signers {
+		apiResp.Signers[i].ErrorCodes = errorCodes(apiResp.Signers[i].Err())
+	}
 
 	return
 }
+
+// signatureResult is the verification of a signature by a worker, a nil
+// signer for a signature that was skipped.
+type signatureResult struct {
+	signer   *Signer
+	errorMsg string
+	err      error
+}
+
+// parallel calls f for 0 to n-1 from up to workers goroutines and returns
+// when all calls returned. A panic of f is raised again in the caller once
+// the other calls returned.
+func parallel(n, workers int, f func(i int)) {
+	workers = min(workers, n)
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			f(i)
+		}
+		return
+	}
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		panicked any
+	)
+	indexes := make(chan int)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				func() {
+					defer func() {
+						if r := recover(); r != nil {
+							once.Do(func() { panicked = r })
+						}
+					}()
+					f(i)
+				}()
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	if panicked != nil {
+		panic(panicked)
+	}
+}
@@ -1,9 +1,17 @@
 package verify
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/digitorus/pkcs7"
 )
 
 func TestFile(t *testing.T) {
@@ -56,6 +64,15 @@ func TestFile(t *testing.T) {
 		if len(signer.Certificates) == 0 {
 			t.Errorf("Signer %d has no certificates", i+1)
 		}
+		if !signer.ByteRangeValid {
+			t.Errorf("Signer %d byte range does not cover the document: %v", i+1, signer.ByteRangeErrors)
+		}
+		if signer.ValidSignature && (signer.MessageDigest == "" || signer.MessageDigest != signer.ByteRangeDigest) {
+			t.Errorf("Signer %d signs the digest %q of the byte range with digest %q", i+1, signer.MessageDigest, signer.ByteRangeDigest)
+		}
+		if signer.Revision == 0 || signer.RevisionEnd <= signer.RevisionStart {
+			t.Errorf("Signer %d covers revision %d from %d to %d", i+1, signer.Revision, signer.RevisionStart, signer.RevisionEnd)
+		}
 	}
 	if !validSignatureFound {
 		t.Error("No valid signatures found in signers")
@@ -377,3 +394,204 @@ func TestExternalRevocationChecking(t *testing.T) {
 	// This test mainly verifies that the options are properly passed through
 	// and the external checking logic doesn't break the verification process
 }
+
+// newTestSignedDocument returns a document with n signatures in its second
+// revision, named "Signer 1" to "Signer n", that each sign the first
+// revision, and the end of the first revision.
+func newTestSignedDocument(t *testing.T, n int) ([]byte, int) {
+	t.Helper()
+
+	cert, key := newTestCRLIssuer(t, "pdfsign Test Signer")
+	base, prev := appendRevision([]byte("%PDF-1.7\n"), 0, map[int]string{
+		1: "<< /Type /Catalog /Pages 2 0 R /AcroForm << /Fields [] /SigFlags 3 >> >>",
+		2: "<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		3: "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >>",
+	})
+
+	// Every signature signs the first revision.
+	signatures := make(map[int]string)
+	for i := 1; i <= n; i++ {
+		sd, err := pkcs7.NewSignedData(base)
+		if err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+		sd.SetDigestAlgorithm(pkcs7.OIDDigestAlgorithmSHA256)
+		if err := sd.AddSigner(cert, key, pkcs7.SignerInfoConfig{}); err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+		sd.Detach()
+		der, err := sd.Finish()
+		if err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+		signatures[10+i] = fmt.Sprintf("<< /Type /Sig /Filter /Adobe.PPKLite /SubFilter /adbe.pkcs7.detached /Name (Signer %d) /ByteRange [0 %d %d 0] /Contents <%x> >>", i, len(base), len(base), der)
+	}
+	document, _ := appendRevision(base, prev, signatures)
+	return document, len(base)
+}
+
+func TestVerifyWorkers(t *testing.T) {
+	const signatures = 12
+	document, _ := newTestSignedDocument(t, signatures)
+
+	for _, workers := range []int{1, 4, 0} {
+		options := DefaultVerifyOptions()
+		options.Workers = workers
+		response, err := VerifyWithOptions(bytes.NewReader(document), int64(len(document)), options)
+		if err != nil {
+			t.Fatalf("%d workers: %s", workers, err.Error())
+		}
+		if len(response.Signers) != signatures {
+			t.Fatalf("%d workers: expected %d signers, got %d", workers, signatures, len(response.Signers))
+		}
+		// The signatures are reported in the order of their objects.
+		for i, signer := range response.Signers {
+			if want := fmt.Sprintf("Signer %d", i+1); signer.Name != want || !signer.ValidSignature {
+				t.Errorf("%d workers: expected a valid signature of %s, got %s (%t)", workers, want, signer.Name, signer.ValidSignature)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	options := DefaultVerifyOptions()
+	options.Context = ctx
+	if _, err := VerifyWithOptions(bytes.NewReader(document), int64(len(document)), options); err != context.Canceled {
+		t.Errorf("expected the verification to be canceled, got %v", err)
+	}
+}
+
+func TestParallel(t *testing.T) {
+	calls := make([]int, 20)
+	parallel(len(calls), 4, func(i int) {
+		calls[i]++
+	})
+	for i, n := range calls {
+		if n != 1 {
+			t.Errorf("expected a call for %d, got %d", i, n)
+		}
+	}
+
+	defer func() {
+		if r := recover(); r != "failed" {
+			t.Errorf("expected the panic of a call, got %v", r)
+		}
+	}()
+	parallel(len(calls), 4, func(i int) {
+		if i == 7 {
+			panic("failed")
+		}
+	})
+}
+
+func TestVerifyLargeByteRange(t *testing.T) {
+	document, end := newTestSignedDocument(t, 2)
+	tampered := append([]byte(nil), document...)
+	i := bytes.Index(tampered[:end], []byte("612"))
+	tampered[i] = '7'
+
+	testfile, err := os.ReadFile(filepath.Join("..", "testfiles", "testfile30.pdf"))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	verify := func(document []byte) *Response {
+		response, err := VerifyWithOptions(bytes.NewReader(document), int64(len(document)), DefaultVerifyOptions())
+		if err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+		return response
+	}
+
+	for name, document := range map[string][]byte{"signed": document, "tampered": tampered, "testfile30": testfile} {
+		t.Run(name, func(t *testing.T) {
+			inMemory := verify(document)
+
+			// All byte ranges are hashed in chunks.
+			defer func(max int64) { maxInMemoryByteRange = max }(maxInMemoryByteRange)
+			maxInMemoryByteRange = 0
+			chunked := verify(document)
+
+			if len(chunked.Signers) != len(inMemory.Signers) {
+				t.Fatalf("expected %d signers, got %d", len(inMemory.Signers), len(chunked.Signers))
+			}
+			for i, s := range chunked.Signers {
+				want := inMemory.Signers[i]
+				if s.ValidSignature != want.ValidSignature || s.TrustedIssuer != want.TrustedIssuer || s.MessageDigest != want.MessageDigest {
+					t.Errorf("signer %d: expected %t, %t and %s, got %t, %t and %s", i+1, want.ValidSignature, want.TrustedIssuer, want.MessageDigest, s.ValidSignature, s.TrustedIssuer, s.MessageDigest)
+				}
+				if name != "tampered" && !s.ValidSignature {
+					t.Errorf("signer %d: expected a valid signature, got %v", i+1, s.Err())
+				}
+				if name == "tampered" && (!errors.Is(s.Err(), ErrDigestMismatch) || !errors.Is(want.Err(), ErrDigestMismatch)) {
+					t.Errorf("signer %d: expected a digest mismatch, got %v and %v", i+1, want.Err(), s.Err())
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyAdbePKCS7SHA1(t *testing.T) {
+	cert, key := newTestCRLIssuer(t, "pdfsign Test Signer")
+	base, prev := appendRevision([]byte("%PDF-1.7\n"), 0, map[int]string{
+		1: "<< /Type /Catalog /Pages 2 0 R /AcroForm << /Fields [] /SigFlags 3 >> >>",
+		2: "<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		3: "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >>",
+	})
+	// sign returns a document with an adbe.pkcs7.sha1 signature that
+	// encapsulates content.
+	sign := func(content []byte) []byte {
+		sd, err := pkcs7.NewSignedData(content)
+		if err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+		sd.SetDigestAlgorithm(pkcs7.OIDDigestAlgorithmSHA256)
+		if err := sd.AddSigner(cert, key, pkcs7.SignerInfoConfig{}); err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+		der, err := sd.Finish()
+		if err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+		document, _ := appendRevision(base, prev, map[int]string{
+			11: fmt.Sprintf("<< /Type /Sig /Filter /Adobe.PPKLite /SubFilter /adbe.pkcs7.sha1 /ByteRange [0 %d %d 0] /Contents <%x> >>", len(base), len(base), der),
+		})
+		return document
+	}
+	verifySHA1 := func(document []byte, policy SHA1Policy) Signer {
+		options := DefaultVerifyOptions()
+		options.SHA1Policy = policy
+		response, err := VerifyWithOptions(bytes.NewReader(document), int64(len(document)), options)
+		if err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+		if len(response.Signers) != 1 {
+			t.Fatalf("expected a signer, got %d", len(response.Signers))
+		}
+		return response.Signers[0]
+	}
+
+	digest := sha1.Sum(base)
+	document := sign(digest[:])
+	signer := verifySHA1(document, SHA1ByDate)
+	if !signer.ValidSignature || signer.DigestAlgorithm != "SHA-1" || signer.MessageDigest != hex.EncodeToString(digest[:]) {
+		t.Fatalf("expected a valid SHA-1 signature of %x, got %t %s %s", digest, signer.ValidSignature, signer.DigestAlgorithm, signer.MessageDigest)
+	}
+	if len(signer.WeakAlgorithms) != 1 {
+		t.Errorf("expected SHA-1 to be weak by date, got %q", signer.WeakAlgorithms)
+	}
+
+	if signer := verifySHA1(document, SHA1Accept); len(signer.WeakAlgorithms) != 0 || len(signer.PolicyErrors) != 0 {
+		t.Errorf("expected SHA-1 to be accepted, got %q and %q", signer.WeakAlgorithms, signer.PolicyErrors)
+	}
+	if signer := verifySHA1(document, SHA1Reject); len(signer.PolicyErrors) != 1 || !errors.Is(signer.Err(), ErrPolicy) {
+		t.Errorf("expected SHA-1 to be rejected, got %q", signer.PolicyErrors)
+	}
+
+	// The encapsulated digest of other content does not match the byte
+	// range.
+	other := sha1.Sum([]byte("other content"))
+	if signer := verifySHA1(sign(other[:]), SHA1Accept); signer.ValidSignature || !errors.Is(signer.Err(), ErrDigestMismatch) {
+		t.Errorf("expected a digest mismatch, got %v", signer.Err())
+	}
+}
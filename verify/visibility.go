@@ -0,0 +1,123 @@
+package verify
+
+import (
+	"fmt"
+
+	"github.com/digitorus/pdf"
+)
+
+// Annotation flags of ISO 32000-1, 12.5.3, that hide a widget.
+const (
+	annotationHidden = 1 << 1
+	annotationNoView = 1 << 5
+)
+
+// minWidgetSize is the width and height in points, 1/72 inch, below which a
+// widget is too small to be seen.
+const minWidgetSize = 1
+
+// signatureVisibility returns why the widgets of the signature field with the
+// signature dictionary v cannot be seen: flags that hide them, a rectangle
+// without area or off the page, or no page at all. It reports whether none
+// of the widgets is visible. pages are the objects of the pages of rdr.
+func signatureVisibility(v pdf.Value, rdr *pdf.Reader, pages map[uint32]pageObject) (hidden bool, warnings []string) {
+	field := signatureField(rdr.Trailer().Key("Root").Key("AcroForm").Key("Fields"), v, 0)
+	if field.IsNull() {
+		return true, []string{"the signature has no signature field"}
+	}
+
+	widgets := signatureWidgets(field)
+	if len(widgets) == 0 {
+		return true, []string{fmt.Sprintf("signature field %q has no widget", fieldName(field))}
+	}
+
+	hidden = true
+	for _, widget := range widgets {
+		name := fieldName(widget)
+		reasons := widgetVisibility(widget, rdr, pages)
+		for _, reason := range reasons {
+			warnings = append(warnings, fmt.Sprintf("widget of signature field %q %s", name, reason))
+		}
+		if len(reasons) == 0 {
+			hidden = false
+		}
+	}
+	return hidden, warnings
+}
+
+// signatureWidgets returns the widgets of the signature field, the field
+// itself when it is merged with its widget, or its kids.
+func signatureWidgets(field pdf.Value) []pdf.Value {
+	if field.Key("Subtype").Name() == "Widget" {
+		return []pdf.Value{field}
+	}
+	var widgets []pdf.Value
+	kids := field.Key("Kids")
+	for i := 0; i < kids.Len(); i++ {
+		if kid := kids.Index(i); kid.Key("Subtype").Name() == "Widget" {
+			widgets = append(widgets, kid)
+		}
+	}
+	return widgets
+}
+
+// widgetVisibility returns why the widget cannot be seen, none if it can.
+func widgetVisibility(widget pdf.Value, rdr *pdf.Reader, pages map[uint32]pageObject) []string {
+	var reasons []string
+	flags := widget.Key("F").Int64()
+	if flags&annotationHidden != 0 {
+		reasons = append(reasons, "is hidden by the Hidden annotation flag")
+	}
+	if flags&annotationNoView != 0 {
+		reasons = append(reasons, "is hidden by the NoView annotation flag")
+	}
+
+	rect, ok := normalizedRect(widget.Key("Rect"))
+	if !ok {
+		return append(reasons, "has no valid rectangle")
+	}
+	visibleArea := rect[2]-rect[0] >= minWidgetSize && rect[3]-rect[1] >= minWidgetSize
+	if !visibleArea {
+		reasons = append(reasons, fmt.Sprintf("has no visible area, its rectangle is %gx%g points", rect[2]-rect[0], rect[3]-rect[1]))
+	}
+
+	ptr := widget.GetPtr()
+	object, ok := pages[ptr.GetID()]
+	if !ok || object.kind != "annotation" {
+		return append(reasons, "is not on any page")
+	}
+	page := rdr.Page(object.page).V
+	box, ok := normalizedRect(inheritedPageKey(page, "CropBox"))
+	if !ok {
+		box, ok = normalizedRect(inheritedPageKey(page, "MediaBox"))
+	}
+	if ok && visibleArea && (rect[2] <= box[0] || rect[0] >= box[2] || rect[3] <= box[1] || rect[1] >= box[3]) {
+		reasons = append(reasons, fmt.Sprintf("is outside of page %d", object.page))
+	}
+	return reasons
+}
+
+// normalizedRect returns the rectangle array v with the lower left corner
+// first, and false if v is not a rectangle.
+func normalizedRect(v pdf.Value) ([4]float64, bool) {
+	var rect [4]float64
+	if v.Kind() != pdf.Array || v.Len() != 4 {
+		return rect, false
+	}
+	for i := range rect {
+		rect[i] = v.Index(i).Float64()
+	}
+	return [4]float64{min(rect[0], rect[2]), min(rect[1], rect[3]), max(rect[0], rect[2]), max(rect[1], rect[3])}, true
+}
+
+// inheritedPageKey returns the entry key of the page, or of the closest
+// node of the page tree above it that has one, see ISO 32000-1, 7.7.3.4.
+func inheritedPageKey(page pdf.Value, key string) pdf.Value {
+	for i := 0; i < 32 && !page.IsNull(); i++ {
+		if v := page.Key(key); !v.IsNull() {
+			return v
+		}
+		page = page.Key("Parent")
+	}
+	return pdf.Value{}
+}
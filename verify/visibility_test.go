@@ -0,0 +1,95 @@
+package verify
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/digitorus/pdf"
+)
+
+func TestSignatureVisibility(t *testing.T) {
+	tests := []struct {
+		name         string
+		field        string
+		annots       string
+		kid          string
+		wantHidden   bool
+		wantWarnings []string
+	}{
+		{
+			name:   "visible",
+			field:  "<< /FT /Sig /T (Signature1) /V 10 0 R /Subtype /Widget /Rect [72 72 272 122] /F 4 >>",
+			annots: "[5 0 R]",
+		},
+		{
+			name:         "hidden flag",
+			field:        "<< /FT /Sig /T (Signature1) /V 10 0 R /Subtype /Widget /Rect [72 72 272 122] /F 6 >>",
+			annots:       "[5 0 R]",
+			wantHidden:   true,
+			wantWarnings: []string{`widget of signature field "Signature1" is hidden by the Hidden annotation flag`},
+		},
+		{
+			name:         "NoView flag",
+			field:        "<< /FT /Sig /T (Signature1) /V 10 0 R /Subtype /Widget /Rect [72 72 272 122] /F 32 >>",
+			annots:       "[5 0 R]",
+			wantHidden:   true,
+			wantWarnings: []string{`widget of signature field "Signature1" is hidden by the NoView annotation flag`},
+		},
+		{
+			name:         "zero size",
+			field:        "<< /FT /Sig /T (Signature1) /V 10 0 R /Subtype /Widget /Rect [0 0 0 0] >>",
+			annots:       "[5 0 R]",
+			wantHidden:   true,
+			wantWarnings: []string{`widget of signature field "Signature1" has no visible area, its rectangle is 0x0 points`},
+		},
+		{
+			name:         "off the page",
+			field:        "<< /FT /Sig /T (Signature1) /V 10 0 R /Subtype /Widget /Rect [700 72 900 122] >>",
+			annots:       "[5 0 R]",
+			wantHidden:   true,
+			wantWarnings: []string{`widget of signature field "Signature1" is outside of page 1`},
+		},
+		{
+			name:         "on no page",
+			field:        "<< /FT /Sig /T (Signature1) /V 10 0 R /Subtype /Widget /Rect [72 72 272 122] >>",
+			annots:       "[]",
+			wantHidden:   true,
+			wantWarnings: []string{`widget of signature field "Signature1" is not on any page`},
+		},
+		{
+			// The signature is visible by one of its widgets
+			name:         "kids",
+			field:        "<< /FT /Sig /T (Signature1) /V 10 0 R /Kids [6 0 R 7 0 R] >>",
+			kid:          "<< /Parent 5 0 R /Subtype /Widget /Rect [72 72 272 122] >>",
+			annots:       "[6 0 R 7 0 R]",
+			wantWarnings: []string{`widget of signature field "Signature1" has no visible area, its rectangle is 200x0 points`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects := map[int]string{
+				1:  "<< /Type /Catalog /Pages 2 0 R /AcroForm << /Fields [5 0 R] /SigFlags 3 >> >>",
+				2:  "<< /Type /Pages /Kids [3 0 R] /Count 1 /MediaBox [0 0 612 792] >>",
+				3:  "<< /Type /Page /Parent 2 0 R /Annots " + tt.annots + " >>",
+				5:  tt.field,
+				10: "<< /Type /Sig /Filter /Adobe.PPKLite /SubFilter /ETSI.CAdES.detached >>",
+			}
+			if tt.kid != "" {
+				objects[6] = tt.kid
+				objects[7] = "<< /Parent 5 0 R /Subtype /Widget /Rect [72 72 272 72] >>"
+			}
+			document, _ := appendRevision([]byte("%PDF-1.7\n"), 0, objects)
+			rdr, err := pdf.NewReader(bytes.NewReader(document), int64(len(document)))
+			if err != nil {
+				t.Fatalf("%s", err.Error())
+			}
+			ptr := rdr.Xref()[10].Ptr()
+			hidden, warnings := signatureVisibility(rdr.Resolve(ptr, ptr), rdr, pageObjects(rdr))
+			if hidden != tt.wantHidden || !reflect.DeepEqual(warnings, tt.wantWarnings) {
+				t.Errorf("expected hidden %t with %q, got %t with %q", tt.wantHidden, tt.wantWarnings, hidden, warnings)
+			}
+		})
+	}
+}
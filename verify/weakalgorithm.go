@@ -0,0 +1,196 @@
+package verify
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/digitorus/pkcs7"
+)
+
+var oidDigestMD5 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 5}
+
+// AlgorithmPolicy declares digest algorithms, RSA key sizes and elliptic
+// curves weak. Each is acceptable for signatures verified at a time before
+// the date it maps to, and never when the date is zero.
+type AlgorithmPolicy struct {
+	Digests     map[crypto.Hash]time.Time // Weak digest algorithms of signatures and certificates
+	RSAKeySizes map[int]time.Time         // RSA keys with fewer bits than the size are weak
+	Curves      map[string]time.Time      // Weak elliptic curves, by name such as "P-224"
+}
+
+// SHA1Policy decides when SHA-1 is acceptable, regardless of the date of the
+// AlgorithmPolicy for it.
+type SHA1Policy string
+
+const (
+	// SHA1ByDate accepts SHA-1 as long as the AlgorithmPolicy does.
+	SHA1ByDate SHA1Policy = ""
+
+	// SHA1Accept never reports SHA-1 as weak.
+	SHA1Accept SHA1Policy = "accept"
+
+	// SHA1Reject reports SHA-1 as weak at any time and makes the
+	// signatures that use it policy errors, even without
+	// RejectWeakAlgorithms.
+	SHA1Reject SHA1Policy = "reject"
+)
+
+// DefaultAlgorithmPolicy returns the default algorithm policy: MD5 and P-224
+// are never acceptable, SHA-1 before 2016 and RSA keys with less than 2048
+// bits before 2014.
+func DefaultAlgorithmPolicy() *AlgorithmPolicy {
+	return &AlgorithmPolicy{
+		Digests: map[crypto.Hash]time.Time{
+			crypto.MD5:  {},
+			crypto.SHA1: time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		RSAKeySizes: map[int]time.Time{
+			2048: time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		Curves: map[string]time.Time{
+			"P-224": {},
+		},
+	}
+}
+
+// digestAlgorithm returns the digest algorithm of the OID, including MD5,
+// which is only recognized to report it.
+func digestAlgorithm(oid asn1.ObjectIdentifier) crypto.Hash {
+	if oid.Equal(oidDigestMD5) {
+		return crypto.MD5
+	}
+	hash, _ := hashForOID(oid)
+	return hash
+}
+
+// setDigestAlgorithm records the digest algorithm of the signature, of the
+// signer of p7 if hash is zero.
+func (s *Signer) setDigestAlgorithm(p7 *pkcs7.PKCS7, hash crypto.Hash) {
+	if hash == 0 && p7 != nil && len(p7.Signers) > 0 {
+		hash = digestAlgorithm(p7.Signers[0].DigestAlgorithm.Algorithm)
+	}
+	if hash != 0 {
+		s.digestAlgorithm = hash
+		s.DigestAlgorithm = hash.String()
+	}
+}
+
+// certificateDigests maps the signature algorithms of certificates to their
+// digest algorithm.
+var certificateDigests = map[x509.SignatureAlgorithm]crypto.Hash{
+	x509.MD5WithRSA:    crypto.MD5,
+	x509.SHA1WithRSA:   crypto.SHA1,
+	x509.DSAWithSHA1:   crypto.SHA1,
+	x509.ECDSAWithSHA1: crypto.SHA1,
+}
+
+// weakAt reports whether an algorithm that is acceptable until the time
+// until is weak at time t.
+func weakAt(until time.Time, t time.Time) bool {
+	return until.IsZero() || !t.Before(until)
+}
+
+// checkAlgorithms records the weak algorithms of each signature at its
+// verification time: the digest algorithm of the signature and the
+// signature algorithms and keys of its certificates. The signatures of
+// self-signed roots are not checked, as their trust does not depend on them.
+// With RejectWeakAlgorithms they are policy errors as well.
+func checkAlgorithms(signers []Signer, options *VerifyOptions) {
+	policy := options.algorithmPolicy()
+
+	for i := range signers {
+		s := &signers[i]
+		at := options.validationTime()
+		if s.VerificationTime != nil {
+			at = *s.VerificationTime
+		}
+
+		if until, ok := policy.Digests[s.digestAlgorithm]; ok && weakAt(until, at) {
+			s.WeakAlgorithms = append(s.WeakAlgorithms, fmt.Sprintf("the signature uses the weak digest algorithm %s", s.digestAlgorithm))
+		}
+		for _, c := range s.Certificates {
+			if c.Certificate == nil {
+				continue
+			}
+			s.WeakAlgorithms = append(s.WeakAlgorithms, weakCertificateAlgorithms(c.Certificate, policy, at)...)
+		}
+
+		if options.RejectWeakAlgorithms {
+			s.PolicyErrors = append(s.PolicyErrors, s.WeakAlgorithms...)
+		} else if options.SHA1Policy == SHA1Reject && usesSHA1(s) {
+			s.PolicyErrors = append(s.PolicyErrors, "the policy does not accept SHA-1")
+		}
+	}
+}
+
+// algorithmPolicy returns the AlgorithmPolicy of the options,
+// DefaultAlgorithmPolicy() if none is set, with SHA-1 acceptable as the
+// SHA1Policy decides.
+func (options *VerifyOptions) algorithmPolicy() *AlgorithmPolicy {
+	policy := options.AlgorithmPolicy
+	if policy == nil {
+		policy = DefaultAlgorithmPolicy()
+	}
+	if options.SHA1Policy != SHA1Accept && options.SHA1Policy != SHA1Reject {
+		return policy
+	}
+
+	adjusted := *policy
+	adjusted.Digests = maps.Clone(policy.Digests)
+	if adjusted.Digests == nil {
+		adjusted.Digests = make(map[crypto.Hash]time.Time)
+	}
+	if options.SHA1Policy == SHA1Accept {
+		delete(adjusted.Digests, crypto.SHA1)
+	} else {
+		adjusted.Digests[crypto.SHA1] = time.Time{}
+	}
+	return &adjusted
+}
+
+// usesSHA1 reports whether the signature digests with SHA-1, or one of its
+// certificates but self-signed roots is signed with it.
+func usesSHA1(s *Signer) bool {
+	if s.digestAlgorithm == crypto.SHA1 {
+		return true
+	}
+	for _, c := range s.Certificates {
+		if c.Certificate != nil && certificateDigests[c.Certificate.SignatureAlgorithm] == crypto.SHA1 && !bytes.Equal(c.Certificate.RawIssuer, c.Certificate.RawSubject) {
+			return true
+		}
+	}
+	return false
+}
+
+// weakCertificateAlgorithms returns the weak algorithms of cert at time at.
+func weakCertificateAlgorithms(cert *x509.Certificate, policy *AlgorithmPolicy, at time.Time) []string {
+	var weak []string
+	if hash, ok := certificateDigests[cert.SignatureAlgorithm]; ok && !bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+		if until, ok := policy.Digests[hash]; ok && weakAt(until, at) {
+			weak = append(weak, fmt.Sprintf("the certificate %s is signed with the weak algorithm %s", cert.Subject, cert.SignatureAlgorithm))
+		}
+	}
+
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		for size, until := range policy.RSAKeySizes {
+			if key.N.BitLen() < size && weakAt(until, at) {
+				weak = append(weak, fmt.Sprintf("the certificate %s has a weak RSA key of %d bits", cert.Subject, key.N.BitLen()))
+				break
+			}
+		}
+	case *ecdsa.PublicKey:
+		name := key.Curve.Params().Name
+		if until, ok := policy.Curves[name]; ok && weakAt(until, at) {
+			weak = append(weak, fmt.Sprintf("the certificate %s uses the weak curve %s", cert.Subject, name))
+		}
+	}
+	return weak
+}
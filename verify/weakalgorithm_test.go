@@ -0,0 +1,129 @@
+package verify
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCheckAlgorithms(t *testing.T) {
+	before := time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)
+	after := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	rsaKey := func(bits int) *rsa.PublicKey {
+		return &rsa.PublicKey{N: new(big.Int).Lsh(big.NewInt(1), uint(bits-1)), E: 65537}
+	}
+	certificate := func(name string, algorithm x509.SignatureAlgorithm, key crypto.PublicKey) Certificate {
+		return Certificate{Certificate: &x509.Certificate{
+			Subject:            pkix.Name{CommonName: name},
+			RawSubject:         []byte(name),
+			RawIssuer:          []byte("CA"),
+			SignatureAlgorithm: algorithm,
+			PublicKey:          key,
+		}}
+	}
+	root := certificate("CA", x509.SHA1WithRSA, rsaKey(4096))
+
+	tests := []struct {
+		name   string
+		signer Signer
+		reject bool
+		want   []string
+	}{
+		{
+			name: "strong",
+			signer: Signer{
+				digestAlgorithm:  crypto.SHA256,
+				VerificationTime: &after,
+				Certificates:     []Certificate{certificate("Signer", x509.SHA256WithRSA, rsaKey(2048)), root},
+			},
+		},
+		{
+			// A self-signed root may be signed with SHA-1.
+			name: "SHA-1 before 2016",
+			signer: Signer{
+				digestAlgorithm:  crypto.SHA1,
+				VerificationTime: &before,
+				Certificates:     []Certificate{certificate("Signer", x509.SHA1WithRSA, rsaKey(2048)), root},
+			},
+		},
+		{
+			name: "SHA-1 after 2016",
+			signer: Signer{
+				digestAlgorithm:  crypto.SHA1,
+				VerificationTime: &after,
+				Certificates:     []Certificate{certificate("Signer", x509.SHA1WithRSA, rsaKey(2048)), root},
+			},
+			want: []string{
+				"the signature uses the weak digest algorithm SHA-1",
+				"the certificate CN=Signer is signed with the weak algorithm SHA1-RSA",
+			},
+		},
+		{
+			name: "MD5",
+			signer: Signer{
+				digestAlgorithm:  crypto.MD5,
+				VerificationTime: &before,
+				Certificates:     []Certificate{certificate("Signer", x509.MD5WithRSA, rsaKey(2048))},
+			},
+			want: []string{
+				"the signature uses the weak digest algorithm MD5",
+				"the certificate CN=Signer is signed with the weak algorithm MD5-RSA",
+			},
+		},
+		{
+			name: "small RSA key",
+			signer: Signer{
+				digestAlgorithm:  crypto.SHA256,
+				VerificationTime: &after,
+				Certificates:     []Certificate{certificate("Signer", x509.SHA256WithRSA, rsaKey(1024))},
+			},
+			reject: true,
+			want:   []string{"the certificate CN=Signer has a weak RSA key of 1024 bits"},
+		},
+		{
+			name: "weak curve",
+			signer: Signer{
+				digestAlgorithm:  crypto.SHA256,
+				VerificationTime: &before,
+				Certificates:     []Certificate{certificate("Signer", x509.ECDSAWithSHA256, &ecdsa.PublicKey{Curve: elliptic.P224()})},
+			},
+			reject: true,
+			want:   []string{"the certificate CN=Signer uses the weak curve P-224"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultVerifyOptions()
+			options.RejectWeakAlgorithms = tt.reject
+			signers := []Signer{tt.signer}
+			checkAlgorithms(signers, options)
+			if !reflect.DeepEqual(signers[0].WeakAlgorithms, tt.want) {
+				t.Errorf("expected weak algorithms %q, got %q", tt.want, signers[0].WeakAlgorithms)
+			}
+			if tt.reject && !reflect.DeepEqual(signers[0].PolicyErrors, tt.want) {
+				t.Errorf("expected policy errors %q, got %q", tt.want, signers[0].PolicyErrors)
+			}
+			if !tt.reject && signers[0].PolicyErrors != nil {
+				t.Errorf("expected weak algorithms only to be reported, got policy errors %q", signers[0].PolicyErrors)
+			}
+		})
+	}
+
+	// Dates of the policy are configurable.
+	options := DefaultVerifyOptions()
+	options.AlgorithmPolicy = &AlgorithmPolicy{Digests: map[crypto.Hash]time.Time{crypto.SHA1: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}}
+	signers := []Signer{{digestAlgorithm: crypto.SHA1, VerificationTime: &after}}
+	checkAlgorithms(signers, options)
+	if signers[0].WeakAlgorithms != nil {
+		t.Errorf("expected SHA-1 to be acceptable before 2021, got %q", signers[0].WeakAlgorithms)
+	}
+}
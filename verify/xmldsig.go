@@ -0,0 +1,548 @@
+package verify
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Namespaces and algorithms of XML signatures, see XML Signature Syntax and
+// Processing Version 1.1, Canonical XML 1.0 and 1.1, Exclusive XML
+// Canonicalization and RFC 6931.
+const (
+	xmldsigNamespace = "http://www.w3.org/2000/09/xmldsig#"
+	xmlNamespace     = "http://www.w3.org/XML/1998/namespace"
+
+	algorithmEnveloped = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	algorithmC14N      = "http://www.w3.org/TR/2001/REC-xml-c14n-20010315"
+	algorithmC14N11    = "http://www.w3.org/2006/12/xml-c14n11"
+	algorithmExcC14N   = "http://www.w3.org/2001/10/xml-exc-c14n#"
+)
+
+// xmlDigestMethods are the digest algorithms of the references.
+var xmlDigestMethods = map[string]crypto.Hash{
+	"http://www.w3.org/2001/04/xmlenc#sha256":       crypto.SHA256,
+	"http://www.w3.org/2001/04/xmldsig-more#sha384": crypto.SHA384,
+	"http://www.w3.org/2001/04/xmlenc#sha512":       crypto.SHA512,
+}
+
+// xmlSignatureMethod is a signature algorithm of the SignedInfo.
+type xmlSignatureMethod struct {
+	hash  crypto.Hash
+	pss   bool
+	ecdsa bool
+}
+
+// xmlSignatureMethods are the signature algorithms of the SignedInfo, SHA-1
+// is not supported.
+var xmlSignatureMethods = map[string]xmlSignatureMethod{
+	"http://www.w3.org/2001/04/xmldsig-more#rsa-sha256":      {hash: crypto.SHA256},
+	"http://www.w3.org/2001/04/xmldsig-more#rsa-sha384":      {hash: crypto.SHA384},
+	"http://www.w3.org/2001/04/xmldsig-more#rsa-sha512":      {hash: crypto.SHA512},
+	"http://www.w3.org/2007/05/xmldsig-more#sha256-rsa-MGF1": {hash: crypto.SHA256, pss: true},
+	"http://www.w3.org/2007/05/xmldsig-more#sha384-rsa-MGF1": {hash: crypto.SHA384, pss: true},
+	"http://www.w3.org/2007/05/xmldsig-more#sha512-rsa-MGF1": {hash: crypto.SHA512, pss: true},
+	"http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha256":    {hash: crypto.SHA256, ecdsa: true},
+	"http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha384":    {hash: crypto.SHA384, ecdsa: true},
+	"http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha512":    {hash: crypto.SHA512, ecdsa: true},
+}
+
+// Kinds of the nodes of an XML document.
+const (
+	xmlDocument = iota
+	xmlElement
+	xmlText
+	xmlComment
+	xmlProcInst
+)
+
+// xmlNode is a node of an XML document. The names of elements and
+// attributes have their prefix in Space, the namespaces in scope of an
+// element are in ns by prefix, the default namespace by "".
+type xmlNode struct {
+	kind     int
+	parent   *xmlNode
+	name     xml.Name
+	attrs    []xml.Attr
+	ns       map[string]string
+	children []*xmlNode
+	text     string // Text and comments, or the instruction of a processing instruction
+}
+
+// parseXMLDocument parses data into the tree of its nodes. Whitespace
+// outside the document element, the XML declaration and the document type
+// declaration are left out.
+func parseXMLDocument(data []byte) (*xmlNode, error) {
+	doc := &xmlNode{kind: xmlDocument, ns: map[string]string{}}
+	current := doc
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			if current == doc && doc.element() != nil {
+				return nil, errors.New("more than one document element")
+			}
+			// The namespaces are shared with the parent unless the element
+			// declares others.
+			n := &xmlNode{kind: xmlElement, parent: current, name: token.Name, ns: current.ns}
+			declared := false
+			for _, a := range token.Attr {
+				switch {
+				case a.Name.Space == "" && a.Name.Local == "xmlns", a.Name.Space == "xmlns" && a.Name.Local != "xml":
+					prefix := a.Name.Local
+					if a.Name.Space == "" {
+						prefix = ""
+					}
+					if n.ns[prefix] != a.Value {
+						if !declared {
+							n.ns, declared = maps.Clone(current.ns), true
+						}
+						n.ns[prefix] = a.Value
+					}
+				case a.Name.Space != "xmlns":
+					n.attrs = append(n.attrs, a)
+				}
+			}
+			current.children = append(current.children, n)
+			current = n
+		case xml.EndElement:
+			if current.kind != xmlElement || current.name != token.Name {
+				return nil, fmt.Errorf("unexpected end element %s", qualifiedName(token.Name))
+			}
+			current = current.parent
+		case xml.CharData:
+			if current != doc {
+				current.children = append(current.children, &xmlNode{kind: xmlText, parent: current, text: string(token)})
+			}
+		case xml.Comment:
+			current.children = append(current.children, &xmlNode{kind: xmlComment, parent: current, text: string(token)})
+		case xml.ProcInst:
+			if token.Target != "xml" {
+				current.children = append(current.children, &xmlNode{kind: xmlProcInst, parent: current, name: xml.Name{Local: token.Target}, text: string(token.Inst)})
+			}
+		}
+	}
+	if current != doc || doc.element() == nil {
+		return nil, errors.New("unexpected end of the document")
+	}
+	return doc, nil
+}
+
+// element returns the document element of a document.
+func (n *xmlNode) element() *xmlNode {
+	for _, c := range n.children {
+		if c.kind == xmlElement {
+			return c
+		}
+	}
+	return nil
+}
+
+// is reports whether the node is the element local of the namespace space.
+func (n *xmlNode) is(space, local string) bool {
+	return n.kind == xmlElement && n.name.Local == local && n.ns[n.name.Space] == space
+}
+
+// child returns the first child element local of the namespace space.
+func (n *xmlNode) child(space, local string) *xmlNode {
+	for _, c := range n.children {
+		if c.is(space, local) {
+			return c
+		}
+	}
+	return nil
+}
+
+// attr returns the value of the attribute local without prefix.
+func (n *xmlNode) attr(local string) (string, bool) {
+	for _, a := range n.attrs {
+		if a.Name.Space == "" && a.Name.Local == local {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// content returns the text of the element, without whitespace.
+func (n *xmlNode) content() string {
+	var b strings.Builder
+	for _, c := range n.children {
+		switch c.kind {
+		case xmlText:
+			b.WriteString(c.text)
+		case xmlElement:
+			b.WriteString(c.content())
+		}
+	}
+	return strings.Join(strings.Fields(b.String()), "")
+}
+
+// byID returns the element with the Id, ID or id attribute id.
+func (n *xmlNode) byID(id string) *xmlNode {
+	for _, c := range n.children {
+		if c.kind != xmlElement {
+			continue
+		}
+		for _, name := range []string{"Id", "ID", "id"} {
+			if v, ok := c.attr(name); ok && v == id {
+				return c
+			}
+		}
+		if found := c.byID(id); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// qualifiedName returns the name with its prefix.
+func qualifiedName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+// xmlCanonicalizer writes the canonical form of a node, without the
+// excluded element.
+type xmlCanonicalizer struct {
+	exclusive bool
+	version11 bool
+	comments  bool
+	prefixes  []string // InclusiveNamespaces PrefixList of exclusive canonicalization, "" for #default
+	excluded  *xmlNode
+}
+
+// setMethod sets the canonicalization algorithm of the method element, false
+// if it is not a canonicalization algorithm.
+func (c *xmlCanonicalizer) setMethod(algorithm string, method *xmlNode) bool {
+	switch algorithm {
+	case algorithmC14N, algorithmC14N + "#WithComments", algorithmC14N11, algorithmC14N11 + "#WithComments":
+		c.exclusive = false
+	case algorithmExcC14N, algorithmExcC14N + "WithComments":
+		c.exclusive = true
+	default:
+		return false
+	}
+	c.version11 = strings.HasPrefix(algorithm, algorithmC14N11)
+	c.comments = strings.HasSuffix(algorithm, "WithComments")
+
+	c.prefixes = nil
+	if inclusive := method.child(algorithmExcC14N, "InclusiveNamespaces"); c.exclusive && inclusive != nil {
+		list, _ := inclusive.attr("PrefixList")
+		for _, prefix := range strings.Fields(list) {
+			if prefix == "#default" {
+				prefix = ""
+			}
+			c.prefixes = append(c.prefixes, prefix)
+		}
+	}
+	return true
+}
+
+// canonicalize returns the canonical form of the document or element n.
+func (c *xmlCanonicalizer) canonicalize(n *xmlNode) []byte {
+	var b bytes.Buffer
+	if n.kind != xmlDocument {
+		c.element(&b, n, map[string]string{}, true)
+		return b.Bytes()
+	}
+
+	// Comments and processing instructions outside the document element are
+	// separated from it by a line break.
+	afterElement := false
+	for _, child := range n.children {
+		switch {
+		case child.kind == xmlElement:
+			c.element(&b, child, map[string]string{}, true)
+			afterElement = true
+		case child.kind == xmlComment && !c.comments:
+		default:
+			if afterElement {
+				b.WriteByte('\n')
+			}
+			c.node(&b, child)
+			if !afterElement {
+				b.WriteByte('\n')
+			}
+		}
+	}
+	return b.Bytes()
+}
+
+var (
+	xmlTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+	xmlAttrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", "\"", "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+)
+
+// node writes a child node of an element.
+func (c *xmlCanonicalizer) node(b *bytes.Buffer, n *xmlNode) {
+	switch n.kind {
+	case xmlText:
+		b.WriteString(xmlTextEscaper.Replace(n.text))
+	case xmlComment:
+		if c.comments {
+			b.WriteString("<!--" + n.text + "-->")
+		}
+	case xmlProcInst:
+		b.WriteString("<?" + n.name.Local)
+		if n.text != "" {
+			b.WriteString(" " + n.text)
+		}
+		b.WriteString("?>")
+	}
+}
+
+// element writes the element n, rendered are the namespaces declared by the
+// elements written around it.
+func (c *xmlCanonicalizer) element(b *bytes.Buffer, n *xmlNode, rendered map[string]string, apex bool) {
+	if n == c.excluded {
+		return
+	}
+
+	// Inclusive canonicalization declares the namespaces in scope,
+	// exclusive canonicalization those that the element and its attributes
+	// use and those of the InclusiveNamespaces PrefixList.
+	var prefixes []string
+	if c.exclusive {
+		prefixes = append([]string{n.name.Space}, c.prefixes...)
+		for _, a := range n.attrs {
+			if a.Name.Space != "" && a.Name.Space != "xml" {
+				prefixes = append(prefixes, a.Name.Space)
+			}
+		}
+	} else {
+		prefixes = slices.Collect(maps.Keys(n.ns))
+	}
+	slices.Sort(prefixes)
+	prefixes = slices.Compact(prefixes)
+
+	b.WriteString("<" + qualifiedName(n.name))
+	cloned := false
+	for _, prefix := range prefixes {
+		if n.ns[prefix] == rendered[prefix] {
+			continue
+		}
+		if !cloned {
+			rendered, cloned = maps.Clone(rendered), true
+		}
+		rendered[prefix] = n.ns[prefix]
+		if prefix == "" {
+			b.WriteString(` xmlns="`)
+		} else {
+			b.WriteString(" xmlns:" + prefix + `="`)
+		}
+		b.WriteString(xmlAttrEscaper.Replace(n.ns[prefix]) + `"`)
+	}
+
+	// The element of a subset of the document inherits the attributes in the
+	// xml namespace of its ancestors, those that Canonical XML 1.1 fixes up
+	// excepted.
+	attrs := slices.Clone(n.attrs)
+	if apex && !c.exclusive {
+		for p := n.parent; p != nil && p.kind == xmlElement; p = p.parent {
+			for _, a := range p.attrs {
+				inherited := a.Name.Space == "xml" && !(c.version11 && (a.Name.Local == "id" || a.Name.Local == "base"))
+				if inherited && !slices.ContainsFunc(attrs, func(o xml.Attr) bool { return o.Name == a.Name }) {
+					attrs = append(attrs, a)
+				}
+			}
+		}
+	}
+	namespace := func(a xml.Attr) string {
+		switch a.Name.Space {
+		case "":
+			return ""
+		case "xml":
+			return xmlNamespace
+		}
+		return n.ns[a.Name.Space]
+	}
+	slices.SortFunc(attrs, func(x, y xml.Attr) int {
+		if order := strings.Compare(namespace(x), namespace(y)); order != 0 {
+			return order
+		}
+		return strings.Compare(x.Name.Local, y.Name.Local)
+	})
+	for _, a := range attrs {
+		b.WriteString(" " + qualifiedName(a.Name) + `="` + xmlAttrEscaper.Replace(a.Value) + `"`)
+	}
+	b.WriteString(">")
+
+	for _, child := range n.children {
+		if child.kind == xmlElement {
+			c.element(b, child, rendered, false)
+		} else {
+			c.node(b, child)
+		}
+	}
+	b.WriteString("</" + qualifiedName(n.name) + ">")
+}
+
+// verifyXMLSignature verifies the enveloped XML signature of the document
+// data, whose references must include the whole document, with the public
+// key of one of signers.
+func verifyXMLSignature(data []byte, signers []*x509.Certificate) error {
+	doc, err := parseXMLDocument(data)
+	if err != nil {
+		return fmt.Errorf("invalid XML: %w", err)
+	}
+	signature := doc.element().child(xmldsigNamespace, "Signature")
+	if signature == nil {
+		return errors.New("the document is not signed")
+	}
+	signedInfo := signature.child(xmldsigNamespace, "SignedInfo")
+	if signedInfo == nil {
+		return errors.New("the signature has no SignedInfo")
+	}
+
+	whole := false
+	for _, reference := range signedInfo.children {
+		if !reference.is(xmldsigNamespace, "Reference") {
+			continue
+		}
+		if err := checkXMLReference(doc, signature, reference); err != nil {
+			return err
+		}
+		uri, _ := reference.attr("URI")
+		whole = whole || uri == ""
+	}
+	if !whole {
+		return errors.New("the signature does not cover the whole document")
+	}
+
+	var c xmlCanonicalizer
+	method := signedInfo.child(xmldsigNamespace, "CanonicalizationMethod")
+	if method == nil {
+		return errors.New("the signature has no canonicalization method")
+	}
+	if algorithm, _ := method.attr("Algorithm"); !c.setMethod(algorithm, method) {
+		return fmt.Errorf("unsupported canonicalization method %s", algorithm)
+	}
+	signatureMethod := signedInfo.child(xmldsigNamespace, "SignatureMethod")
+	if signatureMethod == nil {
+		return errors.New("the signature has no signature method")
+	}
+	algorithm, _ := signatureMethod.attr("Algorithm")
+	sm, ok := xmlSignatureMethods[algorithm]
+	if !ok {
+		return fmt.Errorf("unsupported signature method %s", algorithm)
+	}
+	valueElement := signature.child(xmldsigNamespace, "SignatureValue")
+	if valueElement == nil {
+		return errors.New("the signature has no SignatureValue")
+	}
+	value, err := base64.StdEncoding.DecodeString(valueElement.content())
+	if err != nil {
+		return fmt.Errorf("invalid SignatureValue: %w", err)
+	}
+
+	h := sm.hash.New()
+	h.Write(c.canonicalize(signedInfo))
+	digest := h.Sum(nil)
+	for _, cert := range signers {
+		switch key := cert.PublicKey.(type) {
+		case *rsa.PublicKey:
+			if sm.ecdsa {
+				continue
+			}
+			if sm.pss {
+				err = rsa.VerifyPSS(key, sm.hash, digest, value, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto})
+			} else {
+				err = rsa.VerifyPKCS1v15(key, sm.hash, digest, value)
+			}
+			if err == nil {
+				return nil
+			}
+		case *ecdsa.PublicKey:
+			if sm.ecdsa && verifyECDSA(key, digest, value, true) {
+				return nil
+			}
+		}
+	}
+	return errors.New("the signature is not of one of the signing certificates")
+}
+
+// checkXMLReference checks the digest of a reference of the signature to
+// the whole document or to an element of it by its id.
+func checkXMLReference(doc, signature, reference *xmlNode) error {
+	uri, ok := reference.attr("URI")
+	node := doc
+	switch {
+	case !ok:
+		return errors.New("unsupported reference without URI")
+	case strings.HasPrefix(uri, "#") && !strings.Contains(uri, "("):
+		if node = doc.byID(uri[1:]); node == nil {
+			return fmt.Errorf("the referenced element %s does not exist", uri)
+		}
+	case uri != "":
+		return fmt.Errorf("unsupported reference %s", uri)
+	}
+
+	// The node set of a reference is converted with Canonical XML 1.0 when
+	// the transforms do not canonicalize it. Comments are not part of the
+	// node sets of these references.
+	c := xmlCanonicalizer{}
+	canonicalized := false
+	if transforms := reference.child(xmldsigNamespace, "Transforms"); transforms != nil {
+		for _, transform := range transforms.children {
+			if !transform.is(xmldsigNamespace, "Transform") {
+				continue
+			}
+			algorithm, _ := transform.attr("Algorithm")
+			switch {
+			case canonicalized:
+				return fmt.Errorf("unsupported transform %s after canonicalization", algorithm)
+			case algorithm == algorithmEnveloped:
+				c.excluded = signature
+			case c.setMethod(algorithm, transform):
+				canonicalized = true
+			default:
+				return fmt.Errorf("unsupported transform %s", algorithm)
+			}
+		}
+	}
+	c.comments = false
+
+	method := reference.child(xmldsigNamespace, "DigestMethod")
+	if method == nil {
+		return fmt.Errorf("the reference %q has no digest method", uri)
+	}
+	algorithm, _ := method.attr("Algorithm")
+	hash, ok := xmlDigestMethods[algorithm]
+	if !ok {
+		return fmt.Errorf("unsupported digest method %s", algorithm)
+	}
+	valueElement := reference.child(xmldsigNamespace, "DigestValue")
+	if valueElement == nil {
+		return fmt.Errorf("the reference %q has no digest", uri)
+	}
+	value, err := base64.StdEncoding.DecodeString(valueElement.content())
+	if err != nil {
+		return fmt.Errorf("invalid digest of the reference %q: %w", uri, err)
+	}
+
+	h := hash.New()
+	h.Write(c.canonicalize(node))
+	if !bytes.Equal(h.Sum(nil), value) {
+		return fmt.Errorf("the digest of the reference %q does not match", uri)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package verify
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+// signTestXML returns the document with an enveloped signature of key, an
+// ECDSA P-256 or RSA key, over the whole document.
+func signTestXML(t *testing.T, document string, key crypto.Signer) []byte {
+	t.Helper()
+
+	doc, err := parseXMLDocument([]byte(document))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	c := xmlCanonicalizer{exclusive: true}
+	digest := sha256.Sum256(c.canonicalize(doc))
+
+	method := "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha256"
+	if _, ok := key.(*rsa.PrivateKey); ok {
+		method = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	}
+	signedInfo := `<ds:SignedInfo>` +
+		`<ds:CanonicalizationMethod Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"></ds:CanonicalizationMethod>` +
+		`<ds:SignatureMethod Algorithm="` + method + `"></ds:SignatureMethod>` +
+		`<ds:Reference URI=""><ds:Transforms>` +
+		`<ds:Transform Algorithm="http://www.w3.org/2000/09/xmldsig#enveloped-signature"></ds:Transform>` +
+		`<ds:Transform Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"></ds:Transform>` +
+		`</ds:Transforms><ds:DigestMethod Algorithm="http://www.w3.org/2001/04/xmlenc#sha256"></ds:DigestMethod>` +
+		`<ds:DigestValue>` + base64.StdEncoding.EncodeToString(digest[:]) + `</ds:DigestValue></ds:Reference>` +
+		`</ds:SignedInfo>`
+
+	// The canonical SignedInfo declares the namespace of the signature.
+	canonical := strings.Replace(signedInfo, "<ds:SignedInfo>", `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#">`, 1)
+	hashed := sha256.Sum256([]byte(canonical))
+	var value []byte
+	switch key := key.(type) {
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, hashed[:])
+		if err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+		value = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	case *rsa.PrivateKey:
+		value, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+		if err != nil {
+			t.Fatalf("%s", err.Error())
+		}
+	}
+
+	signature := `<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#">` + signedInfo +
+		`<ds:SignatureValue>` + base64.StdEncoding.EncodeToString(value) + `</ds:SignatureValue></ds:Signature>`
+	end := strings.LastIndex(document, "</")
+	return []byte(document[:end] + signature + document[end:])
+}
+
+func TestCanonicalizeXML(t *testing.T) {
+	document := `<?xml version="1.0" encoding="UTF-8"?>
+<?first a?>
+<!-- comment -->
+<a:root xmlns:a="urn:a" xmlns:b="urn:b" xmlns="urn:d" z="1" b:y="2" a:x="3" xml:lang="en"><b:child  c='"&amp;&lt;&#9;'/><plain xmlns="">t&amp;&gt;&#13;</plain><d/></a:root>
+<?last?>`
+	doc, err := parseXMLDocument([]byte(document))
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	child := doc.element().children[0]
+
+	tests := []struct {
+		name      string
+		node      *xmlNode
+		exclusive bool
+		want      string
+	}{
+		{
+			name:      "exclusive",
+			node:      doc,
+			exclusive: true,
+			want: "<?first a?>\n" +
+				`<a:root xmlns:a="urn:a" xmlns:b="urn:b" z="1" xml:lang="en" a:x="3" b:y="2">` +
+				`<b:child c="&quot;&amp;&lt;&#x9;"></b:child><plain>t&amp;&gt;&#xD;</plain><d xmlns="urn:d"></d></a:root>` +
+				"\n<?last?>",
+		},
+		{
+			name: "inclusive",
+			node: doc,
+			want: "<?first a?>\n" +
+				`<a:root xmlns="urn:d" xmlns:a="urn:a" xmlns:b="urn:b" z="1" xml:lang="en" a:x="3" b:y="2">` +
+				`<b:child c="&quot;&amp;&lt;&#x9;"></b:child><plain xmlns="">t&amp;&gt;&#xD;</plain><d></d></a:root>` +
+				"\n<?last?>",
+		},
+		{
+			name:      "exclusive element",
+			node:      child,
+			exclusive: true,
+			want:      `<b:child xmlns:b="urn:b" c="&quot;&amp;&lt;&#x9;"></b:child>`,
+		},
+		{
+			name: "inclusive element",
+			node: child,
+			want: `<b:child xmlns="urn:d" xmlns:a="urn:a" xmlns:b="urn:b" c="&quot;&amp;&lt;&#x9;" xml:lang="en"></b:child>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := xmlCanonicalizer{exclusive: tt.exclusive}
+			if canonical := string(c.canonicalize(tt.node)); canonical != tt.want {
+				t.Errorf("expected\n%s\ngot\n%s", tt.want, canonical)
+			}
+		})
+	}
+}
+
+func TestVerifyXMLSignature(t *testing.T) {
+	const document = `<?xml version="1.0" encoding="UTF-8"?>
+<List xmlns="urn:list" xmlns:x="urn:x">
+  <Entry x:id="1">Trusted</Entry>
+</List>`
+	cert, key := newTestCRLIssuer(t, "pdfsign List Signer")
+	other, _ := newTestCRLIssuer(t, "pdfsign Other Signer")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	rsaCert := &x509.Certificate{PublicKey: &rsaKey.PublicKey}
+
+	signed := string(signTestXML(t, document, key))
+	tests := []struct {
+		name    string
+		data    string
+		signers []*x509.Certificate
+		wantErr string
+	}{
+		{name: "ECDSA", data: signed, signers: []*x509.Certificate{other, cert}},
+		{name: "RSA", data: string(signTestXML(t, document, rsaKey)), signers: []*x509.Certificate{rsaCert}},
+		{name: "other signer", data: signed, signers: []*x509.Certificate{other}, wantErr: "not of one of the signing certificates"},
+		{name: "modified", data: strings.Replace(signed, "Trusted", "Injected", 1), signers: []*x509.Certificate{cert}, wantErr: "does not match"},
+		{name: "unsigned", data: document, signers: []*x509.Certificate{cert}, wantErr: "not signed"},
+		{
+			name:    "signature not enveloped by the document element",
+			data:    strings.Replace(strings.Replace(signed, "</Entry>", "", 1), "</ds:Signature>", "</ds:Signature></Entry>", 1),
+			signers: []*x509.Certificate{cert},
+			wantErr: "not signed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyXMLSignature([]byte(tt.data), tt.signers)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("%s", err.Error())
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected an error with %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}